@@ -32,6 +32,9 @@ IN_CCI = os.getenv("IN_CCI") == "1"
 CCI_APP_IMAGE = os.getenv("CCI_APP_IMAGE")
 CCI_MOUNT_IMAGE = os.getenv("CCI_MOUNT_IMAGE")
 IN_VCI = os.getenv("IN_VCI") == "1"
+# run the suite in a dual-stack cluster, with CSI using IPv6 if "ipv6"
+IP_FAMILY = os.getenv("IP_FAMILY", "")
+IPV6 = IP_FAMILY == "ipv6"
 
 GLOBAL_MOUNTPOINT = "/mnt/jfs"
 FORMAT = '%(asctime)s %(message)s'
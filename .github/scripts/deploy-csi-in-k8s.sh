@@ -3,6 +3,12 @@
 function main() {
   deployMode=$1
   withoutKubelet=$2
+  if [ "${deployMode}" == "upgrade-to-dev" ]; then
+    # called by the upgrade test, with the previous release deployed by pod-upgrade
+    export dev_tag=${dev_tag:-dev-$(git describe --always)}
+    deploy_csi pod
+    return
+  fi
   prepare_pkg
   echo "deployMode: " $deployMode
   echo "withoutKubelet: " $withoutKubelet
@@ -12,9 +18,23 @@ function main() {
     deploy_webhook
   elif [ $deployMode == "webhook-provisioner" ]; then
     deploy_webhook_provisioner
+  elif [ $deployMode == "pod-upgrade" ]; then
+    deploy_previous_release
   else
     deploy_csi $deployMode
   fi
+  if [ "${IP_FAMILY}" == "ipv6" ]; then
+    set_ipv6
+  fi
+}
+
+function set_ipv6() {
+  # the cluster is dual-stack with IPv4 as the primary family, and controller has no HOST_IP,
+  # tell both components to use IPv6 explicitly
+  sudo microk8s.kubectl -n kube-system set env statefulset/juicefs-csi-controller JUICEFS_IP_FAMILY=ipv6
+  sudo microk8s.kubectl -n kube-system set env daemonset/juicefs-csi-node JUICEFS_IP_FAMILY=ipv6
+  sudo microk8s.kubectl -n kube-system rollout status statefulset/juicefs-csi-controller --timeout=5m
+  sudo microk8s.kubectl -n kube-system rollout status daemonset/juicefs-csi-node --timeout=5m
 }
 
 function prepare_pkg() {
@@ -76,6 +96,24 @@ function deploy_csi() {
   done
 }
 
+function deploy_previous_release() {
+  # the latest release by default, set PREVIOUS_VERSION to test upgrading from another one
+  if [ -z "${PREVIOUS_VERSION}" ]; then
+    PREVIOUS_VERSION=$(curl -s https://api.github.com/repos/juicedata/juicefs-csi-driver/releases/latest | jq -r .tag_name)
+  fi
+  echo "Previous version: " $PREVIOUS_VERSION
+  sudo microk8s.kubectl delete -f ${GITHUB_WORKSPACE}/deploy/webhook.yaml
+  sudo microk8s.kubectl label ns default juicefs.com/enable-injection=false
+  curl -sSL https://raw.githubusercontent.com/juicedata/juicefs-csi-driver/${PREVIOUS_VERSION}/deploy/k8s.yaml |
+    sed -e 's@/var/lib/kubelet@/var/snap/microk8s/common/var/lib/kubelet@g' | sudo microk8s.kubectl apply -f -
+  sudo microk8s.kubectl -n kube-system rollout status statefulset/juicefs-csi-controller --timeout=5m
+  sudo microk8s.kubectl -n kube-system rollout status daemonset/juicefs-csi-node --timeout=5m
+  node_pod=$(sudo microk8s.kubectl -n kube-system get pods | grep Running | grep juicefs-csi-node | awk '{print $1}')
+  echo "JUICEFS_CSI_NODE_POD=$node_pod" >>$GITHUB_ENV
+  sudo microk8s.kubectl cp kube-system/$node_pod:/usr/local/bin/juicefs /usr/local/bin/juicefs -c juicefs-plugin &&
+    sudo chmod a+x /usr/local/bin/juicefs && juicefs -V
+}
+
 function deploy_csi_without_kubelet() {
   sudo microk8s.kubectl delete -f ${GITHUB_WORKSPACE}/deploy/webhook.yaml
   sudo microk8s.kubectl label ns default juicefs.com/enable-injection=false
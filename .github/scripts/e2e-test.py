@@ -15,7 +15,7 @@ import os
 
 from kubernetes import config
 
-from config import GLOBAL_MOUNTPOINT, LOG, IN_CCI, IS_CE
+from config import GLOBAL_MOUNTPOINT, LOG, IN_CCI, IS_CE, IP_FAMILY
 from test_case import (
     test_dynamic_mount_image_with_webhook,
     test_static_mount_image_with_webhook,
@@ -48,12 +48,14 @@ from test_case import (
     test_webhook_two_volume,
     test_dynamic_expand,
     test_multi_pvc,
+    test_upgrade_from_previous_release,
     test_mountpod_recreated,
     test_validate_pv,
     test_config,
     test_recreate_mountpod_reload_config,
     test_secret_has_owner_reference,
     test_secret_has_owner_reference_shared_mount,
+    test_dual_stack_service,
 )
 from util import die, mount_on_host, umount, clean_juicefs_volume, deploy_secret_and_sc, check_do_test
 
@@ -70,6 +72,8 @@ if __name__ == "__main__":
             deploy_secret_and_sc()
 
             if test_mode == "pod":
+                if IP_FAMILY != "":
+                    test_dual_stack_service()
                 test_static_cache_clean_upon_umount()
                 test_dynamic_cache_clean_upon_umount()
                 test_static_delete_policy()
@@ -188,6 +192,9 @@ if __name__ == "__main__":
                     test_quota_using_storage_rw()
                     test_dynamic_expand()
 
+            elif test_mode == "pod-upgrade":
+                test_upgrade_from_previous_release()
+
             elif test_mode == "process":
                 test_static_delete_policy()
                 test_static_cache_clean_upon_umount()
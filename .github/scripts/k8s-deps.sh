@@ -19,6 +19,7 @@ function install_deps() {
         && tar -xf /tmp/kustomize.tar.gz -C /usr/local/bin \
         && chmod a+x /usr/local/bin/kustomize \
         && kustomize version
+    configure_ip_family
     sudo snap install microk8s --classic
     sudo microk8s start && sudo microk8s enable dns storage rbac
     sudo mkdir $HOME/.kube
@@ -27,6 +28,29 @@ function install_deps() {
     sudo microk8s config > $HOME/.kube/config
 }
 
+# IP_FAMILY=dual or ipv6 creates a dual-stack cluster with IPv4 as the primary family, as IPv6 has no egress on
+# GitHub runners, CSI is told to use IPv6 in the ipv6 case by deploy-csi-in-k8s.sh
+function configure_ip_family() {
+    if [ "${IP_FAMILY}" != "dual" ] && [ "${IP_FAMILY}" != "ipv6" ]; then
+        return
+    fi
+    # launch configuration of microk8s, must be in place before it's installed
+    sudo mkdir -p /var/snap/microk8s/common/
+    sudo tee /var/snap/microk8s/common/.microk8s.yaml >/dev/null <<EOF
+---
+version: 0.1.0
+extraCNIEnv:
+  IPv4_SUPPORT: true
+  IPv4_CLUSTER_CIDR: 10.1.0.0/16
+  IPv4_SERVICE_CIDR: 10.152.183.0/24
+  IPv6_SUPPORT: true
+  IPv6_CLUSTER_CIDR: fd02::/64
+  IPv6_SERVICE_CIDR: fd99::/108
+extraSANs:
+  - 10.152.183.1
+EOF
+}
+
 function add_kube_resolv() {
     local kube_dns_ip=$(sudo microk8s.kubectl -n kube-system get svc/kube-dns -o 'go-template={{.spec.clusterIP}}')
     if [ -z "$kube_dns_ip" ]; then
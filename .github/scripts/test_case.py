@@ -20,7 +20,7 @@ from kubernetes import client
 
 from config import KUBE_SYSTEM, IS_CE, RESOURCE_PREFIX, \
     SECRET_NAME, STORAGECLASS_NAME, GLOBAL_MOUNTPOINT, \
-    LOG, PVs, META_URL, MOUNT_MODE, CCI_MOUNT_IMAGE, IN_CCI
+    LOG, PVs, META_URL, MOUNT_MODE, CCI_MOUNT_IMAGE, IN_CCI, IPV6
 from model import PVC, PV, Pod, StorageClass, Deployment, Job, Secret
 from util import check_mount_point, wait_dir_empty, wait_dir_not_empty, \
     get_only_mount_pod_name, get_mount_pods, check_pod_ready, check_mount_pod_refs, gen_random_string, get_vol_uuid, \
@@ -266,6 +266,14 @@ def test_deployment_use_pv_rw():
                 subprocess.check_call(["kubectl", "logs", pod_name, "-c", "app", "-n", "default"])
         raise Exception("Mount point of /mnt/jfs/{} are not ready within 5 min.".format(out_put))
 
+    if IPV6 and IS_CE and MOUNT_MODE == "pod":
+        LOG.info("Check metrics address of mount pod in IPv6 cluster..")
+        mount_pod_name = get_only_mount_pod_name(volume_id)
+        mount_pod = client.CoreV1Api().read_namespaced_pod(name=mount_pod_name, namespace=KUBE_SYSTEM)
+        cmd = " ".join(mount_pod.spec.containers[0].command or [])
+        if "metrics=[::]:" not in cmd:
+            raise Exception("Mount pod {} does not listen metrics on IPv6: {}".format(mount_pod_name, cmd))
+
     # delete test resources
     LOG.info("Remove deployment {}".format(deployment.name))
     deployment.delete()
@@ -3072,4 +3080,110 @@ def test_secret_has_owner_reference_shared_mount():
     dynamic_pvc_2.delete()
 
     LOG.info("Test pass.")
-    return
\ No newline at end of file
+    return
+
+def test_upgrade_from_previous_release():
+    LOG.info("[test case] Upgrade from previous release begin..")
+    # deploy pvc
+    pvc = PVC(name="pvc-upgrade", access_mode="ReadWriteMany", storage_name=STORAGECLASS_NAME, pv="")
+    LOG.info("Deploy pvc {}".format(pvc.name))
+    pvc.create()
+
+    # wait for pvc bound
+    for i in range(0, 60):
+        if pvc.check_is_bound():
+            break
+        time.sleep(1)
+
+    # deploy pod
+    deployment = Deployment(name="app-upgrade", pvc=pvc.name, replicas=1)
+    LOG.info("Deploy deployment {}".format(deployment.name))
+    deployment.create()
+    pod = Pod(name="", deployment_name=deployment.name, replicas=deployment.replicas)
+    LOG.info("Watch for pods of {} for success.".format(deployment.name))
+    result = pod.watch_for_success()
+    if not result:
+        raise Exception("Pods of deployment {} are not ready within 10 min.".format(deployment.name))
+
+    # check mount point
+    LOG.info("Check mount point..")
+    volume_id = pvc.get_volume_id()
+    LOG.info("Get volume_id {}".format(volume_id))
+    check_path = volume_id + "/out.txt"
+    result = check_mount_point(check_path)
+    if not result:
+        raise Exception("mount Point of /jfs/{}/out.txt are not ready within 5 min.".format(volume_id))
+
+    # record mount pod and app pods created by the previous release
+    mount_pod_name = get_only_mount_pod_name(volume_id)
+    mount_pod = client.CoreV1Api().read_namespaced_pod(name=mount_pod_name, namespace=KUBE_SYSTEM)
+    app_pods = client.CoreV1Api().list_namespaced_pod(
+        namespace="default",
+        label_selector="deployment={}".format(deployment.name)
+    )
+    app_pod_uids = {po.metadata.uid for po in app_pods.items}
+    LOG.info("Mount pod {} created by previous release".format(mount_pod_name))
+
+    # upgrade csi to the dev image
+    upgrade_cmd = os.getenv("UPGRADE_CMD", "./deploy-csi-in-k8s.sh upgrade-to-dev")
+    LOG.info("Upgrade csi: {}".format(upgrade_cmd))
+    subprocess.check_call(upgrade_cmd, shell=True)
+
+    # the mount pod must survive the upgrade
+    LOG.info("Check mount pod {} after upgrade..".format(mount_pod_name))
+    time.sleep(30)
+    new_mount_pod = client.CoreV1Api().read_namespaced_pod(name=mount_pod_name, namespace=KUBE_SYSTEM)
+    if new_mount_pod.metadata.uid != mount_pod.metadata.uid:
+        raise Exception("Mount pod {} is recreated during upgrade".format(mount_pod_name))
+    if not check_pod_ready(new_mount_pod):
+        raise Exception("Mount pod {} is not ready after upgrade".format(mount_pod_name))
+
+    # app pods must neither be recreated nor restarted
+    app_pods = client.CoreV1Api().list_namespaced_pod(
+        namespace="default",
+        label_selector="deployment={}".format(deployment.name)
+    )
+    for po in app_pods.items:
+        if po.metadata.uid not in app_pod_uids:
+            raise Exception("App pod {} is recreated during upgrade".format(po.metadata.name))
+        for cs in po.status.container_statuses:
+            if cs.restart_count != 0:
+                raise Exception("App pod {} restarted during upgrade".format(po.metadata.name))
+    result = check_mount_point(check_path)
+    if not result:
+        raise Exception("mount Point of /jfs/{}/out.txt are not ready after upgrade.".format(volume_id))
+
+    # new app pods reuse the mount pod adopted by the new version
+    LOG.info("Scale deployment {} to 2 replicas..".format(deployment.name))
+    deployment.update_replicas(2)
+    pod = Pod(name="", deployment_name=deployment.name, replicas=2)
+    result = pod.watch_for_success()
+    if not result:
+        raise Exception("Pods of deployment {} are not ready within 10 min.".format(deployment.name))
+    if get_only_mount_pod_name(volume_id) != mount_pod_name:
+        raise Exception("Mount pod of volume {} is not reused after upgrade".format(volume_id))
+    LOG.info("Test pass.")
+
+    # delete test resources
+    LOG.info("Remove deployment {}".format(deployment.name))
+    deployment.delete()
+    pod = Pod(name="", deployment_name=deployment.name, replicas=2)
+    LOG.info("Watch for pods of deployment {} for delete.".format(deployment.name))
+    result = pod.watch_for_delete(2)
+    if not result:
+        raise Exception("Pods of deployment {} are not delete within 5 min.".format(deployment.name))
+    LOG.info("Remove pvc {}".format(pvc.name))
+    pvc.delete()
+    return
+
+
+def test_dual_stack_service():
+    LOG.info("[test case] Services of CSI in dual-stack cluster begin..")
+    svc = client.CoreV1Api().read_namespaced_service(name="juicefs-csi-dashboard", namespace=KUBE_SYSTEM)
+    if svc.spec.ip_family_policy != "PreferDualStack":
+        raise Exception("Service {} has ipFamilyPolicy {}, expect PreferDualStack".format(svc.metadata.name, svc.spec.ip_family_policy))
+    if sorted(svc.spec.ip_families or []) != ["IPv4", "IPv6"]:
+        raise Exception("Service {} is not dual-stack: {}".format(svc.metadata.name, svc.spec.ip_families))
+    LOG.info("Service {} has cluster IPs {}".format(svc.metadata.name, svc.spec.cluster_i_ps))
+    LOG.info("Test pass.")
+    return
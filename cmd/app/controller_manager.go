@@ -68,7 +68,7 @@ func NewControllerManager(
 	opts := ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
-			BindAddress: "0.0.0.0:8084",
+			BindAddress: ":8084",
 		},
 		LeaderElection:             leaderElection,
 		LeaderElectionID:           "csi-controller.juicefs.com",
@@ -135,6 +135,15 @@ func (m *ControllerManager) Start(ctx context.Context) error {
 		}
 	}
 
+	if config.StorageClassProtection {
+		if err := (mountctrl.NewStorageClassController(m.client)).SetupWithManager(m.mgr); err != nil {
+			log.Error(err, "Register storageclass controller error")
+			return err
+		}
+	} else if err := mountctrl.ReleaseStorageClasses(ctx, m.client); err != nil {
+		log.Error(err, "Release storageclasses held by storageclass protection error, remove the finalizer by hand", "finalizer", common.StorageClassFinalizer)
+	}
+
 	if config.CacheClientConf {
 		if err := (mountctrl.NewPVController(m.client)).SetupWithManager(m.mgr); err != nil {
 			log.Error(err, "Register pv controller error")
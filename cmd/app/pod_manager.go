@@ -57,7 +57,7 @@ func NewPodManager() (*PodManager, error) {
 	mgr, err := ctrl.NewManager(conf, ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
-			BindAddress: "0.0.0.0:8082",
+			BindAddress: ":8082",
 		},
 		LeaderElectionResourceLock: "leases",
 		LeaderElectionID:           "pod.juicefs.com",
@@ -0,0 +1,84 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/bench"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var benchOpts = bench.Options{Namespace: "default", Tool: bench.ToolJuiceFS}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench PVC [-- ARGS]",
+	Short: "run juicefs bench or fio in a temporary pod bound to the PVC, and record the result in a configmap",
+	Example: `  juicefs-csi-driver bench -n default my-pvc
+  juicefs-csi-driver bench -n default my-pvc -- --big-file-size 4096 --threads 4
+  juicefs-csi-driver bench -n default my-pvc --tool fio --image <image with fio> -- --rw=randread --bs=4k --size=1G`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		benchOpts.PVC = args[0]
+		benchOpts.Args = args[1:]
+		if err := runBench(ctrl.SetupSignalHandler(), os.Stdout); err != nil {
+			log.Error(err, "failed to run bench")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	benchCmd.Flags().StringVarP(&benchOpts.Namespace, "namespace", "n", benchOpts.Namespace, "namespace of the PVC")
+	benchCmd.Flags().StringVar(&benchOpts.Tool, "tool", benchOpts.Tool, "benchmark tool, juicefs or fio")
+	benchCmd.Flags().StringVar(&benchOpts.Image, "image", "", "image of the bench pod, defaults to the mount image of community edition, which has no fio")
+	benchCmd.Flags().DurationVar(&benchOpts.Timeout, "timeout", 0, "timeout of the bench, 30m by default")
+	benchCmd.Flags().BoolVar(&benchOpts.Keep, "keep", false, "keep the bench pod after it finishes")
+}
+
+func runBench(ctx context.Context, out io.Writer) error {
+	client, err := k8sclient.NewClient()
+	if err != nil {
+		return err
+	}
+	result, err := bench.Run(ctx, client, benchOpts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "PVC %s/%s of StorageClass %q, %s %s in %s\n\n", result.Namespace, result.PVC, result.StorageClass, result.Tool, result.Phase, result.Duration)
+	if len(result.Metrics) > 0 {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ITEM\tVALUE\tCOST")
+		for _, m := range result.Metrics {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", m.Item, m.Value, m.Cost)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(out, result.Output)
+	}
+	fmt.Fprintf(out, "\nResult recorded in ConfigMap %s/%s\n", result.Namespace, result.Name)
+	return nil
+}
@@ -32,7 +32,9 @@ import (
 	"github.com/juicedata/juicefs-csi-driver/cmd/app"
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/driver"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
 	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/tracing"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
 )
 
@@ -72,8 +74,10 @@ func parseControllerConfig() {
 
 	config.NodeName = os.Getenv("NODE_NAME")
 	config.Namespace = os.Getenv("JUICEFS_MOUNT_NAMESPACE")
+	config.PodName = os.Getenv("POD_NAME")
 	config.MountPointPath = os.Getenv("JUICEFS_MOUNT_PATH")
 	config.JFSConfigPath = os.Getenv("JUICEFS_CONFIG_PATH")
+	config.IPv6 = config.DetectIPFamily()
 
 	if mountPodImage := os.Getenv("JUICEFS_CE_MOUNT_IMAGE"); mountPodImage != "" {
 		config.DefaultCEMountImage = mountPodImage
@@ -94,21 +98,25 @@ func parseControllerConfig() {
 	if os.Getenv("STORAGE_CLASS_SHARE_MOUNT") == "true" {
 		config.StorageClassShareMount = true
 	}
+	client, err := k8s.NewClient()
+	if err != nil {
+		log.Error(err, "Can't get k8s client")
+		os.Exit(1)
+	}
+	verifyPermissions(client, k8s.ComponentController, k8s.Features{
+		LeaderElection:         leaderElection,
+		Webhook:                config.Webhook,
+		StorageClassProtection: config.StorageClassProtection,
+	})
 	if !config.Webhook {
 		// When not in sidecar mode, we should inherit attributes from CSI Node pod.
-		k8sclient, err := k8s.NewClient()
-		if err != nil {
-			log.Error(err, "Can't get k8s client")
-			os.Exit(1)
-		}
-
 		labelSelector := &metav1.LabelSelector{
 			MatchLabels: map[string]string{
 				"app": "juicefs-csi-node",
 			},
 		}
 
-		pods, err := k8sclient.ListPod(context.TODO(), config.Namespace, labelSelector, nil)
+		pods, err := client.ListPod(context.TODO(), config.Namespace, labelSelector, nil)
 		if err != nil || len(pods) == 0 {
 			log.Error(err, "Can't get CSI pods")
 			os.Exit(1)
@@ -130,18 +138,26 @@ func controllerRun(ctx context.Context) {
 	}
 
 	// http server for pprof
-	go func() {
-		port := 6060
-		for {
-			if err := http.ListenAndServe(fmt.Sprintf("localhost:%d", port), nil); err != nil {
-				log.Error(err, "failed to start pprof server")
-				os.Exit(1)
+	if debugAddr != "" {
+		go serveDebug()
+	} else {
+		go func() {
+			port := 6060
+			for {
+				if err := http.ListenAndServe(fmt.Sprintf("localhost:%d", port), nil); err != nil {
+					log.Error(err, "failed to start pprof server")
+					os.Exit(1)
+				}
+				port++
 			}
-			port++
-		}
-	}()
+		}()
+	}
+
+	tracing.Init("juicefs-csi-controller")
+	events.Setup("juicefs-csi-controller", "")
 
 	registerer, registry := util.NewPrometheus(config.NodeName)
+	config.FeatureGates.RegisterMetrics(registerer)
 	// http server for metrics
 	go func() {
 		mux := http.NewServeMux()
@@ -156,7 +172,7 @@ func controllerRun(ctx context.Context) {
 			Addr:    fmt.Sprintf(":%d", config.WebPort),
 			Handler: mux,
 		}
-		if err := server.ListenAndServe(); err != nil {
+		if err := listenAndServeMetrics(server); err != nil {
 			log.Error(err, "failed to start metrics server")
 		}
 	}()
@@ -189,6 +205,13 @@ func controllerRun(ctx context.Context) {
 		log.Error(err, "fail to create driver")
 		os.Exit(1)
 	}
+	drv.DetectQuotaSupport()
+	go drv.RunScratchCollector(ctx)
+	go drv.RunOrphanAuditor(ctx)
+	go drv.RunCapacitySyncer(ctx)
+	go drv.RunStaleSessionReaper(ctx)
+	go drv.RunCheckpointController(ctx)
+	go drv.RunMetaProber(ctx)
 	go func() {
 		<-ctx.Done()
 		drv.Stop()
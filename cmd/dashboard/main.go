@@ -35,6 +35,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -50,6 +51,8 @@ import (
 
 	jfsConfig "github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/dashboard"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/debug"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/serving"
 )
 
 func init() {
@@ -81,6 +84,9 @@ var (
 
 	enableManager bool
 
+	servingOpts serving.Options
+	debugAddr   string
+
 	// for basic auth
 	USERNAME string
 	PASSWORD string
@@ -110,6 +116,11 @@ func main() {
 	cmd.PersistentFlags().StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "Namespace where the leader election resource lives. Defaults to the pod namespace if not set.")
 	cmd.PersistentFlags().DurationVar(&leaderElectionLeaseDuration, "leader-election-lease-duration", 15*time.Second, "Duration, in seconds, that non-leader candidates will wait to force acquire leadership. Defaults to 15 seconds.")
 	cmd.PersistentFlags().BoolVar(&enableManager, "enable-manager", true, "enable manager for cache/index resource")
+	cmd.PersistentFlags().StringVar(&servingOpts.CertFile, "tls-cert-file", "", "certificate file to serve with, served with plain HTTP if not set. Reloaded once changed.")
+	cmd.PersistentFlags().StringVar(&servingOpts.KeyFile, "tls-key-file", "", "private key file of the certificate")
+	cmd.PersistentFlags().StringVar(&servingOpts.ClientCAFile, "client-ca-file", "", "if set, clients must present certificates signed by the CA")
+	cmd.PersistentFlags().BoolVar(&servingOpts.Authorization, "authorization", false, "authorize requests by SubjectAccessReview, requires RBAC rules to create tokenreviews and subjectaccessreviews")
+	cmd.PersistentFlags().StringVar(&debugAddr, "debug-addr", "", "address of the debug server serving pprof and runtime metrics, e.g. :6060, protected the same as the dashboard. pprof is served on localhost:8089 if not set")
 
 	goFlag := goflag.CommandLine
 	klog.InitFlags(goFlag)
@@ -197,14 +208,29 @@ func run() {
 		Handler: router,
 	}
 
+	var clientset kubernetes.Interface
+	if servingOpts.Authorization {
+		if clientset, err = kubernetes.NewForConfig(config); err != nil {
+			log.Error(err, "can't create clientset")
+			os.Exit(1)
+		}
+	}
+
 	go func() {
 		log.Info("listen and serve", "addr", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := serving.ListenAndServe(srv, servingOpts, clientset); err != nil && err != http.ErrServerClosed {
 			log.Error(err, "listen error")
 			os.Exit(1)
 		}
 	}()
 	go func() {
+		if debugAddr != "" {
+			debugSrv := &http.Server{Addr: debugAddr, Handler: debug.Handler()}
+			if err := serving.ListenAndServe(debugSrv, servingOpts, clientset); err != nil {
+				log.Error(err, "debug server error")
+			}
+			return
+		}
 		// pprof server
 		err = http.ListenAndServe("localhost:8089", nil)
 		if err != nil {
@@ -246,7 +272,7 @@ func newManager(conf *rest.Config) (ctrl.Manager, error) {
 	return ctrl.NewManager(conf, ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
-			BindAddress: "0.0.0.0:8082",
+			BindAddress: ":8082",
 		},
 		LeaderElection:          leaderElection,
 		LeaderElectionID:        "dashboard.juicefs.com",
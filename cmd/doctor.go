@@ -0,0 +1,138 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/doctor"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var (
+	doctorOpts       = doctor.Options{ClusterChecks: true}
+	doctorOutput     = "text"
+	doctorJobNode    = ""
+	doctorPrintJob   = false
+	doctorJobTimeout = 5 * time.Minute
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "diagnose the environment of CSI Driver and print a report, exit with 1 if any check fails",
+	Example: `  juicefs-csi-driver doctor
+  juicefs-csi-driver doctor --job node-1 -o json
+  juicefs-csi-driver doctor --job node-1 --print-job | kubectl apply -f -`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if doctorOutput != "text" && doctorOutput != "json" && doctorOutput != "yaml" {
+			log.Info("--output should be one of text, json and yaml")
+			os.Exit(1)
+		}
+		failed, err := runDoctor(ctrl.SetupSignalHandler(), os.Stdout)
+		if err != nil {
+			log.Error(err, "failed to diagnose")
+			os.Exit(1)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	doctorCmd.Flags().StringVarP(&doctorOpts.Namespace, "namespace", "n", "", "namespace of CSI Driver, defaults to env JUICEFS_MOUNT_NAMESPACE or kube-system")
+	doctorCmd.Flags().BoolVar(&doctorOpts.NodeChecks, "node-checks", false, "check the node the command runs on: kubelet root dir, mount propagation, SELinux and FUSE device")
+	doctorCmd.Flags().BoolVar(&doctorOpts.ClusterChecks, "cluster-checks", true, "check through the API server: RBAC, webhooks and metadata engines of StorageClasses")
+	doctorCmd.Flags().StringVar(&doctorOpts.KubeletRootDir, "kubelet-root-dir", "", "root-dir of kubelet, detected if not set")
+	doctorCmd.Flags().DurationVar(&doctorOpts.Timeout, "timeout", 5*time.Second, "timeout of connecting to webhooks and metadata engines")
+	doctorCmd.Flags().StringVarP(&doctorOutput, "output", "o", doctorOutput, "format of the report: text, json or yaml")
+	doctorCmd.Flags().StringVar(&doctorJobNode, "job", "", "run the node checks in a Job on this node, with the image and service account of CSI Node")
+	doctorCmd.Flags().BoolVar(&doctorPrintJob, "print-job", false, "print the Job of --job instead of running it")
+	doctorCmd.Flags().DurationVar(&doctorJobTimeout, "job-timeout", doctorJobTimeout, "timeout of waiting for the Job of --job to finish")
+}
+
+func runDoctor(ctx context.Context, out io.Writer) (bool, error) {
+	config.NodeName = os.Getenv("NODE_NAME")
+	if doctorOpts.Namespace == "" {
+		doctorOpts.Namespace = os.Getenv("JUICEFS_MOUNT_NAMESPACE")
+	}
+	var client *k8sclient.K8sClient
+	if doctorOpts.ClusterChecks || doctorJobNode != "" {
+		var err error
+		if client, err = k8sclient.NewClient(); err != nil {
+			return false, err
+		}
+	}
+
+	if doctorJobNode != "" {
+		job, err := doctor.GenJob(ctx, client, doctorOpts, doctorJobNode)
+		if err != nil {
+			return false, err
+		}
+		if doctorPrintJob {
+			return false, printObject(job, out)
+		}
+		// the node checks run in the Job, instead of where the command runs
+		doctorOpts.NodeChecks = false
+		report := doctor.Run(ctx, client, doctorOpts)
+		log.Info("run node checks in job", "node", doctorJobNode, "job", job.Name)
+		nodeReport, err := doctor.RunJob(ctx, client, job, doctorJobTimeout)
+		if err != nil {
+			return false, err
+		}
+		report.Merge(nodeReport)
+		return report.Failed(), printReport(report, out)
+	}
+
+	report := doctor.Run(ctx, client, doctorOpts)
+	return report.Failed(), printReport(report, out)
+}
+
+func printReport(report *doctor.Report, out io.Writer) error {
+	switch doctorOutput {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	case "yaml":
+		return printObject(report, out)
+	default:
+		return report.Print(out)
+	}
+}
+
+func printObject(obj interface{}, out io.Writer) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
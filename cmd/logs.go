@@ -0,0 +1,145 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+var (
+	logsPVC            = ""
+	logsTarget         = ""
+	logsNode           = ""
+	logsMountNamespace = ""
+	logsTail           = int64(100)
+	logsFollow         = false
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "print logs of the mount pods serving a PVC or a target path",
+	Example: `  juicefs-csi-driver logs --pvc default/data --tail 200
+  juicefs-csi-driver logs --target /var/lib/kubelet/pods/<pod-uid>/volumes/kubernetes.io~csi/<pv>/mount -f`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if (logsPVC == "") == (logsTarget == "") {
+			log.Info("please specify either --pvc or --target")
+			os.Exit(1)
+		}
+		if err := printMountPodLogs(ctrl.SetupSignalHandler(), os.Stdout); err != nil {
+			log.Error(err, "failed to print mount pod logs")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	logsCmd.Flags().StringVar(&logsPVC, "pvc", "", "PVC in the format of <namespace>/<name>, or <name> in default namespace")
+	logsCmd.Flags().StringVar(&logsTarget, "target", "", "target path of the volume in application pod")
+	logsCmd.Flags().StringVar(&logsNode, "node", "", "only print logs of the mount pods on this node")
+	logsCmd.Flags().StringVar(&logsMountNamespace, "mount-namespace", "", "namespace of mount pods, defaults to env JUICEFS_MOUNT_NAMESPACE or kube-system")
+	logsCmd.Flags().Int64Var(&logsTail, "tail", 100, "lines of recent logs to print, -1 for all")
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "follow the logs")
+}
+
+func printMountPodLogs(ctx context.Context, out io.Writer) error {
+	client, err := k8sclient.NewClient()
+	if err != nil {
+		return err
+	}
+	namespace := logsMountNamespace
+	if namespace == "" {
+		namespace = os.Getenv("JUICEFS_MOUNT_NAMESPACE")
+	}
+	if namespace == "" {
+		namespace = "kube-system"
+	}
+
+	var pods []corev1.Pod
+	if logsPVC != "" {
+		pvcNamespace, pvcName := "default", logsPVC
+		if parts := strings.SplitN(logsPVC, "/", 2); len(parts) == 2 {
+			pvcNamespace, pvcName = parts[0], parts[1]
+		}
+		pods, err = resource.GetMountPodsOfPVC(ctx, client, namespace, pvcNamespace, pvcName, logsNode)
+	} else {
+		pods, err = resource.GetMountPodsOfTarget(ctx, client, namespace, logsTarget, logsNode)
+	}
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("no mount pod found in namespace %s", namespace)
+	}
+
+	// prefix lines with the pod name only if there are multiple mount pods
+	prefix := len(pods) > 1
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		lastErr error
+	)
+	for _, pod := range pods {
+		wg.Add(1)
+		go func(pod corev1.Pod) {
+			defer wg.Done()
+			if err := streamMountPodLog(ctx, client, pod, prefix, out, &mu); err != nil {
+				mu.Lock()
+				lastErr = fmt.Errorf("pod %s: %v", pod.Name, err)
+				mu.Unlock()
+			}
+		}(pod)
+	}
+	wg.Wait()
+	return lastErr
+}
+
+func streamMountPodLog(ctx context.Context, client *k8sclient.K8sClient, pod corev1.Pod, prefix bool, out io.Writer, mu *sync.Mutex) error {
+	stream, err := client.StreamPodLog(ctx, pod.Name, pod.Namespace, common.MountContainerName, logsTail, logsFollow)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		mu.Lock()
+		if prefix {
+			fmt.Fprintf(out, "[%s/%s] %s\n", pod.Spec.NodeName, pod.Name, scanner.Text())
+		} else {
+			fmt.Fprintln(out, scanner.Text())
+		}
+		mu.Unlock()
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
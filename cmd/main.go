@@ -19,6 +19,7 @@ package main
 import (
 	goflag "flag"
 	"fmt"
+	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"strings"
@@ -30,6 +31,9 @@ import (
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/driver"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/debug"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/serving"
 
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -51,11 +55,17 @@ var (
 
 	podManager         bool
 	reconcilerInterval int
+	kubeletRootDir     string
+	mountPointPath     string
+	auditSink          string
 
 	leaderElection              bool
 	leaderElectionNamespace     string
 	leaderElectionLeaseDuration time.Duration
 
+	metricsServing serving.Options
+	debugAddr      string
+
 	log = klog.NewKlogr().WithName("main")
 )
 
@@ -90,11 +100,24 @@ func main() {
 	cmd.PersistentFlags().BoolVar(&formatInPod, "format-in-pod", false, "Put format/auth in pod")
 	cmd.PersistentFlags().BoolVar(&process, "by-process", false, "CSI Driver run juicefs in process or not. default false.")
 	cmd.PersistentFlags().StringVar(&configPath, "config", "", "Paths to a csi config file. default empty")
+	cmd.PersistentFlags().DurationVar(&config.ShutdownTimeout, "shutdown-timeout", config.ShutdownTimeout, "Duration that in-flight CSI requests are waited for on termination before the driver exits, should be less than terminationGracePeriodSeconds of the pod.")
+	cmd.PersistentFlags().BoolVar(&config.UpgradeSafeShutdown, "upgrade-safe-shutdown", false, "Leave mounts intact on termination and record them, so that the next version of the node plugin adopts them on start.")
+
+	cmd.PersistentFlags().Var(config.FeatureGates, "feature-gates", "A set of key=value pairs that describe feature gates for experimental features. Options are:\n"+strings.Join(config.FeatureGates.KnownFeatures(), "\n"))
 
 	cmd.PersistentFlags().BoolVar(&leaderElection, "leader-election", false, "Enables leader election. If leader election is enabled, additional RBAC rules are required. ")
 	cmd.PersistentFlags().StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "Namespace where the leader election resource lives. Defaults to the pod namespace if not set.")
 	cmd.PersistentFlags().DurationVar(&leaderElectionLeaseDuration, "leader-election-lease-duration", 15*time.Second, "Duration, in seconds, that non-leader candidates will wait to force acquire leadership. Defaults to 15 seconds.")
 
+	cmd.PersistentFlags().StringVar(&metricsServing.CertFile, "metrics-tls-cert-file", "", "Certificate file of the metrics server, served with plain HTTP if not set. Reloaded once changed.")
+	cmd.PersistentFlags().StringVar(&metricsServing.KeyFile, "metrics-tls-key-file", "", "Private key file of the metrics server.")
+	cmd.PersistentFlags().StringVar(&metricsServing.ClientCAFile, "metrics-client-ca-file", "", "If set, clients of the metrics server must present certificates signed by the CA.")
+	cmd.PersistentFlags().StringVar(&debugAddr, "debug-addr", "", "Address of the debug server serving pprof and runtime metrics of goroutines, GC and workqueues, e.g. :6060, protected the same as the metrics server. pprof is served on localhost only if not set.")
+	cmd.PersistentFlags().BoolVar(&metricsServing.Authorization, "metrics-authorization", false, "Authorize requests to the metrics server by SubjectAccessReview, requires RBAC rules to create tokenreviews and subjectaccessreviews.")
+
+	cmd.PersistentFlags().BoolVar(&config.VerifyPermissions, "verify-permissions", true, "Check the service account has all the permissions the component requires at startup, and exit with the missing ones reported if not.")
+	cmd.PersistentFlags().BoolVar(&config.NamespaceScoped, "namespace-scoped", false, "Only create mount pods, jobs and their secrets in the namespace of CSI Driver, whose permissions are granted by a Role instead of the ClusterRole, see the rbac command.")
+
 	// controller flags
 	cmd.Flags().BoolVar(&provisioner, "provisioner", false, "Enable provisioner in controller. default false.")
 	cmd.Flags().BoolVar(&cacheConf, "cache-client-conf", false, "Cache client config file. default false.")
@@ -102,16 +125,55 @@ func main() {
 	cmd.Flags().StringVar(&certDir, "webhook-cert-dir", "/etc/webhook/certs", "Admission webhook cert/key dir.")
 	cmd.Flags().IntVar(&webhookPort, "webhook-port", 9444, "Admission webhook port.")
 	cmd.Flags().BoolVar(&validationWebhook, "validating-webhook", false, "Enable validation webhook in controller. default false.")
+	cmd.Flags().StringVar(&config.PVCDefaultsConfigMap, "pvc-defaults-configmap", "juicefs-pvc-defaults", "ConfigMap in the namespace of the driver with the default annotations and labels injected into PVCs of juicefs StorageClasses by the webhook, empty to disable.")
+	cmd.Flags().DurationVar(&config.OrphanAuditInterval, "orphan-audit-interval", 0, "Interval of auditing directories in file systems of StorageClasses which are not used by any PV, disabled if 0.")
+	cmd.Flags().DurationVar(&config.OrphanRetention, "orphan-retention", 0, "Orphan directories not modified in this period are deleted, only reported if 0.")
+	cmd.Flags().DurationVar(&config.CapacitySyncInterval, "capacity-sync-interval", 0, "Interval of comparing the quota of statically provisioned PVs with their capacity, disabled if 0.")
+	cmd.Flags().BoolVar(&config.StrictVolumeContext, "strict-volume-context", false, "Reject provisioning volumes with StorageClass parameters unknown to the driver, only log them as warnings if false.")
+	cmd.Flags().BoolVar(&config.CapacitySyncCorrect, "capacity-sync-correct", false, "Set the quota of static PVs to their capacity on drift, only reported by events if false.")
+	cmd.Flags().DurationVar(&config.StaleSessionInterval, "stale-session-interval", 0, "Interval of cleaning up mount pods left on deleted nodes and reporting the sessions of their clients, disabled if 0.")
+	cmd.Flags().BoolVar(&config.StorageClassProtection, "storageclass-protection", false, "Hold the deletion of juicefs StorageClasses until no PV is provisioned from them, and keep their parameters on the PVs.")
+	cmd.Flags().BoolVar(&config.AdminByJob, "admin-by-job", false, "Set quota and create subdirs of volumes in short-lived jobs with the mount image, so that CSI containers don't run juicefs commands, applicable to mount pod mode only.")
 
 	// node flags
 	cmd.Flags().BoolVar(&podManager, "enable-manager", false, "Enable pod manager in csi node. default false.")
+	cmd.Flags().BoolVar(&config.ThrottleWatcher, "throttle-watcher", false, "Recreate the mount pods on the node by smooth upgrade when the bandwidth limit annotations of their PVCs change, which watches all PVCs of the cluster. Applicable to mount pod mode only.")
+	cmd.Flags().BoolVar(&config.LabelNode, "label-node", false, "Label the node with juicefs.com/fs-<name>=mounted for each file system mounted on it, as a hint to schedule pods where the cache is warm.")
+	cmd.Flags().IntVar(&config.TargetRetryTimes, "target-retry-times", config.TargetRetryTimes, "Retries of creating and bind mounting the target path of pods when it's busy, e.g. still unmounting for the previous pod.")
+	cmd.Flags().DurationVar(&config.TargetRetryInterval, "target-retry-interval", config.TargetRetryInterval, "Interval between the retries of creating and bind mounting the target path.")
+	cmd.Flags().DurationVar(&config.WritebackFlushTimeout, "writeback-flush-timeout", config.WritebackFlushTimeout, "Default terminationGracePeriodSeconds of mount pods with the writeback option, which wait for the staged data to be uploaded before they exit.")
+	cmd.Flags().DurationVar(&config.FuseCheckInterval, "fuse-check-interval", config.FuseCheckInterval, "Interval of checking the FUSE module of the node, which is checked at startup only if 0.")
+	cmd.Flags().IntVar(&config.FuseExpectedMounts, "fuse-expected-mounts", 0, "Number of mounts expected on the node, fs.inotify.max_user_instances (an inotify limit of the kernel, not a FUSE one) is checked against it, defaults to the pod capacity of the node.")
 	cmd.Flags().IntVar(&reconcilerInterval, "reconciler-interval", 5, "interval (default 5s) for reconciler")
+	cmd.Flags().StringVar(&kubeletRootDir, "kubelet-root-dir", "", "root-dir of kubelet, detected from kubelet process or CSI Node pod if not set. Also read from env KUBELET_ROOT_DIR.")
+	cmd.Flags().StringVar(&mountPointPath, "mount-point-path", "", "host path where mount pods propagate the mount points, overrides env JUICEFS_MOUNT_PATH.")
+	cmd.Flags().StringVar(&auditSink, "audit-sink", "", "where audit events of access log are shipped, stdout if empty, or an HTTP URL which events are POSTed to. Also read from env JUICEFS_AUDIT_SINK.")
+	cmd.Flags().StringVar(&config.MountMetricsPortRange, "mount-metrics-port-range", "", "Range of metrics ports assigned to mount pods of community edition on the host network, e.g. 9600-9699, unique on each node and declared as the metrics port of the pod. Random ports are used if not set.")
+	cmd.Flags().StringVar(&config.NFSExportImage, "nfs-export-image", "", "Image of the NFS server exporting volumes of StorageClasses with juicefs/remote-mount from storage nodes, it serves $EXPORT_PATH over NFSv4 on port 2049.")
+	cmd.Flags().Int64Var(&config.RootlessUID, "rootless-uid", 1000, "User and group ID of mount pods of StorageClasses with juicefs/rootless, the FUSE mount points mounted for them are owned by it.")
+	cmd.Flags().BoolVar(&config.MountPodHardened, "mount-pod-hardened", false, "Generate mount pods with read-only root filesystems, seccomp and AppArmor profiles and no capabilities, the FUSE mount points are mounted by the node service for images supporting fuse fd passing.")
+	cmd.Flags().BoolVar(&config.MountPodHardenedRelaxed, "mount-pod-hardened-relaxed", false, "Keep SYS_ADMIN and unconfined seccomp and AppArmor profiles in hardened mount pods, for older kernels and runtimes whose default profiles block syscalls of the client.")
+	cmd.Flags().StringVar(&config.MountPodSeccompProfile, "mount-pod-seccomp-profile", "runtime/default", "Seccomp profile of hardened mount pods, runtime/default or localhost/<path relative to the kubelet seccomp directory>.")
+	cmd.Flags().StringVar(&config.MountPodAppArmorProfile, "mount-pod-apparmor-profile", "runtime/default", "AppArmor profile of hardened mount pods, runtime/default, localhost/<profile loaded on the node> or empty to leave it unset.")
+	cmd.Flags().BoolVar(&config.RootlessUserNamespace, "rootless-user-namespace", false, "Run mount pods of StorageClasses with juicefs/rootless in user namespaces (hostUsers: false), requires Kubernetes v1.30+ with user namespaces enabled.")
+	cmd.Flags().BoolVar(&config.SingleNodeAccessGuard, "single-node-access-guard", false, "Reject publishing ReadWriteOnce volumes on a node when they are published on another one, tracked by a lease per volume in the namespace of CSI Driver.")
 
 	goFlag := goflag.CommandLine
 	klog.InitFlags(goFlag)
 	cmd.PersistentFlags().AddGoFlagSet(goFlag)
 
 	cmd.AddCommand(upgradeCmd)
+	cmd.AddCommand(logsCmd)
+	cmd.AddCommand(migrateCmd)
+	cmd.AddCommand(rebindCmd)
+	cmd.AddCommand(exportCmd)
+	cmd.AddCommand(importCmd)
+	cmd.AddCommand(doctorCmd)
+	cmd.AddCommand(reportCmd)
+	cmd.AddCommand(benchCmd)
+	cmd.AddCommand(rehomeCmd)
+	cmd.AddCommand(usageExporterCmd)
+	cmd.AddCommand(rbacCmd)
 
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
@@ -137,3 +199,26 @@ func run() {
 		nodeRun(ctx)
 	}
 }
+
+// serveDebug serves pprof and runtime metrics on --debug-addr
+func serveDebug() {
+	server := &http.Server{
+		Addr:    debugAddr,
+		Handler: debug.Handler(),
+	}
+	if err := listenAndServeMetrics(server); err != nil {
+		log.Error(err, "failed to start debug server")
+	}
+}
+
+// listenAndServeMetrics serves the metrics server with TLS and authorization configured by flags
+func listenAndServeMetrics(server *http.Server) error {
+	if !metricsServing.Authorization {
+		return serving.ListenAndServe(server, metricsServing, nil)
+	}
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	return serving.ListenAndServe(server, metricsServing, client)
+}
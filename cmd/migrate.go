@@ -0,0 +1,138 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/migrate"
+)
+
+var (
+	migrateOpts    = migrate.Options{}
+	migrateSecret  = ""
+	migrateApply   = false
+	migrateSwitch  = false
+	migrateTimeout = 10 * time.Minute
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "generate CSI StorageClass/PV/PVC for workloads using JuiceFS by hostPath or flexvolume",
+	Example: `  juicefs-csi-driver migrate --host-path-prefix /jfs/myjfs --secret kube-system/juicefs-secret > migrate.yaml
+  juicefs-csi-driver migrate -n default --flex-driver juicedata/juicefs --apply --switch`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(migrateOpts.HostPathPrefixes) == 0 && migrateOpts.FlexDriver == "" {
+			log.Info("please specify --host-path-prefix or --flex-driver")
+			os.Exit(1)
+		}
+		if migrateSecret != "" {
+			migrateOpts.SecretNamespace, migrateOpts.SecretName = "default", migrateSecret
+			if parts := strings.SplitN(migrateSecret, "/", 2); len(parts) == 2 {
+				migrateOpts.SecretNamespace, migrateOpts.SecretName = parts[0], parts[1]
+			}
+		}
+		if err := runMigrate(ctrl.SetupSignalHandler(), os.Stdout); err != nil {
+			log.Error(err, "failed to migrate")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	migrateCmd.Flags().StringVarP(&migrateOpts.Namespace, "namespace", "n", "", "namespace of workloads, all namespaces if empty")
+	migrateCmd.Flags().StringSliceVar(&migrateOpts.HostPathPrefixes, "host-path-prefix", nil, "host paths where JuiceFS is mounted, hostPath volumes under them are migrated")
+	migrateCmd.Flags().StringVar(&migrateOpts.FlexDriver, "flex-driver", "", fmt.Sprintf("driver of JuiceFS flexvolume to migrate, e.g. %s", migrate.DefaultFlexDriver))
+	migrateCmd.Flags().StringVar(&migrateSecret, "secret", "", "secret of the file system in CSI format, <namespace>/<name>, required for hostPath volumes")
+	migrateCmd.Flags().StringVar(&migrateOpts.StorageClass, "storage-class", "", "generate a StorageClass with this name and use it in PVs and PVCs")
+	migrateCmd.Flags().StringVar(&migrateOpts.Capacity, "capacity", migrate.DefaultCapacity, "capacity of generated PVs and PVCs")
+	migrateCmd.Flags().BoolVar(&migrateApply, "apply", false, "create the generated objects instead of printing them")
+	migrateCmd.Flags().BoolVar(&migrateSwitch, "switch", false, "replace volumes of workloads with the generated PVCs one by one, requires --apply")
+	migrateCmd.Flags().DurationVar(&migrateTimeout, "timeout", migrateTimeout, "timeout of waiting for the rollout of each workload")
+}
+
+func runMigrate(ctx context.Context, out io.Writer) error {
+	if migrateSwitch && !migrateApply {
+		return fmt.Errorf("--switch requires --apply")
+	}
+	client, err := k8sclient.NewClient()
+	if err != nil {
+		return err
+	}
+	sources, err := migrate.Discover(ctx, client, migrateOpts)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		log.Info("no workload using JuiceFS by hostPath or flexvolume found")
+		return nil
+	}
+	plan, err := migrate.GeneratePlan(sources, migrateOpts)
+	if err != nil {
+		return err
+	}
+	for _, s := range sources {
+		log.Info("found volume", "workload", s.Owner.String(), "volume", s.VolumeName, "type", s.Type, "path", s.Path, "pvc", s.PVCName())
+	}
+	for _, skipped := range plan.Skipped {
+		log.Info("pod is not controlled by a workload, please switch it manually", "pod", skipped)
+	}
+	if !migrateApply {
+		return printPlan(plan, out)
+	}
+	if err := migrate.Apply(ctx, client, plan); err != nil {
+		return err
+	}
+	log.Info("created objects", "storageClasses", len(plan.StorageClasses), "pvs", len(plan.PVs), "pvcs", len(plan.PVCs))
+	if migrateSwitch {
+		return migrate.Switch(ctx, client, plan, migrateTimeout)
+	}
+	return nil
+}
+
+func printPlan(plan *migrate.Plan, out io.Writer) error {
+	var objs []interface{}
+	for i := range plan.StorageClasses {
+		objs = append(objs, plan.StorageClasses[i])
+	}
+	for i := range plan.PVs {
+		objs = append(objs, plan.PVs[i])
+	}
+	for i := range plan.PVCs {
+		objs = append(objs, plan.PVCs[i])
+	}
+	for _, obj := range objs {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
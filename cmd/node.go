@@ -32,13 +32,15 @@ import (
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/controller"
 	"github.com/juicedata/juicefs-csi-driver/pkg/driver"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
 	"github.com/juicedata/juicefs-csi-driver/pkg/fuse/grace"
 	"github.com/juicedata/juicefs-csi-driver/pkg/fuse/passfd"
 	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/tracing"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
 )
 
-func parseNodeConfig() {
+func parseNodeConfig(ctx context.Context) {
 	config.ByProcess = process
 	if os.Getenv("DRIVER_NAME") != "" {
 		config.DriverName = os.Getenv("DRIVER_NAME")
@@ -59,9 +61,17 @@ func parseNodeConfig() {
 	config.Namespace = os.Getenv("JUICEFS_MOUNT_NAMESPACE")
 	config.PodName = os.Getenv("POD_NAME")
 	config.MountPointPath = os.Getenv("JUICEFS_MOUNT_PATH")
+	if mountPointPath != "" {
+		config.MountPointPath = mountPointPath
+	}
 	config.JFSConfigPath = os.Getenv("JUICEFS_CONFIG_PATH")
+	config.IPv6 = config.DetectIPFamily()
 	config.HostIp = os.Getenv("HOST_IP")
 	config.KubeletPort = os.Getenv("KUBELET_PORT")
+	config.AuditSink = os.Getenv("JUICEFS_AUDIT_SINK")
+	if auditSink != "" {
+		config.AuditSink = auditSink
+	}
 	jfsMountPriorityName := os.Getenv("JUICEFS_MOUNT_PRIORITY_NAME")
 	jfsMountPreemptionPolicy := os.Getenv("JUICEFS_MOUNT_PREEMPTION_POLICY")
 	if timeout := os.Getenv("JUICEFS_RECONCILE_TIMEOUT"); timeout != "" {
@@ -104,6 +114,12 @@ func parseNodeConfig() {
 	if os.Getenv("STORAGE_CLASS_SHARE_MOUNT") == "true" {
 		config.StorageClassShareMount = true
 	}
+	if config.MountMetricsPortRange != "" {
+		if _, _, err := config.ParsePortRange(config.MountMetricsPortRange); err != nil {
+			log.Error(err, "invalid --mount-metrics-port-range")
+			os.Exit(1)
+		}
+	}
 
 	if config.PodName == "" || config.Namespace == "" {
 		log.Info("Pod name & namespace can't be null.")
@@ -119,14 +135,46 @@ func parseNodeConfig() {
 		log.Error(err, "Can't get k8s client")
 		os.Exit(1)
 	}
+	verifyPermissions(k8sclient, k8s.ComponentNode, k8s.Features{
+		SingleNodeAccessGuard: config.SingleNodeAccessGuard,
+		LabelNode:             config.LabelNode && !config.ByProcess,
+	})
 	pod, err := k8sclient.GetPod(context.TODO(), config.PodName, config.Namespace)
 	if err != nil {
 		log.Error(err, "Can't get pod", "pod", config.PodName)
 		os.Exit(1)
 	}
 	config.CSIPod = *pod
+	if node, err := k8sclient.GetNode(context.TODO(), config.NodeName); err != nil {
+		log.Error(err, "Can't get node, stale mount pods of the node recreated with the same name can not be detected", "node", config.NodeName)
+	} else {
+		config.NodeUID = string(node.UID)
+		config.NodeCreationTime = node.CreationTimestamp.Time
+		if config.FuseExpectedMounts == 0 {
+			config.FuseExpectedMounts = int(node.Status.Capacity.Pods().Value())
+		}
+	}
+	if kubeletRootDir == "" {
+		kubeletRootDir = os.Getenv("KUBELET_ROOT_DIR")
+	}
+	config.KubeletRootDir = config.DetectKubeletRootDir(kubeletRootDir, "/proc", pod)
+	log.Info("kubelet root dir", "path", config.KubeletRootDir, "registrationDir", config.PluginRegistrationDir(), "socket", config.PluginSocketPath())
+	for _, problem := range config.CheckKubeletPaths(pod) {
+		log.Error(nil, "CSI Node pod doesn't agree with kubelet root dir, set it in the hostPath volumes and KUBELET_ROOT_DIR env of the DaemonSet", "problem", problem)
+	}
+	// targets are mounted in CSI Node and propagated to host, so kubelet root dir must be mounted at the same path
+	if _, err := os.Stat(config.KubeletRootDir); err != nil {
+		log.Error(err, "kubelet root dir is not mounted into CSI Node at the same path as on host, mount will fail", "path", config.KubeletRootDir)
+	}
 
 	passfd.InitGlobalFds(context.TODO(), k8sclient, "/tmp")
+	if config.ThrottleWatcher && !config.ByProcess {
+		// apply bandwidth limits in PVC annotations to running mount pods
+		go grace.NewThrottleWatcher(k8sclient).Run(ctx)
+	}
+	if config.LabelNode && !config.ByProcess {
+		go controller.NewNodeLabeler(k8sclient).Run(context.TODO())
+	}
 
 	err = grace.ServeGfShutdown(config.ShutdownSockPath)
 	if err != nil {
@@ -136,24 +184,32 @@ func parseNodeConfig() {
 }
 
 func nodeRun(ctx context.Context) {
-	parseNodeConfig()
+	parseNodeConfig(ctx)
 	if nodeID == "" {
 		log.Info("nodeID must be provided")
 		os.Exit(1)
 	}
 
 	// http server for pprof
-	go func() {
-		port := 6060
-		for {
-			if err := http.ListenAndServe(fmt.Sprintf("localhost:%d", port), nil); err != nil {
-				log.Error(err, "failed to start pprof server")
+	if debugAddr != "" {
+		go serveDebug()
+	} else {
+		go func() {
+			port := 6060
+			for {
+				if err := http.ListenAndServe(fmt.Sprintf("localhost:%d", port), nil); err != nil {
+					log.Error(err, "failed to start pprof server")
+				}
+				port++
 			}
-			port++
-		}
-	}()
+		}()
+	}
+
+	tracing.Init("juicefs-csi-node")
+	events.Setup("juicefs-csi-node", config.NodeName)
 
 	registerer, registry := util.NewPrometheus(config.NodeName)
+	config.FeatureGates.RegisterMetrics(registerer)
 	// http server for metrics
 	go func() {
 		mux := http.NewServeMux()
@@ -168,7 +224,7 @@ func nodeRun(ctx context.Context) {
 			Addr:    fmt.Sprintf(":%d", config.WebPort),
 			Handler: mux,
 		}
-		if err := server.ListenAndServe(); err != nil {
+		if err := listenAndServeMetrics(server); err != nil {
 			log.Error(err, "failed to start metrics server")
 		}
 	}()
@@ -180,7 +236,7 @@ func nodeRun(ctx context.Context) {
 				log.Error(err, "Could not Start Reconciler of polling kubelet, retrying...")
 				return true
 			}, func() error {
-				return controller.StartReconciler()
+				return controller.StartReconciler(ctx)
 			})
 			if err != nil {
 				log.Error(err, "Could not Start Reconciler of polling kubelet and fallback to watch ApiServer.")
@@ -218,6 +274,13 @@ func nodeRun(ctx context.Context) {
 		drv.Stop()
 	}()
 
+	// checked before serving, the result is reported in NodeGetInfo on registration
+	if health := drv.CheckFuse(ctx); !health.Healthy() {
+		log.Info("FUSE module of the node is broken, mounts may fail", "problems", health.String())
+	}
+	go drv.RunFuseChecker(ctx)
+	drv.RecoverNode(ctx)
+
 	if err := drv.Run(); err != nil {
 		log.Error(err, "fail to run driver")
 		os.Exit(1)
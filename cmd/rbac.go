@@ -0,0 +1,110 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var (
+	rbacComponent       = k8sclient.ComponentNode
+	rbacNamespace       = "kube-system"
+	rbacServiceAccount  = ""
+	rbacName            = ""
+	rbacNamespaceScoped = false
+	rbacFeatures        = k8sclient.Features{}
+)
+
+var rbacCmd = &cobra.Command{
+	Use:   "rbac",
+	Short: "print the least privileged RBAC objects of a component of CSI Driver",
+	Example: `  juicefs-csi-driver rbac --component node
+  juicefs-csi-driver rbac --component controller --leader-election --namespace-scoped | kubectl apply -f -`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := printRBAC(os.Stdout); err != nil {
+			log.Error(err, "failed to generate RBAC")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rbacCmd.Flags().StringVar(&rbacComponent, "component", rbacComponent, "component of CSI Driver: node or controller")
+	rbacCmd.Flags().StringVarP(&rbacNamespace, "namespace", "n", rbacNamespace, "namespace of CSI Driver, where mount pods are created")
+	rbacCmd.Flags().StringVar(&rbacServiceAccount, "service-account", "", "service account of the component, defaults to juicefs-csi-<component>-sa")
+	rbacCmd.Flags().StringVar(&rbacName, "name", "", "name of the roles and bindings, defaults to juicefs-csi-<component>")
+	rbacCmd.Flags().BoolVar(&rbacNamespaceScoped, "namespace-scoped", false, "grant the permissions on mount pods, jobs and secrets by a Role in the namespace instead of the ClusterRole")
+	rbacCmd.Flags().BoolVar(&rbacFeatures.LeaderElection, "leader-election", false, "controller runs with --leader-election")
+	rbacCmd.Flags().BoolVar(&rbacFeatures.Webhook, "webhook", false, "controller runs with --webhook for sidecar mode")
+	rbacCmd.Flags().BoolVar(&rbacFeatures.StorageClassProtection, "storageclass-protection", false, "controller runs with --storageclass-protection")
+	rbacCmd.Flags().BoolVar(&rbacFeatures.SingleNodeAccessGuard, "single-node-access-guard", false, "node runs with --single-node-access-guard")
+	rbacCmd.Flags().BoolVar(&rbacFeatures.LabelNode, "label-node", false, "node runs with --label-node")
+}
+
+func printRBAC(out io.Writer) error {
+	perms, err := k8sclient.RequiredPermissions(rbacComponent, rbacFeatures)
+	if err != nil {
+		return err
+	}
+	if rbacServiceAccount == "" {
+		rbacServiceAccount = fmt.Sprintf("juicefs-csi-%s-sa", rbacComponent)
+	}
+	if rbacName == "" {
+		rbacName = "juicefs-csi-" + rbacComponent
+	}
+	for i, obj := range k8sclient.GenerateRBAC(rbacName, rbacNamespace, rbacServiceAccount, perms, rbacNamespaceScoped) {
+		if i > 0 {
+			if _, err := fmt.Fprintln(out, "---"); err != nil {
+				return err
+			}
+		}
+		if err := printObject(obj, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyPermissions exits if the service account lacks any permission the component requires, so that it's reported
+// at startup instead of failing in the middle of mounting volumes. In namespace-scoped mode, clients are restricted
+// to the namespace of mount pods for the namespaced permissions.
+func verifyPermissions(client *k8sclient.K8sClient, component string, features k8sclient.Features) {
+	perms, err := k8sclient.RequiredPermissions(component, features)
+	if err != nil {
+		log.Error(err, "can't get required permissions")
+		os.Exit(1)
+	}
+	if config.NamespaceScoped {
+		k8sclient.SetNamespaceScope(config.Namespace, perms)
+	}
+	if !config.VerifyPermissions {
+		return
+	}
+	if err := client.VerifyPermissions(context.TODO(), config.Namespace, perms); err != nil {
+		log.Error(err, "service account of CSI Driver lacks required permissions, grant them or generate the RBAC objects with the rbac command", "component", component)
+		os.Exit(1)
+	}
+	log.Info("permissions verified", "component", component)
+}
@@ -0,0 +1,108 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/rebind"
+)
+
+var (
+	rebindAll         = false
+	rebindRecreatePVC = false
+	rebindDryRun      = false
+)
+
+var rebindCmd = &cobra.Command{
+	Use:   "rebind [PV...]",
+	Short: "make Released JuiceFS PVs with Retain reclaim policy available again after their PVCs are deleted",
+	Example: `  juicefs-csi-driver rebind --all --dry-run
+  juicefs-csi-driver rebind pvc-4f2a7b3c --recreate-pvc`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 && !rebindAll {
+			log.Info("please specify PVs or --all")
+			os.Exit(1)
+		}
+		if err := runRebind(ctrl.SetupSignalHandler(), args); err != nil {
+			log.Error(err, "failed to rebind")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rebindCmd.Flags().BoolVar(&rebindAll, "all", false, "rebind all the Released JuiceFS PVs with Retain reclaim policy")
+	rebindCmd.Flags().BoolVar(&rebindRecreatePVC, "recreate-pvc", false, "recreate the PVC from the metadata stored in PV and bind it to the PV, instead of only clearing the claimRef")
+	rebindCmd.Flags().BoolVar(&rebindDryRun, "dry-run", false, "print the PVs to rebind without changing them")
+}
+
+func runRebind(ctx context.Context, pvNames []string) error {
+	client, err := newCLIClient()
+	if err != nil {
+		return err
+	}
+	if rebindAll {
+		pvs, err := rebind.ListReleased(ctx, client)
+		if err != nil {
+			return err
+		}
+		pvNames = pvNames[:0]
+		for _, pv := range pvs {
+			pvNames = append(pvNames, pv.Name)
+		}
+		if len(pvNames) == 0 {
+			log.Info("no Released JuiceFS PV with Retain reclaim policy found")
+			return nil
+		}
+	}
+	var failed int
+	for _, name := range pvNames {
+		if rebindDryRun {
+			pv, err := client.GetPersistentVolume(ctx, name)
+			if err != nil {
+				return err
+			}
+			claim := "-"
+			if pvc, err := rebind.GenClaim(pv); err == nil {
+				claim = pvc.Namespace + "/" + pvc.Name
+			}
+			log.Info("will rebind pv", "pv", name, "pvc", claim, "recreatePVC", rebindRecreatePVC)
+			continue
+		}
+		pvc, err := rebind.Rebind(ctx, client, name, rebindRecreatePVC)
+		if err != nil {
+			log.Error(err, "rebind pv error", "pv", name)
+			failed++
+			continue
+		}
+		if pvc != nil {
+			log.Info("pv is reserved for pvc", "pv", name, "pvc", pvc.Namespace+"/"+pvc.Name)
+		} else {
+			log.Info("pv is available", "pv", name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d pvs failed to rebind", failed, len(pvNames))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/rehome"
+)
+
+var (
+	rehomeOpts   = rehome.Options{}
+	rehomeTo     = ""
+	rehomeLabels []string
+)
+
+var rehomeCmd = &cobra.Command{
+	Use:   "rehome PV --to NAMESPACE/PVC",
+	Short: "move a JuiceFS PV to a new PVC, possibly in another namespace, without copying data",
+	Example: `  juicefs-csi-driver rehome pvc-4f2a7b3c --to team-b/data --dry-run
+  juicefs-csi-driver rehome pvc-4f2a7b3c --to team-b/data --rename-dir --label tenant=team-b`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ns, name, ok := strings.Cut(rehomeTo, "/")
+		if !ok || ns == "" || name == "" {
+			log.Info("please specify the new PVC by --to NAMESPACE/PVC")
+			os.Exit(1)
+		}
+		rehomeOpts.PV, rehomeOpts.Namespace, rehomeOpts.PVC = args[0], ns, name
+		rehomeOpts.Labels = map[string]string{}
+		for _, l := range rehomeLabels {
+			if k, v, ok := strings.Cut(l, "="); ok && k != "" {
+				rehomeOpts.Labels[k] = v
+			} else if k, ok := strings.CutSuffix(l, "-"); ok && k != "" {
+				rehomeOpts.RemoveLabels = append(rehomeOpts.RemoveLabels, k)
+			} else {
+				log.Info("please specify labels in format of KEY=VALUE, or KEY- to remove it", "label", l)
+				os.Exit(1)
+			}
+		}
+		client, err := newCLIClient()
+		if err != nil {
+			log.Error(err, "failed to create k8s client")
+			os.Exit(1)
+		}
+		plan, err := rehome.Run(ctrl.SetupSignalHandler(), client, rehomeOpts)
+		if err != nil {
+			log.Error(err, "failed to rehome pv", "pv", rehomeOpts.PV)
+			os.Exit(1)
+		}
+		if rehomeOpts.DryRun {
+			log.Info("will rehome " + plan.String())
+			return
+		}
+		log.Info("rehomed " + plan.String())
+	},
+}
+
+// newCLIClient creates the k8s client of commands run by operators, with their own credentials from --kubeconfig,
+// KUBECONFIG or ~/.kube/config, and the in-cluster config otherwise
+func newCLIClient() (*k8sclient.K8sClient, error) {
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return k8sclient.NewClientWithConfig(*cfg)
+}
+
+func init() {
+	rehomeCmd.Flags().StringVar(&rehomeTo, "to", "", "the new PVC in format of NAMESPACE/NAME, which must not exist")
+	rehomeCmd.Flags().BoolVar(&rehomeOpts.RenameDir, "rename-dir", false, "rename the directory named by pathPattern of the StorageClass after the new PVC, the PV is recreated then")
+	rehomeCmd.Flags().StringVar(&rehomeOpts.Image, "image", "", "image of the pod renaming the directory, defaults to the mount image of community edition")
+	rehomeCmd.Flags().StringArrayVar(&rehomeLabels, "label", nil, "label to set on the new PVC and the PV in format of KEY=VALUE, or KEY- to remove it, such as the label counted by tenant quotas")
+	rehomeCmd.Flags().DurationVar(&rehomeOpts.Timeout, "timeout", 0, "timeout of each step, 10m by default")
+	rehomeCmd.Flags().BoolVar(&rehomeOpts.DryRun, "dry-run", false, "print the plan without changing anything")
+}
@@ -0,0 +1,90 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/report"
+)
+
+var (
+	reportOpts   = report.Options{}
+	reportOutput = "text"
+	reportTop    = 10
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "summarize the usage of CSI Driver in the cluster: file systems, capacity and usage of PVs, mount pods of nodes and volumes with the most errors",
+	Example: `  juicefs-csi-driver report
+  juicefs-csi-driver report -o csv > volumes.csv`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if reportOutput != "text" && reportOutput != "json" && reportOutput != "yaml" && reportOutput != "csv" {
+			log.Info("--output should be one of text, json, yaml and csv")
+			os.Exit(1)
+		}
+		if err := runReport(ctrl.SetupSignalHandler(), os.Stdout); err != nil {
+			log.Error(err, "failed to generate report")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	reportCmd.Flags().StringVarP(&reportOpts.Namespace, "namespace", "n", "", "namespace of CSI Driver, defaults to env JUICEFS_MOUNT_NAMESPACE or kube-system")
+	reportCmd.Flags().BoolVar(&reportOpts.SkipUsage, "skip-usage", false, "don't read the usage of volumes from kubelet, which needs get permission on nodes/proxy")
+	reportCmd.Flags().StringVarP(&reportOutput, "output", "o", reportOutput, "format of the report: text, json, yaml, or csv of volumes")
+	reportCmd.Flags().IntVar(&reportTop, "top", reportTop, "number of volumes with the most errors printed in text")
+}
+
+func runReport(ctx context.Context, out io.Writer) error {
+	if reportOpts.Namespace == "" {
+		reportOpts.Namespace = os.Getenv("JUICEFS_MOUNT_NAMESPACE")
+	}
+	client, err := k8sclient.NewClient()
+	if err != nil {
+		return err
+	}
+	r, err := report.Generate(ctx, client, reportOpts)
+	if err != nil {
+		return err
+	}
+	switch reportOutput {
+	case "json":
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	case "yaml":
+		return printObject(r, out)
+	case "csv":
+		return r.WriteCSV(out)
+	default:
+		return r.Print(out, reportTop)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/share"
+)
+
+var (
+	exportCluster = ""
+
+	importFile   = ""
+	importName   = ""
+	importSecret = ""
+	importDryRun = false
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export PV",
+	Short: "print the connection info of a JuiceFS PV without secrets, to be imported as a read-only PV in another cluster",
+	Example: `  juicefs-csi-driver export pvc-4f2a7b3c --cluster prod > data.yaml
+  juicefs-csi-driver import -f data.yaml --secret kube-system/juicefs-secret`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runExport(ctrl.SetupSignalHandler(), args[0], os.Stdout); err != nil {
+			log.Error(err, "failed to export")
+			os.Exit(1)
+		}
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "create a read-only PV from the manifest exported in another cluster",
+	Example: `  juicefs-csi-driver import -f data.yaml --secret kube-system/juicefs-secret --name shared-data
+  juicefs-csi-driver import -f data.yaml --secret kube-system/juicefs-secret --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if importFile == "" || importSecret == "" {
+			log.Info("please specify -f and --secret")
+			os.Exit(1)
+		}
+		if err := runImport(ctrl.SetupSignalHandler(), os.Stdout); err != nil {
+			log.Error(err, "failed to import")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportCluster, "cluster", "", "name of this cluster recorded in the manifest, defaults to the UID of kube-system namespace")
+
+	importCmd.Flags().StringVarP(&importFile, "filename", "f", "", "manifest generated by export, - for stdin")
+	importCmd.Flags().StringVar(&importName, "name", "", "name of the PV, defaults to <cluster>-<pv>")
+	importCmd.Flags().StringVar(&importSecret, "secret", "", "secret of the same file system in this cluster, in the format of <namespace>/<name>")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "print the PV without creating it")
+}
+
+func runExport(ctx context.Context, pvName string, out io.Writer) error {
+	client, err := k8sclient.NewClient()
+	if err != nil {
+		return err
+	}
+	cluster := exportCluster
+	if cluster == "" {
+		if cluster, err = share.ClusterID(ctx, client); err != nil {
+			return err
+		}
+	}
+	m, err := share.Export(ctx, client, pvName, cluster)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+func runImport(ctx context.Context, out io.Writer) error {
+	var (
+		data []byte
+		err  error
+	)
+	if importFile == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(importFile)
+	}
+	if err != nil {
+		return err
+	}
+	m := &share.Manifest{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("invalid manifest: %v", err)
+	}
+	namespace, name, found := strings.Cut(importSecret, "/")
+	if !found || namespace == "" || name == "" {
+		return fmt.Errorf("--secret should be <namespace>/<name>")
+	}
+	opts := share.ImportOptions{Name: importName, SecretName: name, SecretNamespace: namespace}
+
+	if importDryRun {
+		pv, err := share.GenPV(m, opts)
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(pv)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	}
+	client, err := k8sclient.NewClient()
+	if err != nil {
+		return err
+	}
+	pv, err := share.Import(ctx, client, m, opts)
+	if err != nil {
+		return err
+	}
+	log.Info("pv is created, bind it with a ReadOnlyMany PVC", "pv", pv.Name, "from", m.Cluster+"/"+m.PV)
+	return nil
+}
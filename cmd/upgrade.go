@@ -18,6 +18,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -29,6 +30,8 @@ var (
 	recreate        = false
 	batchConfigName = ""
 	crtBatchIndex   = 1
+	standby         = false
+	standbyDrain    = 5 * time.Minute
 )
 
 var upgradeCmd = &cobra.Command{
@@ -45,6 +48,11 @@ var upgradeCmd = &cobra.Command{
 				log.Error(err, "failed to upgrade mount pod")
 				os.Exit(1)
 			}
+		} else if standby {
+			if err := grace.TriggerStandbyUpgrade(config.ShutdownSockPath, name, standbyDrain); err != nil {
+				log.Error(err, "failed to upgrade mount pod")
+				os.Exit(1)
+			}
 		} else if err := grace.TriggerShutdown(config.ShutdownSockPath, name, recreate); err != nil {
 			log.Error(err, "failed to upgrade mount pod")
 			os.Exit(1)
@@ -56,4 +64,6 @@ func init() {
 	upgradeCmd.Flags().BoolVar(&recreate, "recreate", false, "smoothly upgrade the mount pod with recreate")
 	upgradeCmd.Flags().StringVar(&batchConfigName, "batchConfig", "", "batch config name")
 	upgradeCmd.Flags().IntVar(&crtBatchIndex, "batchIndex", 1, "current batch index")
+	upgradeCmd.Flags().BoolVar(&standby, "standby", false, "upgrade the mount pod by switching targets to a standby mount pod with the current config of the volume")
+	upgradeCmd.Flags().DurationVar(&standbyDrain, "drain", standbyDrain, "time to keep the old mount pod for files opened through it after targets are switched, used with --standby")
 }
@@ -0,0 +1,131 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/usage"
+)
+
+var (
+	usageOpts           = usage.Options{Interval: time.Hour}
+	usageOnce           = false
+	usagePushgateway    = ""
+	usagePushgatewayJob = "juicefs-usage"
+	usageWebhook        = ""
+	usageWebhookHeader  []string
+	usageCSV            = ""
+	usageCSVHeader      []string
+)
+
+var usageExporterCmd = &cobra.Command{
+	Use:   "usage-exporter",
+	Short: "periodically aggregate the capacity and usage of volumes by namespace, StorageClass and file system, and push them to sinks for chargeback",
+	Example: `  juicefs-csi-driver usage-exporter --pushgateway http://pushgateway.monitoring:9091
+  juicefs-csi-driver usage-exporter --once --csv /var/lib/usage --webhook https://billing.example.com/usage`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sinks, err := usageSinks()
+		if err != nil {
+			log.Error(err, "invalid sinks")
+			os.Exit(1)
+		}
+		if usageOpts.Namespace == "" {
+			usageOpts.Namespace = os.Getenv("JUICEFS_MOUNT_NAMESPACE")
+		}
+		client, err := k8sclient.NewClient()
+		if err != nil {
+			log.Error(err, "failed to create k8s client")
+			os.Exit(1)
+		}
+		if usageOnce && usageOpts.StateFile == "" {
+			log.Info("--state-file is not set, usage of PVs not in use is reported as unknown with --once")
+		}
+		exporter := usage.NewExporter(client, usageOpts, sinks...)
+		ctx := ctrl.SetupSignalHandler()
+		if usageOnce {
+			if err := exporter.Export(ctx); err != nil {
+				log.Error(err, "failed to export usage")
+				os.Exit(1)
+			}
+			return
+		}
+		exporter.Run(ctx)
+	},
+}
+
+func init() {
+	usageExporterCmd.Flags().StringVarP(&usageOpts.Namespace, "namespace", "n", "", "namespace of CSI Driver, defaults to env JUICEFS_MOUNT_NAMESPACE or kube-system")
+	usageExporterCmd.Flags().StringVar(&usageOpts.Cluster, "cluster", "", "name of the cluster in the usage, for billing systems shared by clusters")
+	usageExporterCmd.Flags().DurationVar(&usageOpts.Interval, "interval", usageOpts.Interval, "interval between exports")
+	usageExporterCmd.Flags().BoolVar(&usageOnce, "once", false, "export once and exit, e.g. in a CronJob")
+	usageExporterCmd.Flags().StringVar(&usageOpts.StateFile, "state-file", "", "file to keep the last known usage of PVs across runs, needed with --once for the usage of PVs not in use")
+	usageExporterCmd.Flags().StringVar(&usagePushgateway, "pushgateway", "", "URL of the Prometheus Pushgateway to push the usage to")
+	usageExporterCmd.Flags().StringVar(&usagePushgatewayJob, "pushgateway-job", usagePushgatewayJob, "job name of the metrics pushed to the Pushgateway")
+	usageExporterCmd.Flags().StringVar(&usageWebhook, "webhook", "", "URL to post the usage in JSON to")
+	usageExporterCmd.Flags().StringArrayVar(&usageWebhookHeader, "webhook-header", nil, "header of webhook requests in \"Key: Value\", can be repeated")
+	usageExporterCmd.Flags().StringVar(&usageCSV, "csv", "", "directory to write the usage in CSV to, or an HTTP URL to put the CSV file to, e.g. of a bucket")
+	usageExporterCmd.Flags().StringArrayVar(&usageCSVHeader, "csv-header", nil, "header of requests putting the CSV file in \"Key: Value\", can be repeated")
+}
+
+func usageSinks() ([]usage.Sink, error) {
+	var sinks []usage.Sink
+	if usagePushgateway != "" {
+		sinks = append(sinks, &usage.PushgatewaySink{URL: usagePushgateway, Job: usagePushgatewayJob})
+	}
+	if usageWebhook != "" {
+		header, err := parseHeader(usageWebhookHeader)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, &usage.WebhookSink{URL: usageWebhook, Header: header})
+	}
+	if usageCSV != "" {
+		header, err := parseHeader(usageCSVHeader)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, &usage.CSVSink{Dest: usageCSV, Header: header})
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("at least one of --pushgateway, --webhook and --csv is needed")
+	}
+	if usageOpts.Interval <= 0 {
+		return nil, fmt.Errorf("--interval should be positive")
+	}
+	return sinks, nil
+}
+
+func parseHeader(lines []string) (http.Header, error) {
+	header := http.Header{}
+	for _, line := range lines {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid header %q, should be \"Key: Value\"", line)
+		}
+		header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return header, nil
+}
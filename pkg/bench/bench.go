@@ -0,0 +1,281 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package bench runs `juicefs bench` or fio in a temporary pod bound to a PVC, and records the results in a
+// configmap, so that storage admins can validate the performance of a StorageClass before handing it to users.
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var benchLog = klog.NewKlogr().WithName("bench")
+
+const (
+	ToolJuiceFS = "juicefs"
+	ToolFio     = "fio"
+
+	// LabelValue of common.PodTypeKey, set on bench pods and the configmaps of results
+	LabelValue = "juicefs-bench"
+	// PVCAnnotationKey annotation of the configmaps of results, <namespace>/<name> of the PVC
+	PVCAnnotationKey = "juicefs.com/bench-pvc"
+
+	containerName = "bench"
+	mountPath     = "/data"
+	resultKey     = "result.json"
+	outputKey     = "output"
+)
+
+// defaultFioArgs is a sequential write then read of 1GiB by 4 jobs, files are removed afterwards
+var defaultFioArgs = []string{"--rw=readwrite", "--bs=1M", "--size=1G", "--numjobs=4", "--group_reporting", "--unlink=1"}
+
+// Options of a bench run
+type Options struct {
+	Namespace string
+	PVC       string
+	// Tool is ToolJuiceFS or ToolFio
+	Tool string
+	// Image of the bench pod, the mount image of community edition by default, which has no fio
+	Image string
+	// Args are extra arguments of the tool
+	Args    []string
+	Timeout time.Duration
+	// Keep the bench pod after it finishes, for debugging
+	Keep bool
+
+	pollInterval time.Duration
+}
+
+// Metric is a row of the result table of `juicefs bench`
+type Metric struct {
+	Item  string `json:"item"`
+	Value string `json:"value"`
+	Cost  string `json:"cost,omitempty"`
+}
+
+// Result of a bench run, recorded in a configmap named after the bench pod
+type Result struct {
+	Name         string          `json:"name"`
+	Namespace    string          `json:"namespace"`
+	PVC          string          `json:"pvc"`
+	StorageClass string          `json:"storageClass,omitempty"`
+	Tool         string          `json:"tool"`
+	Command      []string        `json:"command"`
+	Phase        corev1.PodPhase `json:"phase"`
+	Start        time.Time       `json:"start"`
+	Duration     string          `json:"duration"`
+	Metrics      []Metric        `json:"metrics,omitempty"`
+	// Output is the log of the bench pod, JSON of fio
+	Output string `json:"-"`
+}
+
+// Run runs the bench in a pod bound to the PVC, waits for it to finish, and records the result.
+// The result is returned even if the bench fails, with the phase of the pod.
+func Run(ctx context.Context, client *k8sclient.K8sClient, opts Options) (*Result, error) {
+	if opts.Tool == "" {
+		opts.Tool = ToolJuiceFS
+	}
+	if opts.Tool != ToolJuiceFS && opts.Tool != ToolFio {
+		return nil, fmt.Errorf("unknown tool %q, should be %s or %s", opts.Tool, ToolJuiceFS, ToolFio)
+	}
+	if opts.Image == "" {
+		opts.Image = config.DefaultCEMountImage
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Minute
+	}
+	if opts.pollInterval <= 0 {
+		opts.pollInterval = 2 * time.Second
+	}
+	pvc, err := client.GetPersistentVolumeClaim(ctx, opts.PVC, opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if pvc.Status.Phase != corev1.ClaimBound {
+		return nil, fmt.Errorf("pvc %s/%s is %s, not bound", pvc.Namespace, pvc.Name, pvc.Status.Phase)
+	}
+
+	start := time.Now()
+	result := &Result{
+		Name:      fmt.Sprintf("%s-%s-%d", LabelValue, truncate(pvc.Name, 30), start.Unix()),
+		Namespace: pvc.Namespace,
+		PVC:       pvc.Name,
+		Tool:      opts.Tool,
+		Command:   command(opts),
+		Start:     start,
+	}
+	if pvc.Spec.StorageClassName != nil {
+		result.StorageClass = *pvc.Spec.StorageClassName
+	}
+	pod, err := client.CreatePod(ctx, newPod(result, opts.Image))
+	if err != nil {
+		return nil, err
+	}
+	benchLog.Info("bench pod created", "pod", pod.Name, "namespace", pod.Namespace, "command", result.Command)
+	if !opts.Keep {
+		defer func() {
+			if err := client.DeletePod(context.Background(), pod); err != nil && !k8serrors.IsNotFound(err) {
+				benchLog.Error(err, "delete bench pod error", "pod", pod.Name)
+			}
+		}()
+	}
+
+	if result.Phase, err = waitPod(ctx, client, pod, opts.Timeout, opts.pollInterval); err != nil {
+		return nil, err
+	}
+	result.Duration = time.Since(start).Round(time.Second).String()
+	if result.Output, err = readLog(ctx, client, pod); err != nil {
+		return nil, err
+	}
+	if opts.Tool == ToolJuiceFS {
+		result.Metrics = parseJuiceFSBench(result.Output)
+	}
+	return result, record(ctx, client, result)
+}
+
+func command(opts Options) []string {
+	if opts.Tool == ToolFio {
+		args := opts.Args
+		if len(args) == 0 {
+			args = defaultFioArgs
+		}
+		return append([]string{"fio", "--name=" + LabelValue, "--directory=" + mountPath, "--output-format=json"}, args...)
+	}
+	return append([]string{config.CeCliPath, "bench", mountPath}, opts.Args...)
+}
+
+func newPod(result *Result, image string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      result.Name,
+			Namespace: result.Namespace,
+			Labels:    map[string]string{common.PodTypeKey: LabelValue},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{{
+				Name:         containerName,
+				Image:        image,
+				Command:      result.Command,
+				VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: mountPath}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: result.PVC},
+				},
+			}},
+		},
+	}
+}
+
+func waitPod(ctx context.Context, client *k8sclient.K8sClient, pod *corev1.Pod, timeout, interval time.Duration) (corev1.PodPhase, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p, err := client.GetPod(waitCtx, pod.Name, pod.Namespace)
+		if err != nil {
+			return "", err
+		}
+		if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			return p.Status.Phase, nil
+		}
+		select {
+		case <-waitCtx.Done():
+			return "", fmt.Errorf("bench pod %s is not finished in %s, phase %s", pod.Name, timeout, p.Status.Phase)
+		case <-ticker.C:
+		}
+	}
+}
+
+func readLog(ctx context.Context, client *k8sclient.K8sClient, pod *corev1.Pod) (string, error) {
+	stream, err := client.StreamPodLog(ctx, pod.Name, pod.Namespace, containerName, 0, false)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	data, err := io.ReadAll(stream)
+	return string(data), err
+}
+
+// parseJuiceFSBench parses the result table of `juicefs bench`, e.g.
+//
+//	|   Write big file |    1374.08 MiB/s |  2.98 s/file  |
+func parseJuiceFSBench(output string) []Metric {
+	var metrics []Metric
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		var cells []string
+		for _, cell := range strings.Split(strings.Trim(line, "|"), "|") {
+			cells = append(cells, strings.TrimSpace(cell))
+		}
+		if len(cells) < 2 || cells[0] == "" || strings.EqualFold(cells[0], "ITEM") {
+			continue
+		}
+		m := Metric{Item: cells[0], Value: cells[1]}
+		if len(cells) > 2 {
+			m.Cost = cells[2]
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// record saves the result into a configmap named after the bench pod, in the namespace of the PVC
+func record(ctx context.Context, client *k8sclient.K8sClient, result *Result) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return client.CreateConfigMap(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        result.Name,
+			Namespace:   result.Namespace,
+			Labels:      map[string]string{common.PodTypeKey: LabelValue},
+			Annotations: map[string]string{PVCAnnotationKey: result.Namespace + "/" + result.PVC},
+		},
+		Data: map[string]string{
+			resultKey: string(data),
+			outputKey: result.Output,
+		},
+	})
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.TrimRight(s[:n], "-.")
+}
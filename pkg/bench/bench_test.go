@@ -0,0 +1,93 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package bench
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestParseJuiceFSBench(t *testing.T) {
+	output := `Write big blocks: 1024/1024 [==============================================================]  449.4/s used: 2.2785s
++------------------+------------------+---------------+
+|       ITEM       |       VALUE      |      COST     |
++------------------+------------------+---------------+
+|   Write big file |    1374.08 MiB/s |  2.98 s/file  |
+|    Read big file |     851.65 MiB/s |  4.81 s/file  |
+|         Stat file |   1584.20 files/s |  0.63 ms/file |
++------------------+------------------+---------------+
+`
+	assert.Equal(t, []Metric{
+		{Item: "Write big file", Value: "1374.08 MiB/s", Cost: "2.98 s/file"},
+		{Item: "Read big file", Value: "851.65 MiB/s", Cost: "4.81 s/file"},
+		{Item: "Stat file", Value: "1584.20 files/s", Cost: "0.63 ms/file"},
+	}, parseJuiceFSBench(output))
+}
+
+func TestRun(t *testing.T) {
+	sc := "juicefs-sc"
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+		Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &sc},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+	client := &k8sclient.K8sClient{Interface: fake.NewSimpleClientset(pvc)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// the bench pod finishes once created
+	go func() {
+		for ctx.Err() == nil {
+			pods, _ := client.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+			if len(pods.Items) == 1 {
+				pod := pods.Items[0]
+				pod.Status.Phase = corev1.PodSucceeded
+				_, _ = client.CoreV1().Pods("default").UpdateStatus(ctx, &pod, metav1.UpdateOptions{})
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	result, err := Run(ctx, client, Options{Namespace: "default", PVC: "data", Tool: ToolFio, Image: "fio", pollInterval: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, corev1.PodSucceeded, result.Phase)
+	assert.Equal(t, sc, result.StorageClass)
+	assert.Equal(t, []string{"fio", "--name=juicefs-bench", "--directory=/data", "--output-format=json"}, result.Command[:4])
+
+	cm, err := client.GetConfigMap(ctx, result.Name, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, LabelValue, cm.Labels[common.PodTypeKey])
+	assert.Equal(t, "default/data", cm.Annotations[PVCAnnotationKey])
+	assert.Contains(t, cm.Data[resultKey], `"phase": "Succeeded"`)
+	// the bench pod is deleted
+	pods, _ := client.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+	assert.Empty(t, pods.Items)
+
+	pvc.Status.Phase = corev1.ClaimPending
+	_, _ = client.CoreV1().PersistentVolumeClaims("default").UpdateStatus(ctx, pvc, metav1.UpdateOptions{})
+	_, err = Run(ctx, client, Options{Namespace: "default", PVC: "data"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,267 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package client manages JuiceFS volumes programmatically, the same way CSI Controller provisions,
+// resizes and snapshots them, for operators and platform controllers that don't speak CSI gRPC.
+//
+// A volume is a sub directory of a file system, the one in the volume Secret. Volumes created by the
+// client can be used by statically provisioned PVs with the returned Volume.ID as the volumeHandle
+// and Volume.Context as the volumeAttributes, together with the same Secret:
+//
+//	c := client.New(k8sClient)
+//	vol, err := c.CreateVolume(ctx, client.CreateVolumeOptions{
+//		Name:          "data",
+//		CapacityBytes: 10 << 30,
+//		Secrets:       secrets,
+//	})
+//	...
+//	err = c.ResizeVolume(ctx, vol.ID, 20<<30, secrets, nil)
+//	snap, err := c.CreateSnapshot(ctx, vol.ID, "daily", secrets)
+//
+// Mounting the volumes is up to CSI Node.
+//
+// Scope: the client is the controller logic of CSI Driver made callable, not a standalone SDK.
+//   - The file system is operated by the juicefs CLI, the same as CSI Controller does, in the current process
+//     with the juicefs and juicefs.ce binaries at config.CliPath and config.CeCliPath, or in Jobs running the
+//     mount image in config.Namespace. There is no native metadata path, which would need the JuiceFS Go SDK
+//     that CSI Driver doesn't depend on.
+//   - It shares the process-wide settings in package config with the rest of CSI Driver, e.g. config.ByProcess,
+//     config.Namespace, the default mount images, config.StrictVolumeContext and config.FeatureGates, so there is
+//     one configuration per process. Set them before calling New, they default to those of CSI Controller.
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+// SnapshotDir is the directory in the file system where snapshots are cloned into,
+// the snapshot of a volume locates in SnapshotDir/<source volume id>/<snapshot name>.
+const SnapshotDir = ".snapshots"
+
+// Client manages volumes in JuiceFS file systems, it's safe for concurrent use
+// as long as the operations are on different volumes.
+type Client struct {
+	jfs juicefs.Interface
+}
+
+// New returns a client running the juicefs commands in the current process if config.ByProcess is true,
+// or in Jobs created by k8sClient otherwise
+func New(k8sClient *k8sclient.K8sClient) *Client {
+	return NewWithProvider(juicefs.NewJfsProvider(nil, k8sClient))
+}
+
+// NewWithProvider returns a client on top of the juicefs provider
+func NewWithProvider(jfs juicefs.Interface) *Client {
+	return &Client{jfs: jfs}
+}
+
+// Volume is a sub directory of a file system used as a volume
+type Volume struct {
+	// ID is the volumeHandle of the PV
+	ID string
+	// SubPath of the volume in the file system
+	SubPath string
+	// CapacityBytes is the quota of the volume, 0 for unlimited
+	CapacityBytes int64
+	// Context is the volumeAttributes of the PV
+	Context map[string]string
+}
+
+// CreateVolumeOptions are the options of CreateVolume
+type CreateVolumeOptions struct {
+	// Name is the ID and the sub path of the volume
+	Name string
+	// CapacityBytes is set as the quota of the volume, 0 for unlimited
+	CapacityBytes int64
+	// Parameters are the StorageClass parameters of the volume
+	Parameters map[string]string
+	// Secrets of the file system, in the format of the volume Secret
+	Secrets map[string]string
+	// SnapshotID restores the volume from the snapshot, see CreateSnapshot
+	SnapshotID string
+}
+
+// CreateVolume creates the directory of the volume and sets its quota
+func (c *Client) CreateVolume(ctx context.Context, opts CreateVolumeOptions) (*Volume, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("volume name cannot be empty")
+	}
+	volCtx := make(map[string]string, len(opts.Parameters)+2)
+	for k, v := range opts.Parameters {
+		volCtx[k] = v
+	}
+	if _, err := config.ParseVolumeContext(volCtx, true); err != nil {
+		return nil, err
+	}
+	vol := &Volume{ID: opts.Name, SubPath: opts.Name, CapacityBytes: opts.CapacityBytes, Context: volCtx}
+
+	if opts.SnapshotID != "" {
+		snapshotPath, err := SnapshotPath(opts.SnapshotID)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.jfs.JfsCloneVol(ctx, vol.ID, snapshotPath, vol.SubPath, opts.Secrets, volCtx); err != nil {
+			return nil, fmt.Errorf("restore volume %s from snapshot %s: %v", vol.ID, opts.SnapshotID, err)
+		}
+	} else if err := c.jfs.JfsCreateVol(ctx, vol.ID, vol.SubPath, opts.Secrets, volCtx); err != nil {
+		return nil, fmt.Errorf("create volume %s: %v", vol.ID, err)
+	}
+
+	if opts.CapacityBytes > 0 {
+		settings, err := c.Settings(ctx, vol.ID, opts.Secrets, volCtx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.SetCapacity(ctx, settings, vol.SubPath, opts.Secrets, opts.CapacityBytes); err != nil {
+			return nil, err
+		}
+	}
+	volCtx["subPath"] = vol.SubPath
+	volCtx["capacity"] = strconv.FormatInt(opts.CapacityBytes, 10)
+	return vol, nil
+}
+
+// DeleteVolume deletes the directory of the volume, or destroys the file system of bucket-per-volume volumes.
+// volCtx and options are the volumeAttributes and mountOptions of the PV, looked up by the volume ID if nil.
+func (c *Client) DeleteVolume(ctx context.Context, volumeID string, secrets, volCtx map[string]string, options []string) error {
+	var err error
+	if volCtx == nil {
+		err = c.jfs.JfsDeleteVol(ctx, volumeID, volumeID, secrets, nil, nil)
+	} else {
+		err = c.jfs.JfsDeleteSubPath(ctx, volumeID, volumeID, secrets, volCtx, options)
+	}
+	if err != nil {
+		return fmt.Errorf("delete volume %s: %v", volumeID, err)
+	}
+	return nil
+}
+
+// ResizeVolume sets the quota of the volume to the capacity, options are the mount options of the PV
+func (c *Client) ResizeVolume(ctx context.Context, volumeID string, capacity int64, secrets map[string]string, options []string) error {
+	settings, err := c.Settings(ctx, volumeID, secrets, nil, options)
+	if err != nil {
+		return err
+	}
+	subPath, err := c.jfs.GetSubPath(ctx, volumeID)
+	if err != nil {
+		return fmt.Errorf("get subPath of volume %s: %v", volumeID, err)
+	}
+	return c.SetCapacity(ctx, settings, subPath, secrets, capacity)
+}
+
+// Settings returns the mount settings of the volume, the same as those of its mount pods
+func (c *Client) Settings(ctx context.Context, volumeID string, secrets, volCtx map[string]string, options []string) (*config.JfsSetting, error) {
+	settings, err := c.jfs.Settings(ctx, volumeID, volumeID, secrets["name"], secrets, volCtx, options)
+	if err != nil {
+		return nil, fmt.Errorf("get settings of volume %s: %v", volumeID, err)
+	}
+	return settings, nil
+}
+
+// SetCapacity sets the quota of the sub path, under the subdir in the mount options if any
+func (c *Client) SetCapacity(ctx context.Context, settings *config.JfsSetting, subPath string, secrets map[string]string, capacity int64) error {
+	var subdir string
+	for _, o := range settings.Options {
+		pair := strings.Split(o, "=")
+		if len(pair) != 2 {
+			continue
+		}
+		if pair[0] == "subdir" {
+			subdir = path.Join("/", pair[1])
+		}
+	}
+	if err := c.jfs.SetQuota(ctx, secrets, settings, path.Join(subdir, subPath), capacity); err != nil {
+		return fmt.Errorf("set quota: %v", err)
+	}
+	return nil
+}
+
+// Snapshot is a clone of a volume
+type Snapshot struct {
+	// ID is in format of <source volume id>/<snapshot name>
+	ID             string
+	SourceVolumeID string
+	CreationTime   time.Time
+}
+
+// CreateSnapshot clones the directory of the volume into SnapshotDir,
+// the snapshot is ready to use as soon as the clone finishes
+func (c *Client) CreateSnapshot(ctx context.Context, sourceVolumeID, name string, secrets map[string]string) (*Snapshot, error) {
+	if name == "" || sourceVolumeID == "" {
+		return nil, fmt.Errorf("snapshot name and source volume ID cannot be empty")
+	}
+	srcSubPath, err := c.jfs.GetSubPath(ctx, sourceVolumeID)
+	if err != nil {
+		return nil, fmt.Errorf("get subPath of volume %s: %v", sourceVolumeID, err)
+	}
+	if err := c.jfs.JfsCloneVol(ctx, snapshotKey(sourceVolumeID, name), srcSubPath, path.Join(SnapshotDir, sourceVolumeID, name), secrets, nil); err != nil {
+		return nil, fmt.Errorf("clone volume %s: %v", sourceVolumeID, err)
+	}
+	return &Snapshot{ID: SnapshotID(sourceVolumeID, name), SourceVolumeID: sourceVolumeID, CreationTime: time.Now()}, nil
+}
+
+// DeleteSnapshot deletes the directory of the snapshot
+func (c *Client) DeleteSnapshot(ctx context.Context, snapshotID string, secrets map[string]string) error {
+	sourceVolumeID, name, err := ParseSnapshotID(snapshotID)
+	if err != nil {
+		return err
+	}
+	snapshotPath, _ := SnapshotPath(snapshotID)
+	if err := c.jfs.JfsDeleteSnapshot(ctx, snapshotKey(sourceVolumeID, name), snapshotPath, secrets); err != nil {
+		return fmt.Errorf("delete snapshot %s: %v", snapshotID, err)
+	}
+	return nil
+}
+
+// SnapshotID generates snapshot id in format of <source volume id>/<snapshot name>
+func SnapshotID(sourceVolumeID, name string) string {
+	return sourceVolumeID + "/" + name
+}
+
+// snapshotKey names the job or the temporary mount point which operates the snapshot. The source volume is hashed
+// into it, so that snapshots of the same name in different file systems don't share them.
+func snapshotKey(sourceVolumeID, name string) string {
+	h := sha256.Sum256([]byte(SnapshotID(sourceVolumeID, name)))
+	return fmt.Sprintf("%s-%x", name, h[:4])
+}
+
+// ParseSnapshotID returns the source volume id and the name of the snapshot
+func ParseSnapshotID(snapshotID string) (sourceVolumeID, name string, err error) {
+	idx := strings.LastIndex(snapshotID, "/")
+	if idx <= 0 || idx == len(snapshotID)-1 {
+		return "", "", fmt.Errorf("snapshot id %q is not in format of <volume id>/<snapshot name>", snapshotID)
+	}
+	return snapshotID[:idx], snapshotID[idx+1:], nil
+}
+
+// SnapshotPath returns the path of the snapshot in the file system
+func SnapshotPath(snapshotID string) (string, error) {
+	sourceVolumeID, name, err := ParseSnapshotID(snapshotID)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(SnapshotDir, sourceVolumeID, name), nil
+}
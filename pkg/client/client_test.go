@@ -0,0 +1,90 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+)
+
+func TestParseSnapshotID(t *testing.T) {
+	tests := []struct {
+		id         string
+		wantVolume string
+		wantName   string
+		wantErr    bool
+	}{
+		{id: "pvc-a/snapshot-a", wantVolume: "pvc-a", wantName: "snapshot-a"},
+		{id: "static/pv/snapshot-a", wantVolume: "static/pv", wantName: "snapshot-a"},
+		{id: "snapshot-a", wantErr: true},
+		{id: "/snapshot-a", wantErr: true},
+		{id: "pvc-a/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			volume, name, err := ParseSnapshotID(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSnapshotID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if volume != tt.wantVolume || name != tt.wantName {
+				t.Errorf("ParseSnapshotID() got = %s, %s, want %s, %s", volume, name, tt.wantVolume, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.TODO()
+	secrets := map[string]string{"name": "myjfs", "metaurl": "redis://127.0.0.1:6379/0"}
+	settings := &config.JfsSetting{Options: []string{"subdir=/team"}}
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	jfs := mocks.NewMockInterface(mockCtl)
+	c := NewWithProvider(jfs)
+
+	jfs.EXPECT().JfsCreateVol(ctx, "data", "data", secrets, gomock.Any()).Return(nil)
+	jfs.EXPECT().Settings(ctx, "data", "data", "myjfs", secrets, gomock.Any(), nil).Return(settings, nil)
+	jfs.EXPECT().SetQuota(ctx, secrets, settings, "/team/data", int64(1<<30)).Return(nil)
+	vol, err := c.CreateVolume(ctx, CreateVolumeOptions{Name: "data", CapacityBytes: 1 << 30, Secrets: secrets})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"subPath": "data", "capacity": "1073741824"}, vol.Context)
+
+	jfs.EXPECT().Settings(ctx, "data", "data", "myjfs", secrets, nil, nil).Return(settings, nil)
+	jfs.EXPECT().GetSubPath(ctx, "data").Return("data", nil)
+	jfs.EXPECT().SetQuota(ctx, secrets, settings, "/team/data", int64(2<<30)).Return(nil)
+	assert.NoError(t, c.ResizeVolume(ctx, "data", 2<<30, secrets, nil))
+
+	jfs.EXPECT().GetSubPath(ctx, "data").Return("data", nil)
+	jfs.EXPECT().JfsCloneVol(ctx, "daily-0de55596", "data", ".snapshots/data/daily", secrets, nil).Return(nil)
+	snap, err := c.CreateSnapshot(ctx, "data", "daily", secrets)
+	assert.NoError(t, err)
+	assert.Equal(t, "data/daily", snap.ID)
+
+	jfs.EXPECT().JfsCloneVol(ctx, "restored", ".snapshots/data/daily", "restored", secrets, gomock.Any()).Return(nil)
+	_, err = c.CreateVolume(ctx, CreateVolumeOptions{Name: "restored", Secrets: secrets, SnapshotID: snap.ID})
+	assert.NoError(t, err)
+
+	jfs.EXPECT().JfsDeleteSnapshot(ctx, "daily-0de55596", ".snapshots/data/daily", secrets).Return(nil)
+	assert.NoError(t, c.DeleteSnapshot(ctx, snap.ID, secrets))
+	assert.Error(t, c.DeleteSnapshot(ctx, "daily", secrets))
+}
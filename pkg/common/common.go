@@ -41,6 +41,8 @@ const (
 	PublishSecretNamespace          = "csi.storage.k8s.io/node-publish-secret-namespace"
 	ControllerExpandSecretName      = "csi.storage.k8s.io/controller-expand-secret-name"
 	ControllerExpandSecretNamespace = "csi.storage.k8s.io/controller-expand-secret-namespace"
+	SnapshotterSecretName           = "csi.storage.k8s.io/snapshotter-secret-name"
+	SnapshotterSecretNamespace      = "csi.storage.k8s.io/snapshotter-secret-namespace"
 
 	// webhook
 	WebhookName          = "juicefs-admission-webhook"
@@ -52,24 +54,102 @@ const (
 	InjectSidecarDisable = "disable" + injectSidecar
 
 	// config in pv
-	MountPodCpuLimitKey    = "juicefs/mount-cpu-limit"
-	MountPodMemLimitKey    = "juicefs/mount-memory-limit"
-	MountPodCpuRequestKey  = "juicefs/mount-cpu-request"
-	MountPodMemRequestKey  = "juicefs/mount-memory-request"
-	MountPodLabelKey       = "juicefs/mount-labels"
-	MountPodAnnotationKey  = "juicefs/mount-annotations"
-	MountPodServiceAccount = "juicefs/mount-service-account"
-	MountPodImageKey       = "juicefs/mount-image"
-	DeleteDelay            = "juicefs/mount-delete-delay"
-	CleanCacheKey          = "juicefs/clean-cache"
-	CachePVC               = "juicefs/mount-cache-pvc"
-	CacheEmptyDir          = "juicefs/mount-cache-emptydir"
-	CacheInlineVolume      = "juicefs/mount-cache-inline-volume"
-	MountPodHostPath       = "juicefs/host-path"
+	MountPodCpuLimitKey      = "juicefs/mount-cpu-limit"
+	MountPodMemLimitKey      = "juicefs/mount-memory-limit"
+	MountPodCpuRequestKey    = "juicefs/mount-cpu-request"
+	MountPodMemRequestKey    = "juicefs/mount-memory-request"
+	MountPodLabelKey         = "juicefs/mount-labels"
+	MountPodAnnotationKey    = "juicefs/mount-annotations"
+	MountPodServiceAccount   = "juicefs/mount-service-account"
+	MountPodImageKey         = "juicefs/mount-image"
+	DeleteDelay              = "juicefs/mount-delete-delay"
+	CleanCacheKey            = "juicefs/clean-cache"
+	CleanCacheOnUnpublishKey = "juicefs/clean-cache-on-unpublish"
+	CachePVC                 = "juicefs/mount-cache-pvc"
+	CacheEmptyDir            = "juicefs/mount-cache-emptydir"
+	CacheInlineVolume        = "juicefs/mount-cache-inline-volume"
+	MountPodHostPath         = "juicefs/host-path"
+	VerifyOnMountKey         = "juicefs/verify-on-mount"
+	VerifyOnMountSampleKey   = "juicefs/verify-on-mount-sample"
+	SecretProviderKey        = "juicefs/secret-provider"
+	SecretPathKey            = "juicefs/secret-path"
+	SecretVaultRoleKey       = "juicefs/secret-vault-role"
+	FormatDriftKey           = "juicefs/format-drift"
+	MirrorOfKey              = "juicefs/mirror-of"
+	OptionProfileKey         = "juicefs/option-profile"
+	StrictCapacityKey        = "juicefs/strict-capacity"
+	AuditSampleRateKey       = "juicefs/audit-sample-rate"
+	// UploadLimitKey and DownloadLimitKey PVC annotations, bandwidth limits of the volume in Mbps
+	UploadLimitKey   = "juicefs.com/upload-limit"
+	DownloadLimitKey = "juicefs.com/download-limit"
+	// ScratchTTLKey volume attribute of inline ephemeral volumes, data of the volume is deleted after the TTL once no pod uses it
+	ScratchTTLKey = "juicefs/scratch-ttl"
+	// FuseOptionsKey comma separated FUSE options passed through to the mount command, e.g. max_readahead=1048576
+	FuseOptionsKey = "juicefs/fuse-options"
+	// CachePresetKey volume attribute, metadata cache timeouts tuned for a workload, one of metadata-heavy,
+	// many-small-files and large-sequential, overridden by AttrCacheKey, EntryCacheKey, DirEntryCacheKey and OpenCacheKey
+	CachePresetKey = "juicefs/cache-preset"
+	// AttrCacheKey, EntryCacheKey, DirEntryCacheKey and OpenCacheKey volume attributes, the metadata cache timeouts
+	// of the client, in seconds or durations like 30s
+	AttrCacheKey     = "juicefs/attr-cache"
+	EntryCacheKey    = "juicefs/entry-cache"
+	DirEntryCacheKey = "juicefs/dir-entry-cache"
+	OpenCacheKey     = "juicefs/open-cache"
+	// PodInfoTagsKey volume attribute, "true" to mount the volume for each pod consuming it, tagged with the identity of the pod
+	PodInfoTagsKey = "juicefs/pod-info-tags"
+	// ImportedFromKey volume attribute of PVs imported from another cluster, the source cluster; such volumes are always mounted read-only
+	ImportedFromKey = "juicefs/imported-from"
+	// VolumePoolSizeKey StorageClass parameter, number of empty directories pre-created for new PVCs to be assigned instantly
+	VolumePoolSizeKey = "juicefs/volume-pool-size"
+	// MountStrategyKey volume attribute, "shared" to mount the whole file system and bind the subPath of the volume,
+	// "subdir" to mount the subPath only with the subdir option, so that clients can't traverse outside of the volume
+	MountStrategyKey = "juicefs/mount-strategy"
+	// BucketPerVolumeKey StorageClass parameter, "true" to give each volume a dedicated file system,
+	// whose objects are isolated under its own prefix and destroyed with the volume
+	BucketPerVolumeKey = "juicefs/bucket-per-volume"
+	// MountMetricsKey volume attribute, "off" to listen the metrics of mount pods on the loopback address only,
+	// so that they never conflict with other mounts on the host network, nor are they scraped
+	MountMetricsKey = "juicefs/mount-metrics"
+	// DirTreeKey StorageClass parameter or PVC annotation, [<namespace>/]<name> of the configmap describing
+	// the directory tree created in new volumes, in the namespace of the PVC if not specified
+	DirTreeKey = "juicefs/dir-tree"
+	// DirTreeSpecKey volume attribute, the directory tree read from DirTreeKey at provision time, in JSON
+	DirTreeSpecKey = "juicefs/dir-tree-spec"
+	// RemoteMountKey StorageClass parameter, "nfs" to run the mount of the volume on storage nodes and mount it over NFS
+	// on other nodes, for clusters where FUSE is not allowed on worker nodes
+	RemoteMountKey = "juicefs/remote-mount"
+	// StorageNodeSelectorKey StorageClass parameter, label selector of the storage nodes exporting volumes of RemoteMountKey,
+	// StorageNodeLabelKey=true by default
+	StorageNodeSelectorKey = "juicefs/storage-node-selector"
+	// ExportReplicasKey StorageClass parameter, number of pods exporting the volume of RemoteMountKey, 2 by default
+	ExportReplicasKey = "juicefs/export-replicas"
+	// ObjectStorageClassKey StorageClass parameter, storage class of objects written to the volume, e.g. STANDARD_IA,
+	// also the default one of the dedicated file system of BucketPerVolumeKey
+	ObjectStorageClassKey = "juicefs/object-storage-class"
+	// VolumeFormatOptionsKey StorageClass parameter, format options of the dedicated file system of BucketPerVolumeKey,
+	// e.g. "compress=zstd,trash-days=0", overriding format-options in the secret
+	VolumeFormatOptionsKey = "juicefs/volume-format-options"
+	// RootlessKey StorageClass parameter, "true" to run mount pods of the volume as a non-root user without privileges,
+	// the FUSE mount point is mounted by the node service and handed over to the mount pod
+	RootlessKey = "juicefs/rootless"
 
 	// DeleteDelayTimeKey mount pod annotation
 	DeleteDelayTimeKey = "juicefs-delete-delay"
 	DeleteDelayAtKey   = "juicefs-delete-at"
+	// NodeUIDKey mount pod annotation, UID of the node which the mount pod is created on
+	NodeUIDKey = "juicefs-node-uid"
+	// TraceparentKey mount pod and job annotation, W3C traceparent of the operation which created it
+	TraceparentKey = "juicefs-traceparent"
+	// FsNameKey mount pod annotation, name of the file system mounted
+	FsNameKey = "juicefs-fs-name"
+	// ConsumerPodKey mount pod annotation, <namespace>/<name> of the pod the mount is dedicated to by PodInfoTagsKey
+	ConsumerPodKey = "juicefs-consumer-pod"
+	// ConsumerServiceAccountKey mount pod annotation, service account of the pod the mount is dedicated to
+	ConsumerServiceAccountKey = "juicefs-consumer-service-account"
+	// ShrunkBufferSizeKey mount pod annotation, buffer-size in MiB the mount pod is recreated with to relieve memory pressure
+	ShrunkBufferSizeKey = "juicefs-shrunk-buffer-size"
+	// MetricsPortKey mount pod annotation, metrics port assigned to the mount pod on the host network
+	MetricsPortKey = "juicefs-metrics-port"
 
 	// pod immediate reconciler key
 	ImmediateReconcilerKey = "juicefs-immediate-reconciler"
@@ -85,12 +165,61 @@ const (
 
 	PodInfoName      = "csi.storage.k8s.io/pod.name"
 	PodInfoNamespace = "csi.storage.k8s.io/pod.namespace"
+	PodInfoUID       = "csi.storage.k8s.io/pod.uid"
+	PodInfoSA        = "csi.storage.k8s.io/serviceAccount.name"
+	// set by kubelet for CSI inline ephemeral volumes
+	EphemeralKey = "csi.storage.k8s.io/ephemeral"
+	// set by csi-provisioner with --extra-create-metadata
+	PVCNameKey      = "csi.storage.k8s.io/pvc/name"
+	PVCNamespaceKey = "csi.storage.k8s.io/pvc/namespace"
+
+	// PausedAnnotationKey PV or StorageClass annotation, freezes publishing and provisioning during maintenance
+	PausedAnnotationKey = "juicefs.com/paused"
+	// ClaimAnnotationKey PV annotation, metadata of the PVC which the PV is provisioned for, used to recreate it
+	ClaimAnnotationKey = "juicefs.com/claim"
+	// CheckpointOfKey PVC annotation, the PVC is bound to a read-only clone of the source PVC in the same namespace
+	CheckpointOfKey = "juicefs.com/checkpoint-of"
+	// CheckpointLabelKey PV label, marks the PVs of checkpoints, which are deleted with their clones once released
+	CheckpointLabelKey = "juicefs.com/checkpoint"
+	// NodeFsLabelPrefix node label prefix, juicefs.com/fs-<name>=mounted is set when the file system is mounted on the node
+	NodeFsLabelPrefix = "juicefs.com/fs-"
+	NodeFsLabelValue  = "mounted"
+	// FuseReadyLabelKey node label, "true" or "false" by whether the FUSE module of the node passes the checks of CSI Node,
+	// reported as the topology of the node so that kubelet sets it on registration
+	FuseReadyLabelKey = "juicefs.com/fuse-ready"
+	// ScratchLabelKey secret label, marks the records of scratch volumes
+	ScratchLabelKey = "juicefs.com/scratch"
+	// ScratchDir directory in the file system holding scratch volumes
+	ScratchDir = "juicefs-scratch"
+	// VolumePoolDir directory in the file system holding directories pre-created by volume pools
+	VolumePoolDir = "juicefs-pool"
+	// SnapshotRecordKey configmap label and data key, marks the records of snapshots created by CSI Controller
+	SnapshotRecordKey = "juicefs.com/snapshot"
+	// VolumePoolLabelKey configmap label, marks the records of volume pools
+	VolumePoolLabelKey = "juicefs.com/volume-pool"
+	// CapacitySyncKey PV annotation, overrides how quota drift of static PVs is handled: off, report or correct
+	CapacitySyncKey = "juicefs.com/capacity-sync"
+	// AttachTargetsKey lease annotation, targets of the single-node volume published on the holder node and their pods
+	AttachTargetsKey = "juicefs.com/attach-targets"
+	// StorageNodeLabelKey node label, nodes labeled true export volumes of RemoteMountKey by default
+	StorageNodeLabelKey = "juicefs.com/storage-node"
+	// ExportLabelKey export pod and service label, name of the export of the volume
+	ExportLabelKey = "juicefs.com/export"
+	// ExportHashKey export deployment annotation, hash of the spec the deployment is updated to
+	ExportHashKey = "juicefs.com/export-hash"
+	// StorageClassParametersKey PV annotation, parameters of the StorageClass the PV is provisioned from in JSON,
+	// kept to handle the volume or recreate the StorageClass once it's deleted
+	StorageClassParametersKey = "juicefs.com/storageclass-parameters"
+	// StorageClassFinalizer StorageClass finalizer, holds the deletion of the StorageClass until no PV is provisioned from it
+	StorageClassFinalizer = "juicefs.com/storageclass-protection"
 
 	// smooth upgrade
 	JfsUpgradeProcess   = "juicefs-upgrade-process"
 	JfsFuseFsPathInPod  = "/tmp"
 	JfsFuseFsPathInHost = "/var/run/juicefs-csi"
 	JfsCommEnv          = "JFS_SUPER_COMM"
+	// JfsRetiredByKey mount pod annotation, name of the standby mount pod which its targets are switched to
+	JfsRetiredByKey = "juicefs-retired-by"
 
 	JfsJobKind    = "juicefs-job-kind"
 	KindOfUpgrade = "juicefs-upgrade"
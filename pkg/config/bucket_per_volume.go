@@ -0,0 +1,83 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+// maxFsNameLen is the max length of file system names of community edition
+const maxFsNameLen = 63
+
+var invalidFsNameChars = regexp.MustCompile(`[^a-z0-9-]`)
+
+// BucketPerVolume tells if the volume has a dedicated file system, set by common.BucketPerVolumeKey
+func BucketPerVolume(volCtx map[string]string) bool {
+	v, _ := strconv.ParseBool(volCtx[common.BucketPerVolumeKey])
+	return v
+}
+
+// VolumeSecrets returns the secrets of the dedicated file system of the volume, derived from the shared ones:
+// the file system is named after the volume, so that its objects are stored under its own prefix in the bucket,
+// and its metadata is stored under the volume ID in the metadata engine, which must support key prefixes.
+// Only community edition is supported, file systems of enterprise edition are created in the web console,
+// so volumes of enterprise edition are rejected.
+func VolumeSecrets(secrets map[string]string, volumeId string) (map[string]string, error) {
+	metaUrl := secrets["metaurl"]
+	if metaUrl == "" {
+		return nil, fmt.Errorf("%s is only supported by community edition, file systems of enterprise edition can't be created by CSI Driver, create them in the web console instead",
+			common.BucketPerVolumeKey)
+	}
+	scheme, rest, ok := strings.Cut(metaUrl, "://")
+	if !ok || (scheme != "tikv" && scheme != "etcd") {
+		return nil, fmt.Errorf("%s requires tikv:// or etcd:// metadata engine to store file systems of volumes under different prefixes, got %s://",
+			common.BucketPerVolumeKey, scheme)
+	}
+	rest, query, hasQuery := strings.Cut(rest, "?")
+	hosts, prefix, _ := strings.Cut(rest, "/")
+	prefix = strings.Trim(prefix+"/"+volumeId, "/")
+	metaUrl = scheme + "://" + hosts + "/" + prefix
+	if hasQuery {
+		metaUrl += "?" + query
+	}
+
+	volSecrets := make(map[string]string, len(secrets))
+	for k, v := range secrets {
+		volSecrets[k] = v
+	}
+	volSecrets["metaurl"] = metaUrl
+	volSecrets["name"] = volumeFsName(secrets["name"], volumeId)
+	return volSecrets, nil
+}
+
+// volumeFsName names the file system of the volume, which is also the prefix of its objects in the bucket
+func volumeFsName(name, volumeId string) string {
+	fsName := invalidFsNameChars.ReplaceAllString(strings.ToLower(name+"-"+volumeId), "-")
+	if len(fsName) <= maxFsNameLen {
+		return fsName
+	}
+	sum := sha256.Sum256([]byte(volumeId))
+	suffix := hex.EncodeToString(sum[:])[:8]
+	return strings.TrimRight(fsName[:maxFsNameLen-len(suffix)-1], "-") + "-" + suffix
+}
@@ -0,0 +1,82 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVolumeSecrets(t *testing.T) {
+	tests := []struct {
+		name     string
+		secrets  map[string]string
+		volumeId string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "tikv",
+			secrets:  map[string]string{"name": "jfs", "metaurl": "tikv://pd1:2379,pd2:2379/shared?ca=/ca.pem", "bucket": "https://b.s3.amazonaws.com"},
+			volumeId: "pvc-1",
+			want:     map[string]string{"name": "jfs-pvc-1", "metaurl": "tikv://pd1:2379,pd2:2379/shared/pvc-1?ca=/ca.pem", "bucket": "https://b.s3.amazonaws.com"},
+		},
+		{
+			name:     "etcd-without-prefix",
+			secrets:  map[string]string{"name": "jfs", "metaurl": "etcd://etcd:2379"},
+			volumeId: "pvc-1",
+			want:     map[string]string{"name": "jfs-pvc-1", "metaurl": "etcd://etcd:2379/pvc-1"},
+		},
+		{
+			name:     "redis",
+			secrets:  map[string]string{"name": "jfs", "metaurl": "redis://redis:6379/1"},
+			volumeId: "pvc-1",
+			wantErr:  true,
+		},
+		{
+			name:     "ee",
+			secrets:  map[string]string{"name": "jfs", "token": "xxx"},
+			volumeId: "pvc-1",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VolumeSecrets(tt.secrets, tt.volumeId)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VolumeSecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VolumeSecrets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVolumeFsName(t *testing.T) {
+	if got := volumeFsName("My_FS", "pvc-1"); got != "my-fs-pvc-1" {
+		t.Errorf("volumeFsName() = %v, want my-fs-pvc-1", got)
+	}
+	long := volumeFsName("juicefs-volume", "pvc-6a3f1a2e-9c4b-4e0f-8a57-2f1b0c9d7e31-extra")
+	if len(long) > maxFsNameLen || !strings.HasPrefix(long, "juicefs-volume-pvc-") {
+		t.Errorf("volumeFsName() = %v, should be truncated to %d chars", long, maxFsNameLen)
+	}
+	if other := volumeFsName("juicefs-volume", "pvc-6a3f1a2e-9c4b-4e0f-8a57-2f1b0c9d7e31-other"); other == long {
+		t.Errorf("volumeFsName() of different volumes should differ, got %v", other)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+// cacheTimeout is a metadata cache timeout of the client, set by its key in volume context
+type cacheTimeout struct {
+	key string
+	// ceOption and eeOption are the mount options in community and enterprise edition
+	ceOption string
+	eeOption string
+}
+
+var cacheTimeouts = []cacheTimeout{
+	{key: common.AttrCacheKey, ceOption: "attr-cache", eeOption: "attrcacheto"},
+	{key: common.EntryCacheKey, ceOption: "entry-cache", eeOption: "entrycacheto"},
+	{key: common.DirEntryCacheKey, ceOption: "dir-entry-cache", eeOption: "direntrycacheto"},
+	// enterprise edition only turns open cache on or off, which expires with the attributes
+	{key: common.OpenCacheKey, ceOption: "open-cache", eeOption: "opencache"},
+}
+
+// cachePresets are cache timeouts in seconds tuned for workloads, selected by common.CachePresetKey:
+//   - metadata-heavy: frequent lookups and stats of a tree changed by few clients, e.g. builds and code repos
+//   - many-small-files: read-mostly datasets of small files opened over and over, e.g. training epochs
+//   - large-sequential: few large files read through, metadata is kept consistent while chunks of open files are cached
+var cachePresets = map[string]map[string]string{
+	"metadata-heavy": {
+		common.AttrCacheKey:     "30",
+		common.EntryCacheKey:    "30",
+		common.DirEntryCacheKey: "30",
+		common.OpenCacheKey:     "0",
+	},
+	"many-small-files": {
+		common.AttrCacheKey:     "60",
+		common.EntryCacheKey:    "60",
+		common.DirEntryCacheKey: "60",
+		common.OpenCacheKey:     "60",
+	},
+	"large-sequential": {
+		common.AttrCacheKey:     "1",
+		common.EntryCacheKey:    "1",
+		common.DirEntryCacheKey: "1",
+		common.OpenCacheKey:     "300",
+	},
+}
+
+// CacheOptions returns the mount options of the metadata cache timeouts of the volume, set by common.CachePresetKey
+// and overridden by the keys of each timeout
+func CacheOptions(volCtx map[string]string, isCe bool) ([]string, error) {
+	preset := map[string]string{}
+	if name := volCtx[common.CachePresetKey]; name != "" {
+		if err := validateCachePreset(name); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", common.CachePresetKey, err)
+		}
+		preset = cachePresets[name]
+	}
+	var options []string
+	for _, t := range cacheTimeouts {
+		value := volCtx[t.key]
+		if value == "" {
+			value = preset[t.key]
+		}
+		if value == "" {
+			continue
+		}
+		seconds, err := cacheTimeoutSeconds(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", t.key, err)
+		}
+		switch {
+		case isCe:
+			options = append(options, fmt.Sprintf("%s=%s", t.ceOption, seconds))
+		case t.key == common.OpenCacheKey:
+			if seconds != "0" {
+				options = append(options, t.eeOption)
+			}
+		default:
+			options = append(options, fmt.Sprintf("%s=%s", t.eeOption, seconds))
+		}
+	}
+	return options, nil
+}
+
+// cacheTimeoutSeconds returns the timeout in seconds, which is understood by clients of all versions,
+// v is either in seconds or a duration like 30s
+func cacheTimeoutSeconds(v string) (string, error) {
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		d, derr := time.ParseDuration(v)
+		if derr != nil {
+			return "", fmt.Errorf("%q is neither seconds nor a duration", v)
+		}
+		seconds = d.Seconds()
+	}
+	if seconds < 0 || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return "", fmt.Errorf("%q is not a valid timeout", v)
+	}
+	return strconv.FormatFloat(seconds, 'f', -1, 64), nil
+}
+
+func validateCacheTimeout(v string) error {
+	_, err := cacheTimeoutSeconds(v)
+	return err
+}
+
+func validateCachePreset(v string) error {
+	if _, ok := cachePresets[v]; ok {
+		return nil
+	}
+	names := make([]string, 0, len(cachePresets))
+	for name := range cachePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown cache preset %q, should be one of %s", v, strings.Join(names, ", "))
+}
@@ -0,0 +1,111 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+func TestCacheOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		volCtx map[string]string
+		isCe   bool
+		want   []string
+	}{
+		{
+			name:   "none",
+			volCtx: map[string]string{},
+			isCe:   true,
+		},
+		{
+			name:   "preset",
+			volCtx: map[string]string{common.CachePresetKey: "many-small-files"},
+			isCe:   true,
+			want:   []string{"attr-cache=60", "entry-cache=60", "dir-entry-cache=60", "open-cache=60"},
+		},
+		{
+			name:   "override preset",
+			volCtx: map[string]string{common.CachePresetKey: "metadata-heavy", common.EntryCacheKey: "2m", common.OpenCacheKey: "0.5"},
+			isCe:   true,
+			want:   []string{"attr-cache=30", "entry-cache=120", "dir-entry-cache=30", "open-cache=0.5"},
+		},
+		{
+			name:   "ee",
+			volCtx: map[string]string{common.CachePresetKey: "large-sequential"},
+			want:   []string{"attrcacheto=1", "entrycacheto=1", "direntrycacheto=1", "opencache"},
+		},
+		{
+			name:   "ee without open cache",
+			volCtx: map[string]string{common.AttrCacheKey: "10s", common.OpenCacheKey: "0"},
+			want:   []string{"attrcacheto=10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CacheOptions(tt.volCtx, tt.isCe)
+			if err != nil {
+				t.Fatalf("CacheOptions() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CacheOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, volCtx := range []map[string]string{
+		{common.CachePresetKey: "fast"},
+		{common.AttrCacheKey: "-1"},
+		{common.EntryCacheKey: "1h-"},
+		{common.DirEntryCacheKey: "NaN"},
+	} {
+		if _, err := CacheOptions(volCtx, true); err == nil {
+			t.Errorf("CacheOptions(%v) expected error", volCtx)
+		}
+		if _, err := ParseVolumeContext(volCtx, true); err == nil {
+			t.Errorf("ParseVolumeContext(%v) expected error", volCtx)
+		}
+	}
+}
+
+func TestParseSettingWithCachePreset(t *testing.T) {
+	defer GlobalConfig.Reset()
+	GlobalConfig.OptionProfiles = []OptionProfile{
+		{Name: "training", MountOptions: []string{"attr-cache=5", "buffer-size=1024"}},
+	}
+	secrets := map[string]string{"name": "test", "metaurl": "redis://127.0.0.1:6379/0"}
+	volCtx := map[string]string{common.OptionProfileKey: "training", common.CachePresetKey: "metadata-heavy"}
+
+	got, err := ParseSetting(context.TODO(), secrets, volCtx, []string{"dir-entry-cache=1", "writeback"}, "pv", "pv", "test", nil, nil)
+	if err != nil {
+		t.Fatalf("ParseSetting() error = %v", err)
+	}
+	// mount options override the preset, which overrides the profile
+	want := []string{"buffer-size=1024", "attr-cache=30", "entry-cache=30", "open-cache=0", "dir-entry-cache=1", "writeback"}
+	if !reflect.DeepEqual(got.Options, want) {
+		t.Errorf("ParseSetting() options = %v, want %v", got.Options, want)
+	}
+
+	volCtx[common.CachePresetKey] = "fast"
+	if _, err := ParseSetting(context.TODO(), secrets, volCtx, nil, "pv", "pv", "test", nil, nil); err == nil {
+		t.Errorf("ParseSetting() with unknown cache preset should fail")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"hash/fnv"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -52,17 +53,51 @@ var (
 	Immutable              = false            // csi driver is running in an immutable environment
 	StorageClassShareMount = false            // share mount pod for the same storage class
 	AccessToKubelet        = false            // access kubelet or not
+	LabelNode              = false            // label the node with the file systems mounted on it
+	ThrottleWatcher        = false            // recreate mount pods when the bandwidth limits in PVC annotations change
+	AdminByJob             = false            // set quota and create subdirs of volumes in jobs, instead of in CSI containers
+	StorageClassProtection = false            // hold the deletion of StorageClasses until no PV is provisioned from them
 
 	DriverName               = "csi.juicefs.com"
 	NodeName                 = ""
+	NodeUID                  = ""          // UID of the node object, changes when the node is recreated with the same name
+	NodeCreationTime         = time.Time{} // creation time of the node object
 	Namespace                = ""
 	PodName                  = ""
 	HostIp                   = ""
+	IPv6                     = false // mount pods listen on IPv6 wildcard address, used in IPv6-only clusters
 	KubeletPort              = ""
+	AuditSink                = "" // where audit events of access log are shipped, stdout or an HTTP URL
 	ReconcileTimeout         = 5 * time.Minute
+	ShutdownTimeout          = 20 * time.Second // how long in-flight CSI requests are waited for before the driver exits
+	UpgradeSafeShutdown      = false            // record the mounts left intact on exit, for the next version to adopt
+	TargetRetryTimes         = 3                // retries of creating and binding the target path when it's busy
+	TargetRetryInterval      = 1 * time.Second  // interval between the retries of creating and binding the target path
+	OrphanAuditInterval      = time.Duration(0) // interval of auditing orphan directories in file systems, 0 to disable
+	OrphanRetention          = time.Duration(0) // orphan directories not modified in the period are deleted, 0 to only report them
+	CapacitySyncInterval     = time.Duration(0) // interval of comparing quota of static PVs with their capacity, 0 to disable
+	CapacitySyncCorrect      = false            // set quota of static PVs to their capacity on drift, only report it if false
+	StrictVolumeContext      = false            // reject provisioning with unknown StorageClass parameters, only log them if false
+	StaleSessionInterval     = time.Duration(0) // interval of cleaning up mount pods and sessions left on deleted nodes, 0 to disable
+	MountMetricsPortRange    = ""               // metrics ports assigned to mount pods on the host network, e.g. 9600-9699, random ports if empty
+	SingleNodeAccessGuard    = false            // reject publishing ReadWriteOnce volumes on a node when they are published on another one
+	NFSExportImage           = ""               // image of the NFS server exporting volumes mounted on storage nodes, required by remote mount
+	RootlessUID              = int64(1000)      // user and group of rootless mount pods, owner of the FUSE mount points mounted for them
+	RootlessUserNamespace    = false            // run rootless mount pods in user namespaces, requires Kubernetes v1.30+
+	MountPodHardened         = false            // generate mount pods with read-only root filesystems, seccomp and AppArmor profiles and no capabilities
+	MountPodHardenedRelaxed  = false            // keep SYS_ADMIN and unconfined seccomp and AppArmor in hardened mount pods, for older kernels
+	WritebackFlushTimeout    = 5 * time.Minute  // grace period of mount pods with writeback, for staged data to be uploaded before exit
+	FuseCheckInterval        = 5 * time.Minute  // interval of checking the FUSE module of the node after startup, 0 to check at startup only
+	FuseExpectedMounts       = 0                // number of mounts expected on the node, which the inotify limit is checked against, the pod capacity of the node if 0
+	VerifyPermissions        = true             // check the service account has the permissions the component requires at startup
+	NamespaceScoped          = false            // mount pods, jobs and their secrets are only in Namespace, namespaced permissions are granted by a Role
+	PVCDefaultsConfigMap     = ""               // ConfigMap in Namespace with the annotations and labels injected into PVCs by the webhook
 	ReconcilerInterval       = 5
 	SecretReconcilerInterval = 1 * time.Hour
 
+	MountPodSeccompProfile  = "runtime/default" // seccomp profile of hardened mount pods, runtime/default or localhost/<path>
+	MountPodAppArmorProfile = "runtime/default" // AppArmor profile of hardened mount pods, runtime/default, localhost/<name> or empty to leave it unset
+
 	CSIPod = corev1.Pod{}
 
 	MountPointPath           = "/var/lib/juicefs/volume"
@@ -80,7 +115,12 @@ var (
 	JfsMountPath          = "/sbin/mount.juicefs"
 	DefaultClientConfPath = "/root/.juicefs"
 	ROConfPath            = "/etc/juicefs"
+	TLSConfPath           = "/etc/juicefs-tls"
+	ExternalSecretsPath   = "/run/juicefs/secrets" // tmpfs of the host, secrets fetched from an external secret provider are written here for mount pods and jobs
 	ShutdownSockPath      = "/tmp/juicefs-csi-shutdown.sock"
+	InflightStatePath     = "/tmp/juicefs-csi-inflight.json" // /tmp of CSI Node is a hostPath, kept across restarts
+	HandoverStatePath     = "/tmp/juicefs-csi-handover.json"
+	MirrorStatePath       = "/tmp/juicefs-csi-mirror.json"
 	JfsFuseFdPathName     = "jfs-fuse-fd"
 
 	DefaultCEMountImage = "juicedata/mount:ce-nightly" // mount pod ce image, override by ENV
@@ -112,6 +152,7 @@ var CSISetOptsMap = map[string]interface{}{
 var interVolumesPrefix = []string{
 	"rsa-key",
 	"init-config",
+	"tls-conf",
 	"config-",
 	"jfs-dir",
 	"update-db",
@@ -162,6 +203,55 @@ func MustGetWebPort() int {
 	return 8080
 }
 
+// DetectIPFamily returns whether the cluster is IPv6 single-stack (or IPv6 primary dual-stack).
+// Env JUICEFS_IP_FAMILY ("ipv4" or "ipv6") takes precedence over the address of HOST_IP or POD_IP.
+func DetectIPFamily() bool {
+	switch strings.ToLower(os.Getenv("JUICEFS_IP_FAMILY")) {
+	case "ipv6":
+		return true
+	case "ipv4":
+		return false
+	}
+	for _, env := range []string{"HOST_IP", "POD_IP"} {
+		if ip := net.ParseIP(os.Getenv(env)); ip != nil {
+			return ip.To4() == nil
+		}
+	}
+	return false
+}
+
+// WildcardAddress returns the address listening on all interfaces of the cluster's IP family
+func WildcardAddress(port int) string {
+	host := "0.0.0.0"
+	if IPv6 {
+		host = "::"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// LoopbackAddress returns the loopback address of the cluster's IP family
+func LoopbackAddress(port int) string {
+	host := "127.0.0.1"
+	if IPv6 {
+		host = "::1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// ParsePortRange parses a port range in format of <min>-<max>
+func ParsePortRange(s string) (min, max int32, err error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid port range %q, should be <min>-<max>", s)
+	}
+	l, err1 := strconv.ParseInt(strings.TrimSpace(lo), 10, 32)
+	h, err2 := strconv.ParseInt(strings.TrimSpace(hi), 10, 32)
+	if err1 != nil || err2 != nil || l <= 0 || h > 65535 || l > h {
+		return 0, 0, fmt.Errorf("invalid port range %q, should be <min>-<max> within 1-65535", s)
+	}
+	return int32(l), int32(h), nil
+}
+
 type PVCSelector struct {
 	metav1.LabelSelector
 	MatchStorageClassName string `json:"matchStorageClassName,omitempty"`
@@ -352,6 +442,88 @@ type Config struct {
 	// If the k8s version is 1.29 and later, the default is true.
 	EnableNativeSidecar *bool           `json:"enableNativeSidecar,omitempty"`
 	MountPodPatch       []MountPodPatch `json:"mountPodPatch"`
+	// limit the number of nodes mounting the file system concurrently
+	MountLimits []MountLimit `json:"mountLimits,omitempty"`
+	// named mount option sets, referenced by `juicefs/option-profile` in StorageClass or PV
+	OptionProfiles []OptionProfile `json:"optionProfiles,omitempty"`
+	// how CSI Node relieves memory pressure caused by mount pods, disabled if nil
+	MemoryPressure *MemoryPressurePolicy `json:"memoryPressure,omitempty"`
+	// labels and annotations copied from the PVC and its namespace onto mount pods, disabled if nil
+	PropagateMetadata *MetadataPropagation `json:"propagateMetadata,omitempty"`
+}
+
+// MetadataPropagation is the allowlist of labels and annotations copied onto mount pods, e.g. for cost allocation.
+// Keys are exact, or prefixes ending with "*", e.g. "billing.example.com/*".
+type MetadataPropagation struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+	// also copy the allowed ones of the namespace of PVC, those of PVC take precedence
+	FromNamespace bool `json:"fromNamespace,omitempty"`
+}
+
+// Select returns the entries of src whose keys are allowed by keys
+func (p *MetadataPropagation) Select(keys []string, src map[string]string) map[string]string {
+	selected := map[string]string{}
+	for k, v := range src {
+		for _, allowed := range keys {
+			if k == allowed || (strings.HasSuffix(allowed, "*") && strings.HasPrefix(k, strings.TrimSuffix(allowed, "*"))) {
+				selected[k] = v
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// MemoryPressurePolicy decides which mount pods are shrunk or evicted first when the node is under memory pressure,
+// by the priority of the pods consuming their volumes
+type MemoryPressurePolicy struct {
+	// mount pods whose working set exceeds this ratio of their memory limit are approaching the limit, defaults to 0.9
+	UsageRatio float64 `json:"usageRatio,omitempty"`
+	// buffer-size in MiB which mount pods are shrunk to, by recreating them smoothly; shrinking is disabled if 0
+	ReducedBufferSize int64 `json:"reducedBufferSize,omitempty"`
+	// pods with priority lower than this may be evicted to release the mount pods they use, eviction is disabled if nil
+	EvictBelowPriority *int32 `json:"evictBelowPriority,omitempty"`
+}
+
+// Ratio returns the usage ratio of memory limit regarded as approaching the limit
+func (p *MemoryPressurePolicy) Ratio() float64 {
+	if p.UsageRatio <= 0 || p.UsageRatio > 1 {
+		return 0.9
+	}
+	return p.UsageRatio
+}
+
+type OptionProfile struct {
+	Name         string   `json:"name"`
+	MountOptions []string `json:"mountOptions"`
+}
+
+type MountLimit struct {
+	// name of the file system, the `name` field in volume credentials
+	Name string `json:"name"`
+	// 0 means unlimited
+	MaxNodes int `json:"maxNodes"`
+}
+
+// MaxMountNodes returns the maximum number of nodes which may mount the file system concurrently, 0 means unlimited
+func (c *Config) MaxMountNodes(name string) int {
+	for _, l := range c.MountLimits {
+		if l.Name == name {
+			return l.MaxNodes
+		}
+	}
+	return 0
+}
+
+// OptionProfile returns the mount options of the named profile
+func (c *Config) OptionProfile(name string) ([]string, bool) {
+	for _, p := range c.OptionProfiles {
+		if p.Name == name {
+			return p.MountOptions, true
+		}
+	}
+	return nil, false
 }
 
 func (c *Config) Unmarshal(data []byte) error {
@@ -652,3 +652,59 @@ func TestMountPodPatch_isMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectIPFamily(t *testing.T) {
+	tests := []struct {
+		name     string
+		family   string
+		hostIP   string
+		podIP    string
+		wantIPv6 bool
+		wantAddr string
+	}{
+		{name: "default", wantAddr: "0.0.0.0:9567"},
+		{name: "ipv4 host", hostIP: "10.0.0.1", podIP: "fd00::1", wantAddr: "0.0.0.0:9567"},
+		{name: "ipv6 host", hostIP: "fd00::1", wantIPv6: true, wantAddr: "[::]:9567"},
+		{name: "ipv6 pod", podIP: "fd00::2", wantIPv6: true, wantAddr: "[::]:9567"},
+		{name: "env overrides", family: "IPv4", hostIP: "fd00::1", wantAddr: "0.0.0.0:9567"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JUICEFS_IP_FAMILY", tt.family)
+			t.Setenv("HOST_IP", tt.hostIP)
+			t.Setenv("POD_IP", tt.podIP)
+			IPv6 = DetectIPFamily()
+			defer func() { IPv6 = false }()
+			assert.Equal(t, tt.wantIPv6, IPv6)
+			assert.Equal(t, tt.wantAddr, WildcardAddress(9567))
+		})
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		s        string
+		min, max int32
+		wantErr  bool
+	}{
+		{s: "9600-9699", min: 9600, max: 9699},
+		{s: "9600 - 9600", min: 9600, max: 9600},
+		{s: "9600", wantErr: true},
+		{s: "9699-9600", wantErr: true},
+		{s: "0-10", wantErr: true},
+		{s: "9600-70000", wantErr: true},
+		{s: "a-b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			min, max, err := ParsePortRange(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePortRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if min != tt.min || max != tt.max {
+				t.Errorf("ParsePortRange() = %v, %v, want %v, %v", min, max, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+const csiParamPrefix = "csi.storage.k8s.io/"
+
+// SecretOperation is the CSI operation a secret of StorageClass is passed to
+type SecretOperation string
+
+const (
+	SecretOpProvisioner       SecretOperation = "provisioner"
+	SecretOpControllerPublish SecretOperation = "controller-publish"
+	SecretOpNodeStage         SecretOperation = "node-stage"
+	SecretOpNodePublish       SecretOperation = "node-publish"
+	SecretOpControllerExpand  SecretOperation = "controller-expand"
+	SecretOpNodeExpand        SecretOperation = "node-expand"
+)
+
+var secretOperations = []SecretOperation{
+	SecretOpProvisioner, SecretOpControllerPublish, SecretOpNodeStage,
+	SecretOpNodePublish, SecretOpControllerExpand, SecretOpNodeExpand,
+}
+
+// NameKey returns the StorageClass parameter of the secret name for op
+func (op SecretOperation) NameKey() string {
+	return csiParamPrefix + string(op) + "-secret-name"
+}
+
+// NamespaceKey returns the StorageClass parameter of the secret namespace for op
+func (op SecretOperation) NamespaceKey() string {
+	return csiParamPrefix + string(op) + "-secret-namespace"
+}
+
+// nameVariables returns if the template variable is allowed in the secret name for op, which are the same as
+// the ones of external-provisioner: the provisioner secret is resolved before the PVC is bound, so
+// annotations of the PVC are not allowed in it.
+func (op SecretOperation) nameVariables(name string) bool {
+	switch name {
+	case "pv.name", "pvc.name", "pvc.namespace":
+		return true
+	}
+	return op != SecretOpProvisioner && strings.HasPrefix(name, "pvc.annotations['") && strings.HasSuffix(name, "']")
+}
+
+// namespaceVariables returns if the template variable is allowed in the secret namespace, the name and
+// annotations of PVC are not allowed since they are controlled by the user of the namespace
+func namespaceVariables(name string) bool {
+	return name == "pv.name" || name == "pvc.namespace"
+}
+
+const (
+	csiFSTypeKey          = csiParamPrefix + "fstype"
+	csiSecretNameKey      = csiParamPrefix + "secret-name"
+	csiSecretNamespaceKey = csiParamPrefix + "secret-namespace"
+)
+
+// CSIParameters is the standard csi.storage.k8s.io/* parameters of a StorageClass, translated the same way
+// as external-provisioner does, so that the built-in provisioner and the CSI sidecar create the same PV.
+type CSIParameters struct {
+	// FSType is the fsType of the PV, "juicefs" if not set
+	FSType string
+	// Secrets is the secret of each operation, operations without secret are not in it
+	Secrets map[SecretOperation]*corev1.SecretReference
+}
+
+// ParseCSIParameters parses the csi.storage.k8s.io/* parameters of StorageClass, and resolves the templates in
+// secret names and namespaces with resolve. The secret of an operation is the one set for it, or the one set by
+// csi.storage.k8s.io/secret-name and csi.storage.k8s.io/secret-namespace for all operations.
+// Unknown keys, secrets with only name or namespace, and template variables not allowed for the operation
+// are rejected, instead of turning into empty strings silently.
+func ParseCSIParameters(params map[string]string, resolve func(string) string) (*CSIParameters, error) {
+	p := &CSIParameters{FSType: "juicefs", Secrets: map[SecretOperation]*corev1.SecretReference{}}
+	known := map[string]bool{
+		csiFSTypeKey: true, csiSecretNameKey: true, csiSecretNamespaceKey: true,
+		// used by the snapshot sidecars, not by provisioning
+		common.SnapshotterSecretName: true, common.SnapshotterSecretNamespace: true,
+		// set by external-provisioner with --extra-create-metadata
+		csiParamPrefix + "pvc/name": true, csiParamPrefix + "pvc/namespace": true, csiParamPrefix + "pv/name": true,
+	}
+	for _, op := range secretOperations {
+		known[op.NameKey()], known[op.NamespaceKey()] = true, true
+	}
+	var problems []string
+	for k := range params {
+		if strings.HasPrefix(k, csiParamPrefix) && !known[k] {
+			problems = append(problems, fmt.Sprintf("unknown parameter %s", k))
+		}
+	}
+	if v := params[csiFSTypeKey]; v != "" {
+		p.FSType = v
+	}
+
+	for _, op := range secretOperations {
+		nameKey, namespaceKey := op.NameKey(), op.NamespaceKey()
+		_, nameSet := params[nameKey]
+		_, namespaceSet := params[namespaceKey]
+		if !nameSet && !namespaceSet {
+			nameKey, namespaceKey = csiSecretNameKey, csiSecretNamespaceKey
+			_, nameSet = params[nameKey]
+			_, namespaceSet = params[namespaceKey]
+		}
+		if !nameSet && !namespaceSet {
+			continue
+		}
+		name, namespace := StorageClassSecret(params, op)
+		if name == "" || namespace == "" {
+			problems = append(problems, fmt.Sprintf("both %s and %s should be set", nameKey, namespaceKey))
+			continue
+		}
+		if err := checkTemplate(name, op.nameVariables); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", nameKey, err))
+			continue
+		}
+		if err := checkTemplate(namespace, namespaceVariables); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", namespaceKey, err))
+			continue
+		}
+		ref := &corev1.SecretReference{Name: resolve(name), Namespace: resolve(namespace)}
+		if ref.Name == "" || ref.Namespace == "" {
+			problems = append(problems, fmt.Sprintf("secret of %s resolved to %s/%s", op, ref.Namespace, ref.Name))
+			continue
+		}
+		p.Secrets[op] = ref
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid StorageClass parameters: %s", strings.Join(problems, "; "))
+	}
+	return p, nil
+}
+
+func checkTemplate(tmpl string, allowed func(string) bool) error {
+	var invalid []string
+	os.Expand(tmpl, func(k string) string {
+		if !allowed(k) {
+			invalid = append(invalid, "${"+k+"}")
+		}
+		return ""
+	})
+	if len(invalid) > 0 {
+		return fmt.Errorf("template variables %s are not allowed", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// Secret returns the secret of op, or nil if not set
+func (p *CSIParameters) Secret(op SecretOperation) *corev1.SecretReference {
+	return p.Secrets[op]
+}
+
+// Params returns the resolved secrets as StorageClass parameters of each operation, csi.storage.k8s.io/secret-name
+// and csi.storage.k8s.io/secret-namespace are expanded to the operations they apply to.
+func (p *CSIParameters) Params() map[string]string {
+	params := make(map[string]string, 2*len(p.Secrets))
+	for op, ref := range p.Secrets {
+		params[op.NameKey()] = ref.Name
+		params[op.NamespaceKey()] = ref.Namespace
+	}
+	return params
+}
+
+// ApplyTo sets fsType and the secret references of pv
+func (p *CSIParameters) ApplyTo(pv *corev1.CSIPersistentVolumeSource) {
+	pv.FSType = p.FSType
+	pv.ControllerPublishSecretRef = p.Secret(SecretOpControllerPublish)
+	pv.NodeStageSecretRef = p.Secret(SecretOpNodeStage)
+	pv.NodePublishSecretRef = p.Secret(SecretOpNodePublish)
+	pv.ControllerExpandSecretRef = p.Secret(SecretOpControllerExpand)
+	pv.NodeExpandSecretRef = p.Secret(SecretOpNodeExpand)
+}
+
+// StorageClassSecret returns the unresolved secret name and namespace of op in StorageClass parameters,
+// with the fallback to csi.storage.k8s.io/secret-name and csi.storage.k8s.io/secret-namespace
+func StorageClassSecret(params map[string]string, op SecretOperation) (name, namespace string) {
+	name, nameSet := params[op.NameKey()]
+	namespace, namespaceSet := params[op.NamespaceKey()]
+	if !nameSet && !namespaceSet {
+		return params[csiSecretNameKey], params[csiSecretNamespaceKey]
+	}
+	return name, namespace
+}
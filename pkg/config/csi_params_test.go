@@ -0,0 +1,145 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+func TestParseCSIParameters(t *testing.T) {
+	vars := map[string]string{"pvc.namespace": "ns", "pvc.name": "data", "pv.name": "pvc-1", "pvc.annotations['secret']": "annotated"}
+	resolve := func(s string) string {
+		return os.Expand(s, func(k string) string { return vars[k] })
+	}
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    *CSIParameters
+		wantErr string
+	}{
+		{
+			name:   "empty",
+			params: map[string]string{"juicefs/mount-cpu-limit": "1"},
+			want:   &CSIParameters{FSType: "juicefs", Secrets: map[SecretOperation]*corev1.SecretReference{}},
+		},
+		{
+			name: "per operation",
+			params: map[string]string{
+				common.ProvisionerSecretName:           "juicefs-secret",
+				common.ProvisionerSecretNamespace:      "${pvc.namespace}",
+				common.PublishSecretName:               "${pvc.annotations['secret']}",
+				common.PublishSecretNamespace:          "${pvc.namespace}",
+				common.ControllerExpandSecretName:      "${pvc.name}-expand",
+				common.ControllerExpandSecretNamespace: "kube-system",
+				"csi.storage.k8s.io/fstype":            "ext4",
+			},
+			want: &CSIParameters{FSType: "ext4", Secrets: map[SecretOperation]*corev1.SecretReference{
+				SecretOpProvisioner:      {Name: "juicefs-secret", Namespace: "ns"},
+				SecretOpNodePublish:      {Name: "annotated", Namespace: "ns"},
+				SecretOpControllerExpand: {Name: "data-expand", Namespace: "kube-system"},
+			}},
+		},
+		{
+			name: "shorthand for all operations",
+			params: map[string]string{
+				"csi.storage.k8s.io/secret-name":      "juicefs-secret",
+				"csi.storage.k8s.io/secret-namespace": "default",
+				common.PublishSecretName:              "publish-secret",
+				common.PublishSecretNamespace:         "default",
+			},
+			want: &CSIParameters{FSType: "juicefs", Secrets: map[SecretOperation]*corev1.SecretReference{
+				SecretOpProvisioner:       {Name: "juicefs-secret", Namespace: "default"},
+				SecretOpControllerPublish: {Name: "juicefs-secret", Namespace: "default"},
+				SecretOpNodeStage:         {Name: "juicefs-secret", Namespace: "default"},
+				SecretOpNodePublish:       {Name: "publish-secret", Namespace: "default"},
+				SecretOpControllerExpand:  {Name: "juicefs-secret", Namespace: "default"},
+				SecretOpNodeExpand:        {Name: "juicefs-secret", Namespace: "default"},
+			}},
+		},
+		{
+			name: "only name",
+			params: map[string]string{
+				common.ControllerExpandSecretName: "juicefs-secret",
+			},
+			wantErr: "both csi.storage.k8s.io/controller-expand-secret-name and csi.storage.k8s.io/controller-expand-secret-namespace should be set",
+		},
+		{
+			name: "annotations in provisioner secret",
+			params: map[string]string{
+				common.ProvisionerSecretName:      "${pvc.annotations['secret']}",
+				common.ProvisionerSecretNamespace: "default",
+			},
+			wantErr: "template variables ${pvc.annotations['secret']} are not allowed",
+		},
+		{
+			name: "pvc name in namespace",
+			params: map[string]string{
+				common.PublishSecretName:      "juicefs-secret",
+				common.PublishSecretNamespace: "${pvc.name}",
+			},
+			wantErr: "csi.storage.k8s.io/node-publish-secret-namespace: template variables ${pvc.name} are not allowed",
+		},
+		{
+			name: "resolved to empty",
+			params: map[string]string{
+				common.PublishSecretName:      "${pvc.annotations['missing']}",
+				common.PublishSecretNamespace: "default",
+			},
+			wantErr: "secret of node-publish resolved to default/",
+		},
+		{
+			name:    "unknown",
+			params:  map[string]string{"csi.storage.k8s.io/node-publish-secret": "juicefs-secret"},
+			wantErr: "unknown parameter csi.storage.k8s.io/node-publish-secret",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCSIParameters(tt.params, resolve)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCSIParametersParams(t *testing.T) {
+	p, err := ParseCSIParameters(map[string]string{
+		"csi.storage.k8s.io/secret-name":      "juicefs-secret",
+		"csi.storage.k8s.io/secret-namespace": "default",
+	}, func(s string) string { return s })
+	assert.NoError(t, err)
+	params := p.Params()
+	assert.Equal(t, "juicefs-secret", params[common.ProvisionerSecretName])
+	assert.Equal(t, "default", params[common.ControllerExpandSecretNamespace])
+	assert.NotContains(t, params, "csi.storage.k8s.io/secret-name")
+
+	source := &corev1.CSIPersistentVolumeSource{}
+	p.ApplyTo(source)
+	assert.Equal(t, "juicefs", source.FSType)
+	assert.Equal(t, &corev1.SecretReference{Name: "juicefs-secret", Namespace: "default"}, source.NodePublishSecretRef)
+	assert.Equal(t, source.NodePublishSecretRef, source.NodeExpandSecretRef)
+}
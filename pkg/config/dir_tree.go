@@ -0,0 +1,109 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// DirTreeConfigMapKey is the key of the directory tree in the configmap referred by common.DirTreeKey
+const DirTreeConfigMapKey = "tree.yaml"
+
+// DirTreeEntry is a directory created in new volumes, e.g.
+//
+//   - path: data/logs
+//     mode: "0750"
+//     uid: 1000
+//     gid: 1000
+type DirTreeEntry struct {
+	// Path relative to the root of the volume, parents are created as well
+	Path string `json:"path"`
+	// Mode in octal, 0777 by default
+	Mode string `json:"mode,omitempty"`
+	UID  *int64 `json:"uid,omitempty"`
+	GID  *int64 `json:"gid,omitempty"`
+}
+
+// FileMode returns the permission bits of the entry
+func (e DirTreeEntry) FileMode() uint32 {
+	if e.Mode == "" {
+		return 0777
+	}
+	mode, _ := strconv.ParseUint(e.Mode, 8, 32)
+	return uint32(mode)
+}
+
+// ParseDirTree parses and validates the directory tree in YAML or JSON
+func ParseDirTree(data string) ([]DirTreeEntry, error) {
+	var entries []DirTreeEntry
+	if err := yaml.UnmarshalStrict([]byte(data), &entries); err != nil {
+		return nil, fmt.Errorf("invalid directory tree: %v", err)
+	}
+	for _, e := range entries {
+		clean := path.Clean(e.Path)
+		if e.Path == "" || path.IsAbs(e.Path) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("invalid path %q in directory tree, should be relative to the volume without '..'", e.Path)
+		}
+		if e.Mode != "" {
+			if mode, err := strconv.ParseUint(e.Mode, 8, 32); err != nil || mode > 07777 {
+				return nil, fmt.Errorf("invalid mode %q of %s in directory tree, should be octal like 0755", e.Mode, e.Path)
+			}
+		}
+		if (e.UID != nil && *e.UID < 0) || (e.GID != nil && *e.GID < 0) {
+			return nil, fmt.Errorf("invalid owner of %s in directory tree", e.Path)
+		}
+	}
+	return entries, nil
+}
+
+// EncodeDirTree encodes the directory tree to be stored in common.DirTreeSpecKey
+func EncodeDirTree(entries []DirTreeEntry) string {
+	data, _ := json.Marshal(entries)
+	return string(data)
+}
+
+// ParseDirTreeRef parses the configmap reference of common.DirTreeKey, namespace defaults to the given one
+func ParseDirTreeRef(ref, namespace string) (string, string, error) {
+	name := ref
+	if ns, n, ok := strings.Cut(ref, "/"); ok {
+		namespace, name = ns, n
+	}
+	for _, s := range []string{namespace, name} {
+		if errs := validation.IsDNS1123Subdomain(s); len(errs) > 0 {
+			return "", "", fmt.Errorf("invalid configmap %q: %s", ref, strings.Join(errs, ", "))
+		}
+	}
+	return namespace, name, nil
+}
+
+func validateDirTreeRef(v string) error {
+	// the namespace of PVC is not known here, validate the name only
+	_, _, err := ParseDirTreeRef(v, "default")
+	return err
+}
+
+func validateDirTreeSpec(v string) error {
+	_, err := ParseDirTree(v)
+	return err
+}
@@ -0,0 +1,84 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+)
+
+func TestParseDirTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{name: "empty", data: "", want: 0},
+		{name: "yaml", data: "- path: data/logs\n  mode: \"0750\"\n  uid: 1000\n  gid: 1000\n- path: cache\n", want: 2},
+		{name: "json", data: `[{"path":"data","mode":"1777"}]`, want: 1},
+		{name: "absolute", data: "- path: /data\n", wantErr: true},
+		{name: "escape", data: "- path: data/../../etc\n", wantErr: true},
+		{name: "root", data: "- path: ./\n", wantErr: true},
+		{name: "decimal-mode", data: "- path: data\n  mode: \"755a\"\n", wantErr: true},
+		{name: "large-mode", data: "- path: data\n  mode: \"17777\"\n", wantErr: true},
+		{name: "negative-uid", data: "- path: data\n  uid: -1\n", wantErr: true},
+		{name: "unknown-field", data: "- path: data\n  owner: root\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDirTree(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDirTree() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("ParseDirTree() = %v, want %d entries", got, tt.want)
+			}
+		})
+	}
+
+	entries, _ := ParseDirTree("- path: a\n  mode: \"2750\"\n  uid: 0\n- path: b\n")
+	spec, err := ParseDirTree(EncodeDirTree(entries))
+	if err != nil || len(spec) != 2 || spec[0].FileMode() != 02750 || *spec[0].UID != 0 || spec[0].GID != nil {
+		t.Errorf("ParseDirTree(EncodeDirTree()) = %v, %v", spec, err)
+	}
+	if spec[1].FileMode() != 0777 {
+		t.Errorf("FileMode() = %o, want 777 by default", spec[1].FileMode())
+	}
+}
+
+func TestParseDirTreeRef(t *testing.T) {
+	tests := []struct {
+		ref, wantNs, wantName string
+		wantErr               bool
+	}{
+		{ref: "tree", wantNs: "default", wantName: "tree"},
+		{ref: "kube-system/tree", wantNs: "kube-system", wantName: "tree"},
+		{ref: "a/b/c", wantErr: true},
+		{ref: "Tree", wantErr: true},
+		{ref: "/tree", wantErr: true},
+	}
+	for _, tt := range tests {
+		ns, name, err := ParseDirTreeRef(tt.ref, "default")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDirTreeRef(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if ns != tt.wantNs || name != tt.wantName {
+			t.Errorf("ParseDirTreeRef(%q) = %s/%s, want %s/%s", tt.ref, ns, name, tt.wantNs, tt.wantName)
+		}
+	}
+}
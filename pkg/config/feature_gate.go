@@ -0,0 +1,159 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Feature is the name of a feature gate, turned on or off by --feature-gates
+type Feature string
+
+// FeatureStage is the maturity of a feature
+type FeatureStage string
+
+const (
+	// Alpha features are off by default, they may change or be removed without notice
+	Alpha FeatureStage = "ALPHA"
+	// Beta features are on by default, they can still be turned off in case of problems
+	Beta FeatureStage = "BETA"
+	// GA features are always on, their gates are kept for a while so that existing flags still work
+	GA FeatureStage = "GA"
+)
+
+const (
+	// RemoteMount mounts volumes on storage nodes and forwards them over NFS, see common.RemoteMountKey
+	RemoteMount Feature = "RemoteMount"
+	// RootlessMount runs mount pods as non-root users, see common.RootlessKey
+	RootlessMount Feature = "RootlessMount"
+)
+
+// FeatureSpec is the default and maturity of a feature
+type FeatureSpec struct {
+	Default bool
+	Stage   FeatureStage
+}
+
+var defaultFeatureGates = map[Feature]FeatureSpec{
+	RemoteMount:   {Default: false, Stage: Alpha},
+	RootlessMount: {Default: false, Stage: Alpha},
+}
+
+// FeatureGates of the driver, set by --feature-gates
+var FeatureGates = NewFeatureGate(defaultFeatureGates)
+
+// FeatureGate tells if features are enabled, it implements pflag.Value to be set by
+// a comma separated list of <name>=<bool>
+type FeatureGate struct {
+	mu      sync.RWMutex
+	known   map[Feature]FeatureSpec
+	enabled map[Feature]bool
+}
+
+func NewFeatureGate(known map[Feature]FeatureSpec) *FeatureGate {
+	return &FeatureGate{known: known, enabled: map[Feature]bool{}}
+}
+
+// Enabled tells if the feature is enabled, unknown features are disabled
+func (g *FeatureGate) Enabled(f Feature) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if v, ok := g.enabled[f]; ok {
+		return v
+	}
+	return g.known[f].Default
+}
+
+func (g *FeatureGate) Set(value string) error {
+	enabled := map[Feature]bool{}
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("missing bool value for feature gate %s", s)
+		}
+		f := Feature(strings.TrimSpace(kv[0]))
+		spec, ok := g.known[f]
+		if !ok {
+			return fmt.Errorf("unknown feature gate %s", f)
+		}
+		v, err := strconv.ParseBool(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return fmt.Errorf("invalid value of feature gate %s: %v", f, err)
+		}
+		if spec.Stage == GA && !v {
+			return fmt.Errorf("feature gate %s is GA and can't be disabled", f)
+		}
+		enabled[f] = v
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for f, v := range enabled {
+		g.enabled[f] = v
+	}
+	return nil
+}
+
+func (g *FeatureGate) String() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	pairs := make([]string, 0, len(g.enabled))
+	for f, v := range g.enabled {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", f, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (g *FeatureGate) Type() string {
+	return "mapStringBool"
+}
+
+// KnownFeatures returns the usage of known features, sorted by name
+func (g *FeatureGate) KnownFeatures() []string {
+	features := make([]string, 0, len(g.known))
+	for f, spec := range g.known {
+		features = append(features, fmt.Sprintf("%s=true|false (%s - default=%t)", f, spec.Stage, spec.Default))
+	}
+	sort.Strings(features)
+	return features
+}
+
+// RegisterMetrics exposes whether each known feature is enabled, as feature_enabled{name, stage}
+func (g *FeatureGate) RegisterMetrics(reg prometheus.Registerer) {
+	enabled := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "feature_enabled",
+		Help: "whether a feature gate of the driver is enabled, 1 if enabled",
+	}, []string{"name", "stage"})
+	reg.MustRegister(enabled)
+	for f, spec := range g.known {
+		v := 0.0
+		if g.Enabled(f) {
+			v = 1
+		}
+		enabled.WithLabelValues(string(f), string(spec.Stage)).Set(v)
+	}
+}
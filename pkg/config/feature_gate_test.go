@@ -0,0 +1,65 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+func TestFeatureGate(t *testing.T) {
+	g := NewFeatureGate(map[Feature]FeatureSpec{
+		"A": {Default: false, Stage: Alpha},
+		"B": {Default: true, Stage: Beta},
+		"C": {Default: true, Stage: GA},
+	})
+	assert.False(t, g.Enabled("A"))
+	assert.True(t, g.Enabled("B"))
+	assert.False(t, g.Enabled("D"))
+
+	assert.NoError(t, g.Set("A=true, B=false"))
+	assert.True(t, g.Enabled("A"))
+	assert.False(t, g.Enabled("B"))
+	assert.Equal(t, "A=true,B=false", g.String())
+
+	assert.EqualError(t, g.Set("D=true"), "unknown feature gate D")
+	assert.EqualError(t, g.Set("A"), "missing bool value for feature gate A")
+	assert.Error(t, g.Set("A=yes"))
+	assert.EqualError(t, g.Set("C=false"), "feature gate C is GA and can't be disabled")
+	assert.Equal(t, []string{"A=true|false (ALPHA - default=false)", "B=true|false (BETA - default=true)", "C=true|false (GA - default=true)"}, g.KnownFeatures())
+
+	reg := prometheus.NewRegistry()
+	g.RegisterMetrics(reg)
+	n, err := testutil.GatherAndCount(reg, "feature_enabled")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestGatedVolumeContext(t *testing.T) {
+	_, err := ParseVolumeContext(map[string]string{common.RootlessKey: "true"}, false)
+	assert.EqualError(t, err, `invalid volume context: invalid values [juicefs/rootless="true": feature gate RootlessMount is disabled]`)
+
+	assert.NoError(t, FeatureGates.Set("RootlessMount=true"))
+	defer func() { _ = FeatureGates.Set("RootlessMount=false") }()
+	_, err = ParseVolumeContext(map[string]string{common.RootlessKey: "true"}, false)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,176 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatDriftWarn      = "warn"
+	FormatDriftReconcile = "reconcile"
+)
+
+// FormatDrift is a format setting of community edition whose value in the volume credentials
+// differs from the one stored in the metadata engine
+type FormatDrift struct {
+	Key     string
+	Desired string
+	Current string
+	// Reconcilable is whether the setting can be changed by `juicefs config`
+	Reconcilable bool
+}
+
+func (d FormatDrift) String() string {
+	return fmt.Sprintf("%s: %q -> %q", d.Key, d.Current, d.Desired)
+}
+
+type formatSetting struct {
+	// field in the "Setting" of `juicefs status` output
+	field        string
+	reconcilable bool
+	// normalize converts the desired and current value into comparable form
+	normalizeDesired func(string) (string, error)
+	normalizeCurrent func(string) (string, error)
+}
+
+// storage and bucket are only warned, changing them on a live file system repoints the data of all its clients
+var formatSettings = map[string]formatSetting{
+	"storage":    {field: "Storage"},
+	"bucket":     {field: "Bucket", normalizeDesired: trimSlash, normalizeCurrent: trimSlash},
+	"trash-days": {field: "TrashDays", reconcilable: true, normalizeDesired: normalizeInt, normalizeCurrent: normalizeInt},
+	// capacity is in GiB in format options, but in bytes in `juicefs status`
+	"capacity":   {field: "Capacity", reconcilable: true, normalizeDesired: gibToBytes, normalizeCurrent: normalizeInt},
+	"inodes":     {field: "Inodes", reconcilable: true, normalizeDesired: normalizeInt, normalizeCurrent: normalizeInt},
+	"compress":   {field: "Compression"},
+	"block-size": {field: "BlockSize", normalizeDesired: normalizeInt, normalizeCurrent: normalizeInt},
+}
+
+// DetectFormatDrift compares the format settings in secrets (and format-options in them) with
+// the output of `juicefs status`. Settings not set in secrets are never treated as drift.
+func DetectFormatDrift(secrets map[string]string, statusOutput string) ([]FormatDrift, error) {
+	current, err := parseStatusSetting(statusOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	desired := make(map[string]string)
+	for k := range formatSettings {
+		if secrets[k] != "" {
+			desired[k] = secrets[k]
+		}
+	}
+	if secrets["format-options"] != "" {
+		options, err := (&JfsSetting{FormatOptions: secrets["format-options"]}).ParseFormatOptions()
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range options {
+			if _, ok := formatSettings[pair[0]]; ok && pair[1] != "" {
+				desired[pair[0]] = pair[1]
+			}
+		}
+	}
+
+	var drifts []FormatDrift
+	for k, v := range desired {
+		s := formatSettings[k]
+		cur := current[s.field]
+		if s.normalizeDesired != nil {
+			if v, err = s.normalizeDesired(v); err != nil {
+				return nil, fmt.Errorf("invalid format setting %s: %v", k, err)
+			}
+		}
+		if s.normalizeCurrent != nil && cur != "" {
+			if n, err := s.normalizeCurrent(cur); err == nil {
+				cur = n
+			}
+		}
+		if strings.EqualFold(v, cur) {
+			continue
+		}
+		drifts = append(drifts, FormatDrift{Key: k, Desired: desired[k], Current: current[s.field], Reconcilable: s.reconcilable})
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Key < drifts[j].Key })
+	return drifts, nil
+}
+
+// GenConfigArgs generates the arguments of `juicefs config` reconciling the reconcilable drifts,
+// with the credentials of the object storage in secrets, nil if there is nothing to reconcile
+func GenConfigArgs(secrets map[string]string, drifts []FormatDrift) []string {
+	var args []string
+	for _, d := range drifts {
+		if d.Reconcilable {
+			args = append(args, fmt.Sprintf("--%s=%s", d.Key, d.Desired))
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	for _, k := range []string{"access-key", "secret-key"} {
+		if secrets[k] != "" {
+			args = append(args, fmt.Sprintf("--%s=%s", k, secrets[k]))
+		}
+	}
+	return args
+}
+
+// parseStatusSetting parses the "Setting" of `juicefs status` output into strings
+func parseStatusSetting(output string) (map[string]string, error) {
+	// the output may start with logs printed to stderr
+	idx := strings.Index(output, "{")
+	if idx < 0 {
+		return nil, fmt.Errorf("invalid juicefs status output: %s", output)
+	}
+	var status struct {
+		Setting map[string]interface{}
+	}
+	decoder := json.NewDecoder(strings.NewReader(output[idx:]))
+	decoder.UseNumber()
+	if err := decoder.Decode(&status); err != nil {
+		return nil, fmt.Errorf("parse juicefs status output: %v", err)
+	}
+	setting := make(map[string]string, len(status.Setting))
+	for k, v := range status.Setting {
+		setting[k] = fmt.Sprint(v)
+	}
+	return setting, nil
+}
+
+func trimSlash(v string) (string, error) {
+	return strings.TrimSuffix(v, "/"), nil
+}
+
+func normalizeInt(v string) (string, error) {
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(i, 10), nil
+}
+
+func gibToBytes(v string) (string, error) {
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(i<<30, 10), nil
+}
@@ -0,0 +1,115 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStatusOutput = `2025/01/01 00:00:00.000000 juicefs[1] <INFO>: Meta address: redis://127.0.0.1/1
+{
+  "Setting": {
+    "Name": "myjfs",
+    "UUID": "e4a4ef9c-a4a5-4a4d-8d6b-2f1c0e1e4b5a",
+    "Storage": "s3",
+    "Bucket": "https://bucket.s3.amazonaws.com/",
+    "BlockSize": 4096,
+    "Compression": "none",
+    "TrashDays": 1,
+    "Capacity": 10737418240,
+    "Inodes": 0
+  },
+  "Sessions": []
+}`
+
+func TestDetectFormatDrift(t *testing.T) {
+	tests := []struct {
+		name     string
+		secrets  map[string]string
+		output   string
+		want     []FormatDrift
+		wantArgs []string
+		wantErr  bool
+	}{
+		{
+			name: "no drift",
+			secrets: map[string]string{
+				"storage":        "S3",
+				"bucket":         "https://bucket.s3.amazonaws.com",
+				"format-options": "trash-days=1,capacity=10,block-size=4096",
+			},
+			output: testStatusOutput,
+		},
+		{
+			name: "drift",
+			secrets: map[string]string{
+				"storage":        "s3",
+				"bucket":         "https://other.s3.amazonaws.com",
+				"trash-days":     "1",
+				"format-options": "trash-days=7,compress=lz4,dir-stats",
+				"access-key":     "ak",
+				"secret-key":     "sk",
+			},
+			output: testStatusOutput,
+			want: []FormatDrift{
+				{Key: "bucket", Desired: "https://other.s3.amazonaws.com", Current: "https://bucket.s3.amazonaws.com/"},
+				{Key: "compress", Desired: "lz4", Current: "none"},
+				{Key: "trash-days", Desired: "7", Current: "1", Reconcilable: true},
+			},
+			wantArgs: []string{"--trash-days=7", "--access-key=ak", "--secret-key=sk"},
+		},
+		{
+			name: "storage not reconcilable",
+			secrets: map[string]string{
+				"storage":    "gs",
+				"bucket":     "gs://other",
+				"access-key": "ak",
+			},
+			output: testStatusOutput,
+			want: []FormatDrift{
+				{Key: "bucket", Desired: "gs://other", Current: "https://bucket.s3.amazonaws.com/"},
+				{Key: "storage", Desired: "gs", Current: "s3"},
+			},
+		},
+		{
+			name:    "invalid setting",
+			secrets: map[string]string{"capacity": "10Gi"},
+			output:  testStatusOutput,
+			wantErr: true,
+		},
+		{
+			name:    "invalid output",
+			secrets: map[string]string{"storage": "s3"},
+			output:  "database is not formatted",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectFormatDrift(tt.secrets, tt.output)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantArgs, GenConfigArgs(tt.secrets, got))
+		})
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// fuseOptionDenyList are FUSE options which are managed by the juicefs client, or weaken the isolation of the host,
+// they can't be set in FUSE options or mount options of volumes
+var fuseOptionDenyList = map[string]bool{
+	"fd":         true,
+	"rootmode":   true,
+	"user_id":    true,
+	"group_id":   true,
+	"fsname":     true,
+	"subtype":    true,
+	"blkdev":     true,
+	"dev":        true,
+	"suid":       true,
+	"allow_root": true,
+}
+
+// numericFuseOptions are FUSE options which take a non-negative integer
+var numericFuseOptions = map[string]bool{
+	"max_readahead":        true,
+	"max_read":             true,
+	"max_write":            true,
+	"max_background":       true,
+	"congestion_threshold": true,
+	"blksize":              true,
+}
+
+var fuseOptionNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// FuseOptions parses the comma separated FUSE options of the volume, which are passed through to the mount command
+func FuseOptions(v string) ([]string, error) {
+	var options []string
+	for _, o := range strings.Split(v, ",") {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(o, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !fuseOptionNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid FUSE option %q", o)
+		}
+		if fuseOptionDenyList[name] {
+			return nil, fmt.Errorf("FUSE option %s is not allowed", name)
+		}
+		if numericFuseOptions[name] {
+			if !hasValue {
+				return nil, fmt.Errorf("FUSE option %s requires a value", name)
+			}
+			if err := validateNonNegativeInt(value); err != nil {
+				return nil, fmt.Errorf("FUSE option %s: %v", name, err)
+			}
+		}
+		if hasValue {
+			options = append(options, fmt.Sprintf("%s=%s", name, value))
+		} else {
+			options = append(options, name)
+		}
+	}
+	return options, nil
+}
+
+// checkDeniedOptions returns an error if any of the merged options of the volume is denied, since mount options
+// are passed through to the mount command as well as FUSE options
+func checkDeniedOptions(options []string) error {
+	for _, o := range options {
+		name, _, _ := strings.Cut(o, "=")
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		if fuseOptionDenyList[name] {
+			return fmt.Errorf("FUSE option %s is not allowed", name)
+		}
+	}
+	return nil
+}
+
+func validateFuseOptions(v string) error {
+	_, err := FuseOptions(v)
+	return err
+}
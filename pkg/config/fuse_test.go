@@ -0,0 +1,78 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+func TestFuseOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "valid", value: "allow_other, max_readahead = 1048576,congestion_threshold=48,", want: []string{"allow_other", "max_readahead=1048576", "congestion_threshold=48"}},
+		{name: "denied", value: "allow_other,user_id=0", wantErr: true},
+		{name: "invalid name", value: "Max-Readahead=1", wantErr: true},
+		{name: "numeric without value", value: "max_background", wantErr: true},
+		{name: "numeric with invalid value", value: "max_readahead=1M", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FuseOptions(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FuseOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FuseOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSettingWithFuseOptions(t *testing.T) {
+	secrets := map[string]string{"name": "test", "metaurl": "redis://127.0.0.1:6379/0"}
+	volCtx := map[string]string{common.FuseOptionsKey: "max_readahead=1048576,allow_other"}
+	got, err := ParseSetting(context.TODO(), secrets, volCtx, []string{"max_readahead=4096", "writeback"}, "pv", "pv", "test", nil, nil)
+	if err != nil {
+		t.Fatalf("ParseSetting() error = %v", err)
+	}
+	want := []string{"writeback", "max_readahead=1048576", "allow_other"}
+	if !reflect.DeepEqual(got.Options, want) {
+		t.Errorf("ParseSetting() options = %v, want %v", got.Options, want)
+	}
+
+	volCtx[common.FuseOptionsKey] = "rootmode=40000"
+	if _, err := ParseSetting(context.TODO(), secrets, volCtx, nil, "pv", "pv", "test", nil, nil); err == nil {
+		t.Errorf("ParseSetting() with denied FUSE option should fail")
+	}
+
+	// denied options can't be passed through mount options either
+	delete(volCtx, common.FuseOptionsKey)
+	for _, options := range [][]string{{"allow_root"}, {"writeback", "rootmode=40000"}} {
+		if _, err := ParseSetting(context.TODO(), secrets, volCtx, options, "pv", "pv", "test", nil, nil); err == nil {
+			t.Errorf("ParseSetting() with denied mount options %v should fail", options)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	DefaultKubeletRootDir     = "/var/lib/kubelet"
+	kubeletDirVolumeName      = "kubelet-dir"
+	registrationDirVolumeName = "registration-dir"
+	registrationPathArg       = "--kubelet-registration-path="
+)
+
+// KubeletRootDir is the root-dir of kubelet on the node, targets of NodePublishVolume are under it
+var KubeletRootDir = DefaultKubeletRootDir
+
+// DetectKubeletRootDir resolves the root-dir of kubelet, in the order of:
+// 1. rootDir, from flag or env KUBELET_ROOT_DIR
+// 2. `--root-dir` in the command line of kubelet process, only visible if CSI Node shares the host PID namespace
+// 3. the hostPath of "kubelet-dir" volume of CSI Node pod
+// 4. /var/lib/kubelet
+func DetectKubeletRootDir(rootDir, procDir string, pod *corev1.Pod) string {
+	if rootDir != "" {
+		return path.Clean(rootDir)
+	}
+	if dir := kubeletRootDirFromProc(procDir); dir != "" {
+		return dir
+	}
+	if pod != nil {
+		for _, v := range pod.Spec.Volumes {
+			if v.Name == kubeletDirVolumeName && v.HostPath != nil {
+				return path.Clean(v.HostPath.Path)
+			}
+		}
+	}
+	return DefaultKubeletRootDir
+}
+
+// PluginRegistrationDir is the directory kubelet watches for plugin registration sockets
+func PluginRegistrationDir() string {
+	return path.Join(KubeletRootDir, "plugins_registry")
+}
+
+// PluginSocketPath is the path of CSI socket on the host, which is passed to node-driver-registrar
+// as `--kubelet-registration-path`
+func PluginSocketPath() string {
+	return path.Join(KubeletRootDir, "csi-plugins", DriverName, "csi.sock")
+}
+
+// CheckKubeletPaths checks that the hostPath volumes of CSI Node pod and the args of node-driver-registrar in it
+// agree with KubeletRootDir, otherwise kubelet can't find the driver or the targets aren't propagated to the host.
+// The problems found are returned.
+func CheckKubeletPaths(pod *corev1.Pod) []string {
+	var problems []string
+	for _, v := range pod.Spec.Volumes {
+		if v.HostPath == nil {
+			continue
+		}
+		switch v.Name {
+		case kubeletDirVolumeName:
+			if path.Clean(v.HostPath.Path) != KubeletRootDir {
+				problems = append(problems, fmt.Sprintf("hostPath of volume %s is %s, should be %s", v.Name, v.HostPath.Path, KubeletRootDir))
+			}
+		case registrationDirVolumeName:
+			if path.Clean(v.HostPath.Path) != PluginRegistrationDir() {
+				problems = append(problems, fmt.Sprintf("hostPath of volume %s is %s, should be %s", v.Name, v.HostPath.Path, PluginRegistrationDir()))
+			}
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, arg := range c.Args {
+			v, ok := strings.CutPrefix(arg, registrationPathArg)
+			if !ok {
+				continue
+			}
+			if socket := expandEnv(v, c.Env); path.Clean(socket) != PluginSocketPath() {
+				problems = append(problems, fmt.Sprintf("%s of container %s is %s, should be %s", strings.TrimSuffix(registrationPathArg, "="), c.Name, socket, PluginSocketPath()))
+			}
+		}
+	}
+	return problems
+}
+
+// expandEnv expands $(VAR) references to the literal env of the container, like kubelet does for args
+func expandEnv(s string, envs []corev1.EnvVar) string {
+	for i := len(envs) - 1; i >= 0; i-- {
+		if envs[i].ValueFrom == nil {
+			s = strings.ReplaceAll(s, "$("+envs[i].Name+")", envs[i].Value)
+		}
+	}
+	return s
+}
+
+// kubeletRootDirFromProc looks for `--root-dir` in the command line of kubelet process, which is only visible with
+// hostPID, the volumes of CSI Node pod are used otherwise
+func kubeletRootDirFromProc(procDir string) string {
+	if procDir == "" {
+		return ""
+	}
+	cmdlines, err := filepath.Glob(filepath.Join(procDir, "[0-9]*", "cmdline"))
+	if err != nil {
+		return ""
+	}
+	for _, f := range cmdlines {
+		data, err := os.ReadFile(f)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		args := strings.Split(string(bytes.TrimRight(data, "\x00")), "\x00")
+		if filepath.Base(args[0]) != "kubelet" {
+			continue
+		}
+		for i, arg := range args[1:] {
+			if v, ok := strings.CutPrefix(arg, "--root-dir="); ok {
+				return path.Clean(v)
+			}
+			if arg == "--root-dir" && i+2 < len(args) {
+				return path.Clean(args[i+2])
+			}
+		}
+		// kubelet found but uses the default root-dir
+		return DefaultKubeletRootDir
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDetectKubeletRootDir(t *testing.T) {
+	fakeProc := func(cmdlines ...string) string {
+		dir := t.TempDir()
+		for i, cmdline := range cmdlines {
+			pidDir := filepath.Join(dir, string(rune('1'+i)))
+			assert.NoError(t, os.MkdirAll(pidDir, 0755))
+			data := strings.ReplaceAll(cmdline, " ", "\x00") + "\x00"
+			assert.NoError(t, os.WriteFile(filepath.Join(pidDir, "cmdline"), []byte(data), 0644))
+		}
+		return dir
+	}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+		Name:         "kubelet-dir",
+		VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/snap/microk8s/common/var/lib/kubelet/"}},
+	}}}}
+
+	tests := []struct {
+		name    string
+		rootDir string
+		procDir string
+		pod     *corev1.Pod
+		want    string
+	}{
+		{name: "default", want: DefaultKubeletRootDir},
+		{name: "flag", rootDir: "/data/kubelet/", pod: pod, want: "/data/kubelet"},
+		{name: "kubelet process", procDir: fakeProc("/sbin/init", "/usr/bin/kubelet --config=/etc/kubelet.yaml --root-dir=/data/kubelet"), pod: pod, want: "/data/kubelet"},
+		{name: "kubelet process separated arg", procDir: fakeProc("/usr/bin/kubelet --root-dir /data/k"), want: "/data/k"},
+		{name: "kubelet process default", procDir: fakeProc("/usr/bin/kubelet --v=2"), pod: pod, want: DefaultKubeletRootDir},
+		{name: "csi pod", procDir: fakeProc("/sbin/init"), pod: pod, want: "/var/snap/microk8s/common/var/lib/kubelet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DetectKubeletRootDir(tt.rootDir, tt.procDir, tt.pod))
+		})
+	}
+
+	KubeletRootDir = "/data/kubelet"
+	defer func() { KubeletRootDir = DefaultKubeletRootDir }()
+	assert.Equal(t, "/data/kubelet/plugins_registry", PluginRegistrationDir())
+	assert.Equal(t, "/data/kubelet/csi-plugins/csi.juicefs.com/csi.sock", PluginSocketPath())
+}
+
+func TestCheckKubeletPaths(t *testing.T) {
+	KubeletRootDir = "/data/kubelet"
+	defer func() { KubeletRootDir = DefaultKubeletRootDir }()
+	hostPath := func(name, path string) corev1.Volume {
+		return corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: path}}}
+	}
+	registrar := func(rootDir string) corev1.Container {
+		return corev1.Container{
+			Name: "node-driver-registrar",
+			Args: []string{"--csi-address=$(ADDRESS)", "--kubelet-registration-path=$(DRIVER_REG_SOCK_PATH)"},
+			Env: []corev1.EnvVar{
+				{Name: "ADDRESS", Value: "/csi/csi.sock"},
+				{Name: "KUBELET_ROOT_DIR", Value: rootDir},
+				{Name: "DRIVER_REG_SOCK_PATH", Value: "$(KUBELET_ROOT_DIR)/csi-plugins/csi.juicefs.com/csi.sock"},
+			},
+		}
+	}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "juicefs-plugin"}, registrar("/data/kubelet")},
+		Volumes:    []corev1.Volume{hostPath("kubelet-dir", "/data/kubelet"), hostPath("registration-dir", "/data/kubelet/plugins_registry/")},
+	}}
+	assert.Empty(t, CheckKubeletPaths(pod))
+
+	pod.Spec.Containers[1] = registrar("/var/lib/kubelet")
+	pod.Spec.Volumes[1] = hostPath("registration-dir", "/var/lib/kubelet/plugins_registry/")
+	assert.Equal(t, []string{
+		"hostPath of volume registration-dir is /var/lib/kubelet/plugins_registry/, should be /data/kubelet/plugins_registry",
+		"--kubelet-registration-path of container node-driver-registrar is /var/lib/kubelet/csi-plugins/csi.juicefs.com/csi.sock, should be /data/kubelet/csi-plugins/csi.juicefs.com/csi.sock",
+	}, CheckKubeletPaths(pod))
+}
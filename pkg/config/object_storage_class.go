@@ -0,0 +1,127 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+var objectStorageClassPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// archiveStorageClasses are storage classes whose objects need to be restored before reading,
+// which JuiceFS can't read, normalized by ignoring case, '_' and '-'
+var archiveStorageClasses = map[string]bool{
+	"glacier":         true,
+	"deeparchive":     true,
+	"archive":         true,
+	"coldarchive":     true,
+	"deepcoldarchive": true,
+}
+
+// volumeFormatOptions are format options allowed in common.VolumeFormatOptionsKey, which only
+// decide how data of the dedicated file system of the volume is stored
+var volumeFormatOptions = map[string]bool{
+	"storage-class": true,
+	"block-size":    true,
+	"compress":      true,
+	"hash-prefix":   true,
+	"shards":        true,
+	"trash-days":    true,
+	"capacity":      true,
+	"inodes":        true,
+}
+
+// ObjectStorageOptions returns the mount options writing new objects of the volume in the storage class
+// set by common.ObjectStorageClassKey, only community edition is supported.
+func ObjectStorageOptions(volCtx map[string]string, isCe bool) ([]string, error) {
+	storageClass := volCtx[common.ObjectStorageClassKey]
+	if storageClass == "" {
+		return nil, nil
+	}
+	if !isCe {
+		return nil, fmt.Errorf("%s is only supported by community edition", common.ObjectStorageClassKey)
+	}
+	return []string{"storage-class=" + storageClass}, nil
+}
+
+// VolumeFormatSecrets returns the secrets with format options of the dedicated file system of the volume,
+// set by common.VolumeFormatOptionsKey and common.ObjectStorageClassKey, they take precedence over the ones
+// in secrets. Secrets are returned as is for volumes without dedicated file systems.
+func VolumeFormatSecrets(secrets, volCtx map[string]string) map[string]string {
+	if !BucketPerVolume(volCtx) {
+		return secrets
+	}
+	var options []string
+	if v := volCtx[common.VolumeFormatOptionsKey]; v != "" {
+		options = strings.Split(v, ",")
+	}
+	if v := volCtx[common.ObjectStorageClassKey]; v != "" {
+		options = mergeOptions(options, []string{"storage-class=" + v})
+	}
+	if len(options) == 0 {
+		return secrets
+	}
+	volSecrets := make(map[string]string, len(secrets))
+	for k, v := range secrets {
+		volSecrets[k] = v
+	}
+	var base []string
+	if v := secrets["format-options"]; v != "" {
+		base = strings.Split(v, ",")
+	}
+	for _, option := range options {
+		// keys of secrets are passed to format as well, don't pass them twice
+		delete(volSecrets, strings.TrimSpace(strings.SplitN(option, "=", 2)[0]))
+	}
+	volSecrets["format-options"] = strings.Join(mergeOptions(base, options), ",")
+	return volSecrets
+}
+
+func validateObjectStorageClass(v string) error {
+	if v == "" {
+		return nil
+	}
+	if !objectStorageClassPattern.MatchString(v) {
+		return fmt.Errorf("invalid storage class")
+	}
+	if archiveStorageClasses[strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(v))] {
+		return fmt.Errorf("objects in %s need to be restored before reading, use an instant retrieval class instead", v)
+	}
+	return nil
+}
+
+func validateVolumeFormatOptions(v string) error {
+	options, err := (&JfsSetting{FormatOptions: v}).ParseFormatOptions()
+	if err != nil {
+		return err
+	}
+	for _, option := range options {
+		if !volumeFormatOptions[option[0]] {
+			return fmt.Errorf("format option %s is not allowed per volume", option[0])
+		}
+		if option[0] == "storage-class" {
+			if err := validateObjectStorageClass(option[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
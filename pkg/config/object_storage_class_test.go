@@ -0,0 +1,100 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+func TestValidateObjectStorageClass(t *testing.T) {
+	for _, v := range []string{"", "STANDARD_IA", "GLACIER_IR", "nearline"} {
+		if err := validateObjectStorageClass(v); err != nil {
+			t.Errorf("validateObjectStorageClass(%q) error = %v", v, err)
+		}
+	}
+	for _, v := range []string{"GLACIER", "DEEP_ARCHIVE", "ColdArchive", "STANDARD IA", "a,b"} {
+		if err := validateObjectStorageClass(v); err == nil {
+			t.Errorf("validateObjectStorageClass(%q) expected error", v)
+		}
+	}
+}
+
+func TestValidateVolumeFormatOptions(t *testing.T) {
+	for _, v := range []string{"compress=zstd", "storage-class=STANDARD_IA,trash-days=0,hash-prefix"} {
+		if err := validateVolumeFormatOptions(v); err != nil {
+			t.Errorf("validateVolumeFormatOptions(%q) error = %v", v, err)
+		}
+	}
+	for _, v := range []string{"bucket=https://other", "storage-class=GLACIER", "compress="} {
+		if err := validateVolumeFormatOptions(v); err == nil {
+			t.Errorf("validateVolumeFormatOptions(%q) expected error", v)
+		}
+	}
+}
+
+func TestVolumeFormatSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets map[string]string
+		volCtx  map[string]string
+		want    map[string]string
+	}{
+		{
+			name:    "shared",
+			secrets: map[string]string{"name": "jfs"},
+			volCtx:  map[string]string{common.ObjectStorageClassKey: "STANDARD_IA"},
+			want:    map[string]string{"name": "jfs"},
+		},
+		{
+			name:    "storage-class",
+			secrets: map[string]string{"name": "jfs", "format-options": "trash-days=1,storage-class=STANDARD"},
+			volCtx:  map[string]string{common.BucketPerVolumeKey: "true", common.ObjectStorageClassKey: "STANDARD_IA"},
+			want:    map[string]string{"name": "jfs", "format-options": "trash-days=1,storage-class=STANDARD_IA"},
+		},
+		{
+			name:    "format-options",
+			secrets: map[string]string{"name": "jfs", "trash-days": "1"},
+			volCtx: map[string]string{
+				common.BucketPerVolumeKey:     "true",
+				common.VolumeFormatOptionsKey: "trash-days=0,storage-class=GLACIER_IR",
+				common.ObjectStorageClassKey:  "STANDARD_IA",
+			},
+			want: map[string]string{"name": "jfs", "format-options": "trash-days=0,storage-class=STANDARD_IA"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VolumeFormatSecrets(tt.secrets, tt.volCtx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VolumeFormatSecrets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectStorageOptions(t *testing.T) {
+	volCtx := map[string]string{common.ObjectStorageClassKey: "STANDARD_IA"}
+	got, err := ObjectStorageOptions(volCtx, true)
+	if err != nil || !reflect.DeepEqual(got, []string{"storage-class=STANDARD_IA"}) {
+		t.Errorf("ObjectStorageOptions() = %v, %v", got, err)
+	}
+	if _, err := ObjectStorageOptions(volCtx, false); err == nil {
+		t.Errorf("ObjectStorageOptions() expected error for enterprise edition")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -31,17 +32,32 @@ import (
 	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/klog/v2"
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/secretprovider"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util/security"
 )
 
 const (
 	defaultCheckTimeout = 2 * time.Second
+
+	// MountStrategyShared mounts the whole file system and binds the subPath of the volume to the target
+	MountStrategyShared = "shared"
+	// MountStrategySubdir mounts only the subPath of the volume with the subdir option
+	MountStrategySubdir = "subdir"
+
+	// MountMetricsOff listens the metrics of the mount on the loopback address only
+	MountMetricsOff = "off"
+
+	// RemoteMountNFS exports the volume over NFS from storage nodes
+	RemoteMountNFS = "nfs"
+	// DefaultExportReplicas is the number of pods exporting a volume of remote mount
+	DefaultExportReplicas = 2
 )
 
 type JfsSetting struct {
@@ -73,11 +89,31 @@ type JfsSetting struct {
 	EncryptRsaKey string            `json:"encrypt_rsa_key,omitempty"`
 	InitConfig    string            `json:"initconfig,omitempty"`
 	Configs       map[string]string `json:"configs_map,omitempty"`
+	// TLS options for object storage and metadata engine, mounted to TLSConfPath in mount pod
+	CABundle              string `json:"ca-bundle,omitempty"`
+	TLSCert               string `json:"tls-cert,omitempty"`
+	TLSKey                string `json:"tls-key,omitempty"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify,omitempty"`
+	// ExternalSecrets the secrets are fetched from an external secret provider, they are never put in a Secret
+	// but written to files in ExternalSecretsPath of the node, see secretprovider.WriteFiles
+	ExternalSecrets bool `json:"external_secrets,omitempty"`
 
 	// put in volCtx
 	DeletedDelay string   `json:"deleted_delay"`
 	CleanCache   bool     `json:"clean_cache"`
 	HostPath     []string `json:"host_path"`
+	// drop the cache as soon as the last application pod leaves the node, regardless of DeletedDelay
+	CleanCacheOnUnpublish bool `json:"clean_cache_on_unpublish,omitempty"`
+	// MountStrategy is set by common.MountStrategyKey, decided by the mode of the driver if empty
+	MountStrategy string `json:"mount_strategy,omitempty"`
+	// BucketPerVolume the volume has a dedicated file system, see VolumeSecrets
+	BucketPerVolume bool `json:"bucket_per_volume,omitempty"`
+	// Rootless is set by common.RootlessKey, see RootlessUID
+	Rootless bool `json:"rootless,omitempty"`
+	// MetricsOff is set by common.MountMetricsKey
+	MetricsOff bool `json:"metrics_off,omitempty"`
+	// MetricsPort assigned to the mount pod on the host network, recorded in common.MetricsPortKey of the pod
+	MetricsPort int32 `json:"-"`
 
 	// mount
 	VolumeId   string   // volumeHandle of PV
@@ -90,9 +126,94 @@ type JfsSetting struct {
 	SecretName string   // secret with JuiceFS volume credentials
 
 	Attr *PodAttr
+	// Consumer is the pod the mount is dedicated to and tagged with, set by common.PodInfoTagsKey
+	Consumer *PodInfo `json:"consumer,omitempty"`
 
 	PV  *corev1.PersistentVolume      `json:"-"`
 	PVC *corev1.PersistentVolumeClaim `json:"-"`
+	// PVCNamespace is the namespace of PVC, only got when its metadata is propagated to mount pods
+	PVCNamespace *corev1.Namespace `json:"-"`
+}
+
+// SubdirMount returns whether only the subPath of the volume is mounted. By default, volumes are mounted with subdir
+// in mount pod mode, while the whole file system is mounted and shared by volumes with StorageClassShareMount or in
+// process mode.
+func (s *JfsSetting) SubdirMount() bool {
+	switch s.MountStrategy {
+	case MountStrategySubdir:
+		return true
+	case MountStrategyShared:
+		return false
+	}
+	return !StorageClassShareMount && !ByProcess
+}
+
+// FuseMountedByNode tells if the mount point is mounted by the node service and handed over to the unprivileged
+// mount pod with the fuse fd, for rootless mount pods and hardened ones whose image supports fuse fd passing
+func (s *JfsSetting) FuseMountedByNode() bool {
+	return s.Rootless || (MountPodHardened && util.SupportFusePass(s.Attr.Image))
+}
+
+// Writeback tells if the client uploads written data in background with the writeback option, the data staged in
+// the cache directory is not uploaded until the client is started again if it exits before that
+func (s *JfsSetting) Writeback() bool {
+	for _, option := range s.Options {
+		if option == "writeback" || option == "writeback=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// SubdirMountOptions returns the mount options with the subPath joined into the subdir option
+func (s *JfsSetting) SubdirMountOptions() []string {
+	options := []string{}
+	subdir := s.SubPath
+	for _, option := range s.Options {
+		if strings.HasPrefix(option, "subdir=") {
+			kv := strings.Split(option, "=")
+			if len(kv) != 2 {
+				continue
+			}
+			subdir = path.Join(kv[1], s.SubPath)
+			continue
+		}
+		options = append(options, option)
+	}
+	if subdir != "" {
+		options = append(options, fmt.Sprintf("subdir=%s", subdir))
+	}
+	return options
+}
+
+// PodInfo is the identity of a pod passed to NodePublishVolume with podInfoOnMount
+type PodInfo struct {
+	Namespace      string `json:"namespace"`
+	Name           string `json:"name"`
+	ServiceAccount string `json:"service_account,omitempty"`
+}
+
+// Hostname returns the hostname of the mount pod dedicated to the pod, which is the client name of the session
+// in the metadata engine
+func (p *PodInfo) Hostname() string {
+	name := strings.ReplaceAll(p.Namespace+"-"+p.Name, ".", "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.Trim(name, "-")
+}
+
+// MountOptions returns the options tagging the metrics of the mount with the identity of the pod,
+// custom-labels is only supported by the community edition
+func (p *PodInfo) MountOptions(ce bool) []string {
+	if !ce {
+		return nil
+	}
+	labels := []string{"pod_namespace:" + p.Namespace, "pod_name:" + p.Name}
+	if p.ServiceAccount != "" {
+		labels = append(labels, "service_account:"+p.ServiceAccount)
+	}
+	return []string{"custom-labels=" + strings.Join(labels, ";")}
 }
 
 func (s *JfsSetting) String() string {
@@ -120,6 +241,9 @@ func (s *JfsSetting) Safe() *JfsSetting {
 	if sCopy.EncryptRsaKey != "" {
 		sCopy.EncryptRsaKey = "***"
 	}
+	if sCopy.TLSKey != "" {
+		sCopy.TLSKey = "***"
+	}
 	return sCopy
 }
 
@@ -256,6 +380,17 @@ func ParseSetting(ctx context.Context, secrets, volCtx map[string]string, option
 		jfsSetting.SecretKey2 = secrets["secretkey2"]
 	}
 
+	if v := secrets["tls-insecure-skip-verify"]; v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid tls-insecure-skip-verify %q: %v", v, err)
+		}
+		jfsSetting.TLSInsecureSkipVerify = skip
+	}
+	if (jfsSetting.TLSCert == "") != (jfsSetting.TLSKey == "") {
+		return nil, status.Errorf(codes.InvalidArgument, "tls-cert and tls-key should be set together")
+	}
+
 	if secrets["configs"] != "" {
 		configStr := secrets["configs"]
 		configs := make(map[string]string)
@@ -282,9 +417,19 @@ func ParseSetting(ctx context.Context, secrets, volCtx map[string]string, option
 			jfsSetting.SubPath = volCtx["subPath"]
 		}
 
+		jfsSetting.MountStrategy = volCtx[common.MountStrategyKey]
+		jfsSetting.ExternalSecrets = secretprovider.Enabled(volCtx)
+		jfsSetting.BucketPerVolume = BucketPerVolume(volCtx)
+		jfsSetting.Rootless = volCtx[common.RootlessKey] == "true"
+		jfsSetting.MetricsOff = volCtx[common.MountMetricsKey] == MountMetricsOff
+
 		if volCtx[common.CleanCacheKey] == "true" {
 			jfsSetting.CleanCache = true
 		}
+		if volCtx[common.CleanCacheOnUnpublishKey] == "true" {
+			jfsSetting.CleanCache = true
+			jfsSetting.CleanCacheOnUnpublish = true
+		}
 		delay := volCtx[common.DeleteDelay]
 		if delay != "" {
 			if _, err := time.ParseDuration(delay); err != nil {
@@ -303,6 +448,52 @@ func ParseSetting(ctx context.Context, secrets, volCtx map[string]string, option
 			}
 			jfsSetting.HostPath = hostPaths
 		}
+
+		// mount by process shares the mount point of the volume among pods, it can't be dedicated to one
+		if volCtx[common.PodInfoTagsKey] == "true" && volCtx[common.PodInfoName] != "" && !ByProcess {
+			jfsSetting.Consumer = &PodInfo{
+				Namespace:      volCtx[common.PodInfoNamespace],
+				Name:           volCtx[common.PodInfoName],
+				ServiceAccount: volCtx[common.PodInfoSA],
+			}
+		}
+
+		var baseOptions []string
+		if profile := volCtx[common.OptionProfileKey]; profile != "" {
+			profileOptions, ok := GlobalConfig.OptionProfile(profile)
+			if !ok {
+				return nil, status.Errorf(codes.InvalidArgument, "option profile %s not found", profile)
+			}
+			baseOptions = profileOptions
+		}
+		cacheOptions, err := CacheOptions(volCtx, jfsSetting.IsCe)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		// mount options take precedence over cache timeouts of the volume, which take precedence over the profile
+		baseOptions = mergeOptions(baseOptions, cacheOptions)
+		if len(baseOptions) > 0 {
+			jfsSetting.Options = mergeOptions(baseOptions, jfsSetting.Options)
+		}
+	}
+
+	// bandwidth limits override the ones in mount options
+	jfsSetting.Options = mergeOptions(jfsSetting.Options, ThrottleOptions(volCtx, pvc))
+	fuseOptions, err := FuseOptions(volCtx[common.FuseOptionsKey])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %v", common.FuseOptionsKey, err)
+	}
+	jfsSetting.Options = mergeOptions(jfsSetting.Options, fuseOptions)
+	storageOptions, err := ObjectStorageOptions(volCtx, jfsSetting.IsCe)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	jfsSetting.Options = mergeOptions(jfsSetting.Options, storageOptions)
+	if jfsSetting.Consumer != nil {
+		jfsSetting.Options = mergeOptions(jfsSetting.Options, jfsSetting.Consumer.MountOptions(jfsSetting.IsCe))
+	}
+	if err := checkDeniedOptions(jfsSetting.Options); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mount options: %v", err)
 	}
 
 	if err := GenPodAttrWithCfg(&jfsSetting, volCtx); err != nil {
@@ -470,6 +661,51 @@ func GenCacheDirs(jfsSetting *JfsSetting, volCtx map[string]string) error {
 	return nil
 }
 
+// mergeOptions returns base options overridden by the ones with the same name in options
+func mergeOptions(base, options []string) []string {
+	explicit := make(map[string]bool)
+	for _, option := range options {
+		explicit[strings.TrimSpace(strings.SplitN(option, "=", 2)[0])] = true
+	}
+	merged := make([]string, 0, len(base)+len(options))
+	for _, option := range base {
+		if !explicit[strings.TrimSpace(strings.SplitN(option, "=", 2)[0])] {
+			merged = append(merged, option)
+		}
+	}
+	return append(merged, options...)
+}
+
+// throttleOptions maps bandwidth limit keys to the mount options
+var throttleOptions = map[string]string{
+	common.UploadLimitKey:   "upload-limit",
+	common.DownloadLimitKey: "download-limit",
+}
+
+// ThrottleOptions returns the bandwidth limit mount options of the volume,
+// annotations of PVC take precedence over volume context
+func ThrottleOptions(volCtx map[string]string, pvc *corev1.PersistentVolumeClaim) []string {
+	var options []string
+	for _, key := range []string{common.UploadLimitKey, common.DownloadLimitKey} {
+		candidates := []string{volCtx[key]}
+		if pvc != nil {
+			candidates = []string{pvc.Annotations[key], volCtx[key]}
+		}
+		for _, value := range candidates {
+			if value == "" {
+				continue
+			}
+			if err := validateNonNegativeInt(value); err != nil {
+				log.Info("invalid bandwidth limit, ignore it", "key", key, "value", value, "error", err.Error())
+				continue
+			}
+			options = append(options, fmt.Sprintf("%s=%s", throttleOptions[key], value))
+			break
+		}
+	}
+	return options
+}
+
 func genAndValidOptions(JfsSetting *JfsSetting) error {
 	mountOptions := []string{}
 	for _, option := range JfsSetting.Options {
@@ -482,7 +718,7 @@ func genAndValidOptions(JfsSetting *JfsSetting) error {
 			mountOption = fmt.Sprintf("%s=%s", strings.TrimSpace(ops[0]), strings.TrimSpace(ops[1]))
 		}
 		if mountOption == "writeback" {
-			log.Info("writeback is not suitable in CSI, please do not use it.", "volumeId", JfsSetting.VolumeId)
+			log.Info("writeback is not suitable in CSI, mount pods wait for staged data to be uploaded before exit, within the writeback flush timeout.", "volumeId", JfsSetting.VolumeId)
 		}
 		if len(ops) == 2 && ops[0] == "buffer-size" {
 			memLimit := JfsSetting.Attr.Resources.Limits[corev1.ResourceMemory]
@@ -582,6 +818,15 @@ func GenPodAttrWithCfg(setting *JfsSetting, volCtx map[string]string) error {
 	return nil
 }
 
+func podHasHostPath(pod *corev1.Pod, path string) bool {
+	for _, v := range pod.Spec.Volumes {
+		if v.HostPath != nil && v.HostPath.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
 // GenSettingAttrWithMountPod generate pod attr with mount pod
 // Return the latest pod attributes following the priorities below:
 //
@@ -629,17 +874,35 @@ func GenSettingAttrWithMountPod(ctx context.Context, client *k8sclient.K8sClient
 
 	// get settings from secret
 	secretName := fmt.Sprintf("juicefs-%s-secret", mountPod.Labels[common.PodUniqueIdLabelKey])
-	secret, err := client.GetSecret(ctx, secretName, mountPod.Namespace)
-	if err != nil {
+	var secret *corev1.Secret
+	if dir := filepath.Join(ExternalSecretsPath, secretName); podHasHostPath(mountPod, dir) {
+		// secrets from the external secret provider are only in files on the node of the mount pod
+		data, err := secretprovider.ReadFiles(dir)
+		if err != nil {
+			return nil, fmt.Errorf("read secrets of mount pod %s from the external secret provider on node %s: %v", mountPod.Name, NodeName, err)
+		}
+		secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: mountPod.Namespace}, Data: data}
+	} else if secret, err = client.GetSecret(ctx, secretName, mountPod.Namespace); err != nil {
 		log.Error(err, "Get secret error", "secret", secretName)
 	}
 	setting, err := RevertSetting(mountPod, pvc, pv, secret, custSecret)
 	if err != nil {
 		return nil, err
 	}
+	if pvc != nil && NamespaceMetadataPropagated() {
+		if ns, err := client.CoreV1().Namespaces().Get(ctx, pvc.Namespace, metav1.GetOptions{}); err != nil {
+			log.Error(err, "Get namespace of pvc error", "namespace", pvc.Namespace)
+		} else {
+			setting.PVCNamespace = ns
+		}
+	}
 	if err = setting.ReNew(mountPod, pvc, pv, custSecret); err != nil {
 		return nil, err
 	}
+	// the recreated mount pod keeps the port, the old one is gone by then
+	if port, err := strconv.ParseInt(mountPod.Annotations[common.MetricsPortKey], 10, 32); err == nil {
+		setting.MetricsPort = int32(port)
+	}
 	return setting, nil
 }
 
@@ -674,6 +937,13 @@ func RevertSetting(mountPod *corev1.Pod, pvc *corev1.PersistentVolumeClaim, pv *
 		for k, v := range custSecret.Data {
 			secretsMap[k] = string(v[:])
 		}
+		if BucketPerVolume(pv.Spec.CSI.VolumeAttributes) {
+			volSecrets, err := VolumeSecrets(secretsMap, pv.Spec.CSI.VolumeHandle)
+			if err != nil {
+				return nil, err
+			}
+			secretsMap = volSecrets
+		}
 		setting, err := ParseSetting(
 			context.TODO(),
 			secretsMap,
@@ -818,6 +1088,12 @@ func (s *JfsSetting) ReNew(mountPod *corev1.Pod, pvc *corev1.PersistentVolumeCla
 			s.Passphrase = util.CpNotEmpty(custSetting.Passphrase, s.Passphrase)
 			s.EncryptRsaKey = util.CpNotEmpty(custSetting.EncryptRsaKey, s.EncryptRsaKey)
 			s.InitConfig = util.CpNotEmpty(custSetting.InitConfig, s.InitConfig)
+			s.CABundle = util.CpNotEmpty(custSetting.CABundle, s.CABundle)
+			s.TLSCert = util.CpNotEmpty(custSetting.TLSCert, s.TLSCert)
+			s.TLSKey = util.CpNotEmpty(custSetting.TLSKey, s.TLSKey)
+			if skip, err := strconv.ParseBool(secretsMap["tls-insecure-skip-verify"]); err == nil {
+				s.TLSInsecureSkipVerify = skip
+			}
 			s.CustomerSecret = custSecret
 			s.ClientConfPath = DefaultClientConfPath
 			err = s.genFormatCmd(secretsMap)
@@ -1063,6 +1339,7 @@ func processOption(option string, resources corev1.ResourceRequirements) string
 
 func applyConfigPatch(setting *JfsSetting) {
 	attr := setting.Attr
+	propagateMetadata(setting)
 	// overwrite by mountpod patch
 	patch := GlobalConfig.GenMountPodPatch(*setting)
 	if patch.Image != "" {
@@ -1125,6 +1402,60 @@ func applyConfigPatch(setting *JfsSetting) {
 		setting.CleanCache = v == "true"
 		delete(attr.Annotations, common.CleanCacheKey)
 	}
+	if v, ok := attr.Annotations[common.CleanCacheOnUnpublishKey]; ok {
+		setting.CleanCacheOnUnpublish = v == "true"
+		if setting.CleanCacheOnUnpublish {
+			setting.CleanCache = true
+		}
+		delete(attr.Annotations, common.CleanCacheOnUnpublishKey)
+	}
+}
+
+// propagateMetadata copies the allowed labels and annotations of PVC and its namespace onto the mount pod. Those of
+// PVC are set, while those of the namespace are only added if absent, so that it gives the same result when the
+// namespace is got after the setting is parsed. Mount pod patches take precedence over them.
+func propagateMetadata(setting *JfsSetting) {
+	p := GlobalConfig.PropagateMetadata
+	if p == nil || setting.PVC == nil {
+		return
+	}
+	for k, v := range p.Select(p.Labels, setting.PVC.Labels) {
+		setting.Attr.Labels[k] = v
+	}
+	for k, v := range p.Select(p.Annotations, setting.PVC.Annotations) {
+		setting.Attr.Annotations[k] = v
+	}
+	propagateNamespaceMetadata(setting)
+}
+
+func propagateNamespaceMetadata(setting *JfsSetting) {
+	p := GlobalConfig.PropagateMetadata
+	if p == nil || !p.FromNamespace || setting.PVCNamespace == nil {
+		return
+	}
+	for k, v := range p.Select(p.Labels, setting.PVCNamespace.Labels) {
+		if _, ok := setting.Attr.Labels[k]; !ok {
+			setting.Attr.Labels[k] = v
+		}
+	}
+	for k, v := range p.Select(p.Annotations, setting.PVCNamespace.Annotations) {
+		if _, ok := setting.Attr.Annotations[k]; !ok {
+			setting.Attr.Annotations[k] = v
+		}
+	}
+}
+
+// PropagateNamespaceMetadata adds the allowed labels and annotations of the namespace of PVC to the parsed setting
+func PropagateNamespaceMetadata(setting *JfsSetting, ns *corev1.Namespace) {
+	setting.PVCNamespace = ns
+	if setting.Attr != nil {
+		propagateNamespaceMetadata(setting)
+	}
+}
+
+// NamespaceMetadataPropagated returns whether the namespace of PVC is needed to propagate its metadata to mount pods
+func NamespaceMetadataPropagated() bool {
+	return GlobalConfig.PropagateMetadata != nil && GlobalConfig.PropagateMetadata.FromNamespace
 }
 
 // IsCEMountPod check if the pod is a mount pod of CE
@@ -25,6 +25,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 
 	"github.com/stretchr/testify/assert"
@@ -733,6 +734,132 @@ func TestParseSecret(t *testing.T) {
 	}
 }
 
+func TestParseSettingWithOptionProfile(t *testing.T) {
+	defer GlobalConfig.Reset()
+	GlobalConfig.OptionProfiles = []OptionProfile{
+		{Name: "throughput", MountOptions: []string{"buffer-size=1024", "cache-size=204800", "max-uploads=50"}},
+	}
+	secrets := map[string]string{"name": "test", "metaurl": "redis://127.0.0.1:6379/0"}
+	volCtx := map[string]string{common.OptionProfileKey: "throughput"}
+
+	got, err := ParseSetting(context.TODO(), secrets, volCtx, []string{"cache-size=1024", "writeback"}, "pv", "pv", "test", nil, nil)
+	if err != nil {
+		t.Fatalf("ParseSetting() error = %v", err)
+	}
+	want := []string{"buffer-size=1024", "max-uploads=50", "cache-size=1024", "writeback"}
+	if !reflect.DeepEqual(got.Options, want) {
+		t.Errorf("ParseSetting() options = %v, want %v", got.Options, want)
+	}
+
+	volCtx[common.OptionProfileKey] = "archival"
+	if _, err := ParseSetting(context.TODO(), secrets, volCtx, nil, "pv", "pv", "test", nil, nil); err == nil {
+		t.Errorf("ParseSetting() with unknown profile should fail")
+	}
+	if _, err := ParseVolumeContext(volCtx, true); err == nil {
+		t.Errorf("ParseVolumeContext() with unknown profile should fail")
+	}
+}
+
+func TestParseSettingWithThrottle(t *testing.T) {
+	secrets := map[string]string{"name": "test", "metaurl": "redis://127.0.0.1:6379/0"}
+	volCtx := map[string]string{common.UploadLimitKey: "100", common.DownloadLimitKey: "200"}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{common.UploadLimitKey: "50", common.DownloadLimitKey: "-1"},
+	}}
+
+	got, err := ParseSetting(context.TODO(), secrets, volCtx, []string{"upload-limit=1000", "writeback"}, "pv", "pv", "test", nil, pvc)
+	if err != nil {
+		t.Fatalf("ParseSetting() error = %v", err)
+	}
+	// invalid annotation of pvc is ignored, and the one in volume context is used
+	want := []string{"writeback", "upload-limit=50", "download-limit=200"}
+	if !reflect.DeepEqual(got.Options, want) {
+		t.Errorf("ParseSetting() options = %v, want %v", got.Options, want)
+	}
+}
+
+func TestParseSettingWithPodInfoTags(t *testing.T) {
+	secrets := map[string]string{"name": "test", "metaurl": "redis://127.0.0.1:6379/0"}
+	volCtx := map[string]string{
+		common.PodInfoTagsKey:   "true",
+		common.PodInfoNamespace: "default",
+		common.PodInfoName:      "app.v1-0",
+		common.PodInfoSA:        "app",
+	}
+	got, err := ParseSetting(context.TODO(), secrets, volCtx, []string{"cache-size=1024"}, "pv", "pv", "test", nil, nil)
+	if err != nil {
+		t.Fatalf("ParseSetting() error = %v", err)
+	}
+	want := []string{"cache-size=1024", "custom-labels=pod_namespace:default;pod_name:app.v1-0;service_account:app"}
+	if !reflect.DeepEqual(got.Options, want) {
+		t.Errorf("ParseSetting() options = %v, want %v", got.Options, want)
+	}
+	if got.Consumer == nil || got.Consumer.Hostname() != "default-app-v1-0" {
+		t.Errorf("ParseSetting() consumer = %+v", got.Consumer)
+	}
+
+	// mounts of different pods are not shared
+	other := map[string]string{}
+	for k, v := range volCtx {
+		other[k] = v
+	}
+	other[common.PodInfoName] = "app.v1-1"
+	got2, err := ParseSetting(context.TODO(), secrets, other, []string{"cache-size=1024"}, "pv", "pv", "test", nil, nil)
+	if err != nil {
+		t.Fatalf("ParseSetting() error = %v", err)
+	}
+	if GenHashOfSetting(klog.NewKlogr(), *got) == GenHashOfSetting(klog.NewKlogr(), *got2) {
+		t.Errorf("mounts of different pods should have different hash")
+	}
+
+	// enterprise edition doesn't support custom-labels
+	if options := (&PodInfo{Namespace: "default", Name: "app"}).MountOptions(false); len(options) != 0 {
+		t.Errorf("MountOptions() of enterprise edition = %v", options)
+	}
+}
+
+func TestParseSettingWithPropagatedMetadata(t *testing.T) {
+	defer GlobalConfig.Reset()
+	GlobalConfig.PropagateMetadata = &MetadataPropagation{
+		Labels:        []string{"team", "billing.example.com/*"},
+		Annotations:   []string{"cost-center"},
+		FromNamespace: true,
+	}
+	GlobalConfig.MountPodPatch = []MountPodPatch{{Labels: map[string]string{"team": "patched"}}}
+	secrets := map[string]string{"name": "test", "metaurl": "redis://127.0.0.1:6379/0"}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:        "data",
+		Namespace:   "tenant-a",
+		Labels:      map[string]string{"team": "a", "billing.example.com/project": "p1", "app": "web"},
+		Annotations: map[string]string{"cost-center": "cc-1", "note": "x"},
+	}}
+	got, err := ParseSetting(context.TODO(), secrets, nil, nil, "pv", "pv", "test", nil, pvc)
+	if err != nil {
+		t.Fatalf("ParseSetting() error = %v", err)
+	}
+	wantLabels := map[string]string{"team": "patched", "billing.example.com/project": "p1"}
+	if !reflect.DeepEqual(got.Attr.Labels, wantLabels) {
+		t.Errorf("ParseSetting() labels = %v, want %v", got.Attr.Labels, wantLabels)
+	}
+	if !reflect.DeepEqual(got.Attr.Annotations, map[string]string{"cost-center": "cc-1"}) {
+		t.Errorf("ParseSetting() annotations = %v", got.Attr.Annotations)
+	}
+
+	// those of pvc take precedence over the namespace
+	PropagateNamespaceMetadata(got, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "tenant-a",
+		Labels:      map[string]string{"billing.example.com/project": "p0", "billing.example.com/tenant": "a"},
+		Annotations: map[string]string{"cost-center": "cc-0"},
+	}})
+	wantLabels["billing.example.com/tenant"] = "a"
+	if !reflect.DeepEqual(got.Attr.Labels, wantLabels) {
+		t.Errorf("PropagateNamespaceMetadata() labels = %v, want %v", got.Attr.Labels, wantLabels)
+	}
+	if got.Attr.Annotations["cost-center"] != "cc-1" {
+		t.Errorf("PropagateNamespaceMetadata() annotations = %v", got.Attr.Annotations)
+	}
+}
+
 func Test_genCacheDirs(t *testing.T) {
 	type args struct {
 		JfsSetting JfsSetting
@@ -1450,3 +1577,28 @@ func TestGenHashOfSetting(t *testing.T) {
 		})
 	}
 }
+
+func TestSubdirMount(t *testing.T) {
+	defer func() { StorageClassShareMount = false }()
+	setting := &JfsSetting{SubPath: "pvc-1", Options: []string{"debug", "subdir=/tenant"}}
+	if !setting.SubdirMount() {
+		t.Errorf("SubdirMount() should be true in mount pod mode")
+	}
+	if got, want := setting.SubdirMountOptions(), []string{"debug", "subdir=/tenant/pvc-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SubdirMountOptions() got = %v, want %v", got, want)
+	}
+	setting.MountStrategy = MountStrategyShared
+	if setting.SubdirMount() {
+		t.Errorf("SubdirMount() should be false with shared strategy")
+	}
+
+	StorageClassShareMount = true
+	setting.MountStrategy = ""
+	if setting.SubdirMount() {
+		t.Errorf("SubdirMount() should be false with StorageClassShareMount")
+	}
+	setting.MountStrategy = MountStrategySubdir
+	if !setting.SubdirMount() {
+		t.Errorf("SubdirMount() should be true with subdir strategy")
+	}
+}
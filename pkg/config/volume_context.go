@@ -0,0 +1,353 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/secretprovider"
+)
+
+// VolumeContext is the typed view of PV volumeAttributes or StorageClass parameters
+type VolumeContext struct {
+	SubPath      string
+	Capacity     *int64
+	MountOptions []string
+
+	VerifyOnMount       string
+	VerifyOnMountSample int
+
+	// fail publishing if the capacity quota can not be applied
+	StrictCapacity bool
+
+	// inline ephemeral volume, set by kubelet
+	Ephemeral bool
+	// data of scratch volumes is deleted after the TTL once no pod uses it
+	ScratchTTL time.Duration
+	// source cluster of volumes imported from another cluster, which are mounted read-only
+	ImportedFrom string
+	// directories created in the volume if missing, see DirTreeSpecKey
+	DirTree []DirTreeEntry
+
+	// the volume is mounted by export pods on storage nodes and mounted over NFS on this node, see RemoteMountKey
+	RemoteMount         string
+	StorageNodeSelector map[string]string
+	ExportReplicas      int32
+}
+
+type volumeContextValidator func(value string) error
+
+// volumeContextKeys are all the recognized keys, with the validator of their values
+var volumeContextKeys = map[string]volumeContextValidator{
+	"subPath":                       nil,
+	"capacity":                      validateNonNegativeInt,
+	"mountOptions":                  nil,
+	"pathPattern":                   nil,
+	"secretFinalizer":               validateBool,
+	common.MountPodCpuLimitKey:      validateQuantity,
+	common.MountPodMemLimitKey:      validateQuantity,
+	common.MountPodCpuRequestKey:    validateQuantity,
+	common.MountPodMemRequestKey:    validateQuantity,
+	common.MountPodLabelKey:         validateStringMap,
+	common.MountPodAnnotationKey:    validateStringMap,
+	common.MountPodServiceAccount:   nil,
+	common.MountPodImageKey:         nil,
+	common.DeleteDelay:              validateDuration,
+	common.CleanCacheKey:            validateBool,
+	common.CleanCacheOnUnpublishKey: validateBool,
+	common.CachePVC:                 nil,
+	common.CacheEmptyDir:            validateCacheEmptyDir,
+	common.CacheInlineVolume:        validateCacheInlineVolume,
+	common.MountPodHostPath:         nil,
+	common.VerifyOnMountKey:         nil,
+	common.VerifyOnMountSampleKey:   validateNonNegativeInt,
+	common.SecretProviderKey:        secretprovider.Validate,
+	common.SecretPathKey:            nil,
+	common.SecretVaultRoleKey:       nil,
+	common.FormatDriftKey:           validateFormatDrift,
+	common.MirrorOfKey:              validateSecretRef,
+	common.OptionProfileKey:         validateOptionProfile,
+	common.StrictCapacityKey:        validateBool,
+	common.AuditSampleRateKey:       validateRatio,
+	common.UploadLimitKey:           validateNonNegativeInt,
+	common.DownloadLimitKey:         validateNonNegativeInt,
+	common.ScratchTTLKey:            validateDuration,
+	common.FuseOptionsKey:           validateFuseOptions,
+	common.CachePresetKey:           validateCachePreset,
+	common.AttrCacheKey:             validateCacheTimeout,
+	common.EntryCacheKey:            validateCacheTimeout,
+	common.DirEntryCacheKey:         validateCacheTimeout,
+	common.OpenCacheKey:             validateCacheTimeout,
+	common.ImportedFromKey:          nil,
+	common.PodInfoTagsKey:           validateBool,
+	common.VolumePoolSizeKey:        validateNonNegativeInt,
+	common.MountStrategyKey:         validateMountStrategy,
+	common.BucketPerVolumeKey:       validateBool,
+	common.MountMetricsKey:          validateMountMetrics,
+	common.DirTreeKey:               validateDirTreeRef,
+	common.DirTreeSpecKey:           validateDirTreeSpec,
+	common.RemoteMountKey:           validateRemoteMount,
+	common.StorageNodeSelectorKey:   validateNodeSelector,
+	common.ExportReplicasKey:        validatePositiveInt,
+	common.ObjectStorageClassKey:    validateObjectStorageClass,
+	common.VolumeFormatOptionsKey:   validateVolumeFormatOptions,
+	common.RootlessKey:              validateBool,
+}
+
+// gatedVolumeContextKeys are keys of features behind feature gates, they are rejected when the feature is disabled
+var gatedVolumeContextKeys = map[string]Feature{
+	common.RemoteMountKey: RemoteMount,
+	common.RootlessKey:    RootlessMount,
+}
+
+// keys with these prefixes are set by kubernetes or CSI sidecars, they are not validated
+var ignoredVolumeContextPrefixes = []string{"csi.storage.k8s.io/", "storage.kubernetes.io/"}
+
+// ParseVolumeContext validates all the values in volCtx and returns the typed volume context.
+// Unknown keys are reported only in strict mode, which is used when provisioning: they are logged as warnings,
+// and reject new volumes only with StrictVolumeContext, so that StorageClasses which used to work are not broken
+// on upgrade. Existing PVs carrying keys unknown to this version can always be mounted.
+func ParseVolumeContext(volCtx map[string]string, strict bool) (*VolumeContext, error) {
+	var unknown, invalid []string
+	for k, v := range volCtx {
+		validator, ok := volumeContextKeys[k]
+		if !ok {
+			if !hasIgnoredPrefix(k) {
+				unknown = append(unknown, k)
+			}
+			continue
+		}
+		if f, ok := gatedVolumeContextKeys[k]; ok && v != "" && !FeatureGates.Enabled(f) {
+			invalid = append(invalid, fmt.Sprintf("%s=%q: feature gate %s is disabled", k, v, f))
+			continue
+		}
+		if validator == nil {
+			continue
+		}
+		if err := validator(v); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s=%q: %v", k, v, err))
+		}
+	}
+	sort.Strings(unknown)
+	sort.Strings(invalid)
+
+	var problems []string
+	if strict && len(unknown) > 0 {
+		if StrictVolumeContext {
+			problems = append(problems, fmt.Sprintf("unknown keys %v", unknown))
+		} else {
+			log.Info("unknown keys in volume context are ignored, check them for typos", "keys", unknown)
+		}
+	}
+	if len(invalid) > 0 {
+		problems = append(problems, fmt.Sprintf("invalid values [%s]", strings.Join(invalid, ", ")))
+	}
+	if volCtx[common.VolumeFormatOptionsKey] != "" && !BucketPerVolume(volCtx) {
+		problems = append(problems, fmt.Sprintf("%s requires %s", common.VolumeFormatOptionsKey, common.BucketPerVolumeKey))
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid volume context: %s", strings.Join(problems, "; "))
+	}
+
+	vc := &VolumeContext{
+		SubPath:        volCtx["subPath"],
+		VerifyOnMount:  volCtx[common.VerifyOnMountKey],
+		StrictCapacity: volCtx[common.StrictCapacityKey] == "true",
+		Ephemeral:      volCtx[common.EphemeralKey] == "true",
+		ImportedFrom:   volCtx[common.ImportedFromKey],
+	}
+	if v := volCtx[common.ScratchTTLKey]; v != "" {
+		vc.ScratchTTL, _ = time.ParseDuration(v)
+	}
+	if v, ok := volCtx["capacity"]; ok {
+		capacity, _ := strconv.ParseInt(v, 10, 64)
+		vc.Capacity = &capacity
+	}
+	if v := volCtx["mountOptions"]; v != "" {
+		vc.MountOptions = strings.Split(v, ",")
+	}
+	if v := volCtx[common.VerifyOnMountSampleKey]; v != "" {
+		vc.VerifyOnMountSample, _ = strconv.Atoi(v)
+	}
+	if v := volCtx[common.DirTreeSpecKey]; v != "" {
+		vc.DirTree, _ = ParseDirTree(v)
+	}
+	if vc.RemoteMount = volCtx[common.RemoteMountKey]; vc.RemoteMount != "" {
+		vc.StorageNodeSelector = map[string]string{common.StorageNodeLabelKey: "true"}
+		if v := volCtx[common.StorageNodeSelectorKey]; v != "" {
+			vc.StorageNodeSelector, _ = labels.ConvertSelectorToLabelsMap(v)
+		}
+		vc.ExportReplicas = DefaultExportReplicas
+		if v := volCtx[common.ExportReplicasKey]; v != "" {
+			replicas, _ := strconv.ParseInt(v, 10, 32)
+			vc.ExportReplicas = int32(replicas)
+		}
+	}
+	return vc, nil
+}
+
+func hasIgnoredPrefix(key string) bool {
+	for _, prefix := range ignoredVolumeContextPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateNonNegativeInt(v string) error {
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("not an integer")
+	}
+	if i < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+func validateBool(v string) error {
+	if v != "" && v != "true" && v != "false" {
+		return fmt.Errorf("must be true or false")
+	}
+	return nil
+}
+
+func validateRatio(v string) error {
+	r, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(r) || math.IsInf(r, 0) || r < 0 || r > 1 {
+		return fmt.Errorf("must be a number between 0 and 1")
+	}
+	return nil
+}
+
+func validateDuration(v string) error {
+	if v == "" {
+		return nil
+	}
+	_, err := time.ParseDuration(v)
+	return err
+}
+
+func validateQuantity(v string) error {
+	if v == "" {
+		return nil
+	}
+	_, err := resource.ParseQuantity(v)
+	return err
+}
+
+func validateStringMap(v string) error {
+	if v == "" {
+		return nil
+	}
+	m := make(map[string]string)
+	return parseYamlOrJson(v, &m)
+}
+
+// validateSecretRef validates secret reference in the form of [<namespace>/]<name>
+func validateSecretRef(v string) error {
+	parts := strings.Split(v, "/")
+	if len(parts) > 2 {
+		return fmt.Errorf("should be [<namespace>/]<name>")
+	}
+	for _, p := range parts {
+		if p == "" {
+			return fmt.Errorf("should be [<namespace>/]<name>")
+		}
+	}
+	return nil
+}
+
+func validateOptionProfile(v string) error {
+	if _, ok := GlobalConfig.OptionProfile(v); !ok {
+		return fmt.Errorf("profile not found in optionProfiles of driver config")
+	}
+	return nil
+}
+
+func validateFormatDrift(v string) error {
+	if v != "" && v != FormatDriftWarn && v != FormatDriftReconcile {
+		return fmt.Errorf("must be %s or %s", FormatDriftWarn, FormatDriftReconcile)
+	}
+	return nil
+}
+
+func validateMountStrategy(v string) error {
+	if v != "" && v != MountStrategyShared && v != MountStrategySubdir {
+		return fmt.Errorf("must be %s or %s", MountStrategyShared, MountStrategySubdir)
+	}
+	return nil
+}
+
+func validateRemoteMount(v string) error {
+	if v != "" && v != RemoteMountNFS {
+		return fmt.Errorf("must be %s", RemoteMountNFS)
+	}
+	return nil
+}
+
+// validateNodeSelector validates label selector in the form of key1=value1,key2=value2
+func validateNodeSelector(v string) error {
+	_, err := labels.ConvertSelectorToLabelsMap(v)
+	return err
+}
+
+func validatePositiveInt(v string) error {
+	i, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return fmt.Errorf("not an integer")
+	}
+	if i <= 0 {
+		return fmt.Errorf("must be positive")
+	}
+	return nil
+}
+
+func validateMountMetrics(v string) error {
+	if v != "" && v != MountMetricsOff {
+		return fmt.Errorf("must be %s", MountMetricsOff)
+	}
+	return nil
+}
+
+func validateCacheEmptyDir(v string) error {
+	parts := strings.Split(strings.TrimSpace(v), ":")
+	if len(parts) > 2 {
+		return fmt.Errorf("must be in format of <medium>[:<sizeLimit>]")
+	}
+	if len(parts) == 2 {
+		return validateQuantity(strings.TrimSpace(parts[1]))
+	}
+	return nil
+}
+
+func validateCacheInlineVolume(v string) error {
+	inlineVolumes := []*corev1.CSIVolumeSource{}
+	return json.Unmarshal([]byte(v), &inlineVolumes)
+}
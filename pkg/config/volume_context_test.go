@@ -0,0 +1,148 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+func TestParseVolumeContext(t *testing.T) {
+	assert.NoError(t, FeatureGates.Set("RemoteMount=true"))
+	defer func() { _ = FeatureGates.Set("RemoteMount=false") }()
+	capacity := int64(1073741824)
+	tests := []struct {
+		name          string
+		volCtx        map[string]string
+		strict        bool
+		rejectUnknown bool
+		want          *VolumeContext
+		wantErr       string
+	}{
+		{
+			name:   "empty",
+			volCtx: nil,
+			strict: true,
+			want:   &VolumeContext{},
+		},
+		{
+			name: "valid",
+			volCtx: map[string]string{
+				"subPath":                                      "pvc-a",
+				"capacity":                                     "1073741824",
+				"mountOptions":                                 "ro,cache-size=100",
+				common.MountPodCpuLimitKey:                     "1",
+				common.MountPodLabelKey:                        "a: b",
+				common.DeleteDelay:                             "1m",
+				common.CacheEmptyDir:                           "Memory:1Gi",
+				common.VerifyOnMountKey:                        "SHA256SUMS",
+				common.VerifyOnMountSampleKey:                  "10",
+				"csi.storage.k8s.io/pvc/name":                  "pvc",
+				"storage.kubernetes.io/csiProvisionerIdentity": "id",
+			},
+			strict: true,
+			want: &VolumeContext{
+				SubPath:             "pvc-a",
+				Capacity:            &capacity,
+				MountOptions:        []string{"ro", "cache-size=100"},
+				VerifyOnMount:       "SHA256SUMS",
+				VerifyOnMountSample: 10,
+			},
+		},
+		{
+			name:   "unknown keys in strict mode",
+			volCtx: map[string]string{"subPaht": "a", "foo": "bar"},
+			strict: true,
+			want:   &VolumeContext{},
+		},
+		{
+			name:          "unknown keys rejected in strict mode",
+			volCtx:        map[string]string{"subPaht": "a", "foo": "bar"},
+			strict:        true,
+			rejectUnknown: true,
+			wantErr:       "invalid volume context: unknown keys [foo subPaht]",
+		},
+		{
+			name:   "unknown keys in non-strict mode",
+			volCtx: map[string]string{"subPath": "a", "foo": "bar"},
+			want:   &VolumeContext{SubPath: "a"},
+		},
+		{
+			name: "invalid values",
+			volCtx: map[string]string{
+				"capacity":                 "-1",
+				"secretFinalizer":          "yes",
+				common.MountPodMemLimitKey: "1 GiB",
+				"foo":                      "bar",
+			},
+			strict:        true,
+			rejectUnknown: true,
+			wantErr:       `invalid volume context: unknown keys [foo]; invalid values [capacity="-1": must not be negative, juicefs/mount-memory-limit="1 GiB": quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$', secretFinalizer="yes": must be true or false]`,
+		},
+		{
+			name:   "remote mount",
+			volCtx: map[string]string{common.RemoteMountKey: "nfs"},
+			strict: true,
+			want: &VolumeContext{
+				RemoteMount:         RemoteMountNFS,
+				StorageNodeSelector: map[string]string{common.StorageNodeLabelKey: "true"},
+				ExportReplicas:      DefaultExportReplicas,
+			},
+		},
+		{
+			name:   "remote mount on selected nodes",
+			volCtx: map[string]string{common.RemoteMountKey: "nfs", common.StorageNodeSelectorKey: "pool=storage,zone=a", common.ExportReplicasKey: "3"},
+			strict: true,
+			want: &VolumeContext{
+				RemoteMount:         RemoteMountNFS,
+				StorageNodeSelector: map[string]string{"pool": "storage", "zone": "a"},
+				ExportReplicas:      3,
+			},
+		},
+		{
+			name:    "invalid remote mount",
+			volCtx:  map[string]string{common.RemoteMountKey: "virtiofs", common.ExportReplicasKey: "0"},
+			wantErr: `invalid volume context: invalid values [juicefs/export-replicas="0": must be positive, juicefs/remote-mount="virtiofs": must be nfs]`,
+		},
+		{
+			name:    "invalid cache emptyDir",
+			volCtx:  map[string]string{common.CacheEmptyDir: "Memory:1Gi:2Gi"},
+			wantErr: `invalid volume context: invalid values [juicefs/mount-cache-emptydir="Memory:1Gi:2Gi": must be in format of <medium>[:<sizeLimit>]]`,
+		},
+		{
+			name:    "invalid ratio",
+			volCtx:  map[string]string{common.AuditSampleRateKey: "NaN"},
+			wantErr: `invalid volume context: invalid values [juicefs/audit-sample-rate="NaN": must be a number between 0 and 1]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			StrictVolumeContext = tt.rejectUnknown
+			defer func() { StrictVolumeContext = false }()
+			got, err := ParseVolumeContext(tt.volCtx, tt.strict)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
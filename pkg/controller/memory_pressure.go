@@ -0,0 +1,288 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/fuse/grace"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+const (
+	memoryPressureInterval = 30 * time.Second
+	// memory usage takes a while to settle after an action, no more action is taken in the meantime
+	memoryPressureCooldown = 2 * time.Minute
+	// default buffer-size of JuiceFS in MiB
+	defaultBufferSize = 300
+)
+
+var memoryPressureLog = klog.NewKlogr().WithName("memory-pressure")
+
+type nodeStatsGetter interface {
+	GetNodeRunningPods() (*corev1.PodList, error)
+	GetStatsSummary() (*k8sclient.StatsSummary, error)
+}
+
+// mountCandidate is a mount pod on the node, with the priority of the volume which is the highest priority
+// of the pods consuming it
+type mountCandidate struct {
+	pod         *corev1.Pod
+	consumers   []*corev1.Pod
+	priority    int32
+	workingSet  uint64
+	limit       int64
+	bufferSize  int64
+	approaching bool
+}
+
+// memoryPressureController relieves memory pressure caused by mount pods according to config.MemoryPressurePolicy:
+// mount pods of the lowest priority volumes are shrunk first, then the low priority pods consuming them are
+// evicted if the node is still under pressure, so that mount pods of critical workloads are not OOM killed at random.
+type memoryPressureController struct {
+	client     *k8sclient.K8sClient
+	kc         nodeStatsGetter
+	shrink     func(ctx context.Context, pod *corev1.Pod, bufferSize int64) error
+	now        func() time.Time
+	lastAction time.Time
+}
+
+func newMemoryPressureController(client *k8sclient.K8sClient, kc nodeStatsGetter) *memoryPressureController {
+	c := &memoryPressureController{client: client, kc: kc, now: time.Now}
+	c.shrink = c.shrinkBySmoothRecreate
+	return c
+}
+
+// run checks memory pressure every memoryPressureInterval until ctx is done
+func (c *memoryPressureController) run(ctx context.Context) {
+	ticker := time.NewTicker(memoryPressureInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// the policy is read every round since driver config is reloaded on change
+		policy := config.GlobalConfig.MemoryPressure
+		if policy == nil {
+			continue
+		}
+		roundCtx, cancel := context.WithTimeout(ctx, memoryPressureInterval)
+		if err := c.relieve(roundCtx, policy); err != nil {
+			memoryPressureLog.Error(err, "relieve memory pressure error")
+		}
+		cancel()
+	}
+}
+
+// relieve takes at most one action per round, the cooldown only starts after an action takes effect,
+// a failed one is retried in the next round
+func (c *memoryPressureController) relieve(ctx context.Context, policy *config.MemoryPressurePolicy) error {
+	if c.now().Sub(c.lastAction) < memoryPressureCooldown {
+		return nil
+	}
+	candidates, err := c.candidates(policy)
+	if err != nil {
+		return err
+	}
+	nodePressure, err := c.nodeUnderPressure(ctx)
+	if err != nil {
+		return err
+	}
+	pressure := nodePressure
+	for _, cand := range candidates {
+		pressure = pressure || cand.approaching
+	}
+	if !pressure {
+		return nil
+	}
+
+	if policy.ReducedBufferSize > 0 {
+		for _, cand := range candidates {
+			if !(nodePressure || cand.approaching) || cand.bufferSize <= policy.ReducedBufferSize {
+				continue
+			}
+			if ok, _, _ := resource.CanUpgrade(*cand.pod, true); !ok {
+				continue
+			}
+			memoryPressureLog.Info("shrink mount pod", "pod", cand.pod.Name, "priority", cand.priority,
+				"workingSet", cand.workingSet, "limit", cand.limit, "bufferSize", policy.ReducedBufferSize)
+			if err := c.shrink(ctx, cand.pod, policy.ReducedBufferSize); err != nil {
+				return fmt.Errorf("shrink mount pod %s error: %v", cand.pod.Name, err)
+			}
+			c.lastAction = c.now()
+			c.event(ctx, cand.pod, events.ReasonMemoryPressureShrink, fmt.Sprintf("Recreate to shrink buffer-size from %d MiB to %d MiB to relieve memory pressure", cand.bufferSize, policy.ReducedBufferSize))
+			return nil
+		}
+	}
+
+	if !nodePressure || policy.EvictBelowPriority == nil || len(candidates) == 0 {
+		return nil
+	}
+	highest := candidates[len(candidates)-1].priority
+	for _, cand := range candidates {
+		// pods of the highest priority on the node are never evicted for others
+		if cand.priority >= *policy.EvictBelowPriority || cand.priority >= highest || len(cand.consumers) == 0 {
+			continue
+		}
+		memoryPressureLog.Info("evict pods consuming mount pod", "pod", cand.pod.Name, "priority", cand.priority, "consumers", len(cand.consumers))
+		var errs []string
+		evicted := 0
+		for _, pod := range cand.consumers {
+			if err := c.client.CoreV1().Pods(pod.Namespace).EvictV1(ctx, &policyv1.Eviction{
+				ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+			}); err != nil {
+				errs = append(errs, fmt.Sprintf("%s/%s: %v", pod.Namespace, pod.Name, err))
+				continue
+			}
+			evicted++
+		}
+		// memory is released by the pods evicted, even if others are not
+		if evicted > 0 {
+			c.lastAction = c.now()
+			c.event(ctx, cand.pod, events.ReasonMemoryPressureEvict, fmt.Sprintf("Evict %d pods of priority %d consuming the volume to relieve memory pressure", evicted, cand.priority))
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("evict pods error: %s", strings.Join(errs, "; "))
+		}
+		return nil
+	}
+	return nil
+}
+
+// candidates returns the running mount pods on the node, sorted by priority and then working set in descending order
+func (c *memoryPressureController) candidates(policy *config.MemoryPressurePolicy) ([]*mountCandidate, error) {
+	podList, err := c.kc.GetNodeRunningPods()
+	if err != nil {
+		return nil, err
+	}
+	summary, err := c.kc.GetStatsSummary()
+	if err != nil {
+		return nil, err
+	}
+	workingSets := map[string]uint64{}
+	for _, s := range summary.Pods {
+		if s.Memory != nil && s.Memory.WorkingSetBytes != nil {
+			workingSets[s.PodRef.UID] = *s.Memory.WorkingSetBytes
+		}
+	}
+	pods := map[string]*corev1.Pod{}
+	for i := range podList.Items {
+		pods[string(podList.Items[i].UID)] = &podList.Items[i]
+	}
+
+	var candidates []*mountCandidate
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.Namespace != config.Namespace || pod.Labels[common.PodTypeKey] != common.PodTypeValue || pod.DeletionTimestamp != nil {
+			continue
+		}
+		cand := &mountCandidate{pod: pod, priority: math.MinInt32, workingSet: workingSets[string(pod.UID)], bufferSize: bufferSizeOf(pod)}
+		if len(pod.Spec.Containers) > 0 {
+			cand.limit = pod.Spec.Containers[0].Resources.Limits.Memory().Value()
+		}
+		cand.approaching = cand.limit > 0 && float64(cand.workingSet) >= policy.Ratio()*float64(cand.limit)
+		for k, target := range pod.Annotations {
+			if k != util.GetReferenceKey(target) {
+				continue
+			}
+			consumer, ok := pods[getPodUid(target)]
+			if !ok {
+				continue
+			}
+			cand.consumers = append(cand.consumers, consumer)
+			if p := priorityOf(consumer); p > cand.priority {
+				cand.priority = p
+			}
+		}
+		candidates = append(candidates, cand)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].workingSet > candidates[j].workingSet
+	})
+	return candidates, nil
+}
+
+func (c *memoryPressureController) nodeUnderPressure(ctx context.Context) (bool, error) {
+	node, err := c.client.GetNode(ctx, config.NodeName)
+	if err != nil {
+		return false, err
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeMemoryPressure {
+			return cond.Status == corev1.ConditionTrue, nil
+		}
+	}
+	return false, nil
+}
+
+// shrinkBySmoothRecreate recreates the mount pod with the reduced buffer-size, buffer-size can't be changed in a
+// running client. The FUSE connection is passed to the new mount pod so that the consuming pods are not affected,
+// but data in the buffer and the memory cache of the old client is dropped.
+func (c *memoryPressureController) shrinkBySmoothRecreate(ctx context.Context, pod *corev1.Pod, bufferSize int64) error {
+	if err := resource.AddPodAnnotation(ctx, c.client, pod.Name, pod.Namespace, map[string]string{
+		common.ShrunkBufferSizeKey: strconv.FormatInt(bufferSize, 10),
+	}); err != nil {
+		return err
+	}
+	return grace.TriggerShutdown(config.ShutdownSockPath, pod.Name, true)
+}
+
+func (c *memoryPressureController) event(ctx context.Context, pod *corev1.Pod, reason, message string) {
+	if err := events.NewRecorder(c.client).Event(ctx, pod, corev1.EventTypeWarning, reason, events.ActionRecover, message); err != nil {
+		memoryPressureLog.Error(err, "create event error", "pod", pod.Name)
+	}
+}
+
+func priorityOf(pod *corev1.Pod) int32 {
+	if pod.Spec.Priority == nil {
+		return 0
+	}
+	return *pod.Spec.Priority
+}
+
+// bufferSizeOf returns the buffer-size in MiB in the mount options of the mount pod
+func bufferSizeOf(pod *corev1.Pod) int64 {
+	for _, opt := range util.GetMountOptionsOfPod(pod) {
+		if k, v, found := strings.Cut(opt, "="); found && k == "buffer-size" {
+			if size, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return size
+			}
+		}
+	}
+	return defaultBufferSize
+}
@@ -0,0 +1,207 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+type fakeNodeStats struct {
+	pods    []corev1.Pod
+	summary k8sclient.StatsSummary
+}
+
+func (f *fakeNodeStats) GetNodeRunningPods() (*corev1.PodList, error) {
+	return &corev1.PodList{Items: f.pods}, nil
+}
+
+func (f *fakeNodeStats) GetStatsSummary() (*k8sclient.StatsSummary, error) {
+	return &f.summary, nil
+}
+
+func appPod(name string, priority int32) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name + "-uid")},
+		Spec:       corev1.PodSpec{Priority: &priority},
+	}
+}
+
+func memMountPod(name string, bufferSize string, consumers ...corev1.Pod) corev1.Pod {
+	annotations := map[string]string{}
+	for _, c := range consumers {
+		target := "/var/lib/kubelet/pods/" + string(c.UID) + "/volumes/kubernetes.io~csi/pv/mount"
+		annotations[util.GetReferenceKey(target)] = target
+	}
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   config.Namespace,
+			UID:         types.UID(name + "-uid"),
+			Labels:      map[string]string{common.PodTypeKey: common.PodTypeValue},
+			Annotations: annotations,
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Command: []string{"sh", "-c", "/bin/mount.juicefs redis://127.0.0.1/6379 /jfs/pv -o buffer-size=" + bufferSize},
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1000")},
+			},
+		}}},
+	}
+}
+
+func podStats(pod corev1.Pod, workingSet uint64) k8sclient.PodStats {
+	return k8sclient.PodStats{
+		PodRef: k8sclient.PodReference{Name: pod.Name, Namespace: pod.Namespace, UID: string(pod.UID)},
+		Memory: &k8sclient.MemoryStats{WorkingSetBytes: &workingSet},
+	}
+}
+
+func TestMemoryPressureController(t *testing.T) {
+	defer func(nodeName string) { config.NodeName = nodeName }(config.NodeName)
+	config.NodeName = "node-1"
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue},
+		}},
+	}
+	critical, batch := appPod("critical", 1000000), appPod("batch", 0)
+	criticalMount, batchMount := memMountPod("mount-critical", "300", critical), memMountPod("mount-batch", "300", batch)
+	stats := &fakeNodeStats{
+		pods:    []corev1.Pod{critical, batch, criticalMount, batchMount},
+		summary: k8sclient.StatsSummary{Pods: []k8sclient.PodStats{podStats(criticalMount, 950), podStats(batchMount, 500)}},
+	}
+	clientset := fake.NewSimpleClientset(node, &critical, &batch)
+	c := newMemoryPressureController(&k8sclient.K8sClient{Interface: clientset}, stats)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	var shrunk []string
+	var shrinkErr error
+	c.shrink = func(ctx context.Context, pod *corev1.Pod, bufferSize int64) error {
+		if shrinkErr != nil {
+			return shrinkErr
+		}
+		shrunk = append(shrunk, pod.Name)
+		return nil
+	}
+
+	candidates, err := c.candidates(&config.MemoryPressurePolicy{})
+	if err != nil || len(candidates) != 2 {
+		t.Fatalf("candidates() = %v, %v", candidates, err)
+	}
+	if candidates[0].pod.Name != "mount-batch" || candidates[0].priority != 0 || candidates[0].approaching {
+		t.Errorf("lowest priority candidate = %+v", candidates[0])
+	}
+	if candidates[1].pod.Name != "mount-critical" || !candidates[1].approaching || candidates[1].bufferSize != 300 {
+		t.Errorf("highest priority candidate = %+v", candidates[1])
+	}
+
+	// mount pods of low priority are shrunk first, they are not ready so can't be recreated smoothly
+	lowest := int32(1000)
+	policy := &config.MemoryPressurePolicy{ReducedBufferSize: 100, EvictBelowPriority: &lowest}
+	if err := c.relieve(context.TODO(), policy); err != nil {
+		t.Fatalf("relieve() error = %v", err)
+	}
+	if len(shrunk) != 0 {
+		t.Errorf("mount pods not ready should not be shrunk, got %v", shrunk)
+	}
+	evictions := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "create" && action.GetSubresource() == "eviction" {
+			evictions++
+			if name := action.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName(); name != "batch" {
+				t.Errorf("evicted pod = %s, want batch", name)
+			}
+		}
+	}
+	if evictions != 1 {
+		t.Errorf("evictions = %d, want 1", evictions)
+	}
+
+	// no action in cooldown
+	clientset.ClearActions()
+	if err := c.relieve(context.TODO(), policy); err != nil || len(clientset.Actions()) != 0 {
+		t.Errorf("relieve() in cooldown = %v, actions %v", err, clientset.Actions())
+	}
+
+	// shrink ready mount pods
+	now = now.Add(memoryPressureCooldown)
+	for i := range stats.pods {
+		if len(stats.pods[i].Spec.Containers) > 0 {
+			stats.pods[i].Labels[common.PodJuiceHashLabelKey] = "hash"
+			stats.pods[i].Spec.Containers[0].Image = "juicedata/mount:ce-v1.2.1"
+			stats.pods[i].Status.Conditions = []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+				{Type: corev1.ContainersReady, Status: corev1.ConditionTrue},
+			}
+		}
+	}
+	// a failed action doesn't start the cooldown
+	shrinkErr = errors.New("recreate failed")
+	if err := c.relieve(context.TODO(), policy); err == nil || !c.lastAction.Before(now) {
+		t.Errorf("relieve() = %v, lastAction %v", err, c.lastAction)
+	}
+	shrinkErr = nil
+	if err := c.relieve(context.TODO(), policy); err != nil {
+		t.Fatalf("relieve() error = %v", err)
+	}
+	if len(shrunk) != 1 || shrunk[0] != "mount-batch" {
+		t.Errorf("shrunk = %v, want [mount-batch]", shrunk)
+	}
+}
+
+func TestMemoryPressureControllerStop(t *testing.T) {
+	c := newMemoryPressureController(nil, &fakeNodeStats{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("run() doesn't return after ctx is done")
+	}
+}
+
+func TestBufferSizeOf(t *testing.T) {
+	pod := memMountPod("mount", "1024")
+	if got := bufferSizeOf(&pod); got != 1024 {
+		t.Errorf("bufferSizeOf() = %d", got)
+	}
+	pod.Spec.Containers[0].Command[2] = "/bin/mount.juicefs redis://127.0.0.1/6379 /jfs/pv -o foreground"
+	if got := bufferSizeOf(&pod); got != defaultBufferSize {
+		t.Errorf("bufferSizeOf() without option = %d", got)
+	}
+}
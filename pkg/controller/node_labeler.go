@@ -0,0 +1,122 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+const nodeLabelInterval = 30 * time.Second
+
+var nodeLabelLog = klog.NewKlogr().WithName("node-labeler")
+
+// NodeLabeler keeps the node labeled with juicefs.com/fs-<name>=mounted for each file system mounted by the running
+// mount pods on it, so that pods can prefer nodes where the cache of the file system is warm. The labels are removed
+// once the mount pods of the file system are gone.
+type NodeLabeler struct {
+	client *k8sclient.K8sClient
+}
+
+func NewNodeLabeler(client *k8sclient.K8sClient) *NodeLabeler {
+	return &NodeLabeler{client: client}
+}
+
+func (l *NodeLabeler) Run(ctx context.Context) {
+	ticker := time.NewTicker(nodeLabelInterval)
+	defer ticker.Stop()
+	for {
+		if err := l.sync(ctx); err != nil {
+			nodeLabelLog.Error(err, "sync node labels error", "node", config.NodeName)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *NodeLabeler) sync(ctx context.Context) error {
+	pods, err := l.client.ListPod(ctx, config.Namespace, &metav1.LabelSelector{
+		MatchLabels: map[string]string{common.PodTypeKey: common.PodTypeValue},
+	}, &fields.Set{"spec.nodeName": config.NodeName})
+	if err != nil {
+		return err
+	}
+	mounted := map[string]bool{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != config.NodeName || pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		// mount pods created by older versions have no file system name
+		if key := nodeFsLabel(pod.Annotations[common.FsNameKey]); key != "" {
+			mounted[key] = true
+		}
+	}
+
+	node, err := l.client.GetNode(ctx, config.NodeName)
+	if err != nil {
+		return err
+	}
+	labels := map[string]interface{}{}
+	for key := range mounted {
+		if node.Labels[key] != common.NodeFsLabelValue {
+			labels[key] = common.NodeFsLabelValue
+		}
+	}
+	for key := range node.Labels {
+		if strings.HasPrefix(key, common.NodeFsLabelPrefix) && !mounted[key] {
+			labels[key] = nil
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	nodeLabelLog.Info("update node labels", "node", config.NodeName, "labels", labels)
+	data, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"labels": labels}})
+	if err != nil {
+		return err
+	}
+	_, err = l.client.CoreV1().Nodes().Patch(ctx, config.NodeName, types.MergePatchType, data, metav1.PatchOptions{})
+	return err
+}
+
+// nodeFsLabel returns the node label of the file system, or "" if the name can't be used in a label key
+func nodeFsLabel(fsName string) string {
+	if fsName == "" {
+		return ""
+	}
+	key := common.NodeFsLabelPrefix + fsName
+	if len(validation.IsQualifiedName(key)) != 0 {
+		return ""
+	}
+	return key
+}
@@ -0,0 +1,84 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestNodeLabeler(t *testing.T) {
+	defer func(nodeName string) { config.NodeName = nodeName }(config.NodeName)
+	config.NodeName = "node-1"
+	mountPod := func(name, nodeName, fsName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   config.Namespace,
+				Labels:      map[string]string{common.PodTypeKey: common.PodTypeValue},
+				Annotations: map[string]string{common.FsNameKey: fsName},
+			},
+			Spec:   corev1.PodSpec{NodeName: nodeName},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{
+		"kubernetes.io/hostname":                   "node-1",
+		common.NodeFsLabelPrefix + "unmounted":     common.NodeFsLabelValue,
+		common.NodeFsLabelPrefix + "already-there": common.NodeFsLabelValue,
+	}}}
+	clientset := fake.NewSimpleClientset(node,
+		mountPod("mount-a", "node-1", "already-there"),
+		mountPod("mount-b", "node-1", "myjfs"),
+		mountPod("mount-c", "node-2", "other"),
+		mountPod("mount-d", "node-1", strings.Repeat("x", 64)),
+	)
+	l := NewNodeLabeler(&k8sclient.K8sClient{Interface: clientset})
+	if err := l.sync(context.TODO()); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+	got, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "node-1", metav1.GetOptions{})
+	want := map[string]string{
+		"kubernetes.io/hostname":                   "node-1",
+		common.NodeFsLabelPrefix + "already-there": common.NodeFsLabelValue,
+		common.NodeFsLabelPrefix + "myjfs":         common.NodeFsLabelValue,
+	}
+	if !reflect.DeepEqual(got.Labels, want) {
+		t.Errorf("node labels = %v, want %v", got.Labels, want)
+	}
+
+	// nothing to patch when labels are up to date
+	clientset.ClearActions()
+	if err := l.sync(context.TODO()); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("unexpected patch %v", action)
+		}
+	}
+}
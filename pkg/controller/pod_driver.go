@@ -24,7 +24,6 @@ import (
 	"runtime"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -137,6 +136,9 @@ func (p *PodDriver) Run(ctx context.Context, current *corev1.Pod) (Result, error
 	ctxWithLog := util.WithLog(ctx, log)
 	ps := getPodStatus(current)
 	log.V(1).Info("start handle pod", "namespace", current.Namespace, "status", ps)
+	if isStaleMountPod(current) {
+		return p.staleMountPodHandler(ctxWithLog, current)
+	}
 	// check refs in mount pod annotation first, delete ref that target pod is not found
 	err := p.checkAnnotations(ctxWithLog, current)
 	if err != nil {
@@ -160,6 +162,31 @@ func (p *PodDriver) Run(ctx context.Context, current *corev1.Pod) (Result, error
 	return p.handlers[getPodStatus(pod)](ctxWithLog, pod)
 }
 
+// isStaleMountPod checks if the mount pod is created on a previous node with the same name,
+// which is deleted and recreated, e.g. by cloud autoscaling. Mount pods created before node UID
+// is recorded are regarded as stale if they are older than the node.
+func isStaleMountPod(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || config.NodeUID == "" {
+		return false
+	}
+	if uid, ok := pod.Annotations[common.NodeUIDKey]; ok {
+		return uid != config.NodeUID
+	}
+	return !config.NodeCreationTime.IsZero() && pod.CreationTimestamp.Time.Before(config.NodeCreationTime)
+}
+
+// staleMountPodHandler deletes the stale mount pod, a new one is created for its references when it's being deleted
+func (p *PodDriver) staleMountPodHandler(ctx context.Context, pod *corev1.Pod) (Result, error) {
+	log := util.GenLog(ctx, podDriverLog, "staleMountPodHandler")
+	log.Info("mount pod is created on a previous node with the same name, recreate it",
+		"nodeUID", pod.Annotations[common.NodeUIDKey], "currentNodeUID", config.NodeUID)
+	if err := p.Client.DeletePod(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "delete stale mount pod error")
+		return Result{}, err
+	}
+	return Result{RequeueImmediately: true}, nil
+}
+
 // getPodStatus get pod status
 func getPodStatus(pod *corev1.Pod) podStatus {
 	if pod == nil {
@@ -258,6 +285,9 @@ func (p *PodDriver) checkAnnotations(ctx context.Context, pod *corev1.Pod) error
 			if err := p.Client.DeleteSecret(ctx, secretName, pod.Namespace); !apierrors.IsNotFound(err) && err != nil {
 				log.V(1).Info("Delete secret error", "secretName", secretName)
 			}
+			if err := builder.RemoveMountPodExternalSecrets(ctx, p.Client, pod); err != nil {
+				log.Error(err, "Remove external secrets of pod error")
+			}
 			// return conflict if pod is deleted here
 			return apierrors.NewConflict(schema.GroupResource{
 				Group:    pod.GroupVersionKind().Group,
@@ -897,7 +927,7 @@ func (p *PodDriver) applyConfigPatch(ctx context.Context, pod *corev1.Pod) error
 		if setting.HashVal != pod.Labels[common.PodJuiceHashLabelKey] {
 			// update secret
 			secret := podBuilder.NewSecret()
-			if err := resource.CreateOrUpdateSecret(ctx, p.Client, &secret); err != nil {
+			if err := builder.SaveSecret(ctx, p.Client, setting, &secret); err != nil {
 				return err
 			}
 		}
@@ -938,7 +968,7 @@ func (p *PodDriver) applyConfigPatch(ctx context.Context, pod *corev1.Pod) error
 		setting.SecretName = fmt.Sprintf("juicefs-%s-secret", pod.Labels[common.PodUniqueIdLabelKey])
 		r := builder.NewPodBuilder(setting, 0)
 		secret := r.NewSecret()
-		if err := resource.CreateOrUpdateSecret(ctx, p.Client, &secret); err != nil {
+		if err := builder.SaveSecret(ctx, p.Client, setting, &secret); err != nil {
 			return err
 		}
 	}
@@ -1014,21 +1044,7 @@ func (p *PodDriver) DoAbortFuse(mountpod *corev1.Pod, devMinor uint32) error {
 	}
 	supFusePass := util.SupportFusePass(mountpod.Spec.Containers[0].Image)
 	if supFusePass {
-		err = util.DoWithTimeout(context.Background(), defaultCheckoutTimeout, func(ctx context.Context) error {
-			finfo, err := os.Stat(mntPath)
-			if err != nil {
-				return err
-			}
-			if st, ok := finfo.Sys().(*syscall.Stat_t); ok {
-				if st.Ino == 1 {
-					return nil
-				} else {
-					return fmt.Errorf("mount point is not fuse mount")
-				}
-			}
-			return err
-		})
-		if err == nil {
+		if err := util.CheckFuseMount(context.Background(), mntPath, defaultCheckoutTimeout); err == nil {
 			log.Info("mount point is normal, don't need to abort fuse connection")
 			return nil
 		}
@@ -1137,9 +1153,21 @@ func (p *PodDriver) newMountPod(ctx context.Context, pod *corev1.Pod, newPodName
 		Spec: pod.Spec,
 	}
 	controllerutil.AddFinalizer(newPod, common.Finalizer)
+	if config.NodeUID != "" {
+		newPod.Annotations[common.NodeUIDKey] = config.NodeUID
+	}
 	if err := p.applyConfigPatch(ctx, newPod); err != nil {
 		log.Error(err, "apply config patch error, will ignore")
 	}
+	if bufferSize := pod.Annotations[common.ShrunkBufferSizeKey]; bufferSize != "" {
+		// recreated to relieve memory pressure
+		log.Info("shrink buffer-size of mount pod", "bufferSize", bufferSize)
+		resource.SetMountOption(newPod, "buffer-size", bufferSize)
+		if newPod.Annotations == nil {
+			newPod.Annotations = map[string]string{}
+		}
+		newPod.Annotations[common.ShrunkBufferSizeKey] = bufferSize
+	}
 	newSupportFusePass := util.SupportFusePass(newPod.Spec.Containers[0].Image)
 	if !util.SupportFusePass(newPod.Spec.Containers[0].Image) {
 		if oldSupportFusePass {
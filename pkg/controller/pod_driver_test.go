@@ -39,6 +39,7 @@ import (
 	"k8s.io/utils/mount"
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/driver/mocks"
 	"github.com/juicedata/juicefs-csi-driver/pkg/fuse/passfd"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
@@ -454,6 +455,57 @@ func TestPodDriver_getPodStatus(t *testing.T) {
 	}
 }
 
+func TestPodDriver_staleMountPod(t *testing.T) {
+	defer func() {
+		config.NodeUID, config.NodeCreationTime = "", time.Time{}
+	}()
+	nodeCreated := time.Now()
+	newPod := func(name, nodeUID string, created time.Time) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "kube-system",
+			CreationTimestamp: metav1.NewTime(created),
+			Annotations:       map[string]string{},
+		}}
+		if nodeUID != "" {
+			pod.Annotations[common.NodeUIDKey] = nodeUID
+		}
+		return pod
+	}
+	tests := []struct {
+		name    string
+		nodeUID string
+		pod     *corev1.Pod
+		want    bool
+	}{
+		{name: "node uid unknown", pod: newPod("a", "old", nodeCreated), want: false},
+		{name: "same node", nodeUID: "new", pod: newPod("b", "new", nodeCreated.Add(-time.Hour)), want: false},
+		{name: "previous node", nodeUID: "new", pod: newPod("c", "old", nodeCreated.Add(time.Hour)), want: true},
+		{name: "no uid, created after node", nodeUID: "new", pod: newPod("d", "", nodeCreated.Add(time.Minute)), want: false},
+		{name: "no uid, created before node", nodeUID: "new", pod: newPod("e", "", nodeCreated.Add(-time.Minute)), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.NodeUID, config.NodeCreationTime = tt.nodeUID, nodeCreated
+			if got := isStaleMountPod(tt.pod); got != tt.want {
+				t.Errorf("isStaleMountPod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	config.NodeUID = "new"
+	stale := newPod("stale", "old", nodeCreated)
+	client := &k8sclient.K8sClient{Interface: fake.NewSimpleClientset(stale)}
+	d := NewPodDriver(client, mount.SafeFormatAndMount{}, nil)
+	result, err := d.Run(context.TODO(), stale)
+	if err != nil || !result.RequeueImmediately {
+		t.Errorf("Run() with stale pod = %v, %v", result, err)
+	}
+	if _, err := client.GetPod(context.TODO(), "stale", "kube-system"); !apierrors.IsNotFound(err) {
+		t.Errorf("stale mount pod should be deleted, got %v", err)
+	}
+}
+
 func copyPod(oldPod *corev1.Pod) *corev1.Pod {
 	var newPod = corev1.Pod{}
 	newPod.ObjectMeta = oldPod.ObjectMeta
@@ -49,7 +49,9 @@ type PodReconciler struct {
 	*k8sclient.K8sClient
 }
 
-func StartReconciler() error {
+// StartReconciler starts polling kubelet to reconcile mount pods on the node, and relieving memory pressure
+// of the node until ctx is done
+func StartReconciler(ctx context.Context) error {
 	// gen kubelet client
 	port, err := strconv.Atoi(config.KubeletPort)
 	if err != nil {
@@ -74,6 +76,7 @@ func StartReconciler() error {
 	}
 
 	go doReconcile(k8sClient, kc)
+	go newMemoryPressureController(k8sClient, kc).run(ctx)
 	return nil
 }
 
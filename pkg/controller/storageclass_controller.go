@@ -0,0 +1,247 @@
+/*
+ Copyright 2024 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var scCtrlLog = klog.NewKlogr().WithName("storageclass-controller")
+
+const (
+	// scInUseRequeue how often a StorageClass being deleted is checked again while PVs are still provisioned from it
+	scInUseRequeue = time.Minute
+	// pvStorageClassIndex indexes cached PVs by the StorageClass they are provisioned from
+	pvStorageClassIndex = "spec.storageClassName"
+)
+
+// StorageClassController holds the deletion of juicefs StorageClasses with a finalizer until all PVs provisioned
+// from them are deleted, since the provisioner needs their secrets to delete volumes, and resizing requires them.
+// Parameters of the StorageClass are kept on its PVs, so that the volumes can still be expanded and mounted if it's
+// deleted anyway.
+type StorageClassController struct {
+	*k8sclient.K8sClient
+	// pvs reads PVs from the cache of the manager, indexed by pvStorageClassIndex
+	pvs ctrlclient.Reader
+}
+
+func NewStorageClassController(client *k8sclient.K8sClient) *StorageClassController {
+	return &StorageClassController{K8sClient: client}
+}
+
+func (m *StorageClassController) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	scCtrlLog.V(1).Info("Receive storageclass", "name", request.Name)
+	sc, err := m.GetStorageClass(ctx, request.Name)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		scCtrlLog.Error(err, "Failed to get storageclass", "name", request.Name)
+		return reconcile.Result{}, err
+	}
+	if sc.Provisioner != config.DriverName {
+		return reconcile.Result{}, nil
+	}
+
+	pvs, err := m.provisionedPVs(ctx, sc.Name)
+	if err != nil {
+		scCtrlLog.Error(err, "Failed to list pvs", "storageclass", sc.Name)
+		return reconcile.Result{}, err
+	}
+	for _, pv := range pvs {
+		if err := m.keepParameters(ctx, sc, &pv); err != nil {
+			scCtrlLog.Error(err, "Failed to keep parameters of storageclass on pv", "storageclass", sc.Name, "pv", pv.Name)
+			return reconcile.Result{}, err
+		}
+	}
+
+	if sc.DeletionTimestamp == nil {
+		if controllerutil.AddFinalizer(sc, common.StorageClassFinalizer) {
+			scCtrlLog.Info("Add finalizer to storageclass", "name", sc.Name)
+			return reconcile.Result{}, m.UpdateStorageClass(ctx, sc)
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if len(pvs) != 0 {
+		names := make([]string, 0, len(pvs))
+		for _, pv := range pvs {
+			names = append(names, pv.Name)
+		}
+		sort.Strings(names)
+		scCtrlLog.Info("Storageclass is being deleted but still in use", "name", sc.Name, "pvs", names)
+		if err := events.NewRecorder(m.K8sClient).Eventf(ctx, sc, corev1.EventTypeWarning, events.ReasonStorageClassInUse, events.ActionProvision,
+			"StorageClass is being deleted, but %d PVs are still provisioned from it: %s", len(names), strings.Join(names, ", ")); err != nil {
+			scCtrlLog.Error(err, "Failed to record event", "storageclass", sc.Name)
+		}
+		return reconcile.Result{RequeueAfter: scInUseRequeue}, nil
+	}
+	if controllerutil.RemoveFinalizer(sc, common.StorageClassFinalizer) {
+		scCtrlLog.Info("No pv is provisioned from storageclass, remove its finalizer", "name", sc.Name)
+		return reconcile.Result{}, m.UpdateStorageClass(ctx, sc)
+	}
+	return reconcile.Result{}, nil
+}
+
+// provisionedPVs returns the juicefs PVs provisioned from the StorageClass, including those being deleted,
+// whose volumes are yet to be deleted by the provisioner
+func (m *StorageClassController) provisionedPVs(ctx context.Context, scName string) ([]corev1.PersistentVolume, error) {
+	pvs := &corev1.PersistentVolumeList{}
+	if err := m.pvs.List(ctx, pvs, ctrlclient.MatchingFields{pvStorageClassIndex: scName}); err != nil {
+		return nil, err
+	}
+	var result []corev1.PersistentVolume
+	for _, pv := range pvs.Items {
+		if isJuiceFSPV(&pv) && pv.Spec.StorageClassName == scName {
+			result = append(result, pv)
+		}
+	}
+	return result, nil
+}
+
+// keepParameters records the parameters of the StorageClass on the PV, parameters of StorageClasses are immutable,
+// so it's done only once
+func (m *StorageClassController) keepParameters(ctx context.Context, sc *storagev1.StorageClass, pv *corev1.PersistentVolume) error {
+	if _, ok := pv.Annotations[common.StorageClassParametersKey]; ok {
+		return nil
+	}
+	params, err := json.Marshal(sc.Parameters)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{common.StorageClassParametersKey: string(params)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	scCtrlLog.V(1).Info("Keep parameters of storageclass on pv", "storageclass", sc.Name, "pv", pv.Name)
+	return m.PatchPersistentVolume(ctx, pv.Name, patch, types.MergePatchType)
+}
+
+func isJuiceFSPV(pv *corev1.PersistentVolume) bool {
+	return pv.Spec.CSI != nil && pv.Spec.CSI.Driver == config.DriverName
+}
+
+func indexPVByStorageClass(obj ctrlclient.Object) []string {
+	pv, ok := obj.(*corev1.PersistentVolume)
+	if !ok || pv.Spec.StorageClassName == "" {
+		return nil
+	}
+	return []string{pv.Spec.StorageClassName}
+}
+
+// ReleaseStorageClasses removes the finalizer from juicefs StorageClasses after --storageclass-protection is turned
+// off, otherwise they could never be deleted
+func ReleaseStorageClasses(ctx context.Context, client *k8sclient.K8sClient) error {
+	scs, err := client.ListStorageClasses(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range scs {
+		sc := &scs[i]
+		if sc.Provisioner != config.DriverName || !controllerutil.ContainsFinalizer(sc, common.StorageClassFinalizer) {
+			continue
+		}
+		err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+			latest, err := client.GetStorageClass(ctx, sc.Name)
+			if err != nil {
+				return err
+			}
+			if !controllerutil.RemoveFinalizer(latest, common.StorageClassFinalizer) {
+				return nil
+			}
+			return client.UpdateStorageClass(ctx, latest)
+		})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("remove finalizer %s of storageclass %s: %v", common.StorageClassFinalizer, sc.Name, err)
+		}
+		scCtrlLog.Info("Storageclass protection is off, finalizer removed", "name", sc.Name)
+	}
+	return nil
+}
+
+func (m *StorageClassController) SetupWithManager(mgr ctrl.Manager) error {
+	scCtrlLog.V(1).Info("SetupWithManager", "name", "storageclass-controller")
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.PersistentVolume{}, pvStorageClassIndex, indexPVByStorageClass); err != nil {
+		return err
+	}
+	m.pvs = mgr.GetClient()
+	c, err := controller.New("storageclass", mgr, controller.Options{Reconciler: m})
+	if err != nil {
+		return err
+	}
+
+	if err := c.Watch(source.Kind(mgr.GetCache(), &storagev1.StorageClass{}, &handler.TypedEnqueueRequestForObject[*storagev1.StorageClass]{}, predicate.TypedFuncs[*storagev1.StorageClass]{
+		CreateFunc: func(event event.TypedCreateEvent[*storagev1.StorageClass]) bool {
+			return event.Object.Provisioner == config.DriverName
+		},
+		UpdateFunc: func(updateEvent event.TypedUpdateEvent[*storagev1.StorageClass]) bool {
+			scNew, scOld := updateEvent.ObjectNew, updateEvent.ObjectOld
+			if scNew.GetResourceVersion() == scOld.GetResourceVersion() {
+				return false
+			}
+			return scNew.Provisioner == config.DriverName
+		},
+		DeleteFunc: func(deleteEvent event.TypedDeleteEvent[*storagev1.StorageClass]) bool {
+			return false
+		},
+	})); err != nil {
+		return err
+	}
+
+	// PVs are created and deleted for the StorageClass, keep its parameters on new PVs, and release it once the last one is deleted
+	return c.Watch(source.Kind(mgr.GetCache(), &corev1.PersistentVolume{}, handler.TypedEnqueueRequestsFromMapFunc(
+		func(ctx context.Context, pv *corev1.PersistentVolume) []reconcile.Request {
+			if !isJuiceFSPV(pv) || pv.Spec.StorageClassName == "" {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: pv.Spec.StorageClassName}}}
+		}), predicate.TypedFuncs[*corev1.PersistentVolume]{
+		UpdateFunc: func(updateEvent event.TypedUpdateEvent[*corev1.PersistentVolume]) bool {
+			return false
+		},
+	}))
+}
@@ -0,0 +1,136 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+func TestStorageClassController(t *testing.T) {
+	ctx := context.TODO()
+	sc := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "juicefs-sc"},
+		Provisioner: config.DriverName,
+		Parameters:  map[string]string{common.ProvisionerSecretName: "juicefs-secret"},
+	}
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-a"},
+		Spec: corev1.PersistentVolumeSpec{
+			StorageClassName: "juicefs-sc",
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: config.DriverName, VolumeHandle: "pvc-a"},
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(sc, pv)
+	m := NewStorageClassController(&k8sclient.K8sClient{Interface: clientset})
+	// the cache of PVs, which would be kept in sync by the manager
+	m.pvs = crfake.NewClientBuilder().WithObjects(pv.DeepCopy()).
+		WithIndex(&corev1.PersistentVolume{}, pvStorageClassIndex, indexPVByStorageClass).Build()
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: sc.Name}}
+
+	// finalizer added and parameters kept
+	if _, err := m.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	got, _ := clientset.StorageV1().StorageClasses().Get(ctx, sc.Name, metav1.GetOptions{})
+	if !controllerutil.ContainsFinalizer(got, common.StorageClassFinalizer) {
+		t.Errorf("finalizers = %v, want %s", got.Finalizers, common.StorageClassFinalizer)
+	}
+	gotPV, _ := clientset.CoreV1().PersistentVolumes().Get(ctx, pv.Name, metav1.GetOptions{})
+	params, err := resource.KeptStorageClassParameters(gotPV)
+	if err != nil || params[common.ProvisionerSecretName] != "juicefs-secret" {
+		t.Errorf("kept parameters = %v, %v", params, err)
+	}
+
+	// deletion held while the pv exists
+	now := metav1.Now()
+	got.DeletionTimestamp = &now
+	if _, err := clientset.StorageV1().StorageClasses().Update(ctx, got, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.Reconcile(ctx, request)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != scInUseRequeue {
+		t.Errorf("RequeueAfter = %v, want %v", result.RequeueAfter, scInUseRequeue)
+	}
+	got, _ = clientset.StorageV1().StorageClasses().Get(ctx, sc.Name, metav1.GetOptions{})
+	if !controllerutil.ContainsFinalizer(got, common.StorageClassFinalizer) {
+		t.Errorf("finalizer removed while pv %s exists", pv.Name)
+	}
+	evts, _ := clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{})
+	if len(evts.Items) != 1 || evts.Items[0].Reason != "StorageClassInUse" {
+		t.Errorf("events = %v, want one StorageClassInUse", evts.Items)
+	}
+
+	// released once the pv is deleted
+	if err := clientset.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.pvs.(ctrlclient.Client).Delete(ctx, pv); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	got, _ = clientset.StorageV1().StorageClasses().Get(ctx, sc.Name, metav1.GetOptions{})
+	if controllerutil.ContainsFinalizer(got, common.StorageClassFinalizer) {
+		t.Errorf("finalizers = %v, want none", got.Finalizers)
+	}
+}
+
+func TestReleaseStorageClasses(t *testing.T) {
+	ctx := context.TODO()
+	held := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "juicefs-sc", Finalizers: []string{common.StorageClassFinalizer, "other"}},
+		Provisioner: config.DriverName,
+	}
+	other := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "other-sc", Finalizers: []string{common.StorageClassFinalizer}},
+		Provisioner: "other.csi.example.com",
+	}
+	clientset := fake.NewSimpleClientset(held, other)
+	if err := ReleaseStorageClasses(ctx, &k8sclient.K8sClient{Interface: clientset}); err != nil {
+		t.Fatalf("ReleaseStorageClasses() error = %v", err)
+	}
+	got, _ := clientset.StorageV1().StorageClasses().Get(ctx, held.Name, metav1.GetOptions{})
+	if len(got.Finalizers) != 1 || got.Finalizers[0] != "other" {
+		t.Errorf("finalizers of %s = %v, want [other]", held.Name, got.Finalizers)
+	}
+	got, _ = clientset.StorageV1().StorageClasses().Get(ctx, other.Name, metav1.GetOptions{})
+	if len(got.Finalizers) != 1 {
+		t.Errorf("finalizers of %s = %v, want unchanged", other.Name, got.Finalizers)
+	}
+}
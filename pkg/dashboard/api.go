@@ -111,6 +111,7 @@ func (api *API) Handle(group *gin.RouterGroup) {
 	pvcGroup.GET("/", api.getPVCHandler())
 	pvcGroup.GET("/uniqueid", api.getPVCWithPVHandler())
 	pvcGroup.GET("/mountpods", api.getMountPodsOfPVC())
+	pvcGroup.GET("/mountpods/logs", api.getMountPodLogsOfPVC())
 	pvcGroup.GET("/events", api.getPVCEvents())
 
 	scGroup := group.Group("/storageclass/:name", api.getSCMiddileware())
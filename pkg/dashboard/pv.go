@@ -520,37 +520,82 @@ func (api *API) getMountPodsOfPV() gin.HandlerFunc {
 
 func (api *API) getMountPodsOfPVC() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		obj, ok := c.Get("pvc")
+		pods, ok := api.listMountPodsOfPVC(c)
 		if !ok {
-			c.String(404, "not found")
 			return
 		}
-		pvc := obj.(*corev1.PersistentVolumeClaim)
-		if pvc.Spec.VolumeName == "" {
-			c.String(404, "not found")
+		c.IndentedJSON(200, pods)
+	}
+}
+
+// getMountPodLogsOfPVC returns the recent logs of the mount pods serving the PVC, keyed by the name of mount pod.
+// Use the websocket api of pod logs to follow the logs of one mount pod.
+func (api *API) getMountPodLogsOfPVC() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pods, ok := api.listMountPodsOfPVC(c)
+		if !ok {
 			return
 		}
-		pvName := pvc.Spec.VolumeName
-		var pv corev1.PersistentVolume
-		if err := api.cachedReader.Get(c, types.NamespacedName{Name: pvName}, &pv); err != nil {
-			if k8serrors.IsNotFound(err) {
-				c.String(404, "not found")
-			} else {
-				c.String(500, "get pv %s error %v", pvName, err)
+		tailLines := int64(100)
+		if tail := c.Query("tail"); tail != "" {
+			var err error
+			if tailLines, err = strconv.ParseInt(tail, 10, 64); err != nil {
+				c.String(400, "invalid tail %s", tail)
+				return
 			}
-			return
 		}
+		nodeName := c.Query("node")
+		logs := make(map[string]string)
+		for _, pod := range pods {
+			if nodeName != "" && pod.Spec.NodeName != nodeName {
+				continue
+			}
+			opts := &corev1.PodLogOptions{Container: common.MountContainerName}
+			if tailLines > 0 {
+				opts.TailLines = &tailLines
+			}
+			podLogs, err := api.client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).DoRaw(c)
+			if err != nil {
+				c.String(500, "get logs of mount pod %s: %v", pod.Name, err)
+				return
+			}
+			logs[pod.Name] = string(podLogs)
+		}
+		c.IndentedJSON(200, logs)
+	}
+}
 
-		var pods corev1.PodList
-		err := api.cachedReader.List(c, &pods, &client.ListOptions{
-			LabelSelector: LabelSelectorOfMount(pv),
-		})
-		if err != nil {
-			c.String(500, "list pods error %v", err)
-			return
+func (api *API) listMountPodsOfPVC(c *gin.Context) ([]corev1.Pod, bool) {
+	obj, ok := c.Get("pvc")
+	if !ok {
+		c.String(404, "not found")
+		return nil, false
+	}
+	pvc := obj.(*corev1.PersistentVolumeClaim)
+	if pvc.Spec.VolumeName == "" {
+		c.String(404, "not found")
+		return nil, false
+	}
+	pvName := pvc.Spec.VolumeName
+	var pv corev1.PersistentVolume
+	if err := api.cachedReader.Get(c, types.NamespacedName{Name: pvName}, &pv); err != nil {
+		if k8serrors.IsNotFound(err) {
+			c.String(404, "not found")
+		} else {
+			c.String(500, "get pv %s error %v", pvName, err)
 		}
-		c.IndentedJSON(200, pods.Items)
+		return nil, false
+	}
+
+	var pods corev1.PodList
+	err := api.cachedReader.List(c, &pods, &client.ListOptions{
+		LabelSelector: LabelSelectorOfMount(pv),
+	})
+	if err != nil {
+		c.String(500, "list pods error %v", err)
+		return nil, false
 	}
+	return pods.Items, true
 }
 
 func (api *API) getPVOfSC() gin.HandlerFunc {
@@ -0,0 +1,331 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+const (
+	nodeDaemonSet         = "juicefs-csi-node"
+	controllerStatefulSet = "juicefs-csi-controller"
+	webhookPrefix         = "juicefs-admission"
+)
+
+// checkRBAC checks the service accounts of CSI Node and CSI Controller have the permissions they require
+func checkRBAC(ctx context.Context, client *k8sclient.K8sClient, opts Options) []Result {
+	var results []Result
+	components := []struct {
+		name      string
+		component string
+		podSpec   func() (*corev1.PodSpec, error)
+	}{
+		{nodeDaemonSet, k8sclient.ComponentNode, func() (*corev1.PodSpec, error) {
+			ds, err := client.GetDaemonSet(ctx, nodeDaemonSet, opts.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			return &ds.Spec.Template.Spec, nil
+		}},
+		{controllerStatefulSet, k8sclient.ComponentController, func() (*corev1.PodSpec, error) {
+			sts, err := client.GetStatefulSet(ctx, controllerStatefulSet, opts.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			return &sts.Spec.Template.Spec, nil
+		}},
+	}
+	for _, c := range components {
+		result := Result{Check: "rbac", Target: c.name}
+		spec, err := c.podSpec()
+		if err != nil {
+			result.Status, result.Message = StatusSkipped, err.Error()
+			if !k8serrors.IsNotFound(err) {
+				result.Status = StatusFailed
+			}
+			results = append(results, result)
+			continue
+		}
+		sa := spec.ServiceAccountName
+		if sa == "" {
+			sa = spec.DeprecatedServiceAccount
+		}
+		if sa == "" {
+			sa = "default"
+		}
+		user := fmt.Sprintf("system:serviceaccount:%s:%s", opts.Namespace, sa)
+		// optional features are not known here, only the permissions required by all the deployments are checked
+		perms, err := k8sclient.RequiredPermissions(c.component, k8sclient.Features{})
+		if err != nil {
+			result.Status, result.Message = StatusFailed, err.Error()
+			results = append(results, result)
+			continue
+		}
+		var denied []string
+	check:
+		for _, p := range perms {
+			for _, verb := range p.Verbs {
+				allowed, err := canI(ctx, client, user, opts.Namespace, p, verb)
+				if err != nil {
+					result.Status, result.Message = StatusFailed, fmt.Sprintf("check permissions of %s error: %v", user, err)
+					break check
+				}
+				if !allowed {
+					denied = append(denied, k8sclient.Permission{Group: p.Group, Resource: p.Resource, Subresource: p.Subresource, Verbs: []string{verb}}.String())
+				}
+			}
+		}
+		if result.Status == "" {
+			if len(denied) > 0 {
+				result.Status, result.Message = StatusFailed, fmt.Sprintf("%s can't %s", user, strings.Join(denied, ", "))
+			} else {
+				result.Status, result.Message = StatusOK, user
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func canI(ctx context.Context, client *k8sclient.K8sClient, user, namespace string, p k8sclient.Permission, verb string) (bool, error) {
+	attrs := &authorizationv1.ResourceAttributes{
+		Group:       p.Group,
+		Resource:    p.Resource,
+		Subresource: p.Subresource,
+		Verb:        verb,
+	}
+	if p.Namespaced {
+		attrs.Namespace = namespace
+	}
+	sar, err := client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               user,
+			Groups:             []string{"system:serviceaccounts", "system:serviceaccounts:" + namespace, "system:authenticated"},
+			ResourceAttributes: attrs,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	return sar.Status.Allowed, nil
+}
+
+// checkWebhooks checks the services of the webhooks of CSI Driver have ready endpoints, and are reachable if
+// the command runs in the cluster
+func checkWebhooks(ctx context.Context, client *k8sclient.K8sClient, opts Options) []Result {
+	type webhook struct {
+		name   string
+		config admissionregistrationv1.WebhookClientConfig
+	}
+	var webhooks []webhook
+	mutating, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return []Result{{Check: "webhook", Status: StatusFailed, Message: err.Error()}}
+	}
+	for _, c := range mutating.Items {
+		for _, w := range c.Webhooks {
+			if strings.HasPrefix(c.Name, webhookPrefix) {
+				webhooks = append(webhooks, webhook{c.Name + "/" + w.Name, w.ClientConfig})
+			}
+		}
+	}
+	validating, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return []Result{{Check: "webhook", Status: StatusFailed, Message: err.Error()}}
+	}
+	for _, c := range validating.Items {
+		for _, w := range c.Webhooks {
+			if strings.HasPrefix(c.Name, webhookPrefix) {
+				webhooks = append(webhooks, webhook{c.Name + "/" + w.Name, w.ClientConfig})
+			}
+		}
+	}
+	if len(webhooks) == 0 {
+		return []Result{{Check: "webhook", Status: StatusSkipped, Message: "webhook is not enabled"}}
+	}
+
+	var results []Result
+	for _, w := range webhooks {
+		result := Result{Check: "webhook", Target: w.name}
+		svc := w.config.Service
+		switch {
+		case len(w.config.CABundle) == 0 || string(w.config.CABundle) == "CA_BUNDLE":
+			result.Status, result.Message = StatusFailed, "caBundle is not set"
+		case svc == nil:
+			result.Status, result.Message = StatusSkipped, "webhook is not served by a service"
+		default:
+			port := int32(443)
+			if svc.Port != nil {
+				port = *svc.Port
+			}
+			result.Status, result.Message = checkService(ctx, client, opts, svc.Namespace, svc.Name, port)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func checkService(ctx context.Context, client *k8sclient.K8sClient, opts Options, namespace, name string, port int32) (Status, string) {
+	target := fmt.Sprintf("service %s/%s", namespace, name)
+	ep, err := client.CoreV1().Endpoints(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return StatusFailed, fmt.Sprintf("get endpoints of %s error: %v", target, err)
+	}
+	ready := 0
+	for _, subset := range ep.Subsets {
+		ready += len(subset.Addresses)
+	}
+	if ready == 0 {
+		return StatusFailed, fmt.Sprintf("%s has no ready endpoints, check the CSI Controller pods", target)
+	}
+	if !opts.inCluster() {
+		return StatusOK, fmt.Sprintf("%s has %d ready endpoints", target, ready)
+	}
+	address := net.JoinHostPort(fmt.Sprintf("%s.%s.svc", name, namespace), strconv.Itoa(int(port)))
+	if err := opts.dialTimeout("tcp", address, opts.Timeout); err != nil {
+		return StatusFailed, fmt.Sprintf("%s is unreachable: %v", target, err)
+	}
+	return StatusOK, fmt.Sprintf("%s is reachable", target)
+}
+
+// checkMetaEngines checks the metadata engines in provisioner secrets of the StorageClasses are reachable
+func checkMetaEngines(ctx context.Context, client *k8sclient.K8sClient, opts Options) []Result {
+	classes, err := client.ListStorageClasses(ctx)
+	if err != nil {
+		return []Result{{Check: "meta-engine", Status: StatusFailed, Message: err.Error()}}
+	}
+	var results []Result
+	for _, sc := range classes {
+		if sc.Provisioner != config.DriverName {
+			continue
+		}
+		result := Result{Check: "meta-engine", Target: sc.Name}
+		name, namespace := config.StorageClassSecret(sc.Parameters, config.SecretOpProvisioner)
+		switch {
+		case name == "" || namespace == "":
+			result.Status, result.Message = StatusSkipped, "no provisioner secret"
+		case strings.Contains(name+namespace, "${"):
+			result.Status, result.Message = StatusSkipped, "provisioner secret is resolved for each PVC"
+		default:
+			result.Status, result.Message = checkMetaEngine(ctx, client, opts, name, namespace)
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return []Result{{Check: "meta-engine", Status: StatusSkipped, Message: "no StorageClass of " + config.DriverName}}
+	}
+	return results
+}
+
+func checkMetaEngine(ctx context.Context, client *k8sclient.K8sClient, opts Options, name, namespace string) (Status, string) {
+	secret, err := client.GetSecret(ctx, name, namespace)
+	if err != nil {
+		return StatusFailed, fmt.Sprintf("get secret %s/%s error: %v", namespace, name, err)
+	}
+	metaUrl := string(secret.Data["metaurl"])
+	if metaUrl == "" {
+		// enterprise edition connects to the console, it's checked by `juicefs auth` on mount
+		return StatusSkipped, "no metaurl in secret, enterprise edition is not checked"
+	}
+	engine, address, err := metaAddress(metaUrl)
+	if err != nil {
+		return StatusFailed, err.Error()
+	}
+	if address == "" {
+		return StatusSkipped, fmt.Sprintf("%s is a local metadata engine", engine)
+	}
+	if err := opts.dialTimeout("tcp", address, opts.Timeout); err != nil {
+		return StatusFailed, fmt.Sprintf("%s %s is unreachable: %v", engine, address, err)
+	}
+	return StatusOK, fmt.Sprintf("%s %s is reachable", engine, address)
+}
+
+// default ports of metadata engines, empty for the local ones
+var defaultMetaPorts = map[string]string{
+	"badger":     "",
+	"etcd":       "2379",
+	"memkv":      "",
+	"mysql":      "3306",
+	"postgres":   "5432",
+	"postgresql": "5432",
+	"redis":      "6379",
+	"rediss":     "6379",
+	"sqlite3":    "",
+	"tikv":       "2379",
+	"unix":       "",
+}
+
+// metaAddress returns the engine and the first host:port in metaurl without the credentials,
+// the address is empty for local engines, e.g. sqlite3
+func metaAddress(metaUrl string) (string, string, error) {
+	engine, rest, found := strings.Cut(metaUrl, "://")
+	if !found {
+		return "", "", fmt.Errorf("invalid metaurl without scheme")
+	}
+	engine = strings.ToLower(engine)
+	port, ok := defaultMetaPorts[engine]
+	if !ok {
+		return engine, "", fmt.Errorf("unknown metadata engine %s", engine)
+	}
+	if port == "" {
+		return engine, "", nil
+	}
+	if idx := strings.LastIndex(rest, "@"); idx >= 0 {
+		rest = rest[idx+1:]
+	}
+	if idx := strings.IndexAny(rest, "/?"); idx >= 0 {
+		rest = rest[:idx]
+	}
+	// mysql://user:pass@(host:port)/db
+	rest = strings.TrimSuffix(strings.TrimPrefix(rest, "("), ")")
+	// tikv://host1:2379,host2:2379/prefix
+	host, _, _ := strings.Cut(rest, ",")
+	if host == "" {
+		return engine, "", fmt.Errorf("no host in metaurl of %s", engine)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	return engine, host, nil
+}
+
+func inCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+func dialTimeout(network, address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
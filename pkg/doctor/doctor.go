@@ -0,0 +1,173 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package doctor diagnoses the environment CSI Driver runs in: the node checks must run on the node,
+// either directly or in the Job generated by GenJob, while the cluster checks only need the API server.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var doctorLog = klog.NewKlogr().WithName("doctor")
+
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusWarning Status = "warning"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// Result is the result of one check, Target is the object checked if the check runs for each of them
+type Result struct {
+	Check   string `json:"check"`
+	Target  string `json:"target,omitempty"`
+	Status  Status `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Report is the machine-readable output of doctor
+type Report struct {
+	Node    string         `json:"node,omitempty"`
+	Time    time.Time      `json:"time"`
+	Results []Result       `json:"results"`
+	Summary map[Status]int `json:"summary"`
+}
+
+type Options struct {
+	// Namespace where CSI Driver is installed
+	Namespace string
+	// NodeChecks runs the checks of the node the command runs on
+	NodeChecks bool
+	// ClusterChecks runs the checks through the API server
+	ClusterChecks bool
+	// KubeletRootDir is detected if empty
+	KubeletRootDir string
+	// Timeout of each network check
+	Timeout time.Duration
+
+	// paths of the host, overridden in tests
+	procDir      string
+	selinuxDir   string
+	fuseDevice   string
+	inCluster    func() bool
+	dialTimeout  func(network, address string, timeout time.Duration) error
+	nodeNameFunc func() string
+}
+
+// Run runs the checks and returns the report, failures of checks are in the report instead of the error
+func Run(ctx context.Context, client *k8sclient.K8sClient, opts Options) *Report {
+	opts.setDefaults()
+	report := &Report{Node: opts.nodeNameFunc(), Time: time.Now()}
+	if opts.NodeChecks {
+		report.add(checkKubeletRootDir(opts))
+		report.add(checkMountPropagation(opts))
+		report.add(checkSELinux(opts))
+		report.add(checkFuseDevice(opts))
+	}
+	if opts.ClusterChecks {
+		if client == nil {
+			report.add(Result{Check: "cluster", Status: StatusSkipped, Message: "no access to the API server"})
+		} else {
+			report.add(checkRBAC(ctx, client, opts)...)
+			report.add(checkWebhooks(ctx, client, opts)...)
+			report.add(checkMetaEngines(ctx, client, opts)...)
+		}
+	}
+	report.Summary = map[Status]int{}
+	for _, r := range report.Results {
+		report.Summary[r.Status]++
+	}
+	return report
+}
+
+func (o *Options) setDefaults() {
+	if o.Namespace == "" {
+		o.Namespace = config.Namespace
+	}
+	if o.Namespace == "" {
+		o.Namespace = "kube-system"
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.procDir == "" {
+		o.procDir = "/proc"
+	}
+	if o.selinuxDir == "" {
+		o.selinuxDir = "/sys/fs/selinux"
+	}
+	if o.fuseDevice == "" {
+		o.fuseDevice = "/dev/fuse"
+	}
+	if o.inCluster == nil {
+		o.inCluster = inCluster
+	}
+	if o.dialTimeout == nil {
+		o.dialTimeout = dialTimeout
+	}
+	if o.nodeNameFunc == nil {
+		o.nodeNameFunc = func() string { return config.NodeName }
+	}
+}
+
+func (r *Report) add(results ...Result) {
+	for _, result := range results {
+		doctorLog.V(1).Info("check done", "check", result.Check, "target", result.Target, "status", result.Status, "message", result.Message)
+		r.Results = append(r.Results, result)
+	}
+}
+
+// Failed returns whether any check failed
+func (r *Report) Failed() bool {
+	return r.Summary[StatusFailed] > 0
+}
+
+// Print prints the report in a table
+func (r *Report) Print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(w, "CHECK\tTARGET\tSTATUS\tMESSAGE"); err != nil {
+		return err
+	}
+	for _, result := range r.Results {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Check, result.Target, result.Status, result.Message); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	var summary []string
+	for status, n := range r.Summary {
+		summary = append(summary, fmt.Sprintf("%d %s", n, status))
+	}
+	sort.Strings(summary)
+	_, err := fmt.Fprintf(out, "\n%s\n", strings.Join(summary, ", "))
+	return err
+}
@@ -0,0 +1,188 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+const (
+	jobContainerName = "doctor"
+	jobTTL           = 10 * time.Minute
+)
+
+// GenJob generates the Job running the node checks on node, with the image, service account, tolerations and
+// kubelet root dir of CSI Node, so that it sees the node the same way CSI Node does
+func GenJob(ctx context.Context, client *k8sclient.K8sClient, opts Options, node string) (*batchv1.Job, error) {
+	opts.setDefaults()
+	ds, err := client.GetDaemonSet(ctx, nodeDaemonSet, opts.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("get CSI Node daemonset error: %v", err)
+	}
+	spec := ds.Spec.Template.Spec
+	if len(spec.Containers) == 0 {
+		return nil, fmt.Errorf("no container in CSI Node daemonset")
+	}
+	image := spec.Containers[0].Image
+	for _, c := range spec.Containers {
+		if c.Name == "juicefs-plugin" {
+			image = c.Image
+		}
+	}
+	rootDir := opts.KubeletRootDir
+	if rootDir == "" {
+		rootDir = config.DetectKubeletRootDir("", "", &corev1.Pod{Spec: spec})
+	}
+
+	// the name is in the job-name label of the pod, which is limited to 63 characters
+	name := "juicefs-doctor-" + strings.ReplaceAll(node, ".", "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	name = strings.TrimRight(name, "-.")
+	hostPathType := corev1.HostPathDirectory
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: opts.Namespace,
+			Labels:    map[string]string{common.PodTypeKey: "juicefs-doctor"},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To(int32(0)),
+			TTLSecondsAfterFinished: ptr.To(int32(jobTTL.Seconds())),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{common.PodTypeKey: "juicefs-doctor"}},
+				Spec: corev1.PodSpec{
+					NodeName:           node,
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: spec.ServiceAccountName,
+					Tolerations:        spec.Tolerations,
+					PriorityClassName:  spec.PriorityClassName,
+					Containers: []corev1.Container{{
+						Name:  jobContainerName,
+						Image: image,
+						Args: []string{"doctor", "--node-checks", "--cluster-checks=false", "--output=json",
+							"--kubelet-root-dir=" + rootDir},
+						Env: []corev1.EnvVar{{
+							Name:      "NODE_NAME",
+							ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}},
+						}},
+						SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true)},
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:             "kubelet-dir",
+							MountPath:        rootDir,
+							MountPropagation: ptr.To(corev1.MountPropagationBidirectional),
+						}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "kubelet-dir",
+						VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+							Path: rootDir,
+							Type: &hostPathType,
+						}},
+					}},
+				},
+			},
+		},
+	}, nil
+}
+
+// RunJob creates the Job, waits for it to finish and returns the report it prints
+func RunJob(ctx context.Context, client *k8sclient.K8sClient, job *batchv1.Job, timeout time.Duration) (*Report, error) {
+	if _, err := client.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	defer func() {
+		policy := metav1.DeletePropagationBackground
+		if err := client.BatchV1().Jobs(job.Namespace).Delete(context.Background(), job.Name, metav1.DeleteOptions{PropagationPolicy: &policy}); err != nil {
+			doctorLog.Error(err, "delete job error", "job", job.Name)
+		}
+	}()
+
+	var pod *corev1.Pod
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		pods, err := client.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + job.Name})
+		if err != nil || len(pods.Items) == 0 {
+			return false, nil
+		}
+		pod = &pods.Items[0]
+		return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		if pod != nil {
+			return nil, fmt.Errorf("pod %s of job is %s: %v", pod.Name, pod.Status.Phase, err)
+		}
+		return nil, fmt.Errorf("wait for job %s error: %v", job.Name, err)
+	}
+	logs, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: jobContainerName}).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+	return parseReport(logs)
+}
+
+// parseReport reads the report in JSON from the output of doctor, which may be mixed with logs
+func parseReport(r io.Reader) (*Report, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	output := string(data)
+	idx := strings.Index(output, "\n{")
+	if strings.HasPrefix(output, "{") {
+		idx = 0
+	} else if idx >= 0 {
+		idx++
+	}
+	if idx < 0 {
+		return nil, fmt.Errorf("no report in the output of job: %s", output)
+	}
+	report := &Report{}
+	if err := json.NewDecoder(strings.NewReader(output[idx:])).Decode(report); err != nil {
+		return nil, fmt.Errorf("invalid report in the output of job: %v", err)
+	}
+	return report, nil
+}
+
+// Merge appends the results of other to r
+func (r *Report) Merge(other *Report) {
+	if r.Node == "" {
+		r.Node = other.Node
+	}
+	r.Results = append(r.Results, other.Results...)
+	r.Summary = map[Status]int{}
+	for _, result := range r.Results {
+		r.Summary[result.Status]++
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package doctor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+)
+
+func kubeletRootDir(opts Options) string {
+	return config.DetectKubeletRootDir(opts.KubeletRootDir, opts.procDir, nil)
+}
+
+func checkKubeletRootDir(opts Options) Result {
+	dir := kubeletRootDir(opts)
+	result := Result{Check: "kubelet-root-dir", Target: dir}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		result.Status, result.Message = StatusFailed, fmt.Sprintf("%v, set --kubelet-root-dir to the root-dir of kubelet", err)
+		return result
+	}
+	if !fi.IsDir() {
+		result.Status, result.Message = StatusFailed, "not a directory"
+		return result
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pods")); err != nil {
+		result.Status, result.Message = StatusWarning, "no pods directory in it, it may not be the root-dir of kubelet"
+		return result
+	}
+	result.Status = StatusOK
+	return result
+}
+
+// checkMountPropagation checks the mount containing kubelet root dir is shared, otherwise the mount points
+// created by CSI Node and mount pods are not visible to kubelet and application pods
+func checkMountPropagation(opts Options) Result {
+	dir := kubeletRootDir(opts)
+	result := Result{Check: "mount-propagation", Target: dir}
+	f, err := os.Open(filepath.Join(opts.procDir, "self", "mountinfo"))
+	if err != nil {
+		result.Status, result.Message = StatusFailed, err.Error()
+		return result
+	}
+	defer f.Close()
+	mountPoint, shared, err := propagationOf(f, dir)
+	if err != nil {
+		result.Status, result.Message = StatusFailed, err.Error()
+		return result
+	}
+	if !shared {
+		result.Status = StatusFailed
+		result.Message = fmt.Sprintf("mount point %s is not shared, run `mount --make-shared %s` on the node, "+
+			"or configure the container runtime to use shared mount propagation", mountPoint, mountPoint)
+		return result
+	}
+	result.Status, result.Message = StatusOK, fmt.Sprintf("mount point %s is shared", mountPoint)
+	return result
+}
+
+// propagationOf returns the mount point in mountinfo which dir is in, and whether it's shared
+func propagationOf(mountinfo io.Reader, dir string) (string, bool, error) {
+	var (
+		mountPoint string
+		shared     bool
+	)
+	scanner := bufio.NewScanner(mountinfo)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 shared:2 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 {
+			continue
+		}
+		mp := fields[4]
+		if mp != "/" && dir != mp && !strings.HasPrefix(dir, mp+"/") {
+			continue
+		}
+		// the last one wins if mounted on the same path repeatedly
+		if len(mp) < len(mountPoint) {
+			continue
+		}
+		mountPoint, shared = mp, false
+		for _, opt := range fields[6:] {
+			if opt == "-" {
+				break
+			}
+			if strings.HasPrefix(opt, "shared:") {
+				shared = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", false, err
+	}
+	if mountPoint == "" {
+		return "", false, fmt.Errorf("no mount point of %s found", dir)
+	}
+	return mountPoint, shared, nil
+}
+
+func checkSELinux(opts Options) Result {
+	result := Result{Check: "selinux"}
+	data, err := os.ReadFile(path.Join(opts.selinuxDir, "enforce"))
+	if err != nil {
+		result.Status, result.Message = StatusOK, "disabled"
+		return result
+	}
+	if strings.TrimSpace(string(data)) == "1" {
+		result.Status = StatusWarning
+		result.Message = "enforcing, mount pods and application pods may be denied to access the mount points, " +
+			"set seLinuxOptions of them or the context mount option"
+		return result
+	}
+	result.Status, result.Message = StatusOK, "permissive"
+	return result
+}
+
+func checkFuseDevice(opts Options) Result {
+	result := Result{Check: "fuse-device", Target: opts.fuseDevice}
+	fi, err := os.Stat(opts.fuseDevice)
+	if err != nil {
+		result.Status, result.Message = StatusFailed, fmt.Sprintf("%v, load the fuse kernel module by `modprobe fuse`", err)
+		return result
+	}
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		result.Status, result.Message = StatusFailed, "not a character device"
+		return result
+	}
+	f, err := os.OpenFile(opts.fuseDevice, os.O_RDWR, 0)
+	if err != nil {
+		result.Status, result.Message = StatusFailed, fmt.Sprintf("%v, mount pods need to run privileged or with /dev/fuse", err)
+		return result
+	}
+	_ = f.Close()
+	result.Status = StatusOK
+	return result
+}
@@ -0,0 +1,254 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/ptr"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+// attachGuard rejects publishing single-node volumes on a node while they are published on another one.
+// CSI Driver has no attach step, so Kubernetes doesn't enforce the access mode of ReadWriteOnce volumes.
+// The node publishing a volume holds a lease of the volume in the namespace of CSI Driver, which records
+// the targets and their pods. The lease is taken over once none of its pods is running on the holder node,
+// so that it's not left behind by nodes gone without unpublishing.
+type attachGuard struct {
+	k8sClient *k8s.K8sClient
+	nodeID    string
+}
+
+// attachPod is the pod a target is published for
+type attachPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid,omitempty"`
+}
+
+func (p attachPod) String() string {
+	return p.Namespace + "/" + p.Name
+}
+
+// multiAttachError is returned when the volume is published on another node
+type multiAttachError struct {
+	node string
+	pod  attachPod
+}
+
+func (e *multiAttachError) Error() string {
+	return fmt.Sprintf("volume is published on node %s for pod %s, ReadWriteOnce volumes can't be used on multiple nodes", e.node, e.pod)
+}
+
+func newAttachGuard(k8sClient *k8s.K8sClient, nodeID string) *attachGuard {
+	if !config.SingleNodeAccessGuard || k8sClient == nil {
+		return nil
+	}
+	return &attachGuard{k8sClient: k8sClient, nodeID: nodeID}
+}
+
+// singleNodeWriter returns true if the volume is published for writing and may only be used on one node
+func singleNodeWriter(volCap *csi.VolumeCapability, readonly bool) bool {
+	if readonly {
+		return false
+	}
+	switch volCap.GetAccessMode().GetMode() {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER:
+		return true
+	}
+	return false
+}
+
+// attachLeaseName returns the name of the lease of the volume, volume handles of static PVs may not be valid names
+func attachLeaseName(volumeID string) string {
+	name := "juicefs-attach-" + volumeID
+	if len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+	return fmt.Sprintf("juicefs-attach-%x", sha256.Sum256([]byte(volumeID)))[:48]
+}
+
+// acquire records the target in the lease of the volume, it returns multiAttachError if the volume is
+// published on another node. Nothing is done if the volume is not published as a single-node writer.
+func (g *attachGuard) acquire(ctx context.Context, volumeID, target string, volCap *csi.VolumeCapability, readonly bool, volCtx map[string]string) error {
+	if g == nil || !singleNodeWriter(volCap, readonly) {
+		return nil
+	}
+	log := util.GenLog(ctx, driverLog, "attachGuard")
+	pod := attachPod{Namespace: volCtx[common.PodInfoNamespace], Name: volCtx[common.PodInfoName], UID: volCtx[common.PodInfoUID]}
+	if pod.Name == "" {
+		// whether the volume is still used can't be told without pods, e.g. podInfoOnMount is disabled
+		log.V(1).Info("pod info is not provided, skip checking access mode", "volumeId", volumeID)
+		return nil
+	}
+	leases := g.k8sClient.CoordinationV1().Leases(config.Namespace)
+	name := attachLeaseName(volumeID)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			lease = &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: config.Namespace},
+				Spec:       coordinationv1.LeaseSpec{HolderIdentity: &g.nodeID},
+			}
+			if err := setAttachTargets(lease, map[string]attachPod{target: pod}); err != nil {
+				return err
+			}
+			_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+			if k8serrors.IsAlreadyExists(err) {
+				// created by another node meanwhile, check it again
+				return k8serrors.NewConflict(coordinationv1.Resource("leases"), name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		targets := attachTargets(lease)
+		if holder := ptr.Deref(lease.Spec.HolderIdentity, ""); holder != "" && holder != g.nodeID {
+			if p, ok := g.published(ctx, holder, targets); ok {
+				return &multiAttachError{node: holder, pod: p}
+			}
+			log.Info("volume is not used on its previous node any more, take over it", "volumeId", volumeID, "node", holder)
+			targets = map[string]attachPod{}
+		} else if recorded, ok := targets[target]; ok && recorded == pod {
+			return nil
+		}
+		targets[target] = pod
+		lease.Spec.HolderIdentity = &g.nodeID
+		if err := setAttachTargets(lease, targets); err != nil {
+			return err
+		}
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+		return err
+	})
+	if e, ok := err.(*multiAttachError); ok {
+		g.report(ctx, volumeID, pod, e)
+	}
+	return err
+}
+
+// release removes the target from the lease of the volume, and deletes the lease once no target is left
+func (g *attachGuard) release(ctx context.Context, volumeID, target string) error {
+	if g == nil {
+		return nil
+	}
+	leases := g.k8sClient.CoordinationV1().Leases(config.Namespace)
+	name := attachLeaseName(volumeID)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		targets := attachTargets(lease)
+		if _, ok := targets[target]; !ok || ptr.Deref(lease.Spec.HolderIdentity, "") != g.nodeID {
+			return nil
+		}
+		delete(targets, target)
+		if len(targets) == 0 {
+			err = leases.Delete(ctx, name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion}})
+			if k8serrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if err := setAttachTargets(lease, targets); err != nil {
+			return err
+		}
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// published returns a pod of the targets which is still running on the node. Pods are regarded
+// as running if they can't be checked, so that the volume is never used on two nodes at once.
+func (g *attachGuard) published(ctx context.Context, node string, targets map[string]attachPod) (attachPod, bool) {
+	for _, p := range targets {
+		pod, err := g.k8sClient.GetPod(ctx, p.Name, p.Namespace)
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return p, true
+		}
+		if (p.UID != "" && string(pod.UID) != p.UID) || pod.Spec.NodeName != node ||
+			pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		return p, true
+	}
+	return attachPod{}, false
+}
+
+// report emits events on both the rejected pod and the pod using the volume
+func (g *attachGuard) report(ctx context.Context, volumeID string, pod attachPod, e *multiAttachError) {
+	log := util.GenLog(ctx, driverLog, "attachGuard")
+	recorder := events.NewRecorder(g.k8sClient)
+	rejected := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace, UID: types.UID(pod.UID)}}
+	if err := recorder.Eventf(ctx, rejected, corev1.EventTypeWarning, events.ReasonMultiAttachRejected, events.ActionMount,
+		"Volume %s is published on node %s for pod %s, ReadWriteOnce volumes can't be used on multiple nodes", volumeID, e.node, e.pod); err != nil {
+		log.Error(err, "report multi-attach error", "pod", pod)
+	}
+	holder := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: e.pod.Name, Namespace: e.pod.Namespace, UID: types.UID(e.pod.UID)}}
+	if err := recorder.Eventf(ctx, holder, corev1.EventTypeWarning, events.ReasonMultiAttachRejected, events.ActionMount,
+		"Volume %s used by this pod is rejected to be published on node %s for pod %s", volumeID, g.nodeID, pod); err != nil {
+		log.Error(err, "report multi-attach error", "pod", e.pod)
+	}
+}
+
+func attachTargets(lease *coordinationv1.Lease) map[string]attachPod {
+	targets := map[string]attachPod{}
+	if v := lease.Annotations[common.AttachTargetsKey]; v != "" {
+		if err := json.Unmarshal([]byte(v), &targets); err != nil {
+			driverLog.Error(err, "invalid targets of lease, reset them", "lease", lease.Name)
+			return map[string]attachPod{}
+		}
+	}
+	return targets
+}
+
+func setAttachTargets(lease *coordinationv1.Lease, targets map[string]attachPod) error {
+	data, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[common.AttachTargetsKey] = string(data)
+	return nil
+}
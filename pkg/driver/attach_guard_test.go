@@ -0,0 +1,96 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestAttachGuard(t *testing.T) {
+	ctx := context.TODO()
+	newPod := func(name, node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("uid-" + name)},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	volCtx := func(name string) map[string]string {
+		return map[string]string{common.PodInfoName: name, common.PodInfoNamespace: "default", common.PodInfoUID: "uid-" + name}
+	}
+	rwo := &csi.VolumeCapability{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}}
+	rwx := &csi.VolumeCapability{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER}}
+	clientset := fake.NewSimpleClientset(newPod("app-a", "node-a"), newPod("app-a2", "node-a"), newPod("app-b", "node-b"))
+	client := &k8s.K8sClient{Interface: clientset}
+	nodeA := &attachGuard{k8sClient: client, nodeID: "node-a"}
+	nodeB := &attachGuard{k8sClient: client, nodeID: "node-b"}
+	leases := clientset.CoordinationV1().Leases(config.Namespace)
+
+	assert.NoError(t, nodeA.acquire(ctx, "pv-1", "/a/1", rwo, false, volCtx("app-a")))
+	assert.NoError(t, nodeA.acquire(ctx, "pv-1", "/a/2", rwo, false, volCtx("app-a2")))
+	err := nodeB.acquire(ctx, "pv-1", "/b/1", rwo, false, volCtx("app-b"))
+	assert.IsType(t, &multiAttachError{}, err)
+	evts, _ := clientset.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+	assert.Len(t, evts.Items, 2)
+
+	// read-only and multi-node volumes are not checked
+	assert.NoError(t, nodeB.acquire(ctx, "pv-1", "/b/1", rwo, true, volCtx("app-b")))
+	assert.NoError(t, nodeB.acquire(ctx, "pv-1", "/b/1", rwx, false, volCtx("app-b")))
+
+	// released by all targets
+	assert.NoError(t, nodeA.release(ctx, "pv-1", "/a/1"))
+	assert.Error(t, nodeB.acquire(ctx, "pv-1", "/b/1", rwo, false, volCtx("app-b")))
+	assert.NoError(t, nodeA.release(ctx, "pv-1", "/a/2"))
+	_, err = leases.Get(ctx, attachLeaseName("pv-1"), metav1.GetOptions{})
+	assert.True(t, err != nil)
+	assert.NoError(t, nodeB.acquire(ctx, "pv-1", "/b/1", rwo, false, volCtx("app-b")))
+
+	// taken over once pods on the holder node are gone
+	assert.NoError(t, clientset.CoreV1().Pods("default").Delete(ctx, "app-b", metav1.DeleteOptions{}))
+	assert.NoError(t, nodeA.acquire(ctx, "pv-1", "/a/1", rwo, false, volCtx("app-a")))
+	lease, err := leases.Get(ctx, attachLeaseName("pv-1"), metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "node-a", *lease.Spec.HolderIdentity)
+	assert.Equal(t, map[string]attachPod{"/a/1": {Namespace: "default", Name: "app-a", UID: "uid-app-a"}}, attachTargets(lease))
+	// releasing on another node does nothing
+	assert.NoError(t, nodeB.release(ctx, "pv-1", "/b/1"))
+	_, err = leases.Get(ctx, attachLeaseName("pv-1"), metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	var disabled *attachGuard
+	assert.NoError(t, disabled.acquire(ctx, "pv-1", "/b/1", rwo, false, volCtx("app-b")))
+	assert.NoError(t, disabled.release(ctx, "pv-1", "/b/1"))
+}
+
+func TestAttachLeaseName(t *testing.T) {
+	assert.Equal(t, "juicefs-attach-pvc-1", attachLeaseName("pvc-1"))
+	name := attachLeaseName("Volume_Handle")
+	assert.Len(t, name, 48)
+	assert.NotEqual(t, name, attachLeaseName("volume_handle"))
+}
@@ -0,0 +1,406 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+var (
+	auditLog = klog.NewKlogr().WithName("audit")
+
+	auditBatchSize     = 100
+	auditFlushInterval = time.Second
+	// wait for new entries when reading the access log hits EOF
+	auditPollInterval = 100 * time.Millisecond
+
+	// e.g. 2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:4403] write (17669,8666,4993160): OK <0.000010>
+	accessLogPattern = regexp.MustCompile(`^(\d{4}\.\d{2}\.\d{2} \d{2}:\d{2}:\d{2}\.\d+) \[uid:(\d+),gid:(\d+),pid:(\d+)\] (\w+) \((.*)\): (\S+)(.*)<([\d.]+)>$`)
+	// the inode in the reply of entry operations, e.g. OK (17669,[-rw-r--r--:0100644,1,0,0,...])
+	entryReplyPattern = regexp.MustCompile(`^\s*\((\d+),`)
+
+	// max inodes whose paths are kept for each mount
+	auditMaxPaths = 100000
+)
+
+const accessLogTimeLayout = "2006.01.02 15:04:05.000000"
+
+// AuditEvent is a sampled entry of the access log of a mount, with the workloads using it.
+// Args are the arguments of the operation as logged by JuiceFS, which are inodes and names, not full paths.
+// Path is resolved from the lookups in the access log, relative to the root of the mount, see inodePaths.
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	Volume  string    `json:"volume"`
+	PVC     string    `json:"pvc,omitempty"`
+	Pods    []string  `json:"pods"`
+	UID     int       `json:"uid"`
+	GID     int       `json:"gid"`
+	PID     int       `json:"pid"`
+	Op      string    `json:"op"`
+	Path    string    `json:"path,omitempty"`
+	Args    string    `json:"args"`
+	Result  string    `json:"result"`
+	Latency float64   `json:"latency"`
+
+	reply string
+}
+
+// parseAccessLog parses an entry of .accesslog, the workload fields are left empty
+func parseAccessLog(line string) (*AuditEvent, error) {
+	m := accessLogPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return nil, fmt.Errorf("invalid access log: %s", line)
+	}
+	t, err := time.ParseInLocation(accessLogTimeLayout, m[1], time.Local)
+	if err != nil {
+		return nil, err
+	}
+	event := &AuditEvent{Time: t, Op: m[5], Args: m[6], Result: m[7], reply: m[8]}
+	event.UID, _ = strconv.Atoi(m[2])
+	event.GID, _ = strconv.Atoi(m[3])
+	event.PID, _ = strconv.Atoi(m[4])
+	event.Latency, _ = strconv.ParseFloat(m[9], 64)
+	return event, nil
+}
+
+// inodePaths resolves the paths of inodes from the entries of the access log, which only have inodes and names.
+// The paths are learned from the replies of lookups and creations, so operations on inodes not looked up since
+// the access log is tailed have no path. Inode 1 is the root of the mount.
+type inodePaths struct {
+	paths map[uint64]string
+}
+
+func newInodePaths() *inodePaths {
+	return &inodePaths{paths: map[uint64]string{1: "/"}}
+}
+
+// operations whose arguments start with the parent inode and the name
+var entryOps = map[string]bool{
+	"lookup": true, "mknod": true, "mkdir": true, "create": true, "symlink": true,
+	"unlink": true, "rmdir": true, "rename": true,
+}
+
+// resolve returns the path the operation of the event is on, empty if it's unknown
+func (p *inodePaths) resolve(event *AuditEvent) string {
+	args := strings.Split(event.Args, ",")
+	if entryOps[event.Op] {
+		if len(args) < 2 {
+			return ""
+		}
+		return p.child(args[0], args[1])
+	}
+	inode, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return ""
+	}
+	return p.paths[inode]
+}
+
+func (p *inodePaths) child(parent, name string) string {
+	inode, err := strconv.ParseUint(parent, 10, 64)
+	if err != nil {
+		return ""
+	}
+	if dir, ok := p.paths[inode]; ok {
+		return path.Join(dir, name)
+	}
+	return ""
+}
+
+// update learns the paths from a successful operation, all the entries of the access log should be passed,
+// not only the sampled ones
+func (p *inodePaths) update(event *AuditEvent) {
+	if event.Result != "OK" {
+		return
+	}
+	args := strings.Split(event.Args, ",")
+	switch event.Op {
+	case "lookup", "mknod", "mkdir", "create", "symlink":
+		m := entryReplyPattern.FindStringSubmatch(event.reply)
+		if m == nil || len(args) < 2 {
+			return
+		}
+		inode, _ := strconv.ParseUint(m[1], 10, 64)
+		if name := p.child(args[0], args[1]); name != "" && inode > 1 {
+			if len(p.paths) >= auditMaxPaths {
+				p.paths = map[uint64]string{1: "/"}
+			}
+			p.paths[inode] = name
+		}
+	case "rename":
+		if len(args) < 4 {
+			return
+		}
+		from, to := p.child(args[0], args[1]), p.child(args[2], args[3])
+		for inode, name := range p.paths {
+			if name != from && !strings.HasPrefix(name, from+"/") {
+				continue
+			}
+			if to == "" {
+				delete(p.paths, inode)
+			} else {
+				p.paths[inode] = to + strings.TrimPrefix(name, from)
+			}
+		}
+	}
+}
+
+// auditSink ships audit events, to stdout or an HTTP endpoint
+type auditSink interface {
+	send(ctx context.Context, events []AuditEvent) error
+}
+
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) send(ctx context.Context, events []AuditEvent) error {
+	enc := json.NewEncoder(s.w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) send(ctx context.Context, events []AuditEvent) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit sink returns %s", resp.Status)
+	}
+	return nil
+}
+
+// newAuditSink returns the sink of the address, which is stdout if it's not an HTTP URL
+func newAuditSink(sink string) auditSink {
+	if strings.HasPrefix(sink, "http://") || strings.HasPrefix(sink, "https://") {
+		return &httpSink{url: sink, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return &writerSink{w: os.Stdout}
+}
+
+// auditMount tails .accesslog of a mount point, which is shared by all the targets of the mount
+type auditMount struct {
+	volume  string
+	pvc     string
+	rate    float64
+	targets map[string]string // target -> <namespace>/<pod>
+	paths   *inodePaths
+	cancel  context.CancelFunc
+}
+
+func (m *auditMount) pods() []string {
+	pods := make([]string, 0, len(m.targets))
+	for _, pod := range m.targets {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+	return pods
+}
+
+// auditor samples the access log of mounts with audit enabled, and ships them as structured events.
+// Operations can't be attributed to a single pod if the mount is shared, so the events carry all the
+// pods using the mount.
+type auditor struct {
+	sink         auditSink
+	events       chan AuditEvent
+	pollInterval time.Duration
+
+	once    sync.Once
+	mu      sync.Mutex
+	mounts  map[string]*auditMount // mount path -> mount
+	targets map[string]string      // target -> mount path
+}
+
+func newAuditor(sink auditSink) *auditor {
+	return &auditor{
+		sink:         sink,
+		events:       make(chan AuditEvent, auditBatchSize*10),
+		pollInterval: auditPollInterval,
+		mounts:       make(map[string]*auditMount),
+		targets:      make(map[string]string),
+	}
+}
+
+// attach starts auditing the mount for the target, rate is the ratio of entries sampled
+func (a *auditor) attach(mountPath, target, volume, pvc, pod string, rate float64) {
+	if a == nil || rate <= 0 {
+		return
+	}
+	a.once.Do(func() {
+		go a.ship(context.Background())
+	})
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.targets[target] = mountPath
+	if m, ok := a.mounts[mountPath]; ok {
+		m.targets[target] = pod
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &auditMount{volume: volume, pvc: pvc, rate: rate, targets: map[string]string{target: pod}, paths: newInodePaths(), cancel: cancel}
+	a.mounts[mountPath] = m
+	auditLog.Info("start auditing access log", "mountPath", mountPath, "volume", volume, "rate", rate)
+	go a.tail(ctx, mountPath, m)
+}
+
+// detach stops auditing for the target, and stops tailing the access log if no target uses the mount
+func (a *auditor) detach(target string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	mountPath, ok := a.targets[target]
+	if !ok {
+		return
+	}
+	delete(a.targets, target)
+	m := a.mounts[mountPath]
+	delete(m.targets, target)
+	if len(m.targets) == 0 {
+		m.cancel()
+		delete(a.mounts, mountPath)
+		auditLog.Info("stop auditing access log", "mountPath", mountPath)
+	}
+}
+
+func (a *auditor) tail(ctx context.Context, mountPath string, m *auditMount) {
+	f, err := os.Open(path.Join(mountPath, ".accesslog"))
+	if err != nil {
+		auditLog.Error(err, "open access log error", "mountPath", mountPath)
+		return
+	}
+	go func() {
+		// unblock reading
+		<-ctx.Done()
+		f.Close()
+	}()
+	reader := bufio.NewReader(f)
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		if ctx.Err() != nil {
+			return
+		}
+		if err == io.EOF {
+			partial += line
+			time.Sleep(a.pollInterval)
+			continue
+		}
+		if err != nil {
+			auditLog.Error(err, "read access log error", "mountPath", mountPath)
+			return
+		}
+		line, partial = partial+line, ""
+		event, err := parseAccessLog(line)
+		if err != nil {
+			auditLog.V(1).Info("skip access log", "error", err)
+			continue
+		}
+		// paths are resolved before the entry is learned, e.g. the path removed by unlink
+		sampled := rand.Float64() < m.rate
+		if sampled {
+			event.Path = m.paths.resolve(event)
+		}
+		m.paths.update(event)
+		if !sampled {
+			continue
+		}
+		a.mu.Lock()
+		event.Volume, event.PVC, event.Pods = m.volume, m.pvc, m.pods()
+		a.mu.Unlock()
+		select {
+		case a.events <- *event:
+		default:
+			auditLog.V(1).Info("audit events are dropped because the sink is too slow")
+		}
+	}
+}
+
+// ship sends events to the sink in batches
+func (a *auditor) ship(ctx context.Context) {
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+	batch := make([]AuditEvent, 0, auditBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := a.sink.send(ctx, batch); err != nil {
+			auditLog.Error(err, "send audit events error", "count", len(batch))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-a.events:
+			batch = append(batch, e)
+			if len(batch) >= auditBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// auditSampleRate returns the sample rate of audit in volume context, 0 if audit is disabled
+func auditSampleRate(volCtx map[string]string) float64 {
+	rate, _ := strconv.ParseFloat(volCtx[common.AuditSampleRateKey], 64)
+	return rate
+}
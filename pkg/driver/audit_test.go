@@ -0,0 +1,128 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type chanSink chan []AuditEvent
+
+func (s chanSink) send(ctx context.Context, events []AuditEvent) error {
+	s <- append([]AuditEvent{}, events...)
+	return nil
+}
+
+func TestParseAccessLog(t *testing.T) {
+	event, err := parseAccessLog("2021.01.15 08:26:11.003330 [uid:1000,gid:100,pid:4403] write (17669,8666,4993160): OK <0.000010>\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, event.UID)
+	assert.Equal(t, 100, event.GID)
+	assert.Equal(t, 4403, event.PID)
+	assert.Equal(t, "write", event.Op)
+	assert.Equal(t, "17669,8666,4993160", event.Args)
+	assert.Equal(t, "OK", event.Result)
+	assert.Equal(t, 0.00001, event.Latency)
+
+	event, err = parseAccessLog("2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:1] lookup (1,data.csv): no such file or directory <0.000301>")
+	assert.NoError(t, err)
+	assert.Equal(t, "1,data.csv", event.Args)
+	assert.Equal(t, "no", event.Result)
+
+	_, err = parseAccessLog("not an access log")
+	assert.Error(t, err)
+}
+
+func TestInodePaths(t *testing.T) {
+	p := newInodePaths()
+	learn := func(line string) string {
+		event, err := parseAccessLog(line)
+		assert.NoError(t, err)
+		resolved := p.resolve(event)
+		p.update(event)
+		return resolved
+	}
+	assert.Equal(t, "/data", learn("2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:1] lookup (1,data): OK (100,[drwxr-xr-x:0040755,2,0,0,1610698000,1610698000,1610698000,4096]) <0.000100>"))
+	assert.Equal(t, "/data/a.csv", learn("2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:1] create (100,a.csv,100644:0022): OK (101,[-rw-r--r--:0100644,1,0,0,1610698000,1610698000,1610698000,0]) [fh:1] <0.000100>"))
+	assert.Equal(t, "/data/a.csv", learn("2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:1] write (101,8666,0): OK <0.000010>"))
+	// failed lookups are not learned
+	assert.Equal(t, "/data/b.csv", learn("2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:1] lookup (100,b.csv): no such file or directory <0.000301>"))
+	assert.Len(t, p.paths, 3)
+	// children are moved with the directory
+	assert.Equal(t, "/data", learn("2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:1] rename (1,data,1,archive,0): OK <0.000100>"))
+	assert.Equal(t, "/archive/a.csv", learn("2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:1] read (101,4096,0,1): OK (4096) <0.000010>"))
+	// inodes not looked up
+	assert.Equal(t, "", learn("2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:1] open (17669): OK [fh:1] <0.000100>"))
+}
+
+func TestAuditor(t *testing.T) {
+	mountPath := t.TempDir()
+	accessLog, err := os.Create(path.Join(mountPath, ".accesslog"))
+	assert.NoError(t, err)
+	defer accessLog.Close()
+
+	sink := make(chanSink, 10)
+	a := newAuditor(sink)
+	a.pollInterval = 10 * time.Millisecond
+	a.attach(mountPath, "/target-a", "pv-1", "default/pvc-1", "default/app-a", 1)
+	a.attach(mountPath, "/target-b", "pv-1", "default/pvc-1", "default/app-b", 1)
+	assert.Len(t, a.mounts, 1)
+
+	_, err = accessLog.WriteString("2021.01.15 08:26:11.003330 [uid:0,gid:0,pid:1] open (17669): OK [fh:1] <0.000100>\n")
+	assert.NoError(t, err)
+	select {
+	case events := <-sink:
+		assert.Len(t, events, 1)
+		assert.Equal(t, "pv-1", events[0].Volume)
+		assert.Equal(t, "default/pvc-1", events[0].PVC)
+		assert.Equal(t, []string{"default/app-a", "default/app-b"}, events[0].Pods)
+		assert.Equal(t, "open", events[0].Op)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no audit event shipped")
+	}
+
+	a.detach("/target-a")
+	assert.Len(t, a.mounts, 1)
+	a.detach("/target-b")
+	assert.Len(t, a.mounts, 0)
+	assert.Len(t, a.targets, 0)
+	// detach unknown target
+	a.detach("/target-c")
+}
+
+func TestHTTPAuditSink(t *testing.T) {
+	var received []AuditEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	sink := newAuditSink(server.URL)
+	assert.IsType(t, &httpSink{}, sink)
+	assert.NoError(t, sink.send(context.TODO(), []AuditEvent{{Volume: "pv-1", Op: "read"}}))
+	assert.Equal(t, []AuditEvent{{Volume: "pv-1", Op: "read"}}, received)
+	assert.IsType(t, &writerSink{}, newAuditSink(""))
+}
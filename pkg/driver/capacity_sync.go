@@ -0,0 +1,200 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+const (
+	capacitySyncOff     = "off"
+	capacitySyncReport  = "report"
+	capacitySyncCorrect = "correct"
+
+	// annProvisionedBy is set by external-provisioner on the PVs it provisions
+	annProvisionedBy = "pv.kubernetes.io/provisioned-by"
+)
+
+var capacityLog = klog.NewKlogr().WithName("capacity-syncer")
+
+// capacitySyncer compares the quota of statically provisioned PVs with their capacity periodically, since admins
+// editing the capacity in PV YAML get no feedback otherwise. The drift is reported by events, and corrected by
+// setting the quota to the capacity if enabled. Dynamically provisioned PVs are expanded through the CSI calls.
+type capacitySyncer struct {
+	juicefs   juicefs.Interface
+	k8sClient *k8s.K8sClient
+	drifted   prometheus.Gauge
+}
+
+func newCapacitySyncer(jfs juicefs.Interface, k8sClient *k8s.K8sClient, reg prometheus.Registerer) *capacitySyncer {
+	drifted := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "static_pv_capacity_drift",
+		Help: "number of static PVs whose quota doesn't match their capacity after the last sync",
+	})
+	reg.MustRegister(drifted)
+	return &capacitySyncer{juicefs: jfs, k8sClient: k8sClient, drifted: drifted}
+}
+
+func (s *capacitySyncer) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.sync(ctx)
+	}
+}
+
+func (s *capacitySyncer) sync(ctx context.Context) {
+	pvs, err := s.k8sClient.ListPersistentVolumes(ctx, nil, nil)
+	if err != nil {
+		capacityLog.Error(err, "list pvs error")
+		return
+	}
+	drifted := 0
+	for i := range pvs {
+		pv := &pvs[i]
+		mode := capacitySyncMode(pv)
+		if mode == capacitySyncOff {
+			continue
+		}
+		ok, err := s.syncPV(ctx, pv, mode == capacitySyncCorrect)
+		if err != nil {
+			capacityLog.Error(err, "sync capacity of pv error", "pv", pv.Name)
+			continue
+		}
+		if !ok {
+			drifted++
+		}
+	}
+	s.drifted.Set(float64(drifted))
+}
+
+// capacitySyncMode returns how the drift of the PV is handled, PVs which are not static or have no quota to sync are off
+func capacitySyncMode(pv *corev1.PersistentVolume) string {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName || pv.Spec.CSI.NodePublishSecretRef == nil ||
+		pv.DeletionTimestamp != nil || pv.Annotations[annProvisionedBy] != "" {
+		return capacitySyncOff
+	}
+	// quota is set in whole GiB, PVs less than 1GiB are not limited
+	if pv.Spec.Capacity.Storage().Value() < 1<<30 {
+		return capacitySyncOff
+	}
+	switch pv.Annotations[common.CapacitySyncKey] {
+	case capacitySyncOff, capacitySyncReport, capacitySyncCorrect:
+		return pv.Annotations[common.CapacitySyncKey]
+	}
+	if config.CapacitySyncCorrect {
+		return capacitySyncCorrect
+	}
+	return capacitySyncReport
+}
+
+// syncPV returns whether the quota of the PV matches its capacity, after corrected if correct is set
+func (s *capacitySyncer) syncPV(ctx context.Context, pv *corev1.PersistentVolume, correct bool) (bool, error) {
+	ref := pv.Spec.CSI.NodePublishSecretRef
+	secret, err := s.k8sClient.GetSecret(ctx, ref.Name, ref.Namespace)
+	if err != nil {
+		return false, err
+	}
+	secrets := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+	volumeID := pv.Spec.CSI.VolumeHandle
+	settings, err := s.juicefs.Settings(ctx, volumeID, volumeID, secrets["name"], secrets, pv.Spec.CSI.VolumeAttributes, pv.Spec.MountOptions)
+	if err != nil {
+		return false, err
+	}
+	quotaPath, capacity := quotaOf(settings, pv.Spec.Capacity.Storage().Value())
+	if quotaPath == "/" {
+		// the whole file system is not limited by the capacity of PV
+		return true, nil
+	}
+	applied, err := s.juicefs.GetQuota(ctx, secrets, settings, quotaPath)
+	if err != nil {
+		return false, fmt.Errorf("query quota of %s error: %v", quotaPath, err)
+	}
+	if !quotaDrifted(applied, capacity) {
+		return true, nil
+	}
+
+	log := capacityLog.WithValues("pv", pv.Name, "path", quotaPath, "quota", applied, "capacity", capacity)
+	recorder := events.NewRecorder(s.k8sClient)
+	if !correct {
+		log.Info("quota of static pv drifts from its capacity")
+		msg := fmt.Sprintf("Quota of %s is %s, but capacity of PV is %s", quotaPath, quotaString(applied), pv.Spec.Capacity.Storage())
+		if err := recorder.Event(ctx, pv, corev1.EventTypeWarning, events.ReasonCapacityDrift, events.ActionProvision, msg); err != nil {
+			log.Error(err, "create event error")
+		}
+		return false, nil
+	}
+	if err := s.juicefs.SetQuota(ctx, secrets, settings, quotaPath, capacity); err != nil {
+		msg := fmt.Sprintf("Set quota of %s to %s error: %v", quotaPath, pv.Spec.Capacity.Storage(), err)
+		if err := recorder.Event(ctx, pv, corev1.EventTypeWarning, events.ReasonCapacityDrift, events.ActionProvision, msg); err != nil {
+			log.Error(err, "create event error")
+		}
+		return false, err
+	}
+	log.Info("quota of static pv is set to its capacity")
+	msg := fmt.Sprintf("Quota of %s is set from %s to %s", quotaPath, quotaString(applied), pv.Spec.Capacity.Storage())
+	if err := recorder.Event(ctx, pv, corev1.EventTypeNormal, events.ReasonCapacitySynced, events.ActionProvision, msg); err != nil {
+		log.Error(err, "create event error")
+	}
+	return true, nil
+}
+
+// quotaDrifted returns whether the applied quota doesn't match the capacity, the applied one is reported
+// in human readable size by GetQuota, so the rounding error is allowed
+func quotaDrifted(applied, capacity int64) bool {
+	want := juicefs.QuotaBytes(capacity)
+	return applied == 0 || math.Abs(float64(applied-want)) > float64(want)/100
+}
+
+func quotaString(quota int64) string {
+	if quota == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%dGi", int64(math.Round(float64(quota)/(1<<30))))
+}
+
+// RunCapacitySyncer syncs the quota of static PVs every config.CapacitySyncInterval until ctx is done,
+// it's run by the leader of CSI Controller, so that quotas aren't set by every replica
+func (d *Driver) RunCapacitySyncer(ctx context.Context) {
+	if config.CapacitySyncInterval <= 0 || d.capacity == nil {
+		return
+	}
+	d.runAsLeader(ctx, "capacity-syncer", func(ctx context.Context) {
+		d.capacity.run(ctx, config.CapacitySyncInterval)
+	})
+}
@@ -0,0 +1,110 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestCapacitySyncer(t *testing.T) {
+	defer func() { config.CapacitySyncCorrect = false }()
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+
+	const gi = int64(1 << 30)
+	pv := func(name, capacity string, annotations map[string]string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations},
+			Spec: corev1.PersistentVolumeSpec{
+				Capacity:     corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)},
+				MountOptions: []string{"subdir=/static"},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:               config.DriverName,
+					VolumeHandle:         name,
+					VolumeAttributes:     map[string]string{"subPath": name},
+					NodePublishSecretRef: &corev1.SecretReference{Name: "juicefs-secret", Namespace: "kube-system"},
+				}},
+			},
+		}
+	}
+	matched := pv("matched", "10Gi", nil)
+	drifted := pv("drifted", "20Gi", nil)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-secret", Namespace: "kube-system"}, Data: map[string][]byte{"name": []byte("myjfs")}}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(secret, matched, drifted,
+		pv("dynamic", "10Gi", map[string]string{annProvisionedBy: config.DriverName}),
+		pv("off", "10Gi", map[string]string{common.CapacitySyncKey: capacitySyncOff}),
+		pv("small", "100Mi", nil),
+	)}
+	secrets := map[string]string{"name": "myjfs"}
+	settingsOf := func(pv *corev1.PersistentVolume) *config.JfsSetting {
+		return &config.JfsSetting{PV: pv, SubPath: pv.Name, Options: []string{"subdir=/static"}}
+	}
+	for _, p := range []*corev1.PersistentVolume{matched, drifted} {
+		mockJuicefs.EXPECT().Settings(gomock.Any(), p.Name, p.Name, "myjfs", secrets, p.Spec.CSI.VolumeAttributes, p.Spec.MountOptions).Return(settingsOf(p), nil).Times(2)
+	}
+	mockJuicefs.EXPECT().GetQuota(gomock.Any(), secrets, gomock.Any(), "/static/matched").Return(10*gi, nil).Times(2)
+	mockJuicefs.EXPECT().GetQuota(gomock.Any(), secrets, gomock.Any(), "/static/drifted").Return(10*gi, nil).Times(2)
+
+	s := newCapacitySyncer(mockJuicefs, client, prometheus.NewRegistry())
+	s.sync(context.TODO())
+	assert.Equal(t, float64(1), testutil.ToFloat64(s.drifted))
+	events, _ := client.CoreV1().Events(metav1.NamespaceDefault).List(context.TODO(), metav1.ListOptions{})
+	assert.Len(t, events.Items, 1)
+	assert.Equal(t, "CapacityDrift", events.Items[0].Reason)
+	assert.Equal(t, "drifted", events.Items[0].InvolvedObject.Name)
+	assert.Equal(t, "Quota of /static/drifted is 10Gi, but capacity of PV is 20Gi", events.Items[0].Message)
+
+	// correct the drift
+	config.CapacitySyncCorrect = true
+	mockJuicefs.EXPECT().SetQuota(gomock.Any(), secrets, gomock.Any(), "/static/drifted", 20*gi).Return(nil)
+	s.sync(context.TODO())
+	assert.Equal(t, float64(0), testutil.ToFloat64(s.drifted))
+	events, _ = client.CoreV1().Events(metav1.NamespaceDefault).List(context.TODO(), metav1.ListOptions{})
+	var reasons []string
+	for _, e := range events.Items {
+		reasons = append(reasons, e.Reason)
+	}
+	assert.ElementsMatch(t, []string{"CapacityDrift", "CapacitySynced"}, reasons)
+}
+
+func TestQuotaDrifted(t *testing.T) {
+	const gi = int64(1 << 30)
+	assert.False(t, quotaDrifted(10*gi, 10*gi))
+	// reported in human readable size
+	assert.False(t, quotaDrifted(10*gi-gi/200, 10*gi))
+	// capacity is rounded up to GiB
+	assert.False(t, quotaDrifted(11*gi, 10*gi+gi/2))
+	assert.True(t, quotaDrifted(10*gi, 10*gi+gi/2))
+	assert.True(t, quotaDrifted(0, 10*gi))
+	assert.True(t, quotaDrifted(10*gi, 20*gi))
+}
@@ -0,0 +1,287 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/client"
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var (
+	checkpointLog      = klog.NewKlogr().WithName("checkpoint")
+	checkpointInterval = 15 * time.Second
+)
+
+// checkpointController binds PVCs annotated with common.CheckpointOfKey to read-only PVs of a clone of the source
+// volume, which is a consistent view of the volume at the time of cloning, without blocking its writers.
+// The clone is placed in client.SnapshotDir like volume snapshots, and deleted with the PV once the PVC is deleted.
+type checkpointController struct {
+	juicefs   juicefs.Interface
+	k8sClient *k8s.K8sClient
+	// PVCs are watched by the informer, failed ones are retried every checkpointInterval
+	pvcs     cache.Store
+	informer cache.Controller
+	changed  chan struct{}
+	// last error of the pending PVCs, to avoid emitting the same event every round
+	failures map[types.UID]string
+}
+
+func newCheckpointController(jfs juicefs.Interface, k8sClient *k8s.K8sClient) *checkpointController {
+	c := &checkpointController{juicefs: jfs, k8sClient: k8sClient, changed: make(chan struct{}, 1), failures: map[types.UID]string{}}
+	watchlist := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return k8sClient.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(context.Background(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return k8sClient.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).Watch(context.Background(), options)
+		},
+	}
+	notify := func(obj interface{}) {
+		if pvc, ok := obj.(*corev1.PersistentVolumeClaim); ok && pvc.Annotations[common.CheckpointOfKey] != "" {
+			select {
+			case c.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	c.pvcs, c.informer = cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: watchlist,
+		ObjectType:    &corev1.PersistentVolumeClaim{},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    notify,
+			UpdateFunc: func(oldObj, newObj interface{}) { notify(newObj) },
+		},
+	})
+	return c
+}
+
+func checkpointPVName(pvc *corev1.PersistentVolumeClaim) string {
+	return "checkpoint-" + string(pvc.UID)
+}
+
+func (c *checkpointController) run(ctx context.Context) {
+	go c.informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return
+	}
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for {
+		c.sync(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.changed:
+		}
+	}
+}
+
+func (c *checkpointController) sync(ctx context.Context) {
+	pending := map[types.UID]bool{}
+	for _, obj := range c.pvcs.List() {
+		pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+		if !ok || pvc.Annotations[common.CheckpointOfKey] == "" || pvc.Spec.VolumeName != "" || pvc.DeletionTimestamp != nil {
+			continue
+		}
+		pending[pvc.UID] = true
+		if err := c.checkpoint(ctx, pvc); err != nil {
+			checkpointLog.Error(err, "create checkpoint error", "pvc", pvc.Namespace+"/"+pvc.Name)
+			if c.failures[pvc.UID] != err.Error() {
+				c.failures[pvc.UID] = err.Error()
+				c.event(ctx, pvc, corev1.EventTypeWarning, events.ReasonCheckpointFailed, err.Error())
+			}
+			continue
+		}
+		delete(c.failures, pvc.UID)
+	}
+	// forget PVCs which are deleted or bound
+	for uid := range c.failures {
+		if !pending[uid] {
+			delete(c.failures, uid)
+		}
+	}
+
+	pvs, err := c.k8sClient.ListPersistentVolumes(ctx, &metav1.LabelSelector{MatchLabels: map[string]string{common.CheckpointLabelKey: "true"}}, nil)
+	if err != nil {
+		checkpointLog.Error(err, "list checkpoint pvs error")
+		return
+	}
+	for i := range pvs {
+		if pvs[i].Status.Phase != corev1.VolumeReleased {
+			continue
+		}
+		if err := c.release(ctx, &pvs[i]); err != nil {
+			checkpointLog.Error(err, "delete checkpoint error", "pv", pvs[i].Name)
+		}
+	}
+}
+
+// checkpoint clones the volume of the source PVC and creates the PV bound to pvc
+func (c *checkpointController) checkpoint(ctx context.Context, pvc *corev1.PersistentVolumeClaim) error {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName != "" {
+		return fmt.Errorf("storageClassName of checkpoint pvc must be \"\"")
+	}
+	name := checkpointPVName(pvc)
+	if _, err := c.k8sClient.GetPersistentVolume(ctx, name); err == nil {
+		// created already, waiting to be bound
+		return nil
+	}
+	srcName := pvc.Annotations[common.CheckpointOfKey]
+	src, err := c.k8sClient.GetPersistentVolumeClaim(ctx, srcName, pvc.Namespace)
+	if err != nil {
+		return fmt.Errorf("get source pvc %s error: %v", srcName, err)
+	}
+	if src.Status.Phase != corev1.ClaimBound {
+		return fmt.Errorf("source pvc %s is not bound", srcName)
+	}
+	srcPV, err := c.k8sClient.GetPersistentVolume(ctx, src.Spec.VolumeName)
+	if err != nil {
+		return err
+	}
+	if srcPV.Spec.CSI == nil || srcPV.Spec.CSI.Driver != config.DriverName || srcPV.Spec.CSI.NodePublishSecretRef == nil {
+		return fmt.Errorf("source pvc %s is not a JuiceFS volume with nodePublishSecretRef", srcName)
+	}
+	ref := srcPV.Spec.CSI.NodePublishSecretRef
+	secrets, err := c.secrets(ctx, ref.Name, ref.Namespace)
+	if err != nil {
+		return err
+	}
+
+	// paths in the file system, the clone job mounts the root
+	srcPath := path.Join(subdirOption(srcPV.Spec.MountOptions), srcPV.Spec.CSI.VolumeAttributes["subPath"])
+	dstPath := path.Join(client.SnapshotDir, srcPV.Spec.CSI.VolumeHandle, name)
+	checkpointLog.Info("clone volume for checkpoint", "pvc", pvc.Namespace+"/"+pvc.Name, "source", srcPath, "checkpoint", dstPath)
+	if err := c.juicefs.JfsCloneVol(ctx, name, srcPath, dstPath, secrets, nil); err != nil {
+		return fmt.Errorf("clone %s error: %v", srcPath, err)
+	}
+
+	var mountOptions []string
+	for _, option := range srcPV.Spec.MountOptions {
+		if subdirOption([]string{option}) == "/" {
+			mountOptions = append(mountOptions, option)
+		}
+	}
+	capacity := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if capacity.IsZero() {
+		capacity = srcPV.Spec.Capacity[corev1.ResourceStorage]
+	}
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{common.CheckpointLabelKey: "true"},
+			Annotations: map[string]string{common.CheckpointOfKey: pvc.Namespace + "/" + srcName},
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:     corev1.ResourceList{corev1.ResourceStorage: capacity},
+			AccessModes:  []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany},
+			MountOptions: mountOptions,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+				Driver:               config.DriverName,
+				VolumeHandle:         name,
+				ReadOnly:             true,
+				VolumeAttributes:     map[string]string{"subPath": dstPath},
+				NodePublishSecretRef: ref,
+			}},
+			ClaimRef: &corev1.ObjectReference{
+				Kind:       "PersistentVolumeClaim",
+				APIVersion: "v1",
+				Namespace:  pvc.Namespace,
+				Name:       pvc.Name,
+				UID:        pvc.UID,
+			},
+			// the clone is deleted by the controller, not by the provisioner
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			StorageClassName:              "",
+			VolumeMode:                    srcPV.Spec.VolumeMode,
+		},
+	}
+	if _, err := c.k8sClient.CoreV1().PersistentVolumes().Create(ctx, pv, metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	c.event(ctx, pvc, corev1.EventTypeNormal, events.ReasonCheckpointCreated, fmt.Sprintf("Checkpoint of %s is created as pv %s", srcName, name))
+	return nil
+}
+
+// release deletes the clone and the PV once its checkpoint PVC is deleted
+func (c *checkpointController) release(ctx context.Context, pv *corev1.PersistentVolume) error {
+	ref := pv.Spec.CSI.NodePublishSecretRef
+	secrets, err := c.secrets(ctx, ref.Name, ref.Namespace)
+	if err != nil {
+		return err
+	}
+	subPath := pv.Spec.CSI.VolumeAttributes["subPath"]
+	if !strings.HasPrefix(subPath, client.SnapshotDir+"/") {
+		return fmt.Errorf("subPath %s of checkpoint is not in %s", subPath, client.SnapshotDir)
+	}
+	checkpointLog.Info("delete checkpoint", "pv", pv.Name, "checkpoint", subPath)
+	if err := c.juicefs.JfsDeleteSnapshot(ctx, pv.Name, subPath, secrets); err != nil {
+		return err
+	}
+	err = c.k8sClient.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *checkpointController) secrets(ctx context.Context, name, namespace string) (map[string]string, error) {
+	secret, err := c.k8sClient.GetSecret(ctx, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+	return secrets, nil
+}
+
+func (c *checkpointController) event(ctx context.Context, pvc *corev1.PersistentVolumeClaim, evtType, reason, message string) {
+	if err := events.NewRecorder(c.k8sClient).Event(ctx, pvc, evtType, reason, events.ActionProvision, message); err != nil {
+		checkpointLog.Error(err, "create event error", "pvc", pvc.Namespace+"/"+pvc.Name)
+	}
+}
+
+// RunCheckpointController binds checkpoint PVCs and deletes released checkpoints until ctx is done, it's run by the leader of CSI Controller
+func (d *Driver) RunCheckpointController(ctx context.Context) {
+	if d.controllerService.k8sClient == nil {
+		return
+	}
+	d.runAsLeader(ctx, "checkpoint-controller", func(ctx context.Context) {
+		newCheckpointController(d.controllerService.juicefs, d.controllerService.k8sClient).run(ctx)
+	})
+}
@@ -0,0 +1,149 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestCheckpointController(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+
+	emptySC := ""
+	otherSC := "juicefs-sc"
+	srcPV := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-src"},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:     corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			MountOptions: []string{"subdir=/k8s", "cache-size=1024"},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+				Driver:               config.DriverName,
+				VolumeHandle:         "pvc-src",
+				VolumeAttributes:     map[string]string{"subPath": "pvc-src"},
+				NodePublishSecretRef: &corev1.SecretReference{Name: "juicefs-secret", Namespace: "kube-system"},
+			}},
+		},
+	}
+	src := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-src"},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+	checkpointPVC := func(name string, sc *string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				UID:         types.UID("uid-" + name),
+				Annotations: map[string]string{common.CheckpointOfKey: "data"},
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: sc,
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany},
+			},
+		}
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-secret", Namespace: "kube-system"}, Data: map[string][]byte{"name": []byte("myjfs")}}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(srcPV, src, secret,
+		checkpointPVC("backup", &emptySC), checkpointPVC("invalid", &otherSC))}
+	c := newCheckpointController(mockJuicefs, client)
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.informer.Run(stop)
+	if !cache.WaitForCacheSync(stop, c.informer.HasSynced) {
+		t.Fatal("pvc informer is not synced")
+	}
+
+	mockJuicefs.EXPECT().JfsCloneVol(gomock.Any(), "checkpoint-uid-backup", "/k8s/pvc-src", ".snapshots/pvc-src/checkpoint-uid-backup",
+		map[string]string{"name": "myjfs"}, nil).Return(nil).Times(1)
+	c.sync(context.TODO())
+	// the pv is not cloned again before it's bound
+	c.sync(context.TODO())
+
+	pv, err := client.GetPersistentVolume(context.TODO(), "checkpoint-uid-backup")
+	if err != nil {
+		t.Fatalf("get checkpoint pv error: %v", err)
+	}
+	if pv.Spec.ClaimRef == nil || pv.Spec.ClaimRef.Name != "backup" || !pv.Spec.CSI.ReadOnly ||
+		pv.Spec.AccessModes[0] != corev1.ReadOnlyMany || pv.Spec.CSI.VolumeAttributes["subPath"] != ".snapshots/pvc-src/checkpoint-uid-backup" {
+		t.Errorf("checkpoint pv = %+v", pv.Spec)
+	}
+	if len(pv.Spec.MountOptions) != 1 || pv.Spec.MountOptions[0] != "cache-size=1024" {
+		t.Errorf("mount options = %v, want subdir removed", pv.Spec.MountOptions)
+	}
+	if _, err := client.GetPersistentVolume(context.TODO(), "checkpoint-uid-invalid"); !k8serrors.IsNotFound(err) {
+		t.Errorf("checkpoint pvc with storage class should be rejected, got %v", err)
+	}
+	events, _ := client.CoreV1().Events("default").List(context.TODO(), metav1.ListOptions{})
+	failed := 0
+	for _, e := range events.Items {
+		if e.Reason == "CheckpointFailed" {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("CheckpointFailed events = %d, want 1", failed)
+	}
+
+	// failures of deleted pvcs are forgotten
+	if err := client.CoreV1().PersistentVolumeClaims("default").Delete(context.TODO(), "invalid", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, exists, err := c.pvcs.GetByKey("default/invalid")
+		return !exists, err
+	}); err != nil {
+		t.Fatalf("deleted pvc is still in the informer: %v", err)
+	}
+	c.sync(context.TODO())
+	if len(c.failures) != 0 {
+		t.Errorf("failures = %v, want deleted pvcs forgotten", c.failures)
+	}
+
+	// release the checkpoint once the pvc is deleted
+	if err := client.CoreV1().PersistentVolumeClaims("default").Delete(context.TODO(), "backup", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	pv.Status.Phase = corev1.VolumeReleased
+	if _, err := client.CoreV1().PersistentVolumes().UpdateStatus(context.TODO(), pv, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	mockJuicefs.EXPECT().JfsDeleteSnapshot(gomock.Any(), "checkpoint-uid-backup", ".snapshots/pvc-src/checkpoint-uid-backup", map[string]string{"name": "myjfs"}).Return(nil)
+	c.sync(context.TODO())
+	if _, err := client.GetPersistentVolume(context.TODO(), "checkpoint-uid-backup"); !k8serrors.IsNotFound(err) {
+		t.Errorf("checkpoint pv should be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount/builder"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+// legacyShim recognizes a trait of mount pods created by older versions and migrates the pod in place,
+// so that this version adopts the pod instead of creating another one for the same volume next to it.
+// migrate returns whether the pod is changed.
+type legacyShim struct {
+	name    string
+	migrate func(ctx context.Context, d *nodeService, pod *corev1.Pod) bool
+}
+
+// legacyShims are applied in order, later shims may depend on what earlier ones migrated
+var legacyShims = []legacyShim{
+	{name: "unique-id", migrate: migrateUniqueID},
+	{name: "finalizer", migrate: migrateFinalizer},
+	{name: "reference-keys", migrate: migrateReferenceKeys},
+	{name: "hash-label", migrate: migrateHashLabel},
+}
+
+// migrateUniqueID sets the unique id annotation, older versions only recorded it in the label
+func migrateUniqueID(_ context.Context, _ *nodeService, pod *corev1.Pod) bool {
+	uniqueID := pod.Labels[common.PodUniqueIdLabelKey]
+	if uniqueID == "" || pod.Annotations[common.UniqueId] != "" {
+		return false
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[common.UniqueId] = uniqueID
+	return true
+}
+
+// migrateFinalizer adds the finalizer, without which the mount point isn't cleaned up when the pod is deleted
+func migrateFinalizer(_ context.Context, _ *nodeService, pod *corev1.Pod) bool {
+	return controllerutil.AddFinalizer(pod, common.Finalizer)
+}
+
+// migrateReferenceKeys re-keys references of bind targets which were keyed in other formats,
+// references are looked up by util.GetReferenceKey of the target
+func migrateReferenceKeys(_ context.Context, _ *nodeService, pod *corev1.Pod) bool {
+	changed := false
+	for k, target := range pod.Annotations {
+		if !strings.HasPrefix(k, "juicefs-") || !isTargetPath(target) {
+			continue
+		}
+		if key := util.GetReferenceKey(target); key != k {
+			delete(pod.Annotations, k)
+			pod.Annotations[key] = target
+			changed = true
+		}
+	}
+	return changed
+}
+
+func isTargetPath(p string) bool {
+	return strings.Contains(p, "/volumes/kubernetes.io~csi/") && strings.HasSuffix(p, "/mount")
+}
+
+// migrateHashLabel labels the pod with the hash of the settings of its volume, which mount pods are looked up by.
+// Older versions didn't label the hash, the pod would never be reused for new bind targets otherwise.
+// The hash is only labeled if the pod mounts the same way as this version would create it with the settings,
+// otherwise the pod keeps serving its bind targets and new ones get a new mount pod, replacing it in the end.
+func migrateHashLabel(ctx context.Context, d *nodeService, pod *corev1.Pod) bool {
+	if pod.Labels[common.PodJuiceHashLabelKey] != "" || pod.Annotations[common.UniqueId] == "" {
+		return false
+	}
+	setting, err := config.GenSettingAttrWithMountPod(ctx, d.k8sClient, pod)
+	if err != nil {
+		driverLog.Error(err, "generate setting of legacy mount pod error", "pod", pod.Name)
+		return false
+	}
+	expected, err := builder.NewPodBuilder(setting, 0).NewMountPod(pod.Name)
+	if err != nil {
+		driverLog.Error(err, "generate legacy mount pod with current settings error", "pod", pod.Name)
+		return false
+	}
+	if !sameMountContainer(pod, expected) {
+		driverLog.Info("legacy mount pod differs from the current settings of its volume, leave it for replacement", "pod", pod.Name)
+		return false
+	}
+	pod.Labels[common.PodJuiceHashLabelKey] = setting.HashVal
+	return true
+}
+
+// sameMountContainer returns whether the mount containers of the pods run the same image and command
+func sameMountContainer(pod, expected *corev1.Pod) bool {
+	if len(pod.Spec.Containers) == 0 || len(expected.Spec.Containers) == 0 {
+		return false
+	}
+	a, b := pod.Spec.Containers[0], expected.Spec.Containers[0]
+	return a.Image == b.Image && reflect.DeepEqual(a.Command, b.Command)
+}
+
+// adoptLegacyMountPods migrates the mount pods on the node created by older versions, see legacyShims
+func (d *nodeService) adoptLegacyMountPods(ctx context.Context) (migrated int) {
+	if d.k8sClient == nil || config.ByProcess || config.NodeName == "" {
+		return 0
+	}
+	labelSelector := &metav1.LabelSelector{MatchLabels: map[string]string{common.PodTypeKey: common.PodTypeValue}}
+	fieldSelector := &fields.Set{"spec.nodeName": config.NodeName}
+	pods, err := d.k8sClient.ListPod(ctx, config.Namespace, labelSelector, fieldSelector)
+	if err != nil {
+		driverLog.Error(err, "list mount pods error")
+		return 0
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		var applied []string
+		for _, shim := range legacyShims {
+			if shim.migrate(ctx, d, pod) {
+				applied = append(applied, shim.name)
+			}
+		}
+		if len(applied) == 0 {
+			continue
+		}
+		if err := d.k8sClient.UpdatePod(ctx, pod); err != nil {
+			driverLog.Error(err, "migrate legacy mount pod error", "pod", pod.Name, "shims", applied)
+			continue
+		}
+		driverLog.Info("adopted mount pod created by an older version", "pod", pod.Name, "shims", applied)
+		if d.handover != nil {
+			for _, name := range applied {
+				d.handover.legacyMigrated.WithLabelValues(name).Inc()
+			}
+		}
+		migrated++
+	}
+	return migrated
+}
@@ -0,0 +1,115 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+func TestAdoptLegacyMountPods(t *testing.T) {
+	nodeName, namespace := config.NodeName, config.Namespace
+	defer func() { config.NodeName, config.Namespace = nodeName, namespace }()
+	config.NodeName, config.Namespace = "node-1", "kube-system"
+
+	target := "/var/lib/kubelet/pods/uid-1/volumes/kubernetes.io~csi/pv-1/mount"
+	legacy := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "juicefs-node-1-pv-1",
+			Namespace:   config.Namespace,
+			Labels:      map[string]string{common.PodTypeKey: common.PodTypeValue, common.PodUniqueIdLabelKey: "pv-1"},
+			Annotations: map[string]string{"juicefs-" + target[1:20]: target, "other": "value"},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-1", Containers: []corev1.Container{{
+			Name:    common.MountContainerName,
+			Image:   "juicedata/mount:ce-v1.1.0",
+			Command: []string{"sh", "-c", "exec /bin/mount.juicefs ${metaurl} /jfs/pv-1 -o metrics=0.0.0.0:9567"},
+		}}},
+	}
+	current := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "juicefs-node-1-pv-2-abcdef",
+			Namespace: config.Namespace,
+			Labels: map[string]string{
+				common.PodTypeKey: common.PodTypeValue, common.PodUniqueIdLabelKey: "pv-2", common.PodJuiceHashLabelKey: "hash",
+			},
+			Annotations: map[string]string{common.UniqueId: "pv-2"},
+			Finalizers:  []string{common.Finalizer},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-1"},
+	}
+	// the PV of the legacy pod is now mounted with other options, the pod is left for replacement
+	changed := legacy.DeepCopy()
+	changed.Name = "juicefs-node-1-pv-3"
+	changed.Labels[common.PodUniqueIdLabelKey] = "pv-3"
+	changed.Annotations = map[string]string{}
+	changed.Spec.Containers[0].Command = []string{"sh", "-c", "exec /sbin/mount.juicefs test /jfs/pv-3 -o foreground"}
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-3"},
+		Spec: corev1.PersistentVolumeSpec{
+			MountOptions: []string{"cache-size=100"},
+			ClaimRef:     &corev1.ObjectReference{Name: "pvc-3", Namespace: "default"},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+				VolumeHandle:         "pv-3",
+				NodePublishSecretRef: &corev1.SecretReference{Name: "secret-3", Namespace: "default"},
+			}},
+		},
+	}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "pvc-3", Namespace: "default"}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret-3", Namespace: "default"},
+		Data:       map[string][]byte{"name": []byte("test"), "token": []byte("token")},
+	}
+	client := fake.NewSimpleClientset(legacy, current, changed, pv, pvc, secret)
+	d := &nodeService{
+		k8sClient: &k8sclient.K8sClient{Interface: client},
+		handover:  newHandoverMetrics(prometheus.NewRegistry()),
+	}
+
+	assert.Equal(t, 2, d.adoptLegacyMountPods(context.TODO()))
+	got, err := client.CoreV1().Pods(config.Namespace).Get(context.TODO(), legacy.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "pv-1", got.Annotations[common.UniqueId])
+	assert.Equal(t, []string{common.Finalizer}, got.Finalizers)
+	assert.Equal(t, map[string]string{
+		common.UniqueId:              "pv-1",
+		util.GetReferenceKey(target): target,
+		"other":                      "value",
+	}, got.Annotations)
+	assert.Equal(t, float64(2), testutil.ToFloat64(d.handover.legacyMigrated.WithLabelValues("finalizer")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(d.handover.legacyMigrated.WithLabelValues("hash-label")))
+	assert.NotEmpty(t, got.Labels[common.PodJuiceHashLabelKey])
+	got, err = client.CoreV1().Pods(config.Namespace).Get(context.TODO(), changed.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "pv-3", got.Annotations[common.UniqueId])
+	assert.Empty(t, got.Labels[common.PodJuiceHashLabelKey])
+
+	// nothing left to migrate
+	assert.Equal(t, 0, d.adoptLegacyMountPods(context.TODO()))
+}
@@ -2,7 +2,7 @@ package driver
 
 import (
 	"context"
-	"path"
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
@@ -10,12 +10,20 @@ import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/klog/v2"
 
+	"github.com/juicedata/juicefs-csi-driver/pkg/client"
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/tracing"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/secretprovider"
 )
 
 var (
@@ -34,29 +42,42 @@ var (
 	controllerCaps = []csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 	}
 )
 
 type controllerService struct {
 	csi.UnimplementedControllerServer
-	juicefs  juicefs.Interface
-	vols     map[string]int64
-	volLocks *resource.VolumeLocks
+	juicefs    juicefs.Interface
+	k8sClient  *k8sclient.K8sClient
+	vols       map[string]int64
+	snapshots  *snapshotStore
+	volLocks   *resource.VolumeLocks
+	metaProber *metaProber
+	metrics    *controllerMetrics
+	quota      *quotaSupport
 }
 
 func newControllerService(k8sClient *k8sclient.K8sClient) (controllerService, error) {
 	jfs := juicefs.NewJfsProvider(nil, k8sClient)
 
 	return controllerService{
-		juicefs:  jfs,
-		vols:     make(map[string]int64),
-		volLocks: resource.NewVolumeLocks(),
+		juicefs:   jfs,
+		k8sClient: k8sClient,
+		vols:      make(map[string]int64),
+		snapshots: newSnapshotStore(k8sClient),
+		volLocks:  resource.NewVolumeLocks(),
 	}, nil
 }
 
 // CreateVolume create directory in an existing JuiceFS filesystem
-func (d *controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+func (d *controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (resp *csi.CreateVolumeResponse, err error) {
 	log := klog.NewKlogr().WithName("CreateVolume")
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		log = log.WithValues("traceId", traceID)
+	}
+	done := d.metrics.start(opCreateVolume)
+	defer func() { done(err) }()
 	// DEBUG only, secrets exposed in args
 	// klog.Infof("CreateVolume: called with args: %#v", req)
 
@@ -75,8 +96,22 @@ func (d *controllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 
 	volumeId := req.Name
 	subPath := req.Name
-	secrets := req.Secrets
+	secrets, err := fetchExternalSecrets(ctx, req.Secrets, req.Parameters)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "Could not fetch secrets of volume %s: %v", volumeId, err)
+	}
 	log.Info("Secrets contains keys", "secretKeys", reflect.ValueOf(secrets).MapKeys())
+	if err := d.metaProber.Allow(secrets); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "%v", err)
+	}
+
+	by, err := d.provisionPausedBy(ctx, req.Parameters)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not check if provisioning is paused: %v", err)
+	}
+	if by != "" {
+		return nil, status.Errorf(codes.Unavailable, "Provisioning is paused by %s, remove annotation %s to resume", by, common.PausedAnnotationKey)
+	}
 
 	requiredCap := req.CapacityRange.GetRequiredBytes()
 	if capa, ok := d.vols[req.Name]; ok && capa < requiredCap {
@@ -92,6 +127,9 @@ func (d *controllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}
 		volCtx[k] = v
 	}
+	if _, err := config.ParseVolumeContext(volCtx, true); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
 	// return error if set readonly in dynamic provisioner
 	for _, vc := range req.VolumeCapabilities {
 		if vc.AccessMode.GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY {
@@ -104,6 +142,18 @@ func (d *controllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 	//	return nil, status.Errorf(codes.Internal, "Could not createVol in juicefs: %v", err)
 	//}
 
+	// restore from snapshot
+	if src := req.GetVolumeContentSource(); src != nil {
+		snapshotPath, err := getSnapshotPath(src)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("restore volume from snapshot", "volumeId", volumeId, "snapshot", snapshotPath)
+		if err := d.juicefs.JfsCloneVol(ctx, volumeId, snapshotPath, subPath, secrets, volCtx); err != nil {
+			return nil, status.Errorf(codes.Internal, "Could not restore volume from snapshot %s: %v", snapshotPath, err)
+		}
+	}
+
 	// check if use pathpattern
 	if req.Parameters["pathPattern"] != "" {
 		log.Info("volume uses pathPattern, please enable provisioner in CSI Controller, not works in default mode.", "volumeId", volumeId)
@@ -113,19 +163,55 @@ func (d *controllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		log.Info("volume uses secretFinalizer, please enable provisioner in CSI Controller, not works in default mode.", "volumeId", volumeId)
 	}
 
+	dirTree, err := d.volumeDirTree(ctx, req.Parameters)
+	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "Could not resolve directory tree: %v", err)
+	}
+	if dirTree != "" {
+		volCtx[common.DirTreeSpecKey] = dirTree
+	}
+
 	volCtx["subPath"] = subPath
 	volCtx["capacity"] = strconv.FormatInt(requiredCap, 10)
+	if config.BucketPerVolume(volCtx) {
+		if _, err := config.VolumeSecrets(secrets, volumeId); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		log.Info("format dedicated file system of volume", "volumeId", volumeId)
+		if err := d.juicefs.JfsFormatVol(ctx, volumeId, secrets, volCtx); err != nil {
+			return nil, status.Errorf(codes.Internal, "Could not format file system of volume %s: %v", volumeId, err)
+		}
+	}
 	volume := csi.Volume{
 		VolumeId:      volumeId,
 		CapacityBytes: requiredCap,
 		VolumeContext: volCtx,
+		ContentSource: req.GetVolumeContentSource(),
 	}
 	return &csi.CreateVolumeResponse{Volume: &volume}, nil
 }
 
+// getSnapshotPath returns the path of snapshot in the file system which the volume restores from
+func getSnapshotPath(src *csi.VolumeContentSource) (string, error) {
+	snapshot := src.GetSnapshot()
+	if snapshot == nil {
+		return "", status.Error(codes.InvalidArgument, "Only snapshot is supported as volume content source")
+	}
+	snapshotPath, err := client.SnapshotPath(snapshot.GetSnapshotId())
+	if err != nil {
+		return "", status.Errorf(codes.NotFound, "Snapshot %q not found: %v", snapshot.GetSnapshotId(), err)
+	}
+	return snapshotPath, nil
+}
+
 // DeleteVolume moves directory for the volume to trash (TODO)
-func (d *controllerService) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+func (d *controllerService) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (resp *csi.DeleteVolumeResponse, err error) {
 	log := klog.NewKlogr().WithName("DeleteVolume")
+	done := d.metrics.start(opDeleteVolume)
+	defer func() { done(err) }()
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
@@ -142,6 +228,18 @@ func (d *controllerService) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 	}
 
 	secrets := req.Secrets
+	if !config.ByProcess && d.k8sClient != nil {
+		// secrets of the volume may be in the external secret provider, the PV is loaded by JfsDeleteVol again
+		pv, err := d.k8sClient.GetPersistentVolume(ctx, volumeID)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.Internal, "Could not get PV of volume %s: %v", volumeID, err)
+		}
+		if pv != nil && pv.Spec.CSI != nil {
+			if secrets, err = fetchExternalSecrets(ctx, secrets, pv.Spec.CSI.VolumeAttributes); err != nil {
+				return nil, status.Errorf(codes.Unavailable, "Could not fetch secrets of volume %s: %v", volumeID, err)
+			}
+		}
+	}
 	log.Info("Secrets contains keys", "secretKeys", reflect.ValueOf(secrets).MapKeys())
 	if len(secrets) == 0 {
 		log.Info("Secrets is empty, skip.")
@@ -164,12 +262,29 @@ func (d *controllerService) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 	return &csi.DeleteVolumeResponse{}, nil
 }
 
+// fetchExternalSecrets merges the secrets fetched from the external secret provider of the volume into secrets
+func fetchExternalSecrets(ctx context.Context, secrets, volCtx map[string]string) (map[string]string, error) {
+	if !secretprovider.Enabled(volCtx) {
+		return secrets, nil
+	}
+	fetched, err := secretprovider.Fetch(ctx, volCtx)
+	if err != nil {
+		return nil, err
+	}
+	return secretprovider.Merge(secrets, fetched), nil
+}
+
 // ControllerGetCapabilities gets capabilities
 func (d *controllerService) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
 	log := klog.NewKlogr().WithName("ControllerGetCapabilities")
 	log.V(1).Info("called with args", "args", req)
 	var caps []*csi.ControllerServiceCapability
 	for _, cap := range controllerCaps {
+		if cap == csi.ControllerServiceCapability_RPC_EXPAND_VOLUME && !d.quota.expandable() {
+			// resizes would be no-ops without quota
+			log.Info("volume expansion is not advertised, directory quota is not supported by the clients")
+			continue
+		}
 		c := &csi.ControllerServiceCapability{
 			Type: &csi.ControllerServiceCapability_Rpc{
 				Rpc: &csi.ControllerServiceCapability_RPC{
@@ -212,20 +327,101 @@ func (d *controllerService) ValidateVolumeCapabilities(ctx context.Context, req
 		return nil, status.Error(codes.InvalidArgument, "Volume capabilities not provided")
 	}
 
-	if _, ok := d.vols[volumeID]; !ok {
-		return nil, status.Errorf(codes.NotFound, "Could not get volume by ID %q", volumeID)
+	readOnly, err := d.volumeReadOnly(ctx, volumeID, req.GetVolumeContext())
+	if err != nil {
+		return nil, err
 	}
-
-	var confirmed *csi.ValidateVolumeCapabilitiesResponse_Confirmed
-	if isValidVolumeCapabilities(volCaps) {
-		confirmed = &csi.ValidateVolumeCapabilitiesResponse_Confirmed{VolumeCapabilities: volCaps}
+	for _, c := range volCaps {
+		if err := validateVolumeCapability(c, readOnly); err != nil {
+			log.Info("volume capability not supported", "volumeId", volumeID, "reason", err)
+			return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+		}
 	}
 
 	return &csi.ValidateVolumeCapabilitiesResponse{
-		Confirmed: confirmed,
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      req.GetVolumeContext(),
+			VolumeCapabilities: volCaps,
+			Parameters:         req.GetParameters(),
+		},
 	}, nil
 }
 
+// volumeReadOnly returns whether the volume can only be mounted read-only, i.e. volumes imported from another
+// cluster, mirrors, volumes mounted with ro, and PVs whose access modes are all ReadOnlyMany.
+// NotFound is returned if the volume is neither created by this controller nor found in PVs.
+func (d *controllerService) volumeReadOnly(ctx context.Context, volumeID string, volCtx map[string]string) (bool, error) {
+	vc, err := config.ParseVolumeContext(volCtx, false)
+	if err != nil {
+		return false, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	readOnly := vc.ImportedFrom != "" || volCtx[common.MirrorOfKey] != "" || util.ContainsString(vc.MountOptions, "ro")
+	if _, ok := d.vols[volumeID]; ok {
+		return readOnly, nil
+	}
+	if d.k8sClient == nil {
+		return false, status.Errorf(codes.NotFound, "Could not get volume by ID %q", volumeID)
+	}
+	pvs, err := d.k8sClient.ListPersistentVolumesByVolumeHandle(ctx, volumeID)
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "Could not list PVs of volume %q: %v", volumeID, err)
+	}
+	if len(pvs) == 0 {
+		return false, status.Errorf(codes.NotFound, "Could not get volume by ID %q", volumeID)
+	}
+	pv := pvs[0]
+	readOnlyMany := len(pv.Spec.AccessModes) > 0
+	for _, m := range pv.Spec.AccessModes {
+		if m != corev1.ReadOnlyMany {
+			readOnlyMany = false
+		}
+	}
+	return readOnly || readOnlyMany || util.ContainsString(pv.Spec.MountOptions, "ro"), nil
+}
+
+// validateVolumeCapability returns why the capability is not supported by the volume, nil if it's supported:
+// only mount access type with the juicefs fs type, well-formed mount flags, and reader-only access mode if the
+// volume can only be mounted read-only. Block volumes are not supported, as JuiceFS is a file system.
+func validateVolumeCapability(c *csi.VolumeCapability, readOnly bool) error {
+	if c.GetAccessMode() == nil {
+		return fmt.Errorf("access mode is not provided")
+	}
+	mode := c.GetAccessMode().GetMode()
+	supported := false
+	for i := range volumeCaps {
+		if volumeCaps[i].GetMode() == mode {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("access mode %s is not supported", mode)
+	}
+	if readOnly && mode != csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY {
+		return fmt.Errorf("volume is read-only, access mode %s is not supported", mode)
+	}
+
+	switch t := c.GetAccessType().(type) {
+	case *csi.VolumeCapability_Block:
+		return fmt.Errorf("block access type is not supported")
+	case *csi.VolumeCapability_Mount:
+		if fsType := t.Mount.GetFsType(); fsType != "" && fsType != config.FsType {
+			return fmt.Errorf("fs type %s is not supported, only %s", fsType, config.FsType)
+		}
+		for _, flag := range t.Mount.GetMountFlags() {
+			kv := strings.Split(strings.TrimSpace(flag), "=")
+			if kv[0] == "" || len(kv) > 2 {
+				return fmt.Errorf("invalid mount flag %q", flag)
+			}
+			if kv[0] == "rw" && readOnly {
+				return fmt.Errorf("volume is read-only, mount flag rw is not supported")
+			}
+		}
+	default:
+		return fmt.Errorf("access type is not provided")
+	}
+	return nil
+}
+
 func isValidVolumeCapabilities(volCaps []*csi.VolumeCapability) bool {
 	hasSupport := func(cap *csi.VolumeCapability) bool {
 		switch cap.GetAccessType().(type) {
@@ -253,14 +449,91 @@ func isValidVolumeCapabilities(volCaps []*csi.VolumeCapability) bool {
 	return foundAll
 }
 
-// CreateSnapshot unimplemented
+// CreateSnapshot clones the directory of source volume into snapshot directory,
+// the snapshot is ready to use as soon as the clone finishes.
 func (d *controllerService) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+	log := klog.NewKlogr().WithName("CreateSnapshot")
+	name, sourceVolumeID, secrets := req.GetName(), req.GetSourceVolumeId(), req.GetSecrets()
+	log.V(1).Info("called with args", "name", name, "sourceVolumeId", sourceVolumeID, "secrets", util.StripSecret(secrets))
+
+	if len(name) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot Name cannot be empty")
+	}
+	if len(sourceVolumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Source Volume ID cannot be empty")
+	}
+
+	snapshotID := client.SnapshotID(sourceVolumeID, name)
+	if acquired := d.volLocks.TryAcquire(snapshotID); !acquired {
+		log.Info("Snapshot is being used by another operation", "snapshotId", snapshotID)
+		return nil, status.Errorf(codes.Aborted, "CreateSnapshot: Snapshot %q is being used by another operation", snapshotID)
+	}
+	defer d.volLocks.Release(snapshotID)
+
+	snap, err := d.snapshots.get(ctx, name)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not get record of snapshot %q: %v", name, err)
+	}
+	if snap != nil {
+		if snap.SourceVolumeId != sourceVolumeID {
+			return nil, status.Errorf(codes.AlreadyExists, "Snapshot %q already exists with source volume %q", name, snap.SourceVolumeId)
+		}
+		return &csi.CreateSnapshotResponse{Snapshot: snap}, nil
+	}
+
+	log.Info("Creating snapshot", "snapshotId", snapshotID)
+	created, err := client.NewWithProvider(d.juicefs).CreateSnapshot(ctx, sourceVolumeID, name, secrets)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not create snapshot in juicefs: %v", err)
+	}
+
+	snap = &csi.Snapshot{
+		SnapshotId:     created.ID,
+		SourceVolumeId: sourceVolumeID,
+		CreationTime:   timestamppb.New(created.CreationTime),
+		ReadyToUse:     true,
+	}
+	if err := d.snapshots.put(ctx, name, snap); err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not record snapshot %q: %v", name, err)
+	}
+	return &csi.CreateSnapshotResponse{Snapshot: snap}, nil
 }
 
-// DeleteSnapshot unimplemented
+// DeleteSnapshot deletes the directory of snapshot
 func (d *controllerService) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+	log := klog.NewKlogr().WithName("DeleteSnapshot")
+	snapshotID := req.GetSnapshotId()
+	if len(snapshotID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot ID not provided")
+	}
+	_, snapshotName, err := client.ParseSnapshotID(snapshotID)
+	if err != nil {
+		// snapshot not created by this driver, treat it as deleted
+		log.Info("Snapshot ID is invalid, ignore.", "snapshotId", snapshotID, "error", err)
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+
+	secrets := req.GetSecrets()
+	log.Info("Secrets contains keys", "secretKeys", reflect.ValueOf(secrets).MapKeys())
+	if len(secrets) == 0 {
+		// the directory of snapshot can't be deleted without the credentials, don't report it as deleted
+		return nil, status.Errorf(codes.InvalidArgument, "Secrets are required to delete snapshot %q, set %s and %s in VolumeSnapshotClass", snapshotID, common.SnapshotterSecretName, common.SnapshotterSecretNamespace)
+	}
+
+	if acquired := d.volLocks.TryAcquire(snapshotID); !acquired {
+		log.Info("Snapshot is being used by another operation", "snapshotId", snapshotID)
+		return nil, status.Errorf(codes.Aborted, "DeleteSnapshot: Snapshot %q is being used by another operation", snapshotID)
+	}
+	defer d.volLocks.Release(snapshotID)
+
+	log.Info("Deleting snapshot", "snapshotId", snapshotID)
+	if err := client.NewWithProvider(d.juicefs).DeleteSnapshot(ctx, snapshotID, secrets); err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not delete snapshot in juicefs: %v", err)
+	}
+	if err := d.snapshots.delete(ctx, snapshotName); err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not delete record of snapshot %q: %v", snapshotName, err)
+	}
+	return &csi.DeleteSnapshotResponse{}, nil
 }
 
 // ListSnapshots unimplemented
@@ -291,6 +564,12 @@ func (d *controllerService) ControllerExpandVolume(ctx context.Context, req *csi
 	if maxVolSize > 0 && maxVolSize < newSize {
 		return nil, status.Error(codes.InvalidArgument, "After round-up, volume size exceeds the limit specified")
 	}
+	if len(secrets) == 0 {
+		var err error
+		if secrets, err = d.expandSecrets(ctx, volumeID); err != nil {
+			return nil, status.Errorf(codes.Internal, "get secrets of volume %s: %v", volumeID, err)
+		}
+	}
 	options := []string{}
 
 	// get mount options
@@ -313,25 +592,16 @@ func (d *controllerService) ControllerExpandVolume(ctx context.Context, req *csi
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "get quotaPath error: %v", err)
 	}
-	settings, err := d.juicefs.Settings(ctx, volumeID, volumeID, secrets["name"], secrets, nil, options)
+	volumes := client.NewWithProvider(d.juicefs)
+	settings, err := volumes.Settings(ctx, volumeID, secrets, nil, options)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "get settings: %v", err)
+		return nil, status.Errorf(codes.Internal, "%v", err)
 	}
-
-	var subdir string
-	for _, o := range settings.Options {
-		pair := strings.Split(o, "=")
-		if len(pair) != 2 {
-			continue
-		}
-		if pair[0] == "subdir" {
-			subdir = path.Join("/", pair[1])
-		}
+	if err := d.quota.check(settings); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "can not expand volume %s: %v", volumeID, err)
 	}
-
-	err = d.juicefs.SetQuota(ctx, secrets, settings, path.Join(subdir, quotaPath), capacity)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "set quota: %v", err)
+	if err := volumes.SetCapacity(ctx, settings, quotaPath, secrets, capacity); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
 	}
 	return &csi.ControllerExpandVolumeResponse{
 		CapacityBytes:         newSize,
@@ -339,6 +609,50 @@ func (d *controllerService) ControllerExpandVolume(ctx context.Context, req *csi
 	}, nil
 }
 
+// expandSecrets returns the secrets for expanding volumes whose StorageClass has no controller-expand secret, from the
+// parameters of the StorageClass, or those kept on the PV if the StorageClass is deleted
+func (d *controllerService) expandSecrets(ctx context.Context, volumeID string) (map[string]string, error) {
+	if d.k8sClient == nil {
+		return nil, nil
+	}
+	pv, err := d.k8sClient.GetPersistentVolume(ctx, volumeID)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if pv.Spec.StorageClassName == "" {
+		return nil, nil
+	}
+	params, err := resource.StorageClassParameters(ctx, d.k8sClient, pv)
+	if err != nil {
+		return nil, err
+	}
+	vars := []string{"${pv.name}", pv.Name}
+	if ref := pv.Spec.ClaimRef; ref != nil {
+		vars = append(vars, "${pvc.namespace}", ref.Namespace, "${pvc.name}", ref.Name)
+	}
+	replacer := strings.NewReplacer(vars...)
+	for _, op := range []config.SecretOperation{config.SecretOpControllerExpand, config.SecretOpProvisioner} {
+		name, namespace := config.StorageClassSecret(params, op)
+		name, namespace = replacer.Replace(name), replacer.Replace(namespace)
+		if name == "" || namespace == "" || strings.Contains(name, "$") || strings.Contains(namespace, "$") {
+			continue
+		}
+		secret, err := d.k8sClient.GetSecret(ctx, name, namespace)
+		if err != nil {
+			return nil, err
+		}
+		secrets := make(map[string]string, len(secret.Data))
+		for k, v := range secret.Data {
+			secrets[k] = string(v)
+		}
+		return secrets, nil
+	}
+	return nil, nil
+}
+
 // ControllerPublishVolume unimplemented
 func (d *controllerService) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
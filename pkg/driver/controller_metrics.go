@@ -0,0 +1,85 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	opCreateVolume = "create_volume"
+	opDeleteVolume = "delete_volume"
+	opProvision    = "provision"
+	opDelete       = "delete"
+)
+
+// controllerMetrics instruments the volume operations of CSI Controller and provisioner
+type controllerMetrics struct {
+	duration *prometheus.HistogramVec
+	failures *prometheus.CounterVec
+	inFlight *prometheus.GaugeVec
+}
+
+func newControllerMetrics(reg prometheus.Registerer) *controllerMetrics {
+	metrics := &controllerMetrics{}
+	metrics.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "controller_operation_duration_seconds",
+		Help:    "latency of volume operations in controller",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"operation", "result"})
+	metrics.failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "controller_operation_failures_total",
+		Help: "number of failed volume operations in controller by gRPC code",
+	}, []string{"operation", "code"})
+	metrics.inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "controller_operations_in_flight",
+		Help: "number of volume operations in progress, including the ones waiting for volume lock",
+	}, []string{"operation"})
+	reg.MustRegister(metrics.duration, metrics.failures, metrics.inFlight)
+	return metrics
+}
+
+// start marks an operation in progress, and returns the function to record its result
+func (m *controllerMetrics) start(op string) func(err error) {
+	if m == nil {
+		return func(error) {}
+	}
+	start := time.Now()
+	m.inFlight.WithLabelValues(op).Inc()
+	return func(err error) {
+		m.inFlight.WithLabelValues(op).Dec()
+		result := "success"
+		if err != nil {
+			result = "failure"
+			m.failures.WithLabelValues(op, failureCode(err).String()).Inc()
+		}
+		m.duration.WithLabelValues(op, result).Observe(time.Since(start).Seconds())
+	}
+}
+
+// failureCode returns the gRPC code of the error of volume operations, errors without a code are Unknown,
+// unless they are caused by ctx
+func failureCode(err error) codes.Code {
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	return status.FromContextError(err).Code()
+}
@@ -0,0 +1,68 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFailureCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{status.Error(codes.InvalidArgument, "invalid volume context"), codes.InvalidArgument},
+		{status.Error(codes.Unavailable, "metadata engine is unreachable"), codes.Unavailable},
+		{fmt.Errorf("provision error: %w", context.DeadlineExceeded), codes.DeadlineExceeded},
+		{errors.New("juicefs auth error: invalid token"), codes.Unknown},
+	}
+	for _, tt := range tests {
+		if got := failureCode(tt.err); got != tt.want {
+			t.Errorf("failureCode(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestControllerMetrics(t *testing.T) {
+	m := newControllerMetrics(prometheus.NewRegistry())
+	done := m.start(opProvision)
+	if v := testutil.ToFloat64(m.inFlight.WithLabelValues(opProvision)); v != 1 {
+		t.Errorf("in flight = %v, want 1", v)
+	}
+	done(status.Error(codes.Unavailable, "metadata engine is unreachable"))
+	if v := testutil.ToFloat64(m.inFlight.WithLabelValues(opProvision)); v != 0 {
+		t.Errorf("in flight = %v, want 0", v)
+	}
+	if v := testutil.ToFloat64(m.failures.WithLabelValues(opProvision, codes.Unavailable.String())); v != 1 {
+		t.Errorf("failures = %v, want 1", v)
+	}
+	if c := testutil.CollectAndCount(m.duration); c != 1 {
+		t.Errorf("duration series = %v, want 1", c)
+	}
+
+	// nil metrics are ignored
+	var nilMetrics *controllerMetrics
+	nilMetrics.start(opDelete)(nil)
+}
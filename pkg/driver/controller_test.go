@@ -19,7 +19,9 @@ package driver
 import (
 	"context"
 	"errors"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -29,8 +31,13 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
 	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
@@ -242,6 +249,39 @@ func TestCreateVolume(t *testing.T) {
 					vols:    make(map[string]int64),
 				}
 
+				_, err := juicefsDriver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatalf("error is nil")
+				}
+				srvErr, ok := status.FromError(err)
+				if !ok {
+					t.Fatalf("Could not get error status code from error: %v", srvErr)
+				}
+				if srvErr.Code() != codes.InvalidArgument {
+					t.Fatalf("error status code is not invalid: %v", srvErr.Code())
+				}
+			},
+		},
+		{
+			name: "invalid parameters",
+			testFunc: func(t *testing.T) {
+				volumeId := "vol-test"
+				secret := map[string]string{"a": "b"}
+				volCtx := map[string]string{"c": "d", common.MountPodCpuLimitKey: "1 core"}
+				req := &csi.CreateVolumeRequest{
+					Name:               volumeId,
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Secrets:            secret,
+					Parameters:         volCtx,
+				}
+
+				ctx := context.Background()
+				juicefsDriver := controllerService{
+					juicefs: nil,
+					vols:    make(map[string]int64),
+				}
+
 				_, err := juicefsDriver.CreateVolume(ctx, req)
 				if err == nil {
 					t.Fatalf("error is nil")
@@ -304,6 +344,46 @@ func TestDeleteVolume(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "secrets from secret provider",
+			testFunc: func(t *testing.T) {
+				volumeId := "pvc-95aba554-3fe4-4433-9d25-d2a63a114367"
+				root := t.TempDir()
+				t.Setenv("SECRETS_STORE_DIR", root)
+				if err := os.MkdirAll(filepath.Join(root, "juicefs"), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(root, "juicefs", "metaurl"), []byte("redis://127.0.0.1/1"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				pv := &corev1.PersistentVolume{
+					ObjectMeta: metav1.ObjectMeta{Name: volumeId},
+					Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+						VolumeHandle: volumeId,
+						VolumeAttributes: map[string]string{
+							common.SecretProviderKey: "secrets-store",
+							common.SecretPathKey:     "juicefs",
+						},
+					}}},
+				}
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+				mockJuicefs := mocks.NewMockInterface(mockCtl)
+				mockJuicefs.EXPECT().JfsDeleteVol(context.Background(), volumeId, volumeId, map[string]string{"metaurl": "redis://127.0.0.1/1"}, nil, nil).Return(nil)
+
+				juicefsDriver := controllerService{
+					juicefs:   mockJuicefs,
+					k8sClient: &k8s.K8sClient{Interface: fake.NewSimpleClientset(pv)},
+					vols:      map[string]int64{},
+					volLocks:  resource.NewVolumeLocks(),
+				}
+				_, err := juicefsDriver.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: volumeId})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			},
+		},
 		{
 			name: "volumeId nil",
 			testFunc: func(t *testing.T) {
@@ -436,6 +516,13 @@ func TestControllerGetCapabilities(t *testing.T) {
 							},
 						},
 					},
+					{
+						Type: &csi.ControllerServiceCapability_Rpc{
+							Rpc: &csi.ControllerServiceCapability_RPC{
+								Type: csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+							},
+						},
+					},
 				},
 			},
 			wantErr: false,
@@ -553,6 +640,72 @@ func Test_controllerService_ValidateVolumeCapabilities(t *testing.T) {
 	}
 }
 
+func TestValidateVolumeCapabilitiesMatrix(t *testing.T) {
+	mountCap := func(mode csi.VolumeCapability_AccessMode_Mode, fsType string, flags ...string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: fsType, MountFlags: flags}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+		}
+	}
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "static-pv"},
+		Spec: corev1.PersistentVolumeSpec{
+			AccessModes:            []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: config.DriverName, VolumeHandle: "static"}},
+		},
+	}
+	d := controllerService{
+		k8sClient: &k8s.K8sClient{Interface: fake.NewSimpleClientset(pv)},
+		vols:      map[string]int64{"dynamic": 1},
+	}
+	rwx := csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+	rox := csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY
+	tests := []struct {
+		name     string
+		volumeID string
+		volCtx   map[string]string
+		cap      *csi.VolumeCapability
+		reason   string
+	}{
+		{name: "rwx", volumeID: "dynamic", cap: mountCap(rwx, "juicefs", "cache-size=1024", "ro")},
+		{name: "block", volumeID: "dynamic", cap: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: rwx},
+		}, reason: "block access type is not supported"},
+		{name: "fs type", volumeID: "dynamic", cap: mountCap(rwx, "ext4"), reason: "fs type ext4 is not supported, only juicefs"},
+		{name: "mount flag", volumeID: "dynamic", cap: mountCap(rwx, "", "a=b=c"), reason: `invalid mount flag "a=b=c"`},
+		{name: "access mode", volumeID: "dynamic", cap: mountCap(csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY, ""),
+			reason: "access mode SINGLE_NODE_READER_ONLY is not supported"},
+		{name: "imported", volumeID: "dynamic", volCtx: map[string]string{common.ImportedFromKey: "east"}, cap: mountCap(rwx, ""),
+			reason: "volume is read-only, access mode MULTI_NODE_MULTI_WRITER is not supported"},
+		{name: "rox pv", volumeID: "static", cap: mountCap(rox, "")},
+		{name: "rox pv rw", volumeID: "static", cap: mountCap(rox, "", "rw"), reason: "volume is read-only, mount flag rw is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.ValidateVolumeCapabilities(context.TODO(), &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           tt.volumeID,
+				VolumeContext:      tt.volCtx,
+				VolumeCapabilities: []*csi.VolumeCapability{tt.cap},
+			})
+			if err != nil {
+				t.Fatalf("ValidateVolumeCapabilities() error = %v", err)
+			}
+			if (got.Confirmed == nil) != (tt.reason != "") || got.Message != tt.reason {
+				t.Errorf("ValidateVolumeCapabilities() got = %v, want reason %q", got, tt.reason)
+			}
+		})
+	}
+
+	_, err := d.ValidateVolumeCapabilities(context.TODO(), &csi.ValidateVolumeCapabilitiesRequest{
+		VolumeId:           "unknown",
+		VolumeCapabilities: []*csi.VolumeCapability{mountCap(rwx, "")},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ValidateVolumeCapabilities() of unknown volume error = %v, want NotFound", err)
+	}
+}
+
 func Test_isValidVolumeCapabilities(t *testing.T) {
 	type args struct {
 		volCaps []*csi.VolumeCapability
@@ -776,6 +929,99 @@ func Test_controllerService_DeleteSnapshot(t *testing.T) {
 	}
 }
 
+func TestSnapshot(t *testing.T) {
+	Convey("Test CreateSnapshot and DeleteSnapshot", t, func() {
+		secrets := map[string]string{"name": "test"}
+		Convey("create snapshot", func() {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockJuicefs := mocks.NewMockInterface(mockCtl)
+			mockJuicefs.EXPECT().GetSubPath(context.TODO(), "pvc-a").Return("pvc-a", nil)
+			mockJuicefs.EXPECT().JfsCloneVol(context.TODO(), "snapshot-a-6549f38f", "pvc-a", ".snapshots/pvc-a/snapshot-a", secrets, nil).Return(nil)
+			k8sClient := &k8s.K8sClient{Interface: fake.NewSimpleClientset()}
+			d := controllerService{
+				juicefs:   mockJuicefs,
+				snapshots: newSnapshotStore(k8sClient),
+				volLocks:  resource.NewVolumeLocks(),
+			}
+			req := &csi.CreateSnapshotRequest{SourceVolumeId: "pvc-a", Name: "snapshot-a", Secrets: secrets}
+			got, err := d.CreateSnapshot(context.TODO(), req)
+			So(err, ShouldBeNil)
+			So(got.Snapshot.SnapshotId, ShouldEqual, "pvc-a/snapshot-a")
+			So(got.Snapshot.ReadyToUse, ShouldBeTrue)
+
+			// create again with the same name should be idempotent
+			again, err := d.CreateSnapshot(context.TODO(), req)
+			So(err, ShouldBeNil)
+			So(again.Snapshot.SnapshotId, ShouldEqual, got.Snapshot.SnapshotId)
+			So(again.Snapshot.CreationTime.AsTime().Equal(got.Snapshot.CreationTime.AsTime()), ShouldBeTrue)
+
+			// the snapshot is still known after CSI Controller restarts
+			d.snapshots = newSnapshotStore(k8sClient)
+			again, err = d.CreateSnapshot(context.TODO(), req)
+			So(err, ShouldBeNil)
+			So(again.Snapshot.SnapshotId, ShouldEqual, got.Snapshot.SnapshotId)
+
+			// create with the same name but different source volume
+			_, err = d.CreateSnapshot(context.TODO(), &csi.CreateSnapshotRequest{SourceVolumeId: "pvc-b", Name: "snapshot-a", Secrets: secrets})
+			So(status.Code(err), ShouldEqual, codes.AlreadyExists)
+		})
+		Convey("delete snapshot", func() {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockJuicefs := mocks.NewMockInterface(mockCtl)
+			mockJuicefs.EXPECT().JfsDeleteSnapshot(context.TODO(), "snapshot-a-6549f38f", ".snapshots/pvc-a/snapshot-a", secrets).Return(nil)
+			k8sClient := &k8s.K8sClient{Interface: fake.NewSimpleClientset()}
+			d := controllerService{
+				juicefs:   mockJuicefs,
+				snapshots: newSnapshotStore(k8sClient),
+				volLocks:  resource.NewVolumeLocks(),
+			}
+			So(d.snapshots.put(context.TODO(), "snapshot-a", &csi.Snapshot{SnapshotId: "pvc-a/snapshot-a", SourceVolumeId: "pvc-a", CreationTime: timestamppb.Now()}), ShouldBeNil)
+
+			// the directory can't be deleted without secrets
+			_, err := d.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{SnapshotId: "pvc-a/snapshot-a"})
+			So(status.Code(err), ShouldEqual, codes.InvalidArgument)
+
+			_, err = d.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{SnapshotId: "pvc-a/snapshot-a", Secrets: secrets})
+			So(err, ShouldBeNil)
+			snap, err := d.snapshots.get(context.TODO(), "snapshot-a")
+			So(err, ShouldBeNil)
+			So(snap, ShouldBeNil)
+
+			// invalid snapshot id is treated as deleted
+			_, err = d.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{SnapshotId: "invalid", Secrets: secrets})
+			So(err, ShouldBeNil)
+		})
+		Convey("restore volume from snapshot", func() {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+			mockJuicefs := mocks.NewMockInterface(mockCtl)
+			mockJuicefs.EXPECT().JfsCloneVol(context.TODO(), "pvc-b", ".snapshots/pvc-a/snapshot-a", "pvc-b", secrets, gomock.Any()).Return(nil)
+			d := controllerService{
+				juicefs: mockJuicefs,
+				vols:    make(map[string]int64),
+			}
+			source := &csi.VolumeContentSource{
+				Type: &csi.VolumeContentSource_Snapshot{
+					Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "pvc-a/snapshot-a"},
+				},
+			}
+			got, err := d.CreateVolume(context.TODO(), &csi.CreateVolumeRequest{
+				Name: "pvc-b",
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+				}},
+				Secrets:             secrets,
+				VolumeContentSource: source,
+			})
+			So(err, ShouldBeNil)
+			So(got.Volume.ContentSource, ShouldEqual, source)
+		})
+	})
+}
+
 func Test_controllerService_ListSnapshots(t *testing.T) {
 	type fields struct {
 		juicefs juicefs.Interface
@@ -901,3 +1147,33 @@ func Test_controllerService_ControllerUnpublishVolume(t *testing.T) {
 		})
 	}
 }
+
+func Test_controllerService_expandSecrets(t *testing.T) {
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pvc-a",
+			// the storageclass is deleted, its parameters are kept on the pv
+			Annotations: map[string]string{common.StorageClassParametersKey: `{"csi.storage.k8s.io/provisioner-secret-name":"jfs-${pvc.namespace}","csi.storage.k8s.io/provisioner-secret-namespace":"kube-system"}`},
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			StorageClassName: "juicefs-sc",
+			ClaimRef:         &corev1.ObjectReference{Namespace: "team-a", Name: "data"},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "jfs-team-a", Namespace: "kube-system"},
+		Data:       map[string][]byte{"name": []byte("myjfs")},
+	}
+	d := controllerService{k8sClient: &k8s.K8sClient{Interface: fake.NewSimpleClientset(pv, secret)}}
+
+	secrets, err := d.expandSecrets(context.TODO(), "pvc-a")
+	if err != nil {
+		t.Fatalf("expandSecrets() error = %v", err)
+	}
+	if !reflect.DeepEqual(secrets, map[string]string{"name": "myjfs"}) {
+		t.Errorf("expandSecrets() = %v, want secrets of jfs-team-a", secrets)
+	}
+	if secrets, err := d.expandSecrets(context.TODO(), "pvc-b"); err != nil || secrets != nil {
+		t.Errorf("expandSecrets() of unknown pv = %v, %v, want none", secrets, err)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+// resolveDirTree reads the directory tree of the new volume from the configmap referred by the PVC annotation,
+// or the StorageClass parameter, and returns it encoded for common.DirTreeSpecKey, empty if not referred.
+// Invalid references and trees are reported as codes.InvalidArgument.
+// The tree is stored in the PV, so that CSI Node needs no access to configmaps, and later changes
+// of the configmap only apply to new volumes.
+func resolveDirTree(ctx context.Context, client *k8sclient.K8sClient, params map[string]string, pvc *corev1.PersistentVolumeClaim) (string, error) {
+	ref, namespace, fromPVC := params[common.DirTreeKey], "", false
+	if pvc != nil {
+		namespace = pvc.Namespace
+		if v := pvc.Annotations[common.DirTreeKey]; v != "" {
+			ref, fromPVC = v, true
+		}
+	}
+	if ref == "" {
+		return "", nil
+	}
+	if client == nil {
+		return "", status.Errorf(codes.InvalidArgument, "%s is not supported without kubernetes", common.DirTreeKey)
+	}
+	namespace, name, err := config.ParseDirTreeRef(ref, namespace)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if fromPVC && namespace != pvc.Namespace {
+		// owners of PVCs must not read configmaps in other namespaces through the driver
+		return "", status.Errorf(codes.InvalidArgument, "%s of PVC can only refer to configmaps in its namespace %s", common.DirTreeKey, pvc.Namespace)
+	}
+	cm, err := client.GetConfigMap(ctx, name, namespace)
+	if err != nil {
+		return "", fmt.Errorf("get directory tree of %s: %v", common.DirTreeKey, err)
+	}
+	entries, err := config.ParseDirTree(cm.Data[config.DirTreeConfigMapKey])
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "configmap %s/%s: %v", namespace, name, err)
+	}
+	return config.EncodeDirTree(entries), nil
+}
+
+// createDirTree creates the directories of the tree missing in the volume, with their modes and owners.
+// Existing ones are left as they are, so that changes made by applications are kept across mounts.
+// The volume is writable by applications, so the path is walked without following symlinks, otherwise a symlink
+// planted in the volume makes the node service create, chmod and chown directories on the host.
+func createDirTree(ctx context.Context, root string, entries []config.DirTreeEntry) error {
+	log := util.GenLog(ctx, driverLog, "createDirTree")
+	for _, e := range entries {
+		err := util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) error {
+			fd, created, err := mkdirNoFollow(root, e.Path)
+			if err != nil {
+				return err
+			}
+			defer syscall.Close(fd)
+			if !created {
+				return nil
+			}
+			// fchmod keeps setuid, setgid and sticky bits of a raw mode
+			if err := syscall.Fchmod(fd, e.FileMode()); err != nil {
+				return err
+			}
+			if e.UID == nil && e.GID == nil {
+				return nil
+			}
+			uid, gid := -1, -1
+			if e.UID != nil {
+				uid = int(*e.UID)
+			}
+			if e.GID != nil {
+				gid = int(*e.GID)
+			}
+			return syscall.Fchown(fd, uid, gid)
+		})
+		if err != nil {
+			return fmt.Errorf("create %s of directory tree: %v", e.Path, err)
+		}
+		log.V(1).Info("directory of tree is ready", "path", e.Path)
+	}
+	return nil
+}
+
+// mkdirNoFollow creates the missing directories of path under root one by one, and opens the last one.
+// Every component is opened relative to its parent with O_NOFOLLOW, so that symlinks in the path are
+// refused instead of resolved. created is whether the last directory is created by the call.
+func mkdirNoFollow(root, path string) (fd int, created bool, err error) {
+	fd, err = syscall.Open(root, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, false, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	current := root
+	for _, name := range strings.Split(strings.TrimPrefix(filepath.Clean("/"+path), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		current = filepath.Join(current, name)
+		created = false
+		if err = syscall.Mkdirat(fd, name, 0777); err == nil {
+			created = true
+		} else if err != syscall.EEXIST {
+			syscall.Close(fd)
+			return -1, false, &os.PathError{Op: "mkdir", Path: current, Err: err}
+		}
+		child, err := syscall.Openat(fd, name, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+		syscall.Close(fd)
+		if err != nil {
+			if err == syscall.ELOOP || err == syscall.ENOTDIR {
+				err = fmt.Errorf("not a directory, symlinks are not followed")
+			}
+			return -1, false, &os.PathError{Op: "open", Path: current, Err: err}
+		}
+		fd = child
+	}
+	return fd, created, nil
+}
+
+// volumeDirTree resolves the directory tree of the volume in CreateVolume. The PVC annotation is only
+// known when csi-provisioner runs with --extra-create-metadata.
+func (d *controllerService) volumeDirTree(ctx context.Context, params map[string]string) (string, error) {
+	var pvc *corev1.PersistentVolumeClaim
+	name, namespace := params[common.PVCNameKey], params[common.PVCNamespaceKey]
+	if d.k8sClient != nil && name != "" && namespace != "" {
+		var err error
+		if pvc, err = d.k8sClient.GetPersistentVolumeClaim(ctx, name, namespace); err != nil {
+			return "", err
+		}
+	}
+	return resolveDirTree(ctx, d.k8sClient, params, pvc)
+}
@@ -0,0 +1,117 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestResolveDirTree(t *testing.T) {
+	ctx := context.TODO()
+	newCM := func(namespace, name, tree string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       map[string]string{config.DirTreeConfigMapKey: tree},
+		}
+	}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		newCM("default", "tree", "- path: data\n  mode: \"0750\"\n"),
+		newCM("kube-system", "tree", "- path: shared\n"),
+		newCM("default", "app-tree", "- path: app\n"),
+		newCM("default", "invalid", "- path: /data\n"),
+	)}
+	pvc := func(annotations map[string]string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "default", Annotations: annotations}}
+	}
+
+	got, err := resolveDirTree(ctx, client, map[string]string{}, pvc(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "", got)
+
+	got, err = resolveDirTree(ctx, client, map[string]string{common.DirTreeKey: "tree"}, pvc(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"path":"data","mode":"0750"}]`, got)
+
+	// PVC annotation takes precedence over StorageClass parameter
+	got, err = resolveDirTree(ctx, client, map[string]string{common.DirTreeKey: "tree"}, pvc(map[string]string{common.DirTreeKey: "app-tree"}))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"path":"app"}]`, got)
+
+	// PVC annotation can't refer to configmaps in other namespaces, while StorageClass parameter can
+	_, err = resolveDirTree(ctx, client, map[string]string{}, pvc(map[string]string{common.DirTreeKey: "kube-system/tree"}))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	got, err = resolveDirTree(ctx, client, map[string]string{common.DirTreeKey: "kube-system/tree"}, pvc(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"path":"shared"}]`, got)
+
+	_, err = resolveDirTree(ctx, client, map[string]string{common.DirTreeKey: "invalid"}, pvc(nil))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = resolveDirTree(ctx, client, map[string]string{common.DirTreeKey: "missing"}, pvc(nil))
+	assert.Error(t, err)
+	assert.NotEqual(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCreateDirTree(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "existing"), 0700))
+	uid, gid := int64(os.Getuid()), int64(os.Getgid())
+	entries := []config.DirTreeEntry{
+		{Path: "data/logs", Mode: "0750", UID: &uid, GID: &gid},
+		{Path: "shared", Mode: "1777"},
+		{Path: "existing", Mode: "0755"},
+	}
+	assert.NoError(t, createDirTree(context.TODO(), root, entries))
+
+	fi, err := os.Stat(filepath.Join(root, "data/logs"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.ModeDir|0750, fi.Mode())
+	fi, err = os.Stat(filepath.Join(root, "shared"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.ModeDir|os.ModeSticky|0777, fi.Mode())
+	// existing directories are not changed
+	fi, err = os.Stat(filepath.Join(root, "existing"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.ModeDir|0700, fi.Mode())
+
+	// symlinks planted in the volume are not followed
+	outside := t.TempDir()
+	before, err := os.Stat(outside)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+	assert.Error(t, createDirTree(context.TODO(), root, []config.DirTreeEntry{{Path: "escape/host", Mode: "0777"}}))
+	assert.Error(t, createDirTree(context.TODO(), root, []config.DirTreeEntry{{Path: "escape", Mode: "0777"}}))
+	_, err = os.Stat(filepath.Join(outside, "host"))
+	assert.True(t, os.IsNotExist(err))
+	fi, err = os.Stat(outside)
+	assert.NoError(t, err)
+	assert.Equal(t, before.Mode(), fi.Mode())
+}
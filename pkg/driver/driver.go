@@ -25,6 +25,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 	"k8s.io/klog/v2"
+	k8sexec "k8s.io/utils/exec"
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
@@ -45,6 +46,11 @@ type Driver struct {
 
 	srv      *grpc.Server
 	endpoint string
+	inflight *inflightTracker
+	stopped  chan struct{}
+	orphans  *orphanAuditor
+	capacity *capacitySyncer
+	stale    *staleSessionReaper
 }
 
 // NewDriver creates a new driver
@@ -78,14 +84,64 @@ func NewDriver(endpoint string, nodeID string,
 		return nil, err
 	}
 
+	prober := newMetaProber(cs.juicefs, reg)
+	cs.metaProber = prober
+	ps.metaProber = prober
+	metrics := newControllerMetrics(reg)
+	cs.metrics = metrics
+	ps.opMetrics = metrics
+	var orphans *orphanAuditor
+	var capacity *capacitySyncer
+	var stale *staleSessionReaper
+	if k8sClient != nil {
+		orphans = newOrphanAuditor(cs.juicefs, k8sClient, reg)
+		capacity = newCapacitySyncer(cs.juicefs, k8sClient, reg)
+		stale = newStaleSessionReaper(cs.juicefs, k8sClient, reg)
+	}
+
 	return &Driver{
 		controllerService:  cs,
 		nodeService:        *ns,
 		provisionerService: ps,
 		endpoint:           endpoint,
+		inflight:           newInflightTracker(),
+		stopped:            make(chan struct{}),
+		orphans:            orphans,
+		capacity:           capacity,
+		stale:              stale,
 	}, nil
 }
 
+// DetectQuotaSupport detects if the juicefs clients support directory quota, it's run in CSI Controller
+// before serving, since only CSI Controller sets quota with them, unless config.AdminByJob is set
+func (d *Driver) DetectQuotaSupport() {
+	if !config.AdminByJob {
+		d.controllerService.quota = detectQuotaSupport(k8sexec.New())
+	}
+}
+
+// RecoverNode recovers the state of the node left by the last exit, it's run in CSI Node before serving,
+// so that the recovery doesn't race with retries of kubelet. CSI Controller doesn't own the mounts of its node.
+func (d *Driver) RecoverNode(ctx context.Context) {
+	// clean up the operations interrupted by the last exit
+	ops, err := loadInflight(config.InflightStatePath)
+	if err != nil {
+		driverLog.Error(err, "load interrupted operations error", "path", config.InflightStatePath)
+	} else if len(ops) > 0 {
+		d.nodeService.recoverInterrupted(ctx, ops)
+	}
+	// verify the mounts left intact by the last version exiting in upgrade-safe mode are adopted
+	if state, err := loadHandover(config.HandoverStatePath); err != nil {
+		driverLog.Error(err, "load handover state error", "path", config.HandoverStatePath)
+	} else if state != nil {
+		d.nodeService.adoptHandover(ctx, state)
+	}
+	// keep checking the primary of volumes mounted from their mirror before the restart
+	d.nodeService.mirrors.restore(ctx)
+	// mount pods created by older versions may lack what this version looks them up by
+	d.nodeService.adoptLegacyMountPods(ctx)
+}
+
 // Run runs the server
 func (d *Driver) Run() error {
 	if config.Provisioner {
@@ -109,7 +165,7 @@ func (d *Driver) Run() error {
 		return resp, err
 	}
 	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(logErr),
+		grpc.ChainUnaryInterceptor(logErr, traceRPC, d.inflight.intercept),
 	}
 	d.srv = grpc.NewServer(opts...)
 
@@ -118,11 +174,60 @@ func (d *Driver) Run() error {
 	csi.RegisterNodeServer(d.srv, d)
 
 	driverLog.Info("Listening for connection on address", "address", listener.Addr())
-	return d.srv.Serve(listener)
+	if err := d.srv.Serve(listener); err != nil {
+		return err
+	}
+	// Serve returns once Stop is called, wait for in-flight requests to be drained
+	<-d.stopped
+	return nil
 }
 
-// Stop stops server
+// Stop stops accepting new requests, and waits for in-flight ones to finish within config.ShutdownTimeout.
+// Requests not finished by then are persisted and cleaned up when the driver starts again.
 func (d *Driver) Stop() {
-	driverLog.Info("Stopped server")
+	defer close(d.stopped)
+	var interrupted []inflightOp
+	if config.UpgradeSafeShutdown {
+		defer func() { d.recordHandover(interrupted) }()
+	}
+	if d.srv == nil {
+		return
+	}
+	driverLog.Info("Stopping server, waiting for in-flight requests", "timeout", config.ShutdownTimeout)
+	drained := make(chan struct{})
+	go func() {
+		d.srv.GracefulStop()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		driverLog.Info("Stopped server")
+		return
+	case <-time.After(config.ShutdownTimeout):
+	}
+	ops := d.inflight.list()
+	driverLog.Info("in-flight requests are not finished in time, stop server forcibly", "requests", ops)
+	if config.UpgradeSafeShutdown {
+		// handed over to the next version as they are, instead of being cleaned up
+		interrupted = ops
+	} else if err := d.inflight.persist(config.InflightStatePath); err != nil {
+		driverLog.Error(err, "persist in-flight requests error", "path", config.InflightStatePath)
+	}
 	d.srv.Stop()
 }
+
+// recordHandover records the mounts left intact for the next version to adopt. Nothing is unmounted on exit,
+// mount pods and bind targets keep serving applications while the node plugin is being upgraded.
+func (d *Driver) recordHandover(interrupted []inflightOp) {
+	if config.ByProcess {
+		driverLog.Info("mounts are processes of the node plugin in process mode, they can not be left intact across upgrades")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.nodeService.recordHandover(ctx, config.HandoverStatePath, interrupted); err != nil {
+		driverLog.Error(err, "record handover state error", "path", config.HandoverStatePath)
+		return
+	}
+	driverLog.Info("Leave mounts intact for the next version", "path", config.HandoverStatePath)
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util/dispatch"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
 )
 
 // NewFakeDriver creates a new mock driver used for testing
@@ -33,8 +34,10 @@ func NewFakeDriver(endpoint string, fakeProvider juicefs.Interface) *Driver {
 	return &Driver{
 		endpoint: endpoint,
 		controllerService: controllerService{
-			juicefs: fakeProvider,
-			vols:    make(map[string]int64),
+			juicefs:   fakeProvider,
+			vols:      make(map[string]int64),
+			snapshots: newSnapshotStore(nil),
+			volLocks:  resource.NewVolumeLocks(),
 		},
 		nodeService: nodeService{
 			quotaPool: dispatch.NewPool(defaultQuotaPoolNum),
@@ -43,5 +46,7 @@ func NewFakeDriver(endpoint string, fakeProvider juicefs.Interface) *Driver {
 			k8sClient: &k8sclient.K8sClient{Interface: fake.NewSimpleClientset()},
 			metrics:   metrics,
 		},
+		inflight: newInflightTracker(),
+		stopped:  make(chan struct{}),
 	}
 }
@@ -0,0 +1,151 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/fuse"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var fuseLog = klog.NewKlogr().WithName("fuse-checker")
+
+// fuseHealthReporter checks the FUSE module of the node, and reports the result by the common.FuseReadyLabelKey label
+// of the node, metrics, and events of the node when it changes. Nothing taints the node, pods only avoid nodes where
+// mounts would fail by a node affinity on the label
+type fuseHealthReporter struct {
+	checker   fuse.Checker
+	k8sClient *k8s.K8sClient
+	failed    *prometheus.GaugeVec
+
+	mu   sync.Mutex
+	last *fuse.Health
+}
+
+func newFuseHealthReporter(checker fuse.Checker, k8sClient *k8s.K8sClient, reg prometheus.Registerer) *fuseHealthReporter {
+	failed := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fuse_check_failed",
+		Help: "Whether each check of the FUSE module of the node failed in the last run, 1 if failed.",
+	}, []string{"check"})
+	reg.MustRegister(failed)
+	return &fuseHealthReporter{checker: checker, k8sClient: k8sClient, failed: failed}
+}
+
+// check checks the FUSE module and reports the result
+func (r *fuseHealthReporter) check(ctx context.Context) *fuse.Health {
+	health := r.checker.Check()
+	r.mu.Lock()
+	last := r.last
+	r.last = health
+	r.mu.Unlock()
+
+	failed := map[string]bool{}
+	for _, p := range health.Problems {
+		failed[p.Check] = true
+	}
+	for _, c := range fuse.Checks {
+		value := 0.0
+		if failed[c] {
+			value = 1
+		}
+		r.failed.WithLabelValues(c).Set(value)
+	}
+	changed := last == nil || last.String() != health.String()
+	if changed {
+		fuseLog.Info("checked FUSE module", "node", config.NodeName, "healthy", health.Healthy(), "result", health.String())
+	}
+
+	if r.k8sClient == nil || config.NodeName == "" {
+		return health
+	}
+	node, err := r.k8sClient.GetNode(ctx, config.NodeName)
+	if err != nil {
+		fuseLog.Error(err, "get node error, FUSE health is not reported", "node", config.NodeName)
+		return health
+	}
+	ready := strconv.FormatBool(health.Healthy())
+	labeled := node.Labels[common.FuseReadyLabelKey]
+	if labeled != ready {
+		data, _ := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]string{common.FuseReadyLabelKey: ready}}})
+		if _, err := r.k8sClient.CoreV1().Nodes().Patch(ctx, config.NodeName, types.MergePatchType, data, metav1.PatchOptions{}); err != nil {
+			fuseLog.Error(err, "label node error", "node", config.NodeName, "label", common.FuseReadyLabelKey, "value", ready)
+		}
+	}
+	recorder := events.NewRecorder(r.k8sClient)
+	switch {
+	case !health.Healthy() && changed:
+		_ = recorder.Eventf(ctx, node, corev1.EventTypeWarning, events.ReasonFuseUnhealthy, events.ActionCheckNode,
+			"FUSE module of the node is broken, mounts may fail: %s", health.String())
+	case health.Healthy() && ((last != nil && !last.Healthy()) || (last == nil && labeled == "false")):
+		_ = recorder.Eventf(ctx, node, corev1.EventTypeNormal, events.ReasonFuseHealthy, events.ActionCheckNode,
+			"FUSE module of the node is healthy again")
+	}
+	return health
+}
+
+// topology is reported in NodeGetInfo, so that kubelet sets the label on registration. CSI Controller doesn't
+// provision by topology, so it doesn't steer volumes or pods away from the node by itself
+func (r *fuseHealthReporter) topology() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil {
+		return nil
+	}
+	return map[string]string{common.FuseReadyLabelKey: strconv.FormatBool(r.last.Healthy())}
+}
+
+func (r *fuseHealthReporter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check(ctx)
+		}
+	}
+}
+
+// CheckFuse checks the FUSE module of the node before serving, so that NodeGetInfo reports the result as the
+// topology of the node, it's run in CSI Node. The label is updated first, or kubelet fails the registration when
+// the label left by the last run differs from the topology.
+func (d *Driver) CheckFuse(ctx context.Context) *fuse.Health {
+	return d.nodeService.fuse.check(ctx)
+}
+
+// RunFuseChecker checks the FUSE module of the node every config.FuseCheckInterval until ctx is done
+func (d *Driver) RunFuseChecker(ctx context.Context) {
+	if config.FuseCheckInterval <= 0 {
+		return
+	}
+	d.nodeService.fuse.run(ctx, config.FuseCheckInterval)
+}
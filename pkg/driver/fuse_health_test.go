@@ -0,0 +1,94 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/fuse"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+type fakeFuseChecker struct {
+	health *fuse.Health
+}
+
+func (c *fakeFuseChecker) Check() *fuse.Health {
+	return c.health
+}
+
+func TestFuseHealthReporter(t *testing.T) {
+	defer func(name string) { config.NodeName = name }(config.NodeName)
+	config.NodeName = "node-fuse"
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: config.NodeName}})}
+	checker := &fakeFuseChecker{health: &fuse.Health{Problems: []fuse.Problem{{Check: fuse.CheckDevice, Message: "stat /dev/fuse: no such file or directory"}}}}
+	r := newFuseHealthReporter(checker, client, prometheus.NewRegistry())
+	ctx := context.TODO()
+
+	reasons := func() []string {
+		list, err := client.CoreV1().Events("").List(ctx, metav1.ListOptions{})
+		assert.NoError(t, err)
+		var reasons []string
+		for _, e := range list.Items {
+			if e.InvolvedObject.Name == config.NodeName {
+				reasons = append(reasons, e.Reason)
+			}
+		}
+		return reasons
+	}
+	label := func() string {
+		node, err := client.GetNode(ctx, config.NodeName)
+		assert.NoError(t, err)
+		return node.Labels[common.FuseReadyLabelKey]
+	}
+
+	assert.Nil(t, r.topology())
+	r.check(ctx)
+	assert.Equal(t, "false", label())
+	assert.Equal(t, map[string]string{common.FuseReadyLabelKey: "false"}, r.topology())
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.failed.WithLabelValues(fuse.CheckDevice)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(r.failed.WithLabelValues(fuse.CheckModule)))
+	assert.Equal(t, []string{events.ReasonFuseUnhealthy}, reasons())
+
+	// the same problems are not reported again
+	r.check(ctx)
+	assert.Equal(t, []string{events.ReasonFuseUnhealthy}, reasons())
+
+	checker.health = &fuse.Health{}
+	r.check(ctx)
+	assert.Equal(t, "true", label())
+	assert.Equal(t, map[string]string{common.FuseReadyLabelKey: "true"}, r.topology())
+	assert.Equal(t, float64(0), testutil.ToFloat64(r.failed.WithLabelValues(fuse.CheckDevice)))
+	assert.ElementsMatch(t, []string{events.ReasonFuseUnhealthy, events.ReasonFuseHealthy}, reasons())
+
+	// NodeGetInfo reports the result as topology
+	d := &nodeService{nodeID: config.NodeName, fuse: r}
+	resp, err := d.NodeGetInfo(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{common.FuseReadyLabelKey: "true"}, resp.AccessibleTopology.Segments)
+}
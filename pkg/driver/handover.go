@@ -0,0 +1,164 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/utils/mount"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+// handoverState is recorded by the node plugin exiting in upgrade-safe mode, so that the next version
+// can verify it adopts the mount pods and bind targets left intact. Interrupted are the operations not
+// finished on exit, they are not cleaned up by the next version like the ones persisted by inflightTracker.
+type handoverState struct {
+	Version     string          `json:"version"`
+	Time        time.Time       `json:"time"`
+	MountPods   []handoverMount `json:"mountPods"`
+	Interrupted []inflightOp    `json:"interrupted,omitempty"`
+}
+
+type handoverMount struct {
+	Name    string   `json:"name"`
+	UID     string   `json:"uid"`
+	Targets []string `json:"targets"`
+}
+
+type handoverMetrics struct {
+	adopted        prometheus.Gauge
+	orphaned       prometheus.Gauge
+	legacyMigrated *prometheus.CounterVec
+}
+
+func newHandoverMetrics(reg prometheus.Registerer) *handoverMetrics {
+	metrics := &handoverMetrics{
+		adopted: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "handover_adopted_mounts",
+			Help: "Number of mount pods and bind targets left by the last version and adopted after restart.",
+		}),
+		orphaned: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "handover_orphaned_mounts",
+			Help: "Number of mount pods and bind targets left by the last version but gone or broken after restart.",
+		}),
+		legacyMigrated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "legacy_mount_pods_migrated_total",
+			Help: "Number of mount pods created by older versions and migrated by each compatibility shim.",
+		}, []string{"shim"}),
+	}
+	reg.MustRegister(metrics.adopted, metrics.orphaned, metrics.legacyMigrated)
+	return metrics
+}
+
+// recordHandover writes the mount pods of the node, their bind targets and the interrupted operations into path,
+// nothing is unmounted
+func (d *nodeService) recordHandover(ctx context.Context, path string, interrupted []inflightOp) error {
+	if d.k8sClient == nil {
+		return nil
+	}
+	labelSelector := &metav1.LabelSelector{MatchLabels: map[string]string{common.PodTypeKey: common.PodTypeValue}}
+	fieldSelector := &fields.Set{"spec.nodeName": config.NodeName}
+	pods, err := d.k8sClient.ListPod(ctx, config.Namespace, labelSelector, fieldSelector)
+	if err != nil {
+		return err
+	}
+	state := handoverState{Version: GetVersion().DriverVersion, Time: time.Now(), Interrupted: interrupted}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Spec.NodeName != config.NodeName {
+			continue
+		}
+		m := handoverMount{Name: pod.Name, UID: string(pod.UID)}
+		for _, target := range resource.GetAllRefKeys(pod) {
+			m.Targets = append(m.Targets, target)
+		}
+		sort.Strings(m.Targets)
+		state.MountPods = append(state.MountPods, m)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// loadHandover reads and removes the state recorded by the last exit in upgrade-safe mode
+func loadHandover(path string) (*handoverState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+	state := &handoverState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// adoptHandover verifies the mount pods and bind targets left by the last version are still serving.
+// Mount pods are adopted if they still exist with the same UID, targets are adopted if they are still mounted.
+// Orphaned ones are only reported, kubelet and the pod reconciler take care of them as usual.
+func (d *nodeService) adoptHandover(ctx context.Context, state *handoverState) (adopted, orphaned int) {
+	log := driverLog.WithValues("lastVersion", state.Version, "recordedAt", state.Time)
+	for _, m := range state.MountPods {
+		podAdopted := false
+		if d.k8sClient != nil {
+			pod, err := d.k8sClient.GetPod(ctx, m.Name, config.Namespace)
+			podAdopted = err == nil && string(pod.UID) == m.UID && pod.DeletionTimestamp == nil
+		}
+		if podAdopted {
+			adopted++
+		} else {
+			orphaned++
+			log.Info("mount pod left by the last version is gone", "pod", m.Name)
+		}
+		for _, target := range m.Targets {
+			notMnt, err := mount.IsNotMountPoint(d.SafeFormatAndMount.Interface, target)
+			if err == nil && !notMnt && podAdopted {
+				adopted++
+				continue
+			}
+			orphaned++
+			log.Info("bind target left by the last version is not served", "pod", m.Name, "target", target, "error", err)
+		}
+	}
+	// unlike recoverInterrupted, half-created targets are not unmounted, kubelet retries the operations
+	// which are idempotent, and takes the targets over with them
+	for _, op := range state.Interrupted {
+		log.Info("operation is interrupted by the last version, leave it to kubelet to retry", "method", op.Method,
+			"volumeId", op.VolumeID, "target", op.Target)
+	}
+	if d.handover != nil {
+		d.handover.adopted.Set(float64(adopted))
+		d.handover.orphaned.Set(float64(orphaned))
+	}
+	log.Info("adopted mounts left by the last version", "adopted", adopted, "orphaned", orphaned)
+	return adopted, orphaned
+}
@@ -0,0 +1,101 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/mount"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+func TestHandover(t *testing.T) {
+	nodeName, namespace := config.NodeName, config.Namespace
+	defer func() { config.NodeName, config.Namespace = nodeName, namespace }()
+	config.NodeName, config.Namespace = "node-1", "kube-system"
+
+	served, broken := t.TempDir(), t.TempDir()
+	mountPod := func(name, uid, node string, targets ...string) *corev1.Pod {
+		annotations := map[string]string{}
+		for _, target := range targets {
+			annotations[util.GetReferenceKey(target)] = target
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   config.Namespace,
+				UID:         types.UID(uid),
+				Labels:      map[string]string{common.PodTypeKey: common.PodTypeValue},
+				Annotations: annotations,
+			},
+			Spec: corev1.PodSpec{NodeName: node},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		mountPod("juicefs-node-1-pv-1", "uid-1", "node-1", served, broken),
+		mountPod("juicefs-node-1-pv-2", "uid-2", "node-1"),
+		mountPod("juicefs-node-2-pv-1", "uid-3", "node-2", "/pods/uid-3/mount"),
+	)
+	d := &nodeService{
+		SafeFormatAndMount: mount.SafeFormatAndMount{Interface: mount.NewFakeMounter([]mount.MountPoint{{Device: "JuiceFS:test", Path: served}})},
+		k8sClient:          &k8sclient.K8sClient{Interface: client},
+		handover:           newHandoverMetrics(prometheus.NewRegistry()),
+	}
+
+	path := filepath.Join(t.TempDir(), "handover.json")
+	interrupted := []inflightOp{{Method: methodNodePublish, VolumeID: "pv-1", Target: "/pods/uid-5/mount"}}
+	if err := d.recordHandover(context.TODO(), path, interrupted); err != nil {
+		t.Fatalf("recordHandover() error = %v", err)
+	}
+	state, err := loadHandover(path)
+	if err != nil || state == nil || len(state.MountPods) != 2 || !reflect.DeepEqual(state.Interrupted, interrupted) {
+		t.Fatalf("loadHandover() = %+v, %v", state, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("state file should be removed after loaded, got %v", err)
+	}
+
+	// the second mount pod is recreated by someone else during the upgrade
+	if err := client.CoreV1().Pods(config.Namespace).Delete(context.TODO(), "juicefs-node-1-pv-2", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CoreV1().Pods(config.Namespace).Create(context.TODO(), mountPod("juicefs-node-1-pv-2", "uid-4", "node-1"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	adopted, orphaned := d.adoptHandover(context.TODO(), state)
+	// pod 1 and its served target are adopted, its broken target and the recreated pod 2 are orphaned
+	if adopted != 2 || orphaned != 2 {
+		t.Errorf("adoptHandover() = %d, %d, want 2, 2", adopted, orphaned)
+	}
+	if got := testutil.ToFloat64(d.handover.orphaned); got != 2 {
+		t.Errorf("orphaned mounts metric = %v, want 2", got)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"k8s.io/utils/mount"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+const (
+	methodNodePublish   = "/csi.v1.Node/NodePublishVolume"
+	methodNodeUnpublish = "/csi.v1.Node/NodeUnpublishVolume"
+)
+
+// inflightOp is a volume operation being served, persisted if it's not finished before the driver exits
+type inflightOp struct {
+	Method   string    `json:"method"`
+	VolumeID string    `json:"volumeId"`
+	Target   string    `json:"target"`
+	Start    time.Time `json:"start"`
+}
+
+// inflightTracker tracks the NodePublish/NodeUnpublish requests being served
+type inflightTracker struct {
+	mu   sync.Mutex
+	next uint64
+	ops  map[uint64]inflightOp
+}
+
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{ops: map[uint64]inflightOp{}}
+}
+
+func (t *inflightTracker) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if info.FullMethod != methodNodePublish && info.FullMethod != methodNodeUnpublish {
+		return handler(ctx, req)
+	}
+	op := inflightOp{Method: info.FullMethod, Start: time.Now()}
+	if r, ok := req.(interface{ GetVolumeId() string }); ok {
+		op.VolumeID = r.GetVolumeId()
+	}
+	if r, ok := req.(interface{ GetTargetPath() string }); ok {
+		op.Target = r.GetTargetPath()
+	}
+
+	t.mu.Lock()
+	id := t.next
+	t.next++
+	t.ops[id] = op
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.ops, id)
+		t.mu.Unlock()
+	}()
+	return handler(ctx, req)
+}
+
+// list returns the operations not finished yet
+func (t *inflightTracker) list() []inflightOp {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ops := make([]inflightOp, 0, len(t.ops))
+	for _, op := range t.ops {
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// persist writes the unfinished operations into path, which is recovered when the driver starts again
+func (t *inflightTracker) persist(path string) error {
+	ops := t.list()
+	if len(ops) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// loadInflight reads and removes the operations interrupted by the last exit
+func loadInflight(path string) ([]inflightOp, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+	var ops []inflightOp
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// recoverInterrupted cleans up the publish operations interrupted by the last exit. Targets not mounted
+// are unpublished, so that the references added in mount pods are removed and mount pods without
+// references are deleted. Kubelet retries the operations after the driver is back, which are idempotent.
+func (d *nodeService) recoverInterrupted(ctx context.Context, ops []inflightOp) {
+	for _, op := range ops {
+		log := driverLog.WithValues("method", op.Method, "volumeId", op.VolumeID, "target", op.Target)
+		if op.Method != methodNodePublish || op.Target == "" {
+			log.Info("operation is interrupted by the last exit, leave it to kubelet to retry")
+			continue
+		}
+		notMnt, err := mount.IsNotMountPoint(d.SafeFormatAndMount.Interface, op.Target)
+		if err == nil && !notMnt {
+			log.Info("publish is interrupted by the last exit but target is mounted, leave it to kubelet to retry")
+			continue
+		}
+		log.Info("publish is interrupted by the last exit, clean up the half-created target")
+		if err := d.juicefs.JfsUnmount(util.WithLog(ctx, log), op.VolumeID, op.Target); err != nil {
+			log.Error(err, "clean up interrupted publish error")
+		}
+	}
+}
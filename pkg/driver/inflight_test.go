@@ -0,0 +1,93 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc"
+	"k8s.io/utils/mount"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+)
+
+func TestInflightTracker(t *testing.T) {
+	tracker := newInflightTracker()
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+	req := &csi.NodePublishVolumeRequest{VolumeId: "vol-1", TargetPath: "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv-1/mount"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = tracker.intercept(context.TODO(), req, &grpc.UnaryServerInfo{FullMethod: methodNodePublish}, handler)
+	}()
+	<-started
+	// other requests are not tracked
+	_, _ = tracker.intercept(context.TODO(), &csi.NodeGetInfoRequest{}, &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Node/NodeGetInfo"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+
+	ops := tracker.list()
+	if len(ops) != 1 || ops[0].VolumeID != "vol-1" || ops[0].Target != req.TargetPath || ops[0].Method != methodNodePublish {
+		t.Fatalf("list() = %+v", ops)
+	}
+	path := filepath.Join(t.TempDir(), "inflight.json")
+	if err := tracker.persist(path); err != nil {
+		t.Fatalf("persist() error = %v", err)
+	}
+	close(release)
+	<-done
+	if ops := tracker.list(); len(ops) != 0 {
+		t.Errorf("finished request should not be tracked, got %+v", ops)
+	}
+
+	loaded, err := loadInflight(path)
+	if err != nil || len(loaded) != 1 || loaded[0].Target != req.TargetPath {
+		t.Fatalf("loadInflight() = %+v, %v", loaded, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("state file should be removed after loaded, got %v", err)
+	}
+	if loaded, err := loadInflight(path); err != nil || loaded != nil {
+		t.Errorf("loadInflight() without state file = %+v, %v", loaded, err)
+	}
+}
+
+func TestRecoverInterrupted(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+	mounted, halfCreated := t.TempDir(), t.TempDir()
+	d := &nodeService{
+		SafeFormatAndMount: mount.SafeFormatAndMount{Interface: mount.NewFakeMounter([]mount.MountPoint{{Device: "JuiceFS:test", Path: mounted}})},
+		juicefs:            mockJuicefs,
+	}
+	mockJuicefs.EXPECT().JfsUnmount(gomock.Any(), "vol-2", halfCreated).Return(nil)
+	d.recoverInterrupted(context.TODO(), []inflightOp{
+		{Method: methodNodePublish, VolumeID: "vol-1", Target: mounted},
+		{Method: methodNodePublish, VolumeID: "vol-2", Target: halfCreated},
+		{Method: methodNodeUnpublish, VolumeID: "vol-3", Target: "/pods/uid-3/mount"},
+	})
+}
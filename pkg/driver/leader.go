@@ -0,0 +1,75 @@
+/*
+ Copyright 2022 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+)
+
+// runAsLeader runs fn only in the replica of CSI Controller holding the lease of name, so that background loops
+// changing the cluster or file systems don't run in every replica. fn runs directly if leader election is disabled.
+func (ps *provisionerService) runAsLeader(ctx context.Context, name string, fn func(ctx context.Context)) {
+	if !ps.leaderElection || ps.K8sClient == nil {
+		fn(ctx)
+		return
+	}
+	identity := config.PodName
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      strings.ReplaceAll(config.DriverName, ".", "-") + "-" + name,
+			Namespace: ps.leaderElectionNamespace,
+		},
+		Client:     ps.K8sClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	leaseDuration := ps.leaderElectionLeaseDuration
+	if leaseDuration <= 0 {
+		leaseDuration = 15 * time.Second
+	}
+	for ctx.Err() == nil {
+		// RunOrDie returns once the leadership is lost, try to acquire it again until the context is done
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   leaseDuration * 2 / 3,
+			RetryPeriod:     leaseDuration / 5,
+			ReleaseOnCancel: true,
+			Name:            name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					driverLog.Info("became leader, start", "loop", name)
+					fn(ctx)
+				},
+				OnStoppedLeading: func() {
+					driverLog.Info("lost leadership, stop", "loop", name)
+				},
+			},
+		})
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+)
+
+const (
+	metaProbeInterval         = 30 * time.Second
+	metaProbeFailureThreshold = 3
+	// metaProbeExpiration is how long a metaurl keeps being probed after the last provisioning using it
+	metaProbeExpiration = 24 * time.Hour
+)
+
+var proberLog = klog.NewKlogr().WithName("meta-prober")
+
+type metaProberMetrics struct {
+	up          *prometheus.GaugeVec
+	latency     *prometheus.HistogramVec
+	circuitOpen *prometheus.GaugeVec
+}
+
+func newMetaProberMetrics(reg prometheus.Registerer) *metaProberMetrics {
+	metrics := &metaProberMetrics{}
+	labels := []string{"meta", "engine"}
+	metrics.up = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "meta_engine_up",
+		Help: "whether the metadata engine is reachable, 1 for up and 0 for down",
+	}, labels)
+	metrics.latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "meta_engine_probe_latency_seconds",
+		Help:    "latency of probing the metadata engine",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, labels)
+	metrics.circuitOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "meta_engine_circuit_open",
+		Help: "whether provisioning is rejected because the metadata engine is down",
+	}, labels)
+	reg.MustRegister(metrics.up, metrics.latency, metrics.circuitOpen)
+	return metrics
+}
+
+type metaTarget struct {
+	metaUrl string
+	// envs in the secret, e.g. META_PASSWORD of the metaurl, the ones of the latest provisioning are used
+	envs     map[string]string
+	id       string
+	engine   string
+	failures int
+	open     bool
+	lastUsed time.Time
+}
+
+// metaProber probes every distinct metaurl used in provisioning periodically, reports the health of
+// metadata engines as metrics, and rejects provisioning fast when the engine is down (circuit open)
+// instead of waiting for the juicefs command to time out.
+type metaProber struct {
+	juicefs juicefs.Interface
+	metrics *metaProberMetrics
+
+	mu      sync.Mutex
+	targets map[string]*metaTarget
+}
+
+func newMetaProber(jfs juicefs.Interface, reg prometheus.Registerer) *metaProber {
+	return &metaProber{
+		juicefs: jfs,
+		metrics: newMetaProberMetrics(reg),
+		targets: make(map[string]*metaTarget),
+	}
+}
+
+// Allow tracks the metaurl in secrets and returns error if its circuit is open.
+// Only the tracked metaurls are probed, so the probe loop is idle in processes without provisioning.
+func (p *metaProber) Allow(secrets map[string]string) error {
+	metaUrl := secrets["metaurl"]
+	if p == nil || metaUrl == "" {
+		return nil
+	}
+	envs := make(map[string]string)
+	if secrets["envs"] != "" {
+		if err := config.ParseYamlOrJson(secrets["envs"], &envs); err != nil {
+			// let the following steps report the error
+			proberLog.V(1).Info("parse envs in secret error, skip checking metadata engine", "error", err)
+			return nil
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.targets[metaUrl]
+	if !ok {
+		t = &metaTarget{metaUrl: metaUrl, id: metaID(metaUrl), engine: metaEngine(metaUrl)}
+		p.targets[metaUrl] = t
+		proberLog.Info("start probing metadata engine", "meta", t.id, "engine", t.engine)
+	}
+	t.envs = envs
+	t.lastUsed = time.Now()
+	if t.open {
+		return fmt.Errorf("metadata engine %s (%s) is unreachable after %d probes, reject provisioning", t.id, t.engine, t.failures)
+	}
+	return nil
+}
+
+// RunMetaProber probes the metadata engines used in provisioning until ctx is done
+func (d *Driver) RunMetaProber(ctx context.Context) {
+	d.controllerService.metaProber.run(ctx)
+}
+
+func (p *metaProber) run(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	ticker := time.NewTicker(metaProbeInterval)
+	defer ticker.Stop()
+	for {
+		p.probeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *metaProber) probeAll(ctx context.Context) {
+	p.mu.Lock()
+	var targets []*metaTarget
+	for k, t := range p.targets {
+		if time.Since(t.lastUsed) > metaProbeExpiration {
+			proberLog.Info("stop probing metadata engine which is not used any more", "meta", t.id, "engine", t.engine)
+			delete(p.targets, k)
+			p.metrics.up.DeleteLabelValues(t.id, t.engine)
+			p.metrics.latency.DeleteLabelValues(t.id, t.engine)
+			p.metrics.circuitOpen.DeleteLabelValues(t.id, t.engine)
+			continue
+		}
+		targets = append(targets, t)
+	}
+	p.mu.Unlock()
+
+	for _, t := range targets {
+		p.probe(ctx, t)
+	}
+}
+
+func (p *metaProber) probe(ctx context.Context, t *metaTarget) {
+	p.mu.Lock()
+	envs := t.envs
+	p.mu.Unlock()
+	start := time.Now()
+	err := p.juicefs.Status(ctx, t.metaUrl, envs)
+	p.metrics.latency.WithLabelValues(t.id, t.engine).Observe(time.Since(start).Seconds())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		t.failures++
+		p.metrics.up.WithLabelValues(t.id, t.engine).Set(0)
+		if !t.open && t.failures >= metaProbeFailureThreshold {
+			proberLog.Error(err, "metadata engine is down, open circuit", "meta", t.id, "engine", t.engine)
+			t.open = true
+		}
+	} else {
+		if t.open {
+			proberLog.Info("metadata engine recovered, close circuit", "meta", t.id, "engine", t.engine)
+		}
+		t.failures = 0
+		t.open = false
+		p.metrics.up.WithLabelValues(t.id, t.engine).Set(1)
+	}
+	open := 0.0
+	if t.open {
+		open = 1
+	}
+	p.metrics.circuitOpen.WithLabelValues(t.id, t.engine).Set(open)
+}
+
+// metaID identifies a metaurl without exposing the credentials in it
+func metaID(metaUrl string) string {
+	h := sha256.Sum256([]byte(metaUrl))
+	return fmt.Sprintf("%x", h)[:12]
+}
+
+func metaEngine(metaUrl string) string {
+	if idx := strings.Index(metaUrl, "://"); idx > 0 {
+		return strings.ToLower(metaUrl[:idx])
+	}
+	return "unknown"
+}
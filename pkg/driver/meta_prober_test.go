@@ -0,0 +1,70 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+)
+
+func TestMetaProber(t *testing.T) {
+	metaUrl := "redis://127.0.0.1:6379/1"
+	secrets := map[string]string{"metaurl": metaUrl, "envs": `{"META_PASSWORD": "password"}`}
+	envs := map[string]string{"META_PASSWORD": "password"}
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+
+	p := newMetaProber(mockJuicefs, prometheus.NewRegistry())
+	if err := p.Allow(secrets); err != nil {
+		t.Fatalf("Allow() error = %v, want nil", err)
+	}
+	target := p.targets[metaUrl]
+	if target.engine != "redis" {
+		t.Errorf("engine = %s, want redis", target.engine)
+	}
+
+	mockJuicefs.EXPECT().Status(gomock.Any(), metaUrl, envs).Return(errors.New("connection refused")).Times(metaProbeFailureThreshold)
+	for i := 0; i < metaProbeFailureThreshold; i++ {
+		if err := p.Allow(secrets); err != nil {
+			t.Fatalf("Allow() before circuit open error = %v, want nil", err)
+		}
+		p.probeAll(context.TODO())
+	}
+	if err := p.Allow(secrets); err == nil {
+		t.Fatalf("Allow() after circuit open error = nil, want error")
+	}
+	if v := testutil.ToFloat64(p.metrics.circuitOpen.WithLabelValues(target.id, "redis")); v != 1 {
+		t.Errorf("circuit open metric = %v, want 1", v)
+	}
+
+	mockJuicefs.EXPECT().Status(gomock.Any(), metaUrl, envs).Return(nil)
+	p.probeAll(context.TODO())
+	if err := p.Allow(secrets); err != nil {
+		t.Fatalf("Allow() after recovered error = %v, want nil", err)
+	}
+	if v := testutil.ToFloat64(p.metrics.up.WithLabelValues(target.id, "redis")); v != 1 {
+		t.Errorf("up metric = %v, want 1", v)
+	}
+}
@@ -0,0 +1,326 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+var (
+	mirrorLog           = klog.NewKlogr().WithName("mirror")
+	mirrorCheckInterval = time.Minute
+	// probes of the primary are shared by publishes and checks in the meantime
+	mirrorProbeTTL = 30 * time.Second
+)
+
+// mirrorMount is a target mounted from the mirror file system because the primary was unreachable.
+// It's persisted without secrets, the metaurl of the primary is looked up by the PV again after restart.
+type mirrorMount struct {
+	VolumeID     string `json:"volumeId"`
+	PodName      string `json:"podName,omitempty"`
+	PodNamespace string `json:"podNamespace,omitempty"`
+	Recovered    bool   `json:"recovered,omitempty"`
+	primaryMeta  string
+}
+
+type mirrorProbe struct {
+	err error
+	at  time.Time
+}
+
+// mirrorTracker fails over to the read-only mirror of a volume when its primary file system is unreachable,
+// and reports when the primary recovers. It doesn't fail back: the mirror is mounted in place of the primary,
+// the application pod needs to be recreated to mount the primary again.
+type mirrorTracker struct {
+	juicefs   juicefs.Interface
+	k8sClient *k8s.K8sClient
+	statePath string
+	now       func() time.Time
+
+	once   sync.Once
+	mu     sync.Mutex
+	mounts map[string]*mirrorMount // target -> mount
+	probes map[string]mirrorProbe  // metaurl -> last probe
+}
+
+func newMirrorTracker(jfs juicefs.Interface, k8sClient *k8s.K8sClient, statePath string) *mirrorTracker {
+	return &mirrorTracker{
+		juicefs:   jfs,
+		k8sClient: k8sClient,
+		statePath: statePath,
+		now:       time.Now,
+		mounts:    make(map[string]*mirrorMount),
+		probes:    make(map[string]mirrorProbe),
+	}
+}
+
+// probe checks if the primary is reachable, the result is cached for mirrorProbeTTL, so that publishes of
+// volumes sharing the primary don't wait for a probe each
+func (m *mirrorTracker) probe(ctx context.Context, metaUrl string) error {
+	m.mu.Lock()
+	p, ok := m.probes[metaUrl]
+	m.mu.Unlock()
+	if ok && m.now().Sub(p.at) < mirrorProbeTTL {
+		return p.err
+	}
+	err := m.juicefs.Status(ctx, metaUrl, nil)
+	m.mu.Lock()
+	m.probes[metaUrl] = mirrorProbe{err: err, at: m.now()}
+	m.mu.Unlock()
+	return err
+}
+
+// resolve returns the secrets of the mirror if the volume has one and its primary is unreachable,
+// otherwise the secrets are returned as is.
+func (m *mirrorTracker) resolve(ctx context.Context, volumeID, target string, secrets, volCtx map[string]string) (map[string]string, bool, error) {
+	mirrorOf := volCtx[common.MirrorOfKey]
+	if m == nil || mirrorOf == "" {
+		return secrets, false, nil
+	}
+	log := mirrorLog.WithValues("volumeId", volumeID)
+	if secrets["metaurl"] == "" {
+		log.Info("mirror is only supported in community edition, ignore it")
+		return secrets, false, nil
+	}
+	err := m.probe(ctx, secrets["metaurl"])
+	if err == nil {
+		return secrets, false, nil
+	}
+	if m.k8sClient == nil {
+		return nil, false, fmt.Errorf("primary file system is unreachable (%v), and mirror is not supported without kubernetes", err)
+	}
+	log.Error(err, "primary file system is unreachable, mount its mirror read-only", "mirror", mirrorOf)
+	mirrorSecrets, e := m.getMirrorSecrets(ctx, mirrorOf)
+	if e != nil {
+		return nil, false, fmt.Errorf("primary file system is unreachable (%v), and get mirror secret %s error: %v", err, mirrorOf, e)
+	}
+
+	m.mu.Lock()
+	m.mounts[target] = &mirrorMount{
+		VolumeID:     volumeID,
+		PodName:      volCtx[common.PodInfoName],
+		PodNamespace: volCtx[common.PodInfoNamespace],
+		primaryMeta:  secrets["metaurl"],
+	}
+	m.persistLocked()
+	m.mu.Unlock()
+	m.start()
+	return mirrorSecrets, true, nil
+}
+
+func (m *mirrorTracker) start() {
+	m.once.Do(func() {
+		go m.run(context.Background())
+	})
+}
+
+// forget stops tracking the target once it's unmounted
+func (m *mirrorTracker) forget(target string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.mounts[target]; ok {
+		delete(m.mounts, target)
+		m.persistLocked()
+	}
+}
+
+// persistLocked saves the mirror mounts to statePath, which is kept across restarts of CSI Node
+func (m *mirrorTracker) persistLocked() {
+	if m.statePath == "" {
+		return
+	}
+	if len(m.mounts) == 0 {
+		if err := os.Remove(m.statePath); err != nil && !os.IsNotExist(err) {
+			mirrorLog.Error(err, "remove mirror state error", "path", m.statePath)
+		}
+		return
+	}
+	data, err := json.Marshal(m.mounts)
+	if err == nil {
+		tmp := m.statePath + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, m.statePath)
+		}
+	}
+	if err != nil {
+		mirrorLog.Error(err, "save mirror state error", "path", m.statePath)
+	}
+}
+
+// restore tracks the mirror mounts saved by the last run again, the metaurl of the primary is read from
+// the node publish secret of the PV, mounts whose primary can't be found are no longer tracked
+func (m *mirrorTracker) restore(ctx context.Context) {
+	if m == nil || m.statePath == "" {
+		return
+	}
+	data, err := os.ReadFile(m.statePath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		mirrorLog.Error(err, "read mirror state error", "path", m.statePath)
+		return
+	}
+	mounts := make(map[string]*mirrorMount)
+	if err := json.Unmarshal(data, &mounts); err != nil {
+		mirrorLog.Error(err, "parse mirror state error", "path", m.statePath)
+		return
+	}
+	for target, mnt := range mounts {
+		log := mirrorLog.WithValues("volumeId", mnt.VolumeID, "target", target)
+		metaUrl, err := m.primaryMetaOf(ctx, mnt)
+		if err != nil {
+			log.Error(err, "can't find the primary file system of mirror mount, stop tracking it")
+			delete(mounts, target)
+			continue
+		}
+		mnt.primaryMeta = metaUrl
+	}
+	m.mu.Lock()
+	for target, mnt := range mounts {
+		if _, ok := m.mounts[target]; !ok {
+			m.mounts[target] = mnt
+		}
+	}
+	m.persistLocked()
+	tracked := len(m.mounts)
+	m.mu.Unlock()
+	if tracked > 0 {
+		mirrorLog.Info("restored mirror mounts", "count", tracked)
+		m.start()
+	}
+}
+
+func (m *mirrorTracker) primaryMetaOf(ctx context.Context, mnt *mirrorMount) (string, error) {
+	pv, _, err := resource.GetPVWithVolumeHandleOrAppInfo(ctx, m.k8sClient, mnt.VolumeID, map[string]string{
+		common.PodInfoName:      mnt.PodName,
+		common.PodInfoNamespace: mnt.PodNamespace,
+	})
+	if err != nil {
+		return "", err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.NodePublishSecretRef == nil {
+		return "", fmt.Errorf("no node publish secret in pv %s", pv.Name)
+	}
+	ref := pv.Spec.CSI.NodePublishSecretRef
+	secret, err := m.k8sClient.GetSecret(ctx, ref.Name, ref.Namespace)
+	if err != nil {
+		return "", err
+	}
+	if metaUrl := string(secret.Data["metaurl"]); metaUrl != "" {
+		return metaUrl, nil
+	}
+	return "", fmt.Errorf("no metaurl in secret %s/%s", ref.Namespace, ref.Name)
+}
+
+func (m *mirrorTracker) getMirrorSecrets(ctx context.Context, mirrorOf string) (map[string]string, error) {
+	namespace, name := parseMirrorOf(mirrorOf)
+	secret, err := m.k8sClient.GetSecret(ctx, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string]string, len(secret.Data)+len(secret.StringData))
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+	for k, v := range secret.StringData {
+		secrets[k] = v
+	}
+	if secrets["metaurl"] == "" {
+		return nil, fmt.Errorf("no metaurl in mirror secret")
+	}
+	return secrets, nil
+}
+
+// parseMirrorOf parses <namespace>/<name> of the mirror secret, which is in kube-system if namespace is omitted
+func parseMirrorOf(mirrorOf string) (string, string) {
+	if parts := strings.SplitN(mirrorOf, "/", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return "kube-system", mirrorOf
+}
+
+func (m *mirrorTracker) run(ctx context.Context) {
+	ticker := time.NewTicker(mirrorCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.checkPrimaries(ctx)
+	}
+}
+
+// checkPrimaries probes the primary of mirror mounts, and reports the ones recovered
+func (m *mirrorTracker) checkPrimaries(ctx context.Context) {
+	m.mu.Lock()
+	pending := make(map[string]*mirrorMount)
+	for target, mnt := range m.mounts {
+		if !mnt.Recovered {
+			pending[target] = mnt
+		}
+	}
+	m.mu.Unlock()
+
+	for target, mnt := range pending {
+		if err := m.probe(ctx, mnt.primaryMeta); err != nil {
+			continue
+		}
+		m.mu.Lock()
+		mnt.Recovered = true
+		m.persistLocked()
+		m.mu.Unlock()
+		mirrorLog.Info("primary file system recovered, recreate the application pod to fail back", "volumeId", mnt.VolumeID, "target", target,
+			"pod", mnt.PodName, "namespace", mnt.PodNamespace)
+		m.reportRecovered(ctx, mnt)
+	}
+}
+
+func (m *mirrorTracker) reportRecovered(ctx context.Context, mnt *mirrorMount) {
+	if mnt.PodName == "" || mnt.PodNamespace == "" {
+		return
+	}
+	pod, err := m.k8sClient.GetPod(ctx, mnt.PodName, mnt.PodNamespace)
+	if err != nil {
+		mirrorLog.Error(err, "get application pod error", "pod", mnt.PodName, "namespace", mnt.PodNamespace)
+		return
+	}
+	msg := fmt.Sprintf("primary file system of volume %s recovered, volume is mounted from its read-only mirror, recreate the pod to fail back", mnt.VolumeID)
+	if err := events.NewRecorder(m.k8sClient).Event(ctx, pod, corev1.EventTypeNormal, events.ReasonPrimaryRecovered, events.ActionRecover, msg); err != nil {
+		mirrorLog.Error(err, "create event error", "pod", mnt.PodName, "namespace", mnt.PodNamespace)
+	}
+}
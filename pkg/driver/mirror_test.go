@@ -0,0 +1,163 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestMirrorTracker(t *testing.T) {
+	primary := "redis://primary:6379/1"
+	mirror := "redis://mirror:6379/1"
+	target := "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv/mount"
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirror-secret", Namespace: "kube-system"},
+			Data:       map[string][]byte{"metaurl": []byte(mirror), "name": []byte("myjfs")},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}},
+	)}
+	statePath := filepath.Join(t.TempDir(), "mirror.json")
+	m := newMirrorTracker(mockJuicefs, client, statePath)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	// avoid starting the check loop in test
+	m.once.Do(func() {})
+	ctx := context.TODO()
+	secrets := map[string]string{"metaurl": primary, "name": "myjfs"}
+	volCtx := map[string]string{
+		common.MirrorOfKey:      "mirror-secret",
+		common.PodInfoName:      "app",
+		common.PodInfoNamespace: "default",
+	}
+
+	// no mirror configured
+	got, mirrored, err := m.resolve(ctx, "pv", target, secrets, nil)
+	if err != nil || mirrored || got["metaurl"] != primary {
+		t.Fatalf("resolve() without mirror = %v, %v, %v", got, mirrored, err)
+	}
+
+	// primary is reachable
+	mockJuicefs.EXPECT().Status(gomock.Any(), primary, nil).Return(nil)
+	got, mirrored, err = m.resolve(ctx, "pv", target, secrets, volCtx)
+	if err != nil || mirrored || got["metaurl"] != primary {
+		t.Fatalf("resolve() with reachable primary = %v, %v, %v", got, mirrored, err)
+	}
+
+	// probe result is cached
+	got, mirrored, err = m.resolve(ctx, "pv", target, secrets, volCtx)
+	if err != nil || mirrored || got["metaurl"] != primary {
+		t.Fatalf("resolve() with cached probe = %v, %v, %v", got, mirrored, err)
+	}
+
+	// primary is unreachable, fail over to mirror
+	now = now.Add(mirrorProbeTTL)
+	mockJuicefs.EXPECT().Status(gomock.Any(), primary, nil).Return(errors.New("connection refused"))
+	got, mirrored, err = m.resolve(ctx, "pv", target, secrets, volCtx)
+	if err != nil || !mirrored || got["metaurl"] != mirror {
+		t.Fatalf("resolve() with unreachable primary = %v, %v, %v", got, mirrored, err)
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Errorf("mirror mount is not persisted: %v", err)
+	}
+
+	// primary is still down
+	now = now.Add(mirrorProbeTTL)
+	mockJuicefs.EXPECT().Status(gomock.Any(), primary, nil).Return(errors.New("connection refused"))
+	m.checkPrimaries(ctx)
+	if m.mounts[target].Recovered {
+		t.Errorf("mount should not be recovered")
+	}
+	// primary recovered, event is reported to the application pod only once
+	now = now.Add(mirrorProbeTTL)
+	mockJuicefs.EXPECT().Status(gomock.Any(), primary, nil).Return(nil)
+	m.checkPrimaries(ctx)
+	now = now.Add(mirrorProbeTTL)
+	m.checkPrimaries(ctx)
+	if !m.mounts[target].Recovered {
+		t.Errorf("mount should be recovered")
+	}
+	events, _ := client.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 || events.Items[0].Reason != "PrimaryRecovered" {
+		t.Errorf("events = %v, want one PrimaryRecovered", events.Items)
+	}
+
+	m.forget(target)
+	if len(m.mounts) != 0 {
+		t.Errorf("mount should be forgotten after unmount")
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("mirror state should be removed without mounts: %v", err)
+	}
+
+	// mirror secret not found
+	now = now.Add(mirrorProbeTTL)
+	volCtx[common.MirrorOfKey] = "default/not-exist"
+	mockJuicefs.EXPECT().Status(gomock.Any(), primary, nil).Return(errors.New("connection refused"))
+	if _, _, err = m.resolve(ctx, "pv", target, secrets, volCtx); err == nil {
+		t.Errorf("resolve() with missing mirror secret should fail")
+	}
+}
+
+func TestMirrorTrackerRestore(t *testing.T) {
+	primary := "redis://primary:6379/1"
+	target := "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv/mount"
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "primary-secret", Namespace: "default"},
+			Data:       map[string][]byte{"metaurl": []byte(primary), "name": []byte("myjfs")},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+			Spec: corev1.PersistentVolumeSpec{
+				ClaimRef: &corev1.ObjectReference{Name: "pvc", Namespace: "default"},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+					VolumeHandle:         "pv",
+					NodePublishSecretRef: &corev1.SecretReference{Name: "primary-secret", Namespace: "default"},
+				}},
+			},
+		},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "default"}},
+	)}
+	statePath := filepath.Join(t.TempDir(), "mirror.json")
+	if err := os.WriteFile(statePath, []byte(`{"`+target+`":{"volumeId":"pv","podName":"app","podNamespace":"default"},"/gone":{"volumeId":"not-exist"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	m := newMirrorTracker(nil, client, statePath)
+	m.once.Do(func() {})
+	m.restore(context.TODO())
+	if len(m.mounts) != 1 || m.mounts[target] == nil || m.mounts[target].primaryMeta != primary {
+		t.Fatalf("restored mounts = %v", m.mounts)
+	}
+}
@@ -18,16 +18,20 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path"
 	"reflect"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	k8sexec "k8s.io/utils/exec"
@@ -36,11 +40,16 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/fuse"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/tracing"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util/dispatch"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/secretprovider"
 	k8sMount "k8s.io/utils/mount"
 )
 
@@ -61,6 +70,12 @@ type nodeService struct {
 	nodeID    string
 	k8sClient *k8sclient.K8sClient
 	metrics   *nodeMetrics
+	mirrors   *mirrorTracker
+	auditor   *auditor
+	handover  *handoverMetrics
+	attach    *attachGuard
+	remote    *remoteMounter
+	fuse      *fuseHealthReporter
 }
 
 type nodeMetrics struct {
@@ -97,6 +112,12 @@ func newNodeService(nodeID string, k8sClient *k8sclient.K8sClient, reg prometheu
 		nodeID:             nodeID,
 		k8sClient:          k8sClient,
 		metrics:            metrics,
+		mirrors:            newMirrorTracker(jfsProvider, k8sClient, config.MirrorStatePath),
+		auditor:            newAuditor(newAuditSink(config.AuditSink)),
+		handover:           newHandoverMetrics(reg),
+		attach:             newAttachGuard(k8sClient, nodeID),
+		remote:             &remoteMounter{juicefs: jfsProvider, k8sClient: k8sClient, mounter: mounter.Interface},
+		fuse:               newFuseHealthReporter(fuse.NewChecker(config.FuseExpectedMounts), k8sClient, reg),
 	}, nil
 }
 
@@ -119,6 +140,9 @@ func (d *nodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	}
 	volumeID := req.GetVolumeId()
 	log = log.WithValues("volumeId", volumeID)
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		log = log.WithValues("traceId", traceID)
+	}
 
 	ctxWithLog := util.WithLog(ctx, log)
 	secrets := req.Secrets
@@ -141,7 +165,9 @@ func (d *nodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	}
 
 	log.Info("creating dir", "target", target)
-	if err := d.juicefs.CreateTarget(ctxWithLog, target); err != nil {
+	if err := traced(ctxWithLog, "createTarget", func(ctx context.Context) error {
+		return d.juicefs.CreateTarget(ctx, target)
+	}); err != nil {
 		return nil, status.Errorf(codes.Internal, "Could not create dir %q: %v", target, err)
 	}
 
@@ -155,56 +181,147 @@ func (d *nodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	}
 
 	log.Info("get volume context", "volCtx", volCtx)
+	vc, err := config.ParseVolumeContext(volCtx, false)
+	if err != nil {
+		d.metrics.volumeErrors.Inc()
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if vc.ScratchTTL > 0 {
+		if !vc.Ephemeral {
+			d.metrics.volumeErrors.Inc()
+			return nil, status.Errorf(codes.InvalidArgument, "%s is only supported in inline ephemeral volumes", common.ScratchTTLKey)
+		}
+		// every scratch volume has its own directory
+		vc.SubPath = scratchPath(vc.SubPath, volumeID)
+		volCtx["subPath"] = vc.SubPath
+	}
+	if by := d.publishPausedBy(ctxWithLog, volumeID, volCtx); by != "" {
+		d.metrics.volumeErrors.Inc()
+		return nil, status.Errorf(codes.FailedPrecondition, "Volume %s is paused by %s, remove annotation %s to resume", volumeID, by, common.PausedAnnotationKey)
+	}
+	if err := d.attach.acquire(ctxWithLog, volumeID, target, volCap, req.GetReadonly(), volCtx); err != nil {
+		d.metrics.volumeErrors.Inc()
+		if _, ok := err.(*multiAttachError); ok {
+			return nil, status.Errorf(codes.FailedPrecondition, "Could not publish volume %s: %v", volumeID, err)
+		}
+		return nil, status.Errorf(codes.Unavailable, "Could not check if volume %s is published on other nodes: %v", volumeID, err)
+	}
+	if secretprovider.Enabled(volCtx) {
+		log.Info("fetch secrets from external secret store", "provider", volCtx[common.SecretProviderKey], "path", volCtx[common.SecretPathKey])
+		fetched, err := secretprovider.Fetch(ctx, volCtx)
+		if err != nil {
+			d.metrics.volumeErrors.Inc()
+			return nil, status.Errorf(codes.Unavailable, "Could not fetch secrets of volume %s: %v", volumeID, err)
+		}
+		secrets = secretprovider.Merge(secrets, fetched)
+	}
+	secrets, mirrored, err := d.mirrors.resolve(ctxWithLog, volumeID, target, secrets, volCtx)
+	if err != nil {
+		d.metrics.volumeErrors.Inc()
+		return nil, status.Errorf(codes.Unavailable, "Could not mount volume %s: %v", volumeID, err)
+	}
 
 	mountOptions := []string{}
 	// get mountOptions from PV.volumeAttributes or StorageClass.parameters
-	if opts, ok := volCtx["mountOptions"]; ok {
-		mountOptions = strings.Split(opts, ",")
-	}
+	mountOptions = append(mountOptions, vc.MountOptions...)
 	mountOptions = append(mountOptions, options...)
+	if (mirrored || vc.ImportedFrom != "") && !util.ContainsString(mountOptions, "ro") {
+		// mirror and volumes imported from another cluster are always mounted read-only
+		mountOptions = append(mountOptions, "ro")
+	}
+
+	if vc.RemoteMount != "" {
+		if err := d.remote.publish(ctxWithLog, volumeID, target, secrets, volCtx, vc, util.ContainsString(mountOptions, "ro")); err != nil {
+			d.metrics.volumeErrors.Inc()
+			return nil, status.Errorf(codes.Unavailable, "Could not mount volume %s from storage nodes: %v", volumeID, err)
+		}
+		log.Info("juicefs volume mounted from storage nodes", "volumeId", volumeID, "target", target)
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	if vc.ScratchTTL > 0 {
+		record := scratchRecord{
+			VolumeID:     volumeID,
+			SubPath:      vc.SubPath,
+			TTL:          vc.ScratchTTL.String(),
+			PublishedAt:  time.Now(),
+			PodNamespace: volCtx[common.PodInfoNamespace],
+			PodName:      volCtx[common.PodInfoName],
+			PodUID:       volCtx[common.PodInfoUID],
+			VolumeCtx:    volCtx,
+			MountOptions: mountOptions,
+		}
+		if err := d.recordScratch(ctxWithLog, record, target); err != nil {
+			d.metrics.volumeErrors.Inc()
+			return nil, status.Errorf(codes.Internal, "Could not record scratch volume %s: %v", volumeID, err)
+		}
+	}
 
 	log.Info("mounting juicefs", "secret", fmt.Sprintf("%+v", reflect.ValueOf(secrets).MapKeys()), "options", mountOptions)
-	jfs, err := d.juicefs.JfsMount(ctxWithLog, volumeID, target, secrets, volCtx, mountOptions)
+	var jfs juicefs.Jfs
+	err = traced(ctxWithLog, "mount", func(ctx context.Context) (err error) {
+		jfs, err = d.juicefs.JfsMount(ctx, volumeID, target, secrets, volCtx, mountOptions)
+		return err
+	})
 	if err != nil {
 		d.metrics.volumeErrors.Inc()
-		return nil, status.Errorf(codes.Internal, "Could not mount juicefs: %v", err)
+		class := juicefs.ClassifyMountError(err)
+		log.Info("mount juicefs failed", "class", class)
+		if class.Fatal() {
+			d.reportMisconfigured(ctxWithLog, volumeID, volCtx, class, err)
+		}
+		return nil, status.Errorf(mountErrorCode(err, class), "Could not mount juicefs: %v", err)
 	}
 
-	bindSource, err := jfs.CreateVol(ctxWithLog, volumeID, volCtx["subPath"])
+	bindSource, err := jfs.CreateVol(ctxWithLog, volumeID, vc.SubPath)
 	if err != nil {
 		d.metrics.volumeErrors.Inc()
 		return nil, status.Errorf(codes.Internal, "Could not create volume: %s, %v", volumeID, err)
 	}
 
-	if err := jfs.BindTarget(ctxWithLog, bindSource, target); err != nil {
-		d.metrics.volumeErrors.Inc()
-		return nil, status.Errorf(codes.Internal, "Could not bind %q at %q: %v", bindSource, target, err)
+	if len(vc.DirTree) > 0 {
+		if err := createDirTree(ctxWithLog, bindSource, vc.DirTree); err != nil {
+			d.metrics.volumeErrors.Inc()
+			return nil, status.Errorf(codes.Internal, "Could not create directory tree of volume %s: %v", volumeID, err)
+		}
 	}
 
-	if cap, exist := volCtx["capacity"]; exist {
-		capacity, err := strconv.ParseInt(cap, 10, 64)
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "invalid capacity %s: %v", cap, err)
+	if vc.VerifyOnMount != "" {
+		if err := verifyOnMount(ctxWithLog, bindSource, vc.VerifyOnMount, vc.VerifyOnMountSample); err != nil {
+			d.metrics.volumeErrors.Inc()
+			return nil, status.Errorf(codes.FailedPrecondition, "Could not verify volume %s: %v", volumeID, err)
 		}
-		settings := jfs.GetSetting()
-		if settings.PV != nil {
-			capacity = settings.PV.Spec.Capacity.Storage().Value()
+	}
+
+	if vc.Capacity != nil && vc.StrictCapacity {
+		if err := d.applyQuotaStrictly(ctxWithLog, secrets, jfs.GetSetting(), bindSource, *vc.Capacity); err != nil {
+			d.metrics.volumeErrors.Inc()
+			return nil, status.Errorf(codes.FailedPrecondition, "Could not apply capacity quota of volume %s: %v", volumeID, err)
 		}
-		quotaPath := settings.SubPath
-		var subdir string
-		for _, o := range settings.Options {
-			pair := strings.Split(o, "=")
-			if len(pair) != 2 {
-				continue
-			}
-			if pair[0] == "subdir" {
-				subdir = path.Join("/", pair[1])
-			}
+	}
+
+	if err := traced(ctxWithLog, "bindTarget", func(ctx context.Context) error {
+		return jfs.BindTarget(ctx, bindSource, target)
+	}); err != nil {
+		d.metrics.volumeErrors.Inc()
+		return nil, status.Errorf(codes.Internal, "Could not bind %q at %q: %v", bindSource, target, err)
+	}
+
+	if rate := auditSampleRate(volCtx); rate > 0 {
+		var pvc string
+		if settings := jfs.GetSetting(); settings != nil && settings.PVC != nil {
+			pvc = settings.PVC.Namespace + "/" + settings.PVC.Name
 		}
+		pod := volCtx[common.PodInfoNamespace] + "/" + volCtx[common.PodInfoName]
+		d.auditor.attach(jfs.GetBasePath(), target, volumeID, pvc, pod, rate)
+	}
 
+	if vc.Capacity != nil && !vc.StrictCapacity {
+		settings := jfs.GetSetting()
+		quotaPath, capacity := quotaOf(settings, *vc.Capacity)
 		d.quotaPool.Run(context.Background(), func(ctx context.Context) {
 			err := retry.OnError(retry.DefaultRetry, func(err error) bool { return true }, func() error {
-				return d.juicefs.SetQuota(ctx, secrets, settings, path.Join(subdir, quotaPath), capacity)
+				return d.juicefs.SetQuota(ctx, secrets, settings, quotaPath, capacity)
 			})
 			if err != nil {
 				log.Error(err, "set quota failed")
@@ -216,6 +333,86 @@ func (d *nodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// mountErrorCode returns the code of the mount error, so that errors which won't go away by retrying
+// are told apart from transient ones in kubelet events and by other callers
+func mountErrorCode(err error, class juicefs.MountErrorClass) codes.Code {
+	if errors.Is(err, juicefs.ErrMountLimitExceeded) {
+		return codes.ResourceExhausted
+	}
+	switch class {
+	case juicefs.MountErrorImagePull:
+		return codes.FailedPrecondition
+	case juicefs.MountErrorAuthDenied:
+		return codes.PermissionDenied
+	case juicefs.MountErrorInvalidMetaURL:
+		return codes.InvalidArgument
+	case juicefs.MountErrorTransient:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// reportMisconfigured emits an event on the application pod for mount errors which need the configuration fixed
+func (d *nodeService) reportMisconfigured(ctx context.Context, volumeID string, volCtx map[string]string, class juicefs.MountErrorClass, err error) {
+	if d.k8sClient == nil || volCtx[common.PodInfoName] == "" {
+		return
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      volCtx[common.PodInfoName],
+		Namespace: volCtx[common.PodInfoNamespace],
+		UID:       types.UID(volCtx[common.PodInfoUID]),
+	}}
+	if e := events.NewRecorder(d.k8sClient).Eventf(ctx, pod, corev1.EventTypeWarning, events.ReasonMountMisconfigured, events.ActionMount,
+		"Mount volume %s failed (%s), it won't succeed until the configuration is fixed: %v", volumeID, class, err); e != nil {
+		util.GenLog(ctx, driverLog, "reportMisconfigured").Error(e, "report mount error", "volumeId", volumeID)
+	}
+}
+
+// quotaOf returns the quota path of the volume in the file system and its capacity,
+// capacity of the PV takes precedence over the one in volume context since it may be expanded.
+func quotaOf(settings *config.JfsSetting, capacity int64) (string, int64) {
+	if settings.PV != nil {
+		capacity = settings.PV.Spec.Capacity.Storage().Value()
+	}
+	var subdir string
+	for _, o := range settings.Options {
+		pair := strings.Split(o, "=")
+		if len(pair) != 2 {
+			continue
+		}
+		if pair[0] == "subdir" {
+			subdir = path.Join("/", pair[1])
+		}
+	}
+	return path.Join(subdir, settings.SubPath), capacity
+}
+
+// quotaLoadTimeout is how long the client of the mount point is waited for to load the quota set by CLI
+var quotaLoadTimeout = 30 * time.Second
+
+// applyQuotaStrictly sets the capacity quota and makes sure it's applied to bindSource, the subpath of the volume
+// in the mount point, since the quota may be skipped silently, e.g. the juicefs client does not support it.
+// The quota is read in bytes from statfs of bindSource, which reports the quota of the directory as its size.
+func (d *nodeService) applyQuotaStrictly(ctx context.Context, secrets map[string]string, settings *config.JfsSetting, bindSource string, capacity int64) error {
+	quotaPath, capacity := quotaOf(settings, capacity)
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool { return true }, func() error {
+		return d.juicefs.SetQuota(ctx, secrets, settings, quotaPath, capacity)
+	})
+	if err != nil {
+		return err
+	}
+	want := juicefs.QuotaBytes(capacity)
+	var applied uint64
+	err = wait.PollUntilContextTimeout(ctx, time.Second, quotaLoadTimeout, true, func(ctx context.Context) (bool, error) {
+		applied, _, _, _ = util.GetDiskUsage(bindSource)
+		return int64(applied) == want, nil
+	})
+	if err != nil {
+		return fmt.Errorf("quota of %s is %d bytes, expected %d bytes", quotaPath, applied, want)
+	}
+	return nil
+}
+
 // NodeUnpublishVolume is a reverse operation of NodePublishVolume. This RPC is typically called by the CO when the workload using the volume is being moved to a different node, or all the workload using the volume on a node has finished.
 func (d *nodeService) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
 	log := klog.NewKlogr().WithName("NodeUnpublishVolume")
@@ -230,11 +427,29 @@ func (d *nodeService) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	volumeId := req.GetVolumeId()
 	log.Info("get volume_id", "volumeId", volumeId)
 
+	if remote, err := d.remote.unpublish(ctxWithLog, target); remote {
+		if err != nil {
+			d.metrics.volumeDelErrors.Inc()
+			return nil, status.Errorf(codes.Internal, "Could not unmount %q: %v", target, err)
+		}
+		if err := d.attach.release(ctxWithLog, volumeId, target); err != nil {
+			log.Error(err, "release volume on the node error, it's taken over by other nodes once the pod is gone", "volumeId", volumeId)
+		}
+		return &csi.NodeUnpublishVolumeResponse{}, nil
+	} else if err != nil {
+		log.Error(err, "list mount points error, unmount as usual", "target", target)
+	}
+
 	err := d.juicefs.JfsUnmount(ctxWithLog, volumeId, target)
 	if err != nil {
 		d.metrics.volumeDelErrors.Inc()
 		return nil, status.Errorf(codes.Internal, "Could not unmount %q: %v", target, err)
 	}
+	d.mirrors.forget(target)
+	d.auditor.detach(target)
+	if err := d.attach.release(ctxWithLog, volumeId, target); err != nil {
+		log.Error(err, "release volume on the node error, it's taken over by other nodes once the pod is gone", "volumeId", volumeId)
+	}
 
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
@@ -262,9 +477,15 @@ func (d *nodeService) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoReque
 	log := klog.NewKlogr().WithName("NodeGetInfo")
 	log.V(1).Info("called with args", "args", req)
 
-	return &csi.NodeGetInfoResponse{
+	resp := &csi.NodeGetInfoResponse{
 		NodeId: d.nodeID,
-	}, nil
+	}
+	if d.fuse != nil {
+		if segments := d.fuse.topology(); segments != nil {
+			resp.AccessibleTopology = &csi.Topology{Segments: segments}
+		}
+	}
+	return resp, nil
 }
 
 // NodeExpandVolume unimplemented
@@ -345,3 +566,10 @@ func (d *nodeService) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVo
 		},
 	}, nil
 }
+
+// verifyOnMount verifies the checksum manifest in the volume before it is bound to target
+func verifyOnMount(ctx context.Context, bindSource, manifest string, sample int) error {
+	log := util.GenLog(ctx, klog.NewKlogr(), "verifyOnMount")
+	log.Info("verifying checksum manifest", "manifest", manifest, "sample", sample)
+	return util.VerifyChecksumManifest(ctx, bindSource, manifest, sample)
+}
@@ -21,20 +21,28 @@ import (
 	"errors"
 	"os"
 	"os/exec"
+	"path"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/agiledragon/gomonkey/v2"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/klog/v2"
 	k8sexec "k8s.io/utils/exec"
 	"k8s.io/utils/mount"
 
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
 	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
@@ -103,6 +111,119 @@ var _ = Describe("nodeService", func() {
 				Expect(err).Should(BeNil())
 			})
 		})
+		Context("test verify-on-mount", func() {
+			volumeId := "vol-test"
+			subPath := "/subPath"
+			targetPath := "/test/path"
+			secret := map[string]string{"a": "b"}
+
+			var patch *Patches
+			BeforeEach(func() {
+				patch = ApplyFunc(os.MkdirAll, func(path string, perm os.FileMode) error {
+					return nil
+				})
+			})
+			AfterEach(func() {
+				patch.Reset()
+			})
+			It("should fail before bind when checksum mismatch", func() {
+				bindSource := GinkgoT().TempDir()
+				Expect(os.WriteFile(path.Join(bindSource, "data"), []byte("data"), 0644)).Should(BeNil())
+				Expect(os.WriteFile(path.Join(bindSource, "SHA256SUMS"),
+					[]byte(strings.Repeat("0", 64)+"  data\n"), 0644)).Should(BeNil())
+				volumeCtx := map[string]string{"subPath": subPath, common.VerifyOnMountKey: "SHA256SUMS"}
+
+				ctx := util.WithLog(context.TODO(), klog.NewKlogr().WithName("NodePublishVolume").WithValues("volumeId", volumeId))
+				mockCtl := gomock.NewController(GinkgoT())
+				defer mockCtl.Finish()
+				mockJfs := mocks.NewMockJfs(mockCtl)
+				mockJfs.EXPECT().CreateVol(ctx, volumeId, subPath).Return(bindSource, nil)
+				mockJuicefs := mocks.NewMockInterface(mockCtl)
+				mockJuicefs.EXPECT().JfsMount(ctx, volumeId, targetPath, secret, volumeCtx, []string{}).Return(mockJfs, nil)
+				mockJuicefs.EXPECT().CreateTarget(ctx, targetPath).Return(nil)
+				juicefsDriver.juicefs = mockJuicefs
+				req := &csi.NodePublishVolumeRequest{
+					VolumeId:         volumeId,
+					TargetPath:       targetPath,
+					VolumeCapability: stdVolCap,
+					Secrets:          secret,
+					VolumeContext:    volumeCtx,
+				}
+
+				_, err := juicefsDriver.NodePublishVolume(context.TODO(), req)
+				Expect(status.Code(err)).Should(Equal(codes.FailedPrecondition))
+			})
+		})
+		Context("test strict capacity", func() {
+			volumeId := "vol-test"
+			subPath := "/subPath"
+			targetPath := "/test/path"
+			bindSource := "/test/path"
+			volumeCtx := map[string]string{"subPath": subPath, "capacity": "1073741824", common.StrictCapacityKey: "true"}
+			secret := map[string]string{"a": "b"}
+			settings := &config.JfsSetting{SubPath: subPath, Options: []string{"subdir=/tenant"}}
+			ctx := util.WithLog(context.TODO(), klog.NewKlogr().WithName("NodePublishVolume").WithValues("volumeId", volumeId))
+			newReq := func() *csi.NodePublishVolumeRequest {
+				return &csi.NodePublishVolumeRequest{
+					VolumeId:         volumeId,
+					TargetPath:       targetPath,
+					VolumeCapability: stdVolCap,
+					Secrets:          map[string]string{"a": "b"},
+					VolumeContext:    volumeCtx,
+				}
+			}
+
+			var patch *Patches
+			BeforeEach(func() {
+				patch = ApplyFunc(os.MkdirAll, func(path string, perm os.FileMode) error {
+					return nil
+				})
+			})
+			AfterEach(func() {
+				patch.Reset()
+			})
+			It("should succeed when quota is applied", func() {
+				mockCtl := gomock.NewController(GinkgoT())
+				defer mockCtl.Finish()
+				mockJfs := mocks.NewMockJfs(mockCtl)
+				mockJfs.EXPECT().CreateVol(ctx, volumeId, subPath).Return(bindSource, nil)
+				mockJfs.EXPECT().GetSetting().Return(settings)
+				mockJfs.EXPECT().BindTarget(ctx, bindSource, targetPath).Return(nil)
+				mockJuicefs := mocks.NewMockInterface(mockCtl)
+				mockJuicefs.EXPECT().JfsMount(ctx, volumeId, targetPath, secret, volumeCtx, []string{}).Return(mockJfs, nil)
+				mockJuicefs.EXPECT().CreateTarget(ctx, targetPath).Return(nil)
+				mockJuicefs.EXPECT().SetQuota(ctx, secret, settings, "/tenant/subPath", int64(1073741824)).Return(nil)
+				juicefsDriver.juicefs = mockJuicefs
+				usagePatch := ApplyFunc(util.GetDiskUsage, func(path string) (uint64, uint64, uint64, uint64) {
+					return 1073741824, 0, 0, 0
+				})
+				defer usagePatch.Reset()
+
+				_, err := juicefsDriver.NodePublishVolume(context.TODO(), newReq())
+				Expect(err).Should(BeNil())
+			})
+			It("should fail before bind when quota is not applied", func() {
+				mockCtl := gomock.NewController(GinkgoT())
+				defer mockCtl.Finish()
+				mockJfs := mocks.NewMockJfs(mockCtl)
+				mockJfs.EXPECT().CreateVol(ctx, volumeId, subPath).Return(bindSource, nil)
+				mockJfs.EXPECT().GetSetting().Return(settings)
+				mockJuicefs := mocks.NewMockInterface(mockCtl)
+				mockJuicefs.EXPECT().JfsMount(ctx, volumeId, targetPath, secret, volumeCtx, []string{}).Return(mockJfs, nil)
+				mockJuicefs.EXPECT().CreateTarget(ctx, targetPath).Return(nil)
+				mockJuicefs.EXPECT().SetQuota(ctx, secret, settings, "/tenant/subPath", int64(1073741824)).Return(nil)
+				juicefsDriver.juicefs = mockJuicefs
+				usagePatch := ApplyFunc(util.GetDiskUsage, func(path string) (uint64, uint64, uint64, uint64) {
+					return 1 << 40, 0, 0, 0
+				})
+				defer usagePatch.Reset()
+				defer func(timeout time.Duration) { quotaLoadTimeout = timeout }(quotaLoadTimeout)
+				quotaLoadTimeout = time.Second
+
+				_, err := juicefsDriver.NodePublishVolume(context.TODO(), newReq())
+				Expect(status.Code(err)).Should(Equal(codes.FailedPrecondition))
+			})
+		})
 		Context("test mountOptions in volumeAttributes", func() {
 			volumeId := "vol-test"
 			subPath := "/subPath"
@@ -841,3 +962,25 @@ func Test_nodeService_NodeUnstageVolume(t *testing.T) {
 		})
 	}
 }
+
+func TestMountErrorCode(t *testing.T) {
+	authErr := errors.New("failed log: NOAUTH Authentication required")
+	if code := mountErrorCode(authErr, juicefs.ClassifyMountError(authErr)); code != codes.PermissionDenied {
+		t.Errorf("mountErrorCode() = %v, want %v", code, codes.PermissionDenied)
+	}
+	if code := mountErrorCode(juicefs.ErrMountLimitExceeded, juicefs.MountErrorTransient); code != codes.ResourceExhausted {
+		t.Errorf("mountErrorCode() = %v, want %v", code, codes.ResourceExhausted)
+	}
+	if code := mountErrorCode(errors.New("test"), juicefs.MountErrorUnknown); code != codes.Internal {
+		t.Errorf("mountErrorCode() = %v, want %v", code, codes.Internal)
+	}
+
+	client := fake.NewSimpleClientset()
+	d := &nodeService{k8sClient: &k8s.K8sClient{Interface: client}}
+	volCtx := map[string]string{common.PodInfoName: "app", common.PodInfoNamespace: "default"}
+	d.reportMisconfigured(context.TODO(), "pv-misconfigured", volCtx, juicefs.MountErrorAuthDenied, authErr)
+	evs, _ := client.CoreV1().Events("default").List(context.TODO(), metav1.ListOptions{})
+	if len(evs.Items) != 1 || evs.Items[0].Reason != events.ReasonMountMisconfigured || evs.Items[0].InvolvedObject.Name != "app" {
+		t.Errorf("reportMisconfigured() events = %+v", evs.Items)
+	}
+}
@@ -0,0 +1,361 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+const (
+	// orphanMinAge protects directories of volumes being provisioned, whose PVs are not created yet
+	orphanMinAge = time.Hour
+	// orphanEventLimit is the max number of directories listed in an event
+	orphanEventLimit = 10
+)
+
+var orphanLog = klog.NewKlogr().WithName("orphan-auditor")
+
+type orphanMetrics struct {
+	subdirs *prometheus.GaugeVec
+	deleted *prometheus.CounterVec
+}
+
+func newOrphanMetrics(reg prometheus.Registerer) *orphanMetrics {
+	metrics := &orphanMetrics{}
+	metrics.subdirs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "orphan_subdirs",
+		Help: "number of top-level directories in the file system which are not used by any PV",
+	}, []string{"storage_class"})
+	metrics.deleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "orphan_subdirs_deleted_total",
+		Help: "number of orphan directories deleted after the retention period",
+	}, []string{"storage_class"})
+	reg.MustRegister(metrics.subdirs, metrics.deleted)
+	return metrics
+}
+
+// fsGroup is the StorageClasses provisioning volumes in the same file system, identified by the provisioner secret
+type fsGroup struct {
+	secretNamespace string
+	secretName      string
+	subdir          string
+	classes         []storagev1.StorageClass
+}
+
+// orphanAuditor lists the top-level directories of the file systems managed by StorageClasses periodically,
+// and reports the ones not used by any PV, e.g. left by PVs deleted manually. Orphans older than the retention
+// period are deleted if retention is set.
+type orphanAuditor struct {
+	juicefs   juicefs.Interface
+	k8sClient *k8s.K8sClient
+	metrics   *orphanMetrics
+	now       func() time.Time
+}
+
+func newOrphanAuditor(jfs juicefs.Interface, k8sClient *k8s.K8sClient, reg prometheus.Registerer) *orphanAuditor {
+	return &orphanAuditor{juicefs: jfs, k8sClient: k8sClient, metrics: newOrphanMetrics(reg), now: time.Now}
+}
+
+func (a *orphanAuditor) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		a.audit(ctx)
+	}
+}
+
+func (a *orphanAuditor) audit(ctx context.Context) {
+	classes, err := a.k8sClient.ListStorageClasses(ctx)
+	if err != nil {
+		orphanLog.Error(err, "list storage classes error")
+		return
+	}
+	pvs, err := a.k8sClient.ListPersistentVolumes(ctx, nil, nil)
+	if err != nil {
+		orphanLog.Error(err, "list pvs error")
+		return
+	}
+	pods, err := a.k8sClient.ListPod(ctx, "", nil, nil)
+	if err != nil {
+		orphanLog.Error(err, "list pods error")
+		return
+	}
+	refs := volumeRefs(pvs, pods)
+	fsNames := map[string]string{}
+	for _, group := range groupByFileSystem(classes) {
+		if err := a.auditGroup(ctx, group, refs, fsNames); err != nil {
+			orphanLog.Error(err, "audit file system error", "secret", group.secretNamespace+"/"+group.secretName)
+		}
+	}
+}
+
+// groupByFileSystem groups the StorageClasses of this driver by the file system they provision volumes in
+func groupByFileSystem(classes []storagev1.StorageClass) []*fsGroup {
+	groups := map[string]*fsGroup{}
+	var keys []string
+	for _, sc := range classes {
+		if sc.Provisioner != config.DriverName {
+			continue
+		}
+		name, namespace := config.StorageClassSecret(sc.Parameters, config.SecretOpProvisioner)
+		if namespace == "" || name == "" || strings.Contains(namespace+name, "${") {
+			// secrets resolved per PVC can't be audited
+			continue
+		}
+		key := namespace + "/" + name
+		group, ok := groups[key]
+		if !ok {
+			group = &fsGroup{secretNamespace: namespace, secretName: name, subdir: subdirOption(sc.MountOptions)}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.classes = append(group.classes, sc)
+	}
+	sort.Strings(keys)
+	result := make([]*fsGroup, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, groups[key])
+	}
+	return result
+}
+
+// subdirOption returns the subdir mount option, in the form of a clean absolute path
+func subdirOption(options []string) string {
+	subdir := "/"
+	for _, option := range options {
+		for _, o := range strings.Split(option, ",") {
+			if k, v, found := strings.Cut(strings.TrimSpace(o), "="); found && k == "subdir" {
+				subdir = path.Join("/", v)
+			}
+		}
+	}
+	return subdir
+}
+
+// volumeRef is a volume which may use a directory of a file system, a PV or an inline ephemeral volume of a pod
+type volumeRef struct {
+	name            string
+	storageClass    string
+	secretNamespace string
+	secretName      string
+	mountOptions    []string
+	subPath         string
+}
+
+// volumeRefs returns the PVs and the inline ephemeral volumes of pods of this driver
+func volumeRefs(pvs []corev1.PersistentVolume, pods []corev1.Pod) []volumeRef {
+	var refs []volumeRef
+	for _, pv := range pvs {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName {
+			continue
+		}
+		ref := volumeRef{
+			name:         "pv/" + pv.Name,
+			storageClass: pv.Spec.StorageClassName,
+			mountOptions: pv.Spec.MountOptions,
+			subPath:      pv.Spec.CSI.VolumeAttributes["subPath"],
+		}
+		if secret := pv.Spec.CSI.NodePublishSecretRef; secret != nil {
+			ref.secretNamespace, ref.secretName = secret.Namespace, secret.Name
+		}
+		refs = append(refs, ref)
+	}
+	for _, pod := range pods {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.CSI == nil || volume.CSI.Driver != config.DriverName {
+				continue
+			}
+			ref := volumeRef{
+				name:            fmt.Sprintf("pod/%s/%s:%s", pod.Namespace, pod.Name, volume.Name),
+				secretNamespace: pod.Namespace,
+				subPath:         volume.CSI.VolumeAttributes["subPath"],
+			}
+			if volume.CSI.NodePublishSecretRef != nil {
+				ref.secretName = volume.CSI.NodePublishSecretRef.Name
+			}
+			if options := volume.CSI.VolumeAttributes["mountOptions"]; options != "" {
+				ref.mountOptions = strings.Split(options, ",")
+			}
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// usedBy returns whether the volume is in the file system of the group. The file system of a volume provisioned by
+// another StorageClass, or a static one, is known by the name in its secret. fsNames caches the names of secrets.
+func (a *orphanAuditor) usedBy(ctx context.Context, group *fsGroup, fsName string, ref volumeRef, fsNames map[string]string) (bool, error) {
+	for _, sc := range group.classes {
+		if ref.storageClass != "" && ref.storageClass == sc.Name {
+			return true, nil
+		}
+	}
+	if ref.secretName == "" {
+		return false, fmt.Errorf("no secret")
+	}
+	if ref.secretNamespace == group.secretNamespace && ref.secretName == group.secretName {
+		return true, nil
+	}
+	key := ref.secretNamespace + "/" + ref.secretName
+	name, ok := fsNames[key]
+	if !ok {
+		secret, err := a.k8sClient.GetSecret(ctx, ref.secretName, ref.secretNamespace)
+		if err != nil {
+			return false, err
+		}
+		name = string(secret.Data["name"])
+		fsNames[key] = name
+	}
+	if name == "" || fsName == "" {
+		return false, fmt.Errorf("no name of file system in secret %s", key)
+	}
+	return name == fsName, nil
+}
+
+func (a *orphanAuditor) auditGroup(ctx context.Context, group *fsGroup, refs []volumeRef, fsNames map[string]string) error {
+	log := orphanLog.WithValues("secret", group.secretNamespace+"/"+group.secretName, "subdir", group.subdir)
+	for _, sc := range group.classes[1:] {
+		if subdirOption(sc.MountOptions) != group.subdir {
+			log.Info("storage classes using the same secret mount different subdirs, skip auditing", "storageClass", sc.Name)
+			return nil
+		}
+	}
+
+	secret, err := a.k8sClient.GetSecret(ctx, group.secretName, group.secretNamespace)
+	if err != nil {
+		return err
+	}
+	secrets := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+	// top-level directories used by the volumes, relative to the subdir of the group. Orphans are only deleted if
+	// the file systems of all the volumes are known, otherwise a directory of an unknown one may be deleted.
+	used := map[string]bool{common.ScratchDir: true, common.VolumePoolDir: true}
+	owned := true
+	for _, ref := range refs {
+		same, err := a.usedBy(ctx, group, secrets["name"], ref, fsNames)
+		if err != nil {
+			log.Info("can't tell the file system of volume, orphans are only reported", "volume", ref.name, "error", err.Error())
+			owned = false
+			continue
+		}
+		if !same {
+			continue
+		}
+		refPath := path.Join(subdirOption(ref.mountOptions), ref.subPath)
+		var rel string
+		switch {
+		case group.subdir == "/":
+			rel = strings.TrimPrefix(refPath, "/")
+		case refPath == group.subdir:
+		case strings.HasPrefix(refPath, group.subdir+"/"):
+			rel = strings.TrimPrefix(refPath, group.subdir+"/")
+		default:
+			// not under the subdir
+			continue
+		}
+		if rel == "" {
+			log.Info("volume mounts the whole file system, skip auditing", "volume", ref.name)
+			return nil
+		}
+		used[strings.Split(rel, "/")[0]] = true
+	}
+
+	sc := group.classes[0]
+	volCtx := make(map[string]string, len(sc.Parameters))
+	for k, v := range sc.Parameters {
+		volCtx[k] = v
+	}
+	auditID := "orphan-audit-" + sc.Name
+	subdirs, err := a.juicefs.JfsListSubdirs(ctx, auditID, secrets, volCtx, sc.MountOptions)
+	if err != nil {
+		return err
+	}
+
+	var orphans []string
+	now := a.now()
+	for _, subdir := range subdirs {
+		age := now.Sub(subdir.ModTime)
+		if used[subdir.Name] || age < orphanMinAge {
+			continue
+		}
+		if owned && config.OrphanRetention > 0 && age > config.OrphanRetention {
+			log.Info("delete orphan directory after the retention period", "dir", subdir.Name, "modTime", subdir.ModTime)
+			if err := a.juicefs.JfsDeleteSubPath(ctx, "orphan-"+subdir.Name, subdir.Name, secrets, volCtx, sc.MountOptions); err != nil {
+				log.Error(err, "delete orphan directory error", "dir", subdir.Name)
+			} else {
+				a.metrics.deleted.WithLabelValues(sc.Name).Inc()
+				continue
+			}
+		}
+		orphans = append(orphans, subdir.Name)
+	}
+	for _, c := range group.classes {
+		a.metrics.subdirs.WithLabelValues(c.Name).Set(float64(len(orphans)))
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	log.Info("found orphan directories", "count", len(orphans), "dirs", orphans)
+	listed := orphans
+	if len(listed) > orphanEventLimit {
+		listed = listed[:orphanEventLimit]
+	}
+	msg := fmt.Sprintf("%d directories in %s are not used by any PV: %s", len(orphans), group.subdir, strings.Join(listed, ", "))
+	if len(orphans) > len(listed) {
+		msg += ", ..."
+	}
+	for _, c := range group.classes {
+		if err := events.NewRecorder(a.k8sClient).Event(ctx, &c, corev1.EventTypeWarning, events.ReasonOrphanSubdirs, events.ActionAudit, msg); err != nil {
+			log.Error(err, "create event error", "storageClass", c.Name)
+		}
+	}
+	return nil
+}
+
+// RunOrphanAuditor audits orphan directories every config.OrphanAuditInterval until ctx is done, it's run in CSI Controller
+func (d *Driver) RunOrphanAuditor(ctx context.Context) {
+	if config.OrphanAuditInterval <= 0 || d.orphans == nil {
+		return
+	}
+	d.runAsLeader(ctx, "orphan-auditor", func(ctx context.Context) {
+		d.orphans.run(ctx, config.OrphanAuditInterval)
+	})
+}
@@ -0,0 +1,191 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestOrphanAuditor(t *testing.T) {
+	defer func() { config.OrphanRetention = 0 }()
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+
+	params := map[string]string{
+		common.ProvisionerSecretName:      "juicefs-secret",
+		common.ProvisionerSecretNamespace: "kube-system",
+		common.PublishSecretName:          "juicefs-secret",
+		common.PublishSecretNamespace:     "kube-system",
+	}
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-sc"}, Provisioner: config.DriverName, Parameters: params, MountOptions: []string{"subdir=/k8s"}}
+	templated := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "templated"}, Provisioner: config.DriverName, Parameters: map[string]string{
+		common.ProvisionerSecretName:      "${pvc.name}",
+		common.ProvisionerSecretNamespace: "${pvc.namespace}",
+	}}
+	pv := func(name, scName string, mountOptions []string, subPath string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				StorageClassName: scName,
+				MountOptions:     mountOptions,
+				PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:               config.DriverName,
+					VolumeHandle:         name,
+					VolumeAttributes:     map[string]string{"subPath": subPath},
+					NodePublishSecretRef: &corev1.SecretReference{Name: "juicefs-secret", Namespace: "kube-system"},
+				}},
+			},
+		}
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-secret", Namespace: "kube-system"}, Data: map[string][]byte{"name": []byte("myjfs")}}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(sc, templated, secret,
+		pv("pvc-dynamic", "juicefs-sc", []string{"subdir=/k8s"}, "pvc-dynamic"),
+		// static pv in the same file system
+		pv("static", "", []string{"subdir=/k8s/static-data/sub"}, ""),
+		// static pv out of the subdir
+		pv("other", "", []string{"subdir=/other"}, ""),
+	)}
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	a := newOrphanAuditor(mockJuicefs, client, prometheus.NewRegistry())
+	a.now = func() time.Time { return now }
+	mockJuicefs.EXPECT().JfsListSubdirs(gomock.Any(), "orphan-audit-juicefs-sc", map[string]string{"name": "myjfs"}, params, []string{"subdir=/k8s"}).Return([]mount.Subdir{
+		{Name: "pvc-dynamic", ModTime: old},
+		{Name: "static-data", ModTime: old},
+		{Name: common.ScratchDir, ModTime: old},
+		{Name: "pvc-deleted", ModTime: old},
+		{Name: "pvc-provisioning", ModTime: now},
+	}, nil).Times(2)
+	a.audit(context.TODO())
+
+	if got := testutil.ToFloat64(a.metrics.subdirs.WithLabelValues("juicefs-sc")); got != 1 {
+		t.Errorf("orphan_subdirs = %v, want 1", got)
+	}
+	events, _ := client.CoreV1().Events(metav1.NamespaceDefault).List(context.TODO(), metav1.ListOptions{})
+	if len(events.Items) != 1 || events.Items[0].Reason != "OrphanSubdirs" || !strings.Contains(events.Items[0].Message, "pvc-deleted") {
+		t.Fatalf("events = %+v", events.Items)
+	}
+
+	// delete orphans after retention
+	config.OrphanRetention = 24 * time.Hour
+	mockJuicefs.EXPECT().JfsDeleteSubPath(gomock.Any(), "orphan-pvc-deleted", "pvc-deleted", map[string]string{"name": "myjfs"}, params, []string{"subdir=/k8s"}).Return(nil)
+	a.audit(context.TODO())
+	if got := testutil.ToFloat64(a.metrics.subdirs.WithLabelValues("juicefs-sc")); got != 0 {
+		t.Errorf("orphan_subdirs after deleted = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(a.metrics.deleted.WithLabelValues("juicefs-sc")); got != 1 {
+		t.Errorf("orphan_subdirs_deleted_total = %v, want 1", got)
+	}
+}
+
+func TestOrphanAuditorSkipsWholeFileSystem(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-sc"}, Provisioner: config.DriverName, Parameters: map[string]string{
+		common.ProvisionerSecretName:      "juicefs-secret",
+		common.ProvisionerSecretNamespace: "kube-system",
+	}}
+	root := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "root"},
+		Spec: corev1.PersistentVolumeSpec{
+			StorageClassName: "juicefs-sc",
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+				Driver: config.DriverName, VolumeHandle: "root",
+			}},
+		},
+	}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(sc, root)}
+	// no listing since all the directories may be used by the pv
+	newOrphanAuditor(mockJuicefs, client, prometheus.NewRegistry()).audit(context.TODO())
+}
+
+func TestOrphanAuditorOwnership(t *testing.T) {
+	defer func() { config.OrphanRetention = 0 }()
+	config.OrphanRetention = 24 * time.Hour
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+
+	params := map[string]string{
+		common.ProvisionerSecretName:      "juicefs-secret",
+		common.ProvisionerSecretNamespace: "kube-system",
+	}
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-sc"}, Provisioner: config.DriverName, Parameters: params}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-secret", Namespace: "kube-system"}, Data: map[string][]byte{"name": []byte("myjfs")}}
+	// the same file system with another secret
+	appSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-secret", Namespace: "app"}, Data: map[string][]byte{"name": []byte("myjfs")}}
+	static := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "static"},
+		Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+			Driver:               config.DriverName,
+			VolumeHandle:         "static",
+			VolumeAttributes:     map[string]string{"subPath": "static-data"},
+			NodePublishSecretRef: &corev1.SecretReference{Name: "app-secret", Namespace: "app"},
+		}}},
+	}
+	inline := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{
+			Driver:               config.DriverName,
+			VolumeAttributes:     map[string]string{"subPath": "inline-data"},
+			NodePublishSecretRef: &corev1.LocalObjectReference{Name: "app-secret"},
+		}}}}},
+	}
+	clientset := fake.NewSimpleClientset(sc, secret, appSecret, static, inline)
+	client := &k8s.K8sClient{Interface: clientset}
+
+	old := time.Now().Add(-48 * time.Hour)
+	subdirs := []mount.Subdir{
+		{Name: "static-data", ModTime: old},
+		{Name: "inline-data", ModTime: old},
+		{Name: "pvc-deleted", ModTime: old},
+	}
+	a := newOrphanAuditor(mockJuicefs, client, prometheus.NewRegistry())
+	mockJuicefs.EXPECT().JfsListSubdirs(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(subdirs, nil).Times(2)
+	// only the directory not used by the static pv and the inline volume is deleted
+	mockJuicefs.EXPECT().JfsDeleteSubPath(gomock.Any(), "orphan-pvc-deleted", "pvc-deleted", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	a.audit(context.TODO())
+
+	// the file system of a pv is unknown without its secret, orphans are only reported
+	if err := clientset.CoreV1().Secrets("app").Delete(context.TODO(), "app-secret", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	a.audit(context.TODO())
+	if got := testutil.ToFloat64(a.metrics.subdirs.WithLabelValues("juicefs-sc")); got != 3 {
+		t.Errorf("orphan_subdirs = %v, want 3", got)
+	}
+}
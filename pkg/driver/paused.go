@@ -0,0 +1,91 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+// isPaused checks if the object is paused by admin, e.g. during maintenance of the metadata engine
+func isPaused(annotations map[string]string) bool {
+	return annotations[common.PausedAnnotationKey] == "true"
+}
+
+// pausedBy returns the PV or StorageClass which pauses the volume, empty if the volume is not paused
+func pausedBy(ctx context.Context, client *k8s.K8sClient, pv *corev1.PersistentVolume, scName string) (string, error) {
+	if pv != nil && isPaused(pv.Annotations) {
+		return "PersistentVolume/" + pv.Name, nil
+	}
+	if scName == "" {
+		return "", nil
+	}
+	sc, err := client.GetStorageClass(ctx, scName)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if isPaused(sc.Annotations) {
+		return "StorageClass/" + scName, nil
+	}
+	return "", nil
+}
+
+// publishPausedBy returns the PV or StorageClass which pauses publishing of the volume. The volume is
+// not regarded as paused if its PV can not be found, e.g. inline volumes.
+func (d *nodeService) publishPausedBy(ctx context.Context, volumeID string, volCtx map[string]string) string {
+	if d.k8sClient == nil {
+		return ""
+	}
+	log := util.GenLog(ctx, driverLog, "")
+	pv, _, err := resource.GetPVWithVolumeHandleOrAppInfo(ctx, d.k8sClient, volumeID, volCtx)
+	if err != nil {
+		log.V(1).Info("get pv error, skip checking if volume is paused", "error", err)
+		return ""
+	}
+	by, err := pausedBy(ctx, d.k8sClient, pv, pv.Spec.StorageClassName)
+	if err != nil {
+		log.Error(err, "check if volume is paused error, ignore it")
+	}
+	return by
+}
+
+// provisionPausedBy returns the StorageClass which pauses provisioning of the volume. StorageClass
+// is found by the PVC, which is only known when csi-provisioner runs with --extra-create-metadata.
+func (d *controllerService) provisionPausedBy(ctx context.Context, params map[string]string) (string, error) {
+	name, namespace := params[common.PVCNameKey], params[common.PVCNamespaceKey]
+	if d.k8sClient == nil || name == "" || namespace == "" {
+		return "", nil
+	}
+	pvc, err := d.k8sClient.GetPersistentVolumeClaim(ctx, name, namespace)
+	if err != nil {
+		return "", err
+	}
+	if pvc.Spec.StorageClassName == nil {
+		return "", nil
+	}
+	return pausedBy(ctx, d.k8sClient, nil, *pvc.Spec.StorageClassName)
+}
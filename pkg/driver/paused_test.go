@@ -0,0 +1,79 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestPaused(t *testing.T) {
+	ctx := context.TODO()
+	paused := map[string]string{common.PausedAnnotationKey: "true"}
+	scName := "juicefs-sc"
+	newPV := func(name string, annotations map[string]string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations},
+			Spec: corev1.PersistentVolumeSpec{
+				StorageClassName: scName,
+				ClaimRef:         &corev1.ObjectReference{Name: name, Namespace: "default"},
+			},
+		}
+	}
+	newPVC := func(name string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &scName, VolumeName: name},
+		}
+	}
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: scName}}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		sc, newPV("pv-a", nil), newPVC("pv-a"), newPV("pv-b", paused), newPVC("pv-b"),
+	)}
+	node := &nodeService{k8sClient: client}
+	controller := &controllerService{k8sClient: client}
+	params := map[string]string{common.PVCNameKey: "pv-a", common.PVCNamespaceKey: "default"}
+
+	assert.Equal(t, "", node.publishPausedBy(ctx, "pv-a", nil))
+	assert.Equal(t, "PersistentVolume/pv-b", node.publishPausedBy(ctx, "pv-b", nil))
+	// pv not found
+	assert.Equal(t, "", node.publishPausedBy(ctx, "pv-c", nil))
+	by, err := controller.provisionPausedBy(ctx, params)
+	assert.NoError(t, err)
+	assert.Equal(t, "", by)
+	// pvc unknown without --extra-create-metadata
+	by, err = controller.provisionPausedBy(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", by)
+
+	sc.Annotations = paused
+	_, err = client.StorageV1().StorageClasses().Update(ctx, sc, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "StorageClass/"+scName, node.publishPausedBy(ctx, "pv-a", nil))
+	by, err = controller.provisionPausedBy(ctx, params)
+	assert.NoError(t, err)
+	assert.Equal(t, "StorageClass/"+scName, by)
+}
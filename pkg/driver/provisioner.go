@@ -36,9 +36,12 @@ import (
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
 	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/rebind"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/secretprovider"
 )
 
 var (
@@ -52,6 +55,9 @@ type provisionerService struct {
 	leaderElectionNamespace     string
 	leaderElectionLeaseDuration time.Duration
 	metrics                     *provisionerMetrics
+	metaProber                  *metaProber
+	opMetrics                   *controllerMetrics
+	pool                        *volumePool
 }
 
 type provisionerMetrics struct {
@@ -82,6 +88,7 @@ func newProvisionerService(k8sClient *k8s.K8sClient, leaderElection bool,
 		leaderElectionNamespace:     leaderElectionNamespace,
 		leaderElectionLeaseDuration: leaderElectionLeaseDuration,
 		metrics:                     metrics,
+		pool:                        newVolumePool(jfs, k8sClient, reg),
 	}, nil
 }
 
@@ -90,6 +97,14 @@ func (j *provisionerService) Run(ctx context.Context) {
 		provisionerLog.Info("K8sClient is nil")
 		os.Exit(1)
 	}
+	if name, err := j.externalProvisioner(ctx); err != nil {
+		provisionerLog.Error(err, "check external provisioner error")
+	} else if name != "" {
+		// both would provision the same PVCs, and create duplicated PVs
+		provisionerLog.Error(nil, "external provisioner is running in the pod of CSI Controller with --provisioner=true, remove the sidecar to use the built-in provisioner, or disable it",
+			"container", name)
+		os.Exit(1)
+	}
 	pc := provisioncontroller.NewProvisionController(
 		provisionerLog,
 		j.K8sClient,
@@ -99,31 +114,88 @@ func (j *provisionerService) Run(ctx context.Context) {
 		provisioncontroller.LeaseDuration(j.leaderElectionLeaseDuration),
 		provisioncontroller.LeaderElectionNamespace(j.leaderElectionNamespace),
 	)
+	// pools are filled by the leader only, or every replica fills them up to their sizes
+	go j.runAsLeader(ctx, "volume-pool", j.pool.run)
 	pc.Run(ctx)
 }
 
-func (j *provisionerService) Provision(ctx context.Context, options provisioncontroller.ProvisionOptions) (*corev1.PersistentVolume, provisioncontroller.ProvisioningState, error) {
+// externalProvisioner returns the name of the external-provisioner sidecar in the pod of CSI Controller, which watches
+// the same PVCs as the built-in provisioner, empty if there is none
+func (j *provisionerService) externalProvisioner(ctx context.Context) (string, error) {
+	if config.PodName == "" {
+		return "", nil
+	}
+	pod, err := j.GetPod(ctx, config.PodName, config.Namespace)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == "csi-provisioner" || strings.Contains(c.Image, "csi-provisioner") {
+			return c.Name, nil
+		}
+	}
+	return "", nil
+}
+
+func (j *provisionerService) Provision(ctx context.Context, options provisioncontroller.ProvisionOptions) (_ *corev1.PersistentVolume, _ provisioncontroller.ProvisioningState, err error) {
+	done := j.opMetrics.start(opProvision)
+	defer func() { done(err) }()
 	provisionerLog.V(1).Info("provision options", "options", options)
 	if options.PVC.Spec.Selector != nil {
 		return nil, provisioncontroller.ProvisioningFinished, fmt.Errorf("claim Selector is not supported")
 	}
+	if isPaused(options.StorageClass.Annotations) {
+		return nil, provisioncontroller.ProvisioningNoChange, fmt.Errorf("provisioning is paused by StorageClass/%s, remove annotation %s to resume",
+			options.StorageClass.Name, common.PausedAnnotationKey)
+	}
 
 	pvMeta := resource.NewObjectMeta(*options.PVC, options.SelectedNode)
 
 	pvName := options.PVName
-	scParams := make(map[string]string)
+	csiParams, err := config.ParseCSIParameters(options.StorageClass.Parameters, func(s string) string {
+		return pvMeta.ResolveSecret(s, pvName)
+	})
+	if err != nil {
+		j.metrics.provisionErrors.Inc()
+		return nil, provisioncontroller.ProvisioningFinished, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	// csi.storage.k8s.io/* parameters are replaced by the resolved secrets of each operation
+	scParams := csiParams.Params()
 	for k, v := range options.StorageClass.Parameters {
-		if strings.HasPrefix(k, "csi.storage.k8s.io/") {
-			scParams[k] = pvMeta.ResolveSecret(v, pvName)
-		} else {
-			scParams[k] = pvMeta.StringParser(options.StorageClass.Parameters[k])
+		if !strings.HasPrefix(k, "csi.storage.k8s.io/") {
+			scParams[k] = pvMeta.StringParser(v)
 		}
 	}
 	provisionerLog.V(1).Info("Resolved StorageClass.Parameters", "params", scParams)
+	if _, err := config.ParseVolumeContext(scParams, true); err != nil {
+		j.metrics.provisionErrors.Inc()
+		return nil, provisioncontroller.ProvisioningFinished, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	if err := j.checkMetaEngine(ctx, scParams); err != nil {
+		j.metrics.provisionErrors.Inc()
+		return nil, provisioncontroller.ProvisioningNoChange, err
+	}
+	j.checkFormatDrift(ctx, scParams, options.PVC)
 
 	subPath := pvName
 	if scParams["pathPattern"] != "" {
 		subPath = scParams["pathPattern"]
+	} else if options.PVC.Spec.DataSource == nil {
+		// volumes with data source are filled by the CSI calls, they can't use the pre-created directories
+		pooled, err := j.pool.claim(ctx, options.StorageClass)
+		if err != nil {
+			provisionerLog.Error(err, "claim directory from volume pool error, provision as usual", "storageClass", options.StorageClass.Name)
+		} else if pooled != "" {
+			provisionerLog.Info("assign directory from volume pool", "pvc", options.PVC.Namespace+"/"+options.PVC.Name, "subPath", pooled)
+			subPath = pooled
+			defer func() {
+				// the directory is not used by any PV, return it to the pool
+				if err != nil {
+					j.pool.release(ctx, options.StorageClass, pooled)
+				}
+			}()
+		}
 	}
 	// return error if set readonly in dynamic provisioner
 	for _, am := range options.PVC.Spec.AccessModes {
@@ -151,6 +223,21 @@ func (j *provisionerService) Provision(ctx context.Context, options provisioncon
 	for k, v := range scParams {
 		volCtx[k] = v
 	}
+	if dirTree, err := resolveDirTree(ctx, j.K8sClient, scParams, options.PVC); err != nil {
+		j.metrics.provisionErrors.Inc()
+		if status.Code(err) == codes.InvalidArgument {
+			return nil, provisioncontroller.ProvisioningFinished, err
+		}
+		return nil, provisioncontroller.ProvisioningNoChange, err
+	} else if dirTree != "" {
+		volCtx[common.DirTreeSpecKey] = dirTree
+	}
+	if config.BucketPerVolume(scParams) {
+		if state, err := j.formatVol(ctx, pvName, scParams, volCtx); err != nil {
+			j.metrics.provisionErrors.Inc()
+			return nil, state, err
+		}
+	}
 	pv := &corev1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: options.PVName,
@@ -164,12 +251,7 @@ func (j *provisionerService) Provision(ctx context.Context, options provisioncon
 					Driver:           config.DriverName,
 					VolumeHandle:     pvName,
 					ReadOnly:         false,
-					FSType:           "juicefs",
 					VolumeAttributes: volCtx,
-					NodePublishSecretRef: &corev1.SecretReference{
-						Name:      scParams[common.PublishSecretName],
-						Namespace: scParams[common.PublishSecretNamespace],
-					},
 				},
 			},
 			AccessModes:                   options.PVC.Spec.AccessModes,
@@ -179,11 +261,16 @@ func (j *provisionerService) Provision(ctx context.Context, options provisioncon
 			VolumeMode:                    options.PVC.Spec.VolumeMode,
 		},
 	}
-	if scParams[common.ControllerExpandSecretName] != "" && scParams[common.ControllerExpandSecretNamespace] != "" {
-		pv.Spec.CSI.ControllerExpandSecretRef = &corev1.SecretReference{
-			Name:      scParams[common.ControllerExpandSecretName],
-			Namespace: scParams[common.ControllerExpandSecretNamespace],
-		}
+	if pv.Spec.PersistentVolumeReclaimPolicy == corev1.PersistentVolumeReclaimRetain {
+		// keep the claim to re-bind the PV if the PVC is deleted by accident
+		pv.Annotations = map[string]string{common.ClaimAnnotationKey: rebind.EncodeClaim(options.PVC)}
+	}
+	csiParams.ApplyTo(pv.Spec.CSI)
+	// secrets referenced from external secret store are fetched by the node, there may be no secret in kubernetes
+	if pv.Spec.CSI.NodePublishSecretRef == nil && !secretprovider.Enabled(scParams) {
+		j.metrics.provisionErrors.Inc()
+		return nil, provisioncontroller.ProvisioningFinished, status.Errorf(codes.InvalidArgument,
+			"node-publish secret is required, set %s and %s in StorageClass/%s", common.PublishSecretName, common.PublishSecretNamespace, options.StorageClass.Name)
 	}
 
 	if pv.Spec.PersistentVolumeReclaimPolicy == corev1.PersistentVolumeReclaimDelete && options.StorageClass.Parameters["secretFinalizer"] == "true" {
@@ -203,7 +290,104 @@ func (j *provisionerService) Provision(ctx context.Context, options provisioncon
 	return pv, provisioncontroller.ProvisioningFinished, nil
 }
 
-func (j *provisionerService) Delete(ctx context.Context, volume *corev1.PersistentVolume) error {
+// checkMetaEngine rejects provisioning fast if the metadata engine in provisioner secret is down
+func (j *provisionerService) checkMetaEngine(ctx context.Context, scParams map[string]string) error {
+	if j.metaProber == nil {
+		return nil
+	}
+	secrets, err := j.getProvisionerSecrets(ctx, scParams)
+	if err != nil || secrets == nil {
+		// let the following steps report the error
+		provisionerLog.V(1).Info("Get provisioner secret error, skip checking metadata engine", "error", err)
+		return nil
+	}
+	return j.metaProber.Allow(secrets)
+}
+
+// checkFormatDrift detects the format settings in provisioner secret which differ from the ones in the metadata
+// engine, and reconciles them or reports them as events of the PVC, according to the policy in StorageClass.
+// It never fails the provisioning.
+func (j *provisionerService) checkFormatDrift(ctx context.Context, scParams map[string]string, pvc *corev1.PersistentVolumeClaim) {
+	policy := scParams[common.FormatDriftKey]
+	if policy == "" {
+		return
+	}
+	secrets, err := j.getProvisionerSecrets(ctx, scParams)
+	if err != nil || secrets == nil {
+		provisionerLog.V(1).Info("Get provisioner secret error, skip checking format drift", "error", err)
+		return
+	}
+	reconcile := policy == config.FormatDriftReconcile
+	drifts, err := j.juicefs.JfsFormatDrift(ctx, secrets, reconcile)
+	if err != nil && len(drifts) == 0 {
+		provisionerLog.Error(err, "check format drift error", "name", secrets["name"])
+		return
+	}
+	var reconciled, unreconciled []string
+	for _, d := range drifts {
+		if reconcile && d.Reconcilable && err == nil {
+			reconciled = append(reconciled, d.String())
+		} else {
+			unreconciled = append(unreconciled, d.String())
+		}
+	}
+	if len(reconciled) > 0 {
+		msg := fmt.Sprintf("format settings of file system %s reconciled: %s", secrets["name"], strings.Join(reconciled, ", "))
+		provisionerLog.Info(msg)
+		if e := events.NewRecorder(j.K8sClient).Event(ctx, pvc, corev1.EventTypeNormal, events.ReasonFormatReconciled, events.ActionProvision, msg); e != nil {
+			provisionerLog.Error(e, "create event error")
+		}
+	}
+	if len(unreconciled) > 0 {
+		msg := fmt.Sprintf("format settings of file system %s differ from the secret %s/%s, the ones in metadata engine are used: %s",
+			secrets["name"], scParams[common.ProvisionerSecretNamespace], scParams[common.ProvisionerSecretName], strings.Join(unreconciled, ", "))
+		if err != nil {
+			msg = fmt.Sprintf("%s; reconcile error: %v", msg, err)
+		}
+		provisionerLog.Info(msg)
+		if e := events.NewRecorder(j.K8sClient).Event(ctx, pvc, corev1.EventTypeWarning, events.ReasonFormatDrift, events.ActionProvision, msg); e != nil {
+			provisionerLog.Error(e, "create event error")
+		}
+	}
+}
+
+// getProvisionerSecrets returns the data of provisioner secret in StorageClass merged with the secrets from the
+// external secret provider, or nil if neither is set
+func (j *provisionerService) getProvisionerSecrets(ctx context.Context, scParams map[string]string) (map[string]string, error) {
+	var secrets map[string]string
+	if scParams[common.ProvisionerSecretName] != "" && scParams[common.ProvisionerSecretNamespace] != "" {
+		secret, err := j.K8sClient.GetSecret(ctx, scParams[common.ProvisionerSecretName], scParams[common.ProvisionerSecretNamespace])
+		if err != nil {
+			return nil, err
+		}
+		secrets = make(map[string]string, len(secret.Data))
+		for k, v := range secret.Data {
+			secrets[k] = string(v)
+		}
+	}
+	return fetchExternalSecrets(ctx, secrets, scParams)
+}
+
+// formatVol creates the dedicated file system of the volume, volumes of enterprise edition or unsupported
+// metadata engines are rejected
+func (j *provisionerService) formatVol(ctx context.Context, pvName string, scParams, volCtx map[string]string) (provisioncontroller.ProvisioningState, error) {
+	secrets, err := j.getProvisionerSecrets(ctx, scParams)
+	if err != nil {
+		return provisioncontroller.ProvisioningNoChange, status.Errorf(codes.Unavailable, "Could not get secrets of volume %s: %v", pvName, err)
+	}
+	if _, err := config.VolumeSecrets(secrets, pvName); err != nil {
+		return provisioncontroller.ProvisioningFinished, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	provisionerLog.Info("format dedicated file system of volume", "volume", pvName)
+	if err := j.juicefs.JfsFormatVol(ctx, pvName, secrets, volCtx); err != nil {
+		return provisioncontroller.ProvisioningNoChange, status.Errorf(codes.Internal, "Could not format file system of volume %s: %v", pvName, err)
+	}
+	return provisioncontroller.ProvisioningFinished, nil
+}
+
+func (j *provisionerService) Delete(ctx context.Context, volume *corev1.PersistentVolume) (err error) {
+	done := j.opMetrics.start(opDelete)
+	defer func() { done(err) }()
 	provisionerLog.V(1).Info("Delete volume", "volume", *volume)
 	// If it exists and has a `delete` value, delete the directory.
 	// If it exists and has a `retain` value, safe the directory.
@@ -224,15 +408,25 @@ func (j *provisionerService) Delete(ctx context.Context, volume *corev1.Persiste
 	}
 	provisionerLog.V(1).Info("there are no other pvs using the same subPath, volume can be deleted.", "volume", volume.Name)
 	subPath := volume.Spec.PersistentVolumeSource.CSI.VolumeAttributes["subPath"]
-	secretName, secretNamespace := volume.Spec.CSI.NodePublishSecretRef.Name, volume.Spec.CSI.NodePublishSecretRef.Namespace
-	secret, err := j.K8sClient.GetSecret(ctx, secretName, secretNamespace)
-	if err != nil {
-		provisionerLog.Error(err, "Get Secret error")
-		return err
-	}
+	var (
+		secretName, secretNamespace string
+		secret                      *corev1.Secret
+	)
 	secretData := make(map[string]string)
-	for k, v := range secret.Data {
-		secretData[k] = string(v)
+	if ref := volume.Spec.CSI.NodePublishSecretRef; ref != nil {
+		secretName, secretNamespace = ref.Name, ref.Namespace
+		secret, err = j.K8sClient.GetSecret(ctx, secretName, secretNamespace)
+		if err != nil {
+			provisionerLog.Error(err, "Get Secret error")
+			return err
+		}
+		for k, v := range secret.Data {
+			secretData[k] = string(v)
+		}
+	}
+	if secretData, err = fetchExternalSecrets(ctx, secretData, volume.Spec.CSI.VolumeAttributes); err != nil {
+		provisionerLog.Error(err, "Fetch secrets from external secret store error")
+		return err
 	}
 
 	provisionerLog.Info("Deleting volume subpath", "subPath", subPath)
@@ -241,7 +435,7 @@ func (j *provisionerService) Delete(ctx context.Context, volume *corev1.Persiste
 		return errors.New("unable to provision delete volume: " + err.Error())
 	}
 
-	if volume.Spec.CSI.VolumeAttributes["secretFinalizer"] == "true" {
+	if volume.Spec.CSI.VolumeAttributes["secretFinalizer"] == "true" && secret != nil {
 		shouldRemoveFinalizer, err := resource.CheckForSecretFinalizer(ctx, j.K8sClient, volume)
 		if err != nil {
 			provisionerLog.Error(err, "CheckForSecretFinalizer error")
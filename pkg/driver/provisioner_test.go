@@ -0,0 +1,106 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	provisioncontroller "sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestExternalProvisioner(t *testing.T) {
+	defer func(name, ns string) { config.PodName, config.Namespace = name, ns }(config.PodName, config.Namespace)
+	config.PodName, config.Namespace = "juicefs-csi-controller-0", "kube-system"
+	newPod := func(containers ...corev1.Container) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: config.PodName, Namespace: config.Namespace},
+			Spec:       corev1.PodSpec{Containers: containers},
+		}
+	}
+	plugin := corev1.Container{Name: "juicefs-plugin", Image: "juicedata/juicefs-csi-driver:v0.26.0"}
+
+	j := provisionerService{K8sClient: &k8s.K8sClient{Interface: fake.NewSimpleClientset(newPod(plugin,
+		corev1.Container{Name: "provisioner", Image: "registry.k8s.io/sig-storage/csi-provisioner:v2.2.2"}))}}
+	name, err := j.externalProvisioner(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "provisioner", name)
+
+	j = provisionerService{K8sClient: &k8s.K8sClient{Interface: fake.NewSimpleClientset(newPod(plugin,
+		corev1.Container{Name: "liveness-probe", Image: "registry.k8s.io/sig-storage/livenessprobe:v2.11.0"}))}}
+	name, err = j.externalProvisioner(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+
+	// pod name unknown, e.g. running out of cluster
+	config.PodName = ""
+	name, err = j.externalProvisioner(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+}
+
+func TestFormatVol(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+
+	secret := func(name string, data map[string]string) *corev1.Secret {
+		s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system"}, Data: map[string][]byte{}}
+		for k, v := range data {
+			s.Data[k] = []byte(v)
+		}
+		return s
+	}
+	j := provisionerService{juicefs: mockJuicefs, K8sClient: &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		secret("ce", map[string]string{"name": "jfs", "metaurl": "tikv://pd:2379/jfs"}),
+		secret("ee", map[string]string{"name": "jfs", "token": "xxx"}),
+	)}}
+	params := func(name string) map[string]string {
+		return map[string]string{
+			common.BucketPerVolumeKey:         "true",
+			common.ProvisionerSecretName:      name,
+			common.ProvisionerSecretNamespace: "kube-system",
+		}
+	}
+
+	mockJuicefs.EXPECT().JfsFormatVol(gomock.Any(), "pvc-1", map[string]string{"name": "jfs", "metaurl": "tikv://pd:2379/jfs"}, params("ce")).Return(nil)
+	state, err := j.formatVol(context.TODO(), "pvc-1", params("ce"), params("ce"))
+	assert.NoError(t, err)
+	assert.Equal(t, provisioncontroller.ProvisioningFinished, state)
+
+	// enterprise edition is rejected without retrying
+	state, err = j.formatVol(context.TODO(), "pvc-1", params("ee"), params("ee"))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, provisioncontroller.ProvisioningFinished, state)
+
+	// retried if the secret is missing
+	state, err = j.formatVol(context.TODO(), "pvc-1", params("missing"), params("missing"))
+	assert.Error(t, err)
+	assert.Equal(t, provisioncontroller.ProvisioningNoChange, state)
+}
@@ -0,0 +1,96 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	k8sexec "k8s.io/utils/exec"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+const detectQuotaTimeout = 10 * time.Second
+
+// quotaSupport tells if the juicefs clients in CSI Controller support directory quota, which volume expansion relies on.
+// It is detected at startup, nil means not detected and quota is assumed to be supported.
+type quotaSupport struct {
+	ce, ee               bool
+	ceVersion, eeVersion string
+}
+
+// detectQuotaSupport runs `juicefs version` of both editions in CSI Controller
+func detectQuotaSupport(exec k8sexec.Interface) *quotaSupport {
+	q := &quotaSupport{}
+	q.ce, q.ceVersion = detectClientQuota(exec, true, config.CeCliPath)
+	q.ee, q.eeVersion = detectClientQuota(exec, false, config.CliPath)
+	driverLog.Info("detected directory quota support of clients",
+		"ce", q.ce, "ceVersion", q.ceVersion, "ee", q.ee, "eeVersion", q.eeVersion)
+	return q
+}
+
+func detectClientQuota(exec k8sexec.Interface, ce bool, cli string) (bool, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), detectQuotaTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, cli, "version").CombinedOutput()
+	if err != nil {
+		driverLog.V(1).Info("can not get client version", "cli", cli, "error", err, "output", string(out))
+		return false, ""
+	}
+	version := strings.TrimSpace(string(out))
+	return util.SupportQuota(ce, version), version
+}
+
+// expandable tells if any edition supports quota, so that volume expansion is worth advertising
+func (q *quotaSupport) expandable() bool {
+	return q == nil || q.ce || q.ee
+}
+
+// check returns an error if the client setting quota of the volume does not support it.
+// Quota is set in jobs with the mount image if config.AdminByJob is set, otherwise in CSI Controller.
+func (q *quotaSupport) check(setting *config.JfsSetting) error {
+	edition, minVersion := "enterprise edition", "4.9.0"
+	if setting.IsCe {
+		edition, minVersion = "community edition", "1.1.0"
+	}
+	if config.AdminByJob {
+		if setting.Attr != nil && !util.ImageSupportQuota(setting.Attr.Image) {
+			return fmt.Errorf("directory quota is not supported by juicefs %s in image %s, %s or later is required",
+				edition, setting.Attr.Image, minVersion)
+		}
+		return nil
+	}
+	if q == nil {
+		return nil
+	}
+	supported, version := q.ee, q.eeVersion
+	if setting.IsCe {
+		supported, version = q.ce, q.ceVersion
+	}
+	if supported {
+		return nil
+	}
+	if version == "" {
+		return fmt.Errorf("directory quota is not supported: juicefs %s is not found in CSI Controller", edition)
+	}
+	return fmt.Errorf("directory quota is not supported by %q in CSI Controller, juicefs %s %s or later is required",
+		version, edition, minVersion)
+}
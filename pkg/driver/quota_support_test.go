@@ -0,0 +1,73 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	k8sexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+)
+
+func fakeVersionExec(ceOut, eeOut string, eeErr error) *testingexec.FakeExec {
+	cmd := func(out string, err error) testingexec.FakeCommandAction {
+		return func(cmd string, args ...string) k8sexec.Cmd {
+			return &testingexec.FakeCmd{CombinedOutputScript: []testingexec.FakeAction{
+				func() ([]byte, []byte, error) { return []byte(out), nil, err },
+			}}
+		}
+	}
+	return &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{cmd(ceOut, nil), cmd(eeOut, eeErr)}}
+}
+
+func TestQuotaSupport(t *testing.T) {
+	q := detectQuotaSupport(fakeVersionExec("juicefs version 1.0.4+2023-04-06.f1c475d9", "", errors.New("not found")))
+	assert.False(t, q.ce)
+	assert.False(t, q.ee)
+	assert.False(t, q.expandable())
+	assert.ErrorContains(t, q.check(&config.JfsSetting{IsCe: true}), "1.1.0 or later is required")
+	assert.ErrorContains(t, q.check(&config.JfsSetting{IsCe: false}), "is not found in CSI Controller")
+
+	cs := &controllerService{quota: q}
+	resp, err := cs.ControllerGetCapabilities(context.TODO(), &csi.ControllerGetCapabilitiesRequest{})
+	assert.NoError(t, err)
+	for _, c := range resp.Capabilities {
+		assert.NotEqual(t, csi.ControllerServiceCapability_RPC_EXPAND_VOLUME, c.GetRpc().GetType())
+	}
+
+	q = detectQuotaSupport(fakeVersionExec("juicefs version 1.2.0+2024-06-18.873c47b9", "JuiceFS version 4.8.3 (2022-11-18 4f7ba2c)", nil))
+	assert.True(t, q.expandable())
+	assert.NoError(t, q.check(&config.JfsSetting{IsCe: true}))
+	assert.ErrorContains(t, q.check(&config.JfsSetting{IsCe: false}), "enterprise edition 4.9.0 or later is required")
+
+	// not detected
+	q = nil
+	assert.True(t, q.expandable())
+	assert.NoError(t, q.check(&config.JfsSetting{IsCe: true}))
+
+	// quota is set in jobs with the mount image
+	config.AdminByJob = true
+	defer func() { config.AdminByJob = false }()
+	assert.ErrorContains(t, q.check(&config.JfsSetting{IsCe: true, Attr: &config.PodAttr{Image: "juicedata/mount:ce-v1.0.4"}}), "in image juicedata/mount:ce-v1.0.4")
+	assert.NoError(t, q.check(&config.JfsSetting{IsCe: true, Attr: &config.PodAttr{Image: "juicedata/mount:ce-v1.2.1"}}))
+}
@@ -0,0 +1,206 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/mount"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount/builder"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+var (
+	exportReadyTimeout = 2 * time.Minute
+	exportPollInterval = 2 * time.Second
+	// hard mounts keep retrying while export pods fail over, instead of returning errors to applications
+	nfsMountOptions = []string{"nfsvers=4.1", "hard"}
+)
+
+// remoteMounter mounts volumes of StorageClasses with juicefs/remote-mount over NFS, for nodes where FUSE
+// is not allowed. Each volume is mounted by a deployment of export pods on storage nodes, which serve the
+// mount point over NFS behind a service. The export is shared by all nodes, and deleted with the PV.
+type remoteMounter struct {
+	juicefs   juicefs.Interface
+	k8sClient *k8sclient.K8sClient
+	mounter   mount.Interface
+}
+
+// exportName returns the name of the export deployment and service of the volume, volume handles
+// of static PVs may not be valid service names
+func exportName(volumeID string) string {
+	name := "juicefs-export-" + volumeID
+	if len(validation.IsDNS1035Label(name)) == 0 {
+		return name
+	}
+	return fmt.Sprintf("juicefs-export-%x", sha256.Sum256([]byte(volumeID)))[:48]
+}
+
+// publish makes sure the export of the volume is running, and mounts it at target over NFS
+func (m *remoteMounter) publish(ctx context.Context, volumeID, target string, secrets, volCtx map[string]string, vc *config.VolumeContext, readonly bool) error {
+	log := util.GenLog(ctx, driverLog, "remoteMount")
+	if m == nil || m.k8sClient == nil || config.ByProcess {
+		return fmt.Errorf("remote mount is only supported in mount pod mode")
+	}
+	if config.NFSExportImage == "" {
+		return fmt.Errorf("remote mount requires --nfs-export-image of CSI Node")
+	}
+	if notMnt, err := m.mounter.IsLikelyNotMountPoint(target); err == nil && !notMnt {
+		log.Info("target is already mounted", "target", target)
+		return nil
+	}
+
+	setting, err := m.juicefs.Settings(ctx, volumeID, volumeID, "", secrets, volCtx, vc.MountOptions)
+	if err != nil {
+		return err
+	}
+	if setting.PV == nil {
+		return fmt.Errorf("remote mount requires the PV of volume %s", volumeID)
+	}
+	if setting.ExternalSecrets {
+		return fmt.Errorf("remote mount doesn't support secrets from an external secret provider, volume %s", volumeID)
+	}
+	name := exportName(volumeID)
+	setting.SecretName = fmt.Sprintf("juicefs-%s-secret", setting.UniqueId)
+	r := builder.NewExportBuilder(setting)
+	secret := r.NewSecret()
+	builder.SetPVAsOwner(&secret, setting.PV)
+	if err := resource.CreateOrUpdateSecret(ctx, m.k8sClient, &secret); err != nil {
+		return err
+	}
+	owner := []metav1.OwnerReference{{APIVersion: "v1", Kind: "PersistentVolume", Name: setting.PV.Name, UID: setting.PV.UID}}
+	deploy, err := r.NewExportDeployment(name, vc.ExportReplicas, vc.StorageNodeSelector)
+	if err != nil {
+		return err
+	}
+	deploy.OwnerReferences = owner
+	if err := m.applyExport(ctx, deploy); err != nil {
+		return err
+	}
+	svc := r.NewExportService(name)
+	svc.OwnerReferences = owner
+	if _, err := m.k8sClient.CreateService(ctx, svc); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create service of export %s: %v", name, err)
+	}
+	if svc, err = m.k8sClient.GetService(ctx, name, config.Namespace); err != nil {
+		return fmt.Errorf("get service of export %s: %v", name, err)
+	}
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == corev1.ClusterIPNone {
+		return fmt.Errorf("service of export %s has no cluster IP", name)
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, exportPollInterval, exportReadyTimeout, true, func(ctx context.Context) (bool, error) {
+		deploy, err := m.k8sClient.GetDeployment(ctx, name, config.Namespace)
+		if err != nil {
+			log.V(1).Info("get export error, retry", "name", name, "error", err)
+			return false, nil
+		}
+		return deploy.Status.ReadyReplicas > 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("no export pod of %s is ready on storage nodes %v: %v", name, vc.StorageNodeSelector, err)
+	}
+
+	options := append([]string{}, nfsMountOptions...)
+	if readonly {
+		options = append(options, "ro")
+	}
+	host := svc.Spec.ClusterIP
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	source := host + ":/"
+	log.Info("mounting volume over NFS", "source", source, "target", target, "options", options)
+	return m.mounter.Mount(source, target, "nfs4", options)
+}
+
+// applyExport creates the deployment of export pods, or updates it if the spec is changed,
+// e.g. by changes of the StorageClass, replicas, or the upgrade of CSI Driver
+func (m *remoteMounter) applyExport(ctx context.Context, deploy *appsv1.Deployment) error {
+	log := util.GenLog(ctx, driverLog, "remoteMount")
+	data, err := json.Marshal(deploy.Spec)
+	if err != nil {
+		return err
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+	if deploy.Annotations == nil {
+		deploy.Annotations = map[string]string{}
+	}
+	deploy.Annotations[common.ExportHashKey] = hash
+	_, err = m.k8sClient.CreateDeployment(ctx, deploy)
+	if err == nil {
+		log.Info("export of volume created", "name", deploy.Name, "replicas", *deploy.Spec.Replicas, "nodeSelector", deploy.Spec.Template.Spec.NodeSelector)
+		return nil
+	}
+	if !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create export %s: %v", deploy.Name, err)
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		old, err := m.k8sClient.GetDeployment(ctx, deploy.Name, deploy.Namespace)
+		if err != nil {
+			return err
+		}
+		if old.Annotations[common.ExportHashKey] == hash {
+			return nil
+		}
+		log.Info("spec of export is changed, update it", "name", deploy.Name)
+		if old.Annotations == nil {
+			old.Annotations = map[string]string{}
+		}
+		old.Annotations[common.ExportHashKey] = hash
+		old.Spec = deploy.Spec
+		_, err = m.k8sClient.UpdateDeployment(ctx, old)
+		return err
+	})
+}
+
+// unpublish unmounts target if it's mounted over NFS, and returns false if it's not
+func (m *remoteMounter) unpublish(ctx context.Context, target string) (bool, error) {
+	if m == nil {
+		return false, nil
+	}
+	mps, err := m.mounter.List()
+	if err != nil {
+		return false, err
+	}
+	for _, mp := range mps {
+		if mp.Path != target || !strings.HasPrefix(mp.Type, "nfs") {
+			continue
+		}
+		util.GenLog(ctx, driverLog, "remoteMount").Info("unmounting volume mounted over NFS", "target", target, "source", mp.Device)
+		return true, mount.CleanupMountPoint(target, m.mounter, false)
+	}
+	return false, nil
+}
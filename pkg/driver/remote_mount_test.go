@@ -0,0 +1,126 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/mount"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestExportName(t *testing.T) {
+	assert.Equal(t, "juicefs-export-pvc-1", exportName("pvc-1"))
+	name := exportName("Volume.Handle")
+	assert.Len(t, name, 48)
+	assert.NotEqual(t, name, exportName("volume.handle"))
+}
+
+func TestRemoteMount(t *testing.T) {
+	ctx := context.TODO()
+	config.Namespace = "kube-system"
+	config.ByProcess = false
+	config.NFSExportImage = "nfs-server:test"
+	exportPollInterval, exportReadyTimeout = 10*time.Millisecond, 100*time.Millisecond
+	assert.NoError(t, config.FeatureGates.Set("RemoteMount=true"))
+	defer func() {
+		_ = config.FeatureGates.Set("RemoteMount=false")
+		config.NFSExportImage = ""
+		exportPollInterval, exportReadyTimeout = 2*time.Second, 2*time.Minute
+	}()
+
+	pv := &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pvc-1", UID: "uid-1"}}
+	setting := &config.JfsSetting{
+		IsCe:      true,
+		Name:      "test",
+		Source:    "redis://127.0.0.1:6379/0",
+		MetaUrl:   "redis://127.0.0.1:6379/0",
+		MountPath: "/jfs/pvc-1",
+		VolumeId:  "pvc-1",
+		UniqueId:  "pvc-1",
+		SubPath:   "pvc-1",
+		PV:        pv,
+		Attr:      &config.PodAttr{Namespace: config.Namespace, Image: config.DefaultCEMountImage},
+	}
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+	mockJuicefs.EXPECT().Settings(gomock.Any(), "pvc-1", "pvc-1", "", gomock.Any(), gomock.Any(), gomock.Any()).Return(setting, nil).AnyTimes()
+
+	clientset := fake.NewSimpleClientset(pv, &corev1.Service{
+		// cluster IP is not allocated by the fake clientset
+		ObjectMeta: metav1.ObjectMeta{Name: "juicefs-export-pvc-1", Namespace: config.Namespace},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10"},
+	})
+	mounter := mount.NewFakeMounter(nil)
+	m := &remoteMounter{juicefs: mockJuicefs, k8sClient: &k8s.K8sClient{Interface: clientset}, mounter: mounter}
+	vc, _ := config.ParseVolumeContext(map[string]string{common.RemoteMountKey: "nfs"}, false)
+	target := filepath.Join(t.TempDir(), "target")
+	assert.NoError(t, os.MkdirAll(target, 0750))
+
+	// no export pod is ready
+	err := m.publish(ctx, "pvc-1", target, nil, nil, vc, true)
+	assert.ErrorContains(t, err, "no export pod")
+	deploy, err := clientset.AppsV1().Deployments(config.Namespace).Get(ctx, "juicefs-export-pvc-1", metav1.GetOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int32(config.DefaultExportReplicas), *deploy.Spec.Replicas)
+	assert.Equal(t, map[string]string{common.StorageNodeLabelKey: "true"}, deploy.Spec.Template.Spec.NodeSelector)
+	assert.Equal(t, pv.UID, deploy.OwnerReferences[0].UID)
+	_, err = clientset.CoreV1().Secrets(config.Namespace).Get(ctx, "juicefs-pvc-1-secret", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	deploy.Status = appsv1.DeploymentStatus{ReadyReplicas: 1}
+	_, err = clientset.AppsV1().Deployments(config.Namespace).UpdateStatus(ctx, deploy, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, m.publish(ctx, "pvc-1", target, nil, nil, vc, true))
+	assert.Equal(t, []mount.MountPoint{{Device: "10.96.0.10:/", Path: target, Type: "nfs4", Opts: []string{"nfsvers=4.1", "hard", "ro"}}}, mounter.MountPoints)
+
+	// changes of the StorageClass are applied to the existing export
+	vc, _ = config.ParseVolumeContext(map[string]string{common.RemoteMountKey: "nfs", common.ExportReplicasKey: "3"}, false)
+	other := filepath.Join(t.TempDir(), "other")
+	assert.NoError(t, os.MkdirAll(other, 0750))
+	assert.NoError(t, m.publish(ctx, "pvc-1", other, nil, nil, vc, true))
+	deploy, err = clientset.AppsV1().Deployments(config.Namespace).Get(ctx, "juicefs-export-pvc-1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), *deploy.Spec.Replicas)
+	assert.NoError(t, mount.CleanupMountPoint(other, mounter, false))
+
+	// other targets are left to the usual unmount
+	remote, err := m.unpublish(ctx, filepath.Join(t.TempDir(), "other"))
+	assert.NoError(t, err)
+	assert.False(t, remote)
+	remote, err = m.unpublish(ctx, target)
+	assert.NoError(t, err)
+	assert.True(t, remote)
+	assert.Empty(t, mounter.MountPoints)
+}
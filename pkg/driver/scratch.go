@@ -0,0 +1,201 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+var (
+	scratchLog             = klog.NewKlogr().WithName("scratch")
+	scratchCollectInterval = time.Minute
+)
+
+// scratchRecord is what's needed to delete a scratch volume without its pod, since inline ephemeral volumes
+// have no PV. Credentials are not recorded, only the name of the nodePublishSecretRef in the namespace of the pod.
+type scratchRecord struct {
+	VolumeID     string            `json:"volumeId"`
+	SubPath      string            `json:"subPath"`
+	TTL          string            `json:"ttl"`
+	PublishedAt  time.Time         `json:"publishedAt"`
+	PodNamespace string            `json:"podNamespace"`
+	PodName      string            `json:"podName"`
+	PodUID       string            `json:"podUID"`
+	SecretName   string            `json:"secretName"`
+	VolumeCtx    map[string]string `json:"volumeContext"`
+	MountOptions []string          `json:"mountOptions,omitempty"`
+}
+
+// scratchPath returns the sub path of the scratch volume, under subPath of the volume attributes
+func scratchPath(subPath, volumeID string) string {
+	return path.Join(subPath, common.ScratchDir, volumeID)
+}
+
+func scratchRecordName(volumeID string) string {
+	return fmt.Sprintf("juicefs-scratch-%s", volumeID)
+}
+
+// recordScratch records the scratch volume, so that its data is deleted by CSI Controller after the TTL
+// even if the node is gone. target is the target path of the volume, named after the volume in the pod.
+func (d *nodeService) recordScratch(ctx context.Context, record scratchRecord, target string) error {
+	if d.k8sClient == nil {
+		scratchLog.Info("scratch volume is not recorded without kubernetes, delete its data manually", "volumeId", record.VolumeID, "subPath", record.SubPath)
+		return nil
+	}
+	pod, err := d.k8sClient.GetPod(ctx, record.PodName, record.PodNamespace)
+	if err != nil {
+		return err
+	}
+	// target path is /var/lib/kubelet/pods/<pod uid>/volumes/kubernetes.io~csi/<volume name>/mount
+	volumeName := path.Base(path.Dir(target))
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == volumeName && volume.CSI != nil && volume.CSI.NodePublishSecretRef != nil {
+			record.SecretName = volume.CSI.NodePublishSecretRef.Name
+		}
+	}
+	if record.SecretName == "" {
+		return fmt.Errorf("nodePublishSecretRef of volume %s is not found in pod %s/%s", volumeName, record.PodNamespace, record.PodName)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        scratchRecordName(record.VolumeID),
+			Namespace:   config.Namespace,
+			Labels:      map[string]string{common.ScratchLabelKey: "true"},
+			Annotations: map[string]string{common.ScratchLabelKey: string(data)},
+		},
+	}
+	return resource.CreateOrUpdateSecret(ctx, d.k8sClient, secret)
+}
+
+// scratchCollector deletes the data of scratch volumes whose TTL is expired and no pod uses them,
+// including the ones orphaned by crashed nodes which never unpublished them.
+type scratchCollector struct {
+	juicefs   juicefs.Interface
+	k8sClient *k8s.K8sClient
+	now       func() time.Time
+}
+
+func newScratchCollector(jfs juicefs.Interface, k8sClient *k8s.K8sClient) *scratchCollector {
+	return &scratchCollector{juicefs: jfs, k8sClient: k8sClient, now: time.Now}
+}
+
+func (c *scratchCollector) run(ctx context.Context) {
+	ticker := time.NewTicker(scratchCollectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.collect(ctx)
+	}
+}
+
+func (c *scratchCollector) collect(ctx context.Context) {
+	secrets, err := c.k8sClient.CoreV1().Secrets(config.Namespace).List(ctx, metav1.ListOptions{LabelSelector: common.ScratchLabelKey + "=true"})
+	if err != nil {
+		scratchLog.Error(err, "list scratch records error")
+		return
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		record := scratchRecord{}
+		if err := json.Unmarshal([]byte(secret.Annotations[common.ScratchLabelKey]), &record); err != nil {
+			scratchLog.Error(err, "invalid scratch record, ignore it", "name", secret.Name)
+			continue
+		}
+		log := scratchLog.WithValues("volumeId", record.VolumeID, "pod", record.PodNamespace+"/"+record.PodName)
+		ttl, err := time.ParseDuration(record.TTL)
+		if err != nil {
+			log.Error(err, "invalid ttl of scratch record, ignore it", "ttl", record.TTL)
+			continue
+		}
+		if c.now().Before(record.PublishedAt.Add(ttl)) {
+			continue
+		}
+		if inUse, err := c.inUse(ctx, record); err != nil || inUse {
+			continue
+		}
+		log.Info("ttl of scratch volume is expired, delete its data", "subPath", record.SubPath, "ttl", record.TTL)
+		volSecret, err := c.k8sClient.GetSecret(ctx, record.SecretName, record.PodNamespace)
+		if err != nil {
+			log.Error(err, "get secret of scratch volume error, delete its data manually if the secret is gone", "secret", record.SecretName, "subPath", record.SubPath)
+			continue
+		}
+		volSecrets := make(map[string]string, len(volSecret.Data)+len(volSecret.StringData))
+		for k, v := range volSecret.Data {
+			volSecrets[k] = string(v)
+		}
+		for k, v := range volSecret.StringData {
+			volSecrets[k] = v
+		}
+		if record.VolumeCtx == nil {
+			record.VolumeCtx = map[string]string{}
+		}
+		if err := c.juicefs.JfsDeleteSubPath(ctx, record.VolumeID, record.SubPath, volSecrets, record.VolumeCtx, record.MountOptions); err != nil {
+			log.Error(err, "delete scratch volume error")
+			continue
+		}
+		if err := c.k8sClient.DeleteSecret(ctx, secret.Name, secret.Namespace); err != nil && !k8serrors.IsNotFound(err) {
+			log.Error(err, "delete scratch record error", "name", secret.Name)
+		}
+	}
+}
+
+// inUse checks whether the pod of the scratch volume is still running
+func (c *scratchCollector) inUse(ctx context.Context, record scratchRecord) (bool, error) {
+	pod, err := c.k8sClient.GetPod(ctx, record.PodName, record.PodNamespace)
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		scratchLog.Error(err, "get pod of scratch volume error", "volumeId", record.VolumeID)
+		return false, err
+	}
+	if record.PodUID != "" && string(pod.UID) != record.PodUID {
+		return false, nil
+	}
+	return pod.DeletionTimestamp == nil && !resource.IsPodComplete(pod), nil
+}
+
+// RunScratchCollector deletes expired scratch volumes until ctx is done, it's run by the leader of CSI Controller
+func (d *Driver) RunScratchCollector(ctx context.Context) {
+	if d.controllerService.k8sClient == nil {
+		return
+	}
+	d.runAsLeader(ctx, "scratch-collector", newScratchCollector(d.controllerService.juicefs, d.controllerService.k8sClient).run)
+}
@@ -0,0 +1,134 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestScratchCollector(t *testing.T) {
+	config.Namespace = "kube-system"
+	defer func() { config.Namespace = "" }()
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+	pod := func(name, uid string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(uid)},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+				Name: "scratch",
+				VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{
+					Driver:               config.DriverName,
+					NodePublishSecretRef: &corev1.LocalObjectReference{Name: "juicefs-secret"},
+				}},
+			}}},
+		}
+	}
+	secrets := map[string]string{"name": "myjfs", "metaurl": "redis://127.0.0.1:6379/0"}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		pod("running", "uid-running"),
+		pod("recreated", "uid-old"),
+		pod("deleted", "uid-deleted"),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-secret", Namespace: "default"}, StringData: secrets},
+	)}
+	ns := &nodeService{k8sClient: client}
+	ctx := context.TODO()
+	published := time.Now()
+	record := func(volumeID, pod, uid string) scratchRecord {
+		return scratchRecord{
+			VolumeID:     volumeID,
+			SubPath:      scratchPath("", volumeID),
+			TTL:          "1h",
+			PublishedAt:  published,
+			PodNamespace: "default",
+			PodName:      pod,
+			PodUID:       uid,
+		}
+	}
+	for _, r := range []scratchRecord{
+		record("csi-running", "running", "uid-running"),
+		record("csi-recreated", "recreated", "uid-old"),
+		record("csi-deleted", "deleted", "uid-deleted"),
+	} {
+		if err := ns.recordScratch(ctx, r, "/var/lib/kubelet/pods/"+r.PodUID+"/volumes/kubernetes.io~csi/scratch/mount"); err != nil {
+			t.Fatalf("recordScratch() error = %v", err)
+		}
+		record, err := client.GetSecret(ctx, scratchRecordName(r.VolumeID), config.Namespace)
+		if err != nil {
+			t.Fatalf("get record error = %v", err)
+		}
+		if len(record.Data) != 0 || len(record.StringData) != 0 {
+			t.Errorf("record of scratch volume should not keep credentials, got %v", record.StringData)
+		}
+	}
+	// the pod is recreated and the old one is deleted after they are published
+	if err := client.CoreV1().Pods("default").Delete(ctx, "recreated", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CoreV1().Pods("default").Create(ctx, pod("recreated", "uid-new"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CoreV1().Pods("default").Delete(ctx, "deleted", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newScratchCollector(mockJuicefs, client)
+	// ttl is not expired
+	c.collect(ctx)
+
+	c.now = func() time.Time { return published.Add(2 * time.Hour) }
+	for _, volumeID := range []string{"csi-recreated", "csi-deleted"} {
+		mockJuicefs.EXPECT().JfsDeleteSubPath(gomock.Any(), volumeID, "juicefs-scratch/"+volumeID, secrets, map[string]string{}, nil).Return(nil)
+	}
+	c.collect(ctx)
+
+	if _, err := client.GetSecret(ctx, scratchRecordName("csi-running"), config.Namespace); err != nil {
+		t.Errorf("record of scratch volume in use should be kept, got %v", err)
+	}
+	for _, volumeID := range []string{"csi-recreated", "csi-deleted"} {
+		if _, err := client.GetSecret(ctx, scratchRecordName(volumeID), config.Namespace); !k8serrors.IsNotFound(err) {
+			t.Errorf("record of expired scratch volume %s should be deleted, got %v", volumeID, err)
+		}
+	}
+}
+
+func TestScratchVolumeContext(t *testing.T) {
+	vc, err := config.ParseVolumeContext(map[string]string{common.ScratchTTLKey: "24h", common.EphemeralKey: "true"}, false)
+	if err != nil {
+		t.Fatalf("ParseVolumeContext() error = %v", err)
+	}
+	if vc.ScratchTTL != 24*time.Hour || !vc.Ephemeral {
+		t.Errorf("ParseVolumeContext() = %+v", vc)
+	}
+	if _, err := config.ParseVolumeContext(map[string]string{common.ScratchTTLKey: "1d"}, false); err == nil {
+		t.Errorf("ParseVolumeContext() with invalid ttl should fail")
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+// snapshotRecord is the snapshot created by CreateSnapshot, recorded to answer retries of the same name
+type snapshotRecord struct {
+	Name           string    `json:"name"`
+	SnapshotID     string    `json:"snapshotId"`
+	SourceVolumeID string    `json:"sourceVolumeId"`
+	CreationTime   time.Time `json:"creationTime"`
+}
+
+// snapshotStore records the snapshots in ConfigMaps in the namespace of CSI Driver, one for each snapshot,
+// so that they survive restarts of CSI Controller. They are kept in memory without kubernetes.
+type snapshotStore struct {
+	sync.Mutex
+	k8sClient *k8s.K8sClient
+	snapshots map[string]*csi.Snapshot
+}
+
+func newSnapshotStore(k8sClient *k8s.K8sClient) *snapshotStore {
+	return &snapshotStore{k8sClient: k8sClient, snapshots: make(map[string]*csi.Snapshot)}
+}
+
+// snapshotRecordName returns the name of ConfigMap of the snapshot, snapshot names are not always valid object names
+func snapshotRecordName(name string) string {
+	return fmt.Sprintf("juicefs-snapshot-%x", sha256.Sum256([]byte(name)))
+}
+
+// get returns the snapshot of name, or nil if it's not created
+func (s *snapshotStore) get(ctx context.Context, name string) (*csi.Snapshot, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.k8sClient == nil {
+		return s.snapshots[name], nil
+	}
+	cm, err := s.k8sClient.GetConfigMap(ctx, snapshotRecordName(name), config.Namespace)
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record := snapshotRecord{}
+	if err := json.Unmarshal([]byte(cm.Data[common.SnapshotRecordKey]), &record); err != nil {
+		return nil, fmt.Errorf("invalid record of snapshot %s: %v", name, err)
+	}
+	if record.Name != name {
+		return nil, fmt.Errorf("record %s belongs to snapshot %s, not %s", cm.Name, record.Name, name)
+	}
+	return &csi.Snapshot{
+		SnapshotId:     record.SnapshotID,
+		SourceVolumeId: record.SourceVolumeID,
+		CreationTime:   timestamppb.New(record.CreationTime),
+		ReadyToUse:     true,
+	}, nil
+}
+
+func (s *snapshotStore) put(ctx context.Context, name string, snap *csi.Snapshot) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.k8sClient == nil {
+		s.snapshots[name] = snap
+		return nil
+	}
+	data, err := json.Marshal(snapshotRecord{
+		Name:           name,
+		SnapshotID:     snap.SnapshotId,
+		SourceVolumeID: snap.SourceVolumeId,
+		CreationTime:   snap.CreationTime.AsTime(),
+	})
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      snapshotRecordName(name),
+			Namespace: config.Namespace,
+			Labels:    map[string]string{common.SnapshotRecordKey: "true"},
+		},
+		Data: map[string]string{common.SnapshotRecordKey: string(data)},
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		old, err := s.k8sClient.GetConfigMap(ctx, cm.Name, cm.Namespace)
+		if k8serrors.IsNotFound(err) {
+			return s.k8sClient.CreateConfigMap(ctx, cm)
+		}
+		if err != nil {
+			return err
+		}
+		old.Data = cm.Data
+		return s.k8sClient.UpdateConfigMap(ctx, old)
+	})
+}
+
+func (s *snapshotStore) delete(ctx context.Context, name string) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.k8sClient == nil {
+		delete(s.snapshots, name)
+		return nil
+	}
+	err := s.k8sClient.DeleteConfigMap(ctx, snapshotRecordName(name), config.Namespace)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
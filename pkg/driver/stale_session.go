@@ -0,0 +1,238 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+var staleLog = klog.NewKlogr().WithName("stale-session-reaper")
+
+type staleSessionMetrics struct {
+	podsDeleted prometheus.Counter
+	sessions    *prometheus.GaugeVec
+}
+
+func newStaleSessionMetrics(reg prometheus.Registerer) *staleSessionMetrics {
+	metrics := &staleSessionMetrics{}
+	metrics.podsDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "stale_mount_pods_deleted_total",
+		Help: "number of mount pods left on deleted nodes which are deleted",
+	})
+	metrics.sessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stale_sessions",
+		Help: "number of sessions of clients on deleted nodes found in the last run, by whether the session is still alive",
+	}, []string{"alive"})
+	reg.MustRegister(metrics.podsDeleted, metrics.sessions)
+	return metrics
+}
+
+// staleSessionReaper cleans up what the clients on deleted nodes leave behind. Their mount pods can never be
+// cleaned by CSI Node, and their finalizers keep them terminating forever, so they are deleted here.
+//
+// The sessions of these clients in the metadata engine hold their flocks and opened files. JuiceFS has no command
+// to remove the session of another client (`juicefs destroy` removes the whole file system), so they are not
+// removed here: once its heartbeat expires, the session and its locks are cleaned by any other client of the
+// community edition file system. Sessions still alive belong to clients which are partitioned rather than stopped,
+// they are reported by events since they can only be released by stopping the client. Sessions of enterprise
+// edition are not listed, which is reported by an event as well.
+type staleSessionReaper struct {
+	juicefs   juicefs.Interface
+	k8sClient *k8s.K8sClient
+	metrics   *staleSessionMetrics
+	now       func() time.Time
+}
+
+func newStaleSessionReaper(jfs juicefs.Interface, k8sClient *k8s.K8sClient, reg prometheus.Registerer) *staleSessionReaper {
+	return &staleSessionReaper{juicefs: jfs, k8sClient: k8sClient, metrics: newStaleSessionMetrics(reg), now: time.Now}
+}
+
+func (r *staleSessionReaper) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.reap(ctx)
+	}
+}
+
+func (r *staleSessionReaper) reap(ctx context.Context) {
+	nodes, err := r.k8sClient.ListNode(ctx, nil)
+	if err != nil {
+		staleLog.Error(err, "list nodes error")
+		return
+	}
+	existing := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		existing[node.Name] = true
+	}
+	pods, err := r.k8sClient.ListPod(ctx, config.Namespace, &metav1.LabelSelector{
+		MatchLabels: map[string]string{common.PodTypeKey: common.PodTypeValue},
+	}, nil)
+	if err != nil {
+		staleLog.Error(err, "list mount pods error")
+		return
+	}
+	var alive, expired float64
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName == "" || existing[pod.Spec.NodeName] {
+			continue
+		}
+		a, e := r.reapPod(ctx, pod)
+		alive += float64(a)
+		expired += float64(e)
+	}
+	r.metrics.sessions.WithLabelValues("true").Set(alive)
+	r.metrics.sessions.WithLabelValues("false").Set(expired)
+}
+
+// reapPod reports the sessions of the mount pod on a deleted node and deletes it,
+// the number of sessions still alive and expired are returned
+func (r *staleSessionReaper) reapPod(ctx context.Context, pod *corev1.Pod) (alive, expired int) {
+	log := staleLog.WithValues("pod", pod.Name, "node", pod.Spec.NodeName)
+	// the object the events are reported on, the mount pod is gone after all
+	var obj runtime.Object = pod
+	if pv, err := r.k8sClient.GetPersistentVolume(ctx, pod.Annotations[common.UniqueId]); err == nil {
+		obj = pv
+	}
+	recorder := events.NewRecorder(r.k8sClient)
+
+	sessions, err := r.podSessions(ctx, pod)
+	if err == errSessionsNotListed {
+		if err := recorder.Eventf(ctx, obj, corev1.EventTypeWarning, events.ReasonStaleSession, events.ActionCleanup,
+			"sessions of mount pod %s on deleted node %s are not checked, only community edition with metaurl in secret is supported, check them in the metadata service",
+			pod.Name, pod.Spec.NodeName); err != nil {
+			log.Error(err, "create event error")
+		}
+	} else if err != nil {
+		// the pod is still deleted, its sessions expire anyway
+		log.Error(err, "list sessions error")
+	}
+	now := r.now()
+	for _, s := range sessions {
+		if s.Expire.After(now) {
+			alive++
+			log.Info("session of client on deleted node is still alive", "sid", s.Sid, "expire", s.Expire)
+			if err := recorder.Eventf(ctx, obj, corev1.EventTypeWarning, events.ReasonStaleSession, events.ActionCleanup,
+				"session %d of mount pod %s on deleted node %s is still alive, its locks are held until the client is stopped",
+				s.Sid, pod.Name, pod.Spec.NodeName); err != nil {
+				log.Error(err, "create event error")
+			}
+			continue
+		}
+		expired++
+		if err := recorder.Eventf(ctx, obj, corev1.EventTypeNormal, events.ReasonStaleSession, events.ActionCleanup,
+			"session %d of mount pod %s on deleted node %s expired at %s, it's cleaned with its locks by other clients",
+			s.Sid, pod.Name, pod.Spec.NodeName, s.Expire.Format(time.RFC3339)); err != nil {
+			log.Error(err, "create event error")
+		}
+	}
+
+	if err := resource.RemoveFinalizer(ctx, r.k8sClient, pod, common.Finalizer); err != nil {
+		log.Error(err, "remove finalizer of mount pod error")
+		return
+	}
+	// kubelet is gone with the node, nothing waits for the graceful termination
+	gracePeriod := int64(0)
+	if err := r.k8sClient.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod}); err != nil {
+		log.Error(err, "delete mount pod error")
+		return
+	}
+	log.Info("mount pod on deleted node is deleted")
+	r.metrics.podsDeleted.Inc()
+	if err := recorder.Eventf(ctx, obj, corev1.EventTypeNormal, events.ReasonStaleMountPodDeleted, events.ActionCleanup,
+		"mount pod %s on deleted node %s is deleted", pod.Name, pod.Spec.NodeName); err != nil {
+		log.Error(err, "create event error")
+	}
+	return
+}
+
+// errSessionsNotListed is returned by podSessions if the sessions of the mount pod can't be listed
+var errSessionsNotListed = errors.New("sessions not listed")
+
+// podSessions returns the sessions of the client in the mount pod, matched by hostname and the IP or
+// mount point of the pod, only for community edition
+func (r *staleSessionReaper) podSessions(ctx context.Context, pod *corev1.Pod) ([]juicefs.Session, error) {
+	var secretName string
+	for _, env := range pod.Spec.Containers[0].Env {
+		if env.Name == "metaurl" && env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+			secretName = env.ValueFrom.SecretKeyRef.Name
+		}
+	}
+	if secretName == "" {
+		return nil, errSessionsNotListed
+	}
+	secret, err := r.k8sClient.GetSecret(ctx, secretName, pod.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("get secret %s: %v", secretName, err)
+	}
+	secrets := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+	if secrets["metaurl"] == "" {
+		return nil, errSessionsNotListed
+	}
+	sessions, err := r.juicefs.JfsListSessions(ctx, secrets)
+	if err != nil {
+		return nil, err
+	}
+	mountPath, _, _ := util.GetMountPathOfPod(*pod)
+	var matched []juicefs.Session
+	for _, s := range sessions {
+		if s.HostName != pod.Spec.Hostname {
+			continue
+		}
+		if (mountPath != "" && s.MountPoint == mountPath) || (pod.Status.PodIP != "" && util.ContainsString(s.IPAddrs, pod.Status.PodIP)) {
+			matched = append(matched, s)
+		}
+	}
+	return matched, nil
+}
+
+// RunStaleSessionReaper cleans up mount pods and sessions left on deleted nodes every config.StaleSessionInterval
+// until ctx is done, it's run in CSI Controller
+func (d *Driver) RunStaleSessionReaper(ctx context.Context) {
+	if config.StaleSessionInterval <= 0 || d.stale == nil {
+		return
+	}
+	d.runAsLeader(ctx, "stale-session-reaper", func(ctx context.Context) {
+		d.stale.run(ctx, config.StaleSessionInterval)
+	})
+}
@@ -0,0 +1,113 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestStaleSessionReaper(t *testing.T) {
+	config.Namespace = "kube-system"
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mountPod := func(name, node, ip string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   config.Namespace,
+				Labels:      map[string]string{common.PodTypeKey: common.PodTypeValue},
+				Annotations: map[string]string{common.UniqueId: "pvc-1"},
+				Finalizers:  []string{common.Finalizer},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: node,
+				Hostname: "pvc-1",
+				Containers: []corev1.Container{{
+					Command: []string{"sh", "-c", "exec /bin/mount.juicefs ${metaurl} /jfs/" + name + " -o metrics=0.0.0.0:9567"},
+					Env: []corev1.EnvVar{{Name: "metaurl", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "juicefs-pvc-1-secret"},
+						Key:                  "metaurl",
+					}}}},
+				}},
+			},
+			Status: corev1.PodStatus{PodIP: ip},
+		}
+	}
+	live := mountPod("juicefs-node-a-pvc-1-aaaaaa", "node-a", "10.0.0.1")
+	stale := mountPod("juicefs-node-b-pvc-1-bbbbbb", "node-b", "10.0.0.2")
+	// mount pod of enterprise edition, whose sessions are not listed
+	ee := mountPod("juicefs-node-c-pvc-1-cccccc", "node-c", "10.0.0.3")
+	ee.Spec.Containers[0].Env = nil
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+		&corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"}},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "juicefs-pvc-1-secret", Namespace: config.Namespace},
+			Data:       map[string][]byte{"metaurl": []byte("redis://redis:6379/1")},
+		},
+		live, stale, ee,
+	)}
+
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+	mockJuicefs.EXPECT().JfsListSessions(gomock.Any(), map[string]string{"metaurl": "redis://redis:6379/1"}).Return([]juicefs.Session{
+		{Sid: 1, HostName: "pvc-1", IPAddrs: []string{"10.0.0.1"}, MountPoint: "/jfs/juicefs-node-a-pvc-1-aaaaaa", Expire: now.Add(time.Minute)},
+		{Sid: 2, HostName: "pvc-1", IPAddrs: []string{"10.0.0.2"}, Expire: now.Add(time.Minute)},
+		{Sid: 3, HostName: "pvc-1", MountPoint: "/jfs/juicefs-node-b-pvc-1-bbbbbb", Expire: now.Add(-time.Minute)},
+		{Sid: 4, HostName: "other", IPAddrs: []string{"10.0.0.2"}, Expire: now.Add(time.Minute)},
+	}, nil)
+
+	r := newStaleSessionReaper(mockJuicefs, client, prometheus.NewRegistry())
+	r.now = func() time.Time { return now }
+	r.reap(context.TODO())
+
+	_, err := client.GetPod(context.TODO(), stale.Name, config.Namespace)
+	assert.True(t, k8serrors.IsNotFound(err), "stale mount pod should be deleted: %v", err)
+	_, err = client.GetPod(context.TODO(), ee.Name, config.Namespace)
+	assert.True(t, k8serrors.IsNotFound(err), "stale mount pod of enterprise edition should be deleted: %v", err)
+	_, err = client.GetPod(context.TODO(), live.Name, config.Namespace)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), testutil.ToFloat64(r.metrics.podsDeleted))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.sessions.WithLabelValues("true")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.sessions.WithLabelValues("false")))
+
+	evs, err := client.CoreV1().Events("").List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	reasons := map[string]int{}
+	for _, ev := range evs.Items {
+		assert.Equal(t, "pvc-1", ev.InvolvedObject.Name)
+		reasons[ev.Reason]++
+	}
+	assert.Equal(t, map[string]int{"StaleSession": 3, "StaleMountPodDeleted": 2}, reasons)
+}
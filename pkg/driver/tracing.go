@@ -0,0 +1,71 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"path"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/tracing"
+)
+
+// tracedRPCs are the CSI calls which do the actual work, probes and capability queries are not traced
+var tracedRPCs = map[string]bool{
+	"CreateVolume":           true,
+	"DeleteVolume":           true,
+	"ControllerExpandVolume": true,
+	"CreateSnapshot":         true,
+	"DeleteSnapshot":         true,
+	"NodePublishVolume":      true,
+	"NodeUnpublishVolume":    true,
+}
+
+// volumeIDGetter is implemented by the requests carrying a volume ID
+type volumeIDGetter interface {
+	GetVolumeId() string
+}
+
+// traceRPC starts the span of the CSI call, as a child of the traceparent in the gRPC metadata if the CO sends one
+func traceRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := path.Base(info.FullMethod)
+	if !tracedRPCs[method] {
+		return handler(ctx, req)
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if tp := md.Get("traceparent"); len(tp) > 0 {
+			ctx = tracing.WithRemoteParent(ctx, tp[0])
+		}
+	}
+	ctx, span := tracing.Start(ctx, method)
+	if r, ok := req.(volumeIDGetter); ok {
+		span.SetAttributes("volumeId", r.GetVolumeId())
+	}
+	resp, err := handler(ctx, req)
+	span.Finish(err)
+	return resp, err
+}
+
+// traced runs f in a child span of the CSI call
+func traced(ctx context.Context, name string, f func(ctx context.Context) error) error {
+	ctx, span := tracing.StartChild(ctx, name)
+	err := f(ctx)
+	span.Finish(err)
+	return err
+}
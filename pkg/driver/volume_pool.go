@@ -0,0 +1,289 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var (
+	poolLog            = klog.NewKlogr().WithName("volume-pool")
+	volumePoolInterval = time.Minute
+)
+
+// volumePool keeps empty directories pre-created for the StorageClasses with common.VolumePoolSizeKey, new PVCs
+// are assigned one of them instantly and the pool is backfilled asynchronously. The directories ready to be
+// assigned are recorded in a configmap per StorageClass, claiming one is an atomic update of the configmap.
+type volumePool struct {
+	juicefs   juicefs.Interface
+	k8sClient *k8s.K8sClient
+	available *prometheus.GaugeVec
+	trigger   chan struct{}
+	now       func() time.Time
+}
+
+func newVolumePool(jfs juicefs.Interface, k8sClient *k8s.K8sClient, reg prometheus.Registerer) *volumePool {
+	available := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "volume_pool_available",
+		Help: "number of pre-created directories ready to be assigned to new PVCs",
+	}, []string{"storage_class"})
+	reg.MustRegister(available)
+	return &volumePool{juicefs: jfs, k8sClient: k8sClient, available: available, trigger: make(chan struct{}, 1), now: time.Now}
+}
+
+func poolRecordName(scName string) string {
+	return "juicefs-volume-pool-" + scName
+}
+
+// poolSize returns the size of the pool of the StorageClass, 0 if it's disabled or can't be used, i.e. the
+// directories are named by pathPattern, the secret or mount options are templated per PVC, or each volume has
+// a dedicated file system
+func poolSize(sc *storagev1.StorageClass) int {
+	n, _ := strconv.Atoi(sc.Parameters[common.VolumePoolSizeKey])
+	if n <= 0 || sc.Provisioner != config.DriverName || sc.Parameters["pathPattern"] != "" || config.BucketPerVolume(sc.Parameters) {
+		return 0
+	}
+	name, namespace := config.StorageClassSecret(sc.Parameters, config.SecretOpProvisioner)
+	if name == "" || namespace == "" || strings.Contains(name+namespace, "${") {
+		return 0
+	}
+	for _, o := range sc.MountOptions {
+		if strings.Contains(o, "${") {
+			return 0
+		}
+	}
+	return n
+}
+
+// claim takes the oldest directory from the pool of the StorageClass and returns its sub path, "" if the pool is
+// empty or disabled, then the PVC is provisioned as usual
+func (p *volumePool) claim(ctx context.Context, sc *storagev1.StorageClass) (string, error) {
+	if p == nil || p.k8sClient == nil || poolSize(sc) == 0 {
+		return "", nil
+	}
+	defer p.backfillAsync()
+	var subPath string
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		subPath = ""
+		cm, err := p.k8sClient.GetConfigMap(ctx, poolRecordName(sc.Name), config.Namespace)
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ids := sortedIDs(cm.Data)
+		if len(ids) == 0 {
+			return nil
+		}
+		delete(cm.Data, ids[0])
+		if err := p.k8sClient.UpdateConfigMap(ctx, cm); err != nil {
+			return err
+		}
+		subPath = path.Join(common.VolumePoolDir, ids[0])
+		p.available.WithLabelValues(sc.Name).Set(float64(len(cm.Data)))
+		return nil
+	})
+	return subPath, err
+}
+
+// release returns the directory claimed for a PVC failed to be provisioned to the pool of the StorageClass
+func (p *volumePool) release(ctx context.Context, sc *storagev1.StorageClass, subPath string) {
+	id := path.Base(subPath)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := p.k8sClient.GetConfigMap(ctx, poolRecordName(sc.Name), config.Namespace)
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[id] = p.now().UTC().Format(time.RFC3339Nano)
+		if err := p.k8sClient.UpdateConfigMap(ctx, cm); err != nil {
+			return err
+		}
+		p.available.WithLabelValues(sc.Name).Set(float64(len(cm.Data)))
+		return nil
+	})
+	if err != nil {
+		// the directory is left in the file system, like the ones of disabled pools
+		poolLog.Error(err, "return directory to volume pool error", "storageClass", sc.Name, "subPath", subPath)
+	}
+}
+
+// sortedIDs returns the ids of directories in the record, the oldest first
+func sortedIDs(data map[string]string) []string {
+	ids := make([]string, 0, len(data))
+	for id := range data {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if data[ids[i]] != data[ids[j]] {
+			return data[ids[i]] < data[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func (p *volumePool) backfillAsync() {
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (p *volumePool) run(ctx context.Context) {
+	if p == nil || p.k8sClient == nil {
+		return
+	}
+	ticker := time.NewTicker(volumePoolInterval)
+	defer ticker.Stop()
+	for {
+		p.backfill(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.trigger:
+		}
+	}
+}
+
+// backfill fills the pools up to their sizes, and removes the records of StorageClasses which are deleted or
+// whose pools are disabled
+func (p *volumePool) backfill(ctx context.Context) {
+	classes, err := p.k8sClient.ListStorageClasses(ctx)
+	if err != nil {
+		poolLog.Error(err, "list storage classes error")
+		return
+	}
+	records, err := p.k8sClient.CoreV1().ConfigMaps(config.Namespace).List(ctx, metav1.ListOptions{LabelSelector: common.VolumePoolLabelKey + "=true"})
+	if err != nil {
+		poolLog.Error(err, "list volume pool records error")
+		return
+	}
+	pooled := map[string]bool{}
+	for i := range classes {
+		sc := &classes[i]
+		if poolSize(sc) == 0 {
+			continue
+		}
+		pooled[poolRecordName(sc.Name)] = true
+		if err := p.fill(ctx, sc); err != nil {
+			poolLog.Error(err, "backfill volume pool error", "storageClass", sc.Name)
+		}
+	}
+	for _, cm := range records.Items {
+		if pooled[cm.Name] {
+			continue
+		}
+		scName := cm.Annotations[common.VolumePoolLabelKey]
+		poolLog.Info("volume pool is disabled, delete its record, the directories are left in the file system",
+			"storageClass", scName, "dirs", sortedIDs(cm.Data))
+		if err := p.k8sClient.DeleteConfigMap(ctx, cm.Name, cm.Namespace); err != nil && !k8serrors.IsNotFound(err) {
+			poolLog.Error(err, "delete volume pool record error", "name", cm.Name)
+		}
+		p.available.DeleteLabelValues(scName)
+	}
+}
+
+func (p *volumePool) fill(ctx context.Context, sc *storagev1.StorageClass) error {
+	name := poolRecordName(sc.Name)
+	cm, err := p.k8sClient.GetConfigMap(ctx, name, config.Namespace)
+	if k8serrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: config.Namespace,
+			// names of StorageClasses may be too long for label values
+			Labels:      map[string]string{common.VolumePoolLabelKey: "true"},
+			Annotations: map[string]string{common.VolumePoolLabelKey: sc.Name},
+		}}
+		if err = p.k8sClient.CreateConfigMap(ctx, cm); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	need := poolSize(sc) - len(cm.Data)
+	p.available.WithLabelValues(sc.Name).Set(float64(len(cm.Data)))
+	if need <= 0 {
+		return nil
+	}
+
+	secretName, secretNamespace := config.StorageClassSecret(sc.Parameters, config.SecretOpProvisioner)
+	secret, err := p.k8sClient.GetSecret(ctx, secretName, secretNamespace)
+	if err != nil {
+		return err
+	}
+	secrets := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+	volCtx := make(map[string]string, len(sc.Parameters))
+	for k, v := range sc.Parameters {
+		volCtx[k] = v
+	}
+	// directories are created from the root of the file system, while PVs mount them in the subdir
+	base := strings.TrimPrefix(path.Join(subdirOption(sc.MountOptions), common.VolumePoolDir), "/")
+	for i := 0; i < need; i++ {
+		id := rand.String(10)
+		if err := p.juicefs.JfsCreateVol(ctx, "pool-"+id, path.Join(base, id), secrets, volCtx); err != nil {
+			return err
+		}
+		created := p.now().UTC().Format(time.RFC3339Nano)
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			cm, err := p.k8sClient.GetConfigMap(ctx, name, config.Namespace)
+			if err != nil {
+				return err
+			}
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+			cm.Data[id] = created
+			if err := p.k8sClient.UpdateConfigMap(ctx, cm); err != nil {
+				return err
+			}
+			p.available.WithLabelValues(sc.Name).Set(float64(len(cm.Data)))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		poolLog.V(1).Info("directory added to volume pool", "storageClass", sc.Name, "dir", path.Join(base, id))
+	}
+	return nil
+}
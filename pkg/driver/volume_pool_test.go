@@ -0,0 +1,109 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mocks"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestVolumePool(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockJuicefs := mocks.NewMockInterface(mockCtl)
+
+	params := map[string]string{
+		common.ProvisionerSecretName:      "juicefs-secret",
+		common.ProvisionerSecretNamespace: "kube-system",
+		common.VolumePoolSizeKey:          "2",
+	}
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "pooled"}, Provisioner: config.DriverName, Parameters: params, MountOptions: []string{"subdir=/k8s"}}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-secret", Namespace: "kube-system"}, Data: map[string][]byte{"name": []byte("myjfs")}}
+	stale := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:        poolRecordName("deleted"),
+		Namespace:   config.Namespace,
+		Labels:      map[string]string{common.VolumePoolLabelKey: "true"},
+		Annotations: map[string]string{common.VolumePoolLabelKey: "deleted"},
+	}}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(sc, secret, stale)}
+
+	var created []string
+	mockJuicefs.EXPECT().JfsCreateVol(gomock.Any(), gomock.Any(), gomock.Any(), map[string]string{"name": "myjfs"}, params).DoAndReturn(
+		func(ctx context.Context, volumeID, subPath string, secrets, volCtx map[string]string) error {
+			assert.Equal(t, "pool-"+subPath[strings.LastIndex(subPath, "/")+1:], volumeID)
+			created = append(created, subPath)
+			return nil
+		}).Times(3)
+
+	now := time.Now()
+	p := newVolumePool(mockJuicefs, client, prometheus.NewRegistry())
+	p.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	p.backfill(context.TODO())
+	assert.Len(t, created, 2)
+	assert.True(t, strings.HasPrefix(created[0], "k8s/juicefs-pool/"), created[0])
+	assert.Equal(t, float64(2), testutil.ToFloat64(p.available.WithLabelValues("pooled")))
+	_, err := client.GetConfigMap(context.TODO(), poolRecordName("deleted"), config.Namespace)
+	assert.Error(t, err)
+
+	// the oldest one is claimed first
+	subPath, err := p.claim(context.TODO(), sc)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimPrefix(created[0], "k8s/"), subPath)
+	assert.Equal(t, float64(1), testutil.ToFloat64(p.available.WithLabelValues("pooled")))
+	p.backfill(context.TODO())
+	assert.Len(t, created, 3)
+
+	// the directory of a PVC failed to be provisioned is returned to the pool
+	subPath, err = p.claim(context.TODO(), sc)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimPrefix(created[1], "k8s/"), subPath)
+	p.release(context.TODO(), sc, subPath)
+	cm, err := client.GetConfigMap(context.TODO(), poolRecordName("pooled"), config.Namespace)
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data, path.Base(subPath))
+	assert.Equal(t, float64(2), testutil.ToFloat64(p.available.WithLabelValues("pooled")))
+
+	// pool can't be used with pathPattern
+	patterned := sc.DeepCopy()
+	patterned.Parameters = map[string]string{"pathPattern": "${.pvc.name}"}
+	for k, v := range params {
+		patterned.Parameters[k] = v
+	}
+	subPath, err = p.claim(context.TODO(), patterned)
+	assert.NoError(t, err)
+	assert.Equal(t, "", subPath)
+}
@@ -0,0 +1,270 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package events emits Kubernetes events for all components of CSI Driver. Events of the same object and reason
+// are rate limited, and the repeated ones with the same message are aggregated into one event by increasing its
+// count, so that retries don't flood the API server with duplicate events.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/reference"
+	"k8s.io/klog/v2"
+)
+
+var log = klog.NewKlogr().WithName("events")
+
+// Reasons of events, each reason belongs to one action
+const (
+	// ActionUpgrade upgrading mount pods
+	ActionUpgrade = "Upgrade"
+	ReasonUpgrade = "Upgrade"
+
+	// ActionRecover recovering mounts of application pods
+	ActionRecover              = "Recover"
+	ReasonPrimaryRecovered     = "PrimaryRecovered"
+	ReasonMemoryPressureShrink = "MemoryPressureShrink"
+	ReasonMemoryPressureEvict  = "MemoryPressureEvict"
+
+	// ActionThrottle applying bandwidth limits to mounts
+	ActionThrottle           = "Throttle"
+	ReasonThrottleNotApplied = "ThrottleNotApplied"
+
+	// ActionProvision provisioning volumes
+	ActionProvision         = "Provision"
+	ReasonFormatReconciled  = "FormatReconciled"
+	ReasonFormatDrift       = "FormatDrift"
+	ReasonCheckpointFailed  = "CheckpointFailed"
+	ReasonCheckpointCreated = "CheckpointCreated"
+	ReasonCapacityDrift     = "CapacityDrift"
+	ReasonCapacitySynced    = "CapacitySynced"
+	ReasonStorageClassInUse = "StorageClassInUse"
+
+	// ActionAudit auditing data of file systems
+	ActionAudit         = "Audit"
+	ReasonOrphanSubdirs = "OrphanSubdirs"
+
+	// ActionMount mounting volumes
+	ActionMount                  = "Mount"
+	ReasonMountOptionsDowngraded = "MountOptionsDowngraded"
+	ReasonMultiAttachRejected    = "MultiAttachRejected"
+	ReasonMountMisconfigured     = "MountMisconfigured"
+
+	// ActionCleanup cleaning up what crashed clients left behind
+	ActionCleanup              = "Cleanup"
+	ReasonStaleMountPodDeleted = "StaleMountPodDeleted"
+	ReasonStaleSession         = "StaleSession"
+
+	// ActionCheckNode checking the node where volumes are mounted
+	ActionCheckNode     = "CheckNode"
+	ReasonFuseUnhealthy = "FuseUnhealthy"
+	ReasonFuseHealthy   = "FuseHealthy"
+
+	// ActionInject injecting mount sidecars into application pods
+	ActionInject       = "Inject"
+	ReasonInjectFailed = "InjectFailed"
+)
+
+var (
+	// Component reports events, set by the command of each component
+	Component = "juicefs-csi-driver"
+	// Host is the node events are reported from, empty for components not running on nodes
+	Host = ""
+	// Burst is the number of events of the same object and reason allowed at once, then one more is allowed every Interval
+	Burst    = 10
+	Interval = 30 * time.Second
+	// AggregateWindow repeated events with the same message within the window increase the count of the last one
+	AggregateWindow = 10 * time.Minute
+
+	defaultCache = newCache()
+)
+
+// Setup sets the component and host reporting events
+func Setup(component, host string) {
+	Component = component
+	Host = host
+}
+
+// Recorder emits events through client, rate limiting and aggregation are shared by all recorders of the process
+type Recorder struct {
+	client kubernetes.Interface
+	cache  *cache
+	now    func() time.Time
+}
+
+func NewRecorder(client kubernetes.Interface) *Recorder {
+	return &Recorder{client: client, cache: defaultCache, now: time.Now}
+}
+
+// Eventf is Event with the message formatted
+func (r *Recorder) Eventf(ctx context.Context, obj runtime.Object, eventType, reason, action, format string, args ...interface{}) error {
+	return r.Event(ctx, obj, eventType, reason, action, fmt.Sprintf(format, args...))
+}
+
+// Event emits an event of obj, it's dropped silently if events of obj with the reason are rate limited. Events of
+// cluster scoped objects are created in the default namespace.
+func (r *Recorder) Event(ctx context.Context, obj runtime.Object, eventType, reason, action, message string) error {
+	ref, err := reference.GetReference(scheme.Scheme, obj)
+	if err != nil {
+		return fmt.Errorf("get reference of object error: %v", err)
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	now := r.now()
+	key := fmt.Sprintf("%s/%s/%s/%s", ref.Kind, ref.Namespace, ref.Name, reason)
+	if !r.cache.allow(key, now) {
+		log.V(1).Info("event is rate limited", "object", ref.Namespace+"/"+ref.Name, "kind", ref.Kind, "reason", reason, "message", message)
+		return nil
+	}
+
+	if last := r.cache.last(key, message, now); last != nil {
+		if err := r.increase(ctx, last, now); err == nil {
+			return nil
+		} else if !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	evt, err := r.client.CoreV1().Events(namespace).Create(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", ref.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject:      *ref,
+		Reason:              reason,
+		Action:              action,
+		Message:             message,
+		Source:              corev1.EventSource{Component: Component, Host: Host},
+		FirstTimestamp:      metav1.Time{Time: now},
+		LastTimestamp:       metav1.Time{Time: now},
+		Count:               1,
+		Type:                eventType,
+		ReportingController: Component,
+		ReportingInstance:   Host,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	r.cache.record(key, &recentEvent{
+		namespace: evt.Namespace,
+		name:      evt.Name,
+		message:   message,
+		count:     1,
+		lastTime:  now,
+	})
+	return nil
+}
+
+func (r *Recorder) increase(ctx context.Context, last *recentEvent, now time.Time) error {
+	count := r.cache.increase(last, now)
+	patch, err := json.Marshal(map[string]interface{}{
+		"count":         count,
+		"lastTimestamp": metav1.Time{Time: now},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.client.CoreV1().Events(last.namespace).Patch(ctx, last.name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+type recentEvent struct {
+	namespace string
+	name      string
+	message   string
+	count     int32
+	lastTime  time.Time
+}
+
+// cache keeps the rate limiters and the last events, key is <kind>/<namespace>/<name>/<reason> of events
+type cache struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	events   map[string]*recentEvent
+}
+
+// maxCacheSize entries in cache are pruned once it's reached
+const maxCacheSize = 4096
+
+func newCache() *cache {
+	return &cache{limiters: map[string]*rate.Limiter{}, events: map[string]*recentEvent{}}
+}
+
+func (c *cache) allow(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.limiters) >= maxCacheSize {
+		c.prune(now)
+	}
+	l, ok := c.limiters[key]
+	if !ok {
+		l = rate.NewLimiter(rate.Every(Interval), Burst)
+		c.limiters[key] = l
+	}
+	return l.AllowN(now, 1)
+}
+
+// prune removes the limiters which are full, they behave the same as new ones, and the events out of window
+func (c *cache) prune(now time.Time) {
+	for key, l := range c.limiters {
+		if l.TokensAt(now) >= float64(l.Burst()) {
+			delete(c.limiters, key)
+		}
+	}
+	for key, e := range c.events {
+		if now.Sub(e.lastTime) > AggregateWindow {
+			delete(c.events, key)
+		}
+	}
+}
+
+func (c *cache) last(key, message string, now time.Time) *recentEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.events[key]
+	if !ok || e.message != message || now.Sub(e.lastTime) > AggregateWindow {
+		return nil
+	}
+	return e
+}
+
+func (c *cache) increase(e *recentEvent, now time.Time) int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.count++
+	e.lastTime = now
+	return e.count
+}
+
+func (c *cache) record(key string, e *recentEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events[key] = e
+}
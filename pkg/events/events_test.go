@@ -0,0 +1,91 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestRecorder(now *time.Time) *Recorder {
+	r := NewRecorder(fake.NewSimpleClientset())
+	r.cache = newCache()
+	r.now = func() time.Time { return *now }
+	return r
+}
+
+func TestRecorderAggregate(t *testing.T) {
+	now := time.Now()
+	r := newTestRecorder(&now)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid"}}
+	ctx := context.TODO()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.Event(ctx, pod, corev1.EventTypeWarning, ReasonUpgrade, ActionUpgrade, "same"))
+		now = now.Add(time.Second)
+	}
+	assert.NoError(t, r.Event(ctx, pod, corev1.EventTypeWarning, ReasonUpgrade, ActionUpgrade, "different"))
+
+	evts, err := r.client.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, evts.Items, 2)
+	counts := map[string]int32{}
+	for _, e := range evts.Items {
+		counts[e.Message] = e.Count
+		assert.Equal(t, "Pod", e.InvolvedObject.Kind)
+		assert.Equal(t, ActionUpgrade, e.Action)
+	}
+	assert.Equal(t, map[string]int32{"same": 3, "different": 1}, counts)
+
+	// out of the aggregate window, a new event is created
+	now = now.Add(AggregateWindow + time.Second)
+	assert.NoError(t, r.Event(ctx, pod, corev1.EventTypeWarning, ReasonUpgrade, ActionUpgrade, "different"))
+	evts, _ = r.client.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+	assert.Len(t, evts.Items, 3)
+}
+
+func TestRecorderRateLimit(t *testing.T) {
+	now := time.Now()
+	r := newTestRecorder(&now)
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "sc"}}
+	ctx := context.TODO()
+
+	for i := 0; i < Burst+5; i++ {
+		assert.NoError(t, r.Eventf(ctx, sc, corev1.EventTypeWarning, ReasonOrphanSubdirs, ActionAudit, "message %d", i))
+		now = now.Add(time.Millisecond)
+	}
+	// events of cluster scoped objects are in the default namespace
+	evts, _ := r.client.CoreV1().Events(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{})
+	assert.Len(t, evts.Items, Burst)
+
+	// other reasons are not limited
+	assert.NoError(t, r.Event(ctx, sc, corev1.EventTypeNormal, ReasonFormatReconciled, ActionProvision, "message"))
+	// one more is allowed after the interval
+	now = now.Add(Interval)
+	assert.NoError(t, r.Event(ctx, sc, corev1.EventTypeWarning, ReasonOrphanSubdirs, ActionAudit, "message"))
+	now = now.Add(time.Millisecond)
+	assert.NoError(t, r.Event(ctx, sc, corev1.EventTypeWarning, ReasonOrphanSubdirs, ActionAudit, "dropped"))
+	evts, _ = r.client.CoreV1().Events(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{})
+	assert.Len(t, evts.Items, Burst+2)
+}
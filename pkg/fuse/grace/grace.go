@@ -36,6 +36,7 @@ import (
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
 	"github.com/juicedata/juicefs-csi-driver/pkg/fuse/passfd"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount/builder"
 	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
@@ -48,6 +49,7 @@ var log = klog.NewKlogr().WithName("grace")
 const (
 	recreate             = "RECREATE"
 	noRecreate           = "NORECREATE"
+	standby              = "STANDBY"
 	singleUpgradeTimeout = 30 * time.Minute
 )
 
@@ -90,10 +92,11 @@ type upgradeRequest struct {
 	name       string
 	configName string
 	batchIndex int
+	drain      time.Duration
 }
 
 // parseRequest parse request from message
-// message format: <pod-name> [recreate/noRecreate]
+// message format: <pod-name> [recreate/noRecreate/standby] [options]
 func parseRequest(message string) upgradeRequest {
 	req := upgradeRequest{
 		action: noRecreate,
@@ -105,7 +108,7 @@ func parseRequest(message string) upgradeRequest {
 		return req
 	}
 	req.action = ss[1]
-	if ss[0] == "BATCH" && len(ss) > 2 {
+	if len(ss) > 2 {
 		options := strings.Split(ss[2], ",")
 		for _, option := range options {
 			ops := strings.Split(option, "=")
@@ -123,6 +126,14 @@ func parseRequest(message string) upgradeRequest {
 			if ops[0] == "batchConfig" {
 				req.configName = ops[1]
 			}
+			if ops[0] == "drain" {
+				d, err := time.ParseDuration(ops[1])
+				if err != nil {
+					log.Error(err, "failed to parse options", "option", option)
+					continue
+				}
+				req.drain = d
+			}
 		}
 		return req
 	}
@@ -161,6 +172,10 @@ func handleShutdown(conn net.Conn) {
 
 	ctx, cancel := context.WithTimeout(context.TODO(), singleUpgradeTimeout)
 	defer cancel()
+	if req.action == standby {
+		StandbyUpgrade(ctx, client, req.name, req.drain, conn)
+		return
+	}
 	SinglePodUpgrade(ctx, client, req.name, req.action == recreate, conn)
 }
 
@@ -281,7 +296,7 @@ func (p *PodUpgrade) sighup(ctx context.Context, conn net.Conn, jfsConf *util.Ju
 		sendMessage(conn, "POD-SUCCESS "+upgradeEvtMsg)
 		p.status = config.Success
 	}
-	if err := p.client.CreateEvent(ctx, *p.pod, corev1.EventTypeNormal, "Upgrade", upgradeEvtMsg); err != nil {
+	if err := events.NewRecorder(p.client).Event(ctx, p.pod, corev1.EventTypeNormal, events.ReasonUpgrade, events.ActionUpgrade, upgradeEvtMsg); err != nil {
 		log.Error(err, "fail to create event")
 	}
 	return nil
@@ -20,6 +20,9 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
+
+	k8sMount "k8s.io/utils/mount"
 )
 
 func Test_parseRequest(t *testing.T) {
@@ -63,6 +66,17 @@ func Test_parseRequest(t *testing.T) {
 				batchIndex: 1,
 			},
 		},
+		{
+			name: "standby",
+			args: args{
+				message: fmt.Sprintf("juicefs-xxxx %s drain=10m", standby),
+			},
+			want: upgradeRequest{
+				action: standby,
+				name:   "juicefs-xxxx",
+				drain:  10 * time.Minute,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -72,3 +86,28 @@ func Test_parseRequest(t *testing.T) {
 		})
 	}
 }
+
+func Test_targetMounts(t *testing.T) {
+	podDir := "/var/lib/kubelet/pods/0c6c4b3a-4f2c-4c8b-9d0a-3c2b1a0f9e8d"
+	target := podDir + "/volumes/kubernetes.io~csi/pv-1/mount"
+	mis := []k8sMount.MountInfo{
+		{Major: 0, Minor: 50, Root: "/", MountPoint: "/jfs/pv-1-abcdef"},
+		{Major: 0, Minor: 50, Root: "/", MountPoint: target},
+		{Major: 0, Minor: 50, Root: "/data", MountPoint: podDir + "/volume-subpaths/pv-1/app/0"},
+		// already switched to another mount
+		{Major: 0, Minor: 50, Root: "/logs", MountPoint: podDir + "/volume-subpaths/pv-1/app/1"},
+		{Major: 0, Minor: 60, Root: "/logs", MountPoint: podDir + "/volume-subpaths/pv-1/app/1"},
+		// subpath of another volume
+		{Major: 0, Minor: 50, Root: "/", MountPoint: podDir + "/volume-subpaths/pv-2/app/0"},
+	}
+	want := map[string]string{
+		target:                                 "",
+		podDir + "/volume-subpaths/pv-1/app/0": "data",
+	}
+	if got := targetMounts(mis, target, 0, 50); !reflect.DeepEqual(got, want) {
+		t.Errorf("targetMounts() = %v, want %v", got, want)
+	}
+	if mi := mountOf(mis, "/jfs/pv-1-abcdef"); mi == nil || mi.Minor != 50 {
+		t.Errorf("mountOf() = %v", mi)
+	}
+}
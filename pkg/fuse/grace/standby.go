@@ -0,0 +1,402 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package grace
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8sMount "k8s.io/utils/mount"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	"github.com/juicedata/juicefs-csi-driver/pkg/fuse/passfd"
+	podmount "github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount/builder"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+const (
+	defaultStandbyDrain = 5 * time.Minute
+	standbyReadyTimeout = 5 * time.Minute
+	standbyCheckTimeout = 2 * time.Second
+
+	// place for csi mounts and subpath mounts of application pods
+	containerCsiDirectory     = "volumes/kubernetes.io~csi/"
+	containerSubPathDirectory = "volume-subpaths/"
+)
+
+// StandbyUpgrade upgrades the mount pod without interrupting I/O of applications. A standby mount pod is created
+// alongside with the current config of the volume, once it's healthy, targets of the old one are switched to it by
+// bind mounting over them, then the old one is retired after drain, which leaves time for files opened through it
+// to be closed.
+func StandbyUpgrade(ctx context.Context, client *k8s.K8sClient, name string, drain time.Duration, conn net.Conn) {
+	sendMessage(conn, fmt.Sprintf("POD-START [%s] start to upgrade with a standby mount pod", name))
+	if drain <= 0 {
+		drain = defaultStandbyDrain
+	}
+	su, err := newStandbyUpgrade(ctx, client, name)
+	if err != nil {
+		log.Error(err, "failed to create standby upgrade", "pod", name)
+		sendMessage(conn, fmt.Sprintf("POD-FAIL [%s] %s.", name, err.Error()))
+		return
+	}
+	if err := su.run(ctx, drain, conn); err != nil {
+		log.Error(err, "standby upgrade error", "pod", name)
+		sendMessage(conn, fmt.Sprintf("POD-FAIL [%s] %s.", name, err.Error()))
+		return
+	}
+	msg := fmt.Sprintf("Switch targets to standby mount pod %s, retire after %s", su.standby.Name, drain)
+	if err := events.NewRecorder(client).Event(ctx, su.pod, corev1.EventTypeNormal, events.ReasonUpgrade, events.ActionUpgrade, msg); err != nil {
+		log.Error(err, "fail to create event")
+	}
+	sendMessage(conn, fmt.Sprintf("POD-SUCCESS [%s] %s", name, msg))
+}
+
+type standbyUpgrade struct {
+	client  *k8s.K8sClient
+	pod     *corev1.Pod
+	setting *config.JfsSetting
+	standby *corev1.Pod
+	// refs of the old mount pod, key is reference key, value is target
+	refs map[string]string
+}
+
+func newStandbyUpgrade(ctx context.Context, client *k8s.K8sClient, name string) (*standbyUpgrade, error) {
+	pod, err := client.GetPod(ctx, name, config.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("can not get pod: %v", err)
+	}
+	if pod.Spec.NodeName != config.NodeName {
+		return nil, fmt.Errorf("pod is not on node %s", config.NodeName)
+	}
+	if !resource.IsPodReady(pod) || pod.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("pod is not ready")
+	}
+	if by := pod.Annotations[common.JfsRetiredByKey]; by != "" {
+		return nil, fmt.Errorf("pod is already retired by %s", by)
+	}
+	setting, err := config.GenSettingAttrWithMountPod(ctx, client, pod)
+	if err != nil {
+		return nil, fmt.Errorf("can not generate setting of pod: %v", err)
+	}
+	if setting.HashVal == pod.Labels[common.PodJuiceHashLabelKey] {
+		return nil, fmt.Errorf("config of the volume is not changed, nothing to switch to")
+	}
+	return &standbyUpgrade{
+		client:  client,
+		pod:     pod,
+		setting: setting,
+		refs:    resource.GetAllRefKeys(*pod),
+	}, nil
+}
+
+func (s *standbyUpgrade) run(ctx context.Context, drain time.Duration, conn net.Conn) error {
+	created, err := s.createStandby(ctx)
+	if err != nil {
+		return err
+	}
+	sendMessage(conn, fmt.Sprintf("wait for standby mount pod %s ready", s.standby.Name))
+	if err := s.waitStandbyReady(ctx); err != nil {
+		s.abort(ctx, created)
+		return fmt.Errorf("standby mount pod %s is not healthy: %v", s.standby.Name, err)
+	}
+
+	lock := config.GetPodLock(config.GetPodLockKey(s.pod, ""))
+	lock.Lock()
+	defer lock.Unlock()
+
+	switched, err := s.switchTargets(ctx, conn)
+	if err != nil {
+		log.Error(err, "switch targets error", "pod", s.pod.Name)
+	}
+	return s.moveRefs(ctx, switched, drain, err)
+}
+
+// createStandby creates the mount pod with the current config of the volume, or reuses the one created by
+// publishing after the config changed, with the refs of the old one
+func (s *standbyUpgrade) createStandby(ctx context.Context) (bool, error) {
+	lock := config.GetPodLock(s.setting.HashVal)
+	lock.Lock()
+	defer lock.Unlock()
+
+	uniqueId := resource.GetUniqueId(*s.pod)
+	pods, err := s.client.ListPod(ctx, config.Namespace, &metav1.LabelSelector{MatchLabels: map[string]string{
+		common.PodTypeKey:           common.PodTypeValue,
+		common.PodUniqueIdLabelKey:  uniqueId,
+		common.PodJuiceHashLabelKey: s.setting.HashVal,
+	}}, nil)
+	if err != nil {
+		return false, err
+	}
+	for i := range pods {
+		po := &pods[i]
+		if po.Spec.NodeName != config.NodeName || po.DeletionTimestamp != nil || resource.IsPodComplete(po) {
+			continue
+		}
+		log.Info("reuse mount pod as standby", "pod", s.pod.Name, "standby", po.Name)
+		if err := resource.AddPodAnnotation(ctx, s.client, po.Name, po.Namespace, s.refs); err != nil {
+			return false, err
+		}
+		s.standby = po
+		return false, nil
+	}
+
+	podName := podmount.GenPodNameByUniqueId(uniqueId, true)
+	s.setting.UniqueId = uniqueId
+	s.setting.UpgradeUUID = string(uuid.NewUUID())
+	s.setting.MountPath = filepath.Join(config.PodMountBase, uniqueId) + podName[len(podName)-7:]
+	s.setting.SecretName = fmt.Sprintf("juicefs-%s-secret", uniqueId)
+	// the port of the old mount pod is still in use until targets are switched
+	s.setting.MetricsPort = 0
+	if err := podmount.AllocateMetricsPort(ctx, s.client, s.setting); err != nil {
+		log.Error(err, "assign metrics port error, listen on a random port", "podName", podName)
+	}
+	r := builder.NewPodBuilder(s.setting, 0)
+	secret := r.NewSecret()
+	builder.SetPVAsOwner(&secret, s.setting.PV)
+	if err := util.MkdirIfNotExist(ctx, s.setting.MountPath); err != nil {
+		return false, err
+	}
+	standby, err := r.NewMountPod(podName)
+	if err != nil {
+		return false, err
+	}
+	// refs keep the standby mount pod from being deleted before targets are switched to it
+	for k, v := range s.refs {
+		standby.Annotations[k] = v
+	}
+	if err := builder.SaveSecret(ctx, s.client, s.setting, &secret); err != nil {
+		return false, err
+	}
+	if util.SupportFusePass(s.setting.Attr.Image) {
+		if err := passfd.GlobalFds.ServeFuseFd(ctx, standby); err != nil {
+			log.Error(err, "serve fuse fd error", "podName", podName)
+		}
+	}
+	log.Info("create standby mount pod", "pod", s.pod.Name, "standby", podName)
+	if s.standby, err = s.client.CreatePod(ctx, standby); err != nil {
+		passfd.GlobalFds.StopFd(ctx, standby)
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *standbyUpgrade) waitStandbyReady(ctx context.Context) error {
+	err := wait.PollUntilContextTimeout(ctx, time.Second, standbyReadyTimeout, true, func(ctx context.Context) (bool, error) {
+		po, err := s.client.GetPod(ctx, s.standby.Name, s.standby.Namespace)
+		if err != nil {
+			return false, nil
+		}
+		if po.DeletionTimestamp != nil || resource.IsPodComplete(po) {
+			return false, fmt.Errorf("pod is %s", po.Status.Phase)
+		}
+		s.standby = po
+		return resource.IsPodReady(po), nil
+	})
+	if err != nil {
+		return err
+	}
+	mntPath, _, err := util.GetMountPathOfPod(*s.standby)
+	if err != nil {
+		return err
+	}
+	return resource.WaitUtilMountReady(ctx, s.standby.Name, mntPath, standbyCheckTimeout)
+}
+
+// abort removes the refs copied to the standby mount pod, and deletes it if it's created for the upgrade
+func (s *standbyUpgrade) abort(ctx context.Context, created bool) {
+	if created {
+		if err := s.client.DeletePod(ctx, s.standby); err != nil {
+			log.Error(err, "delete standby mount pod error", "standby", s.standby.Name)
+		}
+		return
+	}
+	keys := make([]string, 0, len(s.refs))
+	for k := range s.refs {
+		keys = append(keys, k)
+	}
+	if err := resource.DelPodAnnotation(ctx, s.client, s.standby.Name, s.standby.Namespace, keys); err != nil {
+		log.Error(err, "remove refs from standby mount pod error", "standby", s.standby.Name)
+	}
+}
+
+// switchTargets bind mounts the standby mount point over the targets of the old one, and returns the reference
+// keys whose targets are all switched
+func (s *standbyUpgrade) switchTargets(ctx context.Context, conn net.Conn) (map[string]bool, error) {
+	oldPath, _, err := util.GetMountPathOfPod(*s.pod)
+	if err != nil {
+		return nil, err
+	}
+	newPath, _, err := util.GetMountPathOfPod(*s.standby)
+	if err != nil {
+		return nil, err
+	}
+	mis, err := k8sMount.ParseMountInfo("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	old := mountOf(mis, oldPath)
+	if old == nil {
+		return nil, fmt.Errorf("mount point %s of pod is not found", oldPath)
+	}
+
+	mounter := k8sMount.New("")
+	switched := map[string]bool{}
+	var lastErr error
+	for key, target := range s.refs {
+		ok := true
+		for mountPoint, subpath := range targetMounts(mis, target, old.Major, old.Minor) {
+			source := path.Join(newPath, subpath)
+			err := util.DoWithTimeout(ctx, standbyCheckTimeout, func(ctx context.Context) error {
+				if _, err := os.Stat(source); err != nil {
+					return err
+				}
+				return mounter.Mount(source, mountPoint, "none", []string{"bind"})
+			})
+			if err != nil {
+				log.Error(err, "switch target error", "target", mountPoint, "source", source)
+				lastErr = fmt.Errorf("switch %s to %s error: %v", mountPoint, source, err)
+				ok = false
+				continue
+			}
+			log.Info("switch target to standby mount pod", "target", mountPoint, "source", source)
+			sendMessage(conn, fmt.Sprintf("switch %s to standby mount pod %s", mountPoint, s.standby.Name))
+		}
+		switched[key] = ok
+	}
+	return switched, lastErr
+}
+
+// moveRefs moves the refs of switched targets to the standby mount pod, and retires the old one after drain if all
+// its targets are switched
+func (s *standbyUpgrade) moveRefs(ctx context.Context, switched map[string]bool, drain time.Duration, switchErr error) error {
+	var moved, remained []string
+	for key := range s.refs {
+		if switched[key] {
+			moved = append(moved, key)
+		} else {
+			remained = append(remained, key)
+		}
+	}
+	if len(remained) != 0 {
+		if err := resource.DelPodAnnotation(ctx, s.client, s.standby.Name, s.standby.Namespace, remained); err != nil {
+			return err
+		}
+	}
+
+	po, err := s.client.GetPod(ctx, s.pod.Name, s.pod.Namespace)
+	if err != nil {
+		return err
+	}
+	annotations := map[string]string{}
+	for k, v := range po.Annotations {
+		annotations[k] = v
+	}
+	for _, key := range moved {
+		delete(annotations, key)
+	}
+	if len(resource.GetAllRefKeys(corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}})) == 0 {
+		// the old mount pod is deleted after drain once it has no refs
+		annotations[common.JfsRetiredByKey] = s.standby.Name
+		annotations[common.DeleteDelayTimeKey] = drain.String()
+		delete(annotations, common.DeleteDelayAtKey)
+	}
+	if err := resource.ReplacePodAnnotation(ctx, s.client, s.pod.Name, s.pod.Namespace, annotations); err != nil {
+		return err
+	}
+	if switchErr != nil {
+		return fmt.Errorf("%d of %d targets are switched, %v", len(moved), len(s.refs), switchErr)
+	}
+	return nil
+}
+
+// mountOf returns the mount on mountPoint in mountinfo, the last one wins if mounted repeatedly
+func mountOf(mis []k8sMount.MountInfo, mountPoint string) *k8sMount.MountInfo {
+	var mi *k8sMount.MountInfo
+	for i := range mis {
+		if mis[i].MountPoint == mountPoint {
+			mi = &mis[i]
+		}
+	}
+	return mi
+}
+
+// targetMounts returns the mount points of target and its subpaths (volumeMount.subPath) in mountinfo, which are
+// bound from the file system of device major:minor on top, with the path in the file system they are bound to
+func targetMounts(mis []k8sMount.MountInfo, target string, major, minor int) map[string]string {
+	subPathPrefix := ""
+	if pair := strings.Split(target, containerCsiDirectory); len(pair) == 2 {
+		pvName := strings.SplitN(pair[1], "/", 2)[0]
+		subPathPrefix = pair[0] + containerSubPathDirectory + pvName + "/"
+	}
+	tops := map[string]k8sMount.MountInfo{}
+	for _, mi := range mis {
+		if mi.MountPoint == target || (subPathPrefix != "" && strings.HasPrefix(mi.MountPoint, subPathPrefix)) {
+			tops[mi.MountPoint] = mi
+		}
+	}
+	mounts := map[string]string{}
+	for mountPoint, mi := range tops {
+		if mi.Major != major || mi.Minor != minor {
+			continue
+		}
+		mounts[mountPoint] = strings.Trim(strings.TrimSuffix(mi.Root, "//deleted"), "/")
+	}
+	return mounts
+}
+
+func TriggerStandbyUpgrade(socketPath string, name string, drain time.Duration) error {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		log.Error(err, "error connecting to socket")
+		return err
+	}
+	defer conn.Close()
+
+	message := fmt.Sprintf("%s %s drain=%s", name, standby, drain)
+	_, err = conn.Write([]byte(message))
+	if err != nil {
+		log.Error(err, "error sending message")
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		message = scanner.Text()
+		fmt.Printf("%s %s\n", time.Now().Format("2006-01-02 15:04:05"), message)
+		if strings.HasPrefix(message, "POD-SUCCESS") || strings.HasPrefix(message, "POD-FAIL") {
+			break
+		}
+	}
+
+	return scanner.Err()
+}
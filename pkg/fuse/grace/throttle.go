@@ -0,0 +1,202 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package grace
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+// ThrottleWatcher watches bandwidth limit annotations of PVCs. Limits can't be changed on a running mount,
+// so mount pods on this node using the volume are recreated smoothly to apply the new limits.
+type ThrottleWatcher struct {
+	client *k8s.K8sClient
+	// queue of namespace/name of PVCs whose limits are changed, recreating mount pods takes a while,
+	// so that events of the informer are never blocked
+	queue workqueue.TypedRateLimitingInterface[string]
+	pvcs  cache.Store
+	// mountPods on this node, only PVCs bound to the volumes they serve are handled
+	mountPods cache.Store
+	// recreate upgrades the mount pod with recreating, replaced in tests
+	recreate func(ctx context.Context, name string) error
+}
+
+func NewThrottleWatcher(client *k8s.K8sClient) *ThrottleWatcher {
+	w := &ThrottleWatcher{
+		client: client,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "throttle"}),
+		pvcs:      cache.NewStore(cache.MetaNamespaceKeyFunc),
+		mountPods: cache.NewStore(cache.MetaNamespaceKeyFunc),
+	}
+	w.recreate = w.recreateMountPod
+	return w
+}
+
+// Run watches PVCs until ctx is done
+func (w *ThrottleWatcher) Run(ctx context.Context) {
+	defer w.queue.ShutDown()
+	labelSelector := labels.SelectorFromSet(labels.Set{common.PodTypeKey: common.PodTypeValue})
+	fieldSelector := fields.OneTermEqualSelector("spec.nodeName", config.NodeName)
+	podList := cache.NewFilteredListWatchFromClient(w.client.CoreV1().RESTClient(), "pods", config.Namespace, func(options *metav1.ListOptions) {
+		options.LabelSelector = labelSelector.String()
+		options.FieldSelector = fieldSelector.String()
+	})
+	var podInformer, pvcInformer cache.Controller
+	w.mountPods, podInformer = cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: podList,
+		ObjectType:    &corev1.Pod{},
+		Handler:       cache.ResourceEventHandlerFuncs{},
+	})
+	pvcList := cache.NewListWatchFromClient(w.client.CoreV1().RESTClient(), "persistentvolumeclaims", metav1.NamespaceAll, fields.Everything())
+	w.pvcs, pvcInformer = cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: pvcList,
+		ObjectType:    &corev1.PersistentVolumeClaim{},
+		Handler: cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldPVC, ok1 := oldObj.(*corev1.PersistentVolumeClaim)
+				newPVC, ok2 := newObj.(*corev1.PersistentVolumeClaim)
+				if ok1 && ok2 && throttleChanged(oldPVC, newPVC) && len(w.mountPodsOf(newPVC.Spec.VolumeName)) != 0 {
+					w.queue.Add(newPVC.Namespace + "/" + newPVC.Name)
+				}
+			},
+		},
+	})
+	go podInformer.Run(ctx.Done())
+	go pvcInformer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), podInformer.HasSynced, pvcInformer.HasSynced) {
+		return
+	}
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for w.processNext(ctx) {
+		}
+	}, time.Second)
+	<-ctx.Done()
+}
+
+// processNext applies the limits of the next PVC in the queue, returns false if the queue is shut down
+func (w *ThrottleWatcher) processNext(ctx context.Context) bool {
+	key, quit := w.queue.Get()
+	if quit {
+		return false
+	}
+	defer w.queue.Done(key)
+	// failures are reported by events, the limits are applied to new mount pods anyway
+	defer w.queue.Forget(key)
+	obj, exists, err := w.pvcs.GetByKey(key)
+	if err != nil || !exists {
+		return true
+	}
+	w.apply(ctx, obj.(*corev1.PersistentVolumeClaim))
+	return true
+}
+
+// throttleChanged checks whether bandwidth limits of a bound PVC are changed
+func throttleChanged(oldPVC, newPVC *corev1.PersistentVolumeClaim) bool {
+	if newPVC.Spec.VolumeName == "" {
+		return false
+	}
+	for _, key := range []string{common.UploadLimitKey, common.DownloadLimitKey} {
+		if oldPVC.Annotations[key] != newPVC.Annotations[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// apply recreates the mount pods of the PVC on this node one by one
+func (w *ThrottleWatcher) apply(ctx context.Context, pvc *corev1.PersistentVolumeClaim) {
+	for _, pod := range w.mountPodsOf(pvc.Spec.VolumeName) {
+		log.Info("bandwidth limits of pvc are changed, recreate mount pod to apply them", "pvc", pvc.Namespace+"/"+pvc.Name, "pod", pod.Name)
+		if err := w.recreate(ctx, pod.Name); err != nil {
+			log.Error(err, "recreate mount pod error", "pod", pod.Name)
+			msg := fmt.Sprintf("bandwidth limits are not applied to mount pod %s on node %s: %v, recreate the application pods to apply them", pod.Name, config.NodeName, err)
+			if e := events.NewRecorder(w.client).Event(ctx, pvc, corev1.EventTypeWarning, events.ReasonThrottleNotApplied, events.ActionThrottle, msg); e != nil {
+				log.Error(e, "create event error", "pvc", pvc.Name)
+			}
+		}
+	}
+}
+
+// mountPodsOf returns the mount pods on this node which serve targets of the PV
+func (w *ThrottleWatcher) mountPodsOf(pvName string) []*corev1.Pod {
+	if pvName == "" {
+		return nil
+	}
+	var matched []*corev1.Pod
+	for _, obj := range w.mountPods.List() {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok || pod.DeletionTimestamp != nil {
+			continue
+		}
+		for k, v := range pod.Annotations {
+			// targets are like <kubelet-dir>/pods/<pod-uid>/volumes/kubernetes.io~csi/<pv-name>/mount
+			if k == util.GetReferenceKey(v) && strings.Contains(v, "/"+pvName+"/") {
+				matched = append(matched, pod)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// recreateMountPod upgrades the mount pod with recreating, and returns error if the upgrade fails
+func (w *ThrottleWatcher) recreateMountPod(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, singleUpgradeTimeout)
+	defer cancel()
+	server, conn := net.Pipe()
+	go func() {
+		defer server.Close()
+		SinglePodUpgrade(ctx, w.client, name, true, server)
+	}()
+
+	var result string
+	scanner := bufio.NewScanner(conn)
+	// read all the messages, or the upgrade is blocked
+	for scanner.Scan() {
+		message := scanner.Text()
+		log.V(1).Info("upgrade message", "pod", name, "message", message)
+		if strings.HasPrefix(message, "POD-SUCCESS") || strings.HasPrefix(message, "POD-FAIL") {
+			result = message
+		}
+	}
+	switch {
+	case strings.HasPrefix(result, "POD-SUCCESS"):
+		return nil
+	case result != "":
+		return fmt.Errorf("%s", result)
+	}
+	return fmt.Errorf("upgrade is not finished")
+}
@@ -0,0 +1,79 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package grace
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+func TestThrottleWatcher(t *testing.T) {
+	config.Namespace, config.NodeName = "kube-system", "node-1"
+	defer func() { config.Namespace, config.NodeName = "", "" }()
+
+	mountPod := func(name, pvName string) *corev1.Pod {
+		target := fmt.Sprintf("/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/%s/mount", pvName)
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   config.Namespace,
+			Labels:      map[string]string{common.PodTypeKey: common.PodTypeValue},
+			Annotations: map[string]string{util.GetReferenceKey(target): target},
+		}}
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-1"},
+	}
+	throttled := pvc.DeepCopy()
+	throttled.Annotations = map[string]string{common.UploadLimitKey: "100"}
+	assert.True(t, throttleChanged(pvc, throttled))
+	assert.False(t, throttleChanged(throttled, throttled.DeepCopy()))
+
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset()}
+	w := NewThrottleWatcher(client)
+	defer w.queue.ShutDown()
+	// mount pods on this node, synced by the informer
+	assert.NoError(t, w.mountPods.Add(mountPod("juicefs-pv-1", "pv-1")))
+	assert.NoError(t, w.mountPods.Add(mountPod("juicefs-pv-2", "pv-2")))
+	assert.Empty(t, w.mountPodsOf("pv-3"), "pvcs of volumes not on this node are ignored")
+	var recreated []string
+	w.recreate = func(ctx context.Context, name string) error {
+		recreated = append(recreated, name)
+		return fmt.Errorf("POD-FAIL [%s] can not upgrade", name)
+	}
+	assert.NoError(t, w.pvcs.Add(throttled))
+	w.queue.Add("default/data")
+	assert.True(t, w.processNext(context.TODO()))
+	assert.Equal(t, []string{"juicefs-pv-1"}, recreated)
+	assert.Equal(t, 0, w.queue.Len())
+
+	events, err := client.CoreV1().Events("default").List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, events.Items, 1)
+	assert.Equal(t, "ThrottleNotApplied", events.Items[0].Reason)
+}
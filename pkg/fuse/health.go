@@ -0,0 +1,164 @@
+/*
+ Copyright 2023 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package fuse holds what CSI Node needs from the kernel FUSE module of the node: health checks of the module,
+// passing FUSE fds to mount pods, and the graceful shutdown of mount pods.
+package fuse
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// checks of the node for FUSE mounts, the names are used in metrics and events. CheckMaxUserInstances is
+// an inotify limit of the kernel rather than a FUSE one, which mounts run out of on the node all the same
+const (
+	CheckDevice           = "device"
+	CheckModule           = "module"
+	CheckMaxUserInstances = "max_user_instances"
+	CheckMaxBackground    = "max_background"
+)
+
+// Checks are all the checks done by Checker
+var Checks = []string{CheckDevice, CheckModule, CheckMaxUserInstances, CheckMaxBackground}
+
+const (
+	// defaultMaxBackground is FUSE_DEFAULT_MAX_BACKGROUND of the kernel, background requests of a FUSE connection
+	defaultMaxBackground = 12
+	// defaultExpectedMounts is the default max pods of kubelet
+	defaultExpectedMounts = 110
+)
+
+// Problem is a failed check of the FUSE module
+type Problem struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// Health is the result of checking the FUSE module, it's healthy without problems
+type Health struct {
+	Problems []Problem `json:"problems,omitempty"`
+}
+
+func (h *Health) Healthy() bool {
+	return len(h.Problems) == 0
+}
+
+func (h *Health) String() string {
+	if h.Healthy() {
+		return "healthy"
+	}
+	msgs := make([]string, 0, len(h.Problems))
+	for _, p := range h.Problems {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", p.Check, p.Message))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Checker checks if the kernel FUSE module of the node can serve the mounts expected on it
+type Checker interface {
+	Check() *Health
+}
+
+// NewChecker returns the Checker of the node, expectedMounts is the number of mount pods the node is expected to run,
+// which fs.inotify.max_user_instances is checked against, the default max pods of kubelet if not positive
+func NewChecker(expectedMounts int) Checker {
+	if expectedMounts <= 0 {
+		expectedMounts = defaultExpectedMounts
+	}
+	return &nodeChecker{
+		device:           "/dev/fuse",
+		filesystems:      "/proc/filesystems",
+		maxUserInstances: "/proc/sys/fs/inotify/max_user_instances",
+		maxUserBgreq:     "/sys/module/fuse/parameters/max_user_bgreq",
+		expectedMounts:   expectedMounts,
+	}
+}
+
+type nodeChecker struct {
+	device, filesystems, maxUserInstances, maxUserBgreq string
+	expectedMounts                                      int
+}
+
+func (c *nodeChecker) Check() *Health {
+	h := &Health{}
+	problem := func(check, format string, args ...interface{}) {
+		h.Problems = append(h.Problems, Problem{Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+	if err := c.checkDevice(); err != nil {
+		problem(CheckDevice, "%v", err)
+	}
+	if loaded, err := c.moduleLoaded(); err != nil {
+		problem(CheckModule, "%v", err)
+	} else if !loaded {
+		problem(CheckModule, "fuse is not in %s, load the module by `modprobe fuse`", c.filesystems)
+	}
+	// every mount pod adds containers to the node, which take inotify instances of kubelet and the container
+	// runtime, new containers fail with "too many open files" once they run out
+	if n, err := readInt(c.maxUserInstances); err != nil {
+		problem(CheckMaxUserInstances, "%v", err)
+	} else if n < c.expectedMounts {
+		problem(CheckMaxUserInstances, "fs.inotify.max_user_instances %d is less than the %d mounts expected on the node", n, c.expectedMounts)
+	}
+	// unprivileged (rootless) mounts can't have more background requests than the module allows,
+	// the parameter is missing if the module is not loaded, which is reported above
+	if n, err := readInt(c.maxUserBgreq); err == nil && n < defaultMaxBackground {
+		problem(CheckMaxBackground, "max_user_bgreq %d of the fuse module is less than the default max_background %d", n, defaultMaxBackground)
+	}
+	return h
+}
+
+func (c *nodeChecker) checkDevice() error {
+	fi, err := os.Stat(c.device)
+	if err != nil {
+		return fmt.Errorf("%v, load the module by `modprobe fuse`", err)
+	}
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("%s is not a character device", c.device)
+	}
+	f, err := os.OpenFile(c.device, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (c *nodeChecker) moduleLoaded() (bool, error) {
+	f, err := os.Open(c.filesystems)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[len(fields)-1] == "fuse" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func readInt(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
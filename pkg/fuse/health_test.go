@@ -0,0 +1,68 @@
+/*
+ Copyright 2024 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package fuse
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNodeChecker(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	c := &nodeChecker{
+		device:           "/dev/null",
+		filesystems:      write("filesystems", "nodev\tsysfs\nnodev\tproc\n\text4\nnodev\tfuse\n\tfuseblk\nnodev\tfusectl\n"),
+		maxUserInstances: write("max_user_instances", "128\n"),
+		maxUserBgreq:     write("max_user_bgreq", "1618\n"),
+		expectedMounts:   110,
+	}
+	if h := c.Check(); !h.Healthy() {
+		t.Errorf("Check() = %s, want healthy", h)
+	}
+
+	c.device = write("fuse", "")
+	c.filesystems = write("filesystems", "nodev\tsysfs\n\text4\n\tfuseblk\nnodev\tfusectl\n")
+	c.expectedMounts = 250
+	write("max_user_bgreq", "8\n")
+	var checks []string
+	for _, p := range c.Check().Problems {
+		checks = append(checks, p.Check)
+	}
+	if want := []string{CheckDevice, CheckModule, CheckMaxUserInstances, CheckMaxBackground}; !reflect.DeepEqual(checks, want) {
+		t.Errorf("Check() problems = %v, want %v", checks, want)
+	}
+
+	// the parameters of the module are missing if it's not loaded
+	c.device = filepath.Join(dir, "missing")
+	c.maxUserBgreq = filepath.Join(dir, "missing")
+	checks = nil
+	for _, p := range c.Check().Problems {
+		checks = append(checks, p.Check)
+	}
+	if want := []string{CheckDevice, CheckModule, CheckMaxUserInstances}; !reflect.DeepEqual(checks, want) {
+		t.Errorf("Check() problems = %v, want %v", checks, want)
+	}
+}
@@ -275,11 +275,41 @@ type fd struct {
 	fuseFd      int
 	fuseSetting []byte
 	sid         uint64
+	owner       *[2]int // uid and gid of rootless mount pods, which need to own the socket to connect to it
 
 	serverAddress      string // server for pod
 	serverAddressInPod string // server path in pod
 }
 
+// MountFuse mounts FUSE at mountPath for the rootless mount pod, which can't open /dev/fuse or mount by itself.
+// The fuse fd is handed over when the pod connects to the fd socket, the mount point is owned by uid and gid.
+func (fs *Fds) MountFuse(ctx context.Context, pod *corev1.Pod, name, mountPath string, uid, gid int64) error {
+	upgradeUUID := resource.GetUpgradeUUID(pod)
+	fs.globalMu.Lock()
+	f := fs.fds[upgradeUUID]
+	fs.globalMu.Unlock()
+	if f == nil {
+		return fmt.Errorf("fuse fd of upgradeUUID %s not found in global fuse fds", upgradeUUID)
+	}
+
+	fuseFd, err := syscall.Open("/dev/fuse", syscall.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("open /dev/fuse: %v", err)
+	}
+	data := fmt.Sprintf("fd=%d,rootmode=40000,user_id=%d,group_id=%d,allow_other", fuseFd, uid, gid)
+	if err := syscall.Mount("JuiceFS:"+name, mountPath, "fuse.juicefs", syscall.MS_NOSUID|syscall.MS_NODEV, data); err != nil {
+		_ = syscall.Close(fuseFd)
+		return fmt.Errorf("mount fuse at %s: %v", mountPath, err)
+	}
+	fdLog.V(1).Info("mount fuse for rootless pod", "fd", fuseFd, "mountPath", mountPath, "pod", pod.Name)
+
+	fs.globalMu.Lock()
+	f.fuseFd = fuseFd
+	f.owner = &[2]int{int(uid), int(gid)}
+	fs.globalMu.Unlock()
+	return nil
+}
+
 func (fs *Fds) ServeFuseFd(ctx context.Context, pod *corev1.Pod) error {
 	upgradeUUID := resource.GetUpgradeUUID(pod)
 	if _, ok := fs.fds[upgradeUUID]; ok {
@@ -305,6 +335,11 @@ func (fs *Fds) serveFuseFD(ctx context.Context, upgradeUUID string) {
 		fdLog.Error(err, "listen unix socket error")
 		return
 	}
+	if f.owner != nil {
+		if err := os.Chown(f.serverAddress, f.owner[0], f.owner[1]); err != nil {
+			fdLog.Error(err, "chown unix socket error", "server address", f.serverAddress)
+		}
+	}
 	go func() {
 		defer func() {
 			_ = util.DoWithTimeout(ctx, 2*time.Second, func(ctx context.Context) error {
@@ -18,10 +18,12 @@ package juicefs
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -33,12 +35,14 @@ import (
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/klog/v2"
 	k8sexec "k8s.io/utils/exec"
 	"k8s.io/utils/mount"
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
 	podmount "github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
@@ -54,20 +58,33 @@ const (
 
 var jfsLog = klog.NewKlogr().WithName("juicefs")
 
+var statusUUIDRegexp = regexp.MustCompile(`"UUID": "(.*)"`)
+
+// ErrMountLimitExceeded is returned by JfsMount if the file system is mounted on too many nodes
+var ErrMountLimitExceeded = errors.New("mount limit exceeded")
+
 // Interface of juicefs provider
 type Interface interface {
 	mount.Interface
 	JfsMount(ctx context.Context, volumeID string, target string, secrets, volCtx map[string]string, options []string) (Jfs, error)
 	JfsCreateVol(ctx context.Context, volumeID string, subPath string, secrets, volCtx map[string]string) error
+	JfsFormatVol(ctx context.Context, volumeID string, secrets, volCtx map[string]string) error
 	JfsDeleteVol(ctx context.Context, volumeID string, target string, secrets, volCtx map[string]string, options []string) error
+	JfsDeleteSubPath(ctx context.Context, volumeID string, subPath string, secrets, volCtx map[string]string, options []string) error
+	JfsCloneVol(ctx context.Context, volumeID string, srcSubPath, dstSubPath string, secrets, volCtx map[string]string) error
+	JfsDeleteSnapshot(ctx context.Context, snapshotID string, snapshotPath string, secrets map[string]string) error
+	JfsListSubdirs(ctx context.Context, volumeID string, secrets, volCtx map[string]string, options []string) ([]podmount.Subdir, error)
 	JfsUnmount(ctx context.Context, volumeID, mountPath string) error
 	JfsCleanupMountPoint(ctx context.Context, mountPath string) error
 	SetQuota(ctx context.Context, secrets map[string]string, jfsSetting *config.JfsSetting, quotaPath string, capacity int64) error
+	GetQuota(ctx context.Context, secrets map[string]string, jfsSetting *config.JfsSetting, quotaPath string) (int64, error)
 	Settings(ctx context.Context, volumeID, uniqueId, uuid string, secrets, volCtx map[string]string, options []string) (*config.JfsSetting, error)
 	GetSubPath(ctx context.Context, volumeID string) (string, error)
 	CreateTarget(ctx context.Context, target string) error
 	AuthFs(ctx context.Context, secrets map[string]string, jfsSetting *config.JfsSetting, force bool) (string, error)
-	Status(ctx context.Context, metaUrl string) error
+	Status(ctx context.Context, metaUrl string, envs map[string]string) error
+	JfsFormatDrift(ctx context.Context, secrets map[string]string, reconcile bool) ([]config.FormatDrift, error)
+	JfsListSessions(ctx context.Context, secrets map[string]string) ([]Session, error)
 }
 
 type juicefs struct {
@@ -107,7 +124,8 @@ func (fs *jfs) GetBasePath() string {
 // CreateVol creates the directory needed
 func (fs *jfs) CreateVol(ctx context.Context, volumeID, subPath string) (string, error) {
 	log := util.GenLog(ctx, jfsLog, "CreateVol")
-	if !config.StorageClassShareMount && !config.ByProcess {
+	if fs.Setting != nil && fs.Setting.SubdirMount() || fs.Setting == nil && !config.StorageClassShareMount && !config.ByProcess {
+		// only the subPath is mounted
 		return fs.MountPath, nil
 	}
 	volPath := filepath.Join(fs.MountPath, subPath)
@@ -119,6 +137,15 @@ func (fs *jfs) CreateVol(ctx context.Context, volumeID, subPath string) (string,
 	}); err != nil {
 		return "", fmt.Errorf("could not check volume path %q exists: %v", volPath, err)
 	}
+	if !exists && config.AdminByJob && !config.ByProcess && fs.Provider != nil && fs.Setting != nil {
+		log.Info("volume not existed, create it in job")
+		setting := *fs.Setting
+		setting.SubPath = subPath
+		if err := fs.Provider.mnt.JCreateVolume(ctx, &setting); err != nil {
+			return "", fmt.Errorf("could not create volume path %q in job: %v", subPath, err)
+		}
+		return volPath, nil
+	}
 	if !exists {
 		log.Info("volume not existed")
 		if err := util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) (err error) {
@@ -146,42 +173,57 @@ func (fs *jfs) CreateVol(ctx context.Context, volumeID, subPath string) (string,
 
 func (fs *jfs) BindTarget(ctx context.Context, bindSource, target string) error {
 	log := util.GenLog(ctx, jfsLog, "BindTarget")
-	mountInfos, err := mount.ParseMountInfo(procMountInfoPath)
-	if err != nil {
-		return err
-	}
-	var mountMinor, targetMinor *int
-	for _, mi := range mountInfos {
-		if mi.MountPoint == fs.MountPath {
-			minor := mi.Minor
-			mountMinor = &minor
+	for attempt := 0; ; attempt++ {
+		mountInfos, err := mount.ParseMountInfo(procMountInfoPath)
+		if err != nil {
+			return err
 		}
-		if mi.MountPoint == target {
-			targetMinor = &mi.Minor
+		var mountMinor, targetMinor *int
+		// mounts stacked at target, left by previous incarnations of the pod
+		targetMounts := 0
+		for _, mi := range mountInfos {
+			if mi.MountPoint == fs.MountPath {
+				minor := mi.Minor
+				mountMinor = &minor
+			}
+			if mi.MountPoint == target {
+				minor := mi.Minor
+				targetMinor = &minor
+				targetMounts++
+			}
 		}
-	}
-	if mountMinor == nil {
-		return fmt.Errorf("BindTarget: mountPath %s not mounted", fs.MountPath)
-	}
-	if targetMinor != nil {
-		if *targetMinor == *mountMinor {
-			// target already binded mountpath
-			log.V(1).Info("target already bind mounted.", "target", target, "mountPath", fs.MountPath)
+		if mountMinor == nil {
+			return fmt.Errorf("BindTarget: mountPath %s not mounted", fs.MountPath)
+		}
+		if targetMinor != nil {
+			if *targetMinor == *mountMinor {
+				// target already binded mountpath
+				log.V(1).Info("target already bind mounted.", "target", target, "mountPath", fs.MountPath)
+				return nil
+			}
+			// target is bind by other path, umount all the stale mounts
+			log.Info("target bind mount to other path, umount it", "target", target, "mounts", targetMounts)
+			for i := 0; i < targetMounts; i++ {
+				_ = util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) error {
+					return util.UmountPath(ctx, target, false)
+				})
+			}
+		}
+		// bind target to mountpath
+		log.Info("binding source at target", "source", bindSource, "target", target)
+		err = fs.Provider.Mount(bindSource, target, fsTypeNone, []string{"bind"})
+		if err == nil {
 			return nil
 		}
-		// target is bind by other path, umount it
-		log.Info("target bind mount to other path, umount it", "target", target)
-		_ = util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) error {
-			return util.UmountPath(ctx, target, false)
-		})
-	}
-	// bind target to mountpath
-	log.Info("binding source at target", "source", bindSource, "target", target)
-	if err := fs.Provider.Mount(bindSource, target, fsTypeNone, []string{"bind"}); err != nil {
-		os.Remove(target)
-		return err
+		if !isTargetBusy(err) || attempt >= config.TargetRetryTimes {
+			os.Remove(target)
+			return err
+		}
+		log.Info("target is busy, retry", "target", target, "attempt", attempt+1, "error", err)
+		if err := waitTargetRetry(ctx); err != nil {
+			return err
+		}
 	}
-	return nil
 }
 
 func (fs *jfs) GetSetting() *config.JfsSetting {
@@ -236,10 +278,22 @@ func (j *juicefs) JfsDeleteVol(ctx context.Context, volumeID string, subPath str
 		volCtx = pv.Spec.CSI.VolumeAttributes
 		options = pv.Spec.MountOptions
 	}
+	return j.deleteVol(ctx, volumeID, subPath, secrets, volCtx, options)
+}
+
+// JfsDeleteSubPath deletes subPath with the given volume context and mount options, for directories without a PV
+func (j *juicefs) JfsDeleteSubPath(ctx context.Context, volumeID string, subPath string, secrets, volCtx map[string]string, options []string) error {
+	return j.deleteVol(ctx, volumeID, subPath, secrets, volCtx, options)
+}
+
+func (j *juicefs) deleteVol(ctx context.Context, volumeID string, subPath string, secrets, volCtx map[string]string, options []string) error {
 	jfsSetting, err := j.genJfsSettings(ctx, volumeID, "", secrets, volCtx, options)
 	if err != nil {
 		return err
 	}
+	if jfsSetting.BucketPerVolume && jfsSetting.IsCe {
+		return j.destroyVol(ctx, jfsSetting)
+	}
 	jfsSetting.SubPath = subPath
 	jfsSetting.MountPath = filepath.Join(config.TmpPodMountBase, jfsSetting.VolumeId)
 
@@ -249,6 +303,100 @@ func (j *juicefs) JfsDeleteVol(ctx context.Context, volumeID string, subPath str
 	return j.JfsCleanupMountPoint(ctx, jfsSetting.MountPath)
 }
 
+// destroyVol destroys the dedicated file system of the volume, both its objects and metadata are deleted
+func (j *juicefs) destroyVol(ctx context.Context, jfsSetting *config.JfsSetting) error {
+	log := util.GenLog(ctx, jfsLog, "destroyVol")
+	cmdCtx, cmdCancel := context.WithTimeout(ctx, 8*defaultCheckTimeout)
+	defer cmdCancel()
+	envs := syscall.Environ()
+	for key, val := range jfsSetting.Envs {
+		envs = append(envs, fmt.Sprintf("%s=%s", security.EscapeBashStr(key), security.EscapeBashStr(val)))
+	}
+	out, err := j.Exec.CommandContext(cmdCtx, config.CeCliPath, "status", jfsSetting.MetaUrl).CombinedOutput()
+	res := string(out)
+	if err != nil {
+		if strings.Contains(res, "database is not formatted") {
+			log.Info("file system of volume is never formatted, nothing to destroy", "volumeId", jfsSetting.VolumeId)
+			return nil
+		}
+		return errors.Wrap(err, res)
+	}
+	matches := statusUUIDRegexp.FindStringSubmatch(res)
+	if len(matches) < 2 {
+		return fmt.Errorf("get uuid of file system %s error: %s", jfsSetting.Name, res)
+	}
+	log.Info("destroy file system of volume", "volumeId", jfsSetting.VolumeId, "name", jfsSetting.Name, "uuid", matches[1])
+	// deleting objects may take long, not limited by the timeout of status
+	destroyCmd := j.Exec.CommandContext(ctx, config.CeCliPath, "destroy", "--yes", jfsSetting.MetaUrl, matches[1])
+	destroyCmd.SetEnv(envs)
+	if res, err := destroyCmd.CombinedOutput(); err != nil {
+		return errors.Wrap(err, string(res))
+	}
+	return nil
+}
+
+// JfsFormatVol formats the dedicated file system of the volume when it's provisioned, see config.BucketPerVolume,
+// so that the volume is ready before it's used. Only community edition is supported.
+func (j *juicefs) JfsFormatVol(ctx context.Context, volumeID string, secrets, volCtx map[string]string) error {
+	volSecrets, err := config.VolumeSecrets(secrets, volumeID)
+	if err != nil {
+		return err
+	}
+	volSecrets = config.VolumeFormatSecrets(volSecrets, volCtx)
+	jfsSetting, err := config.ParseSetting(ctx, volSecrets, volCtx, nil, volumeID, volumeID, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := j.ceFormat(ctx, volSecrets, false, jfsSetting, true); err != nil {
+		return fmt.Errorf("juicefs format error: %v", err)
+	}
+	return nil
+}
+
+// JfsCloneVol clones srcSubPath into dstSubPath in the file system, volumeID is only used to name the job or mount point,
+// so it must be unique among file systems.
+func (j *juicefs) JfsCloneVol(ctx context.Context, volumeID string, srcSubPath, dstSubPath string, secrets, volCtx map[string]string) error {
+	jfsSetting, err := j.genJfsSettings(ctx, volumeID, "", secrets, volCtx, []string{})
+	if err != nil {
+		return err
+	}
+	jfsSetting.SubPath = dstSubPath
+	jfsSetting.MountPath = filepath.Join(config.TmpPodMountBase, jfsSetting.VolumeId)
+	if err := j.mnt.JCloneVolume(ctx, jfsSetting, srcSubPath); err != nil {
+		return err
+	}
+	return j.JfsCleanupMountPoint(ctx, jfsSetting.MountPath)
+}
+
+// JfsDeleteSnapshot deletes the directory of snapshot, there is no PV behind a snapshot,
+// so the settings come from the snapshotter secrets only. snapshotID names the job or mount point like volumeID of JfsCloneVol.
+func (j *juicefs) JfsDeleteSnapshot(ctx context.Context, snapshotID string, snapshotPath string, secrets map[string]string) error {
+	jfsSetting, err := j.genJfsSettings(ctx, snapshotID, "", secrets, nil, []string{})
+	if err != nil {
+		return err
+	}
+	jfsSetting.SubPath = snapshotPath
+	jfsSetting.MountPath = filepath.Join(config.TmpPodMountBase, jfsSetting.VolumeId)
+	if err := j.mnt.JDeleteVolume(ctx, jfsSetting); err != nil {
+		return err
+	}
+	return j.JfsCleanupMountPoint(ctx, jfsSetting.MountPath)
+}
+
+// JfsListSubdirs lists the top-level directories of the file system, volumeID is only used to name the job or mount point.
+func (j *juicefs) JfsListSubdirs(ctx context.Context, volumeID string, secrets, volCtx map[string]string, options []string) ([]podmount.Subdir, error) {
+	jfsSetting, err := j.genJfsSettings(ctx, volumeID, "", secrets, volCtx, options)
+	if err != nil {
+		return nil, err
+	}
+	jfsSetting.MountPath = filepath.Join(config.TmpPodMountBase, jfsSetting.VolumeId)
+	subdirs, err := j.mnt.JListSubdirs(ctx, jfsSetting)
+	if err != nil {
+		return nil, err
+	}
+	return subdirs, j.JfsCleanupMountPoint(ctx, jfsSetting.MountPath)
+}
+
 func (j *juicefs) JfsMount(ctx context.Context, volumeID string, target string, secrets, volCtx map[string]string, options []string) (Jfs, error) {
 	if err := j.validTarget(target); err != nil {
 		return nil, err
@@ -257,6 +405,12 @@ func (j *juicefs) JfsMount(ctx context.Context, volumeID string, target string,
 	if err != nil {
 		return nil, err
 	}
+	if err := j.downgradeMountOptions(ctx, jfsSetting); err != nil {
+		return nil, err
+	}
+	if err := j.checkMountLimit(ctx, jfsSetting); err != nil {
+		return nil, err
+	}
 	appInfo, err := config.ParseAppInfo(volCtx)
 	if err != nil {
 		return nil, err
@@ -275,6 +429,73 @@ func (j *juicefs) JfsMount(ctx context.Context, volumeID string, target string,
 	}, nil
 }
 
+// downgradeMountOptions drops or translates the mount options unsupported by the client in the mount image,
+// so that the mount pod does not crash on unknown flags. It fails if an unsupported option can not be downgraded.
+func (j *juicefs) downgradeMountOptions(ctx context.Context, jfsSetting *config.JfsSetting) error {
+	if config.ByProcess || !jfsSetting.IsCe {
+		return nil
+	}
+	log := util.GenLog(ctx, jfsLog, "downgradeMountOptions")
+	options, changed, err := util.DowngradeMountOptions(jfsSetting.Attr.Image, jfsSetting.Options)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	jfsSetting.Options = options
+	msg := fmt.Sprintf("mount options %s are not supported by the client in image %s, downgraded",
+		strings.Join(changed, ", "), jfsSetting.Attr.Image)
+	log.Info(msg, "volumeId", jfsSetting.VolumeId)
+	if j.K8sClient == nil {
+		return nil
+	}
+	var obj runtime.Object
+	if jfsSetting.PVC != nil {
+		obj = jfsSetting.PVC
+	} else if jfsSetting.PV != nil {
+		obj = jfsSetting.PV
+	} else {
+		return nil
+	}
+	if err := events.NewRecorder(j.K8sClient).Event(ctx, obj, corev1.EventTypeWarning, events.ReasonMountOptionsDowngraded, events.ActionMount, msg); err != nil {
+		log.Error(err, "record event error")
+	}
+	return nil
+}
+
+// checkMountLimit refuses to mount if the file system is already mounted on as many nodes as the limit
+// in mountLimits of global config. The nodes are counted by the mount pods, so it only works in mount pod mode.
+// It's a best-effort guardrail, nodes mounting at the same time may exceed the limit.
+func (j *juicefs) checkMountLimit(ctx context.Context, jfsSetting *config.JfsSetting) error {
+	maxNodes := config.GlobalConfig.MaxMountNodes(jfsSetting.Name)
+	if maxNodes <= 0 || config.ByProcess || config.Webhook || j.K8sClient == nil {
+		return nil
+	}
+	log := util.GenLog(ctx, jfsLog, "checkMountLimit")
+	labelSelector := &metav1.LabelSelector{MatchLabels: map[string]string{common.PodTypeKey: common.PodTypeValue}}
+	pods, err := j.K8sClient.ListPod(ctx, config.Namespace, labelSelector, nil)
+	if err != nil {
+		return fmt.Errorf("list mount pods to check mount limit: %v", err)
+	}
+	nodes := make(map[string]bool)
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Annotations[common.JuiceFSUUID] != jfsSetting.UUID {
+			continue
+		}
+		nodes[pod.Spec.NodeName] = true
+	}
+	if nodes[config.NodeName] {
+		return nil
+	}
+	if len(nodes) >= maxNodes {
+		return fmt.Errorf("%w: file system %s is already mounted on %d nodes, reaching the limit %d, refuse to mount on node %s",
+			ErrMountLimitExceeded, jfsSetting.Name, len(nodes), maxNodes, config.NodeName)
+	}
+	log.V(1).Info("mount limit checked", "name", jfsSetting.Name, "nodes", len(nodes), "maxNodes", maxNodes)
+	return nil
+}
+
 // Settings get all jfs settings and generate format/auth command
 // do format/auth only in process mode
 // volumeID: volumeHandle of PV
@@ -289,6 +510,13 @@ func (j *juicefs) Settings(ctx context.Context, volumeID, uniqueId, uuid string,
 	if err != nil {
 		log.Error(err, "Get PV with volumeID error", "volumeId", volumeID)
 	}
+	if config.BucketPerVolume(volCtx) {
+		// the dedicated file system of the volume, used by format in process mode as well
+		if secrets, err = config.VolumeSecrets(secrets, volumeID); err != nil {
+			return nil, err
+		}
+		secrets = config.VolumeFormatSecrets(secrets, volCtx)
+	}
 	// overwrite volCtx with pvc annotations
 	if pvc != nil {
 		if volCtx == nil {
@@ -307,6 +535,13 @@ func (j *juicefs) Settings(ctx context.Context, volumeID, uniqueId, uuid string,
 		log.Error(err, "Parse config error", "secret", secrets["name"])
 		return nil, err
 	}
+	if pvc != nil && config.NamespaceMetadataPropagated() && j.K8sClient != nil {
+		if ns, err := j.K8sClient.CoreV1().Namespaces().Get(ctx, pvc.Namespace, metav1.GetOptions{}); err != nil {
+			log.Error(err, "Get namespace of pvc error", "namespace", pvc.Namespace)
+		} else {
+			config.PropagateNamespaceMetadata(jfsSetting, ns)
+		}
+	}
 
 	if jfsSetting.FormatCmd != "" {
 		log.Info("Format/Auth command", "cmd", jfsSetting.FormatCmd)
@@ -331,7 +566,7 @@ func (j *juicefs) Settings(ctx context.Context, volumeID, uniqueId, uuid string,
 				log.Info("JfsMount: storage or bucket is empty, format --no-update.")
 				noUpdate = true
 			}
-			_, err := j.ceFormat(ctx, secrets, noUpdate, jfsSetting)
+			_, err := j.ceFormat(ctx, secrets, noUpdate, jfsSetting, false)
 			if err != nil {
 				return nil, fmt.Errorf("juicefs format error: %v", err)
 			}
@@ -391,12 +626,19 @@ func (j *juicefs) getUniqueId(ctx context.Context, volumeId string) (string, err
 		// In dynamic provision, PV.spec.StorageClassName is which SC(StorageClass) it belongs to.
 		// if SC has template secrets, UniqueId set as volumeId
 		if err == nil && pv.Spec.StorageClassName != "" {
-			if sc, err := j.K8sClient.GetStorageClass(ctx, pv.Spec.StorageClassName); err != nil {
+			if pv.Spec.CSI != nil && pv.Spec.CSI.VolumeAttributes[common.MountStrategyKey] == config.MountStrategySubdir {
+				log.V(1).Info("volume is mounted with subdir, cannot use `STORAGE_CLASS_SHARE_MOUNT`", "volumeId", volumeId)
+				return volumeId, nil
+			}
+			if pv.Spec.CSI != nil && config.BucketPerVolume(pv.Spec.CSI.VolumeAttributes) {
+				log.V(1).Info("volume has a dedicated file system, cannot use `STORAGE_CLASS_SHARE_MOUNT`", "volumeId", volumeId)
+				return volumeId, nil
+			}
+			if params, err := resource.StorageClassParameters(ctx, j.K8sClient, pv); err != nil {
 				log.Error(err, "Get storage class error", "sc", pv.Spec.StorageClassName)
 				return "", err
 			} else {
-				secret := sc.Parameters[common.PublishSecretName]
-				secretNamespace := sc.Parameters[common.PublishSecretNamespace]
+				secret, secretNamespace := config.StorageClassSecret(params, config.SecretOpNodePublish)
 				if strings.Contains(secret, "$") || strings.Contains(secretNamespace, "$") {
 					log.Info("storageClass has template secrets, cannot use `STORAGE_CLASS_SHARE_MOUNT`", "volumeId", volumeId)
 					return volumeId, nil
@@ -422,13 +664,7 @@ func (j *juicefs) validTarget(target string) error {
 		// do not check target when by process, because it may not in kubernetes
 		return nil
 	}
-	kubeletDir := "/var/lib/kubelet"
-	for _, v := range config.CSIPod.Spec.Volumes {
-		if v.Name == "kubelet-dir" {
-			kubeletDir = v.HostPath.Path
-			break
-		}
-	}
+	kubeletDir := config.KubeletRootDir
 	dirs := strings.Split(target, "/pods/")
 	if len(dirs) == 0 {
 		return fmt.Errorf("can't parse kubelet rootdir from target %s", target)
@@ -543,24 +779,53 @@ func (j *juicefs) JfsUnmount(ctx context.Context, volumeId, mountPath string) er
 }
 
 func (j *juicefs) CreateTarget(ctx context.Context, target string) error {
-	var corruptedMnt bool
-
-	for {
+	log := util.GenLog(ctx, jfsLog, "CreateTarget")
+	for attempt := 0; ; attempt++ {
 		err := util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) (err error) {
 			_, err = mount.PathExists(target)
 			return
 		})
 		if err == nil {
-			return os.MkdirAll(target, os.FileMode(0755))
-		} else if corruptedMnt = mount.IsCorruptedMnt(err); corruptedMnt {
+			err = os.MkdirAll(target, os.FileMode(0755))
+			if err == nil || !isTargetBusy(err) {
+				return err
+			}
+		} else if mount.IsCorruptedMnt(err) {
 			// if target is a corrupted mount, umount it
+			log.Info("target is a corrupted mount, umount it", "target", target, "error", err)
 			_ = util.DoWithTimeout(ctx, defaultCheckTimeout*2, func(ctx context.Context) error {
 				return util.UmountPath(ctx, target, false)
 			})
-			continue
 		} else {
 			return err
 		}
+		if attempt >= config.TargetRetryTimes {
+			return fmt.Errorf("could not create target %s after %d retries: %v", target, attempt, err)
+		}
+		log.Info("target is not ready, retry", "target", target, "attempt", attempt+1, "error", err)
+		if err := waitTargetRetry(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// isTargetBusy checks if the error is caused by the target being in use, e.g. still unmounting for the previous pod,
+// which usually goes away in a while
+func isTargetBusy(err error) bool {
+	if errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ENOTEMPTY) {
+		return true
+	}
+	// errors of mount command are returned as its output
+	msg := err.Error()
+	return strings.Contains(msg, "busy") || strings.Contains(msg, "not empty")
+}
+
+func waitTargetRetry(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(config.TargetRetryInterval):
+		return nil
 	}
 }
 
@@ -612,21 +877,34 @@ func (j *juicefs) AuthFs(ctx context.Context, secrets map[string]string, setting
 	return string(res), nil
 }
 
+// QuotaBytes returns the capacity quota set by SetQuota for the capacity in bytes, the juicefs CLI sets
+// the quota in whole GiB, so the capacity is rounded up to GiB, e.g. 1GiB for 100MiB
+func QuotaBytes(capacity int64) int64 {
+	return quotaGiB(capacity) << 30
+}
+
+func quotaGiB(capacity int64) int64 {
+	return (capacity + 1<<30 - 1) >> 30
+}
+
+// SetQuota sets the capacity quota of the path, see QuotaBytes
 func (j *juicefs) SetQuota(ctx context.Context, secrets map[string]string, jfsSetting *config.JfsSetting, quotaPath string, capacity int64) error {
 	log := util.GenLog(ctx, jfsLog, "SetQuota")
-	cap := capacity / 1024 / 1024 / 1024
+	cap := quotaGiB(capacity)
 	if cap <= 0 {
-		return fmt.Errorf("capacity %d is too small, at least 1GiB for quota", capacity)
+		return fmt.Errorf("invalid capacity %d for quota", capacity)
 	}
 
 	var args, cmdArgs []string
 	if jfsSetting.IsCe {
-		args = []string{"quota", "set", secrets["metaurl"], "--path", quotaPath, "--capacity", strconv.FormatInt(cap, 10)}
 		cmdArgs = []string{config.CeCliPath, "quota", "set", "${metaurl}", "--path", quotaPath, "--capacity", strconv.FormatInt(cap, 10)}
 	} else {
 		args = []string{"quota", "set", secrets["name"], "--path", quotaPath, "--capacity", strconv.FormatInt(cap, 10)}
 		cmdArgs = []string{config.CliPath, "quota", "set", secrets["name"], "--path", quotaPath, "--capacity", strconv.FormatInt(cap, 10)}
 	}
+	if config.AdminByJob && !config.ByProcess {
+		return j.mnt.JSetQuota(ctx, jfsSetting, quotaPath, cap)
+	}
 	log.Info("quota cmd", "command", strings.Join(cmdArgs, " "))
 	cmdCtx, cmdCancel := context.WithTimeout(ctx, 10*defaultCheckTimeout)
 	defer cmdCancel()
@@ -651,7 +929,7 @@ func (j *juicefs) SetQuota(ctx context.Context, secrets map[string]string, jfsSe
 		return wrapSetQuotaErr(string(res), err)
 	}
 
-	quotaCmd := j.Exec.CommandContext(ctx, config.CeCliPath, args...)
+	quotaCmd := j.Exec.CommandContext(ctx, config.CeCliPath, "quota", "set", jfsSetting.MetaUrl, "--path", quotaPath, "--capacity", strconv.FormatInt(cap, 10))
 	quotaCmd.SetEnv(envs)
 	res, err := quotaCmd.CombinedOutput()
 	if err == nil {
@@ -661,6 +939,63 @@ func (j *juicefs) SetQuota(ctx context.Context, secrets map[string]string, jfsSe
 	return wrapSetQuotaErr(string(res), err)
 }
 
+// GetQuota returns the capacity quota of the path in bytes, 0 if no capacity quota is set. It's queried by the CLI for
+// paths which are not mounted, whose output is a human readable table, so the result is as precise as the table.
+// Use statfs of the mount point for the exact bytes when it's mounted, see applyQuotaStrictly of CSI Node.
+func (j *juicefs) GetQuota(ctx context.Context, secrets map[string]string, jfsSetting *config.JfsSetting, quotaPath string) (int64, error) {
+	cmdCtx, cmdCancel := context.WithTimeout(ctx, 10*defaultCheckTimeout)
+	defer cmdCancel()
+	envs := syscall.Environ()
+	for key, val := range jfsSetting.Envs {
+		envs = append(envs, fmt.Sprintf("%s=%s", security.EscapeBashStr(key), security.EscapeBashStr(val)))
+	}
+	var quotaCmd k8sexec.Cmd
+	if jfsSetting.IsCe {
+		quotaCmd = j.Exec.CommandContext(cmdCtx, config.CeCliPath, "quota", "get", jfsSetting.MetaUrl, "--path", quotaPath)
+	} else {
+		if authRes, err := j.AuthFs(ctx, secrets, jfsSetting, true); err != nil {
+			return 0, errors.Wrap(err, authRes)
+		}
+		quotaCmd = j.Exec.CommandContext(cmdCtx, config.CliPath, "quota", "get", secrets["name"], "--path", quotaPath)
+	}
+	quotaCmd.SetEnv(envs)
+	out, err := quotaCmd.CombinedOutput()
+	res := string(out)
+	if err != nil {
+		return 0, errors.Wrap(err, res)
+	}
+	return parseQuotaCapacity(res, quotaPath)
+}
+
+// parseQuotaCapacity parses the size of the path in the output table of `juicefs quota get`, e.g.
+// | /test | 1.0 GiB | 1.6 MiB |   0% | 400 | 73 | 18% |
+func parseQuotaCapacity(output, quotaPath string) (int64, error) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 3 || filepath.Clean(strings.TrimSpace(fields[1])) != filepath.Clean(quotaPath) {
+			continue
+		}
+		size := strings.ReplaceAll(strings.TrimSpace(fields[2]), " ", "")
+		if size == "" || size == "unlimited" {
+			return 0, nil
+		}
+		var capacity uint64
+		var err error
+		if strings.HasSuffix(size, "iB") {
+			capacity, err = util.ParseToBytes(strings.TrimSuffix(size, "iB"))
+		} else {
+			var bytes float64
+			bytes, err = strconv.ParseFloat(strings.TrimSuffix(size, "B"), 64)
+			capacity = uint64(bytes)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid quota size %q of %s", fields[2], quotaPath)
+		}
+		return int64(capacity), nil
+	}
+	return 0, fmt.Errorf("quota of %s not found in output: %s", quotaPath, output)
+}
+
 func wrapSetQuotaErr(res string, err error) error {
 	if err != nil {
 		re := string(res)
@@ -743,7 +1078,7 @@ func (j *juicefs) Upgrade() {
 	jfsLog.Info("Upgrade: successfully upgraded to newest version")
 }
 
-func (j *juicefs) ceFormat(ctx context.Context, secrets map[string]string, noUpdate bool, setting *config.JfsSetting) (string, error) {
+func (j *juicefs) ceFormat(ctx context.Context, secrets map[string]string, noUpdate bool, setting *config.JfsSetting, force bool) (string, error) {
 	log := util.GenLog(ctx, jfsLog, "ceFormat")
 	args, cmdArgs, err := config.GenFormatCmd(secrets, noUpdate, setting)
 	if err != nil {
@@ -751,7 +1086,7 @@ func (j *juicefs) ceFormat(ctx context.Context, secrets map[string]string, noUpd
 	}
 
 	// only run command when in process mode
-	if !config.ByProcess {
+	if !force && !config.ByProcess {
 		cmd := strings.Join(cmdArgs, " ")
 		return cmd, nil
 	}
@@ -784,28 +1119,120 @@ func (j *juicefs) ceFormat(ctx context.Context, secrets map[string]string, noUpd
 	return string(res), nil
 }
 
-// Status checks the status of JuiceFS, only for community edition
-func (j *juicefs) Status(ctx context.Context, metaUrl string) error {
+// JfsFormatDrift detects format settings in secrets which differ from the ones in the metadata engine,
+// only for community edition. If reconcile is true, the reconcilable ones are changed by `juicefs config`.
+func (j *juicefs) JfsFormatDrift(ctx context.Context, secrets map[string]string, reconcile bool) ([]config.FormatDrift, error) {
+	log := util.GenLog(ctx, jfsLog, "JfsFormatDrift")
+	metaUrl := secrets["metaurl"]
+	if metaUrl == "" {
+		return nil, nil
+	}
+	// the metaurl may need META_PASSWORD in envs, and the object storage may need its envs
+	secretEnvs := make(map[string]string)
+	if secrets["envs"] != "" {
+		if err := config.ParseYamlOrJson(secrets["envs"], &secretEnvs); err != nil {
+			return nil, err
+		}
+	}
+	envs := syscall.Environ()
+	for key, val := range secretEnvs {
+		envs = append(envs, fmt.Sprintf("%s=%s", security.EscapeBashStr(key), security.EscapeBashStr(val)))
+	}
+
+	statusCtx, statusCancel := context.WithTimeout(ctx, 2*defaultCheckTimeout)
+	defer statusCancel()
+	statusCmd := j.Exec.CommandContext(statusCtx, config.CeCliPath, "status", metaUrl)
+	statusCmd.SetEnv(envs)
+	out, err := statusCmd.CombinedOutput()
+	res := string(out)
+	if err != nil {
+		if strings.Contains(res, "database is not formatted") {
+			// will be formatted with the settings in secrets
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, res)
+	}
+	drifts, err := config.DetectFormatDrift(secrets, res)
+	if err != nil || len(drifts) == 0 || !reconcile {
+		return drifts, err
+	}
+
+	args := config.GenConfigArgs(secrets, drifts)
+	if len(args) == 0 {
+		return drifts, nil
+	}
+	log.Info("reconcile format settings", "drifts", drifts)
+	// `juicefs config` may check the object storage, which takes as long as format
+	configCtx, configCancel := context.WithTimeout(ctx, 8*defaultCheckTimeout)
+	defer configCancel()
+	configCmd := j.Exec.CommandContext(configCtx, config.CeCliPath, append([]string{"config", metaUrl, "--yes"}, args...)...)
+	configCmd.SetEnv(envs)
+	if out, err = configCmd.CombinedOutput(); err != nil {
+		return drifts, errors.Wrap(err, string(out))
+	}
+	log.Info("format settings reconciled", "output", string(out))
+	return drifts, nil
+}
+
+// Session is a client registered in the metadata engine, listed by juicefs status
+type Session struct {
+	Sid        uint64
+	Expire     time.Time
+	HostName   string
+	IPAddrs    []string
+	MountPoint string
+	ProcessID  int
+}
+
+// JfsListSessions lists the sessions of the file system, only for community edition, nil is returned for enterprise edition.
+func (j *juicefs) JfsListSessions(ctx context.Context, secrets map[string]string) ([]Session, error) {
+	metaUrl := secrets["metaurl"]
+	if metaUrl == "" {
+		return nil, nil
+	}
+	cmdCtx, cmdCancel := context.WithTimeout(ctx, 2*defaultCheckTimeout)
+	defer cmdCancel()
+	res, err := j.Exec.CommandContext(cmdCtx, config.CeCliPath, "status", metaUrl).CombinedOutput()
+	if err != nil {
+		return nil, wrapStatusErr(string(res), err)
+	}
+	return parseStatusSessions(string(res))
+}
+
+func parseStatusSessions(output string) ([]Session, error) {
+	// the output may start with logs printed to stderr
+	idx := strings.Index(output, "{")
+	if idx < 0 {
+		return nil, fmt.Errorf("invalid juicefs status output: %s", output)
+	}
+	var status struct {
+		Sessions []Session
+	}
+	if err := json.NewDecoder(strings.NewReader(output[idx:])).Decode(&status); err != nil {
+		return nil, fmt.Errorf("parse juicefs status output: %v", err)
+	}
+	return status.Sessions, nil
+}
+
+// Status checks the status of JuiceFS, only for community edition. envs are those in the secret of the file system,
+// e.g. META_PASSWORD of the metaurl.
+func (j *juicefs) Status(ctx context.Context, metaUrl string, envs map[string]string) error {
 	log := util.GenLog(ctx, jfsLog, "status")
-	args := []string{"status", metaUrl}
 	cmdArgs := []string{config.CeCliPath, "status", "${metaurl}"}
 
 	log.Info("juicefs status cmd", "command", strings.Join(cmdArgs, " "))
 	cmdCtx, cmdCancel := context.WithTimeout(ctx, 2*defaultCheckTimeout)
 	defer cmdCancel()
 
-	done := make(chan error, 1)
-	go func() {
-		res, err := j.Exec.CommandContext(context.Background(), config.CeCliPath, args...).CombinedOutput()
-		done <- wrapStatusErr(string(res), err)
-		close(done)
-	}()
-
-	select {
-	case <-cmdCtx.Done():
-		err := fmt.Errorf("juicefs status %s timed out", 2*defaultCheckTimeout)
-		return err
-	case err := <-done:
-		return err
+	statusCmd := j.Exec.CommandContext(cmdCtx, config.CeCliPath, "status", metaUrl)
+	cmdEnvs := syscall.Environ()
+	for key, val := range envs {
+		cmdEnvs = append(cmdEnvs, fmt.Sprintf("%s=%s", security.EscapeBashStr(key), security.EscapeBashStr(val)))
+	}
+	statusCmd.SetEnv(cmdEnvs)
+	res, err := statusCmd.CombinedOutput()
+	if err != nil && cmdCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("juicefs status %s timed out", 2*defaultCheckTimeout)
 	}
+	return wrapStatusErr(string(res), err)
 }
@@ -19,11 +19,13 @@ package juicefs
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"os/exec"
 	"reflect"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -32,10 +34,12 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 	k8sexec "k8s.io/utils/exec"
 	"k8s.io/utils/mount"
 
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/driver/mocks"
 	podmount "github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount"
@@ -304,6 +308,61 @@ var _ = Describe("jfs", func() {
 				Expect(err).Should(BeNil())
 			})
 		})
+
+		Context("test bind busy target", func() {
+			var (
+				patches   []*Patches
+				mountPath = "/var/lib/juicefs/volume/ce-static-vsvhgz"
+				target    = "/var/lib/kubelet/pods/8687ae00-ce35-4715-a117-f2d21e24ae4f/volumes/kubernetes.io~csi/ce-static/mount"
+				mockMits  = []mount.MountInfo{{
+					ID:         3280,
+					ParentID:   31,
+					Major:      0,
+					Minor:      231,
+					Root:       "/",
+					Source:     "JuiceFS:minio",
+					MountPoint: mountPath,
+					FsType:     "fuse.juicefs",
+				}}
+				busyErr = errors.New("mount failed: exit status 32\nOutput: mount: /target: target is busy")
+			)
+			BeforeEach(func() {
+				patches = append(patches,
+					ApplyFunc(mount.ParseMountInfo, func(filename string) ([]mount.MountInfo, error) {
+						return mockMits, nil
+					}),
+					ApplyGlobalVar(&config.TargetRetryInterval, time.Millisecond),
+				)
+			})
+			AfterEach(func() {
+				for _, patch := range patches {
+					patch.Reset()
+				}
+			})
+			It("should retry", func() {
+				mockCtl := gomock.NewController(GinkgoT())
+				defer mockCtl.Finish()
+				mockMount := mocks.NewMockInterface(mockCtl)
+				gomock.InOrder(
+					mockMount.EXPECT().Mount(mountPath, target, fsTypeNone, []string{"bind"}).Return(busyErr).Times(2),
+					mockMount.EXPECT().Mount(mountPath, target, fsTypeNone, []string{"bind"}).Return(nil),
+				)
+				j.MountPath = mountPath
+				j.Provider.SafeFormatAndMount.Interface = mockMount
+				err := j.BindTarget(context.TODO(), mountPath, target)
+				Expect(err).Should(BeNil())
+			})
+			It("should give up after retries", func() {
+				mockCtl := gomock.NewController(GinkgoT())
+				defer mockCtl.Finish()
+				mockMount := mocks.NewMockInterface(mockCtl)
+				mockMount.EXPECT().Mount(mountPath, target, fsTypeNone, []string{"bind"}).Return(busyErr).Times(config.TargetRetryTimes + 1)
+				j.MountPath = mountPath
+				j.Provider.SafeFormatAndMount.Interface = mockMount
+				err := j.BindTarget(context.TODO(), mountPath, target)
+				Expect(err).Should(Equal(busyErr))
+			})
+		})
 	})
 })
 
@@ -1022,7 +1081,7 @@ var _ = Describe("juicefs", func() {
 			It("should succeed", func() {
 				setting, err := config.ParseSetting(context.TODO(), secret, map[string]string{}, []string{}, "", "", secret["name"], nil, nil)
 				Expect(err).To(BeNil())
-				_, err = j.ceFormat(context.TODO(), secret, true, setting)
+				_, err = j.ceFormat(context.TODO(), secret, true, setting, false)
 				Expect(err).To(BeNil())
 			})
 		})
@@ -1048,7 +1107,7 @@ var _ = Describe("juicefs", func() {
 				}
 			})
 			It("should succeed", func() {
-				_, err := j.ceFormat(context.TODO(), secret, true, nil)
+				_, err := j.ceFormat(context.TODO(), secret, true, nil, false)
 				Expect(err).ShouldNot(BeNil())
 			})
 		})
@@ -1076,13 +1135,13 @@ var _ = Describe("juicefs", func() {
 			It("should succeed", func() {
 				setting, err := config.ParseSetting(context.TODO(), secret, map[string]string{}, []string{}, "", "", secret["name"], nil, nil)
 				Expect(err).To(BeNil())
-				_, err = j.ceFormat(context.TODO(), secret, true, setting)
+				_, err = j.ceFormat(context.TODO(), secret, true, setting, false)
 				Expect(err).ShouldNot(BeNil())
 			})
 		})
 		Context("nil secret", func() {
 			It("should succeed", func() {
-				_, err := j.ceFormat(context.TODO(), nil, true, nil)
+				_, err := j.ceFormat(context.TODO(), nil, true, nil, false)
 				Expect(err).ShouldNot(BeNil())
 			})
 		})
@@ -1183,7 +1242,7 @@ func Test_juicefs_ceFormat_format_in_pod(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			j := &juicefs{}
-			got, err := j.ceFormat(context.TODO(), tt.args.secrets, tt.args.noUpdate, tt.args.setting)
+			got, err := j.ceFormat(context.TODO(), tt.args.secrets, tt.args.noUpdate, tt.args.setting, false)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ceFormat() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -1211,6 +1270,8 @@ func Test_juicefs_validTarget(t *testing.T) {
 			},
 		},
 	}
+	config.KubeletRootDir = config.DetectKubeletRootDir("", "", &config.CSIPod)
+	defer func() { config.KubeletRootDir = config.DefaultKubeletRootDir }()
 	type args struct {
 		target string
 	}
@@ -1257,3 +1318,197 @@ func Test_juicefs_validTarget(t *testing.T) {
 		})
 	}
 }
+
+func Test_juicefs_checkMountLimit(t *testing.T) {
+	defer func() {
+		config.GlobalConfig.Reset()
+		config.NodeName = ""
+	}()
+	config.ByProcess = false
+	config.Webhook = false
+	config.NodeName = "node-c"
+	config.GlobalConfig.MountLimits = []config.MountLimit{{Name: "limited", MaxNodes: 2}}
+	mountPod := func(name, node, uuid string, deleting bool) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      map[string]string{common.PodTypeKey: common.PodTypeValue},
+				Annotations: map[string]string{common.JuiceFSUUID: uuid},
+			},
+			Spec: corev1.PodSpec{NodeName: node},
+		}
+		if deleting {
+			pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		}
+		return pod
+	}
+	j := &juicefs{K8sClient: &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		mountPod("a1", "node-a", "uuid-1", false),
+		mountPod("b1", "node-b", "uuid-1", false),
+		mountPod("b2", "node-b", "uuid-1", false),
+		mountPod("d1", "node-d", "uuid-2", true),
+	)}}
+
+	tests := []struct {
+		name    string
+		setting *config.JfsSetting
+		wantErr bool
+	}{
+		{
+			name:    "unlimited",
+			setting: &config.JfsSetting{Name: "other", UUID: "uuid-1"},
+		},
+		{
+			name:    "exceeded",
+			setting: &config.JfsSetting{Name: "limited", UUID: "uuid-1"},
+			wantErr: true,
+		},
+		{
+			name:    "deleting mount pods not counted",
+			setting: &config.JfsSetting{Name: "limited", UUID: "uuid-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := j.checkMountLimit(context.TODO(), tt.setting)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkMountLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrMountLimitExceeded) {
+				t.Errorf("checkMountLimit() error = %v, want ErrMountLimitExceeded", err)
+			}
+		})
+	}
+
+	config.NodeName = "node-a"
+	if err := j.checkMountLimit(context.TODO(), &config.JfsSetting{Name: "limited", UUID: "uuid-1"}); err != nil {
+		t.Errorf("checkMountLimit() on a node already mounted error = %v", err)
+	}
+}
+
+func Test_parseQuotaCapacity(t *testing.T) {
+	output := `+-------+---------+---------+------+-----------+-------+-------+
+|  Path |   Size  |   Used  | Use% |   Inodes  | IUsed | IUse% |
++-------+---------+---------+------+-----------+-------+-------+
+| /test | 1.0 GiB | 1.6 MiB |   0% |       400 |    73 |   18% |
+| /tiny |   512 B |     0 B |   0% |       400 |     0 |    0% |
++-------+---------+---------+------+-----------+-------+-------+`
+	tests := []struct {
+		path    string
+		want    int64
+		wantErr bool
+	}{
+		{path: "/test", want: 1 << 30},
+		{path: "/test/", want: 1 << 30},
+		{path: "/tiny", want: 512},
+		{path: "/other", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseQuotaCapacity(output, tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseQuotaCapacity(%s) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseQuotaCapacity(%s) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
+
+func Test_parseStatusSessions(t *testing.T) {
+	output := `2024/06/18 10:00:00.000000 juicefs[1] <INFO>: Meta address: redis://redis:6379/1 [interface.go:497]
+{
+  "Setting": {"Name": "myjfs", "UUID": "e2b3c7a0"},
+  "Sessions": [
+    {
+      "Sid": 3,
+      "Expire": "2024-06-18T10:01:00+08:00",
+      "Version": "1.2.0+2024-06-18.873c47b9",
+      "HostName": "pvc-1",
+      "IPAddrs": ["10.0.0.3", "fe80::1"],
+      "MountPoint": "/jfs/pvc-1-abcdef",
+      "ProcessID": 12
+    }
+  ]
+}`
+	sessions, err := parseStatusSessions(output)
+	if err != nil {
+		t.Fatalf("parseStatusSessions() error = %v", err)
+	}
+	want := []Session{{
+		Sid:        3,
+		Expire:     time.Date(2024, 6, 18, 2, 1, 0, 0, time.UTC),
+		HostName:   "pvc-1",
+		IPAddrs:    []string{"10.0.0.3", "fe80::1"},
+		MountPoint: "/jfs/pvc-1-abcdef",
+		ProcessID:  12,
+	}}
+	if len(sessions) != 1 || !sessions[0].Expire.Equal(want[0].Expire) {
+		t.Fatalf("parseStatusSessions() = %+v, want %+v", sessions, want)
+	}
+	sessions[0].Expire = want[0].Expire
+	if !reflect.DeepEqual(sessions, want) {
+		t.Errorf("parseStatusSessions() = %+v, want %+v", sessions, want)
+	}
+	if _, err := parseStatusSessions("database is not formatted"); err == nil {
+		t.Errorf("parseStatusSessions() expected error")
+	}
+}
+
+func Test_juicefs_SetQuotaByJob(t *testing.T) {
+	defer func() { config.AdminByJob = false }()
+	config.AdminByJob = true
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockMnt := mntmock.NewMockMntInterface(mockCtl)
+	setting := &config.JfsSetting{IsCe: true, VolumeId: "pvc-1"}
+	mockMnt.EXPECT().JSetQuota(gomock.Any(), setting, "/pvc-1", int64(10)).Return(nil)
+	j := &juicefs{mnt: mockMnt}
+	if err := j.SetQuota(context.TODO(), map[string]string{"metaurl": "redis://127.0.0.1/1"}, setting, "/pvc-1", 10<<30); err != nil {
+		t.Errorf("SetQuota() error = %v", err)
+	}
+}
+
+func Test_isTargetBusy(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: &fs.PathError{Op: "mkdir", Path: "/target", Err: syscall.EBUSY}, want: true},
+		{err: &fs.PathError{Op: "rmdir", Path: "/target", Err: syscall.ENOTEMPTY}, want: true},
+		{err: errors.New("mount failed: exit status 32\nOutput: mount: /target: target is busy"), want: true},
+		{err: &fs.PathError{Op: "mkdir", Path: "/target", Err: syscall.EACCES}, want: false},
+		{err: errors.New("mount failed: exit status 32\nOutput: mount: /target: special device does not exist"), want: false},
+	}
+	for _, tt := range tests {
+		if got := isTargetBusy(tt.err); got != tt.want {
+			t.Errorf("isTargetBusy(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyMountError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want MountErrorClass
+	}{
+		{err: fmt.Errorf("mount redis://:***@127.0.0.1/1 at /jfs failed, mountpod: juicefs-pod, container jfs-mount is waiting: ImagePullBackOff: Back-off pulling image"), want: MountErrorImagePull},
+		{err: fmt.Errorf("failed log: load setting: NOAUTH Authentication required."), want: MountErrorAuthDenied},
+		{err: fmt.Errorf("failed log: object storage: AccessDenied: Access Denied status code: 403"), want: MountErrorAuthDenied},
+		{err: fmt.Errorf("failed log: Invalid meta driver: rediss2"), want: MountErrorInvalidMetaURL},
+		{err: fmt.Errorf("failed log: load setting: database is not formatted, please run `juicefs format ...` first"), want: MountErrorInvalidMetaURL},
+		{err: fmt.Errorf("failed log: dial tcp 10.0.0.1:6379: i/o timeout"), want: MountErrorTransient},
+		{err: fmt.Errorf("mount redis://127.0.0.1/1 at /jfs failed: mount isn't ready in 30 seconds"), want: MountErrorTransient},
+		{err: fmt.Errorf("check mount limit: %w", ErrMountLimitExceeded), want: MountErrorTransient},
+		{err: fmt.Errorf("exit status 1"), want: MountErrorUnknown},
+	}
+	for _, tt := range tests {
+		got := ClassifyMountError(tt.err)
+		if got != tt.want {
+			t.Errorf("ClassifyMountError(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+	if !MountErrorAuthDenied.Fatal() || MountErrorTransient.Fatal() || MountErrorUnknown.Fatal() {
+		t.Errorf("Fatal() is wrong")
+	}
+}
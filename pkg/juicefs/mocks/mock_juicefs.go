@@ -11,7 +11,8 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	config "github.com/juicedata/juicefs-csi-driver/pkg/config"
 	juicefs "github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
-	mount "k8s.io/utils/mount"
+	mount "github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount"
+	mount0 "k8s.io/utils/mount"
 )
 
 // MockInterface is a mock of Interface interface.
@@ -81,6 +82,21 @@ func (mr *MockInterfaceMockRecorder) GetMountRefs(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMountRefs", reflect.TypeOf((*MockInterface)(nil).GetMountRefs), arg0)
 }
 
+// GetQuota mocks base method.
+func (m *MockInterface) GetQuota(arg0 context.Context, arg1 map[string]string, arg2 *config.JfsSetting, arg3 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuota", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuota indicates an expected call of GetQuota.
+func (mr *MockInterfaceMockRecorder) GetQuota(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuota", reflect.TypeOf((*MockInterface)(nil).GetQuota), arg0, arg1, arg2, arg3)
+}
+
 // GetSubPath mocks base method.
 func (m *MockInterface) GetSubPath(arg0 context.Context, arg1 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -125,6 +141,20 @@ func (mr *MockInterfaceMockRecorder) JfsCleanupMountPoint(arg0, arg1 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsCleanupMountPoint", reflect.TypeOf((*MockInterface)(nil).JfsCleanupMountPoint), arg0, arg1)
 }
 
+// JfsCloneVol mocks base method.
+func (m *MockInterface) JfsCloneVol(arg0 context.Context, arg1, arg2, arg3 string, arg4, arg5 map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JfsCloneVol", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// JfsCloneVol indicates an expected call of JfsCloneVol.
+func (mr *MockInterfaceMockRecorder) JfsCloneVol(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsCloneVol", reflect.TypeOf((*MockInterface)(nil).JfsCloneVol), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
 // JfsCreateVol mocks base method.
 func (m *MockInterface) JfsCreateVol(arg0 context.Context, arg1, arg2 string, arg3, arg4 map[string]string) error {
 	m.ctrl.T.Helper()
@@ -139,6 +169,34 @@ func (mr *MockInterfaceMockRecorder) JfsCreateVol(arg0, arg1, arg2, arg3, arg4 i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsCreateVol", reflect.TypeOf((*MockInterface)(nil).JfsCreateVol), arg0, arg1, arg2, arg3, arg4)
 }
 
+// JfsDeleteSnapshot mocks base method.
+func (m *MockInterface) JfsDeleteSnapshot(arg0 context.Context, arg1, arg2 string, arg3 map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JfsDeleteSnapshot", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// JfsDeleteSnapshot indicates an expected call of JfsDeleteSnapshot.
+func (mr *MockInterfaceMockRecorder) JfsDeleteSnapshot(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsDeleteSnapshot", reflect.TypeOf((*MockInterface)(nil).JfsDeleteSnapshot), arg0, arg1, arg2, arg3)
+}
+
+// JfsDeleteSubPath mocks base method.
+func (m *MockInterface) JfsDeleteSubPath(arg0 context.Context, arg1, arg2 string, arg3, arg4 map[string]string, arg5 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JfsDeleteSubPath", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// JfsDeleteSubPath indicates an expected call of JfsDeleteSubPath.
+func (mr *MockInterfaceMockRecorder) JfsDeleteSubPath(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsDeleteSubPath", reflect.TypeOf((*MockInterface)(nil).JfsDeleteSubPath), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
 // JfsDeleteVol mocks base method.
 func (m *MockInterface) JfsDeleteVol(arg0 context.Context, arg1, arg2 string, arg3, arg4 map[string]string, arg5 []string) error {
 	m.ctrl.T.Helper()
@@ -153,6 +211,65 @@ func (mr *MockInterfaceMockRecorder) JfsDeleteVol(arg0, arg1, arg2, arg3, arg4,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsDeleteVol", reflect.TypeOf((*MockInterface)(nil).JfsDeleteVol), arg0, arg1, arg2, arg3, arg4, arg5)
 }
 
+// JfsFormatDrift mocks base method.
+func (m *MockInterface) JfsFormatDrift(arg0 context.Context, arg1 map[string]string, arg2 bool) ([]config.FormatDrift, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JfsFormatDrift", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]config.FormatDrift)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// JfsFormatDrift indicates an expected call of JfsFormatDrift.
+func (mr *MockInterfaceMockRecorder) JfsFormatDrift(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsFormatDrift", reflect.TypeOf((*MockInterface)(nil).JfsFormatDrift), arg0, arg1, arg2)
+}
+
+// JfsFormatVol mocks base method.
+func (m *MockInterface) JfsFormatVol(arg0 context.Context, arg1 string, arg2, arg3 map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JfsFormatVol", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// JfsFormatVol indicates an expected call of JfsFormatVol.
+func (mr *MockInterfaceMockRecorder) JfsFormatVol(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsFormatVol", reflect.TypeOf((*MockInterface)(nil).JfsFormatVol), arg0, arg1, arg2, arg3)
+}
+
+// JfsListSessions mocks base method.
+func (m *MockInterface) JfsListSessions(arg0 context.Context, arg1 map[string]string) ([]juicefs.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JfsListSessions", arg0, arg1)
+	ret0, _ := ret[0].([]juicefs.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// JfsListSessions indicates an expected call of JfsListSessions.
+func (mr *MockInterfaceMockRecorder) JfsListSessions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsListSessions", reflect.TypeOf((*MockInterface)(nil).JfsListSessions), arg0, arg1)
+}
+
+// JfsListSubdirs mocks base method.
+func (m *MockInterface) JfsListSubdirs(arg0 context.Context, arg1 string, arg2, arg3 map[string]string, arg4 []string) ([]mount.Subdir, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JfsListSubdirs", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]mount.Subdir)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// JfsListSubdirs indicates an expected call of JfsListSubdirs.
+func (mr *MockInterfaceMockRecorder) JfsListSubdirs(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JfsListSubdirs", reflect.TypeOf((*MockInterface)(nil).JfsListSubdirs), arg0, arg1, arg2, arg3, arg4)
+}
+
 // JfsMount mocks base method.
 func (m *MockInterface) JfsMount(arg0 context.Context, arg1, arg2 string, arg3, arg4 map[string]string, arg5 []string) (juicefs.Jfs, error) {
 	m.ctrl.T.Helper()
@@ -183,10 +300,10 @@ func (mr *MockInterfaceMockRecorder) JfsUnmount(arg0, arg1, arg2 interface{}) *g
 }
 
 // List mocks base method.
-func (m *MockInterface) List() ([]mount.MountPoint, error) {
+func (m *MockInterface) List() ([]mount0.MountPoint, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "List")
-	ret0, _ := ret[0].([]mount.MountPoint)
+	ret0, _ := ret[0].([]mount0.MountPoint)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -255,17 +372,17 @@ func (mr *MockInterfaceMockRecorder) Settings(arg0, arg1, arg2, arg3, arg4, arg5
 }
 
 // Status mocks base method.
-func (m *MockInterface) Status(arg0 context.Context, arg1 string) error {
+func (m *MockInterface) Status(arg0 context.Context, arg1 string, arg2 map[string]string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Status", arg0, arg1)
+	ret := m.ctrl.Call(m, "Status", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Status indicates an expected call of Status.
-func (mr *MockInterfaceMockRecorder) Status(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) Status(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockInterface)(nil).Status), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockInterface)(nil).Status), arg0, arg1, arg2)
 }
 
 // Unmount mocks base method.
@@ -21,6 +21,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -40,6 +41,8 @@ const (
 	UpdateDBCfgFile = "/etc/updatedb.conf"
 )
 
+var shellNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type BaseBuilder struct {
 	jfsSetting *config.JfsSetting
 	capacity   int64
@@ -86,7 +89,14 @@ func (r *BaseBuilder) genCommonJuicePod(cnGen func() corev1.Container) *corev1.P
 	pod.Spec.PriorityClassName = config.JFSMountPriorityName
 	pod.Spec.RestartPolicy = corev1.RestartPolicyAlways
 	pod.Spec.Hostname = r.jfsSetting.VolumeId
+	if r.jfsSetting.Consumer != nil {
+		// the hostname is the client name of the session in the metadata engine
+		pod.Spec.Hostname = r.jfsSetting.Consumer.Hostname()
+	}
 	gracePeriod := int64(10)
+	if r.jfsSetting.Writeback() {
+		gracePeriod = int64(config.WritebackFlushTimeout.Seconds())
+	}
 	if r.jfsSetting.Attr.TerminationGracePeriodSeconds != nil {
 		gracePeriod = *r.jfsSetting.Attr.TerminationGracePeriodSeconds
 	}
@@ -96,8 +106,11 @@ func (r *BaseBuilder) genCommonJuicePod(cnGen func() corev1.Container) *corev1.P
 	volumes, volumeMounts := r._genJuiceVolumes()
 	pod.Spec.Volumes = volumes
 	pod.Spec.Containers[0].VolumeMounts = volumeMounts
-	// set env key from secret
+	// set env key from secret, external secrets are read from files by the command, see genInitCommand
 	for _, key := range r.GetEnvKey() {
+		if r.jfsSetting.ExternalSecrets {
+			break
+		}
 		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
 			Name: key,
 			ValueFrom: &corev1.EnvVarSource{
@@ -110,16 +123,30 @@ func (r *BaseBuilder) genCommonJuicePod(cnGen func() corev1.Container) *corev1.P
 			},
 		})
 	}
+	if r.jfsSetting.CABundle != "" {
+		// trust the custom CA besides the system ones, used by object storage clients
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "SSL_CERT_DIR",
+			Value: filepath.Join(config.TLSConfPath, filepath.Dir(tlsCAFile)),
+		})
+	}
 	pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, r.jfsSetting.Attr.Env...)
 
 	pod.Spec.Containers[0].Resources = r.jfsSetting.Attr.Resources
-	// if image support passFd from csi, do not set umount preStop
 	if r.jfsSetting.Attr.Lifecycle == nil {
+		preStop := ""
+		if r.jfsSetting.Writeback() {
+			// wait for the written data to be uploaded before the client exits, within the grace period
+			preStop = waitFlushCmd(r.jfsSetting.MountPath) + "; "
+		}
+		// if image support passFd from csi, do not set umount preStop
 		if !util.SupportFusePass(pod.Spec.Containers[0].Image) || config.Webhook {
+			preStop += fmt.Sprintf("umount %s -l; rmdir %s; ", r.jfsSetting.MountPath, r.jfsSetting.MountPath)
+		}
+		if preStop != "" {
 			pod.Spec.Containers[0].Lifecycle = &corev1.Lifecycle{
 				PreStop: &corev1.LifecycleHandler{
-					Exec: &corev1.ExecAction{Command: []string{"sh", "-c", "+e", fmt.Sprintf(
-						"umount %s -l; rmdir %s; exit 0", r.jfsSetting.MountPath, r.jfsSetting.MountPath)}},
+					Exec: &corev1.ExecAction{Command: []string{"sh", "-c", "+e", preStop + "exit 0"}},
 				},
 			}
 		}
@@ -131,8 +158,8 @@ func (r *BaseBuilder) genCommonJuicePod(cnGen func() corev1.Container) *corev1.P
 	pod.Spec.Containers[0].LivenessProbe = r.jfsSetting.Attr.LivenessProbe
 	pod.Spec.Containers[0].ReadinessProbe = r.jfsSetting.Attr.ReadinessProbe
 
-	if r.jfsSetting.Attr.HostNetwork || !r.jfsSetting.IsCe {
-		// When using hostNetwork, the MountPod will use a random port for metrics.
+	if (r.jfsSetting.Attr.HostNetwork && r.jfsSetting.MetricsPort == 0) || !r.jfsSetting.IsCe || r.jfsSetting.MetricsOff {
+		// When using hostNetwork without a port assigned, the MountPod will use a random port for metrics.
 		// Before inducing any auxiliary method to detect that random port, the
 		// best way is to avoid announcing any port about that.
 		// Enterprise edition does not have metrics port.
@@ -148,34 +175,23 @@ func (r *BaseBuilder) genCommonJuicePod(cnGen func() corev1.Container) *corev1.P
 // genMountCommand generates mount command
 func (r *BaseBuilder) genMountCommand() string {
 	cmd := ""
-	options := []string{}
-	subdir := r.jfsSetting.SubPath
-	if !config.StorageClassShareMount {
-		for _, option := range r.jfsSetting.Options {
-			if strings.HasPrefix(option, "subdir=") {
-				s := strings.Split(option, "=")
-				if len(s) != 2 {
-					continue
-				}
-				subdir = path.Join(s[1], r.jfsSetting.SubPath)
-				continue
-			}
-			options = append(options, option)
-		}
-		if subdir != "" {
-			options = append(options, fmt.Sprintf("subdir=%s", subdir))
-		}
-	} else {
-		options = r.jfsSetting.Options
+	options := r.jfsSetting.Options
+	if r.jfsSetting.SubdirMount() {
+		options = r.jfsSetting.SubdirMountOptions()
 	}
 	if r.jfsSetting.IsCe {
 		mountArgs := []string{"exec", config.CeMountPath, "${metaurl}", security.EscapeBashStr(r.jfsSetting.MountPath)}
 		if !util.ContainsPrefix(options, "metrics=") {
-			if r.jfsSetting.Attr.HostNetwork {
+			switch {
+			case r.jfsSetting.MetricsOff:
+				options = append(options, "metrics="+config.LoopbackAddress(0))
+			case r.jfsSetting.MetricsPort > 0:
+				options = append(options, "metrics="+config.WildcardAddress(int(r.jfsSetting.MetricsPort)))
+			case r.jfsSetting.Attr.HostNetwork:
 				// Pick up a random (useable) port for hostNetwork MountPods.
-				options = append(options, "metrics=0.0.0.0:0")
-			} else {
-				options = append(options, "metrics=0.0.0.0:9567")
+				options = append(options, "metrics="+config.WildcardAddress(0))
+			default:
+				options = append(options, "metrics="+config.WildcardAddress(9567))
 			}
 		}
 		mountArgs = append(mountArgs, "-o", security.EscapeBashStr(strings.Join(options, ",")))
@@ -206,9 +222,28 @@ func (r *BaseBuilder) genInitCommand() string {
 		args := []string{"cp", confPath, r.jfsSetting.ClientConfPath}
 		formatCmd = strings.Join(args, " ")
 	}
+	if r.jfsSetting.ExternalSecrets {
+		return strings.Join(append(r.genExternalSecretsEnvCommand(), formatCmd), "\n")
+	}
 	return formatCmd
 }
 
+// genExternalSecretsEnvCommand exports the env from the files of the secrets fetched from the external secret
+// provider, instead of the env from the secret. Keys which are not valid shell names are skipped, as they can't
+// be referenced by the commands.
+func (r *BaseBuilder) genExternalSecretsEnvCommand() []string {
+	keys := r.GetEnvKey()
+	sort.Strings(keys)
+	cmds := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !shellNameRegexp.MatchString(key) {
+			continue
+		}
+		cmds = append(cmds, fmt.Sprintf(`export %s="$(cat %s)"`, key, path.Join(externalSecretsMountPath, key)))
+	}
+	return cmds
+}
+
 func (r *BaseBuilder) getQuotaPath() string {
 	quotaPath := r.jfsSetting.SubPath
 	var subdir string
@@ -250,6 +285,9 @@ func (r *BaseBuilder) getJobCommand() string {
 // genMetricsPort generates metrics port
 func (r *BaseBuilder) genMetricsPort() int32 {
 	port := int64(9567)
+	if r.jfsSetting.MetricsPort > 0 {
+		port = int64(r.jfsSetting.MetricsPort)
+	}
 	options := r.jfsSetting.Options
 
 	for _, option := range options {
@@ -268,7 +306,8 @@ func (r *BaseBuilder) genMetricsPort() int32 {
 func GenMetadata(jfsSetting *config.JfsSetting) (labels map[string]string, annotations map[string]string) {
 	labels = map[string]string{}
 	annotations = map[string]string{}
-	if jfsSetting.DeletedDelay != "" {
+	// the mount pod and its cache are dropped once it's not referenced if CleanCacheOnUnpublish is set
+	if jfsSetting.DeletedDelay != "" && !jfsSetting.CleanCacheOnUnpublish {
 		annotations[common.DeleteDelayTimeKey] = jfsSetting.DeletedDelay
 	}
 	if jfsSetting.CleanCache {
@@ -286,6 +325,18 @@ func GenMetadata(jfsSetting *config.JfsSetting) (labels map[string]string, annot
 	// inter labels & annotations
 	annotations[common.JuiceFSUUID] = jfsSetting.UUID
 	annotations[common.UniqueId] = jfsSetting.UniqueId
+	if jfsSetting.Name != "" {
+		annotations[common.FsNameKey] = jfsSetting.Name
+	}
+	if c := jfsSetting.Consumer; c != nil {
+		annotations[common.ConsumerPodKey] = c.Namespace + "/" + c.Name
+		if c.ServiceAccount != "" {
+			annotations[common.ConsumerServiceAccountKey] = c.ServiceAccount
+		}
+	}
+	if jfsSetting.MetricsPort > 0 {
+		annotations[common.MetricsPortKey] = strconv.Itoa(int(jfsSetting.MetricsPort))
+	}
 	labels[common.PodJuiceHashLabelKey] = jfsSetting.HashVal
 	labels[common.PodUpgradeUUIDLabelKey] = jfsSetting.UpgradeUUID
 	labels[common.PodTypeKey] = common.PodTypeValue
@@ -301,8 +352,37 @@ func (r *BaseBuilder) _genMetadata() (labels map[string]string, annotations map[
 // _genJuiceVolumes generates volumes & volumeMounts
 // 1. if encrypt_rsa_key is set, mount secret to /root/.rsa
 // 2. if initconfig is set, mount secret to /etc/juicefs
-// 3. configs in secret
+// 3. if ca-bundle or tls-cert/tls-key is set, mount secret to /etc/juicefs-tls
+// 4. configs in secret
 func (r *BaseBuilder) _genJuiceVolumes() ([]corev1.Volume, []corev1.VolumeMount) {
+	var volumes []corev1.Volume
+	var volumeMounts []corev1.VolumeMount
+	if r.jfsSetting.ExternalSecrets {
+		volumes, volumeMounts = r.genExternalSecretsVolumes()
+	} else {
+		volumes, volumeMounts = r.genSecretVolumes()
+	}
+	i := 1
+	for k, v := range r.jfsSetting.Configs {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      fmt.Sprintf("config-%v", i),
+			MountPath: v,
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: fmt.Sprintf("config-%v", i),
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: k,
+				},
+			},
+		})
+		i++
+	}
+	return volumes, volumeMounts
+}
+
+// genSecretVolumes mounts the files in the secret of the mount pod
+func (r *BaseBuilder) genSecretVolumes() ([]corev1.Volume, []corev1.VolumeMount) {
 	volumes := []corev1.Volume{}
 	volumeMounts := []corev1.VolumeMount{}
 	secretName := r.jfsSetting.SecretName
@@ -345,21 +425,76 @@ func (r *BaseBuilder) _genJuiceVolumes() ([]corev1.Volume, []corev1.VolumeMount)
 			},
 		)
 	}
-	i := 1
-	for k, v := range r.jfsSetting.Configs {
-		volumeMounts = append(volumeMounts, corev1.VolumeMount{
-			Name:      fmt.Sprintf("config-%v", i),
-			MountPath: v,
-		})
+	var tlsItems []corev1.KeyToPath
+	if r.jfsSetting.CABundle != "" {
+		tlsItems = append(tlsItems, corev1.KeyToPath{Key: "ca-bundle", Path: tlsCAFile})
+	}
+	if r.jfsSetting.TLSCert != "" && r.jfsSetting.TLSKey != "" {
+		tlsItems = append(tlsItems,
+			corev1.KeyToPath{Key: "tls-cert", Path: tlsCertFile},
+			corev1.KeyToPath{Key: "tls-key", Path: tlsKeyFile},
+		)
+	}
+	if len(tlsItems) != 0 {
 		volumes = append(volumes, corev1.Volume{
-			Name: fmt.Sprintf("config-%v", i),
-			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName: k,
-				},
+			Name: "tls-conf",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+				Items:      tlsItems,
+			}},
+		})
+		volumeMounts = append(volumeMounts,
+			corev1.VolumeMount{
+				Name:      "tls-conf",
+				MountPath: config.TLSConfPath,
 			},
+		)
+	}
+	return volumes, volumeMounts
+}
+
+// genExternalSecretsVolumes mounts the directory the secrets fetched from the external secret provider are
+// written to on the node, the files are mounted to the same paths as genSecretVolumes does
+func (r *BaseBuilder) genExternalSecretsVolumes() ([]corev1.Volume, []corev1.VolumeMount) {
+	dirType := corev1.HostPathDirectory
+	volumes := []corev1.Volume{{
+		Name: ExternalSecretsVolumeName,
+		VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+			Path: filepath.Join(config.ExternalSecretsPath, r.jfsSetting.SecretName),
+			Type: &dirType,
+		}},
+	}}
+	volumeMounts := []corev1.VolumeMount{{
+		Name:      ExternalSecretsVolumeName,
+		MountPath: externalSecretsMountPath,
+		ReadOnly:  true,
+	}}
+	fileMount := func(key, path string) {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      ExternalSecretsVolumeName,
+			MountPath: path,
+			SubPath:   key,
+			ReadOnly:  true,
 		})
-		i++
+	}
+	if r.jfsSetting.EncryptRsaKey != "" {
+		fileMount("encrypt_rsa_key", "/root/.rsa/rsa-key.pem")
+	}
+	if r.jfsSetting.InitConfig != "" {
+		fileMount("initconfig", filepath.Join(config.ROConfPath, r.jfsSetting.Name+".conf"))
+	}
+	if r.jfsSetting.CABundle != "" {
+		fileMount("ca-bundle", filepath.Join(config.TLSConfPath, tlsCAFile))
+	}
+	if r.jfsSetting.TLSCert != "" && r.jfsSetting.TLSKey != "" {
+		fileMount("tls-cert", filepath.Join(config.TLSConfPath, tlsCertFile))
+		fileMount("tls-key", filepath.Join(config.TLSConfPath, tlsKeyFile))
 	}
 	return volumes, volumeMounts
 }
+
+// waitFlushCmd returns the shell command waiting until no block is staged in the cache of the mount point,
+// i.e. all data written with writeback is uploaded. It returns at once if the client doesn't report staging blocks.
+func waitFlushCmd(mountPath string) string {
+	return fmt.Sprintf(`while s=$(grep -m1 '^juicefs_staging_blocks' %s/.stats 2>/dev/null | awk '{print $NF}') && [ -n "$s" ] && [ "$s" != "0" ]; do sleep 1; done`, mountPath)
+}
@@ -64,6 +64,30 @@ func TestGenMetadata(t *testing.T) {
 				common.UniqueId:           "unique1",
 			},
 		},
+		{
+			name: "test-clean-cache-on-unpublish",
+			jfsSetting: &config.JfsSetting{
+				DeletedDelay:          "10s",
+				CleanCache:            true,
+				CleanCacheOnUnpublish: true,
+				Attr:                  &config.PodAttr{},
+				UUID:                  "uuid2",
+				UniqueId:              "unique2",
+				HashVal:               "hash1",
+				UpgradeUUID:           "hash1",
+			},
+			wantLabels: map[string]string{
+				common.PodTypeKey:             common.PodTypeValue,
+				common.PodUniqueIdLabelKey:    "unique2",
+				common.PodJuiceHashLabelKey:   "hash1",
+				common.PodUpgradeUUIDLabelKey: "hash1",
+			},
+			wantAnnotations: map[string]string{
+				common.CleanCache:  "true",
+				common.JuiceFSUUID: "uuid2",
+				common.UniqueId:    "unique2",
+			},
+		},
 		{
 			name: "test-overwrite-inter-should-not-overwrite",
 			jfsSetting: &config.JfsSetting{
@@ -0,0 +1,161 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package builder
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+)
+
+const (
+	// NFSContainerName is the container serving the mount point over NFS in export pods
+	NFSContainerName = "nfs-server"
+	NFSPort          = 2049
+	exportAppName    = "juicefs-export"
+)
+
+// ExportBuilder generates the deployment running the mount of a volume on storage nodes, and the service
+// exporting it over NFS to nodes where FUSE is not allowed. The mount point is shared with the NFS server
+// through an emptyDir, instead of the host path of mount pods.
+type ExportBuilder struct {
+	PodBuilder
+}
+
+func NewExportBuilder(setting *config.JfsSetting) *ExportBuilder {
+	// only the subPath of the volume is exported
+	setting.MountStrategy = config.MountStrategySubdir
+	return &ExportBuilder{PodBuilder: *NewPodBuilder(setting, 0)}
+}
+
+// ExportLabels returns the labels of the export pods and service
+func ExportLabels(name string) map[string]string {
+	return map[string]string{
+		common.PodTypeKey:     exportAppName,
+		common.ExportLabelKey: name,
+	}
+}
+
+// NewExportDeployment generates the deployment of export pods, spread over the storage nodes
+func (r *ExportBuilder) NewExportDeployment(name string, replicas int32, nodeSelector map[string]string) (*appsv1.Deployment, error) {
+	pod, err := r.NewMountPod("")
+	if err != nil {
+		return nil, err
+	}
+	spec := pod.Spec
+	spec.NodeName = ""
+	spec.NodeSelector = nodeSelector
+	spec.RestartPolicy = corev1.RestartPolicyAlways
+	spec.Affinity = &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+				Weight: 100,
+				PodAffinityTerm: corev1.PodAffinityTerm{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: ExportLabels(name)},
+					TopologyKey:   corev1.LabelHostname,
+				},
+			}},
+		},
+	}
+
+	volumes := make([]corev1.Volume, 0, len(spec.Volumes))
+	for _, v := range spec.Volumes {
+		switch v.Name {
+		case JfsDirName:
+			v.VolumeSource = corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+		case config.JfsFuseFdPathName:
+			// no fuse fd is passed to export pods
+			continue
+		}
+		volumes = append(volumes, v)
+	}
+	spec.Volumes = volumes
+	mountContainer := spec.Containers[0]
+	volumeMounts := make([]corev1.VolumeMount, 0, len(mountContainer.VolumeMounts))
+	for _, vm := range mountContainer.VolumeMounts {
+		if vm.Name != config.JfsFuseFdPathName {
+			volumeMounts = append(volumeMounts, vm)
+		}
+	}
+	mountContainer.VolumeMounts = volumeMounts
+
+	privileged := true
+	propagation := corev1.MountPropagationHostToContainer
+	nfsContainer := corev1.Container{
+		Name:            NFSContainerName,
+		Image:           config.NFSExportImage,
+		SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+		Env:             []corev1.EnvVar{{Name: "EXPORT_PATH", Value: r.jfsSetting.MountPath}},
+		Ports:           []corev1.ContainerPort{{Name: "nfs", ContainerPort: NFSPort}},
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:             JfsDirName,
+			MountPath:        config.PodMountBase,
+			MountPropagation: &propagation,
+		}},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(NFSPort)},
+			},
+			PeriodSeconds: 5,
+		},
+	}
+	spec.Containers = []corev1.Container{mountContainer, nfsContainer}
+
+	labels := ExportLabels(name)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: config.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				// finalizers of mount pods are not set, nobody removes them from export pods
+				ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: pod.Annotations},
+				Spec:       spec,
+			},
+		},
+	}, nil
+}
+
+// NewExportService generates the service of export pods, each node sticks to one of them
+func (r *ExportBuilder) NewExportService(name string) *corev1.Service {
+	labels := ExportLabels(name)
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: config.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector:        labels,
+			SessionAffinity: corev1.ServiceAffinityClientIP,
+			Ports: []corev1.ServicePort{{
+				Name:       "nfs",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       NFSPort,
+				TargetPort: intstr.FromInt32(NFSPort),
+			}},
+		},
+	}
+}
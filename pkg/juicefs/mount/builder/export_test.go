@@ -0,0 +1,80 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package builder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+)
+
+func TestNewExportDeployment(t *testing.T) {
+	config.NodeName = "node"
+	config.Namespace = "kube-system"
+	config.NFSExportImage = "nfs-server:test"
+	defer func() { config.NFSExportImage = "" }()
+	setting := &config.JfsSetting{
+		IsCe:        true,
+		Name:        "test",
+		UpgradeUUID: "test",
+		Source:      "redis://127.0.0.1:6379/0",
+		MetaUrl:     "redis://127.0.0.1:6379/0",
+		MountPath:   "/jfs/pvc-1",
+		VolumeId:    "pvc-1",
+		SubPath:     "pvc-1",
+		SecretName:  "juicefs-pvc-1-secret",
+		Attr: &config.PodAttr{
+			Namespace:      config.Namespace,
+			MountPointPath: config.MountPointPath,
+			JFSConfigPath:  config.JFSConfigPath,
+			Image:          config.DefaultCEMountImage,
+		},
+	}
+	r := NewExportBuilder(setting)
+	assert.True(t, setting.SubdirMount())
+
+	deploy, err := r.NewExportDeployment("juicefs-export-pvc-1", 2, map[string]string{"pool": "storage"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), *deploy.Spec.Replicas)
+	assert.Equal(t, ExportLabels("juicefs-export-pvc-1"), deploy.Spec.Template.Labels)
+	assert.Empty(t, deploy.Spec.Template.Finalizers)
+	spec := deploy.Spec.Template.Spec
+	assert.Equal(t, "", spec.NodeName)
+	assert.Equal(t, map[string]string{"pool": "storage"}, spec.NodeSelector)
+	assert.Equal(t, corev1.RestartPolicyAlways, spec.RestartPolicy)
+	for _, v := range spec.Volumes {
+		assert.NotEqual(t, config.JfsFuseFdPathName, v.Name)
+		if v.Name == JfsDirName {
+			assert.NotNil(t, v.EmptyDir, "mount point should not be on the host")
+		}
+	}
+	assert.Len(t, spec.Containers, 2)
+	assert.Contains(t, spec.Containers[0].Command[2], "subdir=pvc-1")
+	nfs := spec.Containers[1]
+	assert.Equal(t, "nfs-server:test", nfs.Image)
+	assert.Equal(t, []corev1.EnvVar{{Name: "EXPORT_PATH", Value: "/jfs/pvc-1"}}, nfs.Env)
+	assert.Equal(t, corev1.MountPropagationHostToContainer, *nfs.VolumeMounts[0].MountPropagation)
+
+	svc := r.NewExportService("juicefs-export-pvc-1")
+	assert.Equal(t, "juicefs-export-pvc-1", svc.Spec.Selector[common.ExportLabelKey])
+	assert.Equal(t, corev1.ServiceAffinityClientIP, svc.Spec.SessionAffinity)
+	assert.Equal(t, int32(NFSPort), svc.Spec.Ports[0].Port)
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"path"
 	"strings"
 
 	batchv1 "k8s.io/api/batch/v1"
@@ -74,6 +75,48 @@ func (r *JobBuilder) NewJobForDeleteVolume() *batchv1.Job {
 	return job
 }
 
+// NewJobForCloneVolume returns a job which clones srcSubPath into the subPath of the setting,
+// it backs both snapshot creation and restoring a volume from a snapshot.
+func (r *JobBuilder) NewJobForCloneVolume(srcSubPath string) *batchv1.Job {
+	jobName := GenJobNameByVolumeId(r.jfsSetting.VolumeId) + "-clonevol"
+	job := r.newJob(jobName)
+	jobCmd := r.getCloneVolumeCmd(srcSubPath)
+	initCmd := r.genInitCommand()
+	cmd := strings.Join([]string{initCmd, jobCmd}, "\n")
+	job.Spec.Template.Spec.Containers[0].Command = []string{"sh", "-c", cmd}
+	builderLog.Info("clone volume job", "command", jobCmd)
+	return job
+}
+
+// NewJobForSetQuota returns a job which sets the capacity quota of quotaPath, in GiB. The capacity is in the job name,
+// so that a completed job of an earlier capacity which is not cleaned up by its TTL yet is not taken as this one.
+func (r *JobBuilder) NewJobForSetQuota(quotaPath string, capacityGiB int64) *batchv1.Job {
+	jobName := fmt.Sprintf("%s-quota-%d", GenJobNameByVolumeId(r.jfsSetting.VolumeId), capacityGiB)
+	job := r.newJob(jobName)
+	jobCmd := r.getSetQuotaCmd(quotaPath, capacityGiB)
+	initCmd := r.genInitCommand()
+	cmd := strings.Join([]string{initCmd, jobCmd}, "\n")
+	job.Spec.Template.Spec.Containers[0].Command = []string{"sh", "-c", cmd}
+	builderLog.Info("set quota job", "command", jobCmd)
+	return job
+}
+
+// SubdirsOutputPrefix prefixes the output line of the job listing subdirectories, which is
+// "<mtime> <name>/<mtime> <name>/...", names can't contain "/" so it's used as the separator
+const SubdirsOutputPrefix = "juicefs-subdirs:"
+
+// NewJobForListSubdirs returns a job which prints the top-level directories of the file system
+func (r *JobBuilder) NewJobForListSubdirs() *batchv1.Job {
+	jobName := GenJobNameByVolumeId(r.jfsSetting.VolumeId) + "-lsvol"
+	job := r.newJob(jobName)
+	jobCmd := r.getListSubdirsCmd()
+	initCmd := r.genInitCommand()
+	cmd := strings.Join([]string{initCmd, jobCmd}, "\n")
+	job.Spec.Template.Spec.Containers[0].Command = []string{"sh", "-c", cmd}
+	builderLog.Info("list subdirs job", "command", jobCmd)
+	return job
+}
+
 func (r *JobBuilder) NewJobForCleanCache() *batchv1.Job {
 	jobName := GenJobNameByVolumeId(r.jfsSetting.VolumeId) + "-cleancache-" + util.RandStringRunes(6)
 	job := r.newCleanJob(jobName)
@@ -102,6 +145,10 @@ func (r *JobBuilder) newJob(jobName string) *batchv1.Job {
 	podTemplate.Spec.NodeSelector = config.CSIPod.Spec.NodeSelector
 	podTemplate.Spec.Affinity = config.CSIPod.Spec.Affinity
 	podTemplate.Spec.Tolerations = config.CSIPod.Spec.Tolerations
+	if r.jfsSetting.ExternalSecrets {
+		// the secrets from the external secret provider are only on the node creating the job, see SaveSecret
+		podTemplate.Spec.NodeName = config.NodeName
+	}
 	// set priority class name to empty to make job use default priority class
 	podTemplate.Spec.PriorityClassName = ""
 	podTemplate.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
@@ -172,6 +219,44 @@ func (r *JobBuilder) getDeleteVolumeCmd() string {
 	return fmt.Sprintf("%s && if [ -d /mnt/jfs/%s ]; then %s rmr /mnt/jfs/%s; fi;", cmd, subpath, jfsPath, subpath)
 }
 
+func (r *JobBuilder) getSetQuotaCmd(quotaPath string, capacityGiB int64) string {
+	p := security.EscapeBashStr(quotaPath)
+	if r.jfsSetting.IsCe {
+		return fmt.Sprintf("%s quota set ${metaurl} --path %s --capacity %d", config.CeCliPath, p, capacityGiB)
+	}
+	return fmt.Sprintf("%s quota set %s --path %s --capacity %d", config.CliPath, security.EscapeBashStr(r.jfsSetting.Name), p, capacityGiB)
+}
+
+func (r *JobBuilder) getListSubdirsCmd() string {
+	cmd := r.getJobCommand()
+	return fmt.Sprintf(`%s && cd /mnt/jfs && echo "%s$(for d in */; do [ -d "$d" ] && printf '%%s %%s/' "$(stat -c %%Y "$d")" "${d%%/}"; done)"`,
+		cmd, SubdirsOutputPrefix)
+}
+
+func (r *JobBuilder) getCloneVolumeCmd(srcSubPath string) string {
+	cmd := r.getJobCommand()
+	src := security.EscapeBashStr(srcSubPath)
+	dst := security.EscapeBashStr(r.jfsSetting.SubPath)
+	cloning := security.EscapeBashStr(CloningPath(r.jfsSetting.SubPath))
+	// community edition uses `juicefs clone`, enterprise edition uses `juicefs snapshot`
+	cloneCmd := fmt.Sprintf("%s snapshot", config.CliPath)
+	rmrCmd := fmt.Sprintf("%s rmr", config.CliPath)
+	if r.jfsSetting.IsCe {
+		cloneCmd = fmt.Sprintf("%s clone", config.CeCliPath)
+		rmrCmd = fmt.Sprintf("%s rmr", config.CeCliPath)
+	}
+	// the partial copy left by an interrupted clone is removed first
+	return fmt.Sprintf("%s && if [ ! -d /mnt/jfs/%s ]; then mkdir -p $(dirname /mnt/jfs/%s) && "+
+		"if [ -e /mnt/jfs/%s ]; then %s /mnt/jfs/%s; fi && %s /mnt/jfs/%s /mnt/jfs/%s && mv /mnt/jfs/%s /mnt/jfs/%s; fi;",
+		cmd, dst, dst, cloning, rmrCmd, cloning, cloneCmd, src, cloning, cloning, dst)
+}
+
+// CloningPath returns the hidden path next to subPath which it's cloned into, the clone is renamed to subPath
+// once it finishes, so that a clone interrupted by a timeout or restart is never taken as a finished one.
+func CloningPath(subPath string) string {
+	return path.Join(path.Dir(subPath), "."+path.Base(subPath)+".cloning")
+}
+
 func NewFuseAbortJob(mountpod *corev1.Pod, devMinor uint32, mntPath string) *batchv1.Job {
 	jobName := fmt.Sprintf("%s-abort-fuse", GenJobNameByVolumeId(mountpod.Name))
 	ttlSecond := DefaultJobTTLSecond
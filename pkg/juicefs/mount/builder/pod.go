@@ -25,6 +25,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
@@ -51,6 +52,9 @@ func (r *PodBuilder) NewMountPod(podName string) (*corev1.Pod, error) {
 	pod.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
 
 	pod.Name = podName
+	if config.NodeUID != "" {
+		pod.Annotations[common.NodeUIDKey] = config.NodeUID
+	}
 	mountCmd := r.genMountCommand()
 	cmd := mountCmd
 	initCmd := r.genInitCommand()
@@ -101,9 +105,126 @@ func (r *PodBuilder) NewMountPod(podName string) (*corev1.Pod, error) {
 		pod.Spec.Containers[0].VolumeDevices = append(pod.Spec.Containers[0].VolumeDevices, r.jfsSetting.Attr.VolumeDevices...)
 	}
 
+	if r.jfsSetting.Rootless {
+		setRootless(pod)
+	}
+	if config.MountPodHardened {
+		r.setHardened(pod)
+	}
 	return pod, nil
 }
 
+// setRootless runs the mount pod as config.RootlessUID without privileges. It can neither open /dev/fuse
+// nor propagate mounts to the host, the mount point is mounted by the node service instead, which hands
+// over the fuse fd through the fd socket, see passfd.Fds.MountFuse. The hostPath volumes of the mount point,
+// the fd socket and cache dirs are kept, so the pod still needs the Privileged Pod Security level.
+func setRootless(pod *corev1.Pod) {
+	uid := config.RootlessUID
+	pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{
+		RunAsUser:                &uid,
+		RunAsGroup:               &uid,
+		RunAsNonRoot:             ptr.To(true),
+		AllowPrivilegeEscalation: ptr.To(false),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+	if pod.Spec.SecurityContext == nil {
+		pod.Spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	// emptyDir cache directories are writable by the user
+	pod.Spec.SecurityContext.FSGroup = &uid
+	if config.RootlessUserNamespace {
+		pod.Spec.HostUsers = ptr.To(false)
+	}
+	setHostToContainer(pod)
+}
+
+// setHardened makes the root filesystem of the mount pod read-only, with emptyDirs for the directories the
+// client writes. If the mount point is mounted by the node service, the pod also runs unprivileged with no
+// capabilities under the configured seccomp and AppArmor profiles, otherwise it has to stay privileged to
+// propagate the mount point to the host.
+func (r *PodBuilder) setHardened(pod *corev1.Pod) {
+	container := &pod.Spec.Containers[0]
+	if container.SecurityContext == nil {
+		container.SecurityContext = &corev1.SecurityContext{}
+	}
+	sc := container.SecurityContext
+	sc.ReadOnlyRootFilesystem = ptr.To(true)
+
+	writableDirs := map[string]string{"jfs-tmp": "/tmp"}
+	if !r.jfsSetting.IsCe {
+		// the client config is written by juicefs auth
+		writableDirs["jfs-client-conf"] = r.jfsSetting.ClientConfPath
+	}
+	for _, name := range []string{"jfs-tmp", "jfs-client-conf"} {
+		dir, ok := writableDirs[name]
+		if !ok || hasVolumeMount(container, dir) {
+			continue
+		}
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: name, MountPath: dir})
+	}
+
+	if !r.jfsSetting.FuseMountedByNode() {
+		log.Info("image doesn't support fuse fd passing, hardened mount pod stays privileged", "image", r.jfsSetting.Attr.Image)
+		return
+	}
+	sc.Privileged = nil
+	sc.AllowPrivilegeEscalation = ptr.To(false)
+	sc.Capabilities = &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}
+	if config.MountPodHardenedRelaxed && !r.jfsSetting.Rootless {
+		sc.Capabilities.Add = []corev1.Capability{"SYS_ADMIN"}
+	}
+	sc.SeccompProfile = mountPodSeccompProfile()
+	sc.AppArmorProfile = mountPodAppArmorProfile()
+	setHostToContainer(pod)
+}
+
+func mountPodSeccompProfile() *corev1.SeccompProfile {
+	if config.MountPodHardenedRelaxed {
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}
+	}
+	if profile, ok := strings.CutPrefix(config.MountPodSeccompProfile, "localhost/"); ok {
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: &profile}
+	}
+	return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+}
+
+func mountPodAppArmorProfile() *corev1.AppArmorProfile {
+	if config.MountPodHardenedRelaxed {
+		return &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeUnconfined}
+	}
+	if config.MountPodAppArmorProfile == "" {
+		return nil
+	}
+	if profile, ok := strings.CutPrefix(config.MountPodAppArmorProfile, "localhost/"); ok {
+		return &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeLocalhost, LocalhostProfile: &profile}
+	}
+	return &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeRuntimeDefault}
+}
+
+// setHostToContainer replaces bidirectional propagation, which is only allowed in privileged containers
+func setHostToContainer(pod *corev1.Pod) {
+	hostToContainer := corev1.MountPropagationHostToContainer
+	for i, mount := range pod.Spec.Containers[0].VolumeMounts {
+		if mount.MountPropagation != nil && *mount.MountPropagation == corev1.MountPropagationBidirectional {
+			pod.Spec.Containers[0].VolumeMounts[i].MountPropagation = &hostToContainer
+		}
+	}
+}
+
+func hasVolumeMount(container *corev1.Container, mountPath string) bool {
+	for _, mount := range container.VolumeMounts {
+		if mount.MountPath == mountPath {
+			return true
+		}
+	}
+	return false
+}
+
 // genCommonContainer: generate common privileged container
 func (r *PodBuilder) genCommonContainer() corev1.Container {
 	isPrivileged := true
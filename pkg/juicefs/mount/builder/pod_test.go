@@ -23,11 +23,13 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/yaml"
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
@@ -59,6 +61,7 @@ var (
 			Annotations: map[string]string{
 				common.JuiceFSUUID: "",
 				common.UniqueId:    "",
+				common.FsNameKey:   "test",
 			},
 			Finalizers: []string{common.Finalizer},
 		},
@@ -518,6 +521,64 @@ func TestPodMount_getCommand(t *testing.T) {
 			}
 		})
 	}
+	t.Run("test-ce-ipv6", func(t *testing.T) {
+		config.IPv6 = true
+		defer func() { config.IPv6 = false }()
+		r := PodBuilder{
+			BaseBuilder: BaseBuilder{&config.JfsSetting{
+				Name:      "test-ce-ipv6",
+				IsCe:      true,
+				MountPath: "/jfs/test-volume",
+				Attr:      &config.PodAttr{},
+			}, 0},
+		}
+		want := "exec /bin/mount.juicefs ${metaurl} /jfs/test-volume -o metrics=[::]:9567"
+		if got := r.genMountCommand(); got != want {
+			t.Errorf("getCommand() = %v, want %v", got, want)
+		}
+		r.jfsSetting.Options = []string{"metrics=[::]:9999"}
+		if got := r.genMetricsPort(); got != 9999 {
+			t.Errorf("getMetricsPort() = %v, want 9999", got)
+		}
+	})
+	t.Run("test-ce-metrics-port", func(t *testing.T) {
+		r := PodBuilder{
+			BaseBuilder: BaseBuilder{&config.JfsSetting{
+				Name:        "test-ce-metrics-port",
+				IsCe:        true,
+				MountPath:   "/jfs/test-volume",
+				MetricsPort: 9601,
+				Attr:        &config.PodAttr{HostNetwork: true},
+			}, 0},
+		}
+		want := "exec /bin/mount.juicefs ${metaurl} /jfs/test-volume -o metrics=0.0.0.0:9601"
+		if got := r.genMountCommand(); got != want {
+			t.Errorf("getCommand() = %v, want %v", got, want)
+		}
+		if got := r.genMetricsPort(); got != 9601 {
+			t.Errorf("getMetricsPort() = %v, want 9601", got)
+		}
+		r.jfsSetting.MetricsPort = 0
+		want = "exec /bin/mount.juicefs ${metaurl} /jfs/test-volume -o metrics=0.0.0.0:0"
+		if got := r.genMountCommand(); got != want {
+			t.Errorf("getCommand() = %v, want %v", got, want)
+		}
+	})
+	t.Run("test-ce-metrics-off", func(t *testing.T) {
+		r := PodBuilder{
+			BaseBuilder: BaseBuilder{&config.JfsSetting{
+				Name:       "test-ce-metrics-off",
+				IsCe:       true,
+				MountPath:  "/jfs/test-volume",
+				MetricsOff: true,
+				Attr:       &config.PodAttr{},
+			}, 0},
+		}
+		want := "exec /bin/mount.juicefs ${metaurl} /jfs/test-volume -o metrics=127.0.0.1:0"
+		if got := r.genMountCommand(); got != want {
+			t.Errorf("getCommand() = %v, want %v", got, want)
+		}
+	})
 }
 
 func TestPodMount_getMetricsPort(t *testing.T) {
@@ -615,3 +676,194 @@ func TestBuilder_genHostPathVolumes(t *testing.T) {
 		})
 	}
 }
+
+func TestSetRootless(t *testing.T) {
+	defer func() { config.RootlessUserNamespace = false }()
+	config.RootlessUserNamespace = true
+	bidirectional := corev1.MountPropagationBidirectional
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true)},
+		VolumeMounts:    []corev1.VolumeMount{{Name: JfsDirName, MountPropagation: &bidirectional}, {Name: "cachedir-0"}},
+	}}}}
+	setRootless(pod)
+
+	sc := pod.Spec.Containers[0].SecurityContext
+	if sc.Privileged != nil || *sc.RunAsUser != config.RootlessUID || !*sc.RunAsNonRoot || *sc.AllowPrivilegeEscalation {
+		t.Errorf("setRootless() security context = %+v", sc)
+	}
+	if *pod.Spec.SecurityContext.FSGroup != config.RootlessUID || *pod.Spec.HostUsers {
+		t.Errorf("setRootless() pod security context = %+v, hostUsers = %v", pod.Spec.SecurityContext, *pod.Spec.HostUsers)
+	}
+	if mp := pod.Spec.Containers[0].VolumeMounts[0].MountPropagation; *mp != corev1.MountPropagationHostToContainer {
+		t.Errorf("setRootless() mount propagation = %v", *mp)
+	}
+	if mp := pod.Spec.Containers[0].VolumeMounts[1].MountPropagation; mp != nil {
+		t.Errorf("setRootless() mount propagation = %v", *mp)
+	}
+}
+
+func TestSetHardened(t *testing.T) {
+	defer func() {
+		config.MountPodHardened = false
+		config.MountPodHardenedRelaxed = false
+		config.MountPodSeccompProfile = "runtime/default"
+	}()
+	config.MountPodHardened = true
+	config.MountPodSeccompProfile = "localhost/juicefs.json"
+	newPod := func() *corev1.Pod {
+		return &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true), RunAsUser: &rootUser},
+			VolumeMounts:    []corev1.VolumeMount{{Name: JfsDirName, MountPropagation: &mp}},
+		}}}}
+	}
+
+	r := NewPodBuilder(&config.JfsSetting{IsCe: true, Attr: &config.PodAttr{Image: "juicedata/mount:ce-nightly"}}, 0)
+	pod := newPod()
+	r.setHardened(pod)
+	sc := pod.Spec.Containers[0].SecurityContext
+	assert.Nil(t, sc.Privileged)
+	assert.True(t, *sc.ReadOnlyRootFilesystem)
+	assert.False(t, *sc.AllowPrivilegeEscalation)
+	assert.Equal(t, &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}, sc.Capabilities)
+	assert.Equal(t, corev1.SeccompProfileTypeLocalhost, sc.SeccompProfile.Type)
+	assert.Equal(t, "juicefs.json", *sc.SeccompProfile.LocalhostProfile)
+	assert.Equal(t, corev1.AppArmorProfileTypeRuntimeDefault, sc.AppArmorProfile.Type)
+	assert.Equal(t, corev1.MountPropagationHostToContainer, *pod.Spec.Containers[0].VolumeMounts[0].MountPropagation)
+	assert.Equal(t, []corev1.VolumeMount{{Name: JfsDirName, MountPropagation: pod.Spec.Containers[0].VolumeMounts[0].MountPropagation}, {Name: "jfs-tmp", MountPath: "/tmp"}}, pod.Spec.Containers[0].VolumeMounts)
+
+	config.MountPodHardenedRelaxed = true
+	pod = newPod()
+	r.setHardened(pod)
+	sc = pod.Spec.Containers[0].SecurityContext
+	assert.Equal(t, []corev1.Capability{"SYS_ADMIN"}, sc.Capabilities.Add)
+	assert.Equal(t, corev1.SeccompProfileTypeUnconfined, sc.SeccompProfile.Type)
+	assert.Equal(t, corev1.AppArmorProfileTypeUnconfined, sc.AppArmorProfile.Type)
+
+	// the pod mounts FUSE itself and stays privileged
+	r = NewPodBuilder(&config.JfsSetting{ClientConfPath: config.DefaultClientConfPath, Attr: &config.PodAttr{Image: "juicedata/mount:ee-4.9.0"}}, 0)
+	pod = newPod()
+	r.setHardened(pod)
+	sc = pod.Spec.Containers[0].SecurityContext
+	assert.True(t, *sc.Privileged)
+	assert.True(t, *sc.ReadOnlyRootFilesystem)
+	assert.Equal(t, mp, *pod.Spec.Containers[0].VolumeMounts[0].MountPropagation)
+	assert.Len(t, pod.Spec.Volumes, 2)
+	assert.Equal(t, config.DefaultClientConfPath, pod.Spec.Containers[0].VolumeMounts[2].MountPath)
+}
+
+func TestWritebackFlush(t *testing.T) {
+	setting := &config.JfsSetting{
+		IsCe:      true,
+		MountPath: "/jfs/pv-1",
+		Options:   []string{"writeback", "cache-size=1024"},
+		Attr:      &config.PodAttr{Image: "juicedata/mount:ce-v1.1.0"},
+	}
+	pod, err := NewPodBuilder(setting, 0).NewMountPod("juicefs-test")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(config.WritebackFlushTimeout.Seconds()), *pod.Spec.TerminationGracePeriodSeconds)
+	preStop := pod.Spec.Containers[0].Lifecycle.PreStop.Exec.Command[3]
+	assert.Contains(t, preStop, "/jfs/pv-1/.stats")
+	assert.True(t, strings.HasSuffix(preStop, "exit 0"))
+
+	// grace period set explicitly
+	setting.Attr.TerminationGracePeriodSeconds = ptr.To(int64(30))
+	pod, err = NewPodBuilder(setting, 0).NewMountPod("juicefs-test")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), *pod.Spec.TerminationGracePeriodSeconds)
+
+	setting.Options = []string{"cache-size=1024"}
+	setting.Attr.TerminationGracePeriodSeconds = nil
+	pod, err = NewPodBuilder(setting, 0).NewMountPod("juicefs-test")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), *pod.Spec.TerminationGracePeriodSeconds)
+	assert.NotContains(t, strings.Join(pod.Spec.Containers[0].Lifecycle.PreStop.Exec.Command, " "), ".stats")
+}
+
+func TestExternalSecrets(t *testing.T) {
+	setting := &config.JfsSetting{
+		IsCe:            true,
+		Name:            "test",
+		MetaUrl:         "redis://127.0.0.1/1",
+		Source:          "redis://127.0.0.1/1",
+		SecretKey:       "sk",
+		Envs:            map[string]string{"session-token": "x", "AWS_REGION": "us-east-1"},
+		InitConfig:      "{}",
+		CABundle:        "ca",
+		MountPath:       "/jfs/pv-1",
+		SecretName:      "juicefs-pv-1-secret",
+		ExternalSecrets: true,
+		Attr:            &config.PodAttr{Image: "juicedata/mount:ce-nightly"},
+	}
+	pod, err := NewPodBuilder(setting, 0).NewMountPod("juicefs-test")
+	assert.NoError(t, err)
+	for _, env := range pod.Spec.Containers[0].Env {
+		assert.Nil(t, env.ValueFrom, "env %s shouldn't be from the secret", env.Name)
+	}
+	var external *corev1.Volume
+	for i, v := range pod.Spec.Volumes {
+		assert.Nil(t, v.Secret, "volume %s shouldn't be from the secret", v.Name)
+		if v.Name == ExternalSecretsVolumeName {
+			external = &pod.Spec.Volumes[i]
+		}
+	}
+	if assert.NotNil(t, external) {
+		assert.Equal(t, "/run/juicefs/secrets/juicefs-pv-1-secret", external.HostPath.Path)
+	}
+	mounts := map[string]string{}
+	for _, m := range pod.Spec.Containers[0].VolumeMounts {
+		if m.Name == ExternalSecretsVolumeName {
+			assert.True(t, m.ReadOnly)
+			mounts[m.MountPath] = m.SubPath
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"/etc/juicefs-secrets":       "",
+		"/etc/juicefs/test.conf":     "initconfig",
+		"/etc/juicefs-tls/ca/ca.crt": "ca-bundle",
+	}, mounts)
+	cmd := pod.Spec.Containers[0].Command[2]
+	assert.True(t, strings.HasPrefix(cmd, `export AWS_REGION="$(cat /etc/juicefs-secrets/AWS_REGION)"
+export metaurl="$(cat /etc/juicefs-secrets/metaurl)"
+export secretkey="$(cat /etc/juicefs-secrets/secretkey)"
+cp /etc/juicefs/test.conf`), cmd)
+	assert.NotContains(t, cmd, "session-token")
+
+	config.NodeName = "node-1"
+	defer func() { config.NodeName = "" }()
+	job := NewJobBuilder(setting, 0).NewJobForDeleteVolume()
+	assert.Equal(t, "node-1", job.Spec.Template.Spec.NodeName)
+}
+
+func TestNewJobForSetQuota(t *testing.T) {
+	setting := &config.JfsSetting{
+		IsCe:     true,
+		Name:     "test",
+		VolumeId: "pvc-1",
+		MetaUrl:  "redis://127.0.0.1/1",
+		Source:   "redis://127.0.0.1/1",
+		Attr:     &config.PodAttr{Image: "juicedata/mount:ce-nightly"},
+	}
+	job10 := NewJobBuilder(setting, 0).NewJobForSetQuota("/pvc-1", 10)
+	job20 := NewJobBuilder(setting, 0).NewJobForSetQuota("/pvc-1", 20)
+	assert.Equal(t, GenJobNameByVolumeId("pvc-1")+"-quota-10", job10.Name)
+	assert.NotEqual(t, job10.Name, job20.Name)
+	assert.Contains(t, job20.Spec.Template.Spec.Containers[0].Command[2], "--capacity 20")
+}
+
+func TestNewJobForCloneVolume(t *testing.T) {
+	setting := &config.JfsSetting{
+		IsCe:     true,
+		Name:     "test",
+		VolumeId: "pvc-1",
+		SubPath:  ".snapshots/pvc-1/daily",
+		MetaUrl:  "redis://127.0.0.1/1",
+		Source:   "redis://127.0.0.1/1",
+		Attr:     &config.PodAttr{Image: "juicedata/mount:ce-nightly"},
+	}
+	assert.Equal(t, ".snapshots/pvc-1/.daily.cloning", CloningPath(setting.SubPath))
+	job := NewJobBuilder(setting, 0).NewJobForCloneVolume("pvc-1")
+	cmd := job.Spec.Template.Spec.Containers[0].Command[2]
+	// cloned into the hidden path first, and renamed once it finishes
+	assert.Contains(t, cmd, "clone /mnt/jfs/pvc-1 /mnt/jfs/.snapshots/pvc-1/.daily.cloning && mv /mnt/jfs/.snapshots/pvc-1/.daily.cloning /mnt/jfs/.snapshots/pvc-1/daily")
+	assert.Contains(t, cmd, "rmr /mnt/jfs/.snapshots/pvc-1/.daily.cloning")
+}
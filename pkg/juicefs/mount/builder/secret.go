@@ -17,18 +17,34 @@ limitations under the License.
 package builder
 
 import (
+	"context"
+	"fmt"
+	"path/filepath"
 	"strings"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/secretprovider"
 )
 
 const (
 	checkMountScriptName = "check_mount.sh"
 	checkMountScriptPath = "/" + checkMountScriptName
+
+	// ExternalSecretsVolumeName is the volume of the secrets fetched from the external secret provider
+	ExternalSecretsVolumeName = "juicefs-external-secrets"
+	externalSecretsMountPath  = "/etc/juicefs-secrets"
+
+	tlsCAFile   = "ca/ca.crt"
+	tlsCertFile = "client/tls.crt"
+	tlsKeyFile  = "client/tls.key"
 )
 
 var (
@@ -68,7 +84,7 @@ func (r *BaseBuilder) NewSecret() corev1.Secret {
 	data := make(map[string]string)
 	data["jfsSettings"] = r.jfsSetting.String()
 	if r.jfsSetting.MetaUrl != "" {
-		data["metaurl"] = r.jfsSetting.MetaUrl
+		data["metaurl"] = r.genMetaUrl()
 	}
 	if r.jfsSetting.SecretKey != "" {
 		data["secretkey"] = r.jfsSetting.SecretKey
@@ -88,6 +104,13 @@ func (r *BaseBuilder) NewSecret() corev1.Secret {
 	if r.jfsSetting.InitConfig != "" {
 		data["initconfig"] = r.jfsSetting.InitConfig
 	}
+	if r.jfsSetting.CABundle != "" {
+		data["ca-bundle"] = r.jfsSetting.CABundle
+	}
+	if r.jfsSetting.TLSCert != "" && r.jfsSetting.TLSKey != "" {
+		data["tls-cert"] = r.jfsSetting.TLSCert
+		data["tls-key"] = r.jfsSetting.TLSKey
+	}
 	replacer := strings.NewReplacer("¬", "`")
 	data[checkMountScriptName] = replacer.Replace(checkMountScriptContent)
 	if options, err := r.jfsSetting.ParseFormatOptions(); err == nil {
@@ -113,6 +136,88 @@ func (r *BaseBuilder) NewSecret() corev1.Secret {
 	return secret
 }
 
+// genMetaUrl appends the TLS options in secret to the meta url of rediss and tikv,
+// options already set in the meta url are kept as is.
+func (r *BaseBuilder) genMetaUrl() string {
+	metaUrl := r.jfsSetting.MetaUrl
+	var keys [4]string // ca, cert, key, insecure
+	switch {
+	case strings.HasPrefix(metaUrl, "rediss://"):
+		keys = [4]string{"tls-ca-cert-file", "tls-cert-file", "tls-key-file", "insecure-skip-verify"}
+	case strings.HasPrefix(metaUrl, "tikv://"):
+		keys = [4]string{"ca", "cert", "key", ""}
+	default:
+		return metaUrl
+	}
+	params := [][2]string{}
+	if r.jfsSetting.CABundle != "" {
+		params = append(params, [2]string{keys[0], filepath.Join(config.TLSConfPath, tlsCAFile)})
+	}
+	if r.jfsSetting.TLSCert != "" && r.jfsSetting.TLSKey != "" {
+		params = append(params,
+			[2]string{keys[1], filepath.Join(config.TLSConfPath, tlsCertFile)},
+			[2]string{keys[2], filepath.Join(config.TLSConfPath, tlsKeyFile)})
+	}
+	if r.jfsSetting.TLSInsecureSkipVerify && keys[3] != "" {
+		params = append(params, [2]string{keys[3], "true"})
+	}
+	for _, p := range params {
+		if strings.Contains(metaUrl, "?"+p[0]+"=") || strings.Contains(metaUrl, "&"+p[0]+"=") {
+			continue
+		}
+		sep := "?"
+		if strings.Contains(metaUrl, "?") {
+			sep = "&"
+		}
+		metaUrl = metaUrl + sep + p[0] + "=" + p[1]
+	}
+	return metaUrl
+}
+
+// SaveSecret creates or updates the secret of the mount pod or job built with setting. Secrets fetched from an
+// external secret provider are never stored in kubernetes, they are written to ExternalSecretsPath of this node
+// instead, where the mount pod or job reads them from, see genExternalSecretsVolumes.
+func SaveSecret(ctx context.Context, client *k8sclient.K8sClient, setting *config.JfsSetting, secret *corev1.Secret) error {
+	if !setting.ExternalSecrets {
+		return resource.CreateOrUpdateSecret(ctx, client, secret)
+	}
+	uid := 0
+	if setting.Rootless {
+		uid = int(config.RootlessUID)
+	}
+	return secretprovider.WriteFiles(filepath.Join(config.ExternalSecretsPath, secret.Name), secret.StringData, uid)
+}
+
+// RemoveExternalSecrets removes the secrets written by SaveSecret for the external secret provider
+func RemoveExternalSecrets(secretName string) error {
+	return secretprovider.RemoveFiles(filepath.Join(config.ExternalSecretsPath, secretName))
+}
+
+// RemoveMountPodExternalSecrets removes the secrets from the external secret provider of the deleted mount pod,
+// unless they are still used by other mount pods of the volume on the node.
+func RemoveMountPodExternalSecrets(ctx context.Context, client *k8sclient.K8sClient, pod *corev1.Pod) error {
+	uniqueId := pod.Labels[common.PodUniqueIdLabelKey]
+	external := false
+	for _, v := range pod.Spec.Volumes {
+		external = external || v.Name == ExternalSecretsVolumeName
+	}
+	if !external || uniqueId == "" {
+		return nil
+	}
+	pods, err := client.ListPod(ctx, pod.Namespace, &metav1.LabelSelector{
+		MatchLabels: map[string]string{common.PodUniqueIdLabelKey: uniqueId},
+	}, &fields.Set{"spec.nodeName": pod.Spec.NodeName})
+	if err != nil {
+		return err
+	}
+	for _, other := range pods {
+		if other.Name != pod.Name && other.DeletionTimestamp == nil {
+			return nil
+		}
+	}
+	return RemoveExternalSecrets(fmt.Sprintf("juicefs-%s-secret", uniqueId))
+}
+
 func (r *BaseBuilder) GetEnvKey() []string {
 	keys := []string{}
 	if r.jfsSetting.MetaUrl != "" {
@@ -60,3 +60,55 @@ func TestBaseBuilder_GetEnvKey(t *testing.T) {
 		})
 	}
 }
+
+func TestBaseBuilder_genMetaUrl(t *testing.T) {
+	tests := []struct {
+		name       string
+		jfsSetting *config.JfsSetting
+		want       string
+	}{
+		{
+			name:       "no-tls",
+			jfsSetting: &config.JfsSetting{MetaUrl: "rediss://127.0.0.1:6379/1"},
+			want:       "rediss://127.0.0.1:6379/1",
+		},
+		{
+			name:       "plain-redis",
+			jfsSetting: &config.JfsSetting{MetaUrl: "redis://127.0.0.1:6379/1", CABundle: "ca"},
+			want:       "redis://127.0.0.1:6379/1",
+		},
+		{
+			name: "rediss",
+			jfsSetting: &config.JfsSetting{
+				MetaUrl:               "rediss://127.0.0.1:6379/1",
+				CABundle:              "ca",
+				TLSCert:               "cert",
+				TLSKey:                "key",
+				TLSInsecureSkipVerify: true,
+			},
+			want: "rediss://127.0.0.1:6379/1?tls-ca-cert-file=/etc/juicefs-tls/ca/ca.crt&tls-cert-file=/etc/juicefs-tls/client/tls.crt" +
+				"&tls-key-file=/etc/juicefs-tls/client/tls.key&insecure-skip-verify=true",
+		},
+		{
+			name: "tikv-keep-existing",
+			jfsSetting: &config.JfsSetting{
+				MetaUrl:               "tikv://127.0.0.1:2379/jfs?ca=/my/ca.pem",
+				CABundle:              "ca",
+				TLSCert:               "cert",
+				TLSKey:                "key",
+				TLSInsecureSkipVerify: true,
+			},
+			want: "tikv://127.0.0.1:2379/jfs?ca=/my/ca.pem&cert=/etc/juicefs-tls/client/tls.crt&key=/etc/juicefs-tls/client/tls.key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &BaseBuilder{
+				jfsSetting: tt.jfsSetting,
+			}
+			if got := r.genMetaUrl(); got != tt.want {
+				t.Errorf("genMetaUrl() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package mount
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+// stagingMetric metric of the client in .stats of the mount point, number of blocks written with writeback which are
+// staged in the cache and yet to be uploaded
+const stagingMetric = "juicefs_staging_blocks"
+
+var flushPollInterval = time.Second
+
+// parseStagingBlocks returns the staging blocks in the content of .stats, -1 if it's not reported
+func parseStagingBlocks(data []byte) int64 {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, stagingMetric) {
+			continue
+		}
+		fields := strings.Fields(line)
+		if v, err := strconv.ParseFloat(fields[len(fields)-1], 64); err == nil {
+			return int64(v)
+		}
+	}
+	return -1
+}
+
+// stagingBlocks returns the staging blocks of the client of the mount point, -1 if unknown
+func stagingBlocks(ctx context.Context, mountPath string) int64 {
+	var data []byte
+	err := util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) (err error) {
+		data, err = os.ReadFile(filepath.Join(mountPath, ".stats"))
+		return
+	})
+	if err != nil {
+		return -1
+	}
+	return parseStagingBlocks(data)
+}
+
+// waitFlushed waits until data written with writeback is uploaded by the client of the mount point, before it's
+// unmounted and the client exits, or the timeout. It returns at once if the client stages nothing.
+func waitFlushed(ctx context.Context, log klog.Logger, mountPath string, timeout time.Duration) {
+	n := stagingBlocks(ctx, mountPath)
+	if n <= 0 {
+		return
+	}
+	log.Info("wait for staged data to be uploaded before unmount", "mountPath", mountPath, "blocks", n)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for n > 0 {
+		select {
+		case <-ctx.Done():
+			log.Info("staged data is not uploaded in time, unmount anyway", "mountPath", mountPath, "blocks", n, "timeout", timeout)
+			return
+		case <-time.After(flushPollInterval):
+		}
+		n = stagingBlocks(ctx, mountPath)
+	}
+}
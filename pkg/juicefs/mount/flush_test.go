@@ -0,0 +1,64 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package mount
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/klog/v2"
+)
+
+func TestParseStagingBlocks(t *testing.T) {
+	assert.Equal(t, int64(3), parseStagingBlocks([]byte("juicefs_blockcache_blocks 10\njuicefs_staging_blocks 3\njuicefs_staging_block_bytes 12582912\n")))
+	assert.Equal(t, int64(0), parseStagingBlocks([]byte(`juicefs_staging_blocks{mp="/jfs",vol_name="myjfs"} 0`)))
+	assert.Equal(t, int64(-1), parseStagingBlocks([]byte("juicefs_blockcache_blocks 10\n")))
+}
+
+func TestWaitFlushed(t *testing.T) {
+	defer func(i time.Duration) { flushPollInterval = i }(flushPollInterval)
+	flushPollInterval = 10 * time.Millisecond
+	dir := t.TempDir()
+	stats := filepath.Join(dir, ".stats")
+	log := klog.NewKlogr()
+
+	// nothing reported
+	start := time.Now()
+	waitFlushed(context.TODO(), log, dir, time.Minute)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// returns once uploaded
+	assert.NoError(t, os.WriteFile(stats, []byte("juicefs_staging_blocks 2\n"), 0644))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(stats, []byte("juicefs_staging_blocks 0\n"), 0644)
+	}()
+	start = time.Now()
+	waitFlushed(context.TODO(), log, dir, time.Minute)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// gives up after the timeout
+	assert.NoError(t, os.WriteFile(stats, []byte("juicefs_staging_blocks 2\n"), 0644))
+	start = time.Now()
+	waitFlushed(context.TODO(), log, dir, 100*time.Millisecond)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
@@ -18,6 +18,7 @@ package mount
 
 import (
 	"context"
+	"time"
 
 	k8sMount "k8s.io/utils/mount"
 
@@ -29,9 +30,18 @@ type MntInterface interface {
 	JMount(ctx context.Context, appInfo *jfsConfig.AppInfo, jfsSetting *jfsConfig.JfsSetting) error
 	JCreateVolume(ctx context.Context, jfsSetting *jfsConfig.JfsSetting) error
 	JDeleteVolume(ctx context.Context, jfsSetting *jfsConfig.JfsSetting) error
+	JCloneVolume(ctx context.Context, jfsSetting *jfsConfig.JfsSetting, srcSubPath string) error
+	JListSubdirs(ctx context.Context, jfsSetting *jfsConfig.JfsSetting) ([]Subdir, error)
+	JSetQuota(ctx context.Context, jfsSetting *jfsConfig.JfsSetting, quotaPath string, capacityGiB int64) error
 	GetMountRef(ctx context.Context, target, podName string) (int, error) // podName is only used by podMount
 	UmountTarget(ctx context.Context, target, podName string) error       // podName is only used by podMount
 	JUmount(ctx context.Context, target, podName string) error            // podName is only used by podMount
 	AddRefOfMount(ctx context.Context, target string, podName string) error
 	CleanCache(ctx context.Context, image string, id string, volumeId string, cacheDirs []string) error
 }
+
+// Subdir is a top-level directory in the file system, hidden ones are not listed
+type Subdir struct {
+	Name    string
+	ModTime time.Time
+}
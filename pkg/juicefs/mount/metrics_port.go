@@ -0,0 +1,93 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package mount
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	jfsConfig "github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+// portReservationTTL is how long an assigned port is reserved before the mount pod shows up in the list
+const portReservationTTL = time.Minute
+
+// metricsPorts are the ports assigned recently, mount pods of different volumes may be created concurrently
+var metricsPorts = &portReservations{reserved: map[int32]time.Time{}}
+
+type portReservations struct {
+	sync.Mutex
+	reserved map[int32]time.Time
+}
+
+// AllocateMetricsPort assigns a metrics port in config.MountMetricsPortRange to the mount pod of the setting,
+// unique among the mount pods on the node. Only mount pods of community edition on the host network need it,
+// others listen on 9567 in their own network namespace. Nothing is assigned if the range is not set, the port is
+// set by the metrics mount option, or metrics are off, and the mount pod listens on a random port as before.
+func AllocateMetricsPort(ctx context.Context, client *k8sclient.K8sClient, setting *jfsConfig.JfsSetting) error {
+	if jfsConfig.MountMetricsPortRange == "" || client == nil || !setting.IsCe || setting.MetricsOff ||
+		setting.Attr == nil || !setting.Attr.HostNetwork || util.ContainsPrefix(setting.Options, "metrics=") {
+		return nil
+	}
+	min, max, err := jfsConfig.ParsePortRange(jfsConfig.MountMetricsPortRange)
+	if err != nil {
+		return err
+	}
+
+	metricsPorts.Lock()
+	defer metricsPorts.Unlock()
+	used := map[int32]bool{}
+	now := time.Now()
+	for port, at := range metricsPorts.reserved {
+		if now.Sub(at) > portReservationTTL {
+			delete(metricsPorts.reserved, port)
+			continue
+		}
+		used[port] = true
+	}
+	labelSelector := &metav1.LabelSelector{MatchLabels: map[string]string{common.PodTypeKey: common.PodTypeValue}}
+	fieldSelector := &fields.Set{"spec.nodeName": jfsConfig.NodeName}
+	pods, err := client.ListPod(ctx, jfsConfig.Namespace, labelSelector, fieldSelector)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != jfsConfig.NodeName {
+			continue
+		}
+		if port, err := strconv.ParseInt(pod.Annotations[common.MetricsPortKey], 10, 32); err == nil {
+			used[int32(port)] = true
+		}
+	}
+	for port := min; port <= max; port++ {
+		if !used[port] {
+			metricsPorts.reserved[port] = now
+			setting.MetricsPort = port
+			return nil
+		}
+	}
+	return fmt.Errorf("all the %d metrics ports in %s are assigned to mount pods on node %s", max-min+1, jfsConfig.MountMetricsPortRange, jfsConfig.NodeName)
+}
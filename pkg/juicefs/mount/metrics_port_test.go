@@ -0,0 +1,83 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package mount
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	jfsConfig "github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestAllocateMetricsPort(t *testing.T) {
+	defer func(r, node, ns string) {
+		jfsConfig.MountMetricsPortRange, jfsConfig.NodeName, jfsConfig.Namespace = r, node, ns
+		metricsPorts.reserved = map[int32]time.Time{}
+	}(jfsConfig.MountMetricsPortRange, jfsConfig.NodeName, jfsConfig.Namespace)
+	jfsConfig.MountMetricsPortRange, jfsConfig.NodeName, jfsConfig.Namespace = "9600-9602", "node-1", "kube-system"
+
+	mountPod := func(name, node, port string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "kube-system",
+				Labels:      map[string]string{common.PodTypeKey: common.PodTypeValue},
+				Annotations: map[string]string{common.MetricsPortKey: port},
+			},
+			Spec: corev1.PodSpec{NodeName: node},
+		}
+	}
+	client := &k8sclient.K8sClient{Interface: fake.NewSimpleClientset(
+		mountPod("a", "node-1", "9600"),
+		mountPod("b", "node-2", "9601"),
+	)}
+	hostNetwork := func() *jfsConfig.JfsSetting {
+		return &jfsConfig.JfsSetting{IsCe: true, Attr: &jfsConfig.PodAttr{HostNetwork: true}}
+	}
+	ctx := context.TODO()
+
+	// 9600 is used on the node, 9601 is used on another node
+	s := hostNetwork()
+	assert.NoError(t, AllocateMetricsPort(ctx, client, s))
+	assert.Equal(t, int32(9601), s.MetricsPort)
+	// 9601 is reserved until the mount pod shows up
+	s = hostNetwork()
+	assert.NoError(t, AllocateMetricsPort(ctx, client, s))
+	assert.Equal(t, int32(9602), s.MetricsPort)
+	s = hostNetwork()
+	assert.ErrorContains(t, AllocateMetricsPort(ctx, client, s), "all the 3 metrics ports")
+	assert.Equal(t, int32(0), s.MetricsPort)
+
+	// not assigned
+	for _, s := range []*jfsConfig.JfsSetting{
+		{IsCe: true, Attr: &jfsConfig.PodAttr{}},
+		{IsCe: false, Attr: &jfsConfig.PodAttr{HostNetwork: true}},
+		{IsCe: true, MetricsOff: true, Attr: &jfsConfig.PodAttr{HostNetwork: true}},
+		{IsCe: true, Options: []string{"metrics=0.0.0.0:9999"}, Attr: &jfsConfig.PodAttr{HostNetwork: true}},
+	} {
+		assert.NoError(t, AllocateMetricsPort(ctx, client, s))
+		assert.Equal(t, int32(0), s.MetricsPort)
+	}
+}
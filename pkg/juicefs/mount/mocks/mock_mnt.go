@@ -10,7 +10,8 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	config "github.com/juicedata/juicefs-csi-driver/pkg/config"
-	mount "k8s.io/utils/mount"
+	mount "github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount"
+	mount0 "k8s.io/utils/mount"
 )
 
 // MockMntInterface is a mock of MntInterface interface.
@@ -109,6 +110,20 @@ func (mr *MockMntInterfaceMockRecorder) IsLikelyNotMountPoint(arg0 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsLikelyNotMountPoint", reflect.TypeOf((*MockMntInterface)(nil).IsLikelyNotMountPoint), arg0)
 }
 
+// JCloneVolume mocks base method.
+func (m *MockMntInterface) JCloneVolume(arg0 context.Context, arg1 *config.JfsSetting, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JCloneVolume", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// JCloneVolume indicates an expected call of JCloneVolume.
+func (mr *MockMntInterfaceMockRecorder) JCloneVolume(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JCloneVolume", reflect.TypeOf((*MockMntInterface)(nil).JCloneVolume), arg0, arg1, arg2)
+}
+
 // JCreateVolume mocks base method.
 func (m *MockMntInterface) JCreateVolume(arg0 context.Context, arg1 *config.JfsSetting) error {
 	m.ctrl.T.Helper()
@@ -137,6 +152,21 @@ func (mr *MockMntInterfaceMockRecorder) JDeleteVolume(arg0, arg1 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JDeleteVolume", reflect.TypeOf((*MockMntInterface)(nil).JDeleteVolume), arg0, arg1)
 }
 
+// JListSubdirs mocks base method.
+func (m *MockMntInterface) JListSubdirs(arg0 context.Context, arg1 *config.JfsSetting) ([]mount.Subdir, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JListSubdirs", arg0, arg1)
+	ret0, _ := ret[0].([]mount.Subdir)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// JListSubdirs indicates an expected call of JListSubdirs.
+func (mr *MockMntInterfaceMockRecorder) JListSubdirs(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JListSubdirs", reflect.TypeOf((*MockMntInterface)(nil).JListSubdirs), arg0, arg1)
+}
+
 // JMount mocks base method.
 func (m *MockMntInterface) JMount(arg0 context.Context, arg1 *config.AppInfo, arg2 *config.JfsSetting) error {
 	m.ctrl.T.Helper()
@@ -151,6 +181,20 @@ func (mr *MockMntInterfaceMockRecorder) JMount(arg0, arg1, arg2 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JMount", reflect.TypeOf((*MockMntInterface)(nil).JMount), arg0, arg1, arg2)
 }
 
+// JSetQuota mocks base method.
+func (m *MockMntInterface) JSetQuota(arg0 context.Context, arg1 *config.JfsSetting, arg2 string, arg3 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JSetQuota", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// JSetQuota indicates an expected call of JSetQuota.
+func (mr *MockMntInterfaceMockRecorder) JSetQuota(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JSetQuota", reflect.TypeOf((*MockMntInterface)(nil).JSetQuota), arg0, arg1, arg2, arg3)
+}
+
 // JUmount mocks base method.
 func (m *MockMntInterface) JUmount(arg0 context.Context, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
@@ -166,10 +210,10 @@ func (mr *MockMntInterfaceMockRecorder) JUmount(arg0, arg1, arg2 interface{}) *g
 }
 
 // List mocks base method.
-func (m *MockMntInterface) List() ([]mount.MountPoint, error) {
+func (m *MockMntInterface) List() ([]mount0.MountPoint, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "List")
-	ret0, _ := ret[0].([]mount.MountPoint)
+	ret0, _ := ret[0].([]mount0.MountPoint)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
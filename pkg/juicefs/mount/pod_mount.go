@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -40,6 +41,7 @@ import (
 	"github.com/juicedata/juicefs-csi-driver/pkg/fuse/passfd"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount/builder"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/tracing"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util/security"
@@ -85,7 +87,9 @@ func (p *PodMount) JMount(ctx context.Context, appInfo *jfsConfig.AppInfo, jfsSe
 			}
 		}
 
-		err = p.createOrAddRef(ctx, podName, jfsSetting, appInfo)
+		spanCtx, span := tracing.StartChild(ctx, "createMountPod", "pod", podName)
+		err = p.createOrAddRef(spanCtx, podName, jfsSetting, appInfo)
+		span.Finish(err)
 		if err != nil {
 			return err
 		}
@@ -94,7 +98,9 @@ func (p *PodMount) JMount(ctx context.Context, appInfo *jfsConfig.AppInfo, jfsSe
 		return err
 	}
 
-	err = p.waitUtilMountReady(ctx, jfsSetting, podName)
+	spanCtx, span := tracing.StartChild(ctx, "waitMountReady", "pod", podName)
+	err = p.waitUtilMountReady(spanCtx, jfsSetting, podName)
+	span.Finish(err)
 	if err != nil {
 		return err
 	}
@@ -225,6 +231,9 @@ func (p *PodMount) JUmount(ctx context.Context, target, podName string) error {
 				// do not return err if delete secret failed
 				log.V(1).Info("Delete secret error", "secretName", secretName, "error", err)
 			}
+			if err := builder.RemoveMountPodExternalSecrets(ctx, p.K8sClient, po); err != nil {
+				log.Error(err, "Remove external secrets of pod error", "podName", podName)
+			}
 		}
 		return nil
 	})
@@ -237,6 +246,42 @@ func (p *PodMount) JCreateVolume(ctx context.Context, jfsSetting *jfsConfig.JfsS
 	var exist *batchv1.Job
 	r := builder.NewJobBuilder(jfsSetting, 0)
 	job := r.NewJobForCreateVolume()
+	setTraceparent(ctx, job)
+	exist, err := p.K8sClient.GetJob(ctx, job.Name, job.Namespace)
+	if err != nil && k8serrors.IsNotFound(err) {
+		log.Info("create job", "jobName", job.Name)
+		exist, err = p.K8sClient.CreateJob(ctx, job)
+		if err != nil {
+			log.Error(err, "create job err", "jobName", job.Name)
+			return err
+		}
+	}
+	if err != nil {
+		log.Error(err, "get job err", "jobName", job.Name)
+		return err
+	}
+	secret := r.NewSecret()
+	builder.SetJobAsOwner(&secret, *exist)
+	if err := builder.SaveSecret(ctx, p.K8sClient, jfsSetting, &secret); err != nil {
+		return err
+	}
+	defer p.removeJobExternalSecrets(ctx, jfsSetting, secret.Name)
+	err = p.waitUtilJobCompleted(ctx, job.Name)
+	if err != nil {
+		// fall back if err
+		if e := p.K8sClient.DeleteJob(ctx, job.Name, job.Namespace); e != nil {
+			log.Error(e, "delete job error", "jobName", job.Name)
+		}
+	}
+	return err
+}
+
+func (p *PodMount) JCloneVolume(ctx context.Context, jfsSetting *jfsConfig.JfsSetting, srcSubPath string) error {
+	log := util.GenLog(ctx, p.log, "JCloneVolume")
+	var exist *batchv1.Job
+	r := builder.NewJobBuilder(jfsSetting, 0)
+	job := r.NewJobForCloneVolume(srcSubPath)
+	setTraceparent(ctx, job)
 	exist, err := p.K8sClient.GetJob(ctx, job.Name, job.Namespace)
 	if err != nil && k8serrors.IsNotFound(err) {
 		log.Info("create job", "jobName", job.Name)
@@ -252,9 +297,10 @@ func (p *PodMount) JCreateVolume(ctx context.Context, jfsSetting *jfsConfig.JfsS
 	}
 	secret := r.NewSecret()
 	builder.SetJobAsOwner(&secret, *exist)
-	if err := resource.CreateOrUpdateSecret(ctx, p.K8sClient, &secret); err != nil {
+	if err := builder.SaveSecret(ctx, p.K8sClient, jfsSetting, &secret); err != nil {
 		return err
 	}
+	defer p.removeJobExternalSecrets(ctx, jfsSetting, secret.Name)
 	err = p.waitUtilJobCompleted(ctx, job.Name)
 	if err != nil {
 		// fall back if err
@@ -285,9 +331,10 @@ func (p *PodMount) JDeleteVolume(ctx context.Context, jfsSetting *jfsConfig.JfsS
 	}
 	secret := r.NewSecret()
 	builder.SetJobAsOwner(&secret, *exist)
-	if err := resource.CreateOrUpdateSecret(ctx, p.K8sClient, &secret); err != nil {
+	if err := builder.SaveSecret(ctx, p.K8sClient, jfsSetting, &secret); err != nil {
 		return err
 	}
+	defer p.removeJobExternalSecrets(ctx, jfsSetting, secret.Name)
 	err = p.waitUtilJobCompleted(ctx, job.Name)
 	if err != nil {
 		// fall back if err
@@ -298,6 +345,135 @@ func (p *PodMount) JDeleteVolume(ctx context.Context, jfsSetting *jfsConfig.JfsS
 	return err
 }
 
+// JSetQuota sets the capacity quota of quotaPath in a job, so that CSI containers don't need to run the juicefs CLI
+func (p *PodMount) JSetQuota(ctx context.Context, jfsSetting *jfsConfig.JfsSetting, quotaPath string, capacityGiB int64) error {
+	log := util.GenLog(ctx, p.log, "JSetQuota")
+	r := builder.NewJobBuilder(jfsSetting, 0)
+	job := r.NewJobForSetQuota(quotaPath, capacityGiB)
+	setTraceparent(ctx, job)
+	exist, err := p.K8sClient.GetJob(ctx, job.Name, job.Namespace)
+	if err != nil && k8serrors.IsNotFound(err) {
+		log.Info("create job", "jobName", job.Name, "quotaPath", quotaPath, "capacity", capacityGiB)
+		exist, err = p.K8sClient.CreateJob(ctx, job)
+		if err != nil {
+			log.Error(err, "create job err", "jobName", job.Name)
+			return err
+		}
+	}
+	if err != nil {
+		log.Error(err, "get job err", "jobName", job.Name)
+		return err
+	}
+	secret := r.NewSecret()
+	builder.SetJobAsOwner(&secret, *exist)
+	if err := builder.SaveSecret(ctx, p.K8sClient, jfsSetting, &secret); err != nil {
+		return err
+	}
+	defer p.removeJobExternalSecrets(ctx, jfsSetting, secret.Name)
+	err = p.waitUtilJobCompleted(ctx, job.Name)
+	if err != nil {
+		// the job is recreated in the next attempt
+		if e := p.K8sClient.DeleteJob(ctx, job.Name, job.Namespace); e != nil {
+			log.Error(e, "delete job error", "jobName", job.Name)
+		}
+	}
+	return err
+}
+
+// JListSubdirs lists the top-level directories of the file system in a job, and reads them from its log
+func (p *PodMount) JListSubdirs(ctx context.Context, jfsSetting *jfsConfig.JfsSetting) ([]Subdir, error) {
+	log := util.GenLog(ctx, p.log, "JListSubdirs")
+	r := builder.NewJobBuilder(jfsSetting, 0)
+	job := r.NewJobForListSubdirs()
+	exist, err := p.K8sClient.GetJob(ctx, job.Name, job.Namespace)
+	if err != nil && k8serrors.IsNotFound(err) {
+		log.Info("create job", "jobName", job.Name)
+		exist, err = p.K8sClient.CreateJob(ctx, job)
+		if err != nil {
+			log.Error(err, "create job err", "jobName", job.Name)
+			return nil, err
+		}
+	}
+	if err != nil {
+		log.Error(err, "get job err", "jobName", job.Name)
+		return nil, err
+	}
+	// the output is read from the log of the job, delete the job once it's read
+	defer func() {
+		if e := p.K8sClient.DeleteJob(context.Background(), job.Name, job.Namespace); e != nil && !k8serrors.IsNotFound(e) {
+			log.Error(e, "delete job error", "jobName", job.Name)
+		}
+	}()
+	secret := r.NewSecret()
+	builder.SetJobAsOwner(&secret, *exist)
+	if err := builder.SaveSecret(ctx, p.K8sClient, jfsSetting, &secret); err != nil {
+		return nil, err
+	}
+	defer p.removeJobExternalSecrets(ctx, jfsSetting, secret.Name)
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer waitCancel()
+	for {
+		job, err := p.K8sClient.GetJob(waitCtx, job.Name, job.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("get job %s error: %v", exist.Name, err)
+		}
+		if resource.IsJobFailed(job) {
+			return nil, fmt.Errorf("job %s failed", job.Name)
+		}
+		if resource.IsJobCompleted(job) {
+			break
+		}
+		select {
+		case <-waitCtx.Done():
+			return nil, fmt.Errorf("job %s isn't completed: %v", exist.Name, waitCtx.Err())
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	pods, err := p.K8sClient.ListPod(ctx, job.Namespace, &metav1.LabelSelector{MatchLabels: map[string]string{"job-name": job.Name}}, nil)
+	if err != nil || len(pods) == 0 {
+		return nil, fmt.Errorf("get pod from job %s error %v", job.Name, err)
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		output, err := p.K8sClient.GetPodLog(ctx, pod.Name, pod.Namespace, pod.Spec.Containers[0].Name)
+		if err != nil {
+			return nil, fmt.Errorf("get log of pod %s error: %v", pod.Name, err)
+		}
+		return parseSubdirs(output)
+	}
+	return nil, fmt.Errorf("no succeeded pod of job %s", job.Name)
+}
+
+// parseSubdirs parses the output of the job listing subdirectories
+func parseSubdirs(output string) ([]Subdir, error) {
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, builder.SubdirsOutputPrefix) {
+			continue
+		}
+		var subdirs []Subdir
+		for _, item := range strings.Split(strings.TrimPrefix(line, builder.SubdirsOutputPrefix), "/") {
+			if item == "" {
+				continue
+			}
+			mtime, name, found := strings.Cut(item, " ")
+			if !found {
+				return nil, fmt.Errorf("invalid subdir %q", item)
+			}
+			sec, err := strconv.ParseInt(mtime, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid mtime of subdir %q", item)
+			}
+			subdirs = append(subdirs, Subdir{Name: name, ModTime: time.Unix(sec, 0)})
+		}
+		return subdirs, nil
+	}
+	return nil, fmt.Errorf("subdirs not found in output: %s", output)
+}
+
 func (p *PodMount) genMountPodName(ctx context.Context, jfsSetting *jfsConfig.JfsSetting) (string, error) {
 	log := util.GenLog(ctx, p.log, "genMountPodName")
 	labelSelector := &metav1.LabelSelector{MatchLabels: map[string]string{
@@ -365,12 +541,16 @@ func (p *PodMount) createOrAddRef(ctx context.Context, podName string, jfsSettin
 				}
 				// pod not exist, create
 				log.Info("Need to create pod", "podName", podName)
+				if err := AllocateMetricsPort(ctx, p.K8sClient, jfsSetting); err != nil {
+					log.Error(err, "assign metrics port error, listen on a random port", "podName", podName)
+				}
 				newPod, err := r.NewMountPod(podName)
 				if err != nil {
 					log.Error(err, "Make new mount pod error", "podName", podName)
 					return err
 				}
 				newPod.Annotations[key] = jfsSetting.TargetPath
+				setTraceparent(ctx, newPod)
 				if jfsConfig.GlobalConfig.EnableNodeSelector {
 					nodeSelector := map[string]string{
 						"kubernetes.io/hostname": newPod.Spec.NodeName,
@@ -394,10 +574,24 @@ func (p *PodMount) createOrAddRef(ctx context.Context, podName string, jfsSettin
 					}
 				}
 
-				if err := resource.CreateOrUpdateSecret(ctx, p.K8sClient, &secret); err != nil {
+				if err := builder.SaveSecret(ctx, p.K8sClient, jfsSetting, &secret); err != nil {
 					return err
 				}
 
+				if jfsSetting.Rootless && !util.SupportFusePass(jfsSetting.Attr.Image) {
+					return fmt.Errorf("mount %v failed: image %s of rootless mount pod doesn't support fuse fd passing", jfsSetting.VolumeId, jfsSetting.Attr.Image)
+				}
+				if jfsSetting.FuseMountedByNode() {
+					owner := int64(0)
+					if jfsSetting.Rootless {
+						owner = jfsConfig.RootlessUID
+					}
+					// mount the mount point for the pod, it's handed over with the fuse fd
+					if err := passfd.GlobalFds.MountFuse(ctx, newPod, jfsSetting.Name, jfsSetting.MountPath, owner, owner); err != nil {
+						passfd.GlobalFds.StopFd(ctx, newPod)
+						return err
+					}
+				}
 				if util.SupportFusePass(jfsSetting.Attr.Image) {
 					if err := passfd.GlobalFds.ServeFuseFd(ctx, newPod); err != nil {
 						log.Error(err, "serve fuse fd error", "podName", podName)
@@ -408,6 +602,9 @@ func (p *PodMount) createOrAddRef(ctx context.Context, podName string, jfsSettin
 				if err != nil {
 					log.Error(err, "Create pod err, stop fuse fd server", "podName", podName)
 					passfd.GlobalFds.StopFd(ctx, newPod)
+					if jfsSetting.FuseMountedByNode() {
+						_ = p.Unmount(jfsSetting.MountPath)
+					}
 				}
 				return err
 			} else if k8serrors.IsTimeout(err) {
@@ -418,7 +615,7 @@ func (p *PodMount) createOrAddRef(ctx context.Context, podName string, jfsSettin
 			return err
 		}
 		// pod exist, add refs
-		if err = resource.CreateOrUpdateSecret(ctx, p.K8sClient, &secret); err != nil {
+		if err = builder.SaveSecret(ctx, p.K8sClient, jfsSetting, &secret); err != nil {
 			return err
 		}
 		// update mount path
@@ -436,12 +633,44 @@ func (p *PodMount) createOrAddRef(ctx context.Context, podName string, jfsSettin
 	}
 }
 
+// setTraceparent records the trace of the operation in the annotations of the mount pod or job created by it,
+// so that it can be found from the pod
+func setTraceparent(ctx context.Context, obj metav1.Object) {
+	tp := tracing.Traceparent(ctx)
+	if tp == "" {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[common.TraceparentKey] = tp
+	obj.SetAnnotations(annotations)
+}
+
+// removeJobExternalSecrets removes the secrets from the external secret provider written for the job once it's done,
+// while the Secret of other jobs is garbage collected with the job
+func (p *PodMount) removeJobExternalSecrets(ctx context.Context, jfsSetting *jfsConfig.JfsSetting, secretName string) {
+	if !jfsSetting.ExternalSecrets {
+		return
+	}
+	if err := builder.RemoveExternalSecrets(secretName); err != nil {
+		util.GenLog(ctx, p.log, "").Error(err, "remove external secrets of job error", "secretName", secretName)
+	}
+}
+
 func (p *PodMount) waitUtilMountReady(ctx context.Context, jfsSetting *jfsConfig.JfsSetting, podName string) error {
 	logger := util.GenLog(ctx, p.log, "waitUtilMountReady")
 	err := resource.WaitUtilMountReady(ctx, podName, jfsSetting.MountPath, defaultCheckTimeout)
 	if err == nil {
 		return nil
 	}
+	// containers waiting for their images have no log, report why they are waiting instead
+	if pod, err := p.K8sClient.GetPod(ctx, podName, jfsConfig.Namespace); err == nil {
+		if cn, waiting := waitingContainer(pod); waiting != nil {
+			return fmt.Errorf("mount %v at %v failed, mountpod: %s, container %s is waiting: %s: %s", util.StripPasswd(jfsSetting.Source), jfsSetting.MountPath, podName, cn, waiting.Reason, waiting.Message)
+		}
+	}
 	// mountpoint not ready, get mount pod log for detail
 	log, err := p.getErrContainerLog(ctx, podName)
 	if err != nil {
@@ -632,6 +861,19 @@ func (p *PodMount) getErrContainerLog(ctx context.Context, podName string) (log
 	return
 }
 
+// waitingContainer returns the container of the pod waiting for a reason other than being created
+func waitingContainer(pod *corev1.Pod) (string, *corev1.ContainerStateWaiting) {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cn := range statuses {
+		waiting := cn.State.Waiting
+		if waiting == nil || waiting.Reason == "" || waiting.Reason == "ContainerCreating" || waiting.Reason == "PodInitializing" {
+			continue
+		}
+		return cn.Name, waiting
+	}
+	return "", nil
+}
+
 func (p *PodMount) getNotCompleteCnLog(ctx context.Context, podName string) (log string, err error) {
 	pod, err := p.K8sClient.GetPod(ctx, podName, jfsConfig.Namespace)
 	if err != nil {
@@ -40,6 +40,7 @@ import (
 	jfsConfig "github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/driver/mocks"
 	"github.com/juicedata/juicefs-csi-driver/pkg/fuse/passfd"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount/builder"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
 )
@@ -868,3 +869,26 @@ func TestGetRef(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSubdirs(t *testing.T) {
+	output := "2025/01/01 00:00:00.000000 juicefs[1] <INFO>: Meta address: redis://127.0.0.1:6379/0\n" +
+		builder.SubdirsOutputPrefix + "1735689600 pvc-1/1735776000 my data/\n"
+	subdirs, err := parseSubdirs(output)
+	if err != nil {
+		t.Fatalf("parseSubdirs() error = %v", err)
+	}
+	want := []Subdir{{Name: "pvc-1", ModTime: time.Unix(1735689600, 0)}, {Name: "my data", ModTime: time.Unix(1735776000, 0)}}
+	if !reflect.DeepEqual(subdirs, want) {
+		t.Errorf("parseSubdirs() = %v, want %v", subdirs, want)
+	}
+
+	if subdirs, err := parseSubdirs(builder.SubdirsOutputPrefix + "\n"); err != nil || len(subdirs) != 0 {
+		t.Errorf("parseSubdirs() of empty file system = %v, %v", subdirs, err)
+	}
+	if _, err := parseSubdirs("mount failed"); err == nil {
+		t.Errorf("parseSubdirs() without output should fail")
+	}
+	if _, err := parseSubdirs(builder.SubdirsOutputPrefix + "now pvc-1/"); err == nil {
+		t.Errorf("parseSubdirs() with invalid mtime should fail")
+	}
+}
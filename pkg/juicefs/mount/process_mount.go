@@ -31,6 +31,8 @@ import (
 	k8sMount "k8s.io/utils/mount"
 
 	jfsConfig "github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount/builder"
+	"github.com/juicedata/juicefs-csi-driver/pkg/tracing"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
 )
 
@@ -132,6 +134,114 @@ func (p *ProcessMount) JDeleteVolume(ctx context.Context, jfsSetting *jfsConfig.
 	return nil
 }
 
+func (p *ProcessMount) JCloneVolume(ctx context.Context, jfsSetting *jfsConfig.JfsSetting, srcSubPath string) (err error) {
+	log := util.GenLog(ctx, p.log, "JCloneVolume")
+	// 1. mount juicefs
+	options := util.StripReadonlyOption(jfsSetting.Options)
+	err = p.jmount(ctx, jfsSetting.Source, jfsSetting.MountPath, jfsSetting.Storage, options, jfsSetting.Envs)
+	if err != nil {
+		return fmt.Errorf("could not mount juicefs: %v", err)
+	}
+	// 3. umount, also when the clone fails
+	defer func() {
+		if e := p.Unmount(jfsSetting.MountPath); e != nil {
+			log.Error(e, "could not unmount", "mountPath", jfsSetting.MountPath)
+			if err == nil {
+				err = fmt.Errorf("could not unmount %q: %v", jfsSetting.MountPath, e)
+			}
+		}
+	}()
+
+	// 2. clone source path into subPath
+	srcPath := filepath.Join(jfsSetting.MountPath, srcSubPath)
+	dstPath := filepath.Join(jfsSetting.MountPath, jfsSetting.SubPath)
+	var existed bool
+	if err := util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) (err error) {
+		existed, err = k8sMount.PathExists(dstPath)
+		return err
+	}); err != nil {
+		return fmt.Errorf("could not check volume path %q exists: %v", dstPath, err)
+	}
+	if existed {
+		// clones are renamed to subPath only when they finish
+		return nil
+	}
+	if err := util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) (err error) {
+		return os.MkdirAll(filepath.Dir(dstPath), os.FileMode(0777))
+	}); err != nil {
+		return fmt.Errorf("could not make parent directory of %q: %v", dstPath, err)
+	}
+	cloningPath := filepath.Join(jfsSetting.MountPath, builder.CloningPath(jfsSetting.SubPath))
+	var cloningExisted bool
+	if err := util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) (err error) {
+		cloningExisted, err = k8sMount.PathExists(cloningPath)
+		return err
+	}); err != nil {
+		return fmt.Errorf("could not check cloning path %q exists: %v", cloningPath, err)
+	}
+	if cloningExisted {
+		// left by an interrupted clone
+		stdoutStderr, err := p.RmrDir(ctx, cloningPath, jfsSetting.IsCe)
+		log.Info("rmr output", "output", string(stdoutStderr))
+		if err != nil {
+			return fmt.Errorf("could not delete partial clone %q: %v", cloningPath, err)
+		}
+	}
+	stdoutStderr, err := p.CloneDir(ctx, srcPath, cloningPath, jfsSetting.IsCe)
+	log.Info("clone output", "output", string(stdoutStderr))
+	if err != nil {
+		return fmt.Errorf("could not clone %q to %q: %v", srcPath, cloningPath, err)
+	}
+	if err := util.DoWithTimeout(ctx, defaultCheckTimeout, func(ctx context.Context) error {
+		return os.Rename(cloningPath, dstPath)
+	}); err != nil {
+		return fmt.Errorf("could not rename %q to %q: %v", cloningPath, dstPath, err)
+	}
+	return nil
+}
+
+func (p *ProcessMount) JSetQuota(ctx context.Context, jfsSetting *jfsConfig.JfsSetting, quotaPath string, capacityGiB int64) error {
+	return fmt.Errorf("setting quota in job is not supported in process mode")
+}
+
+func (p *ProcessMount) JListSubdirs(ctx context.Context, jfsSetting *jfsConfig.JfsSetting) ([]Subdir, error) {
+	// 1. mount juicefs
+	options := util.StripReadonlyOption(jfsSetting.Options)
+	err := p.jmount(ctx, jfsSetting.Source, jfsSetting.MountPath, jfsSetting.Storage, options, jfsSetting.Envs)
+	if err != nil {
+		return nil, fmt.Errorf("could not mount juicefs: %v", err)
+	}
+
+	// 2. list top-level directories
+	var subdirs []Subdir
+	err = util.DoWithTimeout(ctx, time.Minute, func(ctx context.Context) error {
+		entries, err := os.ReadDir(jfsSetting.MountPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			subdirs = append(subdirs, Subdir{Name: entry.Name(), ModTime: info.ModTime()})
+		}
+		return nil
+	})
+
+	// 3. umount
+	if e := p.Unmount(jfsSetting.MountPath); e != nil {
+		return nil, fmt.Errorf("could not unmount %q: %v", jfsSetting.MountPath, e)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not list %q: %v", jfsSetting.MountPath, err)
+	}
+	return subdirs, nil
+}
+
 func (p *ProcessMount) JMount(ctx context.Context, _ *jfsConfig.AppInfo, jfsSetting *jfsConfig.JfsSetting) error {
 	// create subpath if readonly mount
 	if jfsSetting.SubPath != "" {
@@ -143,7 +253,14 @@ func (p *ProcessMount) JMount(ctx context.Context, _ *jfsConfig.AppInfo, jfsSett
 		}
 	}
 
-	return p.jmount(ctx, jfsSetting.Source, jfsSetting.MountPath, jfsSetting.Storage, jfsSetting.Options, jfsSetting.Envs)
+	options := jfsSetting.Options
+	if jfsSetting.MountStrategy == jfsConfig.MountStrategySubdir {
+		options = jfsSetting.SubdirMountOptions()
+	}
+	ctx, span := tracing.StartChild(ctx, "mountCommand", "mountPath", jfsSetting.MountPath)
+	err := p.jmount(ctx, jfsSetting.Source, jfsSetting.MountPath, jfsSetting.Storage, options, jfsSetting.Envs)
+	span.Finish(err)
+	return err
 }
 
 func (p *ProcessMount) jmount(ctx context.Context, source, mountPath, storage string, options []string, extraEnvs map[string]string) error {
@@ -325,6 +442,7 @@ func (p *ProcessMount) JUmount(ctx context.Context, target, podName string) erro
 	// we can only unmount this when only one is left
 	// since the PVC might be used by more than one container
 	if err == nil && len(refs) == 1 {
+		waitFlushed(ctx, log, refs[0], jfsConfig.WritebackFlushTimeout)
 		log.Info("unmounting ref for target", "ref", refs[0], "target", target)
 		if err = p.Unmount(refs[0]); err != nil {
 			log.Info("error unmounting mount ref", "ref", refs[0], "error", err)
@@ -368,3 +486,14 @@ func (p *ProcessMount) RmrDir(ctx context.Context, directory string, isCeMount b
 	}
 	return p.Exec.CommandContext(ctx, jfsConfig.CliPath, "rmr", directory).CombinedOutput()
 }
+
+// CloneDir clones src into dst with metadata-only copy, `juicefs clone` for community edition
+// and `juicefs snapshot` for enterprise edition.
+func (p *ProcessMount) CloneDir(ctx context.Context, src, dst string, isCeMount bool) ([]byte, error) {
+	log := util.GenLog(ctx, p.log, "CloneDir")
+	log.Info("cloning directory", "src", src, "dst", dst)
+	if isCeMount {
+		return p.Exec.CommandContext(ctx, jfsConfig.CeCliPath, "clone", src, dst).CombinedOutput()
+	}
+	return p.Exec.CommandContext(ctx, jfsConfig.CliPath, "snapshot", src, dst).CombinedOutput()
+}
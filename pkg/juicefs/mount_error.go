@@ -0,0 +1,84 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package juicefs
+
+import (
+	"errors"
+	"strings"
+)
+
+// MountErrorClass classifies errors of JfsMount by whether retrying the mount can help
+type MountErrorClass string
+
+const (
+	// MountErrorImagePull the mount image can't be pulled, the image or the pull secrets are wrong
+	MountErrorImagePull MountErrorClass = "ImagePull"
+	// MountErrorAuthDenied the credentials of the metadata engine, the object storage or the console are rejected
+	MountErrorAuthDenied MountErrorClass = "AuthDenied"
+	// MountErrorInvalidMetaURL the metadata engine doesn't exist or isn't formatted
+	MountErrorInvalidMetaURL MountErrorClass = "InvalidMetaURL"
+	// MountErrorTransient network errors and timeouts, which may go away by retrying
+	MountErrorTransient MountErrorClass = "Transient"
+	// MountErrorUnknown anything else
+	MountErrorUnknown MountErrorClass = "Unknown"
+)
+
+// mountErrorPatterns are matched in lower case against the error, including the log of the mount pod,
+// in order of the classes, so that an auth error reported through a timeout is still fatal
+var mountErrorPatterns = []struct {
+	class    MountErrorClass
+	patterns []string
+}{
+	{MountErrorImagePull, []string{"imagepullbackoff", "errimagepull", "invalidimagename", "errimageneverpull"}},
+	{MountErrorAuthDenied, []string{
+		"noauth", "wrongpass", "invalid password", "authentication failed", "access denied", "accessdenied",
+		"invalidaccesskeyid", "signaturedoesnotmatch", "invalid token", "401 unauthorized", "403 forbidden",
+	}},
+	{MountErrorInvalidMetaURL, []string{"invalid meta driver", "database is not formatted", "unknown driver", "invalid meta url"}},
+	{MountErrorTransient, []string{
+		"i/o timeout", "connection refused", "connection reset", "no route to host", "no such host", "deadline exceeded",
+		"temporarily unavailable", "tls handshake timeout", "isn't ready in",
+	}},
+}
+
+// ClassifyMountError returns the class of the error returned by JfsMount
+func ClassifyMountError(err error) MountErrorClass {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, ErrMountLimitExceeded) {
+		return MountErrorTransient
+	}
+	msg := strings.ToLower(err.Error())
+	for _, p := range mountErrorPatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(msg, pattern) {
+				return p.class
+			}
+		}
+	}
+	return MountErrorUnknown
+}
+
+// Fatal tells if the mount keeps failing until the configuration is fixed
+func (c MountErrorClass) Fatal() bool {
+	switch c {
+	case MountErrorImagePull, MountErrorAuthDenied, MountErrorInvalidMetaURL:
+		return true
+	}
+	return false
+}
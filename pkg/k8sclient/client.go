@@ -131,6 +131,9 @@ func (k *K8sClient) CreatePod(ctx context.Context, pod *corev1.Pod) (*corev1.Pod
 	if pod == nil {
 		return nil, nil
 	}
+	if err := checkScope("", "pods", "create", pod.Namespace); err != nil {
+		return nil, err
+	}
 	mntPod, err := k.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
@@ -170,6 +173,14 @@ func (k *K8sClient) ListPod(ctx context.Context, namespace string, labelSelector
 	return podList.Items, nil
 }
 
+func (k *K8sClient) GetNode(ctx context.Context, nodeName string) (*corev1.Node, error) {
+	node, err := k.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
 func (k *K8sClient) ListNode(ctx context.Context, labelSelector *metav1.LabelSelector) ([]corev1.Node, error) {
 	listOptions := metav1.ListOptions{}
 	if labelSelector != nil {
@@ -208,6 +219,18 @@ func (k *K8sClient) GetPodLog(ctx context.Context, podName, namespace, container
 	return str, nil
 }
 
+// StreamPodLog streams the log of the container, only the last tailLines lines if tailLines > 0
+func (k *K8sClient) StreamPodLog(ctx context.Context, podName, namespace, containerName string, tailLines int64, follow bool) (io.ReadCloser, error) {
+	opts := &corev1.PodLogOptions{
+		Container: containerName,
+		Follow:    follow,
+	}
+	if tailLines > 0 {
+		opts.TailLines = &tailLines
+	}
+	return k.CoreV1().Pods(namespace).GetLogs(podName, opts).Stream(ctx)
+}
+
 func (k *K8sClient) PatchPod(ctx context.Context, podName, namespace string, data []byte, pt types.PatchType) error {
 	_, err := k.CoreV1().Pods(namespace).Patch(ctx, podName, pt, data, metav1.PatchOptions{})
 	return err
@@ -240,6 +263,9 @@ func (k *K8sClient) CreateSecret(ctx context.Context, secret *corev1.Secret) (*c
 	if secret == nil {
 		return nil, nil
 	}
+	if err := checkScope("", "secrets", "create", secret.Namespace); err != nil {
+		return nil, err
+	}
 	s, err := k.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
@@ -280,6 +306,9 @@ func (k *K8sClient) CreateJob(ctx context.Context, job *batchv1.Job) (*batchv1.J
 	if job == nil {
 		return nil, nil
 	}
+	if err := checkScope("batch", "jobs", "create", job.Namespace); err != nil {
+		return nil, err
+	}
 	created, err := k.BatchV1().Jobs(job.Namespace).Create(ctx, job, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
@@ -329,6 +358,11 @@ func (k *K8sClient) ListPersistentVolumes(ctx context.Context, labelSelector *me
 	return pvList.Items, nil
 }
 
+func (k *K8sClient) PatchPersistentVolume(ctx context.Context, pvName string, data []byte, pt types.PatchType) error {
+	_, err := k.CoreV1().PersistentVolumes().Patch(ctx, pvName, pt, data, metav1.PatchOptions{})
+	return err
+}
+
 func (k *K8sClient) ListPersistentVolumesByVolumeHandle(ctx context.Context, volumeHandle string) ([]corev1.PersistentVolume, error) {
 	pvs, err := k.ListPersistentVolumes(ctx, nil, nil)
 	if err != nil {
@@ -384,6 +418,14 @@ func (k *K8sClient) GetStorageClass(ctx context.Context, scName string) (*storag
 	return mntPod, nil
 }
 
+func (k *K8sClient) UpdateStorageClass(ctx context.Context, sc *storagev1.StorageClass) error {
+	if sc == nil {
+		return nil
+	}
+	_, err := k.StorageV1().StorageClasses().Update(ctx, sc, metav1.UpdateOptions{})
+	return err
+}
+
 func (k *K8sClient) GetDaemonSet(ctx context.Context, dsName, namespace string) (*appsv1.DaemonSet, error) {
 	ds, err := k.AppsV1().DaemonSets(namespace).Get(ctx, dsName, metav1.GetOptions{})
 	if err != nil {
@@ -443,42 +485,63 @@ func (k *K8sClient) GetConfigMap(ctx context.Context, cmName, namespace string)
 }
 
 func (k *K8sClient) CreateConfigMap(ctx context.Context, cfg *corev1.ConfigMap) error {
+	if err := checkScope("", "configmaps", "create", cfg.Namespace); err != nil {
+		return err
+	}
 	_, err := k.CoreV1().ConfigMaps(cfg.Namespace).Create(ctx, cfg, metav1.CreateOptions{})
 	return err
 }
 
 func (k *K8sClient) UpdateConfigMap(ctx context.Context, cfg *corev1.ConfigMap) error {
+	if err := checkScope("", "configmaps", "update", cfg.Namespace); err != nil {
+		return err
+	}
 	_, err := k.CoreV1().ConfigMaps(cfg.Namespace).Update(ctx, cfg, metav1.UpdateOptions{})
 	return err
 }
 
-func (k *K8sClient) CreateEvent(ctx context.Context, pod corev1.Pod, evtType, reason, message string) error {
-	now := time.Now()
-	_, err := k.CoreV1().Events(pod.Namespace).Create(ctx, &corev1.Event{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%v.%x", pod.Name, now.UnixNano()),
-			Namespace: pod.Namespace,
-		},
-		InvolvedObject: corev1.ObjectReference{
-			Kind:       pod.Kind,
-			Namespace:  pod.Namespace,
-			Name:       pod.Name,
-			UID:        pod.UID,
-			APIVersion: pod.APIVersion,
-		},
-		Reason:  reason,
-		Message: message,
-		Source: corev1.EventSource{
-			Component: "juicefs-csi-node",
-			Host:      pod.Spec.NodeName,
-		},
-		FirstTimestamp:      metav1.Time{Time: now},
-		LastTimestamp:       metav1.Time{Time: now},
-		Type:                evtType,
-		ReportingController: "juicefs-csi-node",
-		ReportingInstance:   pod.Spec.NodeName,
-	}, metav1.CreateOptions{})
-	return err
+func (k *K8sClient) DeleteConfigMap(ctx context.Context, cmName, namespace string) error {
+	if err := checkScope("", "configmaps", "delete", namespace); err != nil {
+		return err
+	}
+	return k.CoreV1().ConfigMaps(namespace).Delete(ctx, cmName, metav1.DeleteOptions{})
+}
+
+func (k *K8sClient) GetDeployment(ctx context.Context, name, namespace string) (*appsv1.Deployment, error) {
+	deploy, err := k.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return deploy, nil
+}
+
+func (k *K8sClient) CreateDeployment(ctx context.Context, deploy *appsv1.Deployment) (*appsv1.Deployment, error) {
+	if err := checkScope("apps", "deployments", "create", deploy.Namespace); err != nil {
+		return nil, err
+	}
+	return k.AppsV1().Deployments(deploy.Namespace).Create(ctx, deploy, metav1.CreateOptions{})
+}
+
+func (k *K8sClient) UpdateDeployment(ctx context.Context, deploy *appsv1.Deployment) (*appsv1.Deployment, error) {
+	if err := checkScope("apps", "deployments", "update", deploy.Namespace); err != nil {
+		return nil, err
+	}
+	return k.AppsV1().Deployments(deploy.Namespace).Update(ctx, deploy, metav1.UpdateOptions{})
+}
+
+func (k *K8sClient) GetService(ctx context.Context, name, namespace string) (*corev1.Service, error) {
+	svc, err := k.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+func (k *K8sClient) CreateService(ctx context.Context, svc *corev1.Service) (*corev1.Service, error) {
+	if err := checkScope("", "services", "create", svc.Namespace); err != nil {
+		return nil, err
+	}
+	return k.CoreV1().Services(svc.Namespace).Create(ctx, svc, metav1.CreateOptions{})
 }
 
 func (k *K8sClient) GetEvents(ctx context.Context, pod *corev1.Pod) ([]corev1.Event, error) {
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -160,7 +161,7 @@ func NewKubeletClient(host string, port int) (*KubeletClient, error) {
 }
 
 func (kc *KubeletClient) Access() error {
-	resp, err := kc.client.Get(fmt.Sprintf("https://%v:%d/pods/", kc.host, kc.port))
+	resp, err := kc.client.Get(fmt.Sprintf("https://%s/pods/", net.JoinHostPort(kc.host, strconv.Itoa(kc.port))))
 	if err != nil {
 		return err
 	}
@@ -189,7 +190,7 @@ func checkKubeletAccessErr(err error) {
 }
 
 func (kc *KubeletClient) GetNodeRunningPods() (*corev1.PodList, error) {
-	resp, err := kc.client.Get(fmt.Sprintf("https://%v:%d/pods/", kc.host, kc.port))
+	resp, err := kc.client.Get(fmt.Sprintf("https://%s/pods/", net.JoinHostPort(kc.host, strconv.Itoa(kc.port))))
 	if err != nil {
 		checkKubeletAccessErr(err)
 		return nil, err
@@ -214,3 +215,64 @@ func (kc *KubeletClient) GetNodeRunningPods() (*corev1.PodList, error) {
 	checkKubeletAccessErr(nil)
 	return podLists, nil
 }
+
+// StatsSummary is the subset of the kubelet stats summary API used by the driver
+type StatsSummary struct {
+	Node NodeStats  `json:"node"`
+	Pods []PodStats `json:"pods"`
+}
+
+type NodeStats struct {
+	Memory *MemoryStats `json:"memory,omitempty"`
+}
+
+type PodStats struct {
+	PodRef      PodReference  `json:"podRef"`
+	Memory      *MemoryStats  `json:"memory,omitempty"`
+	VolumeStats []VolumeStats `json:"volume,omitempty"`
+}
+
+// VolumeStats is the usage of a volume of the pod, PVCRef is set for volumes of PVCs
+type VolumeStats struct {
+	Name      string        `json:"name"`
+	PVCRef    *PVCReference `json:"pvcRef,omitempty"`
+	UsedBytes *uint64       `json:"usedBytes,omitempty"`
+}
+
+type PVCReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type PodReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	UID       string `json:"uid"`
+}
+
+type MemoryStats struct {
+	AvailableBytes  *uint64 `json:"availableBytes,omitempty"`
+	WorkingSetBytes *uint64 `json:"workingSetBytes,omitempty"`
+}
+
+// GetStatsSummary returns the resource usage of the node and its pods, it needs `get` permission on nodes/stats
+func (kc *KubeletClient) GetStatsSummary() (*StatsSummary, error) {
+	resp, err := kc.client.Get(fmt.Sprintf("https://%s/stats/summary", net.JoinHostPort(kc.host, strconv.Itoa(kc.port))))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	summary := &StatsSummary{}
+	if err = json.NewDecoder(resp.Body).Decode(summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2021 Juicedata Inc
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	ComponentNode       = "node"
+	ComponentController = "controller"
+)
+
+// Permission is a permission required by a component of CSI Driver. Namespaced ones are only required in the
+// namespace of mount pods, the others are required cluster-wide.
+type Permission struct {
+	Group       string
+	Resource    string
+	Subresource string
+	Verbs       []string
+	Namespaced  bool
+}
+
+func (p Permission) resource() string {
+	if p.Subresource != "" {
+		return p.Resource + "/" + p.Subresource
+	}
+	return p.Resource
+}
+
+func (p Permission) String() string {
+	resource := p.resource()
+	if p.Group != "" {
+		resource += "." + p.Group
+	}
+	return strings.Join(p.Verbs, ",") + " " + resource
+}
+
+// Features are the optional features of components which need extra permissions
+type Features struct {
+	LeaderElection         bool
+	Webhook                bool
+	StorageClassProtection bool
+	SingleNodeAccessGuard  bool
+	LabelNode              bool
+}
+
+var (
+	nodePermissions = []Permission{
+		// application pods and mount pods on the node
+		{Resource: "pods", Verbs: []string{"get", "list", "watch"}},
+		{Resource: "pods", Verbs: []string{"create", "update", "patch", "delete"}, Namespaced: true},
+		{Resource: "pods", Subresource: "log", Verbs: []string{"get"}, Namespaced: true},
+		{Resource: "pods", Subresource: "exec", Verbs: []string{"create"}, Namespaced: true},
+		{Resource: "secrets", Verbs: []string{"get", "create", "update", "patch", "delete"}, Namespaced: true},
+		{Group: "batch", Resource: "jobs", Verbs: []string{"get", "create", "delete"}, Namespaced: true},
+		{Resource: "configmaps", Verbs: []string{"get"}, Namespaced: true},
+		// exports of remote mount
+		{Group: "apps", Resource: "deployments", Verbs: []string{"get", "create", "update"}, Namespaced: true},
+		{Resource: "services", Verbs: []string{"get", "create"}, Namespaced: true},
+		{Resource: "events", Verbs: []string{"create", "patch"}},
+		// nodes are listed by label to schedule mount pods with node selector
+		{Resource: "nodes", Verbs: []string{"get", "list"}},
+		{Resource: "nodes", Subresource: "proxy", Verbs: []string{"get"}},
+		// application pods are evicted under memory pressure
+		{Resource: "pods", Subresource: "eviction", Verbs: []string{"create"}},
+		{Resource: "persistentvolumes", Verbs: []string{"get", "list", "watch"}},
+		{Resource: "persistentvolumeclaims", Verbs: []string{"get", "list", "watch"}},
+		{Group: "storage.k8s.io", Resource: "storageclasses", Verbs: []string{"get"}},
+		{Resource: "namespaces", Verbs: []string{"get"}},
+	}
+	controllerPermissions = []Permission{
+		// csi-provisioner and csi-resizer sidecars share the service account of CSI Controller
+		{Resource: "persistentvolumes", Verbs: []string{"get", "list", "watch", "create", "delete", "patch"}},
+		{Resource: "persistentvolumeclaims", Verbs: []string{"get", "list", "watch", "update", "patch"}},
+		{Resource: "persistentvolumeclaims", Subresource: "status", Verbs: []string{"patch"}},
+		{Group: "storage.k8s.io", Resource: "storageclasses", Verbs: []string{"get", "list", "watch"}},
+		{Group: "storage.k8s.io", Resource: "csinodes", Verbs: []string{"get", "list", "watch"}},
+		{Resource: "events", Verbs: []string{"list", "watch", "create", "update", "patch"}},
+		{Resource: "nodes", Verbs: []string{"get", "list", "watch"}},
+		{Resource: "namespaces", Verbs: []string{"get"}},
+		// secrets referenced by StorageClasses live in any namespace
+		{Resource: "secrets", Verbs: []string{"get"}},
+		{Resource: "secrets", Verbs: []string{"list", "watch", "create", "update", "patch", "delete"}, Namespaced: true},
+		// application pods and mount pods
+		{Resource: "pods", Verbs: []string{"get", "list", "watch"}},
+		{Resource: "pods", Verbs: []string{"create", "update", "patch", "delete"}, Namespaced: true},
+		{Resource: "pods", Subresource: "log", Verbs: []string{"get"}, Namespaced: true},
+		{Group: "batch", Resource: "jobs", Verbs: []string{"get", "list", "watch", "create", "update", "delete"}, Namespaced: true},
+		// configmaps of directory trees live in any namespace, the others are records of volume pools
+		{Resource: "configmaps", Verbs: []string{"get"}},
+		{Resource: "configmaps", Verbs: []string{"list", "watch", "create", "update", "delete"}, Namespaced: true},
+		// csi-snapshotter sidecar
+		{Group: "snapshot.storage.k8s.io", Resource: "volumesnapshotclasses", Verbs: []string{"get", "list", "watch"}},
+		{Group: "snapshot.storage.k8s.io", Resource: "volumesnapshotcontents", Verbs: []string{"get", "list", "watch", "update", "patch"}},
+		{Group: "snapshot.storage.k8s.io", Resource: "volumesnapshotcontents", Subresource: "status", Verbs: []string{"update", "patch"}},
+		// sidecars of old versions elect leader with endpoints
+		{Resource: "endpoints", Verbs: []string{"get", "list", "watch", "create", "update", "patch"}},
+	}
+	leasePermission = Permission{Group: "coordination.k8s.io", Resource: "leases", Verbs: []string{"get", "create", "update"}, Namespaced: true}
+)
+
+// RequiredPermissions returns the permissions the component requires with the features enabled
+func RequiredPermissions(component string, features Features) ([]Permission, error) {
+	var perms []Permission
+	switch component {
+	case ComponentNode:
+		perms = append(perms, nodePermissions...)
+		if features.SingleNodeAccessGuard {
+			perms = append(perms, Permission{Group: "coordination.k8s.io", Resource: "leases", Verbs: []string{"get", "create", "update", "delete"}, Namespaced: true})
+		}
+		if features.LabelNode {
+			// nodes are labeled with the file systems mounted on them
+			perms = append(perms, Permission{Resource: "nodes", Verbs: []string{"patch"}})
+		}
+	case ComponentController:
+		perms = append(perms, controllerPermissions...)
+		if features.LeaderElection {
+			perms = append(perms, leasePermission)
+		}
+		if features.Webhook {
+			// secrets of sidecars are created in the namespaces of application pods, which are checked by their owners
+			// and exec'ed into to umount
+			perms = append(perms,
+				Permission{Resource: "secrets", Verbs: []string{"create", "update", "patch"}},
+				Permission{Resource: "pods", Subresource: "exec", Verbs: []string{"create"}},
+				Permission{Group: "apps", Resource: "replicasets", Verbs: []string{"get"}},
+				Permission{Group: "apps", Resource: "statefulsets", Verbs: []string{"get"}},
+				Permission{Group: "apps", Resource: "daemonsets", Verbs: []string{"get"}},
+				Permission{Group: "batch", Resource: "jobs", Verbs: []string{"get"}},
+			)
+		}
+		if features.StorageClassProtection {
+			perms = append(perms, Permission{Group: "storage.k8s.io", Resource: "storageclasses", Verbs: []string{"update"}})
+		}
+	default:
+		return nil, fmt.Errorf("unknown component %q, must be %s or %s", component, ComponentNode, ComponentController)
+	}
+	return perms, nil
+}
+
+// VerifyPermissions checks the identity of the client has the permissions, namespaced ones are checked in namespace.
+// All the denied permissions are reported in one error.
+func (k *K8sClient) VerifyPermissions(ctx context.Context, namespace string, perms []Permission) error {
+	var denied []string
+	for _, p := range perms {
+		var verbs []string
+		for _, verb := range p.Verbs {
+			attrs := &authorizationv1.ResourceAttributes{
+				Group:       p.Group,
+				Resource:    p.Resource,
+				Subresource: p.Subresource,
+				Verb:        verb,
+			}
+			if p.Namespaced {
+				attrs.Namespace = namespace
+			}
+			review, err := k.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: attrs},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("check permission %s %s error: %v", verb, p.resource(), err)
+			}
+			if !review.Status.Allowed {
+				verbs = append(verbs, verb)
+			}
+		}
+		if len(verbs) > 0 {
+			missing := Permission{Group: p.Group, Resource: p.Resource, Subresource: p.Subresource, Verbs: verbs}.String()
+			if p.Namespaced {
+				missing += " in namespace " + namespace
+			} else {
+				missing += " cluster-wide"
+			}
+			denied = append(denied, missing)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("missing %d permissions:\n  %s", len(denied), strings.Join(denied, "\n  "))
+	}
+	return nil
+}
+
+// GenerateRBAC generates the RBAC objects granting the permissions to the service account. With namespaceScoped,
+// namespaced permissions are granted by a Role in namespace instead of the ClusterRole.
+func GenerateRBAC(name, namespace, serviceAccount string, perms []Permission, namespaceScoped bool) []runtime.Object {
+	var clusterRules, rules []rbacv1.PolicyRule
+	for _, p := range perms {
+		if namespaceScoped && p.Namespaced {
+			rules = mergeRule(rules, p)
+		} else {
+			clusterRules = mergeRule(clusterRules, p)
+		}
+	}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: serviceAccount, Namespace: namespace}}
+	objs := []runtime.Object{
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Rules:      clusterRules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Subjects:   subjects,
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name},
+		},
+	}
+	if len(rules) > 0 {
+		objs = append(objs,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Rules:      rules,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Subjects:   subjects,
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+			},
+		)
+	}
+	return objs
+}
+
+// mergeRule adds the permission to the rule of the same group and resource
+func mergeRule(rules []rbacv1.PolicyRule, p Permission) []rbacv1.PolicyRule {
+	for i, r := range rules {
+		if r.APIGroups[0] == p.Group && r.Resources[0] == p.resource() {
+			for _, verb := range p.Verbs {
+				if !contains(r.Verbs, verb) {
+					rules[i].Verbs = append(rules[i].Verbs, verb)
+				}
+			}
+			return rules
+		}
+	}
+	return append(rules, rbacv1.PolicyRule{
+		APIGroups: []string{p.Group},
+		Resources: []string{p.resource()},
+		Verbs:     append([]string{}, p.Verbs...),
+	})
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+var scope struct {
+	namespace string
+	perms     []Permission
+}
+
+// SetNamespaceScope restricts the clients to the namespace for the namespaced permissions, so that a mount pod or
+// job created outside the namespace is refused by the client instead of a confusing error of API server.
+func SetNamespaceScope(namespace string, perms []Permission) {
+	scope.namespace, scope.perms = namespace, perms
+}
+
+// checkScope checks the namespace is allowed for the verb on the resource in namespace-scoped mode
+func checkScope(group, resource, verb, namespace string) error {
+	if scope.namespace == "" || namespace == scope.namespace {
+		return nil
+	}
+	for _, p := range scope.perms {
+		if p.Group == group && p.resource() == resource && !p.Namespaced && contains(p.Verbs, verb) {
+			return nil
+		}
+	}
+	return k8serrors.NewForbidden(schema.GroupResource{Group: group, Resource: resource}, "",
+		fmt.Errorf("namespace-scoped mode only allows to %s %s in namespace %s, not %s", verb, resource, scope.namespace, namespace))
+}
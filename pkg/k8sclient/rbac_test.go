@@ -0,0 +1,522 @@
+/*
+Copyright 2021 Juicedata Inc
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+func TestVerifyPermissions(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	// exec into pods and any verb outside kube-system are denied
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = attrs.Subresource != "exec" && (attrs.Namespace == "" || attrs.Namespace == "kube-system")
+		return true, review, nil
+	})
+	client := &K8sClient{Interface: clientset}
+	perms, err := RequiredPermissions(ComponentNode, Features{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.VerifyPermissions(context.TODO(), "kube-system", perms); err == nil {
+		t.Errorf("VerifyPermissions() expect error of denied pods/exec")
+	} else if !strings.Contains(err.Error(), "create pods/exec in namespace kube-system") || !strings.HasPrefix(err.Error(), "missing 1 permissions") {
+		t.Errorf("VerifyPermissions() error = %v", err)
+	}
+	// all the namespaced permissions are denied in another namespace
+	if err := client.VerifyPermissions(context.TODO(), "juicefs", perms); err == nil || !strings.Contains(err.Error(), "get,create,update,patch,delete secrets in namespace juicefs") {
+		t.Errorf("VerifyPermissions() error = %v", err)
+	}
+	if _, err := RequiredPermissions("dashboard", Features{}); err == nil {
+		t.Errorf("RequiredPermissions() expect error of unknown component")
+	}
+}
+
+func TestGenerateRBAC(t *testing.T) {
+	perms, _ := RequiredPermissions(ComponentController, Features{LeaderElection: true})
+	objs := GenerateRBAC("juicefs-csi-controller", "kube-system", "juicefs-csi-controller-sa", perms, false)
+	if len(objs) != 2 {
+		t.Fatalf("GenerateRBAC() got %d objects, want 2", len(objs))
+	}
+	cr := objs[0].(*rbacv1.ClusterRole)
+	for _, r := range cr.Rules {
+		if r.Resources[0] == "pods" && strings.Join(r.Verbs, ",") != "get,list,watch,create,update,patch,delete" {
+			t.Errorf("GenerateRBAC() pods verbs = %v", r.Verbs)
+		}
+	}
+
+	objs = GenerateRBAC("juicefs-csi-controller", "kube-system", "juicefs-csi-controller-sa", perms, true)
+	if len(objs) != 4 {
+		t.Fatalf("GenerateRBAC() got %d objects, want 4", len(objs))
+	}
+	cr = objs[0].(*rbacv1.ClusterRole)
+	role := objs[2].(*rbacv1.Role)
+	for _, r := range cr.Rules {
+		if r.Resources[0] == "pods" && strings.Join(r.Verbs, ",") != "get,list,watch" {
+			t.Errorf("GenerateRBAC() pods verbs of ClusterRole = %v", r.Verbs)
+		}
+		if r.Resources[0] == "leases" {
+			t.Errorf("GenerateRBAC() %s should be granted by Role", r.Resources[0])
+		}
+		// configmaps of directory trees are read in any namespace
+		if r.Resources[0] == "configmaps" && strings.Join(r.Verbs, ",") != "get" {
+			t.Errorf("GenerateRBAC() configmaps verbs of ClusterRole = %v", r.Verbs)
+		}
+	}
+	if role.Namespace != "kube-system" || objs[3].(*rbacv1.RoleBinding).Subjects[0].Name != "juicefs-csi-controller-sa" {
+		t.Errorf("GenerateRBAC() role = %v", role)
+	}
+}
+
+// TestShippedRBAC checks the roles in the deployment manifests grant all the permissions components require
+func TestShippedRBAC(t *testing.T) {
+	for _, manifest := range []string{
+		"../../deploy/kubernetes/base/resources.yaml",
+		"../../deploy/k8s.yaml",
+		"../../deploy/k8s_before_v1_18.yaml",
+	} {
+		roles := shippedRoles(t, manifest)
+		for component, name := range map[string][2]string{
+			ComponentNode:       {"juicefs-csi-external-node-service-role", "juicefs-csi-node-role"},
+			ComponentController: {"juicefs-external-provisioner-role", ""},
+		} {
+			checkGranted(t, manifest, component, roles[name[0]], roles[name[1]].Rules, Features{LeaderElection: true, StorageClassProtection: true, SingleNodeAccessGuard: true})
+		}
+		// exports of remote mount are only managed in the namespace of CSI Driver
+		nodeRole := roles["juicefs-csi-external-node-service-role"]
+		for _, p := range []Permission{{Group: "apps", Resource: "deployments"}, {Resource: "services"}} {
+			if granted(nodeRole.Rules, p, "create") {
+				t.Errorf("%s of %s grants create %s cluster-wide", nodeRole.Name, manifest, p.resource())
+			}
+		}
+		// nodes are only patched with the opt-in --label-node
+		if granted(nodeRole.Rules, Permission{Resource: "nodes"}, "patch") {
+			t.Errorf("%s of %s grants patch nodes", nodeRole.Name, manifest)
+		}
+	}
+	// the webhook kustomizations patch the role of controller in base
+	for _, patch := range []string{
+		"../../deploy/kubernetes/webhook/rbac.yaml",
+		"../../deploy/kubernetes/webhook-with-certmanager/rbac.yaml",
+	} {
+		data, err := os.ReadFile(patch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ops []struct {
+			Value rbacv1.PolicyRule `json:"value"`
+		}
+		if err := yaml.Unmarshal(data, &ops); err != nil {
+			t.Fatal(err)
+		}
+		role := shippedRoles(t, "../../deploy/kubernetes/base/resources.yaml")["juicefs-external-provisioner-role"]
+		for _, op := range ops {
+			role.Rules = append(role.Rules, op.Value)
+		}
+		checkGranted(t, patch, ComponentController, role, nil, Features{LeaderElection: true, Webhook: true, StorageClassProtection: true})
+	}
+}
+
+func shippedRoles(t *testing.T, manifest string) map[string]rbacv1.ClusterRole {
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := map[string]rbacv1.ClusterRole{}
+	for _, doc := range strings.Split(string(data), "\n---") {
+		var role rbacv1.ClusterRole
+		if err := yaml.Unmarshal([]byte(doc), &role); err != nil {
+			t.Fatal(err)
+		}
+		if role.Kind == "ClusterRole" || role.Kind == "Role" {
+			roles[role.Name] = role
+		}
+	}
+	return roles
+}
+
+// checkGranted checks the permissions of component are granted by role, namespaced ones may be granted by
+// the rules of the Role in the namespace of CSI Driver as well
+func checkGranted(t *testing.T, manifest, component string, role rbacv1.ClusterRole, namespaced []rbacv1.PolicyRule, features Features) {
+	perms, _ := RequiredPermissions(component, features)
+	for _, p := range perms {
+		rules := role.Rules
+		if p.Namespaced {
+			rules = append(append([]rbacv1.PolicyRule{}, role.Rules...), namespaced...)
+		}
+		for _, verb := range p.Verbs {
+			if !granted(rules, p, verb) {
+				t.Errorf("%s of %s doesn't grant %s %s required by %s", role.Name, manifest, verb, p.resource(), component)
+			}
+		}
+	}
+}
+
+func granted(rules []rbacv1.PolicyRule, p Permission, verb string) bool {
+	for _, r := range rules {
+		if (contains(r.APIGroups, p.Group) || contains(r.APIGroups, "*")) &&
+			(contains(r.Resources, p.resource()) || contains(r.Resources, "*")) &&
+			(contains(r.Verbs, verb) || contains(r.Verbs, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNamespaceScope(t *testing.T) {
+	perms, _ := RequiredPermissions(ComponentController, Features{Webhook: true})
+	SetNamespaceScope("kube-system", perms)
+	defer SetNamespaceScope("", nil)
+	client := &K8sClient{Interface: fake.NewSimpleClientset()}
+	if _, err := client.CreatePod(context.TODO(), &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "mount", Namespace: "kube-system"}}); err != nil {
+		t.Errorf("CreatePod() in scope error = %v", err)
+	}
+	if _, err := client.CreatePod(context.TODO(), &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "mount", Namespace: "default"}}); !k8serrors.IsForbidden(err) {
+		t.Errorf("CreatePod() out of scope error = %v, want forbidden", err)
+	}
+	// secrets of sidecars are created in namespaces of applications by the webhook
+	if _, err := client.CreateSecret(context.TODO(), &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "sidecar", Namespace: "default"}}); err != nil {
+		t.Errorf("CreateSecret() of webhook error = %v", err)
+	}
+	if err := client.CreateConfigMap(context.TODO(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default"}}); !k8serrors.IsForbidden(err) {
+		t.Errorf("CreateConfigMap() out of scope error = %v, want forbidden", err)
+	}
+
+	perms, _ = RequiredPermissions(ComponentNode, Features{})
+	SetNamespaceScope("kube-system", perms)
+	if _, err := client.CreateDeployment(context.TODO(), &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "export", Namespace: "default"}}); !k8serrors.IsForbidden(err) {
+		t.Errorf("CreateDeployment() out of scope error = %v, want forbidden", err)
+	}
+	if _, err := client.CreateService(context.TODO(), &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "export", Namespace: "default"}}); !k8serrors.IsForbidden(err) {
+		t.Errorf("CreateService() out of scope error = %v, want forbidden", err)
+	}
+	if _, err := client.CreateService(context.TODO(), &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "export", Namespace: "kube-system"}}); err != nil {
+		t.Errorf("CreateService() in scope error = %v", err)
+	}
+}
+
+// apiCall is a call to API server found in the source
+type apiCall struct {
+	group, resource, verb string
+}
+
+func (c apiCall) String() string {
+	if c.group != "" {
+		return c.verb + " " + c.resource + "." + c.group
+	}
+	return c.verb + " " + c.resource
+}
+
+// funcCalls are the API calls of a function and the functions it calls, which are referred as package.Func for
+// functions and Method for methods
+type funcCalls struct {
+	calls []apiCall
+	refs  []string
+}
+
+var (
+	groupAccessors = map[string]string{
+		"CoreV1":         "",
+		"AppsV1":         "apps",
+		"BatchV1":        "batch",
+		"StorageV1":      "storage.k8s.io",
+		"CoordinationV1": "coordination.k8s.io",
+		"PolicyV1":       "policy",
+	}
+	verbMethods = map[string]apiCall{
+		"Get":              {verb: "get"},
+		"List":             {verb: "list"},
+		"Watch":            {verb: "watch"},
+		"Create":           {verb: "create"},
+		"Update":           {verb: "update"},
+		"UpdateStatus":     {resource: "status", verb: "update"},
+		"Patch":            {verb: "patch"},
+		"Delete":           {verb: "delete"},
+		"DeleteCollection": {verb: "deletecollection"},
+		"EvictV1":          {resource: "eviction", verb: "create"},
+		"GetLogs":          {resource: "log", verb: "get"},
+	}
+	// calls through the REST client which can't be derived from the typed clients
+	restCalls = map[string][]apiCall{
+		"ExecuteInContainer": {{resource: "pods/exec", verb: "create"}},
+	}
+	// components running the files of pkg/driver and pkg/controller
+	componentFiles = map[string]string{
+		"driver/attach_guard.go":                ComponentNode,
+		"driver/compat.go":                      ComponentNode,
+		"driver/fuse_health.go":                 ComponentNode,
+		"driver/handover.go":                    ComponentNode,
+		"driver/mirror.go":                      ComponentNode,
+		"driver/remote_mount.go":                ComponentNode,
+		"controller/memory_pressure.go":         ComponentNode,
+		"controller/node_labeler.go":            ComponentNode,
+		"controller/pod_driver.go":              ComponentNode,
+		"controller/pod_controller.go":          ComponentNode,
+		"controller/reconciler.go":              ComponentNode,
+		"driver/node.go":                        ComponentNode,
+		"driver/capacity_sync.go":               ComponentController,
+		"driver/checkpoint.go":                  ComponentController,
+		"driver/controller.go":                  ComponentController,
+		"driver/dir_tree.go":                    ComponentController,
+		"driver/leader.go":                      ComponentController,
+		"driver/orphan.go":                      ComponentController,
+		"driver/paused.go":                      ComponentController,
+		"driver/provisioner.go":                 ComponentController,
+		"driver/scratch.go":                     ComponentController,
+		"driver/snapshot.go":                    ComponentController,
+		"driver/stale_session.go":               ComponentController,
+		"driver/volume_pool.go":                 ComponentController,
+		"controller/app_controller.go":          ComponentController,
+		"controller/job_controller.go":          ComponentController,
+		"controller/mount_controller.go":        ComponentController,
+		"controller/pv_controller.go":           ComponentController,
+		"controller/secret_controller.go":       ComponentController,
+		"controller/storageclass_controller.go": ComponentController,
+	}
+	// packages whose methods are run by both components, their functions are only counted when called
+	sharedPackages = []string{"config", "events", "fuse", "juicefs", "util/resource"}
+)
+
+// parseFuncs parses the functions of the go files in dir, keyed by the path of the file and the reference of
+// the function
+func parseFuncs(t *testing.T, dir string, recursive bool) map[string]map[string]*funcCalls {
+	fset := token.NewFileSet()
+	files := map[string]map[string]*funcCalls{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		files[path] = fileFuncs(f)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func fileFuncs(f *ast.File) map[string]*funcCalls {
+	// local names of the imported packages
+	imports := map[string]string{}
+	for _, imp := range f.Imports {
+		path := strings.Trim(imp.Path.Value, `"`)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			imports[imp.Name.Name] = name
+		} else {
+			imports[name] = name
+		}
+	}
+	funcs := map[string]*funcCalls{}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		key := f.Name.Name + "." + fn.Name.Name
+		if fn.Recv != nil {
+			key = fn.Name.Name
+		}
+		if funcs[key] == nil {
+			funcs[key] = &funcCalls{}
+		}
+		bodyCalls(fn.Body, f.Name.Name, imports, funcs[key])
+	}
+	return funcs
+}
+
+func bodyCalls(body *ast.BlockStmt, pkg string, imports map[string]string, fc *funcCalls) {
+	// the clients of a resource assigned to variables, e.g. leases := client.CoordinationV1().Leases(ns)
+	vars := map[string]apiCall{}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for i, rhs := range n.Rhs {
+				if c, ok := resourceClient(rhs); ok && i < len(n.Lhs) {
+					if id, ok := n.Lhs[i].(*ast.Ident); ok {
+						vars[id.Name] = c
+					}
+				}
+			}
+		case *ast.CallExpr:
+			switch fun := n.Fun.(type) {
+			case *ast.Ident:
+				fc.refs = append(fc.refs, pkg+"."+fun.Name)
+			case *ast.SelectorExpr:
+				c, ok := resourceClient(fun.X)
+				id, isIdent := fun.X.(*ast.Ident)
+				if !ok && isIdent {
+					c, ok = vars[id.Name]
+				}
+				if v, isVerb := verbMethods[fun.Sel.Name]; ok && isVerb {
+					c.verb = v.verb
+					if v.resource != "" {
+						c.resource += "/" + v.resource
+					}
+					fc.calls = append(fc.calls, c)
+				} else if isIdent && imports[id.Name] != "" {
+					fc.refs = append(fc.refs, imports[id.Name]+"."+fun.Sel.Name)
+				} else {
+					fc.refs = append(fc.refs, fun.Sel.Name)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// resourceClient parses the client of a resource like client.CoreV1().Pods(namespace)
+func resourceClient(e ast.Expr) (apiCall, bool) {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return apiCall{}, false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return apiCall{}, false
+	}
+	groupCall, ok := sel.X.(*ast.CallExpr)
+	if !ok {
+		return apiCall{}, false
+	}
+	groupSel, ok := groupCall.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return apiCall{}, false
+	}
+	group, ok := groupAccessors[groupSel.Sel.Name]
+	if !ok {
+		return apiCall{}, false
+	}
+	return apiCall{group: group, resource: strings.ToLower(sel.Sel.Name)}, true
+}
+
+// TestCallSitePermissions checks the permissions components require cover all the API calls in their source,
+// the calls of the informers and caches of controller-runtime are not covered.
+func TestCallSitePermissions(t *testing.T) {
+	// methods of K8sClient and the functions of shared packages
+	funcs := map[string]*funcCalls{}
+	for _, dir := range append([]string{"k8sclient"}, sharedPackages...) {
+		for _, fileFuncs := range parseFuncs(t, filepath.Join("..", dir), dir != "k8sclient") {
+			for ref, fc := range fileFuncs {
+				if dir == "k8sclient" || strings.Contains(ref, ".") {
+					funcs[ref] = fc
+				}
+			}
+		}
+	}
+	for method, calls := range restCalls {
+		funcs[method].calls = append(funcs[method].calls, calls...)
+	}
+	var resolve func(fc *funcCalls, seen map[string]bool) []apiCall
+	resolve = func(fc *funcCalls, seen map[string]bool) []apiCall {
+		calls := append([]apiCall{}, fc.calls...)
+		for _, ref := range fc.refs {
+			if callee, ok := funcs[ref]; ok && !seen[ref] {
+				seen[ref] = true
+				calls = append(calls, resolve(callee, seen)...)
+			}
+		}
+		return calls
+	}
+
+	required := map[string]map[apiCall]bool{ComponentNode: {}, ComponentController: {}}
+	add := func(components []string, fc *funcCalls) int {
+		calls := resolve(fc, map[string]bool{})
+		for _, component := range components {
+			if required[component] == nil {
+				continue
+			}
+			for _, c := range calls {
+				required[component][c] = true
+			}
+		}
+		return len(calls)
+	}
+	for _, dir := range []string{"driver", "controller"} {
+		for path, fileFuncs := range parseFuncs(t, filepath.Join("..", dir), false) {
+			rel := filepath.ToSlash(strings.TrimPrefix(path, "../"))
+			component, ok := componentFiles[rel]
+			for _, fc := range fileFuncs {
+				if n := add([]string{component}, fc); n > 0 && !ok {
+					t.Errorf("%s calls API server but isn't in componentFiles", rel)
+					break
+				}
+			}
+		}
+	}
+	for _, dir := range sharedPackages {
+		for _, fileFuncs := range parseFuncs(t, filepath.Join("..", dir), true) {
+			for ref, fc := range fileFuncs {
+				if !strings.Contains(ref, ".") {
+					add([]string{ComponentNode, ComponentController}, fc)
+				}
+			}
+		}
+	}
+	for _, fileFuncs := range parseFuncs(t, "../webhook", true) {
+		for _, fc := range fileFuncs {
+			add([]string{ComponentController}, fc)
+		}
+	}
+
+	for component, calls := range required {
+		perms, _ := RequiredPermissions(component, Features{LeaderElection: true, Webhook: true, StorageClassProtection: true, SingleNodeAccessGuard: true, LabelNode: true})
+		var rules []rbacv1.PolicyRule
+		for _, p := range perms {
+			rules = mergeRule(rules, p)
+		}
+		for c := range calls {
+			if !granted(rules, Permission{Group: c.group, Resource: c.resource}, c.verb) {
+				t.Errorf("%s calls %s, but it isn't in the required permissions", component, c)
+			}
+		}
+	}
+}
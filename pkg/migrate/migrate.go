@@ -0,0 +1,332 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package migrate discovers workloads using JuiceFS through hostPath or flexvolume,
+// and generates the equivalent CSI StorageClass/PV/PVC for them.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+var log = klog.NewKlogr().WithName("migrate")
+
+const (
+	SourceHostPath   = "hostPath"
+	SourceFlexVolume = "flexVolume"
+
+	// MigratedFromAnnotation records the original volume of a migrated PV
+	MigratedFromAnnotation = "juicefs.com/migrated-from"
+
+	DefaultFlexDriver = "juicedata/juicefs"
+	DefaultCapacity   = "10Pi"
+)
+
+// Options of discovering and generating
+type Options struct {
+	Namespace string
+	// hostPath volumes under these prefixes are JuiceFS mount points on the host,
+	// the path relative to the prefix is used as subdir
+	HostPathPrefixes []string
+	// flexvolumes of this driver are migrated if not empty
+	FlexDriver string
+	// secret of the file system in CSI format, required for hostPath sources
+	SecretName      string
+	SecretNamespace string
+	// generate a StorageClass of this name and set it to PV and PVC if not empty
+	StorageClass string
+	Capacity     string
+}
+
+// Owner is the workload controlling the pods using the volume
+type Owner struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (o Owner) String() string {
+	return fmt.Sprintf("%s/%s/%s", o.Kind, o.Namespace, o.Name)
+}
+
+// Source is a volume in pod spec using JuiceFS without CSI
+type Source struct {
+	Type       string
+	Namespace  string
+	VolumeName string
+	// host path for hostPath, driver for flexVolume
+	Path         string
+	SubDir       string
+	MountOptions []string
+	// secret in pod namespace referenced by flexVolume
+	SecretName string
+	Owner      Owner
+	Pods       []string
+}
+
+func (s *Source) identity() string {
+	return strings.Join(append([]string{s.Type, s.Namespace, s.Path, s.SubDir, s.SecretName}, s.MountOptions...), "|")
+}
+
+// PVCName is the name of generated PVC, unique for the same source in the namespace
+func (s *Source) PVCName() string {
+	h := sha256.Sum256([]byte(s.identity()))
+	name := strings.ToLower(strings.ReplaceAll(s.VolumeName, "_", "-"))
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return fmt.Sprintf("%s-%x", strings.Trim(name, "-"), h[:4])
+}
+
+// PVName is the name of generated PV
+func (s *Source) PVName() string {
+	return fmt.Sprintf("juicefs-%s-%s", s.Namespace, s.PVCName())
+}
+
+// Plan is the result of migration planning
+type Plan struct {
+	Sources        []*Source
+	StorageClasses []storagev1.StorageClass
+	PVs            []corev1.PersistentVolume
+	PVCs           []corev1.PersistentVolumeClaim
+	// pods which can't be switched automatically, e.g. bare pods
+	Skipped []string
+}
+
+// Discover lists pods using JuiceFS by hostPath or flexvolume, sources are deduplicated
+// by owner and volume so that pods of the same workload share one PVC
+func Discover(ctx context.Context, client *k8s.K8sClient, opts Options) ([]*Source, error) {
+	pods, err := client.CoreV1().Pods(opts.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	sources := map[string]*Source{}
+	for _, pod := range pods.Items {
+		var owner *Owner
+		for _, volume := range pod.Spec.Volumes {
+			source := sourceOfVolume(&pod, volume, opts)
+			if source == nil {
+				continue
+			}
+			if owner == nil {
+				o := resolveOwner(ctx, client, &pod)
+				owner = &o
+			}
+			source.Owner = *owner
+			key := owner.String() + "|" + source.VolumeName + "|" + source.identity()
+			if s, ok := sources[key]; ok {
+				s.Pods = append(s.Pods, pod.Name)
+				continue
+			}
+			source.Pods = []string{pod.Name}
+			sources[key] = source
+		}
+	}
+	result := make([]*Source, 0, len(sources))
+	for _, s := range sources {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Owner.String() != result[j].Owner.String() {
+			return result[i].Owner.String() < result[j].Owner.String()
+		}
+		return result[i].VolumeName < result[j].VolumeName
+	})
+	return result, nil
+}
+
+func sourceOfVolume(pod *corev1.Pod, volume corev1.Volume, opts Options) *Source {
+	if volume.HostPath != nil {
+		p := path.Clean(volume.HostPath.Path)
+		for _, prefix := range opts.HostPathPrefixes {
+			prefix = path.Clean(prefix)
+			if p != prefix && !strings.HasPrefix(p, prefix+"/") {
+				continue
+			}
+			return &Source{
+				Type:       SourceHostPath,
+				Namespace:  pod.Namespace,
+				VolumeName: volume.Name,
+				Path:       p,
+				SubDir:     strings.TrimPrefix(strings.TrimPrefix(p, prefix), "/"),
+			}
+		}
+		return nil
+	}
+	if volume.FlexVolume != nil && opts.FlexDriver != "" && volume.FlexVolume.Driver == opts.FlexDriver {
+		s := &Source{
+			Type:       SourceFlexVolume,
+			Namespace:  pod.Namespace,
+			VolumeName: volume.Name,
+			Path:       volume.FlexVolume.Driver,
+		}
+		if volume.FlexVolume.SecretRef != nil {
+			s.SecretName = volume.FlexVolume.SecretRef.Name
+		}
+		keys := make([]string, 0, len(volume.FlexVolume.Options))
+		for k := range volume.FlexVolume.Options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := volume.FlexVolume.Options[k]
+			switch k {
+			case "subdir":
+				s.SubDir = strings.Trim(v, "/")
+			case "name", "token", "access-key", "secret-key", "accesskey", "secretkey", "metaurl", "bucket":
+				// file system and credentials are in the secret
+			default:
+				if v == "" || v == "true" {
+					s.MountOptions = append(s.MountOptions, k)
+				} else {
+					s.MountOptions = append(s.MountOptions, fmt.Sprintf("%s=%s", k, v))
+				}
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+func resolveOwner(ctx context.Context, client *k8s.K8sClient, pod *corev1.Pod) Owner {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return Owner{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name}
+	}
+	if ref.Kind == "ReplicaSet" {
+		rs, err := client.GetReplicaSet(ctx, ref.Name, pod.Namespace)
+		if err != nil {
+			log.Error(err, "get replicaset error", "name", ref.Name, "namespace", pod.Namespace)
+			return Owner{Kind: ref.Kind, Namespace: pod.Namespace, Name: ref.Name}
+		}
+		if rsRef := metav1.GetControllerOf(rs); rsRef != nil && rsRef.Kind == "Deployment" {
+			return Owner{Kind: rsRef.Kind, Namespace: pod.Namespace, Name: rsRef.Name}
+		}
+	}
+	return Owner{Kind: ref.Kind, Namespace: pod.Namespace, Name: ref.Name}
+}
+
+// GeneratePlan generates StorageClass/PV/PVC for sources. PVs are statically provisioned,
+// so that data in the original path is used as is.
+func GeneratePlan(sources []*Source, opts Options) (*Plan, error) {
+	capacity := opts.Capacity
+	if capacity == "" {
+		capacity = DefaultCapacity
+	}
+	quantity, err := resource.ParseQuantity(capacity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capacity %s: %v", capacity, err)
+	}
+	plan := &Plan{Sources: sources}
+	if opts.StorageClass != "" {
+		if opts.SecretName == "" {
+			return nil, fmt.Errorf("secret is required to generate storage class")
+		}
+		plan.StorageClasses = append(plan.StorageClasses, storagev1.StorageClass{
+			TypeMeta:    metav1.TypeMeta{APIVersion: "storage.k8s.io/v1", Kind: "StorageClass"},
+			ObjectMeta:  metav1.ObjectMeta{Name: opts.StorageClass},
+			Provisioner: config.DriverName,
+			Parameters: map[string]string{
+				"csi.storage.k8s.io/provisioner-secret-name":       opts.SecretName,
+				"csi.storage.k8s.io/provisioner-secret-namespace":  opts.SecretNamespace,
+				"csi.storage.k8s.io/node-publish-secret-name":      opts.SecretName,
+				"csi.storage.k8s.io/node-publish-secret-namespace": opts.SecretNamespace,
+			},
+		})
+	}
+	generated := map[string]bool{}
+	for _, s := range sources {
+		if s.Owner.Kind == "Pod" {
+			plan.Skipped = append(plan.Skipped, s.Owner.String())
+		}
+		pvName := s.PVName()
+		if generated[pvName] {
+			continue
+		}
+		generated[pvName] = true
+
+		secretName, secretNamespace := opts.SecretName, opts.SecretNamespace
+		if s.Type == SourceFlexVolume && s.SecretName != "" && opts.SecretName == "" {
+			secretName, secretNamespace = s.SecretName, s.Namespace
+		}
+		if secretName == "" {
+			return nil, fmt.Errorf("no secret for volume %s of %s, please specify one", s.VolumeName, s.Owner)
+		}
+		mountOptions := append([]string{}, s.MountOptions...)
+		if s.SubDir != "" {
+			mountOptions = append(mountOptions, "subdir=/"+s.SubDir)
+		}
+		plan.PVs = append(plan.PVs, corev1.PersistentVolume{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolume"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        pvName,
+				Labels:      map[string]string{"juicefs-name": pvName},
+				Annotations: map[string]string{MigratedFromAnnotation: fmt.Sprintf("%s:%s", s.Type, s.Path)},
+			},
+			Spec: corev1.PersistentVolumeSpec{
+				Capacity:                      corev1.ResourceList{corev1.ResourceStorage: quantity},
+				AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+				PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+				StorageClassName:              opts.StorageClass,
+				MountOptions:                  mountOptions,
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{
+						Driver:       config.DriverName,
+						VolumeHandle: pvName,
+						FSType:       "juicefs",
+						NodePublishSecretRef: &corev1.SecretReference{
+							Name:      secretName,
+							Namespace: secretNamespace,
+						},
+					},
+				},
+			},
+		})
+		plan.PVCs = append(plan.PVCs, corev1.PersistentVolumeClaim{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.PVCName(),
+				Namespace: s.Namespace,
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+				StorageClassName: &opts.StorageClass,
+				VolumeName:       pvName,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"juicefs-name": pvName},
+				},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: quantity},
+				},
+			},
+		})
+	}
+	return plan, nil
+}
@@ -0,0 +1,124 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package migrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestDiscoverAndGeneratePlan(t *testing.T) {
+	isController := true
+	hostPathVolume := corev1.Volume{
+		Name:         "data",
+		VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/jfs/myjfs/app/"}},
+	}
+	flexVolume := corev1.Volume{
+		Name: "flex",
+		VolumeSource: corev1.VolumeSource{FlexVolume: &corev1.FlexVolumeSource{
+			Driver:    DefaultFlexDriver,
+			SecretRef: &corev1.LocalObjectReference{Name: "flex-secret"},
+			Options:   map[string]string{"name": "myjfs", "subdir": "/logs", "cache-size": "1024", "writeback": "true"},
+		}},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{hostPathVolume, {Name: "other", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+		}}},
+	}
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:            "app-123",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "app", Controller: &isController}},
+	}}
+	appPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "app-123", Controller: &isController}},
+			},
+			Spec: deployment.Spec.Template.Spec,
+		}
+	}
+	barePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "bare", Namespace: "default"},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{
+			flexVolume,
+			{Name: "host", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/log"}}},
+		}},
+	}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(deployment, rs, appPod("app-123-a"), appPod("app-123-b"), barePod)}
+	ctx := context.TODO()
+
+	opts := Options{
+		HostPathPrefixes: []string{"/jfs/myjfs"},
+		FlexDriver:       DefaultFlexDriver,
+		StorageClass:     "juicefs-migrated",
+		SecretName:       "juicefs-secret",
+		SecretNamespace:  "kube-system",
+	}
+	sources, err := Discover(ctx, client, opts)
+	assert.NoError(t, err)
+	if !assert.Len(t, sources, 2) {
+		return
+	}
+	assert.Equal(t, Owner{Kind: "Deployment", Namespace: "default", Name: "app"}, sources[0].Owner)
+	assert.Equal(t, "app", sources[0].SubDir)
+	assert.ElementsMatch(t, []string{"app-123-a", "app-123-b"}, sources[0].Pods)
+	assert.Equal(t, Owner{Kind: "Pod", Namespace: "default", Name: "bare"}, sources[1].Owner)
+	assert.Equal(t, "logs", sources[1].SubDir)
+	assert.Equal(t, []string{"cache-size=1024", "writeback"}, sources[1].MountOptions)
+
+	plan, err := GeneratePlan(sources, opts)
+	assert.NoError(t, err)
+	assert.Len(t, plan.StorageClasses, 1)
+	assert.Len(t, plan.PVs, 2)
+	assert.Len(t, plan.PVCs, 2)
+	assert.Equal(t, []string{"Pod/default/bare"}, plan.Skipped)
+	pv := plan.PVs[0]
+	assert.Equal(t, []string{"subdir=/app"}, pv.Spec.MountOptions)
+	assert.Equal(t, "juicefs-secret", pv.Spec.CSI.NodePublishSecretRef.Name)
+	assert.Equal(t, pv.Name, plan.PVCs[0].Spec.VolumeName)
+	assert.Equal(t, sources[0].PVCName(), plan.PVCs[0].Name)
+
+	// hostPath source requires a secret
+	_, err = GeneratePlan(sources[:1], Options{})
+	assert.Error(t, err)
+	// flexvolume source uses its own secret
+	plan, err = GeneratePlan(sources[1:], Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "flex-secret", plan.PVs[0].Spec.CSI.NodePublishSecretRef.Name)
+	assert.Equal(t, "default", plan.PVs[0].Spec.CSI.NodePublishSecretRef.Namespace)
+
+	// switch volumes of deployment
+	assert.NoError(t, switchOwner(ctx, client, sources[0].Owner, map[string]string{"data": sources[0].PVCName()}))
+	d, err := client.AppsV1().Deployments("default").Get(ctx, "app", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, sources[0].PVCName(), d.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.NotNil(t, d.Spec.Template.Spec.Volumes[1].EmptyDir)
+	assert.Error(t, switchOwner(ctx, client, Owner{Kind: "Job", Namespace: "default", Name: "job"}, nil))
+}
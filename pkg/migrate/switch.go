@@ -0,0 +1,167 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+// Apply creates the StorageClass/PV/PVC of plan, existing ones are left untouched
+func Apply(ctx context.Context, client *k8s.K8sClient, plan *Plan) error {
+	for i := range plan.StorageClasses {
+		if _, err := client.StorageV1().StorageClasses().Create(ctx, &plan.StorageClasses[i], metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	for i := range plan.PVs {
+		if _, err := client.CoreV1().PersistentVolumes().Create(ctx, &plan.PVs[i], metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	for i := range plan.PVCs {
+		pvc := &plan.PVCs[i]
+		if _, err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(ctx, pvc, metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Switch replaces the volumes of workloads with the generated PVCs one workload at a time,
+// and waits for the rollout of each workload before moving on to the next one
+func Switch(ctx context.Context, client *k8s.K8sClient, plan *Plan, timeout time.Duration) error {
+	var owners []Owner
+	volumes := map[Owner]map[string]string{}
+	for _, s := range plan.Sources {
+		if s.Owner.Kind == "Pod" {
+			continue
+		}
+		if _, ok := volumes[s.Owner]; !ok {
+			owners = append(owners, s.Owner)
+			volumes[s.Owner] = map[string]string{}
+		}
+		volumes[s.Owner][s.VolumeName] = s.PVCName()
+	}
+	for _, owner := range owners {
+		log.Info("switch workload to CSI volumes", "workload", owner.String(), "volumes", volumes[owner])
+		if err := switchOwner(ctx, client, owner, volumes[owner]); err != nil {
+			return fmt.Errorf("switch %s: %v", owner, err)
+		}
+		if err := waitRollout(ctx, client, owner, timeout); err != nil {
+			return fmt.Errorf("wait rollout of %s: %v", owner, err)
+		}
+	}
+	return nil
+}
+
+// replaceVolumes replaces the volumes of pod template with PVCs, returns whether any volume is replaced
+func replaceVolumes(spec *corev1.PodSpec, pvcs map[string]string) bool {
+	replaced := false
+	for i, v := range spec.Volumes {
+		pvc, ok := pvcs[v.Name]
+		if !ok || (v.HostPath == nil && v.FlexVolume == nil) {
+			continue
+		}
+		spec.Volumes[i].VolumeSource = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvc},
+		}
+		replaced = true
+	}
+	return replaced
+}
+
+func switchOwner(ctx context.Context, client *k8s.K8sClient, owner Owner, pvcs map[string]string) error {
+	apps := client.AppsV1()
+	switch owner.Kind {
+	case "Deployment":
+		d, err := apps.Deployments(owner.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if replaceVolumes(&d.Spec.Template.Spec, pvcs) {
+			_, err = apps.Deployments(owner.Namespace).Update(ctx, d, metav1.UpdateOptions{})
+		}
+		return err
+	case "StatefulSet":
+		s, err := apps.StatefulSets(owner.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if replaceVolumes(&s.Spec.Template.Spec, pvcs) {
+			_, err = apps.StatefulSets(owner.Namespace).Update(ctx, s, metav1.UpdateOptions{})
+		}
+		return err
+	case "DaemonSet":
+		d, err := apps.DaemonSets(owner.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if replaceVolumes(&d.Spec.Template.Spec, pvcs) {
+			_, err = apps.DaemonSets(owner.Namespace).Update(ctx, d, metav1.UpdateOptions{})
+		}
+		return err
+	}
+	return fmt.Errorf("unsupported workload kind %s, please switch it manually", owner.Kind)
+}
+
+func waitRollout(ctx context.Context, client *k8s.K8sClient, owner Owner, timeout time.Duration) error {
+	apps := client.AppsV1()
+	return wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		switch owner.Kind {
+		case "Deployment":
+			d, err := apps.Deployments(owner.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return deploymentRolledOut(d), nil
+		case "StatefulSet":
+			s, err := apps.StatefulSets(owner.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return s.Status.ObservedGeneration >= s.Generation && s.Status.UpdateRevision == s.Status.CurrentRevision &&
+				s.Status.ReadyReplicas == s.Status.Replicas, nil
+		case "DaemonSet":
+			d, err := apps.DaemonSets(owner.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return d.Status.ObservedGeneration >= d.Generation && d.Status.UpdatedNumberScheduled == d.Status.DesiredNumberScheduled &&
+				d.Status.NumberAvailable == d.Status.DesiredNumberScheduled, nil
+		}
+		return true, nil
+	})
+}
+
+func deploymentRolledOut(d *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	return d.Status.ObservedGeneration >= d.Generation && d.Status.UpdatedReplicas == replicas &&
+		d.Status.Replicas == replicas && d.Status.AvailableReplicas == replicas
+}
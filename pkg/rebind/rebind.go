@@ -0,0 +1,203 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package rebind re-attaches PVs with Retain reclaim policy which are left Released after their PVCs
+// are deleted by accident, so that the data can be used again without hand-editing PV YAML.
+package rebind
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+// Claim is the metadata of the PVC which the PV is provisioned for, stored in common.ClaimAnnotationKey of PV
+type Claim struct {
+	Namespace   string            `json:"namespace"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// annotations set by kubernetes, which are not restored to the recreated PVC
+var ignoredAnnotationPrefixes = []string{
+	"pv.kubernetes.io/",
+	"volume.kubernetes.io/",
+	"volume.beta.kubernetes.io/",
+	"kubectl.kubernetes.io/",
+}
+
+// NewClaim returns the metadata of the PVC, without the annotations set by kubernetes
+func NewClaim(pvc *corev1.PersistentVolumeClaim) Claim {
+	claim := Claim{Namespace: pvc.Namespace, Name: pvc.Name, Labels: pvc.Labels}
+	for k, v := range pvc.Annotations {
+		if hasIgnoredPrefix(k) {
+			continue
+		}
+		if claim.Annotations == nil {
+			claim.Annotations = map[string]string{}
+		}
+		claim.Annotations[k] = v
+	}
+	return claim
+}
+
+// EncodeClaim encodes the metadata of the PVC to be stored in its PV
+func EncodeClaim(pvc *corev1.PersistentVolumeClaim) string {
+	data, _ := json.Marshal(NewClaim(pvc))
+	return string(data)
+}
+
+func hasIgnoredPrefix(key string) bool {
+	for _, prefix := range ignoredAnnotationPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListReleased returns the Released JuiceFS PVs with Retain reclaim policy
+func ListReleased(ctx context.Context, client *k8s.K8sClient) ([]corev1.PersistentVolume, error) {
+	pvs, err := client.ListPersistentVolumes(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var released []corev1.PersistentVolume
+	for _, pv := range pvs {
+		if checkReleased(&pv) == nil {
+			released = append(released, pv)
+		}
+	}
+	return released, nil
+}
+
+func checkReleased(pv *corev1.PersistentVolume) error {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName {
+		return fmt.Errorf("pv %s is not a JuiceFS volume", pv.Name)
+	}
+	if pv.Status.Phase != corev1.VolumeReleased {
+		return fmt.Errorf("pv %s is %s, not Released", pv.Name, pv.Status.Phase)
+	}
+	if pv.Spec.PersistentVolumeReclaimPolicy != corev1.PersistentVolumeReclaimRetain {
+		return fmt.Errorf("reclaim policy of pv %s is %s, not Retain", pv.Name, pv.Spec.PersistentVolumeReclaimPolicy)
+	}
+	return nil
+}
+
+// GenClaim generates the PVC to re-bind the PV, from the claim stored in PV or its claimRef
+func GenClaim(pv *corev1.PersistentVolume) (*corev1.PersistentVolumeClaim, error) {
+	claim := Claim{}
+	if data := pv.Annotations[common.ClaimAnnotationKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &claim); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation of pv %s: %v", common.ClaimAnnotationKey, pv.Name, err)
+		}
+	} else if pv.Spec.ClaimRef != nil {
+		claim.Namespace, claim.Name = pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name
+	}
+	if claim.Namespace == "" || claim.Name == "" {
+		return nil, fmt.Errorf("pvc of pv %s is unknown", pv.Name)
+	}
+	storageClassName := pv.Spec.StorageClassName
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        claim.Name,
+			Namespace:   claim.Namespace,
+			Labels:      claim.Labels,
+			Annotations: claim.Annotations,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: pv.Spec.AccessModes,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: pv.Spec.Capacity[corev1.ResourceStorage]},
+			},
+			StorageClassName: &storageClassName,
+			VolumeName:       pv.Name,
+			VolumeMode:       pv.Spec.VolumeMode,
+		},
+	}, nil
+}
+
+// Rebind makes the Released PV available again. If recreatePVC is set, the PVC is recreated and the PV is
+// reserved for it, otherwise the PV is available for any PVC referring to it by volumeName.
+func Rebind(ctx context.Context, client *k8s.K8sClient, pvName string, recreatePVC bool) (*corev1.PersistentVolumeClaim, error) {
+	pv, err := client.GetPersistentVolume(ctx, pvName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReleased(pv); err != nil {
+		return nil, err
+	}
+	if !recreatePVC {
+		return nil, patchClaimRef(ctx, client, pv.Name, nil)
+	}
+
+	pvc, err := GenClaim(pv)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := client.GetPersistentVolumeClaim(ctx, pvc.Name, pvc.Namespace)
+	switch {
+	case err == nil:
+		if existing.Spec.VolumeName != pv.Name {
+			return nil, fmt.Errorf("pvc %s/%s already exists and refers to pv %q", pvc.Namespace, pvc.Name, existing.Spec.VolumeName)
+		}
+		pvc = existing
+	case k8serrors.IsNotFound(err):
+		if pvc, err = client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	// reserve the PV for the new PVC, PV controller binds them then
+	claimRef := &corev1.ObjectReference{
+		Kind:       "PersistentVolumeClaim",
+		APIVersion: "v1",
+		Namespace:  pvc.Namespace,
+		Name:       pvc.Name,
+		UID:        pvc.UID,
+	}
+	if err := patchClaimRef(ctx, client, pv.Name, claimRef); err != nil {
+		return nil, err
+	}
+	return pvc, nil
+}
+
+// patchClaimRef replaces claimRef of the PV as a whole, which is removed if claimRef is nil
+func patchClaimRef(ctx context.Context, client *k8s.K8sClient, pvName string, claimRef *corev1.ObjectReference) error {
+	op := map[string]interface{}{"op": "remove", "path": "/spec/claimRef"}
+	if claimRef != nil {
+		op = map[string]interface{}{"op": "add", "path": "/spec/claimRef", "value": claimRef}
+	}
+	data, err := json.Marshal([]interface{}{op})
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().PersistentVolumes().Patch(ctx, pvName, types.JSONPatchType, data, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,133 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package rebind
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func releasedPV(name string, policy corev1.PersistentVolumeReclaimPolicy, annotations map[string]string) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: config.DriverName, VolumeHandle: name},
+			},
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			ClaimRef:                      &corev1.ObjectReference{Namespace: "default", Name: "data", UID: "old-uid"},
+			PersistentVolumeReclaimPolicy: policy,
+			StorageClassName:              "juicefs-sc",
+		},
+		Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeReleased},
+	}
+}
+
+func TestEncodeClaim(t *testing.T) {
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:      "data",
+		Namespace: "default",
+		Labels:    map[string]string{"app": "web"},
+		Annotations: map[string]string{
+			"juicefs/mount-cpu-limit":                  "1",
+			"pv.kubernetes.io/bind-completed":          "yes",
+			"volume.kubernetes.io/storage-provisioner": config.DriverName,
+		},
+	}}
+	pv := releasedPV("pv-1", corev1.PersistentVolumeReclaimRetain, map[string]string{common.ClaimAnnotationKey: EncodeClaim(pvc)})
+	got, err := GenClaim(pv)
+	assert.NoError(t, err)
+	assert.Equal(t, "default", got.Namespace)
+	assert.Equal(t, "data", got.Name)
+	assert.Equal(t, map[string]string{"app": "web"}, got.Labels)
+	assert.Equal(t, map[string]string{"juicefs/mount-cpu-limit": "1"}, got.Annotations)
+	assert.Equal(t, "pv-1", got.Spec.VolumeName)
+	assert.Equal(t, "juicefs-sc", *got.Spec.StorageClassName)
+	assert.Equal(t, resource.MustParse("10Gi"), got.Spec.Resources.Requests[corev1.ResourceStorage])
+
+	// fall back to claimRef
+	pv = releasedPV("pv-2", corev1.PersistentVolumeReclaimRetain, nil)
+	got, err = GenClaim(pv)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", got.Name)
+	assert.Nil(t, got.Labels)
+
+	pv.Spec.ClaimRef = nil
+	_, err = GenClaim(pv)
+	assert.Error(t, err)
+}
+
+func TestRebind(t *testing.T) {
+	ctx := context.Background()
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default", Labels: map[string]string{"app": "web"}}}
+	retained := releasedPV("pv-retain", corev1.PersistentVolumeReclaimRetain, map[string]string{common.ClaimAnnotationKey: EncodeClaim(pvc)})
+	deleted := releasedPV("pv-delete", corev1.PersistentVolumeReclaimDelete, nil)
+	bound := releasedPV("pv-bound", corev1.PersistentVolumeReclaimRetain, nil)
+	bound.Status.Phase = corev1.VolumeBound
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(retained, deleted, bound)}
+
+	pvs, err := ListReleased(ctx, client)
+	assert.NoError(t, err)
+	assert.Len(t, pvs, 1)
+	assert.Equal(t, "pv-retain", pvs[0].Name)
+
+	_, err = Rebind(ctx, client, "pv-delete", false)
+	assert.Error(t, err)
+	_, err = Rebind(ctx, client, "pv-bound", true)
+	assert.Error(t, err)
+
+	t.Run("clear claimRef", func(t *testing.T) {
+		_, err := Rebind(ctx, client, "pv-retain", false)
+		assert.NoError(t, err)
+		pv, err := client.GetPersistentVolume(ctx, "pv-retain")
+		assert.NoError(t, err)
+		assert.Nil(t, pv.Spec.ClaimRef)
+	})
+
+	t.Run("recreate pvc", func(t *testing.T) {
+		client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(retained.DeepCopy())}
+		got, err := Rebind(ctx, client, "pv-retain", true)
+		assert.NoError(t, err)
+		created, err := client.GetPersistentVolumeClaim(ctx, "data", "default")
+		assert.NoError(t, err)
+		assert.Equal(t, "pv-retain", created.Spec.VolumeName)
+		assert.Equal(t, map[string]string{"app": "web"}, created.Labels)
+		pv, err := client.GetPersistentVolume(ctx, "pv-retain")
+		assert.NoError(t, err)
+		assert.Equal(t, "data", pv.Spec.ClaimRef.Name)
+		assert.Equal(t, got.UID, pv.Spec.ClaimRef.UID)
+	})
+
+	t.Run("pvc exists for another pv", func(t *testing.T) {
+		other := pvc.DeepCopy()
+		other.Spec.VolumeName = "pv-other"
+		client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(retained.DeepCopy(), other)}
+		_, err := Rebind(ctx, client, "pv-retain", true)
+		assert.Error(t, err)
+	})
+}
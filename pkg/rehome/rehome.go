@@ -0,0 +1,511 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package rehome moves a JuiceFS PV from its PVC to another PVC, possibly in another namespace, without copying data.
+// It is used for tenant renames and migrations: the claimRef is moved to the new PVC, which inherits the labels and
+// annotations of the old one, labels used by quotas are updated on both the PVC and the PV, and the directory named
+// by pathPattern is renamed after the new PVC if required. It runs with the credentials of the caller.
+package rehome
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/rebind"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util/resource"
+)
+
+var log = klog.NewKlogr().WithName("rehome")
+
+const (
+	// RehomedFromAnnotation PVC annotation, <namespace>/<name> of the PVC which the PV is moved from
+	RehomedFromAnnotation = "juicefs.com/rehomed-from"
+	// renameSuffix of the temporary PV, PVC and pod renaming the directory
+	renameSuffix = "-rehome"
+)
+
+// Options of moving a PV
+type Options struct {
+	PV string
+	// Namespace and PVC of the new claim, which must not exist
+	Namespace string
+	PVC       string
+	// RenameDir renames the directory named by pathPattern after the new PVC, the directory is kept otherwise
+	RenameDir bool
+	// Image of the pod renaming the directory, the mount image of community edition by default
+	Image string
+	// Labels are set on the new PVC and the PV, such as the tenant label counted by quotas,
+	// RemoveLabels are removed from both
+	Labels       map[string]string
+	RemoveLabels []string
+	Timeout      time.Duration
+	DryRun       bool
+
+	pollInterval time.Duration
+}
+
+// Plan of moving a PV
+type Plan struct {
+	PV   string
+	From string
+	To   string
+	// SubPath is the directory of the PV, NewSubPath differs from it only if the directory is renamed
+	SubPath    string
+	NewSubPath string
+	// Claim is the new PVC, bound to the PV by volumeName
+	Claim *corev1.PersistentVolumeClaim
+	// PVLabels are the labels of the PV after moving
+	PVLabels map[string]string
+
+	pv     *corev1.PersistentVolume
+	oldPVC *corev1.PersistentVolumeClaim
+}
+
+// NewPlan checks the PV can be moved and plans the new PVC and directory
+func NewPlan(ctx context.Context, client *k8s.K8sClient, opts Options) (*Plan, error) {
+	pv, err := client.GetPersistentVolume(ctx, opts.PV)
+	if err != nil {
+		return nil, err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName {
+		return nil, fmt.Errorf("pv %s is not a JuiceFS volume", pv.Name)
+	}
+	if pv.Spec.ClaimRef == nil {
+		return nil, fmt.Errorf("pv %s is not claimed by any pvc", pv.Name)
+	}
+	if _, err := client.GetPersistentVolumeClaim(ctx, opts.PVC, opts.Namespace); err == nil {
+		return nil, fmt.Errorf("pvc %s/%s already exists", opts.Namespace, opts.PVC)
+	} else if !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	plan := &Plan{
+		PV:      pv.Name,
+		From:    pv.Spec.ClaimRef.Namespace + "/" + pv.Spec.ClaimRef.Name,
+		To:      opts.Namespace + "/" + opts.PVC,
+		SubPath: pv.Spec.CSI.VolumeAttributes["subPath"],
+		pv:      pv,
+	}
+	plan.NewSubPath = plan.SubPath
+
+	// the new PVC inherits the old one, or the claim stored in PV if the old one is gone
+	claim := rebind.Claim{}
+	oldPVC, err := client.GetPersistentVolumeClaim(ctx, pv.Spec.ClaimRef.Name, pv.Spec.ClaimRef.Namespace)
+	switch {
+	case err == nil && oldPVC.UID == pv.Spec.ClaimRef.UID:
+		plan.oldPVC = oldPVC
+		claim = rebind.NewClaim(oldPVC)
+	case err == nil || k8serrors.IsNotFound(err):
+		if data := pv.Annotations[common.ClaimAnnotationKey]; data != "" {
+			if err := json.Unmarshal([]byte(data), &claim); err != nil {
+				return nil, fmt.Errorf("invalid %s annotation of pv %s: %v", common.ClaimAnnotationKey, pv.Name, err)
+			}
+		}
+	default:
+		return nil, err
+	}
+	plan.Claim = newClaim(pv, plan.oldPVC, claim, opts)
+	plan.Claim.Labels = updateLabels(claim.Labels, opts)
+	plan.Claim.Annotations[RehomedFromAnnotation] = plan.From
+	plan.PVLabels = updateLabels(pv.Labels, opts)
+
+	if opts.RenameDir && pv.Spec.CSI.VolumeAttributes["pathPattern"] != "" {
+		sc, err := client.GetStorageClass(ctx, pv.Spec.StorageClassName)
+		if err != nil {
+			return nil, fmt.Errorf("get storageclass of pv %s to resolve pathPattern: %v", pv.Name, err)
+		}
+		plan.NewSubPath = resource.NewObjectMeta(*plan.Claim, nil).StringParser(sc.Parameters["pathPattern"])
+		if plan.NewSubPath == "" || path.Clean("/"+plan.NewSubPath) == "/" {
+			return nil, fmt.Errorf("pathPattern of storageclass %s is resolved to root for pvc %s", sc.Name, plan.To)
+		}
+	}
+	return plan, nil
+}
+
+// updateLabels returns a copy of labels with the labels of options set and removed
+func updateLabels(labels map[string]string, opts Options) map[string]string {
+	if len(labels) == 0 && len(opts.Labels) == 0 {
+		return labels
+	}
+	updated := make(map[string]string, len(labels)+len(opts.Labels))
+	for k, v := range labels {
+		updated[k] = v
+	}
+	for k, v := range opts.Labels {
+		updated[k] = v
+	}
+	for _, k := range opts.RemoveLabels {
+		delete(updated, k)
+	}
+	return updated
+}
+
+func newClaim(pv *corev1.PersistentVolume, oldPVC *corev1.PersistentVolumeClaim, claim rebind.Claim, opts Options) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        opts.PVC,
+			Namespace:   opts.Namespace,
+			Labels:      claim.Labels,
+			Annotations: map[string]string{},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: pv.Spec.AccessModes,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: pv.Spec.Capacity[corev1.ResourceStorage]},
+			},
+			StorageClassName: &pv.Spec.StorageClassName,
+			VolumeName:       pv.Name,
+			VolumeMode:       pv.Spec.VolumeMode,
+		},
+	}
+	if oldPVC != nil {
+		pvc.Spec.AccessModes = oldPVC.Spec.AccessModes
+		pvc.Spec.Resources = oldPVC.Spec.Resources
+	}
+	for k, v := range claim.Annotations {
+		pvc.Annotations[k] = v
+	}
+	return pvc
+}
+
+// Run moves the PV to the new PVC as planned. The old PVC must not be used by any pod, it is deleted with the PV
+// retained, then the PV is reserved for the new PVC. If the directory is renamed, the PV is recreated with the new
+// subPath, since the volume attributes of PVs are immutable. If any step fails before the directory is renamed, the
+// new PVC is deleted and the PV is bound to a recreated old PVC again.
+func Run(ctx context.Context, client *k8s.K8sClient, opts Options) (*Plan, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Minute
+	}
+	if opts.pollInterval <= 0 {
+		opts.pollInterval = 2 * time.Second
+	}
+	if opts.Image == "" {
+		opts.Image = config.DefaultCEMountImage
+	}
+	plan, err := NewPlan(ctx, client, opts)
+	if err != nil || opts.DryRun {
+		return plan, err
+	}
+	pv := plan.pv
+	if plan.oldPVC != nil {
+		if pod, err := usedBy(ctx, client, plan.oldPVC); err != nil {
+			return plan, err
+		} else if pod != "" {
+			return plan, fmt.Errorf("pvc %s is used by pod %s, stop it first", plan.From, pod)
+		}
+	}
+
+	// keep the data when the old PVC is deleted, the reclaim policy is restored at last
+	policy := pv.Spec.PersistentVolumeReclaimPolicy
+	if policy != corev1.PersistentVolumeReclaimRetain {
+		if err := patchPV(ctx, client, pv.Name, types.MergePatchType, map[string]interface{}{
+			"spec": map[string]interface{}{"persistentVolumeReclaimPolicy": corev1.PersistentVolumeReclaimRetain},
+		}); err != nil {
+			return plan, err
+		}
+		log.Info("pv is retained during moving", "pv", pv.Name, "reclaimPolicy", policy)
+	}
+	if plan.oldPVC != nil {
+		if err := deletePVC(ctx, client, plan.oldPVC, opts); err != nil {
+			return plan, rollback(client, plan, policy, err)
+		}
+		log.Info("old pvc is deleted", "pvc", plan.From)
+	}
+
+	newPVC, err := client.CoreV1().PersistentVolumeClaims(plan.Claim.Namespace).Create(ctx, plan.Claim, metav1.CreateOptions{})
+	if err != nil {
+		return plan, rollback(client, plan, policy, err)
+	}
+	claimRef := &corev1.ObjectReference{
+		Kind:       "PersistentVolumeClaim",
+		APIVersion: "v1",
+		Namespace:  newPVC.Namespace,
+		Name:       newPVC.Name,
+		UID:        newPVC.UID,
+	}
+	claimAnno := rebind.EncodeClaim(newPVC)
+	if plan.NewSubPath != plan.SubPath {
+		if err := renameDir(ctx, client, pv, plan, opts); err != nil {
+			return plan, rollback(client, plan, policy, err)
+		}
+		if err := recreatePV(ctx, client, pv, plan, claimRef, claimAnno, policy, opts); err != nil {
+			// the directory is renamed already, the old PV is not usable any more
+			return plan, fmt.Errorf("directory of pv %s is renamed from %s to %s, but recreating the pv failed: %v; "+
+				"create pv %s with subPath %s and claimRef to pvc %s manually", pv.Name, plan.SubPath, plan.NewSubPath, err,
+				pv.Name, plan.NewSubPath, plan.To)
+		}
+		return plan, nil
+	}
+	// claimRef is replaced as a whole, merging would keep the uid and resourceVersion of the old PVC
+	ops := []interface{}{
+		map[string]interface{}{"op": "add", "path": "/spec/claimRef", "value": claimRef},
+		map[string]interface{}{"op": "add", "path": "/spec/persistentVolumeReclaimPolicy", "value": policy},
+	}
+	if _, ok := pv.Annotations[common.ClaimAnnotationKey]; ok {
+		ops = append(ops, map[string]interface{}{
+			"op":    "add",
+			"path":  "/metadata/annotations/" + strings.ReplaceAll(common.ClaimAnnotationKey, "/", "~1"),
+			"value": claimAnno,
+		})
+	}
+	if !reflect.DeepEqual(plan.PVLabels, pv.Labels) {
+		ops = append(ops, map[string]interface{}{"op": "add", "path": "/metadata/labels", "value": plan.PVLabels})
+	}
+	if err := patchPV(ctx, client, pv.Name, types.JSONPatchType, ops); err != nil {
+		return plan, rollback(client, plan, policy, err)
+	}
+	return plan, nil
+}
+
+// rollback deletes the new PVC, recreates the old PVC and binds the PV to it with the reclaim policy restored.
+// It runs in a new context, since the context of Run may be canceled already.
+func rollback(client *k8s.K8sClient, plan *Plan, policy corev1.PersistentVolumeReclaimPolicy, cause error) error {
+	ctx := context.Background()
+	log.Info("rolling back", "pv", plan.PV, "error", cause)
+	if err := client.CoreV1().PersistentVolumeClaims(plan.Claim.Namespace).Delete(ctx, plan.Claim.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("%v; rollback failed, delete new pvc %s: %v", cause, plan.To, err)
+	}
+	ops := []interface{}{
+		map[string]interface{}{"op": "add", "path": "/spec/persistentVolumeReclaimPolicy", "value": policy},
+	}
+	if plan.oldPVC != nil {
+		oldPVC, err := client.GetPersistentVolumeClaim(ctx, plan.oldPVC.Name, plan.oldPVC.Namespace)
+		if k8serrors.IsNotFound(err) {
+			pvc := plan.oldPVC.DeepCopy()
+			pvc.ObjectMeta = metav1.ObjectMeta{
+				Name:        pvc.Name,
+				Namespace:   pvc.Namespace,
+				Labels:      pvc.Labels,
+				Annotations: pvc.Annotations,
+			}
+			pvc.Spec.VolumeName = plan.PV
+			pvc.Status = corev1.PersistentVolumeClaimStatus{}
+			oldPVC, err = client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(ctx, pvc, metav1.CreateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("%v; rollback failed, recreate old pvc %s: %v", cause, plan.From, err)
+		}
+		ops = append(ops, map[string]interface{}{"op": "add", "path": "/spec/claimRef", "value": &corev1.ObjectReference{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: "v1",
+			Namespace:  oldPVC.Namespace,
+			Name:       oldPVC.Name,
+			UID:        oldPVC.UID,
+		}})
+	}
+	if err := patchPV(ctx, client, plan.PV, types.JSONPatchType, ops); err != nil {
+		return fmt.Errorf("%v; rollback failed, restore pv %s: %v", cause, plan.PV, err)
+	}
+	return fmt.Errorf("%v; rolled back to pvc %s", cause, plan.From)
+}
+
+// usedBy returns the name of a pod using the PVC, empty if none
+func usedBy(ctx context.Context, client *k8s.K8sClient, pvc *corev1.PersistentVolumeClaim) (string, error) {
+	pods, err := client.ListPod(ctx, pvc.Namespace, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, v := range pod.Spec.Volumes {
+			if v.PersistentVolumeClaim != nil && v.PersistentVolumeClaim.ClaimName == pvc.Name {
+				return pod.Name, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func deletePVC(ctx context.Context, client *k8s.K8sClient, pvc *corev1.PersistentVolumeClaim, opts Options) error {
+	err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Delete(ctx, pvc.Name, metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	return wait.PollUntilContextTimeout(ctx, opts.pollInterval, opts.Timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := client.GetPersistentVolumeClaim(ctx, pvc.Name, pvc.Namespace)
+		if k8serrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+func patchPV(ctx context.Context, client *k8s.K8sClient, name string, pt types.PatchType, patch interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().PersistentVolumes().Patch(ctx, name, pt, data, metav1.PatchOptions{})
+	return err
+}
+
+// renameDir renames the directory of the PV in a pod, which mounts the root of the file system by a temporary
+// static PV sharing the secret and attributes of the PV
+func renameDir(ctx context.Context, client *k8s.K8sClient, pv *corev1.PersistentVolume, plan *Plan, opts Options) error {
+	name := pv.Name + renameSuffix
+	attrs := map[string]string{}
+	for k, v := range pv.Spec.CSI.VolumeAttributes {
+		attrs[k] = v
+	}
+	for _, k := range []string{"subPath", "pathPattern", "capacity"} {
+		delete(attrs, k)
+	}
+	tmpPV := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: pv.Spec.Capacity,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+				Driver:               config.DriverName,
+				VolumeHandle:         name,
+				VolumeAttributes:     attrs,
+				NodePublishSecretRef: pv.Spec.CSI.NodePublishSecretRef,
+			}},
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			MountOptions:                  pv.Spec.MountOptions,
+			ClaimRef:                      &corev1.ObjectReference{Namespace: opts.Namespace, Name: name},
+		},
+	}
+	storageClassName := ""
+	tmpPVC := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: opts.Namespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      tmpPV.Spec.AccessModes,
+			Resources:        corev1.VolumeResourceRequirements{Requests: pv.Spec.Capacity},
+			StorageClassName: &storageClassName,
+			VolumeName:       name,
+		},
+	}
+	oldDir := path.Join("/data", path.Clean("/"+plan.SubPath))
+	newDir := path.Join("/data", path.Clean("/"+plan.NewSubPath))
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: opts.Namespace},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{{
+				Name:  "rename",
+				Image: opts.Image,
+				Command: []string{"sh", "-c", fmt.Sprintf(`set -e; [ ! -e %[2]q ] || { echo "%[2]s already exists"; exit 1; }; mkdir -p "$(dirname %[2]q)"; mv %[1]q %[2]q`,
+					oldDir, newDir)},
+				VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+			}},
+			Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: name},
+			}}},
+		},
+	}
+
+	if _, err := client.CoreV1().PersistentVolumes().Create(ctx, tmpPV, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	defer func() {
+		bg := context.Background()
+		_ = client.CoreV1().Pods(opts.Namespace).Delete(bg, name, metav1.DeleteOptions{})
+		_ = client.CoreV1().PersistentVolumeClaims(opts.Namespace).Delete(bg, name, metav1.DeleteOptions{})
+		_ = client.CoreV1().PersistentVolumes().Delete(bg, name, metav1.DeleteOptions{})
+	}()
+	if _, err := client.CoreV1().PersistentVolumeClaims(opts.Namespace).Create(ctx, tmpPVC, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := client.CreatePod(ctx, pod); err != nil {
+		return err
+	}
+	log.Info("renaming directory", "pv", pv.Name, "from", plan.SubPath, "to", plan.NewSubPath)
+	var phase corev1.PodPhase
+	err := wait.PollUntilContextTimeout(ctx, opts.pollInterval, opts.Timeout, true, func(ctx context.Context) (bool, error) {
+		p, err := client.GetPod(ctx, name, opts.Namespace)
+		if err != nil {
+			return false, err
+		}
+		phase = p.Status.Phase
+		return phase == corev1.PodSucceeded || phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		return fmt.Errorf("wait for pod %s/%s renaming the directory: %v", opts.Namespace, name, err)
+	}
+	if phase != corev1.PodSucceeded {
+		return fmt.Errorf("rename directory %s to %s failed, see logs of pod %s/%s", plan.SubPath, plan.NewSubPath, opts.Namespace, name)
+	}
+	return nil
+}
+
+// recreatePV replaces the PV with the same one of the new subPath, reserved for the new PVC
+func recreatePV(ctx context.Context, client *k8s.K8sClient, pv *corev1.PersistentVolume, plan *Plan,
+	claimRef *corev1.ObjectReference, claimAnno string, policy corev1.PersistentVolumeReclaimPolicy, opts Options) error {
+	newPV := pv.DeepCopy()
+	newPV.ObjectMeta = metav1.ObjectMeta{
+		Name:        pv.Name,
+		Labels:      plan.PVLabels,
+		Annotations: pv.Annotations,
+	}
+	if newPV.Annotations == nil {
+		newPV.Annotations = map[string]string{}
+	}
+	if _, ok := pv.Annotations[common.ClaimAnnotationKey]; ok {
+		newPV.Annotations[common.ClaimAnnotationKey] = claimAnno
+	}
+	newPV.Spec.CSI.VolumeAttributes["subPath"] = plan.NewSubPath
+	if newPV.Spec.CSI.VolumeAttributes["pathPattern"] != "" {
+		newPV.Spec.CSI.VolumeAttributes["pathPattern"] = plan.NewSubPath
+	}
+	newPV.Spec.ClaimRef = claimRef
+	newPV.Spec.PersistentVolumeReclaimPolicy = policy
+	newPV.Status = corev1.PersistentVolumeStatus{}
+
+	// the PV is retained, deleting it leaves the data intact
+	if err := client.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	err := wait.PollUntilContextTimeout(ctx, opts.pollInterval, opts.Timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := client.GetPersistentVolume(ctx, pv.Name)
+		if k8serrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("wait for pv %s to be deleted: %v", pv.Name, err)
+	}
+	_, err = client.CoreV1().PersistentVolumes().Create(ctx, newPV, metav1.CreateOptions{})
+	return err
+}
+
+// String describes the plan
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pv %s: %s -> %s", p.PV, p.From, p.To)
+	if p.NewSubPath != p.SubPath {
+		fmt.Fprintf(&b, ", directory %s -> %s", p.SubPath, p.NewSubPath)
+	}
+	return b.String()
+}
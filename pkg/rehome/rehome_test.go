@@ -0,0 +1,196 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package rehome
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func boundPV(attrs map[string]string) (*corev1.PersistentVolume, *corev1.PersistentVolumeClaim) {
+	sc := "juicefs-sc"
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "data",
+			Namespace:   "team-a",
+			UID:         "old-uid",
+			Labels:      map[string]string{"tenant": "a"},
+			Annotations: map[string]string{"pv.kubernetes.io/bind-completed": "yes", "juicefs/mount-cpu-limit": "1"},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			Resources:        corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}},
+			StorageClassName: &sc,
+			VolumeName:       "pvc-1",
+		},
+	}
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1", Annotations: map[string]string{common.ClaimAnnotationKey: `{"namespace":"team-a","name":"data"}`}},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: config.DriverName, VolumeHandle: "pvc-1", VolumeAttributes: attrs},
+			},
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			ClaimRef:                      &corev1.ObjectReference{Namespace: "team-a", Name: "data", UID: "old-uid"},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimDelete,
+			StorageClassName:              sc,
+		},
+		Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeBound},
+	}
+	return pv, pvc
+}
+
+func TestNewPlan(t *testing.T) {
+	pv, pvc := boundPV(map[string]string{"subPath": "team-a-data", "pathPattern": "team-a-data"})
+	sc := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "juicefs-sc"},
+		Provisioner: config.DriverName,
+		Parameters:  map[string]string{"pathPattern": "${.pvc.namespace}-${.pvc.name}"},
+	}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(pv, pvc, sc)}
+	ctx := context.TODO()
+
+	plan, err := NewPlan(ctx, client, Options{PV: "pvc-1", Namespace: "team-b", PVC: "data"})
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a/data", plan.From)
+	assert.Equal(t, "team-b/data", plan.To)
+	assert.Equal(t, "team-a-data", plan.NewSubPath, "directory is kept without RenameDir")
+	assert.Equal(t, map[string]string{"tenant": "a"}, plan.Claim.Labels)
+	assert.Equal(t, map[string]string{"juicefs/mount-cpu-limit": "1", RehomedFromAnnotation: "team-a/data"}, plan.Claim.Annotations)
+	assert.Equal(t, "pvc-1", plan.Claim.Spec.VolumeName)
+
+	plan, err = NewPlan(ctx, client, Options{PV: "pvc-1", Namespace: "team-b", PVC: "data", RenameDir: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "team-b-data", plan.NewSubPath)
+	assert.Equal(t, "pv pvc-1: team-a/data -> team-b/data, directory team-a-data -> team-b-data", plan.String())
+
+	plan, err = NewPlan(ctx, client, Options{PV: "pvc-1", Namespace: "team-b", PVC: "data",
+		Labels: map[string]string{"tenant": "b", "quota": "q1"}, RemoveLabels: []string{"app"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "b", "quota": "q1"}, plan.Claim.Labels)
+	assert.Equal(t, map[string]string{"tenant": "b", "quota": "q1"}, plan.PVLabels)
+	assert.Equal(t, map[string]string{"tenant": "a"}, pvc.Labels, "labels of the old pvc are kept")
+
+	_, err = NewPlan(ctx, client, Options{PV: "pvc-1", Namespace: "team-a", PVC: "data"})
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestRun(t *testing.T) {
+	pv, pvc := boundPV(map[string]string{"subPath": "pvc-1"})
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(pv, pvc)}
+	ctx := context.TODO()
+	opts := Options{PV: "pvc-1", Namespace: "team-b", PVC: "data", Timeout: time.Second, pollInterval: 10 * time.Millisecond}
+
+	// used by a pod
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a"},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+		}}}},
+	}
+	_, err := client.CreatePod(ctx, pod)
+	assert.NoError(t, err)
+	_, err = Run(ctx, client, opts)
+	assert.ErrorContains(t, err, "is used by pod app")
+	assert.NoError(t, client.DeletePod(ctx, pod))
+
+	plan, err := Run(ctx, client, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "pvc-1", plan.NewSubPath)
+
+	_, err = client.GetPersistentVolumeClaim(ctx, "data", "team-a")
+	assert.Error(t, err, "old pvc is deleted")
+	newPVC, err := client.GetPersistentVolumeClaim(ctx, "data", "team-b")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", newPVC.Labels["tenant"])
+
+	newPV, err := client.GetPersistentVolume(ctx, "pvc-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-b", newPV.Spec.ClaimRef.Namespace)
+	assert.Equal(t, "data", newPV.Spec.ClaimRef.Name)
+	assert.Equal(t, newPVC.UID, newPV.Spec.ClaimRef.UID)
+	assert.Equal(t, corev1.PersistentVolumeReclaimDelete, newPV.Spec.PersistentVolumeReclaimPolicy, "reclaim policy is restored")
+	assert.Contains(t, newPV.Annotations[common.ClaimAnnotationKey], `"namespace":"team-b"`)
+}
+
+func TestRunLabels(t *testing.T) {
+	pv, pvc := boundPV(map[string]string{"subPath": "pvc-1"})
+	pv.Labels = map[string]string{"tenant": "a", "app": "web"}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(pv, pvc)}
+	ctx := context.TODO()
+	opts := Options{PV: "pvc-1", Namespace: "team-b", PVC: "data", Timeout: time.Second, pollInterval: 10 * time.Millisecond,
+		Labels: map[string]string{"tenant": "b"}, RemoveLabels: []string{"app"}}
+
+	_, err := Run(ctx, client, opts)
+	assert.NoError(t, err)
+	newPVC, err := client.GetPersistentVolumeClaim(ctx, "data", "team-b")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "b"}, newPVC.Labels)
+	newPV, err := client.GetPersistentVolume(ctx, "pvc-1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "b"}, newPV.Labels)
+}
+
+func TestRunRollback(t *testing.T) {
+	pv, pvc := boundPV(map[string]string{"subPath": "pvc-1"})
+	cs := fake.NewSimpleClientset(pv, pvc)
+	failed := false
+	cs.PrependReactor("patch", "persistentvolumes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() == types.JSONPatchType && !failed {
+			failed = true
+			return true, nil, fmt.Errorf("injected")
+		}
+		return false, nil, nil
+	})
+	client := &k8s.K8sClient{Interface: cs}
+	ctx := context.TODO()
+	opts := Options{PV: "pvc-1", Namespace: "team-b", PVC: "data", Timeout: time.Second, pollInterval: 10 * time.Millisecond}
+
+	_, err := Run(ctx, client, opts)
+	assert.ErrorContains(t, err, "injected")
+	assert.ErrorContains(t, err, "rolled back to pvc team-a/data")
+
+	_, err = client.GetPersistentVolumeClaim(ctx, "data", "team-b")
+	assert.Error(t, err, "new pvc is deleted")
+	oldPVC, err := client.GetPersistentVolumeClaim(ctx, "data", "team-a")
+	assert.NoError(t, err)
+	assert.Equal(t, "pvc-1", oldPVC.Spec.VolumeName)
+	assert.Equal(t, map[string]string{"tenant": "a"}, oldPVC.Labels)
+	newPV, err := client.GetPersistentVolume(ctx, "pvc-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", newPV.Spec.ClaimRef.Namespace)
+	assert.Equal(t, "data", newPV.Spec.ClaimRef.Name)
+	assert.Equal(t, corev1.PersistentVolumeReclaimDelete, newPV.Spec.PersistentVolumeReclaimPolicy, "reclaim policy is restored")
+}
@@ -0,0 +1,381 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package report summarizes the usage of CSI Driver in the cluster for capacity planning: file systems, PVs of
+// each file system with their capacity and usage, mount pods of each node, and volumes with the most errors.
+// Only the API server is needed, usage of volumes is read from kubelet through the node proxy of the API server.
+package report
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+var reportLog = klog.NewKlogr().WithName("report")
+
+// volumeInMessage matches the volume in messages of kubelet events, e.g. FailedMount of pods
+var volumeInMessage = regexp.MustCompile(`for volume "([^"]+)"`)
+
+// FileSystem is the usage summary of a file system, identified by the name in its volume credentials
+type FileSystem struct {
+	Name           string   `json:"name"`
+	StorageClasses []string `json:"storageClasses,omitempty"`
+	PVs            int      `json:"pvs"`
+	// Capacity is the sum of the capacity of PVs, which is the quota set on their subdirs
+	Capacity int64 `json:"capacity"`
+	// Used is the sum of the usage reported by kubelet, of PVs in use only
+	Used int64 `json:"used"`
+}
+
+// Volume is a PV of CSI Driver, Used is nil if the usage is unknown, e.g. the volume is not in use
+type Volume struct {
+	FileSystem   string `json:"fileSystem"`
+	PV           string `json:"pv"`
+	PVC          string `json:"pvc,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
+	Capacity     int64  `json:"capacity"`
+	Used         *int64 `json:"used,omitempty"`
+	// Errors is the number of warning events of the PV, its PVC, its mount pods and pods failing to mount it
+	Errors int `json:"errors"`
+}
+
+// Node is the number of mount pods on a node
+type Node struct {
+	Name      string `json:"name"`
+	MountPods int    `json:"mountPods"`
+}
+
+// Report is the machine-readable output of report
+type Report struct {
+	Time        time.Time    `json:"time"`
+	FileSystems []FileSystem `json:"fileSystems"`
+	// Volumes are sorted by errors, the most first
+	Volumes []Volume `json:"volumes"`
+	Nodes   []Node   `json:"nodes"`
+	// Warnings are the parts of the report which can't be generated, e.g. no permission
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type Options struct {
+	// Namespace where CSI Driver is installed
+	Namespace string
+	// SkipUsage skips reading the usage of volumes from kubelet
+	SkipUsage bool
+	// SkipErrors skips counting the warning events of volumes
+	SkipErrors bool
+
+	// statsSummary reads the stats summary of the node, overridden in tests
+	statsSummary func(ctx context.Context, client *k8sclient.K8sClient, node string) (*k8sclient.StatsSummary, error)
+}
+
+func (o *Options) setDefaults() {
+	if o.Namespace == "" {
+		o.Namespace = config.Namespace
+	}
+	if o.Namespace == "" {
+		o.Namespace = "kube-system"
+	}
+	if o.statsSummary == nil {
+		o.statsSummary = statsSummary
+	}
+}
+
+// Generate generates the report, only failing to list PVs is an error, other failures are in Report.Warnings
+func Generate(ctx context.Context, client *k8sclient.K8sClient, opts Options) (*Report, error) {
+	opts.setDefaults()
+	report := &Report{Time: time.Now()}
+	pvs, err := client.ListPersistentVolumes(ctx, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("list PVs error: %v", err)
+	}
+
+	// names of file systems are read from the secrets of PVs
+	fsNames := map[string]string{}
+	fsName := func(ref *corev1.SecretReference) string {
+		if ref == nil {
+			return "<unknown>"
+		}
+		key := ref.Namespace + "/" + ref.Name
+		if name, ok := fsNames[key]; ok {
+			return name
+		}
+		fsNames[key] = key
+		if secret, err := client.GetSecret(ctx, ref.Name, ref.Namespace); err != nil {
+			report.warn("get secret %s error, file system is named by the secret: %v", key, err)
+		} else if name := string(secret.Data["name"]); name != "" {
+			fsNames[key] = name
+		}
+		return fsNames[key]
+	}
+
+	volumes := map[string]*Volume{}
+	pvcToPV := map[string]string{}
+	for _, pv := range pvs {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName {
+			continue
+		}
+		v := &Volume{
+			FileSystem:   fsName(pv.Spec.CSI.NodePublishSecretRef),
+			PV:           pv.Name,
+			StorageClass: pv.Spec.StorageClassName,
+			Capacity:     pv.Spec.Capacity.Storage().Value(),
+		}
+		if ref := pv.Spec.ClaimRef; ref != nil {
+			v.PVC = ref.Namespace + "/" + ref.Name
+			pvcToPV[v.PVC] = pv.Name
+		}
+		volumes[pv.Name] = v
+	}
+
+	mountPods, err := client.ListPod(ctx, opts.Namespace, &metav1.LabelSelector{MatchLabels: map[string]string{common.PodTypeKey: common.PodTypeValue}}, nil)
+	if err != nil {
+		report.warn("list mount pods error: %v", err)
+	}
+	nodes := map[string]int{}
+	mountPodPV := map[string]string{}
+	for _, pod := range mountPods {
+		nodes[pod.Spec.NodeName]++
+		mountPodPV[pod.Name] = pod.Annotations[common.UniqueId]
+	}
+	for name, n := range nodes {
+		report.Nodes = append(report.Nodes, Node{Name: name, MountPods: n})
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Name < report.Nodes[j].Name })
+
+	if !opts.SkipErrors {
+		report.countErrors(ctx, client, opts, volumes, pvcToPV, mountPodPV)
+	}
+	if !opts.SkipUsage {
+		report.readUsage(ctx, client, opts, volumes, pvcToPV)
+	}
+
+	fileSystems := map[string]*FileSystem{}
+	for _, v := range volumes {
+		fs := fileSystems[v.FileSystem]
+		if fs == nil {
+			fs = &FileSystem{Name: v.FileSystem}
+			fileSystems[v.FileSystem] = fs
+		}
+		fs.PVs++
+		fs.Capacity += v.Capacity
+		if v.Used != nil {
+			fs.Used += *v.Used
+		}
+		if v.StorageClass != "" && !util.ContainsString(fs.StorageClasses, v.StorageClass) {
+			fs.StorageClasses = append(fs.StorageClasses, v.StorageClass)
+		}
+		report.Volumes = append(report.Volumes, *v)
+	}
+	for _, fs := range fileSystems {
+		sort.Strings(fs.StorageClasses)
+		report.FileSystems = append(report.FileSystems, *fs)
+	}
+	sort.Slice(report.FileSystems, func(i, j int) bool { return report.FileSystems[i].Name < report.FileSystems[j].Name })
+	sort.Slice(report.Volumes, func(i, j int) bool {
+		if report.Volumes[i].Errors != report.Volumes[j].Errors {
+			return report.Volumes[i].Errors > report.Volumes[j].Errors
+		}
+		return report.Volumes[i].PV < report.Volumes[j].PV
+	})
+	return report, nil
+}
+
+// countErrors counts the warning events of the volumes, events are kept by the API server for an hour by default
+func (r *Report) countErrors(ctx context.Context, client *k8sclient.K8sClient, opts Options, volumes map[string]*Volume, pvcToPV, mountPodPV map[string]string) {
+	events, err := client.CoreV1().Events("").List(ctx, metav1.ListOptions{FieldSelector: "type=" + corev1.EventTypeWarning})
+	if err != nil {
+		r.warn("list events error, errors of volumes are not counted: %v", err)
+		return
+	}
+	for _, e := range events.Items {
+		if e.Type != corev1.EventTypeWarning {
+			continue
+		}
+		obj := e.InvolvedObject
+		var pv string
+		switch obj.Kind {
+		case "PersistentVolume":
+			pv = obj.Name
+		case "PersistentVolumeClaim":
+			pv = pvcToPV[obj.Namespace+"/"+obj.Name]
+		case "Pod":
+			if obj.Namespace == opts.Namespace && mountPodPV[obj.Name] != "" {
+				pv = mountPodPV[obj.Name]
+			} else if m := volumeInMessage.FindStringSubmatch(e.Message); m != nil {
+				pv = m[1]
+			}
+		}
+		if v := volumes[pv]; v != nil {
+			count := int(e.Count)
+			if count == 0 {
+				count = 1
+			}
+			v.Errors += count
+		}
+	}
+}
+
+// readUsage reads the usage of volumes in use from kubelet of the nodes where they are used
+func (r *Report) readUsage(ctx context.Context, client *k8sclient.K8sClient, opts Options, volumes map[string]*Volume, pvcToPV map[string]string) {
+	pods, err := client.ListPod(ctx, "", nil, nil)
+	if err != nil {
+		r.warn("list pods error, usage of volumes is unknown: %v", err)
+		return
+	}
+	nodes := map[string]bool{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if vol.PersistentVolumeClaim != nil && pvcToPV[pod.Namespace+"/"+vol.PersistentVolumeClaim.ClaimName] != "" {
+				nodes[pod.Spec.NodeName] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	for _, node := range names {
+		summary, err := opts.statsSummary(ctx, client, node)
+		if err != nil {
+			r.warn("read stats of node %s error, usage of volumes on it is unknown: %v", node, err)
+			continue
+		}
+		for _, pod := range summary.Pods {
+			for _, vs := range pod.VolumeStats {
+				if vs.PVCRef == nil || vs.UsedBytes == nil {
+					continue
+				}
+				v := volumes[pvcToPV[vs.PVCRef.Namespace+"/"+vs.PVCRef.Name]]
+				if v == nil {
+					continue
+				}
+				// all the pods using the volume see the same usage of the subdir
+				used := int64(*vs.UsedBytes)
+				if v.Used == nil || *v.Used < used {
+					v.Used = &used
+				}
+			}
+		}
+	}
+}
+
+func statsSummary(ctx context.Context, client *k8sclient.K8sClient, node string) (*k8sclient.StatsSummary, error) {
+	data, err := client.CoreV1().RESTClient().Get().AbsPath("/api/v1/nodes", node, "proxy", "stats", "summary").DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summary := &k8sclient.StatsSummary{}
+	if err := json.Unmarshal(data, summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func (r *Report) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	reportLog.V(1).Info(msg)
+	r.Warnings = append(r.Warnings, msg)
+}
+
+// Print prints the report in tables, only the top volumes with errors are printed
+func (r *Report) Print(out io.Writer, top int) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FILESYSTEM\tSTORAGECLASSES\tPVS\tCAPACITY\tUSED")
+	for _, fs := range r.FileSystems {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", fs.Name, joinOrNone(fs.StorageClasses), fs.PVs, quantity(fs.Capacity), quantity(fs.Used))
+	}
+	fmt.Fprintln(w, "\nNODE\tMOUNTPODS")
+	for _, n := range r.Nodes {
+		fmt.Fprintf(w, "%s\t%d\n", n.Name, n.MountPods)
+	}
+	fmt.Fprintln(w, "\nPV\tPVC\tFILESYSTEM\tCAPACITY\tUSED\tERRORS")
+	for i, v := range r.Volumes {
+		if i >= top || v.Errors == 0 {
+			break
+		}
+		used := "-"
+		if v.Used != nil {
+			used = quantity(*v.Used)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", v.PV, v.PVC, v.FileSystem, quantity(v.Capacity), used, v.Errors)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, warning := range r.Warnings {
+		if _, err := fmt.Fprintf(out, "\nWARNING: %s", warning); err != nil {
+			return err
+		}
+	}
+	if len(r.Warnings) > 0 {
+		_, err := fmt.Fprintln(out)
+		return err
+	}
+	return nil
+}
+
+// WriteCSV writes the volumes in CSV, one row for each PV, sizes are in bytes and empty if unknown
+func (r *Report) WriteCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"filesystem", "pv", "pvc", "storage_class", "capacity_bytes", "used_bytes", "errors"}); err != nil {
+		return err
+	}
+	for _, v := range r.Volumes {
+		used := ""
+		if v.Used != nil {
+			used = strconv.FormatInt(*v.Used, 10)
+		}
+		if err := w.Write([]string{v.FileSystem, v.PV, v.PVC, v.StorageClass, strconv.FormatInt(v.Capacity, 10), used, strconv.Itoa(v.Errors)}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func quantity(bytes int64) string {
+	return resource.NewQuantity(bytes, resource.BinarySI).String()
+}
+
+func joinOrNone(items []string) string {
+	if len(items) == 0 {
+		return "<none>"
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,111 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestGenerate(t *testing.T) {
+	pv := func(name, sc, capacity, pvc string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				Capacity:         corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)},
+				StorageClassName: sc,
+				ClaimRef:         &corev1.ObjectReference{Namespace: "default", Name: pvc},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:               config.DriverName,
+					VolumeHandle:         name,
+					NodePublishSecretRef: &corev1.SecretReference{Name: "juicefs-secret", Namespace: "kube-system"},
+				}},
+			},
+		}
+	}
+	mountPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "juicefs-node-1-pv-1-abcdef",
+			Namespace:   "kube-system",
+			Labels:      map[string]string{common.PodTypeKey: common.PodTypeValue},
+			Annotations: map[string]string{common.UniqueId: "pv-1"},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-1"},
+	}
+	app := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: corev1.PodSpec{NodeName: "node-1", Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc-1"},
+		}}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	event := func(name string, obj corev1.ObjectReference, message string, count int32) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: obj.Namespace},
+			InvolvedObject: obj,
+			Type:           corev1.EventTypeWarning,
+			Message:        message,
+			Count:          count,
+		}
+	}
+	client := &k8sclient.K8sClient{Interface: fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "juicefs-secret", Namespace: "kube-system"}, Data: map[string][]byte{"name": []byte("myjfs")}},
+		pv("pv-1", "sc-1", "10Gi", "pvc-1"),
+		pv("pv-2", "sc-2", "20Gi", "pvc-2"),
+		mountPod, app,
+		event("e1", corev1.ObjectReference{Kind: "Pod", Namespace: "kube-system", Name: mountPod.Name}, "Back-off restarting failed container", 3),
+		event("e2", corev1.ObjectReference{Kind: "PersistentVolumeClaim", Namespace: "default", Name: "pvc-2"}, "resize failed", 1),
+		event("e3", corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "app"}, `MountVolume.SetUp failed for volume "pv-1"`, 2),
+	)}
+
+	used := uint64(3 << 30)
+	opts := Options{Namespace: "kube-system", statsSummary: func(ctx context.Context, client *k8sclient.K8sClient, node string) (*k8sclient.StatsSummary, error) {
+		assert.Equal(t, "node-1", node)
+		return &k8sclient.StatsSummary{Pods: []k8sclient.PodStats{{VolumeStats: []k8sclient.VolumeStats{
+			{Name: "data", PVCRef: &k8sclient.PVCReference{Namespace: "default", Name: "pvc-1"}, UsedBytes: &used},
+		}}}}, nil
+	}}
+	report, err := Generate(context.TODO(), client, opts)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Warnings)
+	assert.Equal(t, []FileSystem{{Name: "myjfs", StorageClasses: []string{"sc-1", "sc-2"}, PVs: 2, Capacity: 30 << 30, Used: 3 << 30}}, report.FileSystems)
+	assert.Equal(t, []Node{{Name: "node-1", MountPods: 1}}, report.Nodes)
+	assert.Len(t, report.Volumes, 2)
+	assert.Equal(t, "pv-1", report.Volumes[0].PV)
+	assert.Equal(t, 5, report.Volumes[0].Errors)
+	assert.Equal(t, int64(3<<30), *report.Volumes[0].Used)
+	assert.Equal(t, 1, report.Volumes[1].Errors)
+	assert.Nil(t, report.Volumes[1].Used)
+
+	var out bytes.Buffer
+	assert.NoError(t, report.WriteCSV(&out))
+	assert.Equal(t, `filesystem,pv,pvc,storage_class,capacity_bytes,used_bytes,errors
+myjfs,pv-1,default/pvc-1,sc-1,10737418240,3221225472,5
+myjfs,pv-2,default/pvc-2,sc-2,21474836480,,1
+`, out.String())
+}
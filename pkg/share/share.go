@@ -0,0 +1,200 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package share exports the connection info of a JuiceFS PV into a portable manifest, and imports the
+// manifest as a read-only PV in another cluster, so that the same data can be consumed across clusters.
+// Secrets are never exported, the importing cluster provides its own secret of the same file system.
+package share
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+const (
+	APIVersion = "juicefs.com/v1"
+	Kind       = "VolumeExport"
+)
+
+// exportedAttributes are the volume attributes carried by the manifest, the others are either secrets
+// or specific to the source cluster, e.g. the cache PVC or the secret store
+var exportedAttributes = []string{
+	"subPath",
+	"mountOptions",
+	common.MountPodCpuLimitKey,
+	common.MountPodMemLimitKey,
+	common.MountPodCpuRequestKey,
+	common.MountPodMemRequestKey,
+	common.MountPodImageKey,
+	common.UploadLimitKey,
+	common.DownloadLimitKey,
+	common.FuseOptionsKey,
+	common.CachePresetKey,
+	common.AttrCacheKey,
+	common.EntryCacheKey,
+	common.DirEntryCacheKey,
+	common.OpenCacheKey,
+}
+
+// Manifest is the portable connection info of a JuiceFS PV, without secrets
+type Manifest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Cluster is the source cluster, recorded in the imported PV
+	Cluster string `json:"cluster"`
+	PV      string `json:"pv"`
+	// FileSystem is the name of the file system, checked against the secret of the importing cluster
+	FileSystem       string            `json:"fileSystem"`
+	Capacity         resource.Quantity `json:"capacity"`
+	MountOptions     []string          `json:"mountOptions,omitempty"`
+	VolumeAttributes map[string]string `json:"volumeAttributes,omitempty"`
+	ExportedAt       metav1.Time       `json:"exportedAt"`
+}
+
+// ImportOptions are the settings of the PV created from a manifest
+type ImportOptions struct {
+	// Name of the PV, defaults to <cluster>-<pv>
+	Name            string
+	SecretName      string
+	SecretNamespace string
+}
+
+// ClusterID returns the UID of kube-system namespace, which identifies the cluster if no name is given
+func ClusterID(ctx context.Context, client *k8s.K8sClient) (string, error) {
+	ns, err := client.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return string(ns.UID), nil
+}
+
+// Export generates the manifest of the PV
+func Export(ctx context.Context, client *k8s.K8sClient, pvName, cluster string) (*Manifest, error) {
+	pv, err := client.GetPersistentVolume(ctx, pvName)
+	if err != nil {
+		return nil, err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName {
+		return nil, fmt.Errorf("pv %s is not a JuiceFS volume", pvName)
+	}
+	if from := pv.Spec.CSI.VolumeAttributes[common.ImportedFromKey]; from != "" {
+		return nil, fmt.Errorf("pv %s is imported from cluster %s, export it from there instead", pvName, from)
+	}
+	ref := pv.Spec.CSI.NodePublishSecretRef
+	if ref == nil {
+		return nil, fmt.Errorf("pv %s has no nodePublishSecretRef", pvName)
+	}
+	secret, err := client.GetSecret(ctx, ref.Name, ref.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	fsName := string(secret.Data["name"])
+	if fsName == "" {
+		return nil, fmt.Errorf("secret %s/%s of pv %s has no name", ref.Namespace, ref.Name, pvName)
+	}
+
+	m := &Manifest{
+		APIVersion:   APIVersion,
+		Kind:         Kind,
+		Cluster:      cluster,
+		PV:           pv.Name,
+		FileSystem:   fsName,
+		Capacity:     pv.Spec.Capacity[corev1.ResourceStorage],
+		MountOptions: pv.Spec.MountOptions,
+		ExportedAt:   metav1.NewTime(time.Now()),
+	}
+	for _, k := range exportedAttributes {
+		if v, ok := pv.Spec.CSI.VolumeAttributes[k]; ok {
+			if m.VolumeAttributes == nil {
+				m.VolumeAttributes = map[string]string{}
+			}
+			m.VolumeAttributes[k] = v
+		}
+	}
+	return m, nil
+}
+
+// GenPV generates the read-only PV from the manifest, it's never deleted with its data since the
+// reclaim policy is Retain
+func GenPV(m *Manifest, opts ImportOptions) (*corev1.PersistentVolume, error) {
+	if m.APIVersion != APIVersion || m.Kind != Kind {
+		return nil, fmt.Errorf("not a volume export manifest, expect %s %s, got %s %s", APIVersion, Kind, m.APIVersion, m.Kind)
+	}
+	if m.Cluster == "" || m.PV == "" || m.FileSystem == "" {
+		return nil, fmt.Errorf("cluster, pv and fileSystem are required in the manifest")
+	}
+	name := opts.Name
+	if name == "" {
+		name = m.Cluster + "-" + m.PV
+	}
+	attributes := map[string]string{common.ImportedFromKey: m.Cluster}
+	for _, k := range exportedAttributes {
+		if v, ok := m.VolumeAttributes[k]; ok {
+			attributes[k] = v
+		}
+	}
+	if _, err := config.ParseVolumeContext(attributes, true); err != nil {
+		return nil, err
+	}
+	capacity := m.Capacity
+	if capacity.IsZero() {
+		capacity = resource.MustParse("10Pi")
+	}
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"juicefs.com/imported": "true"},
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:     corev1.ResourceList{corev1.ResourceStorage: capacity},
+			AccessModes:  []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany},
+			MountOptions: m.MountOptions,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+				Driver:               config.DriverName,
+				VolumeHandle:         name,
+				ReadOnly:             true,
+				VolumeAttributes:     attributes,
+				NodePublishSecretRef: &corev1.SecretReference{Name: opts.SecretName, Namespace: opts.SecretNamespace},
+			}},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+		},
+	}, nil
+}
+
+// Import creates the read-only PV from the manifest, after checking the secret refers to the same file system
+func Import(ctx context.Context, client *k8s.K8sClient, m *Manifest, opts ImportOptions) (*corev1.PersistentVolume, error) {
+	pv, err := GenPV(m, opts)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := client.GetSecret(ctx, opts.SecretName, opts.SecretNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if fsName := string(secret.Data["name"]); fsName != m.FileSystem {
+		return nil, fmt.Errorf("secret %s/%s is for file system %q, but the manifest is for %q", opts.SecretNamespace, opts.SecretName, fsName, m.FileSystem)
+	}
+	return client.CoreV1().PersistentVolumes().Create(ctx, pv, metav1.CreateOptions{})
+}
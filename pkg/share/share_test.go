@@ -0,0 +1,93 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package share
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func secret(namespace, name, fsName string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Data:       map[string][]byte{"name": []byte(fsName), "access-key": []byte("ak"), "secret-key": []byte("sk")},
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:     corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			MountOptions: []string{"subdir=/k8s", "cache-size=1024"},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+				Driver:       config.DriverName,
+				VolumeHandle: "pvc-1",
+				VolumeAttributes: map[string]string{
+					"subPath":                  "pvc-1",
+					common.CachePVC:            "cache",
+					common.MountPodCpuLimitKey: "2",
+				},
+				NodePublishSecretRef: &corev1.SecretReference{Name: "juicefs-secret", Namespace: "default"},
+			}},
+		},
+	}
+	source := &k8s.K8sClient{Interface: fake.NewSimpleClientset(pv, secret("default", "juicefs-secret", "myjfs"))}
+	m, err := Export(context.TODO(), source, "pvc-1", "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "myjfs", m.FileSystem)
+	assert.Equal(t, []string{"subdir=/k8s", "cache-size=1024"}, m.MountOptions)
+	// cluster specific attributes are not exported
+	assert.Equal(t, map[string]string{"subPath": "pvc-1", common.MountPodCpuLimitKey: "2"}, m.VolumeAttributes)
+
+	target := &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		secret("kube-system", "juicefs-secret", "myjfs"),
+		secret("kube-system", "other-secret", "otherjfs"),
+	)}
+	_, err = Import(context.TODO(), target, m, ImportOptions{SecretName: "other-secret", SecretNamespace: "kube-system"})
+	assert.ErrorContains(t, err, `secret kube-system/other-secret is for file system "otherjfs"`)
+
+	imported, err := Import(context.TODO(), target, m, ImportOptions{SecretName: "juicefs-secret", SecretNamespace: "kube-system"})
+	assert.NoError(t, err)
+	assert.Equal(t, "prod-pvc-1", imported.Name)
+	assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany}, imported.Spec.AccessModes)
+	assert.Equal(t, corev1.PersistentVolumeReclaimRetain, imported.Spec.PersistentVolumeReclaimPolicy)
+	assert.True(t, imported.Spec.CSI.ReadOnly)
+	assert.Equal(t, "prod", imported.Spec.CSI.VolumeAttributes[common.ImportedFromKey])
+	assert.Equal(t, "pvc-1", imported.Spec.CSI.VolumeAttributes["subPath"])
+
+	// imported pv can't be exported again
+	_, err = Export(context.TODO(), target, "prod-pvc-1", "staging")
+	assert.ErrorContains(t, err, "imported from cluster prod")
+}
+
+func TestGenPVInvalidManifest(t *testing.T) {
+	_, err := GenPV(&Manifest{APIVersion: "v1", Kind: "PersistentVolume"}, ImportOptions{})
+	assert.ErrorContains(t, err, "not a volume export manifest")
+	_, err = GenPV(&Manifest{APIVersion: APIVersion, Kind: Kind, Cluster: "prod", PV: "pvc-1"}, ImportOptions{})
+	assert.ErrorContains(t, err, "required")
+}
@@ -0,0 +1,76 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Init sets up the OTLP/HTTP exporter from the standard OpenTelemetry environment variables,
+// e.g. OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME, spans are only logged if no endpoint is set
+func Init(serviceName string) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return
+	}
+	tp, err := newProvider(context.Background(), serviceName)
+	if err != nil {
+		log.Error(err, "create OTLP exporter error, spans are only logged")
+		return
+	}
+	log.Info("export spans with OTLP/HTTP", "service", serviceName)
+	setProvider(tp)
+}
+
+func newProvider(ctx context.Context, serviceName string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence over the default service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(logProcessor{}),
+		sdktrace.WithBatcher(exporter),
+	), nil
+}
+
+// logProcessor logs finished spans at level 1
+type logProcessor struct{}
+
+func (logProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (logProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	log.V(1).Info("span finished", "traceId", s.SpanContext().TraceID().String(), "spanId", s.SpanContext().SpanID().String(),
+		"parentSpanId", s.Parent().SpanID().String(), "name", s.Name(), "duration", s.EndTime().Sub(s.StartTime()).String(), "error", s.Status().Description)
+}
+
+func (logProcessor) Shutdown(context.Context) error { return nil }
+
+func (logProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,140 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package tracing records spans of volume operations, e.g. NodePublishVolume and the phases of mount pod lifecycle,
+// so that the phase taking the time of a slow mount can be found. It's a thin layer over the OpenTelemetry SDK: trace
+// context is propagated in the W3C traceparent format, spans are exported with the OTLP/HTTP exporter if
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, and logged at level 1 in any case.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+var log = klog.NewKlogr().WithName("tracing")
+
+const instrumentationName = "github.com/juicedata/juicefs-csi-driver"
+
+var (
+	tracer     trace.Tracer
+	propagator = propagation.TraceContext{}
+)
+
+func init() {
+	setProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(logProcessor{})))
+}
+
+// setProvider sets the provider spans are started by
+func setProvider(tp *sdktrace.TracerProvider) {
+	tracer = tp.Tracer(instrumentationName)
+}
+
+// Span is an operation in a trace
+type Span struct {
+	span trace.Span
+}
+
+// SetAttributes sets attributes of the span in key-value pairs
+func (s *Span) SetAttributes(kvs ...string) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attributes(kvs)...)
+}
+
+// Finish ends the span with the error of the operation, nil if it succeeded
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	} else {
+		s.span.SetStatus(codes.Ok, "")
+	}
+	s.span.End()
+}
+
+// TraceID returns the trace ID of the span in hex
+func (s *Span) TraceID() string {
+	return s.span.SpanContext().TraceID().String()
+}
+
+// SpanID returns the ID of the span in hex
+func (s *Span) SpanID() string {
+	return s.span.SpanContext().SpanID().String()
+}
+
+func attributes(kvs []string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(kvs)/2)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		attrs = append(attrs, attribute.String(kvs[i], kvs[i+1]))
+	}
+	return attrs
+}
+
+// Start starts a span, as a child of the span or remote parent in ctx, or a new trace if there is none
+func Start(ctx context.Context, name string, kvs ...string) (context.Context, *Span) {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attributes(kvs)...))
+	return ctx, &Span{span: span}
+}
+
+// StartChild starts a span only if ctx is in a trace, ctx and a nil span are returned otherwise,
+// which is used for the phases of an operation, so that they are not recorded as traces of their own
+func StartChild(ctx context.Context, name string, kvs ...string) (context.Context, *Span) {
+	if FromContext(ctx) == nil {
+		return ctx, nil
+	}
+	return Start(ctx, name, kvs...)
+}
+
+// FromContext returns the span in ctx, nil if there is none
+func FromContext(ctx context.Context) *Span {
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+// TraceID returns the trace ID of the span in ctx, "" if there is none
+func TraceID(ctx context.Context) string {
+	if span := FromContext(ctx); span != nil {
+		return span.TraceID()
+	}
+	return ""
+}
+
+// Traceparent returns the W3C traceparent of the span in ctx, "" if there is none
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// WithRemoteParent returns a context whose spans are children of the remote span in the W3C traceparent,
+// ctx is returned as is if traceparent is invalid
+func WithRemoteParent(ctx context.Context, traceparent string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
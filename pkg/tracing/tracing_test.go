@@ -0,0 +1,120 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpans(t *testing.T) {
+	r := tracetest.NewSpanRecorder()
+	setProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(r)))
+	defer setProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(logProcessor{})))
+
+	remote := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx, root := Start(WithRemoteParent(context.Background(), remote), "NodePublishVolume", "volumeId", "pv-1")
+	if root.TraceID() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("root span should continue the remote trace, got %s", root.TraceID())
+	}
+	if got := Traceparent(ctx); got != "00-"+root.TraceID()+"-"+root.SpanID()+"-01" {
+		t.Errorf("Traceparent() = %s", got)
+	}
+	_, child := Start(ctx, "createMountPod")
+	if child.TraceID() != root.TraceID() {
+		t.Errorf("child span should be in trace %s, got %s", root.TraceID(), child.TraceID())
+	}
+	child.Finish(errors.New("timeout"))
+	child.Finish(nil)
+	root.Finish(nil)
+	ended := r.Ended()
+	if len(ended) != 2 || ended[0].Name() != "createMountPod" || ended[0].Status().Code != codes.Error ||
+		ended[0].Parent().SpanID().String() != root.SpanID() || ended[1].Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("ended spans = %+v", ended)
+	}
+
+	// invalid traceparent starts a new trace
+	for _, tp := range []string{"", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "garbage"} {
+		if FromContext(WithRemoteParent(context.Background(), tp)) != nil {
+			t.Errorf("traceparent %q should be ignored", tp)
+		}
+		_, span := Start(WithRemoteParent(context.Background(), tp), "op")
+		span.Finish(nil)
+		if s := r.Ended()[len(r.Ended())-1]; s.Parent().IsValid() || !s.SpanContext().TraceID().IsValid() {
+			t.Errorf("span of traceparent %q = %+v", tp, s)
+		}
+	}
+	if ctx, span := StartChild(context.Background(), "phase"); span != nil || FromContext(ctx) != nil {
+		t.Errorf("StartChild() out of trace = %+v", span)
+	}
+	if Traceparent(context.Background()) != "" || TraceID(context.Background()) != "" {
+		t.Errorf("no trace context expected")
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		body []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		body = data
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer token")
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	tp, err := newProvider(context.Background(), "juicefs-csi-node")
+	if err != nil {
+		t.Fatalf("newProvider() error = %v", err)
+	}
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+	setProvider(tp)
+	defer setProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(logProcessor{})))
+
+	_, span := Start(context.Background(), "bindTarget", "target", "/var/lib/kubelet/pods/x")
+	span.Finish(errors.New("device busy"))
+	if err := tp.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush() error = %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// the payload is protobuf encoded, so only check the strings in it
+	for _, want := range []string{"juicefs-csi-node", "bindTarget", "/var/lib/kubelet/pods/x", "device busy"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("payload should contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// PushgatewaySink pushes the usage as gauges to a Prometheus Pushgateway, replacing the ones of the last round so
+// that entries of deleted volumes are gone
+type PushgatewaySink struct {
+	URL string
+	Job string
+}
+
+func (s *PushgatewaySink) Name() string { return "pushgateway" }
+
+func (s *PushgatewaySink) Push(ctx context.Context, usage *Usage) error {
+	labels := []string{"namespace", "storage_class", "filesystem"}
+	capacity := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "juicefs_usage_capacity_bytes",
+		Help: "Sum of the capacity of JuiceFS PVs, which is the quota of their subdirs.",
+	}, labels)
+	used := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "juicefs_usage_used_bytes",
+		Help: "Sum of the used bytes of JuiceFS PVs, the last known one for PVs not in use.",
+	}, labels)
+	pvs := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "juicefs_usage_pvs",
+		Help: "Number of JuiceFS PVs.",
+	}, labels)
+	unknown := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "juicefs_usage_unknown_pvs",
+		Help: "Number of JuiceFS PVs whose usage is unknown, as they have never been seen in use.",
+	}, labels)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(capacity, used, pvs, unknown)
+	for _, e := range usage.Entries {
+		l := prometheus.Labels{"namespace": e.Namespace, "storage_class": e.StorageClass, "filesystem": e.FileSystem}
+		capacity.With(l).Set(float64(e.Capacity))
+		used.With(l).Set(float64(e.Used))
+		pvs.With(l).Set(float64(e.PVs))
+		unknown.With(l).Set(float64(e.UsageUnknown))
+	}
+
+	pusher := push.New(s.URL, s.Job).Gatherer(registry).Client(httpClient)
+	if usage.Cluster != "" {
+		pusher = pusher.Grouping("cluster", usage.Cluster)
+	}
+	return pusher.PushContext(ctx)
+}
+
+// WebhookSink posts the usage in JSON to an HTTP endpoint
+type WebhookSink struct {
+	URL    string
+	Header http.Header
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Push(ctx context.Context, usage *Usage) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return send(ctx, http.MethodPost, s.URL, s.Header, "application/json", data)
+}
+
+// CSVSink writes the usage in CSV, one file for each round named by its time. Dest is a directory, e.g. where a
+// bucket or a JuiceFS volume is mounted, or an HTTP URL to PUT the file to, e.g. of a bucket, where the file name is
+// appended if it ends with "/".
+type CSVSink struct {
+	Dest   string
+	Header http.Header
+}
+
+func (s *CSVSink) Name() string { return "csv" }
+
+func (s *CSVSink) Push(ctx context.Context, usage *Usage) error {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, usage); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("usage-%s.csv", usage.Time.UTC().Format("20060102T150405Z"))
+	if strings.HasPrefix(s.Dest, "http://") || strings.HasPrefix(s.Dest, "https://") {
+		url := s.Dest
+		if strings.HasSuffix(url, "/") {
+			url += name
+		}
+		return send(ctx, http.MethodPut, url, s.Header, "text/csv", buf.Bytes())
+	}
+	if err := os.MkdirAll(s.Dest, 0755); err != nil {
+		return err
+	}
+	// written to a temporary file first, so that readers never see a partial one
+	path := filepath.Join(s.Dest, name)
+	if err := os.WriteFile(path+".tmp", buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// WriteCSV writes the usage in CSV, one row for each entry, sizes are in bytes
+func WriteCSV(out io.Writer, usage *Usage) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"time", "cluster", "namespace", "storage_class", "filesystem", "pvs", "capacity_bytes", "used_bytes", "usage_unknown"}); err != nil {
+		return err
+	}
+	t := usage.Time.UTC().Format(time.RFC3339)
+	for _, e := range usage.Entries {
+		if err := w.Write([]string{t, usage.Cluster, e.Namespace, e.StorageClass, e.FileSystem, strconv.Itoa(e.PVs),
+			strconv.FormatInt(e.Capacity, 10), strconv.FormatInt(e.Used, 10), strconv.Itoa(e.UsageUnknown)}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func send(ctx context.Context, method, url string, header http.Header, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s %s", method, url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package usage periodically aggregates the capacity (quota) and usage of volumes by namespace, StorageClass and file
+// system, and pushes them to billing systems through sinks, for the chargeback of file systems shared by tenants.
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/report"
+)
+
+var usageLog = klog.NewKlogr().WithName("usage-exporter")
+
+// Entry is the usage of volumes of a namespace in a StorageClass of a file system
+type Entry struct {
+	Namespace    string `json:"namespace"`
+	StorageClass string `json:"storageClass"`
+	FileSystem   string `json:"fileSystem"`
+	PVs          int    `json:"pvs"`
+	// Capacity is the sum of the capacity of PVs, which is the quota set on their subdirs
+	Capacity int64 `json:"capacityBytes"`
+	// Used is the sum of the usage of PVs, the last known one for PVs not in use
+	Used int64 `json:"usedBytes"`
+	// UsageUnknown is the number of PVs never seen in use by the exporter, not counted in Used
+	UsageUnknown int `json:"usageUnknown,omitempty"`
+}
+
+// Usage is what is pushed to sinks in each round
+type Usage struct {
+	Time    time.Time `json:"time"`
+	Cluster string    `json:"cluster,omitempty"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Sink receives the usage of each round, e.g. a billing system
+type Sink interface {
+	Name() string
+	Push(ctx context.Context, usage *Usage) error
+}
+
+type Options struct {
+	report.Options
+	// Cluster identifies the cluster in the usage, for billing systems shared by clusters
+	Cluster string
+	// Interval between rounds
+	Interval time.Duration
+	// StateFile keeps the last known usage of PVs across runs, e.g. of a CronJob, it's kept in memory only if empty
+	StateFile string
+}
+
+// Exporter aggregates the usage of volumes and pushes it to sinks
+type Exporter struct {
+	client *k8sclient.K8sClient
+	opts   Options
+	sinks  []Sink
+
+	// lastUsed is the last known usage of PVs, kubelet only reports the usage of volumes in use
+	lastUsed map[string]int64
+	generate func(ctx context.Context, client *k8sclient.K8sClient, opts report.Options) (*report.Report, error)
+}
+
+func NewExporter(client *k8sclient.K8sClient, opts Options, sinks ...Sink) *Exporter {
+	// only capacity and usage are needed
+	opts.SkipErrors = true
+	e := &Exporter{
+		client:   client,
+		opts:     opts,
+		sinks:    sinks,
+		lastUsed: map[string]int64{},
+		generate: report.Generate,
+	}
+	if err := e.loadState(); err != nil {
+		usageLog.Error(err, "load last known usage error, usage of PVs not in use is unknown until they are seen in use", "file", opts.StateFile)
+	}
+	return e
+}
+
+// loadState loads the last known usage of PVs from the state file, if any
+func (e *Exporter) loadState() error {
+	if e.opts.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(e.opts.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &e.lastUsed)
+}
+
+// saveState writes the last known usage of PVs to the state file atomically, if any
+func (e *Exporter) saveState() error {
+	if e.opts.StateFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(e.lastUsed)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(e.opts.StateFile), filepath.Base(e.opts.StateFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), e.opts.StateFile)
+}
+
+// Run exports the usage every interval until ctx is done
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := e.Export(ctx); err != nil {
+			usageLog.Error(err, "export usage error")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Export aggregates the usage once and pushes it to all sinks, a failed sink doesn't stop the others
+func (e *Exporter) Export(ctx context.Context) error {
+	usage, err := e.collect(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, sink := range e.sinks {
+		if err := sink.Push(ctx, usage); err != nil {
+			errs = append(errs, fmt.Errorf("push to %s error: %v", sink.Name(), err))
+			continue
+		}
+		usageLog.V(1).Info("usage pushed", "sink", sink.Name(), "entries", len(usage.Entries))
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Exporter) collect(ctx context.Context) (*Usage, error) {
+	r, err := e.generate(ctx, e.client, e.opts.Options)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range r.Warnings {
+		usageLog.Info("usage may be incomplete", "warning", warning)
+	}
+
+	type key struct{ namespace, sc, fs string }
+	entries := map[key]*Entry{}
+	existing := map[string]bool{}
+	for _, v := range r.Volumes {
+		existing[v.PV] = true
+		if v.Used != nil {
+			e.lastUsed[v.PV] = *v.Used
+		}
+		namespace := ""
+		if v.PVC != "" {
+			namespace = strings.SplitN(v.PVC, "/", 2)[0]
+		}
+		k := key{namespace, v.StorageClass, v.FileSystem}
+		entry := entries[k]
+		if entry == nil {
+			entry = &Entry{Namespace: namespace, StorageClass: v.StorageClass, FileSystem: v.FileSystem}
+			entries[k] = entry
+		}
+		entry.PVs++
+		entry.Capacity += v.Capacity
+		if used, ok := e.lastUsed[v.PV]; ok {
+			entry.Used += used
+		} else {
+			entry.UsageUnknown++
+		}
+	}
+	// forget deleted PVs
+	for pv := range e.lastUsed {
+		if !existing[pv] {
+			delete(e.lastUsed, pv)
+		}
+	}
+	if err := e.saveState(); err != nil {
+		usageLog.Error(err, "save last known usage error", "file", e.opts.StateFile)
+	}
+
+	usage := &Usage{Time: r.Time, Cluster: e.opts.Cluster}
+	for _, entry := range entries {
+		usage.Entries = append(usage.Entries, *entry)
+	}
+	sort.Slice(usage.Entries, func(i, j int) bool {
+		a, b := usage.Entries[i], usage.Entries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.StorageClass != b.StorageClass {
+			return a.StorageClass < b.StorageClass
+		}
+		return a.FileSystem < b.FileSystem
+	})
+	return usage, nil
+}
@@ -0,0 +1,156 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/report"
+)
+
+func TestExport(t *testing.T) {
+	used := func(n int64) *int64 { return &n }
+	now := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	rounds := [][]report.Volume{
+		{
+			{FileSystem: "myjfs", PV: "pv-1", PVC: "team-a/data", StorageClass: "sc-1", Capacity: 10 << 30, Used: used(3 << 30)},
+			{FileSystem: "myjfs", PV: "pv-2", PVC: "team-a/logs", StorageClass: "sc-1", Capacity: 20 << 30},
+			{FileSystem: "myjfs", PV: "pv-3", PVC: "team-b/data", StorageClass: "sc-1", Capacity: 5 << 30, Used: used(1 << 30)},
+		},
+		// pv-1 is not in use anymore, and pv-3 is deleted
+		{
+			{FileSystem: "myjfs", PV: "pv-1", PVC: "team-a/data", StorageClass: "sc-1", Capacity: 10 << 30},
+			{FileSystem: "myjfs", PV: "pv-2", PVC: "team-a/logs", StorageClass: "sc-1", Capacity: 20 << 30, Used: used(2 << 30)},
+		},
+	}
+
+	var posted []Usage
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		u := Usage{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&u))
+		posted = append(posted, u)
+	}))
+	defer webhook.Close()
+	var pushed string
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/metrics/job/juicefs-usage/cluster/c1", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		pushed = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer pushgateway.Close()
+	dir := t.TempDir()
+
+	e := NewExporter(nil, Options{Cluster: "c1"},
+		&WebhookSink{URL: webhook.URL, Header: http.Header{"Authorization": {"Bearer token"}}},
+		&PushgatewaySink{URL: pushgateway.URL, Job: "juicefs-usage"},
+		&CSVSink{Dest: dir},
+	)
+	round := 0
+	e.generate = func(ctx context.Context, client *k8sclient.K8sClient, opts report.Options) (*report.Report, error) {
+		assert.True(t, opts.SkipErrors)
+		defer func() { round++ }()
+		return &report.Report{Time: now.Add(time.Duration(round) * time.Hour), Volumes: rounds[round]}, nil
+	}
+
+	assert.NoError(t, e.Export(context.TODO()))
+	assert.Equal(t, []Entry{
+		{Namespace: "team-a", StorageClass: "sc-1", FileSystem: "myjfs", PVs: 2, Capacity: 30 << 30, Used: 3 << 30, UsageUnknown: 1},
+		{Namespace: "team-b", StorageClass: "sc-1", FileSystem: "myjfs", PVs: 1, Capacity: 5 << 30, Used: 1 << 30},
+	}, posted[0].Entries)
+	assert.Equal(t, "c1", posted[0].Cluster)
+	assert.Contains(t, pushed, "juicefs_usage_capacity_bytes")
+
+	assert.NoError(t, e.Export(context.TODO()))
+	// the last known usage of pv-1 is still counted
+	assert.Equal(t, []Entry{
+		{Namespace: "team-a", StorageClass: "sc-1", FileSystem: "myjfs", PVs: 2, Capacity: 30 << 30, Used: 5 << 30},
+	}, posted[1].Entries)
+	assert.Equal(t, map[string]int64{"pv-1": 3 << 30, "pv-2": 2 << 30}, e.lastUsed)
+
+	data, err := os.ReadFile(filepath.Join(dir, "usage-20261001T090000Z.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, `time,cluster,namespace,storage_class,filesystem,pvs,capacity_bytes,used_bytes,usage_unknown
+2026-10-01T09:00:00Z,c1,team-a,sc-1,myjfs,2,32212254720,5368709120,0
+`, string(data))
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 2)
+}
+
+func TestStateFile(t *testing.T) {
+	used := int64(3 << 30)
+	state := filepath.Join(t.TempDir(), "state.json")
+	var posted []Usage
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := Usage{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&u))
+		posted = append(posted, u)
+	}))
+	defer webhook.Close()
+
+	// each run of --once starts a new exporter
+	export := func(volume report.Volume) {
+		e := NewExporter(nil, Options{StateFile: state}, &WebhookSink{URL: webhook.URL})
+		e.generate = func(ctx context.Context, client *k8sclient.K8sClient, opts report.Options) (*report.Report, error) {
+			return &report.Report{Volumes: []report.Volume{volume}}, nil
+		}
+		assert.NoError(t, e.Export(context.TODO()))
+	}
+	export(report.Volume{FileSystem: "myjfs", PV: "pv-1", PVC: "team-a/data", Capacity: 10 << 30, Used: &used})
+	// pv-1 is not in use anymore
+	export(report.Volume{FileSystem: "myjfs", PV: "pv-1", PVC: "team-a/data", Capacity: 10 << 30})
+	assert.Equal(t, []Entry{{Namespace: "team-a", FileSystem: "myjfs", PVs: 1, Capacity: 10 << 30, Used: 3 << 30}}, posted[1].Entries)
+}
+
+func TestCSVSinkURL(t *testing.T) {
+	var path, body string
+	bucket := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("AccessDenied"))
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		path, body = r.URL.Path, string(data)
+	}))
+	defer bucket.Close()
+
+	usage := &Usage{Time: time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC), Entries: []Entry{{Namespace: "team-a", PVs: 1}}}
+	s := &CSVSink{Dest: bucket.URL + "/usage/", Header: http.Header{"X-Token": {"secret"}}}
+	assert.NoError(t, s.Push(context.TODO(), usage))
+	assert.Equal(t, "/usage/usage-20261001T080000Z.csv", path)
+	assert.True(t, strings.HasPrefix(body, "time,cluster,namespace"))
+
+	s = &CSVSink{Dest: bucket.URL + "/usage.csv"}
+	err := s.Push(context.TODO(), usage)
+	assert.ErrorContains(t, err, "403 Forbidden AccessDenied")
+}
@@ -0,0 +1,149 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package util
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+type checksumEntry struct {
+	sum  string
+	path string
+}
+
+// VerifyChecksumManifest verifies the files under root against the manifest, which is in the format of
+// `sha256sum` output: "<sha256>  <path relative to root>" per line.
+// If sample > 0, only sample entries picked randomly are verified, otherwise all entries are verified.
+// The files are controlled by the tenant of the volume, so only regular files under root are read, see openInRoot.
+func VerifyChecksumManifest(ctx context.Context, root, manifest string, sample int) error {
+	entries, err := parseChecksumManifest(root, manifest)
+	if err != nil {
+		return err
+	}
+	if sample > 0 && sample < len(entries) {
+		rand.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+		entries = entries[:sample]
+	}
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sum, err := sha256File(ctx, root, e.path)
+		if err != nil {
+			return fmt.Errorf("checksum %s: %v", e.path, err)
+		}
+		if sum != e.sum {
+			return fmt.Errorf("checksum mismatch of %s: expected %s, got %s", e.path, e.sum, sum)
+		}
+	}
+	return nil
+}
+
+func parseChecksumManifest(root, manifest string) ([]checksumEntry, error) {
+	f, err := openInRoot(root, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("open checksum manifest: %v", err)
+	}
+	defer f.Close()
+
+	var entries []checksumEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 2)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid checksum manifest line %d: %q", line, text)
+		}
+		// `sha256sum` marks binary mode with a leading '*'
+		p := strings.TrimPrefix(strings.TrimLeft(fields[1], " "), "*")
+		entries = append(entries, checksumEntry{sum: strings.ToLower(fields[0]), path: p})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read checksum manifest: %v", err)
+	}
+	return entries, nil
+}
+
+// openInRoot opens the regular file p under root, p is cleaned as an absolute path first so that it never escapes
+// from root lexically. Symlinks are not followed in any component of p, since they may point to files of the host,
+// and FIFOs or devices are rejected since reading them may never end.
+func openInRoot(root, p string) (*os.File, error) {
+	parts := strings.Split(strings.TrimPrefix(filepath.Clean("/"+p), "/"), "/")
+	cur := root
+	for i, part := range parts {
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if err != nil {
+			return nil, err
+		}
+		if i < len(parts)-1 && !fi.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", filepath.Join(parts[:i+1]...))
+		}
+		if i == len(parts)-1 && !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file", p)
+		}
+	}
+	// O_NONBLOCK keeps opening a FIFO swapped in after the check from blocking
+	f, err := os.OpenFile(cur, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a regular file", p)
+	}
+	return f, nil
+}
+
+// ctxReader stops reading once ctx is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func sha256File(ctx context.Context, root, p string) (string, error) {
+	f, err := openInRoot(root, p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, &ctxReader{ctx: ctx, r: f}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,124 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestVerifyChecksumManifest(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.txt":     "hello",
+		"dir/b.txt": "world",
+	}
+	manifest := ""
+	for p, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, p)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, p), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		manifest += fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), p)
+	}
+	writeManifest := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeManifest("SHA256SUMS", "# checksums\n"+manifest)
+	badSum := sha256.Sum256([]byte("other"))
+	writeManifest("BAD", manifest+fmt.Sprintf("%s  a.txt\n", hex.EncodeToString(badSum[:])))
+	writeManifest("ESCAPE", fmt.Sprintf("%s  ../../etc/passwd\n", hex.EncodeToString(badSum[:])))
+	writeManifest("INVALID", "not a checksum line\n")
+	// symlinks and FIFOs in the volume are not followed or read
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	helloSum := sha256.Sum256([]byte("hello"))
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Dir(outside), filepath.Join(root, "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(root, "fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeManifest("SYMLINK", fmt.Sprintf("%s  link\n", hex.EncodeToString(helloSum[:])))
+	writeManifest("SYMLINK_DIR", fmt.Sprintf("%s  linkdir/secret\n", hex.EncodeToString(helloSum[:])))
+	writeManifest("FIFO", fmt.Sprintf("%s  fifo\n", hex.EncodeToString(helloSum[:])))
+
+	tests := []struct {
+		name     string
+		manifest string
+		sample   int
+		wantErr  bool
+	}{
+		{name: "full", manifest: "SHA256SUMS"},
+		{name: "sampled", manifest: "SHA256SUMS", sample: 1},
+		{name: "mismatch", manifest: "BAD", wantErr: true},
+		{name: "path confined in root", manifest: "ESCAPE", wantErr: true},
+		{name: "invalid manifest", manifest: "INVALID", wantErr: true},
+		{name: "manifest not found", manifest: "NOT_EXIST", wantErr: true},
+		{name: "symlink entry", manifest: "SYMLINK", wantErr: true},
+		{name: "entry in symlinked dir", manifest: "SYMLINK_DIR", wantErr: true},
+		{name: "fifo entry", manifest: "FIFO", wantErr: true},
+		{name: "symlink manifest", manifest: "link", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyChecksumManifest(context.TODO(), root, tt.manifest, tt.sample)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyChecksumManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSha256FileCanceled(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := sha256File(ctx, root, "a.txt")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("sha256File() with canceled ctx should fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sha256File() doesn't return after ctx is done")
+	}
+}
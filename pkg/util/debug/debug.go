@@ -0,0 +1,58 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package debug serves pprof and runtime metrics of a process on a debug port, so that performance regressions,
+// e.g. of CSI Node under heavy pod churn, can be profiled in production.
+package debug
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	// metrics of workqueues, client-go requests and leader election are registered in its registry on init
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// runtimeRegistry Go runtime and process metrics, kept apart from the metrics of JuiceFS
+var runtimeRegistry = prometheus.NewRegistry()
+
+func init() {
+	runtimeRegistry.MustRegister(
+		collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsGC, collectors.MetricsScheduler)),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler returns the handler of the debug port:
+//   - /debug/pprof/ the profiles of net/http/pprof
+//   - /metrics goroutines, GC and scheduler metrics of the Go runtime, process metrics, and depth, latency and retries
+//     of the workqueues of controllers, along with client-go request and leader election metrics
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/metrics", promhttp.HandlerFor(
+		prometheus.Gatherers{runtimeRegistry, ctrlmetrics.Registry},
+		promhttp.HandlerOpts{},
+	))
+	return mux
+}
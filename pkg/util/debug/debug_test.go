@@ -0,0 +1,56 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package debug
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestHandler(t *testing.T) {
+	queue := workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.DefaultTypedControllerRateLimiter[string](),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "debug-test"})
+	defer queue.ShutDown()
+	queue.Add("item")
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	get := func(path string) string {
+		resp, err := http.Get(server.URL + path)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return string(body)
+	}
+
+	metrics := get("/metrics")
+	assert.Contains(t, metrics, "go_goroutines")
+	assert.Contains(t, metrics, "go_gc_")
+	assert.Contains(t, metrics, `workqueue_depth{controller="debug-test",name="debug-test"} 1`)
+	assert.Contains(t, get("/debug/pprof/"), "goroutine")
+	assert.Contains(t, get("/debug/pprof/cmdline"), "debug.test")
+}
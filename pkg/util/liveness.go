@@ -0,0 +1,88 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	k8sMount "k8s.io/utils/mount"
+)
+
+// FuseConnectionsDir is where fusectl is mounted, the FUSE connections of the node are listed by their device minor
+var FuseConnectionsDir = "/sys/fs/fuse/connections"
+
+// ErrMountHung is returned by CheckFuseMount if the mount point doesn't respond in time
+var ErrMountHung = errors.New("mount point doesn't respond")
+
+// CheckFuseMount checks if the JuiceFS mount at mountPath is alive by itself, without looking for the process of
+// the client on the host, so that it works without hostPID: the root of the mount must respond with inode 1, and its
+// FUSE connection must exist if fusectl is mounted.
+func CheckFuseMount(ctx context.Context, mountPath string, timeout time.Duration) error {
+	type result struct {
+		st  *syscall.Stat_t
+		err error
+	}
+	// stat of a hung mount point never returns, so it's not waited
+	done := make(chan result, 1)
+	go func() {
+		fi, err := os.Stat(mountPath)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			done <- result{err: fmt.Errorf("unexpected stat of %s", mountPath)}
+			return
+		}
+		done <- result{st: st}
+	}()
+	var st *syscall.Stat_t
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(timeout):
+		return fmt.Errorf("%w in %s: %s", ErrMountHung, timeout, mountPath)
+	case r := <-done:
+		if r.err != nil {
+			if k8sMount.IsCorruptedMnt(r.err) {
+				return fmt.Errorf("mount point %s is corrupted: %v", mountPath, r.err)
+			}
+			return r.err
+		}
+		st = r.st
+	}
+	if st.Ino != 1 {
+		return fmt.Errorf("%s is not the root of a JuiceFS mount", mountPath)
+	}
+	if _, err := os.Stat(FuseConnectionsDir); err != nil {
+		// fusectl is not mounted, the connection can't be checked
+		return nil
+	}
+	conn := filepath.Join(FuseConnectionsDir, strconv.FormatUint(uint64(DevMinor(uint64(st.Dev))), 10))
+	if _, err := os.Stat(conn); os.IsNotExist(err) {
+		return fmt.Errorf("FUSE connection of %s is gone", mountPath)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckFuseMount(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckFuseMount(context.TODO(), dir, time.Second); err == nil || !strings.Contains(err.Error(), "not the root of a JuiceFS mount") {
+		t.Errorf("CheckFuseMount() of a plain directory = %v", err)
+	}
+	if err := CheckFuseMount(context.TODO(), filepath.Join(dir, "not-exist"), time.Second); !os.IsNotExist(err) {
+		t.Errorf("CheckFuseMount() of a missing directory = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if err := CheckFuseMount(ctx, dir, time.Second); err == nil {
+		t.Errorf("CheckFuseMount() with canceled context should fail")
+	}
+}
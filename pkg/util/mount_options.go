@@ -0,0 +1,90 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mountOptionSince is a mount option introduced in a client version.
+// downgrade returns the option to use instead for older clients ("" to drop it),
+// or false if the option can not be downgraded and the mount should fail.
+type mountOptionSince struct {
+	name      string
+	since     ClientVersion
+	downgrade func(value string) (string, bool)
+}
+
+func dropOption(string) (string, bool) { return "", true }
+
+func failOption(string) (string, bool) { return "", false }
+
+// ceMountOptions are options of juicefs community edition which are not supported by all the clients
+var ceMountOptions = []mountOptionSince{
+	{name: "atime-mode", since: ClientVersion{IsCe: true, Major: 1, Minor: 1}, downgrade: func(value string) (string, bool) {
+		// older clients never update atime, which is the same as noatime
+		return "", value == "noatime"
+	}},
+	{name: "enable-ioctl", since: ClientVersion{IsCe: true, Major: 1, Minor: 1}, downgrade: failOption},
+	{name: "check-storage", since: ClientVersion{IsCe: true, Major: 1, Minor: 1}, downgrade: dropOption},
+	{name: "cache-expire", since: ClientVersion{IsCe: true, Major: 1, Minor: 1}, downgrade: dropOption},
+	{name: "skip-dir-nlink", since: ClientVersion{IsCe: true, Major: 1, Minor: 1}, downgrade: dropOption},
+	{name: "storage-class", since: ClientVersion{IsCe: true, Major: 1, Minor: 1}, downgrade: failOption},
+	{name: "readdir-cache", since: ClientVersion{IsCe: true, Major: 1, Minor: 2}, downgrade: dropOption},
+	{name: "negative-entry-cache", since: ClientVersion{IsCe: true, Major: 1, Minor: 2}, downgrade: dropOption},
+	{name: "max-stage-write", since: ClientVersion{IsCe: true, Major: 1, Minor: 2}, downgrade: dropOption},
+	{name: "skip-dir-mtime", since: ClientVersion{IsCe: true, Major: 1, Minor: 2}, downgrade: dropOption},
+}
+
+// DowngradeMountOptions adapts mount options to the client version of the mount image.
+// Options unsupported by the client are dropped or translated, and reported in changed as "old" or "old -> new".
+// It returns an error if an unsupported option can not be downgraded. Options are returned as is if
+// the version can not be told from the image, e.g. latest, nightly or custom tags.
+func DowngradeMountOptions(image string, options []string) (result []string, changed []string, err error) {
+	v := parseClientVersionFromImage(image)
+	if image == "" || !v.IsCe || v.Dev || v.Nightly {
+		return options, nil, nil
+	}
+	result = make([]string, 0, len(options))
+	for _, option := range options {
+		name, value, _ := strings.Cut(strings.TrimPrefix(option, "--"), "=")
+		var since *mountOptionSince
+		for i := range ceMountOptions {
+			if ceMountOptions[i].name == name {
+				since = &ceMountOptions[i]
+				break
+			}
+		}
+		if since == nil || !v.LessThan(since.since) {
+			result = append(result, option)
+			continue
+		}
+		replace, ok := since.downgrade(value)
+		if !ok {
+			return nil, nil, fmt.Errorf("mount option %q requires juicefs %d.%d.%d or later, but the client in image %s is %d.%d.%d",
+				option, since.since.Major, since.since.Minor, since.since.Patch, image, v.Major, v.Minor, v.Patch)
+		}
+		if replace == "" {
+			changed = append(changed, option)
+			continue
+		}
+		changed = append(changed, option+" -> "+replace)
+		result = append(result, replace)
+	}
+	return result, changed, nil
+}
@@ -0,0 +1,89 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDowngradeMountOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		image       string
+		options     []string
+		wantOptions []string
+		wantChanged []string
+		wantErr     bool
+	}{
+		{
+			name:        "new-client",
+			image:       "juicedata/mount:ce-v1.2.0",
+			options:     []string{"readdir-cache", "atime-mode=relatime"},
+			wantOptions: []string{"readdir-cache", "atime-mode=relatime"},
+		},
+		{
+			name:        "unknown-version",
+			image:       "juicedata/mount:nightly",
+			options:     []string{"readdir-cache"},
+			wantOptions: []string{"readdir-cache"},
+		},
+		{
+			name:        "ee",
+			image:       "juicedata/mount:ee-5.0.2-69f82b3",
+			options:     []string{"readdir-cache"},
+			wantOptions: []string{"readdir-cache"},
+		},
+		{
+			name:        "drop",
+			image:       "juicedata/mount:ce-v1.1.2",
+			options:     []string{"cache-size=1024", "readdir-cache", "negative-entry-cache=1", "cache-expire=3600"},
+			wantOptions: []string{"cache-size=1024", "cache-expire=3600"},
+			wantChanged: []string{"readdir-cache", "negative-entry-cache=1"},
+		},
+		{
+			name:        "drop-noatime",
+			image:       "juicedata/mount:ce-v1.0.4",
+			options:     []string{"atime-mode=noatime"},
+			wantOptions: []string{},
+			wantChanged: []string{"atime-mode=noatime"},
+		},
+		{
+			name:    "fail",
+			image:   "juicedata/mount:ce-v1.0.4",
+			options: []string{"atime-mode=strictatime"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOptions, gotChanged, err := DowngradeMountOptions(tt.image, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DowngradeMountOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(gotOptions, tt.wantOptions) {
+				t.Errorf("DowngradeMountOptions() options = %v, want %v", gotOptions, tt.wantOptions)
+			}
+			if !reflect.DeepEqual(gotChanged, tt.wantChanged) {
+				t.Errorf("DowngradeMountOptions() changed = %v, want %v", gotChanged, tt.wantChanged)
+			}
+		})
+	}
+}
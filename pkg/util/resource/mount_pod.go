@@ -0,0 +1,92 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+// GetMountPodsOfPVC returns the mount pods serving the PV bound to the PVC, on all nodes if nodeName is empty
+func GetMountPodsOfPVC(ctx context.Context, client *k8s.K8sClient, mountNamespace, pvcNamespace, pvcName, nodeName string) ([]corev1.Pod, error) {
+	pvc, err := client.GetPersistentVolumeClaim(ctx, pvcName, pvcNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if pvc.Spec.VolumeName == "" {
+		return nil, fmt.Errorf("pvc %s/%s is not bound", pvcNamespace, pvcName)
+	}
+	pv, err := client.GetPersistentVolume(ctx, pvc.Spec.VolumeName)
+	if err != nil {
+		return nil, err
+	}
+	if pv.Spec.CSI == nil {
+		return nil, fmt.Errorf("pv %s is not a csi volume", pv.Name)
+	}
+	// mount pods shared by the StorageClass are labeled with its name
+	values := []string{pv.Spec.CSI.VolumeHandle}
+	if pv.Spec.StorageClassName != "" {
+		values = append(values, pv.Spec.StorageClassName)
+	}
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{common.PodTypeKey: common.PodTypeValue},
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      common.PodUniqueIdLabelKey,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   values,
+		}},
+	}
+	return client.ListPod(ctx, mountNamespace, selector, nodeFieldSelector(nodeName))
+}
+
+// GetMountPodsOfTarget returns the mount pods referenced by the target path of application pod,
+// on all nodes if nodeName is empty
+func GetMountPodsOfTarget(ctx context.Context, client *k8s.K8sClient, mountNamespace, target, nodeName string) ([]corev1.Pod, error) {
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{common.PodTypeKey: common.PodTypeValue},
+	}
+	pods, err := client.ListPod(ctx, mountNamespace, selector, nodeFieldSelector(nodeName))
+	if err != nil {
+		return nil, err
+	}
+	target = filepath.Clean(target)
+	var mountPods []corev1.Pod
+	for _, pod := range pods {
+		for _, v := range GetAllRefKeys(pod) {
+			if filepath.Clean(v) == target {
+				mountPods = append(mountPods, pod)
+				break
+			}
+		}
+	}
+	return mountPods, nil
+}
+
+func nodeFieldSelector(nodeName string) *fields.Set {
+	if nodeName == "" {
+		return nil
+	}
+	return &fields.Set{"spec.nodeName": nodeName}
+}
@@ -0,0 +1,89 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	k8s "github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+	"github.com/juicedata/juicefs-csi-driver/pkg/util"
+)
+
+func TestGetMountPodsOfPVCAndTarget(t *testing.T) {
+	target := "/var/lib/kubelet/pods/uid-a/volumes/kubernetes.io~csi/pv-a/mount"
+	mountPod := func(name, uniqueId string, targets ...string) *corev1.Pod {
+		annos := map[string]string{}
+		for _, t := range targets {
+			annos[util.GetReferenceKey(t)] = t
+		}
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "kube-system",
+			Labels: map[string]string{
+				common.PodTypeKey:          common.PodTypeValue,
+				common.PodUniqueIdLabelKey: uniqueId,
+			},
+			Annotations: annos,
+		}}
+	}
+	client := &k8s.K8sClient{Interface: fake.NewSimpleClientset(
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-a", Namespace: "default"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-a"},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-pending", Namespace: "default"},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-a"},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{VolumeHandle: "pv-a"},
+				},
+			},
+		},
+		mountPod("juicefs-node1-pv-a-abc", "pv-a", target),
+		mountPod("juicefs-node2-pv-a-def", "pv-a"),
+		mountPod("juicefs-node1-pv-b-ghi", "pv-b", "/var/lib/kubelet/pods/uid-b/volumes/kubernetes.io~csi/pv-b/mount"),
+	)}
+	ctx := context.TODO()
+
+	pods, err := GetMountPodsOfPVC(ctx, client, "kube-system", "default", "pvc-a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 2 {
+		t.Errorf("GetMountPodsOfPVC() got %d pods, want 2", len(pods))
+	}
+	if _, err := GetMountPodsOfPVC(ctx, client, "kube-system", "default", "pvc-pending", ""); err == nil {
+		t.Errorf("GetMountPodsOfPVC() of pending pvc should fail")
+	}
+
+	pods, err = GetMountPodsOfTarget(ctx, client, "kube-system", target+"/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 || pods[0].Name != "juicefs-node1-pv-a-abc" {
+		t.Errorf("GetMountPodsOfTarget() got %v, want juicefs-node1-pv-a-abc", pods)
+	}
+}
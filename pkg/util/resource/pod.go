@@ -415,6 +415,28 @@ func MergeMountOptions(pod *corev1.Pod, jfsSetting *config.JfsSetting) {
 	pod.Spec.Containers[0].Command[2] = strings.Join(command, "\n")
 }
 
+// SetMountOption sets the value of the mount option in the mount command of the pod, it's added if not present
+func SetMountOption(pod *corev1.Pod, key, value string) {
+	if len(pod.Spec.Containers) == 0 || len(pod.Spec.Containers[0].Command) < 3 {
+		return
+	}
+	command := strings.Split(pod.Spec.Containers[0].Command[2], "\n")
+	mountCmds := strings.Fields(command[len(command)-1])
+	if len(mountCmds) < 3 || mountCmds[len(mountCmds)-2] != "-o" {
+		return
+	}
+	opts := []string{}
+	for _, opt := range strings.Split(mountCmds[len(mountCmds)-1], ",") {
+		if k, _, _ := strings.Cut(opt, "="); k != key {
+			opts = append(opts, opt)
+		}
+	}
+	opts = append(opts, key+"="+value)
+	mountCmds[len(mountCmds)-1] = strings.Join(opts, ",")
+	command[len(command)-1] = strings.Join(mountCmds, " ")
+	pod.Spec.Containers[0].Command[2] = strings.Join(command, "\n")
+}
+
 // MergeVolumes merges the cache volumes and volume mounts specified in the JfsSetting
 // into the given pod's spec.
 func MergeVolumes(pod *corev1.Pod, jfsSetting *config.JfsSetting) {
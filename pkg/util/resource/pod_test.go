@@ -1145,3 +1145,13 @@ func TestFilterVars(t *testing.T) {
 		}
 	})
 }
+
+func TestSetMountOption(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Command: []string{"sh", "-c", "cp test.config /root/test.config\n/sbin/mount.juicefs test /jfs/mntPath -o foreground,buffer-size=1024"},
+	}}}}
+	SetMountOption(pod, "buffer-size", "100")
+	assert.Equal(t, "cp test.config /root/test.config\n/sbin/mount.juicefs test /jfs/mntPath -o foreground,buffer-size=100", pod.Spec.Containers[0].Command[2])
+	SetMountOption(pod, "cache-size", "0")
+	assert.Equal(t, "cp test.config /root/test.config\n/sbin/mount.juicefs test /jfs/mntPath -o foreground,buffer-size=100,cache-size=0", pod.Spec.Containers[0].Command[2])
+}
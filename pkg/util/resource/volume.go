@@ -18,6 +18,7 @@ package resource
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 
@@ -25,6 +26,7 @@ import (
 	storagev1 "k8s.io/api/storage/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
 )
@@ -101,6 +103,41 @@ func getVol(ctx context.Context, client *k8sclient.K8sClient, pod *corev1.Pod, n
 	return
 }
 
+// KeptStorageClassParameters returns the parameters of the StorageClass kept on the PV by the storageclass
+// controller, nil if they are not kept
+func KeptStorageClassParameters(pv *corev1.PersistentVolume) (map[string]string, error) {
+	data, ok := pv.Annotations[common.StorageClassParametersKey]
+	if !ok {
+		return nil, nil
+	}
+	params := map[string]string{}
+	if err := json.Unmarshal([]byte(data), &params); err != nil {
+		return nil, fmt.Errorf("invalid %s of pv %s: %v", common.StorageClassParametersKey, pv.Name, err)
+	}
+	return params, nil
+}
+
+// StorageClassParameters returns the parameters of the StorageClass the PV is provisioned from, or those kept on the
+// PV if the StorageClass is deleted
+func StorageClassParameters(ctx context.Context, client *k8sclient.K8sClient, pv *corev1.PersistentVolume) (map[string]string, error) {
+	sc, err := client.GetStorageClass(ctx, pv.Spec.StorageClassName)
+	if err == nil {
+		return sc.Parameters, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	params, keptErr := KeptStorageClassParameters(pv)
+	if keptErr != nil {
+		return nil, keptErr
+	}
+	if params == nil {
+		return nil, err
+	}
+	resourceLog.V(1).Info("storageclass is deleted, use the parameters kept on pv", "storageclass", pv.Spec.StorageClassName, "pv", pv.Name)
+	return params, nil
+}
+
 type VolumeLocks struct {
 	locks sync.Map
 	mux   sync.Mutex
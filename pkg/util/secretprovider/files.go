@@ -0,0 +1,107 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package secretprovider
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// f_type of the file systems in memory, see statfs(2)
+const (
+	tmpfsMagic = 0x01021994
+	ramfsMagic = 0x858458f6
+)
+
+// WriteFiles writes the secrets to dir, a file for each key, so that the secrets fetched from the external
+// secret store reach mount pods and jobs without being stored in kubernetes. The parent of dir must be on
+// tmpfs, so that the secrets never reach the disk of the node. Files of keys not in data are removed,
+// the files are owned by uid if it's not root.
+func WriteFiles(dir string, data map[string]string, uid int) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(dir), &st); err != nil {
+		return fmt.Errorf("stat %s: %v", filepath.Dir(dir), err)
+	}
+	if st.Type != tmpfsMagic && st.Type != ramfsMagic {
+		return fmt.Errorf("%s is not on tmpfs, refuse to write secrets to it", filepath.Dir(dir))
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for k, v := range data {
+		if k == "" || k == "." || k == ".." || strings.ContainsRune(k, '/') {
+			return fmt.Errorf("invalid secret key %q", k)
+		}
+		tmp := filepath.Join(dir, "."+k+".tmp")
+		if err := os.WriteFile(tmp, []byte(v), 0600); err != nil {
+			return err
+		}
+		if uid != 0 {
+			if err := os.Chown(tmp, uid, uid); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, k)); err != nil {
+			return err
+		}
+	}
+	if uid != 0 {
+		if err := os.Chown(dir, uid, uid); err != nil {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, ok := data[e.Name()]; !ok {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveFiles removes the secrets written by WriteFiles
+func RemoveFiles(dir string) error {
+	return os.RemoveAll(dir)
+}
+
+// ReadFiles reads the secrets written by WriteFiles
+func ReadFiles(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string][]byte, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		v, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		data[e.Name()] = v
+	}
+	return data, nil
+}
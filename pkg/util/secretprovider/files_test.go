@@ -0,0 +1,71 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package secretprovider
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFiles(t *testing.T) {
+	var st syscall.Statfs_t
+	tmp := t.TempDir()
+	if err := syscall.Statfs(tmp, &st); err == nil && st.Type != tmpfsMagic && st.Type != ramfsMagic {
+		if err := WriteFiles(filepath.Join(tmp, "secret"), map[string]string{"a": "b"}, 0); err == nil {
+			t.Errorf("WriteFiles() should refuse to write secrets to disk")
+		}
+	}
+
+	if err := syscall.Statfs("/dev/shm", &st); err != nil || st.Type != tmpfsMagic {
+		t.Skip("/dev/shm is not on tmpfs")
+	}
+	base, err := os.MkdirTemp("/dev/shm", "secrets")
+	if err != nil {
+		t.Skipf("can't create dir in /dev/shm: %v", err)
+	}
+	defer os.RemoveAll(base)
+	dir := filepath.Join(base, "juicefs-test-secret")
+	if err := WriteFiles(dir, map[string]string{"metaurl": "redis://127.0.0.1/1", "old": "x"}, 0); err != nil {
+		t.Fatalf("WriteFiles() error = %v", err)
+	}
+	if err := WriteFiles(dir, map[string]string{"metaurl": "redis://127.0.0.1/2", "token": "t"}, 0); err != nil {
+		t.Fatalf("WriteFiles() error = %v", err)
+	}
+	got, err := ReadFiles(dir)
+	if err != nil {
+		t.Fatalf("ReadFiles() error = %v", err)
+	}
+	want := map[string][]byte{"metaurl": []byte("redis://127.0.0.1/2"), "token": []byte("t")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadFiles() = %v, want %v", got, want)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "token")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("mode of secret file = %v, %v, want 0600", fi, err)
+	}
+	if err := WriteFiles(dir, map[string]string{"../escape": "x"}, 0); err == nil {
+		t.Errorf("WriteFiles() with invalid key should fail")
+	}
+	if err := RemoveFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("dir should be removed, stat error = %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package secretprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+const (
+	Vault        = "vault"
+	SecretsStore = "secrets-store"
+
+	defaultVaultAuthPath   = "kubernetes"
+	defaultSecretsStoreDir = "/var/run/secrets-store"
+	serviceAccountToken    = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Enabled returns whether the secrets of the volume are referenced from an external secret store
+func Enabled(volCtx map[string]string) bool {
+	return volCtx[common.SecretProviderKey] != ""
+}
+
+// Validate checks the provider name, it's used by the volume context validation
+func Validate(provider string) error {
+	switch provider {
+	case "", Vault, SecretsStore:
+		return nil
+	}
+	return fmt.Errorf("must be %s or %s", Vault, SecretsStore)
+}
+
+// Fetch reads the secrets referenced by the volume context from the external secret store.
+// The secrets are never written to kubernetes, mount pods and jobs read them from the files written by WriteFiles.
+//
+//   - vault: reads the secret at juicefs/secret-path through the Vault HTTP API. The address is read from env
+//     VAULT_ADDR, the token from env VAULT_TOKEN, or got by logging in with kubernetes auth method as
+//     role juicefs/secret-vault-role (or env VAULT_ROLE) using the service account token of the driver.
+//   - secrets-store: reads every file in directory juicefs/secret-path as a key, the directory must be under
+//     env SECRETS_STORE_DIR (/var/run/secrets-store by default), which is usually mounted into the driver
+//     by the Secrets Store CSI driver with a SecretProviderClass.
+func Fetch(ctx context.Context, volCtx map[string]string) (map[string]string, error) {
+	provider, secretPath := volCtx[common.SecretProviderKey], volCtx[common.SecretPathKey]
+	if secretPath == "" {
+		return nil, fmt.Errorf("%s is required by secret provider %s", common.SecretPathKey, provider)
+	}
+	switch provider {
+	case Vault:
+		return fetchFromVault(ctx, secretPath, volCtx[common.SecretVaultRoleKey])
+	case SecretsStore:
+		return fetchFromSecretsStore(secretPath)
+	}
+	return nil, fmt.Errorf("unknown secret provider %q", provider)
+}
+
+// Merge overlays the fetched secrets on secrets, returns a new map
+func Merge(secrets, fetched map[string]string) map[string]string {
+	merged := make(map[string]string, len(secrets)+len(fetched))
+	for k, v := range secrets {
+		merged[k] = v
+	}
+	for k, v := range fetched {
+		merged[k] = v
+	}
+	return merged
+}
+
+func fetchFromVault(ctx context.Context, secretPath, role string) (map[string]string, error) {
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return nil, fmt.Errorf("env VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		var err error
+		if token, err = vaultLogin(ctx, addr, role); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := vaultRequest(ctx, http.MethodGet, addr+"/v1/"+strings.TrimPrefix(secretPath, "/"), token, nil, &resp); err != nil {
+		return nil, fmt.Errorf("read vault secret %s: %v", secretPath, err)
+	}
+	data := resp.Data
+	// kv v2 engine wraps the secret in data.data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("vault secret %s is empty", secretPath)
+	}
+	secrets := make(map[string]string, len(data))
+	for k, v := range data {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("value of key %s in vault secret %s is not a string", k, secretPath)
+		}
+		secrets[k] = s
+	}
+	return secrets, nil
+}
+
+func vaultLogin(ctx context.Context, addr, role string) (string, error) {
+	if role == "" {
+		role = os.Getenv("VAULT_ROLE")
+	}
+	if role == "" {
+		return "", fmt.Errorf("neither env VAULT_TOKEN nor vault role is set")
+	}
+	jwt, err := os.ReadFile(serviceAccountToken)
+	if err != nil {
+		return "", fmt.Errorf("read service account token: %v", err)
+	}
+	authPath := os.Getenv("VAULT_AUTH_PATH")
+	if authPath == "" {
+		authPath = defaultVaultAuthPath
+	}
+	body, _ := json.Marshal(map[string]string{"role": role, "jwt": strings.TrimSpace(string(jwt))})
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := vaultRequest(ctx, http.MethodPost, fmt.Sprintf("%s/v1/auth/%s/login", addr, authPath), "", body, &resp); err != nil {
+		return "", fmt.Errorf("vault login as role %s: %v", role, err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault login as role %s: no client token returned", role)
+	}
+	return resp.Auth.ClientToken, nil
+}
+
+func vaultRequest(ctx context.Context, method, url, token string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
+
+func fetchFromSecretsStore(secretPath string) (map[string]string, error) {
+	root := os.Getenv("SECRETS_STORE_DIR")
+	if root == "" {
+		root = defaultSecretsStoreDir
+	}
+	// the path is cleaned as an absolute path first so that it never escapes from root
+	dir := filepath.Join(root, filepath.Clean("/"+secretPath))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read secrets store directory: %v", err)
+	}
+	secrets := make(map[string]string)
+	for _, e := range entries {
+		// skip the ..data link and timestamped directories created by the atomic writer of secrets store CSI driver
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, e.Name()))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read secret %s: %v", e.Name(), err)
+		}
+		secrets[e.Name()] = strings.TrimRight(string(data), "\n")
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no secret found in secrets store directory %s", secretPath)
+	}
+	return secrets, nil
+}
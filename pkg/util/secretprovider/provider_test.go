@@ -0,0 +1,139 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package secretprovider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+)
+
+func TestFetchFromVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/juicefs":
+			_, _ = w.Write([]byte(`{"data":{"data":{"name":"myjfs","metaurl":"redis://127.0.0.1/1"},"metadata":{"version":1}}}`))
+		case "/v1/kv/juicefs":
+			_, _ = w.Write([]byte(`{"data":{"name":"myjfs","token":"abc"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	tests := []struct {
+		name    string
+		path    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "kv v2",
+			path: "secret/data/juicefs",
+			want: map[string]string{"name": "myjfs", "metaurl": "redis://127.0.0.1/1"},
+		},
+		{
+			name: "kv v1",
+			path: "/kv/juicefs",
+			want: map[string]string{"name": "myjfs", "token": "abc"},
+		},
+		{
+			name:    "not found",
+			path:    "secret/data/none",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Fetch(context.TODO(), map[string]string{
+				common.SecretProviderKey: Vault,
+				common.SecretPathKey:     tt.path,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fetch() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchFromSecretsStore(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("SECRETS_STORE_DIR", root)
+	dir := filepath.Join(root, "juicefs")
+	if err := os.MkdirAll(filepath.Join(dir, "..2025_01_01"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{"name": "myjfs\n", "metaurl": "redis://127.0.0.1/1"} {
+		if err := os.WriteFile(filepath.Join(dir, k), []byte(v), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "normal",
+			path: "juicefs",
+			want: map[string]string{"name": "myjfs", "metaurl": "redis://127.0.0.1/1"},
+		},
+		{
+			name: "path confined in root",
+			path: "../../juicefs",
+			want: map[string]string{"name": "myjfs", "metaurl": "redis://127.0.0.1/1"},
+		},
+		{
+			name:    "not exist",
+			path:    "none",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Fetch(context.TODO(), map[string]string{
+				common.SecretProviderKey: SecretsStore,
+				common.SecretPathKey:     tt.path,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fetch() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package serving serves the HTTP endpoints of CSI Driver, such as metrics and dashboard, optionally with TLS,
+// client certificate verification (mTLS), and authorization of requests by SubjectAccessReview, so that they can
+// be exposed safely in multi-tenant clusters.
+package serving
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+var log = klog.NewKlogr().WithName("serving")
+
+const (
+	// reloadInterval files of certificates are checked for rotation at most once in the interval
+	reloadInterval = 10 * time.Second
+	// reviewTTL results of TokenReview and SubjectAccessReview are cached for the TTL
+	reviewTTL = time.Minute
+)
+
+// Options of serving HTTP endpoints
+type Options struct {
+	// CertFile and KeyFile are the serving certificate, served with plain HTTP if not set. They are reloaded once
+	// changed, so that the certificate can be rotated without restart.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile if set, clients must present certificates signed by the CA
+	ClientCAFile string
+	// Authorization if set, requests are authenticated by client certificates or bearer tokens (TokenReview), and
+	// authorized by SubjectAccessReview with the path and verb of the request as non-resource attributes
+	Authorization bool
+}
+
+// TLS returns whether the endpoint is served with TLS
+func (o Options) TLS() bool {
+	return o.CertFile != "" && o.KeyFile != ""
+}
+
+func (o Options) validate() error {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return fmt.Errorf("certificate and key files should be set together")
+	}
+	if o.ClientCAFile != "" && !o.TLS() {
+		return fmt.Errorf("client CA file is set without serving certificate")
+	}
+	return nil
+}
+
+// ListenAndServe serves server with opts, requests are authorized by client if opts.Authorization is set
+func ListenAndServe(server *http.Server, opts Options, client kubernetes.Interface) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if opts.Authorization {
+		if client == nil {
+			return fmt.Errorf("authorization requires kubernetes client")
+		}
+		server.Handler = NewAuthorizer(client).Handler(server.Handler)
+	}
+	if !opts.TLS() {
+		return server.ListenAndServe()
+	}
+	reloader, err := newCertReloader(opts)
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = reloader.tlsConfig()
+	log.Info("serve with TLS", "addr", server.Addr, "mTLS", opts.ClientCAFile != "", "authorization", opts.Authorization)
+	return server.ListenAndServeTLS("", "")
+}
+
+// certReloader reloads the serving certificate and client CA once their files are changed
+type certReloader struct {
+	opts Options
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(opts Options) (*certReloader, error) {
+	r := &certReloader{opts: opts, modTimes: map[string]time.Time{}}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) load() error {
+	modTimes := map[string]time.Time{}
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		modTimes[f] = fi.ModTime()
+	}
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load serving certificate error: %v", err)
+	}
+	var clientCAs *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		data, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate found in client CA file %s", r.opts.ClientCAFile)
+		}
+	}
+	r.cert, r.clientCAs, r.modTimes = &cert, clientCAs, modTimes
+	return nil
+}
+
+// reload reloads the files if any of them is changed, the old ones are kept if the new ones are invalid,
+// e.g. the certificate is updated but the key is not yet
+func (r *certReloader) reload(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.checkedAt) < reloadInterval {
+		return
+	}
+	r.checkedAt = now
+	changed := false
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err == nil && !fi.ModTime().Equal(r.modTimes[f]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := r.load(); err != nil {
+		log.Error(err, "reload certificates error, keep the old ones")
+		return
+	}
+	log.Info("certificates reloaded", "cert", r.opts.CertFile)
+}
+
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.reload(time.Now())
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			conf := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if r.clientCAs != nil {
+				conf.ClientCAs = r.clientCAs
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return conf, nil
+		},
+	}
+}
+
+// Authorizer authenticates and authorizes requests with the API server
+type Authorizer struct {
+	client kubernetes.Interface
+	now    func() time.Time
+
+	mu      sync.Mutex
+	users   map[string]cachedUser
+	reviews map[string]cachedReview
+}
+
+type cachedUser struct {
+	user      *authenticationv1.UserInfo
+	expiresAt time.Time
+}
+
+type cachedReview struct {
+	allowed   bool
+	reason    string
+	expiresAt time.Time
+}
+
+func NewAuthorizer(client kubernetes.Interface) *Authorizer {
+	return &Authorizer{
+		client:  client,
+		now:     time.Now,
+		users:   map[string]cachedUser{},
+		reviews: map[string]cachedReview{},
+	}
+}
+
+// Handler authorizes requests before passing them to next, 401 is returned if the request can't be
+// authenticated, and 403 if it's not allowed
+func (a *Authorizer) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, err := a.authenticate(req)
+		if err != nil {
+			log.V(1).Info("unauthenticated request", "path", req.URL.Path, "remote", req.RemoteAddr, "error", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		allowed, reason, err := a.authorize(req, user)
+		if err != nil {
+			log.Error(err, "authorize request error", "path", req.URL.Path, "user", user.Username)
+			http.Error(w, "Authorization error", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			log.V(1).Info("forbidden request", "path", req.URL.Path, "user", user.Username, "reason", reason)
+			http.Error(w, fmt.Sprintf("Forbidden (user=%s, verb=%s, path=%s)", user.Username, verbOf(req), req.URL.Path), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// authenticate returns the user of the verified client certificate, or of the bearer token by TokenReview
+func (a *Authorizer) authenticate(req *http.Request) (*authenticationv1.UserInfo, error) {
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+		cert := req.TLS.VerifiedChains[0][0]
+		return &authenticationv1.UserInfo{Username: cert.Subject.CommonName, Groups: cert.Subject.Organization}, nil
+	}
+	token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return nil, fmt.Errorf("no client certificate or bearer token")
+	}
+
+	now := a.now()
+	a.mu.Lock()
+	cached, ok := a.users[token]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.user, nil
+	}
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(req.Context(), &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !review.Status.Authenticated {
+		return nil, fmt.Errorf("token is not authenticated: %s", review.Status.Error)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune(now)
+	a.users[token] = cachedUser{user: &review.Status.User, expiresAt: now.Add(reviewTTL)}
+	return &review.Status.User, nil
+}
+
+func (a *Authorizer) authorize(req *http.Request, user *authenticationv1.UserInfo) (bool, string, error) {
+	verb := verbOf(req)
+	key := fmt.Sprintf("%s/%s/%s/%s", user.Username, strings.Join(user.Groups, ","), verb, req.URL.Path)
+	now := a.now()
+	a.mu.Lock()
+	cached, ok := a.reviews[key]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.allowed, cached.reason, nil
+	}
+
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(req.Context(), &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: req.URL.Path,
+				Verb: verb,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune(now)
+	a.reviews[key] = cachedReview{allowed: sar.Status.Allowed, reason: sar.Status.Reason, expiresAt: now.Add(reviewTTL)}
+	return sar.Status.Allowed, sar.Status.Reason, nil
+}
+
+// prune removes the expired entries, it's called with a.mu held
+func (a *Authorizer) prune(now time.Time) {
+	for k, v := range a.users {
+		if !now.Before(v.expiresAt) {
+			delete(a.users, k)
+		}
+	}
+	for k, v := range a.reviews {
+		if !now.Before(v.expiresAt) {
+			delete(a.reviews, k)
+		}
+	}
+}
+
+// verbOf maps the HTTP method to the verb of non-resource requests, the same as the API server
+func verbOf(req *http.Request) string {
+	switch req.Method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return "get"
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package serving
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAuthorizer(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	tokenReviews, accessReviews := 0, 0
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tokenReviews++
+		tr := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if tr.Spec.Token == "good" {
+			tr.Status.Authenticated = true
+			tr.Status.User = authenticationv1.UserInfo{Username: "system:serviceaccount:monitoring:prometheus"}
+		}
+		return true, tr, nil
+	})
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		accessReviews++
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		sar.Status.Allowed = sar.Spec.NonResourceAttributes.Path == "/metrics" && sar.Spec.NonResourceAttributes.Verb == "get"
+		return true, sar, nil
+	})
+	now := time.Now()
+	a := NewAuthorizer(clientset)
+	a.now = func() time.Time { return now }
+	handler := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/metrics", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/metrics", "bad"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/metrics", "good"))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/metrics", "good"))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/pods", "good"))
+	assert.Equal(t, 2, tokenReviews)
+	assert.Equal(t, 3, accessReviews)
+
+	// results are cached in TTL
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/metrics", "good"))
+	assert.Equal(t, 2, tokenReviews)
+	assert.Equal(t, 3, accessReviews)
+	now = now.Add(reviewTTL)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/metrics", "good"))
+	assert.Equal(t, 3, tokenReviews)
+	assert.Equal(t, 4, accessReviews)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "first")
+	r, err := newCertReloader(Options{CertFile: certFile, KeyFile: keyFile})
+	assert.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, r))
+
+	// not reloaded in interval
+	writeCert(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(certFile, future, future))
+	r.checkedAt = time.Now()
+	r.reload(time.Now())
+	assert.Equal(t, "first", commonName(t, r))
+	r.reload(time.Now().Add(reloadInterval))
+	assert.Equal(t, "second", commonName(t, r))
+
+	// invalid files are not loaded
+	assert.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0600))
+	assert.NoError(t, os.Chtimes(keyFile, future, future.Add(time.Minute)))
+	r.reload(time.Now().Add(2 * reloadInterval))
+	assert.Equal(t, "second", commonName(t, r))
+
+	_, err = newCertReloader(Options{CertFile: certFile, KeyFile: keyFile})
+	assert.Error(t, err)
+	assert.Error(t, Options{CertFile: certFile}.validate())
+	assert.Error(t, Options{ClientCAFile: certFile}.validate())
+}
+
+func commonName(t *testing.T, r *certReloader) string {
+	conf, err := r.tlsConfig().GetConfigForClient(nil)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(conf.Certificates[0].Certificate[0])
+	assert.NoError(t, err)
+	return cert.Subject.CommonName
+}
+
+func writeCert(t *testing.T, certFile, keyFile, cn string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
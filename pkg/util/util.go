@@ -632,6 +632,41 @@ func ImageSupportBinary(image string) bool {
 	return supportUpgradeBinary(v)
 }
 
+// SupportQuota tells if the client supports directory quota, by the output of `juicefs version`
+func SupportQuota(ce bool, version string) bool {
+	return supportQuota(parseClientVersion(ce, version))
+}
+
+// ImageSupportQuota tells if the client in the image supports directory quota, true if the version is unknown
+func ImageSupportQuota(image string) bool {
+	v := parseClientVersionFromImage(image)
+	if v.Nightly || v.Dev || image == "" {
+		return true
+	}
+	return supportQuota(v)
+}
+
+func supportQuota(v ClientVersion) bool {
+	ceQuotaVersion := ClientVersion{
+		IsCe:  true,
+		Dev:   false,
+		Major: 1,
+		Minor: 1,
+		Patch: 0,
+	}
+	eeQuotaVersion := ClientVersion{
+		IsCe:  false,
+		Dev:   false,
+		Major: 4,
+		Minor: 9,
+		Patch: 0,
+	}
+	if v.IsCe {
+		return !v.LessThan(ceQuotaVersion)
+	}
+	return !v.LessThan(eeQuotaVersion)
+}
+
 func supportFusePass(v ClientVersion) bool {
 	ceFuseVersion := ClientVersion{
 		IsCe:  true,
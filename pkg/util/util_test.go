@@ -1037,6 +1037,51 @@ func TestSupportUpgradeBinary(t *testing.T) {
 	}
 }
 
+func TestSupportQuota(t *testing.T) {
+	tests := []struct {
+		name    string
+		ce      bool
+		version string
+		want    bool
+	}{
+		{name: "ee-5.0", ce: false, version: "juicefs version 5.0.0 (2024-09-09 5a1303e2)", want: true},
+		{name: "ee-4.9", ce: false, version: "JuiceFS version 4.9.0 (2023-03-28 bfeaf6a)", want: true},
+		{name: "ee-4.8", ce: false, version: "JuiceFS version 4.8.3 (2022-11-18 4f7ba2c)", want: false},
+		{name: "ce-1.1.0", ce: true, version: "juicefs version 1.1.0+2023-09-04.08c4ae62", want: true},
+		{name: "ce-1.0.4", ce: true, version: "juicefs version 1.0.4+2023-04-06.f1c475d9", want: false},
+		{name: "ce-dev", ce: true, version: "juicefs version 1.3.0-dev+2024-08-23.f4e98bd3", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SupportQuota(tt.ce, tt.version); got != tt.want {
+				t.Errorf("SupportQuota() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageSupportQuota(t *testing.T) {
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{image: "juicedata/mount:ce-v1.0.4", want: false},
+		{image: "juicedata/mount:ce-v1.1.0", want: true},
+		{image: "juicedata/mount:ee-4.8.3", want: false},
+		{image: "juicedata/mount:ee-5.0.2-69f82b3", want: true},
+		{image: "juicedata/mount:ce-nightly", want: true},
+		{image: "juicedata/mount:custom", want: true},
+		{image: "", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := ImageSupportQuota(tt.image); got != tt.want {
+				t.Errorf("ImageSupportQuota() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetMountOptionsOfPod(t *testing.T) {
 	tests := []struct {
 		name string
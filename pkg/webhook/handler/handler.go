@@ -29,6 +29,7 @@ import (
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/common"
 	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/events"
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
 	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
 	"github.com/juicedata/juicefs-csi-driver/pkg/util"
@@ -95,6 +96,17 @@ func (s *SidecarHandler) Handle(ctx context.Context, request admission.Request)
 	handlerLog.Info("start injecting juicefs client as sidecar in pod", "name", pod.Name, "namespace", pod.Namespace)
 	out, err := sidecarMutate.Mutate(ctx, pod)
 	if err != nil {
+		// pods of workloads are retried by their controllers, events of the same PVC are rate limited
+		name := pod.Name
+		if name == "" {
+			name = pod.GenerateName
+		}
+		for _, p := range pair {
+			if e := events.NewRecorder(s.Client).Eventf(ctx, p.PVC, corev1.EventTypeWarning, events.ReasonInjectFailed, events.ActionInject,
+				"inject juicefs client as sidecar into pod %s/%s error: %v", pod.Namespace, name, err); e != nil {
+				handlerLog.Error(e, "create event error", "pvc", p.PVC.Name)
+			}
+		}
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 	pod = out
@@ -185,6 +197,43 @@ func (s *PVHandler) Handle(ctx context.Context, request admission.Request) admis
 	return admission.Allowed("")
 }
 
+type PVCHandler struct {
+	Client *k8sclient.K8sClient
+	// A decoder will be automatically injected
+	decoder admission.Decoder
+}
+
+func NewPVCHandler(client *k8sclient.K8sClient, scheme *runtime.Scheme) *PVCHandler {
+	return &PVCHandler{
+		Client:  client,
+		decoder: admission.NewDecoder(scheme),
+	}
+}
+
+func (s *PVCHandler) Handle(ctx context.Context, request admission.Request) admission.Response {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := s.decoder.Decode(request, pvc)
+	if err != nil {
+		handlerLog.Error(err, "unable to decoder pvc from req")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	out, changed, err := mutate.NewPVCMutate(s.Client).Mutate(ctx, pvc)
+	if err != nil {
+		// defaults are best effort, never block creating PVCs
+		handlerLog.Error(err, "inject defaults into pvc error", "namespace", pvc.Namespace, "name", pvc.Name)
+		return admission.Allowed("").WithWarnings(fmt.Sprintf("juicefs defaults are not injected: %v", err))
+	}
+	if !changed {
+		return admission.Allowed("")
+	}
+	marshaledPVC, err := json.Marshal(out)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(request.Object.Raw, marshaledPVC)
+}
+
 var (
 	evictLog = klog.NewKlogr().WithName("evict-pod-handler")
 )
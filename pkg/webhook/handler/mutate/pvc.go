@@ -0,0 +1,129 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package mutate
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+// PVCDefaultsAllKey is the key of the defaults in the policy ConfigMap that apply to PVCs of all juicefs
+// StorageClasses, other keys are StorageClass names whose defaults take precedence over them.
+// It can't be the name of a StorageClass.
+const PVCDefaultsAllKey = "_all"
+
+var pvcLog = klog.NewKlogr().WithName("pvc-mutate")
+
+// PVCDefaults are the annotations and labels injected into PVCs unless they are set on the PVC already
+type PVCDefaults struct {
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// PVCMutate injects the defaults of config.PVCDefaultsConfigMap into PVCs of juicefs StorageClasses,
+// so that features controlled by PVC annotations can be enabled cluster-wide or per StorageClass
+type PVCMutate struct {
+	client *k8sclient.K8sClient
+}
+
+func NewPVCMutate(client *k8sclient.K8sClient) *PVCMutate {
+	return &PVCMutate{client: client}
+}
+
+// Mutate returns the PVC with the defaults injected, and whether it's changed
+func (m *PVCMutate) Mutate(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, bool, error) {
+	if config.PVCDefaultsConfigMap == "" || pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return pvc, false, nil
+	}
+	scName := *pvc.Spec.StorageClassName
+	sc, err := m.client.GetStorageClass(ctx, scName)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return pvc, false, nil
+		}
+		return nil, false, err
+	}
+	if sc.Provisioner != config.DriverName {
+		return pvc, false, nil
+	}
+	cm, err := m.client.GetConfigMap(ctx, config.PVCDefaultsConfigMap, config.Namespace)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return pvc, false, nil
+		}
+		return nil, false, err
+	}
+	defaults, err := ParsePVCDefaults(cm, scName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	out := pvc.DeepCopy()
+	changed := false
+	out.Annotations, changed = mergeDefaults(out.Annotations, defaults.Annotations, changed)
+	out.Labels, changed = mergeDefaults(out.Labels, defaults.Labels, changed)
+	if changed {
+		pvcLog.V(1).Info("inject defaults into pvc", "namespace", pvc.Namespace, "name", pvc.Name, "storageClass", scName)
+	}
+	return out, changed, nil
+}
+
+// ParsePVCDefaults returns the defaults in the policy ConfigMap for PVCs of the StorageClass,
+// those of the StorageClass override those of all StorageClasses key by key
+func ParsePVCDefaults(cm *corev1.ConfigMap, scName string) (PVCDefaults, error) {
+	defaults := PVCDefaults{Annotations: map[string]string{}, Labels: map[string]string{}}
+	for _, key := range []string{PVCDefaultsAllKey, scName} {
+		data, ok := cm.Data[key]
+		if !ok {
+			continue
+		}
+		var d PVCDefaults
+		if err := yaml.Unmarshal([]byte(data), &d); err != nil {
+			return defaults, fmt.Errorf("parse %s of configmap %s/%s: %v", key, cm.Namespace, cm.Name, err)
+		}
+		for k, v := range d.Annotations {
+			defaults.Annotations[k] = v
+		}
+		for k, v := range d.Labels {
+			defaults.Labels[k] = v
+		}
+	}
+	return defaults, nil
+}
+
+// mergeDefaults sets the defaults absent in m, the values set by users are kept
+func mergeDefaults(m, defaults map[string]string, changed bool) (map[string]string, bool) {
+	for k, v := range defaults {
+		if _, ok := m[k]; ok {
+			continue
+		}
+		if m == nil {
+			m = map[string]string{}
+		}
+		m[k] = v
+		changed = true
+	}
+	return m, changed
+}
@@ -0,0 +1,79 @@
+/*
+ Copyright 2025 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package mutate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+
+	"github.com/juicedata/juicefs-csi-driver/pkg/common"
+	"github.com/juicedata/juicefs-csi-driver/pkg/config"
+	"github.com/juicedata/juicefs-csi-driver/pkg/k8sclient"
+)
+
+func TestPVCMutate(t *testing.T) {
+	defer func() { config.PVCDefaultsConfigMap = "" }()
+	config.PVCDefaultsConfigMap = "juicefs-pvc-defaults"
+	client := &k8sclient.K8sClient{Interface: fake.NewSimpleClientset(
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "jfs"}, Provisioner: config.DriverName},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "other"}, Provisioner: "other.csi.io"},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "juicefs-pvc-defaults", Namespace: config.Namespace},
+			Data: map[string]string{
+				PVCDefaultsAllKey: "annotations:\n  juicefs.com/upload-limit: 100\n  juicefs.com/download-limit: 200\nlabels:\n  backup: daily\n",
+				"jfs":             "annotations:\n  juicefs.com/download-limit: 400\n",
+				"other":           "labels:\n  backup: never\n",
+			},
+		},
+	)}
+	m := NewPVCMutate(client)
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default", Annotations: map[string]string{common.UploadLimitKey: "10M"}},
+		Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: ptr.To("jfs")},
+	}
+	out, changed, err := m.Mutate(context.TODO(), pvc)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	// set by the user
+	assert.Equal(t, "10M", out.Annotations[common.UploadLimitKey])
+	// defaults of the StorageClass override those of all StorageClasses
+	assert.Equal(t, "400", out.Annotations[common.DownloadLimitKey])
+	assert.Equal(t, map[string]string{"backup": "daily"}, out.Labels)
+	assert.Nil(t, pvc.Labels)
+
+	_, changed, err = m.Mutate(context.TODO(), out)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	for _, sc := range []*string{nil, ptr.To("other"), ptr.To("missing")} {
+		pvc := &corev1.PersistentVolumeClaim{Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: sc}}
+		_, changed, err := m.Mutate(context.TODO(), pvc)
+		assert.NoError(t, err)
+		assert.False(t, changed)
+	}
+
+	_, err = ParsePVCDefaults(&corev1.ConfigMap{Data: map[string]string{"jfs": "annotations: [a"}}, "jfs")
+	assert.Error(t, err)
+}
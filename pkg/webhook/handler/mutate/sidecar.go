@@ -142,6 +142,10 @@ func (s *SidecarMutate) mutate(ctx context.Context, pod *corev1.Pod, pair resour
 		return nil, fmt.Errorf("capacity %d is too small, at least 1GiB for quota", capacity)
 	}
 
+	if jfsSetting.ExternalSecrets {
+		return nil, fmt.Errorf("secrets from an external secret provider are not supported in sidecar mode")
+	}
+
 	var r builder.SidecarInterface
 	if !s.Serverless {
 		r = builder.NewContainerBuilder(jfsSetting, cap)
@@ -32,6 +32,7 @@ const (
 	SecretPath     = "/juicefs/validate-secret"
 	PVPath         = "/juicefs/validate-pv"
 	EvictPodPath   = "/juicefs/validate-evict-pod"
+	PVCPath        = "/juicefs/mutate-pvc"
 )
 
 var (
@@ -47,6 +48,8 @@ func Register(mgr manager.Manager, client *k8sclient.K8sClient) {
 	webhookLog.Info("Registered webhook handler for sidecar", "path", SidecarPath)
 	server.Register(ServerlessPath, &webhook.Admission{Handler: NewSidecarHandler(client, true, scheme)})
 	webhookLog.Info("Registered webhook handler path for serverless", "path", ServerlessPath)
+	server.Register(PVCPath, &webhook.Admission{Handler: NewPVCHandler(client, scheme)})
+	webhookLog.Info("Registered webhook handler for pvc defaults", "path", PVCPath)
 	if config.ValidatingWebhook {
 		server.Register(SecretPath, &webhook.Admission{Handler: NewSecretHandler(client, scheme)})
 		server.Register(PVPath, &webhook.Admission{Handler: NewPVHandler(client, scheme)})
@@ -58,7 +58,7 @@ func (s *SecretValidator) Validate(ctx context.Context, secret corev1.Secret) er
 		if metaUrl == "" {
 			return fmt.Errorf("metaurl is empty")
 		}
-		if err := s.jfs.Status(ctx, metaUrl); err != nil {
+		if err := s.jfs.Status(ctx, metaUrl, jfsSetting.Envs); err != nil {
 			return err
 		}
 	} else {
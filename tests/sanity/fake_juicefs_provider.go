@@ -26,6 +26,7 @@ import (
 	"k8s.io/utils/mount"
 
 	"github.com/juicedata/juicefs-csi-driver/pkg/juicefs"
+	jfsmount "github.com/juicedata/juicefs-csi-driver/pkg/juicefs/mount"
 )
 
 type fakeJfs struct {
@@ -60,10 +61,30 @@ func (j *fakeJfsProvider) JfsCreateVol(ctx context.Context, volumeID string, sub
 	return nil
 }
 
+func (j *fakeJfsProvider) JfsFormatVol(ctx context.Context, volumeID string, secrets, volCtx map[string]string) error {
+	return nil
+}
+
 func (j *fakeJfsProvider) JfsDeleteVol(ctx context.Context, volumeID string, target string, secrets, volCtx map[string]string, options []string) error {
 	return nil
 }
 
+func (j *fakeJfsProvider) JfsDeleteSubPath(ctx context.Context, volumeID string, subPath string, secrets, volCtx map[string]string, options []string) error {
+	return nil
+}
+
+func (j *fakeJfsProvider) JfsCloneVol(ctx context.Context, volumeID string, srcSubPath, dstSubPath string, secrets, volCtx map[string]string) error {
+	return nil
+}
+
+func (j *fakeJfsProvider) JfsDeleteSnapshot(ctx context.Context, snapshotID string, snapshotPath string, secrets map[string]string) error {
+	return nil
+}
+
+func (j *fakeJfsProvider) JfsListSubdirs(ctx context.Context, volumeID string, secrets, volCtx map[string]string, options []string) ([]jfsmount.Subdir, error) {
+	return nil, nil
+}
+
 func (j *fakeJfsProvider) JfsMount(ctx context.Context, volumeID string, target string, secrets, volCtx map[string]string, options []string) (juicefs.Jfs, error) {
 	jfsName := "fake"
 	fs, ok := j.fs[jfsName]
@@ -104,6 +125,10 @@ func (j *fakeJfsProvider) SetQuota(ctx context.Context, secrets map[string]strin
 	return nil
 }
 
+func (j *fakeJfsProvider) GetQuota(ctx context.Context, secrets map[string]string, jfsSetting *config.JfsSetting, quotaPath string) (int64, error) {
+	return 0, nil
+}
+
 func (j *fakeJfsProvider) GetSubPath(ctx context.Context, volumeID string) (string, error) {
 	return volumeID, nil
 }
@@ -138,6 +163,14 @@ func (fs *fakeJfs) BindTarget(ctx context.Context, bindSource, target string) er
 	return nil
 }
 
-func (j *fakeJfsProvider) Status(ctx context.Context, metaUrl string) error {
+func (j *fakeJfsProvider) Status(ctx context.Context, metaUrl string, envs map[string]string) error {
 	return nil
 }
+
+func (j *fakeJfsProvider) JfsFormatDrift(ctx context.Context, secrets map[string]string, reconcile bool) ([]config.FormatDrift, error) {
+	return nil, nil
+}
+
+func (j *fakeJfsProvider) JfsListSessions(ctx context.Context, secrets map[string]string) ([]juicefs.Session, error) {
+	return nil, nil
+}
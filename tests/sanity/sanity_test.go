@@ -56,5 +56,6 @@ var _ = AfterSuite(func() {
 var _ = Describe("JuiceFS CSI Driver", func() {
 	config := sanity.NewTestConfig()
 	config.Address = endpoint
+	config.SecretsFile = "secrets.yaml"
 	sanity.GinkgoTest(&config)
 })